@@ -16,13 +16,17 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -152,31 +156,89 @@ func GoogleServiceTokenSource() oauth2.TokenSource {
 
 // GoogleClientFromJSONKey  provides an http.Client authorized with an
 // oauth2 token retrieved using a Google Developers service account's
-// private JSON key file.
+// private JSON key file. Besides service account keys, the JSON
+// credentials of workload identity federation (external_account) and of
+// impersonated service accounts are accepted.
 func GoogleClientFromJSONKey(jsonKey []byte, scope ...string) (*http.Client, error) {
+	ts, err := GoogleTokenSourceFromJSONKey(jsonKey, scope...)
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth2.NewClient(oauth2.NoContext, ts), nil
+}
+
+// GoogleTokenSourceFromJSONKey provides an oauth2.TokenSource
+// authorized in the same manner as GoogleClientFromJSONKey.
+func GoogleTokenSourceFromJSONKey(jsonKey []byte, scope ...string) (oauth2.TokenSource, error) {
 	if scope == nil {
 		scope = conf.Scopes
 	}
-	jwtConf, err := google.JWTConfigFromJSON(jsonKey, scope...)
+
+	creds, err := google.CredentialsFromJSON(oauth2.NoContext, jsonKey, scope...)
 	if err != nil {
 		return nil, err
 	}
 
-	return jwtConf.Client(oauth2.NoContext), nil
+	return creds.TokenSource, nil
+}
 
+// GoogleImpersonatedClient provides an http.Client authorized with the
+// tokens of GoogleImpersonatedTokenSource.
+func GoogleImpersonatedClient(ts oauth2.TokenSource, serviceAccount string, scope ...string) *http.Client {
+	return oauth2.NewClient(oauth2.NoContext, GoogleImpersonatedTokenSource(ts, serviceAccount, scope...))
 }
 
-// GoogleTokenSourceFromJSONKey provides an oauth2.TokenSource
-// authorized in the same manner as GoogleClientFromJSONKey.
-func GoogleTokenSourceFromJSONKey(jsonKey []byte, scope ...string) (oauth2.TokenSource, error) {
+// GoogleImpersonatedTokenSource provides an oauth2.TokenSource for the
+// serviceAccount email, impersonated with the tokens of ts through the
+// IAM credentials API. The tokens of ts need the cloud-platform scope and
+// the principal the Service Account Token Creator role.
+func GoogleImpersonatedTokenSource(ts oauth2.TokenSource, serviceAccount string, scope ...string) oauth2.TokenSource {
 	if scope == nil {
 		scope = conf.Scopes
 	}
+	return oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+		client:         oauth2.NewClient(oauth2.NoContext, ts),
+		serviceAccount: serviceAccount,
+		scopes:         scope,
+	})
+}
 
-	jwtConf, err := google.JWTConfigFromJSON(jsonKey, scope...)
+type impersonatedTokenSource struct {
+	client         *http.Client
+	serviceAccount string
+	scopes         []string
+}
+
+func (s *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(struct {
+		Scope    []string `json:"scope"`
+		Lifetime string   `json:"lifetime"`
+	}{s.scopes, "3600s"})
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken", s.serviceAccount)
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("impersonating %s: %s: %s", s.serviceAccount, resp.Status, msg)
+	}
 
-	return jwtConf.TokenSource(oauth2.NoContext), nil
+	var tok struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: tok.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      tok.ExpireTime,
+	}, nil
 }
@@ -0,0 +1,206 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	KubeConfigPath = ".kube/config"
+
+	// in-cluster service account credentials of pods
+	kubeServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// KubeProfile holds the credentials of one kubeconfig context.
+type KubeProfile struct {
+	Server    string
+	Namespace string
+	Insecure  bool
+
+	// PEM data
+	CAData         []byte
+	ClientCertData []byte
+	ClientKeyData  []byte
+
+	Token string
+}
+
+// kubeConfig is the subset of the kubeconfig format Mantle supports.
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// ReadKubeConfig reads the credentials of the named context from a
+// kubeconfig file, or of the current context if name is empty. Only
+// static credentials are supported, exec and auth provider plugins are
+// not.
+//
+// If path is empty, $KUBECONFIG is read, or if unset $HOME/.kube/config.
+// If neither exists and Mantle runs in a pod, the service account of the
+// pod is used.
+func ReadKubeConfig(path, name string) (*KubeProfile, error) {
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		user, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(user.HomeDir, KubeConfigPath)
+		if _, err := os.Stat(path); os.IsNotExist(err) && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			return readInClusterConfig()
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	if name == "" {
+		name = config.CurrentContext
+	}
+	profile := &KubeProfile{}
+	var clusterName, userName string
+	for _, c := range config.Contexts {
+		if c.Name == name {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+			profile.Namespace = c.Context.Namespace
+			break
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %q has no context %q", path, name)
+	}
+
+	// relative file references are relative to the kubeconfig
+	dir := filepath.Dir(path)
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		profile.Server = c.Cluster.Server
+		profile.Insecure = c.Cluster.InsecureSkipTLSVerify
+		if profile.CAData, err = dataOrFile(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir); err != nil {
+			return nil, err
+		}
+	}
+	if profile.Server == "" {
+		return nil, fmt.Errorf("kubeconfig %q has no server for cluster %q", path, clusterName)
+	}
+
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		if profile.ClientCertData, err = dataOrFile(u.User.ClientCertificateData, u.User.ClientCertificate, dir); err != nil {
+			return nil, err
+		}
+		if profile.ClientKeyData, err = dataOrFile(u.User.ClientKeyData, u.User.ClientKey, dir); err != nil {
+			return nil, err
+		}
+		profile.Token = u.User.Token
+		if profile.Token == "" && u.User.TokenFile != "" {
+			token, err := os.ReadFile(resolvePath(u.User.TokenFile, dir))
+			if err != nil {
+				return nil, err
+			}
+			profile.Token = string(token)
+		}
+	}
+
+	return profile, nil
+}
+
+func readInClusterConfig() (*KubeProfile, error) {
+	token, err := os.ReadFile(filepath.Join(kubeServiceAccountPath, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(filepath.Join(kubeServiceAccountPath, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := os.ReadFile(filepath.Join(kubeServiceAccountPath, "namespace"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubeProfile{
+		Server:    "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+		Namespace: string(namespace),
+		CAData:    ca,
+		Token:     string(token),
+	}, nil
+}
+
+func dataOrFile(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolvePath(file, dir))
+	}
+	return nil, nil
+}
+
+func resolvePath(path, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
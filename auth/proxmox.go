@@ -0,0 +1,65 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+const ProxmoxConfigPath = ".config/proxmox.json"
+
+// ProxmoxProfile represents a parsed Proxmox VE profile. API tokens are
+// created in the Proxmox UI under Datacenter -> Permissions -> API Tokens.
+type ProxmoxProfile struct {
+	URL         string `json:"url"`
+	TokenID     string `json:"token_id"`
+	TokenSecret string `json:"token_secret"`
+	Node        string `json:"node"`
+	Insecure    bool   `json:"insecure"`
+}
+
+// ReadProxmoxConfig decodes a Proxmox VE config file, which is a custom
+// format used by Mantle to hold API token credentials.
+//
+// If path is empty, $HOME/.config/proxmox.json is read.
+func ReadProxmoxConfig(path string) (map[string]ProxmoxProfile, error) {
+	if path == "" {
+		user, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(user.HomeDir, ProxmoxConfigPath)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles map[string]ProxmoxProfile
+	if err := json.NewDecoder(f).Decode(&profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("Proxmox config %q contains no profiles", path)
+	}
+
+	return profiles, nil
+}
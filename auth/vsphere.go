@@ -0,0 +1,70 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+const VSphereConfigPath = ".config/vsphere.json"
+
+// VSphereProfile represents a parsed vSphere profile. Besides the vCenter
+// credentials it names the inventory objects machines are created in,
+// empty fields fall back to the defaults of the vCenter.
+type VSphereProfile struct {
+	Server       string `json:"server"`
+	User         string `json:"user"`
+	Password     string `json:"password"`
+	Insecure     bool   `json:"insecure"`
+	Datacenter   string `json:"datacenter,omitempty"`
+	ResourcePool string `json:"resource_pool,omitempty"`
+	Datastore    string `json:"datastore,omitempty"`
+	Network      string `json:"network,omitempty"`
+	Folder       string `json:"folder,omitempty"`
+}
+
+// ReadVSphereConfig decodes a vSphere config file, which is a custom
+// format used by Mantle to hold vCenter credentials and placement.
+//
+// If path is empty, $HOME/.config/vsphere.json is read.
+func ReadVSphereConfig(path string) (map[string]VSphereProfile, error) {
+	if path == "" {
+		user, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(user.HomeDir, VSphereConfigPath)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles map[string]VSphereProfile
+	if err := json.NewDecoder(f).Decode(&profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("vSphere config %q contains no profiles", path)
+	}
+
+	return profiles, nil
+}
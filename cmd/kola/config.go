@@ -0,0 +1,143 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the name of the configuration file looked up in the
+// current directory, for the project, and in the user's configuration
+// directory.
+const configFileName = "kola.yaml"
+
+// applyConfig sets the flags of cmd not given on the command line from the
+// configuration files: --config or ./kola.yaml, then the user's
+// kola/kola.yaml. The keys are flag names, nested maps are joined with
+// "-", e.g. aws: {region: us-east-1} sets --aws-region.
+func applyConfig(cmd *cobra.Command) error {
+	var files []string
+	if kolaConfigFile != "" {
+		files = append(files, kolaConfigFile)
+	} else if _, err := os.Stat(configFileName); err == nil {
+		files = append(files, configFileName)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		path := filepath.Join(dir, "kola", configFileName)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+
+	for _, path := range files {
+		if err := applyConfigFile(cmd.Flags(), path); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// applyConfigFile sets the flags of the configuration file path which
+// are not set yet.
+func applyConfigFile(flags *pflag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	values := make(map[string][]string)
+	if err := flattenConfig(values, "", doc); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			// the file may hold the flags of other commands
+			if !flagKnown(name) {
+				return fmt.Errorf("unknown option %q", name)
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		for _, value := range values[name] {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("option %q: %v", name, err)
+			}
+		}
+	}
+	plog.Infof("Using the options of %s", path)
+	return nil
+}
+
+// flattenConfig collects the values of doc by flag name into values,
+// lists give a value per element.
+func flattenConfig(values map[string][]string, prefix string, doc map[string]interface{}) error {
+	for key, v := range doc {
+		name := prefix + key
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := flattenConfig(values, name+"-", v); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, e := range v {
+				switch e.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("option %q: nested lists and maps are not supported", name)
+				}
+				values[name] = append(values[name], fmt.Sprint(e))
+			}
+		case nil:
+		default:
+			values[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
+
+// flagKnown reports whether any kola command has the flag name.
+func flagKnown(name string) bool {
+	var known func(cmd *cobra.Command) bool
+	known = func(cmd *cobra.Command) bool {
+		if cmd.PersistentFlags().Lookup(name) != nil || cmd.Flags().Lookup(name) != nil {
+			return true
+		}
+		for _, sub := range cmd.Commands() {
+			if known(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return known(root)
+}
@@ -0,0 +1,134 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/harness/results"
+)
+
+var (
+	cmdDiff = &cobra.Command{
+		Use:   "diff <run-a> <run-b>",
+		Short: "Compare the results of two runs",
+		Long: `Compare the results of two runs of the same tests, usually on different
+image versions, and report the tests newly failing, newly passing and
+taking a lot longer in run-b.
+
+The runs are given as output directories or report.json files. The exit
+status is 1 if tests newly fail or got slower.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  runDiff,
+	}
+
+	diffSlowdownFactor float64
+	diffMinDuration    time.Duration
+	diffJSON           bool
+)
+
+func init() {
+	root.AddCommand(cmdDiff)
+
+	cmdDiff.Flags().Float64Var(&diffSlowdownFactor, "slowdown-factor", 1.5, "report tests taking this many times longer, 0 to ignore durations")
+	cmdDiff.Flags().DurationVar(&diffMinDuration, "min-duration", 10*time.Second, "ignore the durations of tests taking less in both runs")
+	cmdDiff.Flags().BoolVar(&diffJSON, "json", false, "print the comparison as JSON")
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	var runs []*results.Run
+	for _, arg := range args {
+		run, err := readRun(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		runs = append(runs, run)
+	}
+
+	d := results.Diff(runs[0], runs[1], results.DiffOptions{
+		SlowdownFactor: diffSlowdownFactor,
+		MinDuration:    diffMinDuration,
+	})
+	if diffJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(d); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		printDiff(os.Stdout, d)
+	}
+
+	if d.Regressed() {
+		os.Exit(1)
+	}
+}
+
+// readRun reads the run in the output directory or report file path.
+func readRun(path string) (*results.Run, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, "reports", "report.json")
+	}
+	return results.Read(path)
+}
+
+func printDiff(w io.Writer, d *results.RunDiff) {
+	fmt.Fprintf(w, "Comparing %s to %s\n", d.OldVersion, d.NewVersion)
+
+	section := func(title string, tests []results.TestDiff, line func(results.TestDiff) string) {
+		if len(tests) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, t := range tests {
+			fmt.Fprintf(w, "  %s\n", line(t))
+		}
+	}
+	section("Newly failing", d.NewlyFailing, func(t results.TestDiff) string {
+		return t.Name
+	})
+	section("Newly passing", d.NewlyPassing, func(t results.TestDiff) string {
+		return t.Name
+	})
+	section("Slower", d.Slower, func(t results.TestDiff) string {
+		return fmt.Sprintf("%s: %v -> %v", t.Name, t.OldDuration.Round(time.Second), t.NewDuration.Round(time.Second))
+	})
+
+	names := func(title string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+	names("Only in "+d.NewVersion, d.Added)
+	names("Only in "+d.OldVersion, d.Removed)
+
+	if !d.Regressed() {
+		fmt.Fprintln(w, "\nNo regressions")
+	}
+}
@@ -29,8 +29,12 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/harness"
 	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/metrics"
+	"github.com/flatcar/mantle/platform/tracing"
 
 	// register OS test suite
 	_ "github.com/flatcar/mantle/kola/registry"
@@ -53,6 +57,10 @@ var (
 If the glob pattern is exactly equal to the name of a single test, any
 restrictions on the versions of Container Linux supported by that test
 will be ignored.
+
+A pattern can select subtests after a slash like go test -run, with one
+regexp per level, e.g. 'systemd.sysext.simple/reload' runs only the
+reload subtest.
 `,
 		Run:    runRun,
 		PreRun: preRun,
@@ -64,12 +72,24 @@ will be ignored.
 		Run:   runList,
 	}
 
-	listJSON   bool
-	listFilter bool
-
-	runRemove     bool
-	runSetSSHKeys bool
-	runSSHKeys    []string
+	listJSON      bool
+	listFilter    bool
+	listDurations []string
+
+	runRemove        bool
+	runSetSSHKeys    bool
+	runSSHKeys       []string
+	runEncryptTo     string
+	runMarkerURL     string
+	runMarkerKey     string
+	runAuditLog      bool
+	runMetricsAddr   string
+	runOTLPAddr      string
+	runOTLPNoTLS     bool
+	runQuarantine    string
+	runDurationsDB   string
+	runDurationsFrom string
+	runShard         string
 )
 
 func init() {
@@ -77,11 +97,24 @@ func init() {
 	root.AddCommand(cmdList)
 
 	cmdList.Flags().BoolVar(&listJSON, "json", false, "format output in JSON")
+	cmdList.Flags().StringSliceVar(&listDurations, "durations", nil, "estimate the durations of the tests from the reports/report.json of earlier runs (can be repeated)")
 	cmdList.Flags().BoolVar(&listFilter, "filter", false, "Filter by --platform and --distro, required for glob patterns, uses '*' as pattern if no pattern is specified")
 
 	cmdRun.Flags().BoolVarP(&runRemove, "remove", "r", true, "remove instances after test exits (--remove=false will keep them)")
 	cmdRun.Flags().BoolVarP(&runSetSSHKeys, "keys", "k", false, "add SSH keys from --key options")
 	cmdRun.Flags().StringSliceVar(&runSSHKeys, "key", nil, "path to SSH public key (default: SSH agent + ~/.ssh/id_{rsa,dsa,ecdsa,ed25519}.pub)")
+	cmdRun.Flags().StringVar(&runEncryptTo, "encrypt-to", "", "encrypt the output directory except test results after the run, to an age recipient (age1...) or the path of an OpenPGP public key")
+	cmdRun.Flags().StringVar(&runMarkerURL, "publish-marker", "", "after a passing run, publish a signed marker with the version and results to this gs:// or http(s):// URL")
+	cmdRun.Flags().StringVar(&runMarkerKey, "marker-signing-key", "", "path to the OpenPGP private key used to sign the --publish-marker marker")
+	cmdRun.Flags().BoolVar(&runAuditLog, "audit-log", true, "record all mutating cloud API calls in audit.jsonl in the output directory")
+	cmdRun.Flags().StringVar(&runMetricsAddr, "metrics-addr", "", "serve Prometheus metrics of the run at /metrics on this host:port")
+	cmdRun.Flags().StringVar(&runOTLPAddr, "otlp-endpoint", "", "export OpenTelemetry traces of the test phases over OTLP/HTTP to this collector host:port")
+	cmdRun.Flags().BoolVar(&runOTLPNoTLS, "otlp-insecure", false, "export traces to --otlp-endpoint without TLS")
+	cmdRun.Flags().StringVar(&runQuarantine, "quarantine", "", "file with glob patterns of known flaky tests, one per line, whose failures are reported as QUARANTINED and don't fail the run")
+	cmdRun.Flags().StringVar(&runDurationsDB, "durations-db", "", "path or gs:// URL of a database of test durations, used to start the longest tests first and to balance --shard, and updated after the run")
+	cmdRun.Flags().StringVar(&runDurationsFrom, "durations-from", "", "path or gs:// URL of a durations database which is only read, used instead of --durations-db to order the tests and balance --shard")
+	cmdRun.Flags().StringVar(&runShard, "shard", "", "run only shard `i/n` of the tests, split into n shards of about the same duration")
+	cmdRun.Flags().IntVar(&kola.InfraRetries, "infra-retries", 0, "run tests that failed because of the infrastructure, e.g. cloud API errors, exhausted quotas or unreachable machines, again up to this many times")
 
 }
 
@@ -90,6 +123,11 @@ func main() {
 }
 
 func preRun(cmd *cobra.Command, args []string) {
+	if err := applyConfig(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(3)
+	}
+
 	err := syncOptions()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -113,6 +151,58 @@ func runRun(cmd *cobra.Command, args []string) {
 		patterns = []string{"*"} // run all tests by default
 	}
 
+	if runEncryptTo != "" {
+		if err := kola.CheckEncryptRecipient(runEncryptTo); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if runMarkerURL != "" {
+		if err := kola.CheckMarkerTarget(runMarkerURL, runMarkerKey); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if runQuarantine != "" {
+		quarantine, err := harness.LoadQuarantine(runQuarantine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loading the quarantine list: %v\n", err)
+			os.Exit(1)
+		}
+		kola.Quarantine = quarantine
+	}
+
+	if runShard != "" {
+		var shard, shards int
+		if _, err := fmt.Sscanf(runShard, "%d/%d", &shard, &shards); err != nil || shard < 1 || shard > shards {
+			fmt.Fprintf(os.Stderr, "invalid --shard %q: must be i/n with 1 <= i <= n\n", runShard)
+			os.Exit(1)
+		}
+		kola.Shard, kola.Shards = shard-1, shards
+
+		// every shard updates --durations-db, so the shards started
+		// later would see other durations and disagree on the split
+		if runDurationsDB != "" && runDurationsFrom == "" {
+			fmt.Fprintf(os.Stderr, "--shard with --durations-db needs a snapshot of the database in --durations-from\n")
+			os.Exit(1)
+		}
+	}
+
+	durationsFrom := runDurationsFrom
+	if durationsFrom == "" {
+		durationsFrom = runDurationsDB
+	}
+	if durationsFrom != "" {
+		db, err := kola.LoadDurationsDB(durationsFrom)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		kola.Durations = db.Durations()
+	}
+
 	var err error
 	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
 	if err != nil {
@@ -120,6 +210,31 @@ func runRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if runAuditLog {
+		if err := audit.Open(filepath.Join(outputDir, "audit.jsonl")); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if runMetricsAddr != "" {
+		addr, err := metrics.Serve(runMetricsAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		defer metrics.Close()
+		kola.Metrics = true
+		plog.Noticef("Serving metrics at http://%s/metrics", addr)
+	}
+
+	if runOTLPAddr != "" {
+		if err := tracing.Start(runOTLPAddr, "kola", runOTLPNoTLS); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	var sshKeys []agent.Key
 	if runSetSSHKeys {
 		sshKeys, err = GetSSHKeys(runSSHKeys)
@@ -132,12 +247,59 @@ func runRun(cmd *cobra.Command, args []string) {
 	}
 	runErr := kola.RunTests(patterns, kolaChannel, kolaOffering, kolaPlatform, outputDir, &sshKeys, runRemove)
 
+	// flush the traces before exiting on errors below
+	if err := tracing.Stop(); err != nil {
+		plog.Errorf("Exporting traces failed: %v", err)
+	}
+
+	if err := audit.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "writing audit log: %v\n", err)
+		os.Exit(1)
+	}
+
 	// needs to be after RunTests() because harness empties the directory
 	if err := writeProps(); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
+	if runDurationsDB != "" {
+		// read the database again to keep the updates of runs that
+		// finished in the meantime, e.g. other shards
+		db, err := kola.LoadDurationsDB(runDurationsDB)
+		if err == nil {
+			err = db.UpdateFromOutputDir(outputDir)
+		}
+		if err == nil {
+			err = db.Save(runDurationsDB)
+		}
+		if err != nil {
+			plog.Errorf("Updating the durations database: %v", err)
+		}
+	}
+
+	if runErr == nil && runMarkerURL != "" {
+		marker, err := kola.NewMarker(outputDir, kolaPlatform, kolaChannel, kola.QEMUOptions.Board)
+		if err == nil {
+			err = kola.PublishMarker(marker, runMarkerURL, runMarkerKey)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "publishing marker: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if runEncryptTo != "" {
+		if err := kola.EncryptOutputDir(outputDir, runEncryptTo); err != nil {
+			fmt.Fprintf(os.Stderr, "encrypting output directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := kola.FinishRun(runErr); err != nil {
+		plog.Errorf("Recording the result of the run: %v", err)
+	}
+
 	if runErr != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", runErr)
 		os.Exit(1)
@@ -154,21 +316,30 @@ func writeProps() error {
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "    ")
 
-	type AWS struct {
-		Region       string `json:"region"`
+	type AWSMatrixEntry struct {
+		Board        string `json:"board"`
 		AMI          string `json:"ami"`
 		InstanceType string `json:"type"`
 	}
+	type AWS struct {
+		Region       string           `json:"region"`
+		AMI          string           `json:"ami"`
+		InstanceType string           `json:"type"`
+		IMDSv2Only   bool             `json:"imdsv2_only"`
+		Spot         bool             `json:"spot"`
+		Matrix       []AWSMatrixEntry `json:"matrix,omitempty"`
+	}
 	type Azure struct {
-		DiskURI   string `json:"diskUri"`
-		BlobURL   string `json:"blobUrl"`
-		ImageFile string `json:"imageFile"`
-		Publisher string `json:"publisher"`
-		Offer     string `json:"offer"`
-		Sku       string `json:"sku"`
-		Version   string `json:"version"`
-		Location  string `json:"location"`
-		Size      string `json:"size"`
+		DiskURI      string `json:"diskUri"`
+		BlobURL      string `json:"blobUrl"`
+		ImageFile    string `json:"imageFile"`
+		Publisher    string `json:"publisher"`
+		Offer        string `json:"offer"`
+		Sku          string `json:"sku"`
+		Version      string `json:"version"`
+		Location     string `json:"location"`
+		Size         string `json:"size"`
+		SecurityType string `json:"securityType"`
 	}
 	type DO struct {
 		Region string `json:"region"`
@@ -180,24 +351,56 @@ func writeProps() error {
 		BaseVMName string `json:"base_vm_name"`
 	}
 	type GCE struct {
-		Image       string `json:"image"`
-		MachineType string `json:"type"`
+		Image               string `json:"image"`
+		MachineType         string `json:"type"`
+		SecureBoot          bool   `json:"secure_boot"`
+		VTPM                bool   `json:"vtpm"`
+		IntegrityMonitoring bool   `json:"integrity_monitoring"`
+		ConfidentialCompute bool   `json:"confidential_compute"`
 	}
 	type OpenStack struct {
-		Region string `json:"region"`
-		Image  string `json:"image"`
-		Flavor string `json:"flavor"`
+		Region      string `json:"region"`
+		Image       string `json:"image"`
+		Flavor      string `json:"flavor"`
+		ConfigDrive bool   `json:"config_drive"`
 	}
 	type EquinixMetal struct {
-		Facility              string `json:"facility"`
-		Plan                  string `json:"plan"`
-		InstallerImageBaseURL string `json:"installer"`
-		ImageURL              string `json:"image"`
+		Facility              string   `json:"facility"`
+		Plan                  string   `json:"plan"`
+		InstallerImageBaseURL string   `json:"installer"`
+		ImageURL              string   `json:"image"`
+		HardwareReservations  []string `json:"hardware_reservations"`
+		SpotInstance          bool     `json:"spot"`
+		SpotPriceMax          float64  `json:"spot_price_max"`
+	}
+	type Proxmox struct {
+		URL      string `json:"url"`
+		Node     string `json:"node"`
+		Template int    `json:"template"`
+	}
+	type Scaleway struct {
+		Zone         string `json:"zone"`
+		InstanceType string `json:"type"`
+		Image        string `json:"image"`
+	}
+	type KubeVirt struct {
+		Namespace string `json:"namespace"`
+		Image     string `json:"image"`
+	}
+	type VSphere struct {
+		Server   string `json:"server"`
+		Template string `json:"template"`
+		OVA      string `json:"ova"`
 	}
 	type QEMU struct {
 		Image   string `json:"image"`
 		Mangled bool   `json:"mangled"`
 	}
+	var awsMatrix []AWSMatrixEntry
+	for _, entry := range kola.AWSMatrix {
+		awsMatrix = append(awsMatrix, AWSMatrixEntry(entry))
+	}
+
 	return enc.Encode(&struct {
 		Cmdline         []string     `json:"cmdline"`
 		Platform        string       `json:"platform"`
@@ -210,9 +413,13 @@ func writeProps() error {
 		DO              DO           `json:"do"`
 		ESX             ESX          `json:"esx"`
 		GCE             GCE          `json:"gce"`
+		KubeVirt        KubeVirt     `json:"kubevirt"`
 		OpenStack       OpenStack    `json:"openstack"`
 		EquinixMetal    EquinixMetal `json:"equinixmetal"`
+		Proxmox         Proxmox      `json:"proxmox"`
 		QEMU            QEMU         `json:"qemu"`
+		Scaleway        Scaleway     `json:"scaleway"`
+		VSphere         VSphere      `json:"vsphere"`
 	}{
 		Cmdline:         os.Args,
 		Platform:        kolaPlatform,
@@ -224,17 +431,21 @@ func writeProps() error {
 			Region:       kola.AWSOptions.Region,
 			AMI:          kola.AWSOptions.AMI,
 			InstanceType: kola.AWSOptions.InstanceType,
+			IMDSv2Only:   kola.AWSOptions.IMDSv2Only,
+			Spot:         kola.AWSOptions.Spot,
+			Matrix:       awsMatrix,
 		},
 		Azure: Azure{
-			DiskURI:   kola.AzureOptions.DiskURI,
-			BlobURL:   kola.AzureOptions.BlobURL,
-			ImageFile: kola.AzureOptions.ImageFile,
-			Publisher: kola.AzureOptions.Publisher,
-			Offer:     kola.AzureOptions.Offer,
-			Sku:       kola.AzureOptions.Sku,
-			Version:   kola.AzureOptions.Version,
-			Location:  kola.AzureOptions.Location,
-			Size:      kola.AzureOptions.Size,
+			DiskURI:      kola.AzureOptions.DiskURI,
+			BlobURL:      kola.AzureOptions.BlobURL,
+			ImageFile:    kola.AzureOptions.ImageFile,
+			Publisher:    kola.AzureOptions.Publisher,
+			Offer:        kola.AzureOptions.Offer,
+			Sku:          kola.AzureOptions.Sku,
+			Version:      kola.AzureOptions.Version,
+			Location:     kola.AzureOptions.Location,
+			Size:         kola.AzureOptions.Size,
+			SecurityType: kola.AzureOptions.SecurityType,
 		},
 		DO: DO{
 			Region: kola.DOOptions.Region,
@@ -246,24 +457,51 @@ func writeProps() error {
 			BaseVMName: kola.ESXOptions.BaseVMName,
 		},
 		GCE: GCE{
-			Image:       kola.GCEOptions.Image,
-			MachineType: kola.GCEOptions.MachineType,
+			Image:               kola.GCEOptions.Image,
+			MachineType:         kola.GCEOptions.MachineType,
+			SecureBoot:          kola.GCEOptions.SecureBoot,
+			VTPM:                kola.GCEOptions.VTPM,
+			IntegrityMonitoring: kola.GCEOptions.IntegrityMonitoring,
+			ConfidentialCompute: kola.GCEOptions.ConfidentialCompute,
 		},
 		OpenStack: OpenStack{
-			Region: kola.OpenStackOptions.Region,
-			Image:  kola.OpenStackOptions.Image,
-			Flavor: kola.OpenStackOptions.Flavor,
+			Region:      kola.OpenStackOptions.Region,
+			Image:       kola.OpenStackOptions.Image,
+			Flavor:      kola.OpenStackOptions.Flavor,
+			ConfigDrive: kola.OpenStackOptions.ConfigDrive,
 		},
 		EquinixMetal: EquinixMetal{
 			Facility:              kola.EquinixMetalOptions.Facility,
 			Plan:                  kola.EquinixMetalOptions.Plan,
 			InstallerImageBaseURL: kola.EquinixMetalOptions.InstallerImageBaseURL,
 			ImageURL:              kola.EquinixMetalOptions.ImageURL,
+			HardwareReservations:  kola.EquinixMetalOptions.HardwareReservations,
+			SpotInstance:          kola.EquinixMetalOptions.SpotInstance,
+			SpotPriceMax:          kola.EquinixMetalOptions.SpotPriceMax,
+		},
+		Proxmox: Proxmox{
+			URL:      kola.ProxmoxOptions.URL,
+			Node:     kola.ProxmoxOptions.Node,
+			Template: kola.ProxmoxOptions.Template,
 		},
 		QEMU: QEMU{
 			Image:   kola.QEMUOptions.DiskImage,
 			Mangled: !kola.QEMUOptions.UseVanillaImage,
 		},
+		KubeVirt: KubeVirt{
+			Namespace: kola.KubeVirtOptions.Namespace,
+			Image:     kola.KubeVirtOptions.Image,
+		},
+		Scaleway: Scaleway{
+			Zone:         kola.ScalewayOptions.Zone,
+			InstanceType: kola.ScalewayOptions.InstanceType,
+			Image:        kola.ScalewayOptions.Image,
+		},
+		VSphere: VSphere{
+			Server:   kola.VSphereOptions.Server,
+			Template: kola.VSphereOptions.Template,
+			OVA:      kola.VSphereOptions.OVAPath,
+		},
 	})
 }
 
@@ -285,20 +523,40 @@ func runList(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	durations, err := kola.LoadDurations(listDurations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading durations: %v\n", err)
+		os.Exit(1)
+	}
+
 	var testlist []*item
 
 	for name, test := range tests {
 		item := &item{
-			name,
-			test.Platforms,
-			test.ExcludePlatforms,
-			test.Architectures,
-			test.Distros,
-			test.ExcludeDistros,
-			test.Channels,
-			test.ExcludeChannels,
-			test.Offerings,
-			test.ExcludeOfferings,
+			Name:             name,
+			Platforms:        test.Platforms,
+			ExcludePlatforms: test.ExcludePlatforms,
+			Architectures:    test.Architectures,
+			Distros:          test.Distros,
+			ExcludeDistros:   test.ExcludeDistros,
+			Channels:         test.Channels,
+			ExcludeChannels:  test.ExcludeChannels,
+			Offerings:        test.Offerings,
+			ExcludeOfferings: test.ExcludeOfferings,
+			ClusterSize:      test.ClusterSize,
+			Tags:             test.Tags,
+		}
+		if test.MinVersion != (semver.Version{}) {
+			item.MinVersion = test.MinVersion.String()
+		}
+		if test.EndVersion != (semver.Version{}) {
+			item.EndVersion = test.EndVersion.String()
+		}
+		for _, flag := range test.Flags {
+			item.Flags = append(item.Flags, flag.String())
+		}
+		if d, ok := durations[name]; ok {
+			item.EstimatedDuration = d.Seconds()
 		}
 		item.updateValues()
 		testlist = append(testlist, item)
@@ -338,6 +596,15 @@ type item struct {
 	ExcludeChannels  []string `json:"-"`
 	Offerings        []string
 	ExcludeOfferings []string `json:"-"`
+	ClusterSize      int
+	// MinVersion and EndVersion are the default version range, tests
+	// may have others for some distributions and channels.
+	MinVersion string   `json:",omitempty"`
+	EndVersion string   `json:",omitempty"`
+	Flags      []string `json:",omitempty"`
+	Tags       []string `json:",omitempty"`
+	// EstimatedDuration is in seconds, see --durations.
+	EstimatedDuration float64 `json:",omitempty"`
 }
 
 func (i *item) updateValues() {
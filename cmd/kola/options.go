@@ -29,31 +29,39 @@ import (
 
 	"github.com/flatcar/mantle/auth"
 	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/logsink"
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/aws"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/distro"
+	"github.com/flatcar/mantle/platform/throttle"
 	"github.com/flatcar/mantle/sdk"
 )
 
 var (
+	kolaConfigFile     string
 	outputDir          string
+	workspaceMaxSize   string
 	kolaPlatform       string
 	kolaChannel        string
 	kolaOffering       string
 	defaultTargetBoard = sdk.DefaultBoard()
 	kolaArchitectures  = []string{"amd64"}
-	kolaPlatforms      = []string{"aws", "azure", "do", "esx", "external", "gce", "openstack", "equinixmetal", "qemu", "qemu-unpriv"}
-	kolaDistros        = []string{"cl", "fcos", "rhcos"}
+	kolaPlatforms      = []string{"aws", "azure", "do", "esx", "external", "gce", "kubevirt", "openstack", "equinixmetal", "proxmox", "qemu", "qemu-unpriv", "scaleway", "vsphere"}
+	kolaDistros        = distro.Names()
+	kolaDistroProfiles string
+	kolaImageHooks     string
+	kolaLogSinks       []string
+	kolaAPIRateLimits  []string
+	awsBoardAMIs       []string
+	channelImages      []string
+	awsArm64Type       string
 	kolaChannels       = []string{"alpha", "beta", "stable", "edge", "lts"}
 	kolaOfferings      = []string{"basic", "pro"}
 	kolaDefaultImages  = map[string]string{
 		"amd64-usr": sdk.BuildRoot() + "/images/amd64-usr/latest/flatcar_production_image.bin",
 		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/flatcar_production_image.bin",
 	}
-	kolaIgnitionVersionDefaults = map[string]string{
-		"cl":    "v2",
-		"fcos":  "v3",
-		"rhcos": "v3",
-	}
-
 	kolaDefaultBIOS = map[string]string{
 		"amd64-usr": "bios-256k.bin",
 		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/flatcar_production_qemu_uefi_efi_code.fd",
@@ -71,24 +79,50 @@ func init() {
 	iv := root.PersistentFlags().IntVar
 
 	// general options
+	sv(&kolaConfigFile, "config", "", "YAML file with defaults for the options not given on the command line, instead of ./"+configFileName+", the user's kola/"+configFileName+" is read as well")
 	sv(&outputDir, "output-dir", "", "Temporary output directory for test data and logs")
+	dv(&kola.WorkspaceMaxAge, "workspace-max-age", 0, "without --output-dir, remove the runs in "+kola.WorkspaceDir+" older than this before a run, e.g. 72h")
+	sv(&workspaceMaxSize, "workspace-max-size", "", "without --output-dir, remove the oldest runs in "+kola.WorkspaceDir+" before a run until it is smaller than this, e.g. 50G")
 	sv(&kola.TorcxManifestFile, "torcx-manifest", "", "Path to a torcx manifest that should be made available to tests")
 	sv(&kola.DevcontainerURL, "devcontainer-url", "http://bincache.flatcar-linux.net/images/@ARCH@/@VERSION@", "URL to a dev container archive that should be made available to tests")
 	sv(&kola.DevcontainerFile, "devcontainer-file", "", "Path to a dev container archive that should be made available to tests as alternative to devcontainer-url, note that a working devcontainer-binhost-url is still needed")
 	sv(&kola.DevcontainerBinhostURL, "devcontainer-binhost-url", "http://bincache.flatcar-linux.net/boards/@ARCH@-usr/@VERSION@/pkgs", "URL to a binary host that the devcontainer test should use")
 	root.PersistentFlags().StringVarP(&kolaPlatform, "platform", "p", "qemu", "VM platform: "+strings.Join(kolaPlatforms, ", "))
 	root.PersistentFlags().StringVarP(&kolaChannel, "channel", "", "stable", "Channel: "+strings.Join(kolaChannels, ", "))
+	root.PersistentFlags().StringSliceVar(&channelImages, "channel-matrix", nil, "Run the tests once per channel or channel=image pair (e.g. lts,stable,beta,alpha), the image defaults to the current release of the channel on aws, azure, do and gce, overrides --channel")
 	root.PersistentFlags().StringVarP(&kolaOffering, "offering", "", "basic", "Offering: "+strings.Join(kolaOfferings, ", "))
 	root.PersistentFlags().StringVarP(&kola.Options.Distribution, "distro", "b", "cl", "Distribution: "+strings.Join(kolaDistros, ", "))
+	sv(&kolaDistroProfiles, "distro-profiles", "", "JSON file with additional distribution profiles")
+	sv(&kolaImageHooks, "image-hooks", "", "JSON file with per-platform transformations applied to local images before they are booted or uploaded")
+	root.PersistentFlags().StringSliceVar(&kolaLogSinks, "log-sink", nil, "Ship the journals of the machines to a Loki server (http://loki:3100) or an S3 bucket (s3://bucket/prefix) while the tests run")
+	sv(&kola.Options.Kdump, "kdump", "", "enable kdump with this much memory reserved for the crash kernel (e.g. 256M) and collect the dmesg of kernel panics")
+	sv(&kola.Options.CgroupMode, "cgroup-mode", "", "boot the machines with the cgroup v1 or v2 hierarchy and check it, tests setting their own mode keep it")
+	sv(&kola.Options.SELinuxMode, "selinux-mode", "", "boot the machines with SELinux enforcing or permissive and check it, instead of switching to enforcing after the boot")
+	root.PersistentFlags().StringSliceVar(&kola.Options.DNSServers, "dns-server", nil, "DNS server the machines use instead of those of the platform (can be repeated), on qemu the dnsmasq of kola forwards to them")
+	sv(&kola.Options.IgnitionDelivery, "ignition-delivery", "", "serve the Ignition configs over http or https from kola and only pass a pointer config as userdata")
+	sv(&kola.Options.IgnitionServerAddr, "ignition-server-addr", "", "host[:port] at which machines reach kola's Ignition server for --ignition-delivery, not needed on qemu")
+	sv(&kola.Options.AssetServerAddr, "asset-server-addr", "", "host[:port] at which machines reach kola's server of the test assets, not needed on qemu")
 	root.PersistentFlags().IntVarP(&kola.TestParallelism, "parallel", "j", 1, "number of tests to run in parallel")
+	root.PersistentFlags().StringSliceVar(&kola.Tags, "tag", nil, "Only run the tests with any of these tags (can be repeated)")
+	root.PersistentFlags().StringSliceVar(&kola.ExcludeTags, "exclude-tag", nil, "Don't run the tests with any of these tags (can be repeated)")
+	sv(&kola.Progress, "progress", "", "show the progress of the tests: tui for a live view of the running tests (needs a terminal), plain for a line per change")
+	root.PersistentFlags().StringSliceVar(&kolaAPIRateLimits, "api-rate-limit", nil, "Limit the calls to a cloud API service to a rate per second and burst, as service=rate[:burst] (e.g. ec2=10:20, services: ec2, iam, azure, gce, digitalocean, equinixmetal, scaleway)")
+	bv(&kola.NoQuotaCheck, "no-quota-check", false, "don't check the AWS, Azure or GCE quotas for the machines needed by the parallel tests before running them")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
 	ss("debug-systemd-unit", []string{}, "full-unit-name.service to enable SYSTEMD_LOG_LEVEL=debug on. Specify multiple times for multiple units.")
 	sv(&kola.UpdatePayloadFile, "update-payload", "", "Path to an update payload that should be made available to tests")
+	dv(&kola.ResourceInterval, "resource-interval", 0, "sample the CPU, memory and disk usage of the machines at this interval and record their boot times, e.g. 10s")
+	sv(&kola.TestDataDir, "test-data-dir", "", "Directory with the data directories of the tests (default: data next to kola or in /usr/lib/kola)")
+	sv(&kola.KubernetesConformance, "kubernetes-conformance", "", "regular expression of the Kubernetes conformance tests the kubeadm.*.conformance tests run with sonobuoy (e.g. \\[Conformance\\]), they are skipped if empty")
 	bv(&kola.ForceFlatcarKey, "force-flatcar-key", false, "Use the Flatcar production key to verify update payload")
 	sv(&kola.Options.IgnitionVersion, "ignition-version", "", "Ignition version override: v2, v3")
 	iv(&kola.Options.SSHRetries, "ssh-retries", kolaSSHRetries, "Number of retries with the SSH timeout when starting the machine")
 	dv(&kola.Options.SSHTimeout, "ssh-timeout", kolaSSHTimeout, "A timeout for a single try of establishing an SSH connection when starting the machine")
+	sv(&kola.Options.JumpHost, "jump-host", "", "host[:port] of an SSH bastion to connect to the machines through, e.g. when they are in a private subnet")
+	sv(&kola.Options.JumpUser, "jump-user", "", "user on the --jump-host (default: the local user)")
+	sv(&kola.Options.JumpKeyFile, "jump-key", "", "private SSH key file for the --jump-host (default: the keys of the SSH agent)")
+	sv(&kola.Options.WireGuardSubnet, "wireguard-subnet", "", "join the kola host and the machines of each cluster in a WireGuard overlay with addresses of this IPv4 subnet, e.g. 10.254.0.0/16 (needs root and the ip and wg tools)")
 
 	// rhcos-specific options
 	sv(&kola.Options.OSContainer, "oscontainer", "", "oscontainer image pullspec for pivot (RHCOS only)")
@@ -101,14 +135,29 @@ func init() {
 	sv(&kola.AWSOptions.CredentialsFile, "aws-credentials-file", "", "AWS credentials file (default \"~/.aws/credentials\")")
 	sv(&kola.AWSOptions.Region, "aws-region", defaultRegion, "AWS region")
 	sv(&kola.AWSOptions.Profile, "aws-profile", "default", "AWS profile name")
+	root.PersistentFlags().StringSliceVar(&kola.AWSOptions.Profiles, "aws-profiles", nil, "AWS profile names of several accounts to create the clusters in round-robin, e.g. to stay within their quotas, overrides --aws-profile")
+	sv(&kola.AWSOptions.RoleARN, "aws-role-arn", "", "AWS IAM role ARN to assume")
+	sv(&kola.AWSOptions.ExternalID, "aws-external-id", "", "External ID to assume the AWS IAM role with")
+	sv(&kola.AWSOptions.RoleSessionName, "aws-role-session-name", "", "Session name of the assumed AWS IAM role (default \"mantle\")")
+	sv(&kola.AWSOptions.WebIdentityTokenFile, "aws-web-identity-token-file", "", "OIDC token file to assume --aws-role-arn with, or \""+aws.WebIdentityGitHubActions+"\" to request the token from GitHub Actions")
 	sv(&kola.AWSOptions.AMI, "aws-ami", "alpha", `AWS AMI ID, or (alpha|beta|stable) to use the latest image`)
 	sv(&kola.AWSOptions.InstanceType, "aws-type", "m4.large", "AWS instance type")
+	sv(&awsArm64Type, "aws-arm64-type", "m6g.large", "AWS instance type for arm64-usr, used unless --aws-type is given")
+	sv(&kola.AWSOptions.GPUInstanceType, "aws-gpu-type", "", "AWS instance type for tests requiring a GPU (default g4dn.xlarge, g5g.xlarge for arm64-usr)")
+	root.PersistentFlags().StringSliceVar(&awsBoardAMIs, "aws-board-ami", nil, "Run the tests once per board=AMI pair (e.g. amd64-usr=alpha,arm64-usr=ami-0123), overrides --board and --aws-ami")
 	sv(&kola.AWSOptions.SecurityGroup, "aws-sg", "kola", "AWS security group name")
 	sv(&kola.AWSOptions.IAMInstanceProfile, "aws-iam-profile", "kola", "AWS IAM instance profile name")
+	bv(&kola.AWSOptions.IMDSv2Only, "aws-imdsv2-only", false, "Require session tokens (IMDSv2) for the AWS instance metadata service")
+	bv(&kola.AWSOptions.Spot, "aws-spot", false, "Use AWS spot instances, falling back to on-demand instances without spot capacity")
+	sv(&kola.AWSOptions.SpotMaxPrice, "aws-spot-max-price", "", "Maximum hourly price for AWS spot instances (default: on-demand price)")
 
 	// azure-specific options
 	sv(&kola.AzureOptions.AzureProfile, "azure-profile", "", "Azure profile (default \"~/"+auth.AzureProfilePath+"\")")
 	sv(&kola.AzureOptions.AzureAuthLocation, "azure-auth", "", "Azure auth location (default \"~/"+auth.AzureAuthPath+"\")")
+	sv(&kola.AzureOptions.Credentials, "azure-credentials", "file", "Azure credentials: \"file\" for --azure-auth, \"workload-identity\" for federated OIDC tokens of GitHub Actions or AKS, or \"msi\" for the managed identity of the host")
+	sv(&kola.AzureOptions.ClientID, "azure-client-id", "", "Azure client ID of the workload or user-assigned managed identity (default $AZURE_CLIENT_ID)")
+	sv(&kola.AzureOptions.TenantID, "azure-tenant-id", "", "Azure tenant ID of the workload identity (default $AZURE_TENANT_ID)")
+	sv(&kola.AzureOptions.SubscriptionID, "azure-subscription-id", "", "Azure subscription ID, needed without --azure-profile for workload-identity and msi credentials (default $AZURE_SUBSCRIPTION_ID)")
 	sv(&kola.AzureOptions.BlobURL, "azure-blob-url", "", "Azure source page blob to be copied from a public/SAS URL, recommended way (from \"plume pre-release\" or \"ore azure upload-blob-arm\")")
 	sv(&kola.AzureOptions.ImageFile, "azure-image-file", "", "Azure image file (local image to upload in the temporary kola resource group)")
 	sv(&kola.AzureOptions.DiskURI, "azure-disk-uri", "", "Azure disk uri (custom images)")
@@ -122,6 +171,10 @@ func init() {
 	sv(&kola.AzureOptions.VnetSubnetName, "azure-vnet-subnet-name", "", "Use a pre-existing virtual network for created instances. Specify as vnet-name/subnet-name. If subnet name is omitted then \"default\" is assumed")
 	bv(&kola.AzureOptions.UseGallery, "azure-use-gallery", false, "Use gallery image instead of managed image")
 	bv(&kola.AzureOptions.UsePrivateIPs, "azure-use-private-ips", false, "Assume nodes are reachable using private IP addresses")
+	sv(&kola.AzureOptions.SecurityType, "azure-security-type", "", "Azure security type for all instances (\"TrustedLaunch\" or \"ConfidentialVM\"), requires a Gen2 image")
+	bv(&kola.AzureOptions.DisableSecureBoot, "azure-disable-secure-boot", false, "Disable Secure Boot on Trusted Launch and Confidential VM instances")
+	sv(&kola.AzureOptions.ConfidentialVMSize, "azure-cvm-size", "Standard_DC2as_v5", "Azure machine size for Confidential VM instances")
+	sv(&kola.AzureOptions.GPUVMSize, "azure-gpu-size", "Standard_NC4as_T4_v3", "Azure machine size with an NVIDIA GPU for tests requiring a GPU")
 
 	// do-specific options
 	sv(&kola.DOOptions.ConfigPath, "do-config-file", "", "DigitalOcean config file (default \"~/"+auth.DOConfigPath+"\")")
@@ -130,6 +183,8 @@ func init() {
 	sv(&kola.DOOptions.Region, "do-region", "sfo2", "DigitalOcean region slug")
 	sv(&kola.DOOptions.Size, "do-size", "s-1vcpu-2gb", "DigitalOcean size slug")
 	sv(&kola.DOOptions.Image, "do-image", "alpha", "DigitalOcean image ID, {alpha, beta, stable}, or user image name")
+	sv(&kola.DOOptions.VPC, "do-vpc", "", "DigitalOcean VPC UUID or name to place the droplets in (default: the region's default VPC)")
+	bv(&kola.DOOptions.UsePrivateIPs, "do-use-private-ips", false, "connect to the droplets via their private IPs, e.g. when running kola inside the VPC")
 
 	// esx-specific options
 	sv(&kola.ESXOptions.ConfigPath, "esx-config-file", "", "ESX config file (default \"~/"+auth.ESXConfigPath+"\")")
@@ -144,6 +199,12 @@ func init() {
 	sv(&kola.ESXOptions.FirstStaticIpPrivate, "esx-first-static-ip-private", "", "First available private IP (only needed for static IP addresses)")
 	root.PersistentFlags().IntVarP(&kola.ESXOptions.StaticSubnetSize, "esx-subnet-size", "", 0, "Subnet size (only needed for static IP addresses)")
 
+	// plugin-specific options
+	sv(&kola.PluginOptions.Path, "plugin-path", "", "path of the plugin executable implementing --platform (default: kola-platform-<platform> in $PATH)")
+	root.PersistentFlags().StringToStringVar(&kola.PluginOptions.PluginOptions, "plugin-opt", nil, "option passed to the platform plugin, as key=value")
+	bv(&kola.PluginOptions.Sandbox, "plugin-sandbox", false, "run the platform plugin as another user, without the environment of kola and with a seccomp filter (needs root)")
+	sv(&kola.PluginOptions.SandboxUser, "plugin-sandbox-user", "nobody", "user the sandboxed platform plugin runs as")
+
 	// external-specific options
 	sv(&kola.ExternalOptions.ManagementUser, "external-user", "", "External platform management SSH user")
 	sv(&kola.ExternalOptions.ManagementPassword, "external-password", "", "External platform management SSH password")
@@ -156,13 +217,21 @@ func init() {
 	// gce-specific options
 	sv(&kola.GCEOptions.Image, "gce-image", "projects/coreos-cloud/global/images/family/coreos-alpha", "GCE image, full api endpoints names are accepted if resource is in a different project")
 	sv(&kola.GCEOptions.Project, "gce-project", "flatcar-212911", "GCE project name")
+	root.PersistentFlags().StringSliceVar(&kola.GCEOptions.Projects, "gce-projects", nil, "GCE projects, each optionally as project=json-key-file, to create the clusters in round-robin, e.g. to stay within their quotas, overrides --gce-project")
 	sv(&kola.GCEOptions.Zone, "gce-zone", "us-central1-a", "GCE zone name")
 	sv(&kola.GCEOptions.MachineType, "gce-machinetype", "n1-standard-1", "GCE machine type")
 	sv(&kola.GCEOptions.DiskType, "gce-disktype", "pd-ssd", "GCE disk type")
 	sv(&kola.GCEOptions.Network, "gce-network", "default", "GCE network")
 	bv(&kola.GCEOptions.GVNIC, "gce-gvnic", false, "Use gVNIC instead of default virtio-net network device")
 	bv(&kola.GCEOptions.ServiceAuth, "gce-service-auth", false, "for non-interactive auth when running within GCE")
-	sv(&kola.GCEOptions.JSONKeyFile, "gce-json-key", "", "use a service account's JSON key for authentication")
+	sv(&kola.GCEOptions.JSONKeyFile, "gce-json-key", "", "use a service account's JSON key, or the JSON credentials of workload identity federation, for authentication")
+	sv(&kola.GCEOptions.ImpersonateServiceAccount, "gce-impersonate-service-account", "", "email of a service account to impersonate with the credentials of --gce-json-key or --gce-service-auth")
+	bv(&kola.GCEOptions.SecureBoot, "gce-secure-boot", false, "Enable Secure Boot on Shielded VM instances")
+	bv(&kola.GCEOptions.VTPM, "gce-vtpm", false, "Enable the vTPM on Shielded VM instances")
+	bv(&kola.GCEOptions.IntegrityMonitoring, "gce-integrity-monitoring", false, "Enable integrity monitoring on Shielded VM instances")
+	bv(&kola.GCEOptions.ConfidentialCompute, "gce-confidential-compute", false, "Launch Confidential VM (AMD SEV) instances, requires an image created with --confidential-compute")
+	sv(&kola.GCEOptions.ConfidentialMachineType, "gce-confidential-machinetype", "n2d-standard-2", "GCE machine type for Confidential VM instances")
+	sv(&kola.GCEOptions.GPUMachineType, "gce-gpu-machinetype", "a2-highgpu-1g", "GCE machine type with attached NVIDIA GPUs for tests requiring a GPU")
 
 	// openstack-specific options
 	sv(&kola.OpenStackOptions.ConfigPath, "openstack-config-file", "", "OpenStack config file (default \"~/"+auth.OpenStackConfigPath+"\")")
@@ -176,6 +245,7 @@ func init() {
 	sv(&kola.OpenStackOptions.Host, "openstack-host", "", "Host can be used to optionally SSH into deployed VMs from the OpenStack host")
 	sv(&kola.OpenStackOptions.User, "openstack-user", "", "User is the one used for the SSH connection to the Host")
 	sv(&kola.OpenStackOptions.Keyfile, "openstack-keyfile", "", "Keyfile is the absolute path to private SSH key file for the User on the Host")
+	bv(&kola.OpenStackOptions.ConfigDrive, "openstack-config-drive", false, "Pass userdata on a config drive, for clouds without metadata service")
 
 	// packet-specific options (kept for compatiblity but marked as deprecated)
 	sv(&kola.EquinixMetalOptions.ConfigPath, "packet-config-file", "", "Packet config file (default \"~/"+auth.EquinixMetalConfigPath+"\")")
@@ -219,6 +289,61 @@ func init() {
 	sv(&kola.EquinixMetalOptions.RemoteDocumentRoot, "equinixmetal-remote-document-root", "/var/www", "the absolute path to the document root of the webserver for serving temporary files")
 	dv(&kola.EquinixMetalOptions.LaunchTimeout, "equinixmetal-launch-timeout", 0, "Timeout used for waiting for instance to launch")
 	dv(&kola.EquinixMetalOptions.InstallTimeout, "equinixmetal-install-timeout", 0, "Timeout used for waiting for installation to finish")
+	root.PersistentFlags().StringSliceVar(&kola.EquinixMetalOptions.HardwareReservations, "equinixmetal-hardware-reservation", nil, "EquinixMetal hardware reservation IDs to create devices on, \"next-available\" picks any (can be repeated)")
+	bv(&kola.EquinixMetalOptions.SpotInstance, "equinixmetal-spot", false, "Create EquinixMetal devices on the spot market")
+	root.PersistentFlags().Float64Var(&kola.EquinixMetalOptions.SpotPriceMax, "equinixmetal-spot-price-max", 0, "Maximum bid in USD per hour for EquinixMetal spot instances")
+
+	// proxmox-specific options
+	sv(&kola.ProxmoxOptions.ConfigPath, "proxmox-config-file", "", "Proxmox VE config file (default \"~/"+auth.ProxmoxConfigPath+"\")")
+	sv(&kola.ProxmoxOptions.Profile, "proxmox-profile", "", "Proxmox VE profile (default \"default\")")
+	sv(&kola.ProxmoxOptions.URL, "proxmox-url", "", "Proxmox VE API URL, e.g. \"https://pve.example.com:8006\" (overrides config file)")
+	sv(&kola.ProxmoxOptions.TokenID, "proxmox-token-id", "", "Proxmox VE API token ID in the form USER@REALM!TOKENID (overrides config file)")
+	sv(&kola.ProxmoxOptions.TokenSecret, "proxmox-token-secret", "", "Proxmox VE API token secret (overrides config file)")
+	sv(&kola.ProxmoxOptions.Node, "proxmox-node", "", "Proxmox VE node to create VMs on (overrides config file)")
+	bv(&kola.ProxmoxOptions.Insecure, "proxmox-insecure", false, "Skip TLS certificate verification of the Proxmox VE API")
+	iv(&kola.ProxmoxOptions.Template, "proxmox-template", 0, "Proxmox VE VM ID of the Flatcar template to clone (create with: ore proxmox create-template)")
+	sv(&kola.ProxmoxOptions.Storage, "proxmox-storage", "", "Proxmox VE storage for full clones (default: linked clone on the template storage)")
+	sv(&kola.ProxmoxOptions.ISOStorage, "proxmox-iso-storage", "local", "Proxmox VE storage the Ignition config drive ISOs are uploaded to")
+	sv(&kola.ProxmoxOptions.Pool, "proxmox-pool", "", "Proxmox VE resource pool for created VMs")
+	sv(&kola.ProxmoxOptions.Bridge, "proxmox-bridge", "", "Proxmox VE network bridge (default: keep the template setting)")
+	iv(&kola.ProxmoxOptions.Memory, "proxmox-memory", 0, "Proxmox VE VM memory in MiB (default: keep the template setting)")
+	iv(&kola.ProxmoxOptions.Cores, "proxmox-cores", 0, "Proxmox VE VM CPU cores (default: keep the template setting)")
+
+	// scaleway-specific options
+	sv(&kola.ScalewayOptions.ConfigPath, "scaleway-config-file", "", "Scaleway config file (default \"~/"+auth.ScalewayConfigPath+"\")")
+	sv(&kola.ScalewayOptions.Profile, "scaleway-profile", "", "Scaleway profile (default \"default\")")
+	sv(&kola.ScalewayOptions.AccessKey, "scaleway-access-key", "", "Scaleway access key (overrides config file)")
+	sv(&kola.ScalewayOptions.SecretKey, "scaleway-secret-key", "", "Scaleway secret key (overrides config file)")
+	sv(&kola.ScalewayOptions.ProjectID, "scaleway-project-id", "", "Scaleway project ID (overrides config file)")
+	sv(&kola.ScalewayOptions.Region, "scaleway-region", "", "Scaleway region (default derived from the zone)")
+	sv(&kola.ScalewayOptions.Zone, "scaleway-zone", "", "Scaleway zone (default \"fr-par-1\")")
+	sv(&kola.ScalewayOptions.InstanceType, "scaleway-instance-type", "DEV1-S", "Scaleway instance type")
+	sv(&kola.ScalewayOptions.Image, "scaleway-image", "", "Scaleway image ID (create with: ore scaleway create-image)")
+
+	// kubevirt-specific options
+	sv(&kola.KubeVirtOptions.ConfigPath, "kubevirt-config-file", "", "kubeconfig file (default $KUBECONFIG or \"~/"+auth.KubeConfigPath+"\", falls back to the in-cluster service account)")
+	sv(&kola.KubeVirtOptions.Context, "kubevirt-context", "", "kubeconfig context (default: current context)")
+	sv(&kola.KubeVirtOptions.Namespace, "kubevirt-namespace", "", "Kubernetes namespace for the VMIs (default: namespace of the context or \"default\")")
+	sv(&kola.KubeVirtOptions.Image, "kubevirt-image", "", "containerDisk image with the Flatcar kubevirt image")
+	sv(&kola.KubeVirtOptions.Memory, "kubevirt-memory", "2Gi", "KubeVirt VMI memory request")
+	iv(&kola.KubeVirtOptions.CPUs, "kubevirt-cpus", 2, "KubeVirt VMI CPU cores")
+
+	// vsphere-specific options
+	sv(&kola.VSphereOptions.ConfigPath, "vsphere-config-file", "", "vSphere config file (default \"~/"+auth.VSphereConfigPath+"\")")
+	sv(&kola.VSphereOptions.Profile, "vsphere-profile", "", "vSphere profile (default \"default\")")
+	sv(&kola.VSphereOptions.Server, "vsphere-server", "", "vCenter server (overrides config file)")
+	sv(&kola.VSphereOptions.User, "vsphere-user", "", "vCenter user (overrides config file)")
+	sv(&kola.VSphereOptions.Password, "vsphere-password", "", "vCenter password (overrides config file)")
+	bv(&kola.VSphereOptions.Insecure, "vsphere-insecure", false, "Skip TLS certificate verification of the vCenter")
+	sv(&kola.VSphereOptions.Datacenter, "vsphere-datacenter", "", "vSphere datacenter (overrides config file)")
+	sv(&kola.VSphereOptions.ResourcePool, "vsphere-resource-pool", "", "vSphere resource pool, e.g. \"cluster/Resources\" (overrides config file)")
+	sv(&kola.VSphereOptions.Datastore, "vsphere-datastore", "", "vSphere datastore (overrides config file)")
+	sv(&kola.VSphereOptions.Network, "vsphere-network", "", "vSphere network (overrides config file)")
+	sv(&kola.VSphereOptions.Folder, "vsphere-folder", "", "vSphere VM folder (overrides config file)")
+	sv(&kola.VSphereOptions.Template, "vsphere-template", "", "vSphere Flatcar template to clone (create with: ore vsphere import-ova)")
+	sv(&kola.VSphereOptions.OVAPath, "vsphere-ova", "", "Flatcar OVA imported as template for the run if no template is given")
+	iv(&kola.VSphereOptions.Memory, "vsphere-memory", 0, "vSphere VM memory in MiB (default: keep the template setting)")
+	iv(&kola.VSphereOptions.CPUs, "vsphere-cpus", 0, "vSphere VM CPUs (default: keep the template setting)")
 
 	// QEMU-specific options
 	sv(&kola.QEMUOptions.Board, "board", defaultTargetBoard, "target board")
@@ -226,6 +351,20 @@ func init() {
 	sv(&kola.QEMUOptions.BIOSImage, "qemu-bios", "", "BIOS to use for QEMU vm")
 	bv(&kola.QEMUOptions.UseVanillaImage, "qemu-skip-mangle", false, "don't modify CL disk image to capture console log")
 	sv(&kola.QEMUOptions.ExtraBaseDiskSize, "qemu-grow-base-disk-by", "", "grow base disk by the given size in bytes, following optional 1024-based suffixes are allowed: b (ignored), k, K, M, G, T")
+	sv(&kola.QEMUOptions.LiveISO, "qemu-iso", "", "path to the Flatcar ISO image to boot for installation tests")
+	sv(&kola.QEMUOptions.InstallImage, "qemu-install-image", "", "path to the compressed disk image (flatcar_production_image.bin.bz2) to install in installation tests")
+	sv(&kola.QEMUOptions.PXEKernel, "qemu-pxe-kernel", "", "path to the PXE kernel (flatcar_production_pxe.vmlinuz) for netboot tests")
+	bv(&kola.QEMUOptions.NestedVirt, "qemu-nested-virt", false, "let all QEMU machines run KVM guests, needs nested virtualization on the host")
+	sv(&kola.QEMUOptions.PXEInitrd, "qemu-pxe-initrd", "", "path to the PXE initrd (flatcar_production_pxe_image.cpio.gz) for netboot tests")
+}
+
+// awsInstanceType returns the instance type for the board: --aws-type if it
+// was given, otherwise the default for the architecture.
+func awsInstanceType(board string) string {
+	if board == "arm64-usr" && !root.PersistentFlags().Changed("aws-type") {
+		return awsArm64Type
+	}
+	return kola.AWSOptions.InstanceType
 }
 
 // Sync up the command line options if there is dependency
@@ -243,8 +382,18 @@ func syncOptions() error {
 	kola.AzureOptions.Board = board
 	kola.AWSOptions.Board = board
 	kola.EquinixMetalOptions.Board = board
+	kola.ProxmoxOptions.Board = board
+	kola.ScalewayOptions.Board = board
+	kola.VSphereOptions.Board = board
+	kola.KubeVirtOptions.Board = board
 	kola.EquinixMetalOptions.GSOptions = &kola.GCEOptions
 
+	maxSize, err := parseSize(workspaceMaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --workspace-max-size: %v", err)
+	}
+	kola.WorkspaceMaxSize = maxSize
+
 	validateOption := func(name, item string, valid []string) error {
 		for _, v := range valid {
 			if v == item {
@@ -254,12 +403,35 @@ func syncOptions() error {
 		return fmt.Errorf("unsupported %v %q", name, item)
 	}
 
+	if len(awsBoardAMIs) > 0 {
+		if kolaPlatform != "aws" {
+			return fmt.Errorf("--aws-board-ami is only supported on the aws platform, not %q", kolaPlatform)
+		}
+		kola.AWSMatrix = nil
+		for _, pair := range awsBoardAMIs {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return fmt.Errorf("invalid --aws-board-ami %q, expected board=AMI", pair)
+			}
+			if _, ok := kolaDefaultImages[parts[0]]; !ok {
+				return fmt.Errorf("unsupported board %q in --aws-board-ami", parts[0])
+			}
+			kola.AWSMatrix = append(kola.AWSMatrix, kola.AWSMatrixEntry{
+				Board:        parts[0],
+				AMI:          parts[1],
+				InstanceType: awsInstanceType(parts[0]),
+			})
+		}
+	} else {
+		kola.AWSOptions.InstanceType = awsInstanceType(board)
+	}
+
 	if kolaPlatform == "packet" {
 		fmt.Println("packet platform is deprecated, updating to equinixmetal")
 		kolaPlatform = "equinixmetal"
 	}
 
-	if err := validateOption("platform", kolaPlatform, kolaPlatforms); err != nil {
+	if err := validateOption("platform", kolaPlatform, kolaPlatforms); err != nil && !kola.IsPluginPlatform(kolaPlatform) {
 		return err
 	}
 
@@ -267,13 +439,88 @@ func syncOptions() error {
 		return err
 	}
 
+	if len(channelImages) > 0 {
+		kola.ChannelMatrix = nil
+		for _, pair := range channelImages {
+			parts := strings.SplitN(pair, "=", 2)
+			if err := validateOption("channel", parts[0], kolaChannels); err != nil {
+				return fmt.Errorf("invalid --channel-matrix %q: %v", pair, err)
+			}
+			entry := kola.ChannelMatrixEntry{Channel: parts[0]}
+			if len(parts) == 2 {
+				entry.Image = parts[1]
+			}
+			kola.ChannelMatrix = append(kola.ChannelMatrix, entry)
+		}
+	}
+
 	if err := validateOption("offering", kolaOffering, kolaOfferings); err != nil {
 		return err
 	}
 
+	if kola.Progress != "" {
+		if err := validateOption("progress", kola.Progress, []string{"tui", "plain"}); err != nil {
+			return err
+		}
+	}
+
+	if kola.Options.CgroupMode != "" {
+		if err := validateOption("cgroup mode", kola.Options.CgroupMode, conf.CgroupModes); err != nil {
+			return err
+		}
+	}
+
+	if kola.Options.SELinuxMode != "" {
+		if err := validateOption("SELinux mode", kola.Options.SELinuxMode, platform.SELinuxModes); err != nil {
+			return err
+		}
+	}
+
+	if kola.Options.IgnitionDelivery != "" {
+		if err := validateOption("Ignition delivery", kola.Options.IgnitionDelivery, []string{"http", "https"}); err != nil {
+			return err
+		}
+	}
+
+	if kolaDistroProfiles != "" {
+		if err := distro.LoadFile(kolaDistroProfiles); err != nil {
+			return fmt.Errorf("loading distribution profiles: %v", err)
+		}
+		kolaDistros = distro.Names()
+	}
+
+	if kolaImageHooks != "" {
+		hooks, err := platform.LoadImageHooks(kolaImageHooks)
+		if err != nil {
+			return fmt.Errorf("loading image hooks: %v", err)
+		}
+		kola.Options.ImageHooks = hooks[kolaPlatform]
+	}
+
+	kola.LogSinks = nil
+	for _, spec := range kolaLogSinks {
+		sink, err := logsink.New(spec)
+		if err != nil {
+			return err
+		}
+		kola.LogSinks = append(kola.LogSinks, sink)
+	}
+
+	for _, spec := range kolaAPIRateLimits {
+		service, budget, err := throttle.ParseBudget(spec)
+		if err != nil {
+			return err
+		}
+		throttle.SetBudget(service, budget)
+	}
+
 	if err := validateOption("distro", kola.Options.Distribution, kolaDistros); err != nil {
 		return err
 	}
+	profile, err := distro.Get(kola.Options.Distribution)
+	if err != nil {
+		return err
+	}
 
 	image, ok := kolaDefaultImages[kola.QEMUOptions.Board]
 	if !ok {
@@ -296,15 +543,12 @@ func syncOptions() error {
 		})
 	}
 
-	if kola.Options.OSContainer != "" && kola.Options.Distribution != "rhcos" {
-		return fmt.Errorf("oscontainer is only supported on rhcos")
+	if kola.Options.OSContainer != "" && profile.Updater != distro.UpdaterPivot {
+		return fmt.Errorf("oscontainer is only supported on distributions updated by pivot")
 	}
 
 	if kola.Options.IgnitionVersion == "" {
-		kola.Options.IgnitionVersion, ok = kolaIgnitionVersionDefaults[kola.Options.Distribution]
-		if !ok {
-			return fmt.Errorf("Distribution %q has no default Ignition version", kola.Options.Distribution)
-		}
+		kola.Options.IgnitionVersion = profile.IgnitionVersion
 	}
 
 	if kola.Options.SSHRetries == 0 {
@@ -0,0 +1,96 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/flatcar/mantle/kola"
+)
+
+var (
+	cmdReproduce = &cobra.Command{
+		Use:   "reproduce <test>",
+		Short: "Run a single kola test repeatedly",
+		Long: `Run a single kola test repeatedly to reproduce a flaky failure.
+
+The output of each run is written to an iteration-NNN directory in the
+output directory. With --until-failure the runs stop at the first
+failure, keeping its output and, with --remove=false, its machines.
+
+With --keep-cluster all runs use the machines provisioned by the first
+one, which makes iterations faster but only works for tests which don't
+change their machines in a way that breaks the next run.
+
+Like with kola run, subtests of the test can be selected after a slash,
+e.g. 'systemd.sysext.simple/reload'.
+`,
+		Args:   cobra.ExactArgs(1),
+		Run:    runReproduce,
+		PreRun: preRun,
+	}
+
+	reproduceIterations   int
+	reproduceUntilFailure bool
+	reproduceKeepCluster  bool
+)
+
+func init() {
+	root.AddCommand(cmdReproduce)
+
+	cmdReproduce.Flags().IntVar(&reproduceIterations, "iterations", 10, "number of runs, 0 to run until a failure")
+	cmdReproduce.Flags().BoolVar(&reproduceUntilFailure, "until-failure", false, "stop at the first failing run")
+	cmdReproduce.Flags().BoolVar(&reproduceKeepCluster, "keep-cluster", false, "run all iterations on the machines of the first one")
+	cmdReproduce.Flags().BoolVarP(&runRemove, "remove", "r", true, "remove instances after the runs (--remove=false will keep them)")
+	cmdReproduce.Flags().BoolVarP(&runSetSSHKeys, "keys", "k", false, "add SSH keys from --key options")
+	cmdReproduce.Flags().StringSliceVar(&runSSHKeys, "key", nil, "path to SSH public key (default: SSH agent + ~/.ssh/id_{rsa,dsa,ecdsa,ed25519}.pub)")
+}
+
+func runReproduce(cmd *cobra.Command, args []string) {
+	if reproduceIterations < 0 {
+		fmt.Fprintf(os.Stderr, "--iterations must not be negative\n")
+		os.Exit(2)
+	}
+
+	var err error
+	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	var sshKeys []agent.Key
+	if runSetSSHKeys {
+		sshKeys, err = GetSSHKeys(runSSHKeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := kola.ReproduceOptions{
+		Iterations:   reproduceIterations,
+		UntilFailure: reproduceUntilFailure,
+		KeepCluster:  reproduceKeepCluster,
+	}
+	if err := kola.Reproduce(args[0], kolaChannel, kolaOffering, kolaPlatform, outputDir, &sshKeys, runRemove, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
 	"github.com/flatcar/mantle/platform/machine/qemu"
@@ -39,8 +40,14 @@ var (
 	cmdSpawn = &cobra.Command{
 		Run:    runSpawn,
 		PreRun: preRun,
-		Use:    "spawn",
+		Use:    "spawn [test name]",
 		Short:  "spawn a CoreOS instance",
+		Long: `Spawn CoreOS instances and open a shell on one of them.
+
+If the name of a registered test is given, the machines get the userdata,
+number of nodes and runtime settings of that test, which helps to reproduce
+failures interactively. --userdata and --nodecount override them.`,
+		Args: cobra.MaximumNArgs(1),
 	}
 
 	spawnNodeCount      int
@@ -52,6 +59,7 @@ var (
 	spawnMachineOptions string
 	spawnSetSSHKeys     bool
 	spawnSSHKeys        []string
+	spawnForwardAgent   bool
 )
 
 func init() {
@@ -64,6 +72,7 @@ func init() {
 	cmdSpawn.Flags().StringVar(&spawnMachineOptions, "qemu-options", "", "experimental: path to QEMU machine options json")
 	cmdSpawn.Flags().BoolVarP(&spawnSetSSHKeys, "keys", "k", false, "add SSH keys from --key options")
 	cmdSpawn.Flags().StringSliceVar(&spawnSSHKeys, "key", nil, "path to SSH public key (default: SSH agent + ~/.ssh/id_{rsa,dsa,ecdsa,ed25519}.pub)")
+	cmdSpawn.Flags().BoolVarP(&spawnForwardAgent, "forward-agent", "A", false, "forward the SSH agent of kola to the shell, to reach the other instances")
 	root.AddCommand(cmdSpawn)
 }
 
@@ -84,11 +93,29 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		spawnRemove = false
 	}
 
+	var test *register.Test
+	if len(args) == 1 {
+		var ok bool
+		test, ok = register.Tests[args[0]]
+		if !ok {
+			return fmt.Errorf("no test named %q", args[0])
+		}
+		if test.ClusterSize == 0 && spawnUserData == "" {
+			return fmt.Errorf("test %q creates its own machines, pass their userdata with --userdata", test.Name)
+		}
+		if !cmd.Flags().Changed("nodecount") && test.ClusterSize > 0 {
+			spawnNodeCount = test.ClusterSize
+		}
+	}
+
 	if spawnNodeCount <= 0 {
 		return fmt.Errorf("Cluster Failed: nodecount must be one or more")
 	}
 
 	var userdata *conf.UserData
+	if test != nil && spawnUserData == "" {
+		userdata = kola.UserDataFor(test)
+	}
 	if spawnUserData != "" {
 		userbytes, err := ioutil.ReadFile(spawnUserData)
 		if err != nil {
@@ -123,12 +150,18 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		defer flight.Destroy()
 	}
 
-	cluster, err := flight.NewCluster(&platform.RuntimeConfig{
-		OutputDir:        outputDir,
-		AllowFailedUnits: true,
-		SSHRetries:       kola.Options.SSHRetries,
-		SSHTimeout:       kola.Options.SSHTimeout,
-	})
+	rconf := &platform.RuntimeConfig{
+		OutputDir:  outputDir,
+		SSHRetries: kola.Options.SSHRetries,
+		SSHTimeout: kola.Options.SSHTimeout,
+	}
+	rconf.Tags = kola.ResourceTags(flight, "spawn")
+	if test != nil {
+		rconf = kola.RuntimeConfigFor(test, outputDir)
+		rconf.Tags = kola.ResourceTags(flight, test.Name)
+	}
+	rconf.AllowFailedUnits = true
+	cluster, err := flight.NewCluster(rconf)
 	if err != nil {
 		return fmt.Errorf("Cluster failed: %v", err)
 	}
@@ -137,6 +170,14 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		defer cluster.Destroy()
 	}
 
+	if userdata != nil && userdata.Contains("$discovery") {
+		url, err := cluster.GetDiscoveryURL(spawnNodeCount)
+		if err != nil {
+			return fmt.Errorf("Creating discovery endpoint failed: %v", err)
+		}
+		userdata = userdata.Subst("$discovery", url)
+	}
+
 	var updateConf *strings.Reader
 	if spawnOmahaPackage != "" {
 		qc, ok := cluster.(*qemu.Cluster)
@@ -156,7 +197,11 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("getting Omaha server address: %v", err)
 		}
-		updateConf = strings.NewReader(fmt.Sprintf("GROUP=developer\nSERVER=http://%s/v1/update/\n", hostport))
+		contents, err := conf.UpdateConf(fmt.Sprintf("http://%s/v1/update/", hostport), "developer", "")
+		if err != nil {
+			return err
+		}
+		updateConf = strings.NewReader(contents)
 	}
 
 	var someMach platform.Machine
@@ -202,7 +247,7 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 				return fmt.Errorf("Setting shell prompt failed: %v", err)
 			}
 		}
-		if err := platform.Manhole(someMach); err != nil {
+		if err := platform.Manhole(someMach, spawnForwardAgent); err != nil {
 			return fmt.Errorf("Manhole failed: %v", err)
 		}
 	}
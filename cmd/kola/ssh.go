@@ -0,0 +1,134 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/network"
+	"github.com/flatcar/mantle/platform"
+)
+
+var (
+	cmdSSH = &cobra.Command{
+		Use:   "ssh [user@]host [command...]",
+		Short: "Connect to a machine via SSH",
+		Long: `Open a shell or run a command on a machine, e.g. one kept by
+'kola spawn --remove=false', through the --jump-host if one is given.
+
+The user defaults to core. The keys of the SSH agent at $SSH_AUTH_SOCK
+are used, so the machine needs one of them, see 'kola spawn -k'.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runSSH,
+	}
+
+	sshForwardAgent bool
+)
+
+func init() {
+	cmdSSH.Flags().BoolVarP(&sshForwardAgent, "forward-agent", "A", false, "forward the SSH agent to the machine")
+	// flags after the host belong to the command
+	cmdSSH.Flags().SetInterspersed(false)
+	root.AddCommand(cmdSSH)
+}
+
+func runSSH(cmd *cobra.Command, args []string) {
+	if err := doSSH(args[0], args[1:]); err != nil {
+		if e, ok := err.(*ssh.ExitError); ok {
+			os.Exit(e.ExitStatus())
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func doSSH(target string, command []string) error {
+	user, host := "core", target
+	if u, h, ok := strings.Cut(target, "@"); ok {
+		user, host = u, h
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	if len(command) == 0 && !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("no command given and stdin is not a terminal")
+	}
+
+	var dialer network.Dialer = network.NewRetryDialer()
+	if kola.Options.JumpHost != "" {
+		d, err := network.NewJumpDialer(kola.Options.JumpHost, kola.Options.JumpUser, kola.Options.JumpKeyFile)
+		if err != nil {
+			return fmt.Errorf("connecting to jump host %s: %v", kola.Options.JumpHost, err)
+		}
+		dialer = d
+	}
+
+	keys, err := network.LocalAgent()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialer.Dial("tcp", host)
+	if err != nil {
+		return err
+	}
+	sshconn, chans, reqs, err := ssh.NewClientConn(conn, host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(keys.Signers)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	client := ssh.NewClient(sshconn, chans, reqs)
+	defer client.Close()
+
+	if sshForwardAgent {
+		if err := agent.ForwardToAgent(client, keys); err != nil {
+			return err
+		}
+	}
+
+	if len(command) == 0 {
+		return platform.Shell(client, sshForwardAgent)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if sshForwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return err
+		}
+	}
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	return session.Run(strings.Join(command, " "))
+}
@@ -0,0 +1,164 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/kola"
+)
+
+var (
+	cmdWorkspace = &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage the runs in " + kola.WorkspaceDir,
+		Long: `Manage the output directories of the runs that kola creates in ` + kola.WorkspaceDir + `
+when no --output-dir is given.
+
+Each run records a manifest with its command line, host, start and end time
+and result, and holds a lock while it is running, so that runs are never
+removed while they are in use. The retention policy given with
+--workspace-max-age and --workspace-max-size is applied before each run.
+`,
+	}
+
+	cmdWorkspaceList = &cobra.Command{
+		Use:   "list",
+		Short: "List the runs, the oldest first",
+		Args:  cobra.NoArgs,
+		Run:   runWorkspaceList,
+	}
+
+	cmdWorkspacePurge = &cobra.Command{
+		Use:   "purge",
+		Short: "Remove old runs",
+		Long: `Remove the runs older than --older-than, then the oldest ones until the
+workspace is smaller than --max-size, or all of them with --all. Running runs
+are kept.
+`,
+		Args: cobra.NoArgs,
+		Run:  runWorkspacePurge,
+	}
+
+	purgeOlderThan time.Duration
+	purgeMaxSize   string
+	purgeAll       bool
+)
+
+func init() {
+	root.AddCommand(cmdWorkspace)
+	cmdWorkspace.AddCommand(cmdWorkspaceList)
+	cmdWorkspace.AddCommand(cmdWorkspacePurge)
+
+	cmdWorkspacePurge.Flags().DurationVar(&purgeOlderThan, "older-than", 0, "remove the runs older than this, e.g. 72h")
+	cmdWorkspacePurge.Flags().StringVar(&purgeMaxSize, "max-size", "", "remove the oldest runs until the workspace is smaller than this, e.g. 50G")
+	cmdWorkspacePurge.Flags().BoolVar(&purgeAll, "all", false, "remove all runs which are not running")
+}
+
+func runWorkspaceList(cmd *cobra.Command, args []string) {
+	runs, err := kola.ListWorkspace(kola.WorkspaceDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "Run\tStarted\tSize\tStatus\tCommand")
+	for _, run := range runs {
+		var command string
+		if run.Manifest != nil {
+			command = strings.Join(run.Manifest.Command, " ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", run.Name, run.Started.Local().Format("2006-01-02 15:04"), formatSize(run.Size), run.Status(), command)
+	}
+	w.Flush()
+}
+
+func runWorkspacePurge(cmd *cobra.Command, args []string) {
+	maxSize, err := parseSize(purgeMaxSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --max-size: %v\n", err)
+		os.Exit(2)
+	}
+	maxAge := purgeOlderThan
+	if purgeAll {
+		// anything which is not running
+		maxAge = time.Nanosecond
+	} else if maxAge == 0 && maxSize == 0 {
+		fmt.Fprintf(os.Stderr, "one of --older-than, --max-size or --all is needed\n")
+		os.Exit(2)
+	}
+
+	removed, err := kola.PruneWorkspace(kola.WorkspaceDir, maxAge, maxSize)
+	var freed int64
+	for _, run := range removed {
+		fmt.Printf("Removed %s\n", run.Name)
+		freed += run.Size
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Freed %s\n", formatSize(freed))
+}
+
+// parseSize parses a size in bytes with an optional K, M, G or T suffix
+// for powers of 1024, an empty size is 0.
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "T":
+		multiplier <<= 10
+		fallthrough
+	case "G":
+		multiplier <<= 10
+		fallthrough
+	case "M":
+		multiplier <<= 10
+		fallthrough
+	case "K":
+		multiplier <<= 10
+		size = size[:len(size)-1]
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a size in bytes with a binary unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGT"[exp])
+}
@@ -16,11 +16,13 @@ package main
 
 import (
 	"os"
+	"os/exec"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/kola/kolet"
 	"github.com/flatcar/mantle/kola/register"
 
 	// Register any tests that we may wish to execute in kolet.
@@ -41,6 +43,13 @@ var (
 		Short: "Run a given test's native function",
 		Run:   run,
 	}
+
+	cmdExec = &cobra.Command{
+		Use:   "exec binary [args...]",
+		Short: "Run an external test binary, reporting its results to kola",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runExec,
+	}
 )
 
 func run(cmd *cobra.Command, args []string) {
@@ -48,6 +57,13 @@ func run(cmd *cobra.Command, args []string) {
 	os.Exit(2)
 }
 
+func runExec(cmd *cobra.Command, args []string) {
+	if err := kolet.Exec(exec.Command(args[0], args[1:]...), os.Stdout); err != nil {
+		plog.Fatal(err)
+	}
+	os.Exit(0)
+}
+
 func main() {
 	for testName, testObj := range register.Tests {
 		if len(testObj.NativeFuncs) == 0 {
@@ -79,6 +95,7 @@ func main() {
 		cmdRun.AddCommand(testCmd)
 	}
 	root.AddCommand(cmdRun)
+	root.AddCommand(cmdExec)
 
 	cli.Execute(root)
 }
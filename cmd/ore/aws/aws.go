@@ -39,30 +39,51 @@ var (
 	profileName     string
 	accessKeyID     string
 	secretAccessKey string
+
+	roleARN              string
+	externalID           string
+	roleSessionName      string
+	webIdentityTokenFile string
 )
 
 func init() {
-	defaultRegion := os.Getenv("AWS_REGION")
-	if defaultRegion == "" {
-		defaultRegion = "us-west-2"
-	}
-
 	AWS.PersistentFlags().StringVar(&credentialsFile, "credentials-file", "", "AWS credentials file")
 	AWS.PersistentFlags().StringVar(&profileName, "profile", "", "AWS profile name")
 	AWS.PersistentFlags().StringVar(&accessKeyID, "access-id", "", "AWS access key")
 	AWS.PersistentFlags().StringVar(&secretAccessKey, "secret-key", "", "AWS secret key")
-	AWS.PersistentFlags().StringVar(&region, "region", defaultRegion, "AWS region")
+	AWS.PersistentFlags().StringVar(&region, "region", defaultRegion(), "AWS region")
+	AWS.PersistentFlags().StringVar(&roleARN, "role-arn", "", "AWS IAM role ARN to assume")
+	AWS.PersistentFlags().StringVar(&externalID, "external-id", "", "External ID to assume the AWS IAM role with")
+	AWS.PersistentFlags().StringVar(&roleSessionName, "role-session-name", "", "Session name of the assumed AWS IAM role (default \"mantle\")")
+	AWS.PersistentFlags().StringVar(&webIdentityTokenFile, "web-identity-token-file", "", "OIDC token file to assume --role-arn with, or \""+aws.WebIdentityGitHubActions+"\" to request the token from GitHub Actions")
 	cli.WrapPreRun(AWS, preflightCheck)
 }
 
+func defaultRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return "us-west-2"
+}
+
+// newAPI returns a client for the region with the credentials of the
+// flags.
+func newAPI(region string) (*aws.API, error) {
+	return aws.New(&aws.Options{
+		Region:               region,
+		CredentialsFile:      credentialsFile,
+		Profile:              profileName,
+		RoleARN:              roleARN,
+		ExternalID:           externalID,
+		RoleSessionName:      roleSessionName,
+		WebIdentityTokenFile: webIdentityTokenFile,
+		Options:              &platform.Options{},
+	})
+}
+
 func preflightCheck(cmd *cobra.Command, args []string) error {
 	plog.Debugf("Running AWS Preflight check. Region: %v", region)
-	api, err := aws.New(&aws.Options{
-		Region:          region,
-		CredentialsFile: credentialsFile,
-		Profile:         profileName,
-		Options:         &platform.Options{},
-	})
+	api, err := newAPI(region)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "could not create AWS client: %v\n", err)
 		os.Exit(1)
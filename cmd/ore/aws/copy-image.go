@@ -18,27 +18,44 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"github.com/flatcar/mantle/lang/worker"
+	"github.com/flatcar/mantle/platform/api/aws"
 )
 
 var (
 	cmdCopyImage = &cobra.Command{
 		Use:   "copy-image <dest-region...>",
 		Short: "Copy AWS image between regions",
-		Long: `Copy an AWS image to one or more regions.
+		Long: `Copy an AWS image to one or more regions concurrently.
+
+The copies keep the tags and launch permissions of the image and are tagged with SourceImage and SourceRegion. If a copy fails, the copies made so far are deleted unless --cleanup=false.
 
 After a successful run, the final line of output will be a line of JSON describing the resources created.
 `,
+		Example: `  ore aws copy-image --region=us-west-2 --image=ami-0123456789abcdef0 \
+	  --tags=Channel=stable --public --manifest=amis.json us-east-1 eu-central-1`,
 		RunE: runCopyImage,
 	}
 
 	sourceImageID string
+	copyTags      []string
+	copyPublic    bool
+	copyCleanup   bool
+	copyManifest  string
 )
 
 func init() {
 	AWS.AddCommand(cmdCopyImage)
 	cmdCopyImage.Flags().StringVar(&sourceImageID, "image", "", "source AMI")
+	cmdCopyImage.Flags().StringSliceVar(&copyTags, "tags", []string{}, "list of key=value tags to attach to the copies")
+	cmdCopyImage.Flags().BoolVar(&copyPublic, "public", false, "make the copies public")
+	cmdCopyImage.Flags().BoolVar(&copyCleanup, "cleanup", true, "delete the copies if any copy failed")
+	cmdCopyImage.Flags().StringVar(&copyManifest, "manifest", "", "write the AMI of every region, including the source, to this JSON file")
 }
 
 func runCopyImage(cmd *cobra.Command, args []string) error {
@@ -46,13 +63,41 @@ func runCopyImage(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Specify one or more regions.\n")
 		os.Exit(2)
 	}
+	tags, err := parseTags(copyTags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	tags["SourceImage"] = sourceImageID
+	tags["SourceRegion"] = region
 
 	amis, err := API.CopyImage(sourceImageID, args)
+	if err == nil {
+		err = finishCopies(amis, tags)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Couldn't copy images: %v\n", err)
+		if copyCleanup {
+			deleteCopies(amis)
+		}
 		os.Exit(1)
 	}
 
+	if copyManifest != "" {
+		manifest := map[string]string{region: sourceImageID}
+		for r, id := range amis {
+			manifest[r] = id
+		}
+		b, err := json.MarshalIndent(manifest, "", "  ")
+		if err == nil {
+			err = os.WriteFile(copyManifest, append(b, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't write manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	err = json.NewEncoder(os.Stdout).Encode(amis)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Couldn't encode result: %v\n", err)
@@ -60,3 +105,42 @@ func runCopyImage(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// finishCopies tags the copies and makes them public if requested.
+func finishCopies(amis, tags map[string]string) error {
+	regions := make([]string, 0, len(amis))
+	for r := range amis {
+		regions = append(regions, r)
+	}
+	sort.Strings(regions)
+	return worker.ForEach(context.Background(), aws.MaxConcurrentImageCopies, len(regions), func(ctx context.Context, i int) error {
+		api, err := newAPI(regions[i])
+		if err != nil {
+			return fmt.Errorf("creating client for %v: %v", regions[i], err)
+		}
+		imageID := amis[regions[i]]
+		if err := api.TagImage(imageID, tags); err != nil {
+			return fmt.Errorf("couldn't tag %v in %v: %v", imageID, regions[i], err)
+		}
+		if copyPublic {
+			if err := api.PublishImage(imageID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// deleteCopies deletes the copies of a failed run, so it leaves no partial
+// set of images behind.
+func deleteCopies(amis map[string]string) {
+	for r, imageID := range amis {
+		api, err := newAPI(r)
+		if err == nil {
+			err = api.DeleteImage(imageID)
+		}
+		if err != nil {
+			plog.Errorf("Couldn't delete copy %v in %v: %v", imageID, r, err)
+		}
+	}
+}
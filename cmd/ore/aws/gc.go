@@ -26,8 +26,9 @@ var (
 	cmdGC = &cobra.Command{
 		Use:   "gc",
 		Short: "GC resources in AWS",
-		Long:  `Delete instances created over the given duration ago`,
-		RunE:  runGC,
+		Long: `Delete instances, detached volumes, key pairs and images tagged
+CreatedBy=mantle that were created over the given duration ago.`,
+		RunE: runGC,
 	}
 
 	gcDuration time.Duration
@@ -0,0 +1,61 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdMetadataOptions = &cobra.Command{
+		Use:   "metadata-options",
+		Short: "Set the instance metadata options of EC2 instances",
+		Long: `Set whether the instance metadata service of running EC2 instances requires session tokens (IMDSv2).
+
+This allows to switch instances launched outside of kola to IMDSv2 only to test the metadata clients.`,
+		Example: `  ore aws metadata-options --instance-id=i-0123456789abcdef0 --imdsv2-only`,
+		RunE:    runMetadataOptions,
+	}
+
+	metadataInstanceIDs []string
+	metadataIMDSv2Only  bool
+)
+
+func init() {
+	AWS.AddCommand(cmdMetadataOptions)
+	cmdMetadataOptions.Flags().StringSliceVar(&metadataInstanceIDs, "instance-id", nil, "EC2 instance ID (can be repeated)")
+	cmdMetadataOptions.Flags().BoolVar(&metadataIMDSv2Only, "imdsv2-only", true, "require session tokens, false allows IMDSv1 again")
+}
+
+func runMetadataOptions(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in aws metadata-options cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if len(metadataInstanceIDs) == 0 {
+		fmt.Fprintf(os.Stderr, "Specify --instance-id\n")
+		os.Exit(2)
+	}
+
+	if err := API.SetMetadataOptions(metadataInstanceIDs, metadataIMDSv2Only); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flatcar/mantle/cmd/ore/upload"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/aws"
+)
+
+func init() {
+	upload.Register("aws", uploadImage)
+}
+
+// uploadImage implements "ore upload" for AWS: the image is imported as a
+// snapshot in the first region, registered as an AMI and copied to the
+// other regions.
+func uploadImage(opts *upload.Options) ([]upload.Image, error) {
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regions = []string{defaultRegion()}
+	}
+	apiOpts := &aws.Options{
+		Region:  regions[0],
+		Options: &platform.Options{},
+	}
+	api, err := aws.New(apiOpts)
+	if err != nil {
+		return nil, fmt.Errorf("could not create AWS client: %v", err)
+	}
+	if err := api.PreflightCheck(); err != nil {
+		return nil, fmt.Errorf("could not complete AWS preflight check: %v", err)
+	}
+
+	amiName := opts.Name
+	if amiName == "" {
+		version, err := opts.Version()
+		if err != nil {
+			return nil, err
+		}
+		// '+' is invalid in an AMI name
+		amiName = fmt.Sprintf("Container-Linux-dev-%s-%s", os.Getenv("USER"), strings.Replace(version, "+", "-", -1))
+	}
+	if opts.Board == "arm64-usr" && !strings.HasSuffix(amiName, "-arm64") {
+		amiName += "-arm64"
+	}
+	arch, err := aws.AmiArchForBoard(opts.Board)
+	if err != nil {
+		return nil, err
+	}
+	format := aws.EC2ImageFormatRaw
+	if strings.HasSuffix(opts.File, ".vmdk") {
+		format = aws.EC2ImageFormatVmdk
+	}
+
+	s3URL, err := defaultBucketURL("", amiName, opts.Board, opts.File, regions[0])
+	if err != nil {
+		return nil, err
+	}
+	s3Object := aws.BucketObject{
+		Bucket: s3URL.Host,
+		Path:   strings.TrimPrefix(s3URL.Path, "/"),
+	}
+	if opts.Force {
+		if err := api.RemoveImage(amiName, amiName, s3Object, regions[1:]); err != nil {
+			return nil, fmt.Errorf("removing existing image: %v", err)
+		}
+	}
+
+	// reuse the snapshot of a previous run
+	snapshot, err := api.FindSnapshot(amiName)
+	if err != nil {
+		return nil, fmt.Errorf("failed finding snapshot: %v", err)
+	}
+	if snapshot == nil {
+		f, err := os.Open(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		err = api.UploadObject(f, s3Object.Bucket, s3Object.Path, opts.Force)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("uploading: %v", err)
+		}
+		snapshot, err = api.CreateSnapshot(amiName, s3URL.String(), format)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create snapshot: %v", err)
+		}
+		if err := api.DeleteObject(s3Object.Bucket, s3Object.Path); err != nil {
+			return nil, fmt.Errorf("unable to delete object: %v", err)
+		}
+	}
+
+	amiID, err := api.CreateHVMImage(snapshot.SnapshotID, aws.ContainerLinuxDiskSizeGiB, amiName+"-hvm", "", arch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create HVM image: %v", err)
+	}
+	if err := api.CreateTags([]string{amiID, snapshot.SnapshotID}, opts.Tags); err != nil {
+		return nil, fmt.Errorf("unable to add tags: %v", err)
+	}
+	// the copies inherit the launch permissions and the tags
+	if opts.Public {
+		if err := api.PublishImage(amiID); err != nil {
+			return nil, err
+		}
+	}
+	images := []upload.Image{{Region: regions[0], ID: amiID}}
+	if len(regions) == 1 {
+		return images, nil
+	}
+
+	amis, err := api.CopyImage(amiID, regions[1:])
+	if err != nil {
+		return nil, fmt.Errorf("couldn't copy images: %v", err)
+	}
+	for _, region := range regions[1:] {
+		if opts.Public {
+			// the snapshots of the copies are still private
+			regionOpts := *apiOpts
+			regionOpts.Region = region
+			regionAPI, err := aws.New(&regionOpts)
+			if err != nil {
+				return nil, err
+			}
+			if err := regionAPI.PublishImage(amis[region]); err != nil {
+				return nil, err
+			}
+		}
+		images = append(images, upload.Image{Region: region, ID: amis[region]})
+	}
+	return images, nil
+}
@@ -125,6 +125,19 @@ func defaultBucketURL(urlPrefix, imageName, board, file, region string) (*url.UR
 	return s3URL, nil
 }
 
+// parseTags parses a list of key=value tags.
+func parseTags(tags []string) (map[string]string, error) {
+	tagMap := make(map[string]string)
+	for _, tag := range tags {
+		splitTag := strings.SplitN(tag, "=", 2)
+		if len(splitTag) != 2 {
+			return nil, fmt.Errorf("invalid tag format; should be key=value, not %v", tag)
+		}
+		tagMap[splitTag[0]] = splitTag[1]
+	}
+	return tagMap, nil
+}
+
 func runUpload(cmd *cobra.Command, args []string) error {
 	if len(args) != 0 {
 		fmt.Fprintf(os.Stderr, "Unrecognized args in aws upload cmd: %v\n", args)
@@ -290,15 +303,10 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	tagMap := make(map[string]string)
-	for _, tag := range uploadTags {
-		splitTag := strings.SplitN(tag, "=", 2)
-		if len(splitTag) != 2 {
-			fmt.Fprintf(os.Stderr, "invalid tag format; should be key=value, not %v\n", tag)
-			os.Exit(1)
-		}
-		key, value := splitTag[0], splitTag[1]
-		tagMap[key] = value
+	tagMap, err := parseTags(uploadTags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 
 	if err := API.CreateTags([]string{hvmID, sourceSnapshot}, tagMap); err != nil {
@@ -20,6 +20,7 @@ import (
 
 	"github.com/flatcar/mantle/auth"
 	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/api/azure"
 )
 
@@ -36,6 +37,11 @@ var (
 	azureSubscription string
 	azureLocation     string
 
+	azureCredentials    string
+	azureClientID       string
+	azureTenantID       string
+	azureSubscriptionID string
+
 	api *azure.API
 )
 
@@ -47,16 +53,25 @@ func init() {
 	sv(&azureAuth, "azure-auth", "", "Azure auth location (default \"~/"+auth.AzureAuthPath+"\")")
 	sv(&azureSubscription, "azure-subscription", "", "Azure subscription name. If unset, the first is used.")
 	sv(&azureLocation, "azure-location", "westus", "Azure location (default \"westus\")")
+	sv(&azureCredentials, "azure-credentials", "file", "Azure credentials: \"file\" for --azure-auth, \"workload-identity\" for federated OIDC tokens of GitHub Actions or AKS, or \"msi\" for the managed identity of the host")
+	sv(&azureClientID, "azure-client-id", "", "Azure client ID of the workload or user-assigned managed identity (default $AZURE_CLIENT_ID)")
+	sv(&azureTenantID, "azure-tenant-id", "", "Azure tenant ID of the workload identity (default $AZURE_TENANT_ID)")
+	sv(&azureSubscriptionID, "azure-subscription-id", "", "Azure subscription ID, needed without --azure-profile for workload-identity and msi credentials (default $AZURE_SUBSCRIPTION_ID)")
 }
 
 func preauth(cmd *cobra.Command, args []string) error {
 	plog.Printf("Creating Azure API...")
 
 	a, err := azure.New(&azure.Options{
+		Options:           &platform.Options{},
 		AzureProfile:      azureProfile,
 		AzureAuthLocation: azureAuth,
 		AzureSubscription: azureSubscription,
 		Location:          azureLocation,
+		Credentials:       azureCredentials,
+		ClientID:          azureClientID,
+		TenantID:          azureTenantID,
+		SubscriptionID:    azureSubscriptionID,
 	})
 	if err != nil {
 		plog.Fatalf("Failed to create Azure API: %v", err)
@@ -0,0 +1,132 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/platform/api/azure"
+)
+
+var (
+	cmdPublishGalleryImage = &cobra.Command{
+		Use:   "publish-gallery-image",
+		Short: "Publish an Azure Compute Gallery image version",
+		Long: `Publish a VHD blob as a version of an image in an Azure Compute Gallery.
+
+The gallery and the image definition are created if they don't exist. The blob must be in a storage account of the resource group of the gallery. The version is replicated to the location given with --azure-location and the target regions.
+
+After a successful run, the final line of output will be a line of JSON describing the image version.
+`,
+		Example: `  ore azure publish-gallery-image --azure-location=westeurope \
+	  --gallery=flatcar --image-name=flatcar-stable --image-version=3510.2.0 \
+	  --image-blob=https://kola.blob.core.windows.net/vhds/flatcar.vhd \
+	  --target-region=eastus=3 --target-region=westus2`,
+		RunE: runPublishGalleryImage,
+	}
+
+	// publish gallery image options
+	pgo struct {
+		version          azure.GalleryImageVersion
+		board            string
+		hyperVGeneration string
+		targetRegions    []string
+	}
+)
+
+func init() {
+	sv := cmdPublishGalleryImage.Flags().StringVar
+
+	sv(&pgo.version.Gallery, "gallery", "", "gallery name")
+	sv(&pgo.version.Image, "image-name", "", "image definition name")
+	sv(&pgo.version.Version, "image-version", "", "image version, e.g. 3510.2.0")
+	sv(&pgo.version.Publisher, "publisher", "kola", "publisher of the image definition")
+	sv(&pgo.version.Offer, "offer", "Flatcar", "offer of the image definition")
+	sv(&pgo.version.Sku, "sku", "dev", "SKU of the image definition")
+	sv(&pgo.version.BlobURI, "image-blob", "", "source blob url")
+	sv(&pgo.version.StorageAccount, "storage-account", "kola", "storage account name of the blob")
+	sv(&pgo.version.ResourceGroup, "resource-group", "kola", "resource group name of the gallery and the storage account")
+	sv(&pgo.board, "board", "amd64-usr", "board of the image")
+	sv(&pgo.hyperVGeneration, "hyper-v-generation", "V1", "Hyper-V generation of the image (\"V1\" or \"V2\")")
+	cmdPublishGalleryImage.Flags().StringSliceVar(&pgo.targetRegions, "target-region", nil,
+		"region[=replicas] to replicate the version to, with 1 replica by default")
+	cmdPublishGalleryImage.Flags().BoolVar(&pgo.version.ExcludeFromLatest, "exclude-from-latest", false,
+		"don't use the version for VMs using the latest version")
+
+	Azure.AddCommand(cmdPublishGalleryImage)
+}
+
+// parseTargetRegions parses a list of region[=replicas].
+func parseTargetRegions(regions []string) (map[string]int, error) {
+	targets := make(map[string]int)
+	for _, r := range regions {
+		region, replicas := r, 1
+		if i := strings.Index(r, "="); i >= 0 {
+			count, err := strconv.Atoi(r[i+1:])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid replica count in %q", r)
+			}
+			region, replicas = r[:i], count
+		}
+		targets[region] = replicas
+	}
+	return targets, nil
+}
+
+func runPublishGalleryImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in azure publish-gallery-image cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if pgo.version.Gallery == "" || pgo.version.Image == "" || pgo.version.Version == "" || pgo.version.BlobURI == "" {
+		fmt.Fprintf(os.Stderr, "--gallery, --image-name, --image-version and --image-blob are required\n")
+		os.Exit(2)
+	}
+	targets, err := parseTargetRegions(pgo.targetRegions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	pgo.version.TargetRegions = targets
+
+	if err := api.SetupClients(); err != nil {
+		fmt.Fprintf(os.Stderr, "setting up clients: %v\n", err)
+		os.Exit(1)
+	}
+	api.Opts.Board = pgo.board
+	api.Opts.HyperVGeneration = pgo.hyperVGeneration
+	id, err := api.PublishGalleryImage(&pgo.version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't publish gallery image: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(&struct {
+		ID string
+	}{
+		ID: id,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't encode result: %v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Microsoft/azure-vhd-utils/vhdcore/validator"
+
+	"github.com/flatcar/mantle/cmd/ore/upload"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/azure"
+)
+
+func init() {
+	upload.Register("azure", uploadImage)
+}
+
+// uploadImage implements "ore upload" for Azure: the VHD is uploaded to
+// the storage account and resource group used by kola by default and a
+// managed image is created from it in a single region.
+func uploadImage(opts *upload.Options) ([]upload.Image, error) {
+	region := "westus"
+	switch len(opts.Regions) {
+	case 0:
+	case 1:
+		region = opts.Regions[0]
+	default:
+		return nil, fmt.Errorf("managed images are created in a single region, got %d", len(opts.Regions))
+	}
+	if opts.Public {
+		return nil, fmt.Errorf("managed images can't be made public")
+	}
+	if !strings.HasSuffix(strings.ToLower(opts.File), ".vhd") {
+		return nil, fmt.Errorf("image should end with .vhd")
+	}
+	if err := validator.ValidateVhd(opts.File); err != nil {
+		return nil, err
+	}
+	if err := validator.ValidateVhdSize(opts.File); err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		version, err := opts.Version()
+		if err != nil {
+			return nil, err
+		}
+		name = fmt.Sprintf("Container-Linux-dev-%s-%s", os.Getenv("USER"), strings.Replace(version, "+", "-", -1))
+	}
+	hyperVGeneration := "V1"
+	if opts.Board == "arm64-usr" {
+		hyperVGeneration = "V2"
+	}
+
+	api, err := azure.New(&azure.Options{
+		Options:          &platform.Options{Board: opts.Board},
+		Location:         region,
+		HyperVGeneration: hyperVGeneration,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure API: %v", err)
+	}
+	if err := api.SetupClients(); err != nil {
+		return nil, fmt.Errorf("setting up clients: %v", err)
+	}
+
+	const (
+		storageAccount = "kola"
+		container      = "vhds"
+		resourceGroup  = "kola"
+	)
+	kr, err := api.GetStorageServiceKeysARM(storageAccount, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("fetching storage service keys failed: %v", err)
+	}
+	if kr.Keys == nil || len(*kr.Keys) == 0 {
+		return nil, fmt.Errorf("no storage service keys found")
+	}
+	key := *(*kr.Keys)[0].Value
+	blob := name + ".vhd"
+	if err := api.UploadBlob(storageAccount, key, opts.File, container, blob, opts.Force); err != nil {
+		return nil, fmt.Errorf("uploading blob failed: %v", err)
+	}
+
+	img, err := api.CreateImage(name, resourceGroup, api.UrlOfBlob(storageAccount, container, blob).String())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create image: %v", err)
+	}
+	if img.ID == nil {
+		return nil, fmt.Errorf("received nil image")
+	}
+	if err := api.TagImage(name, resourceGroup, opts.Tags); err != nil {
+		return nil, fmt.Errorf("couldn't tag image: %v", err)
+	}
+	return []upload.Image{{Region: region, ID: *img.ID}}, nil
+}
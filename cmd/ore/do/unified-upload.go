@@ -0,0 +1,75 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package do
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flatcar/mantle/cmd/ore/upload"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/do"
+)
+
+func init() {
+	upload.Register("do", uploadImage)
+}
+
+// uploadImage implements "ore upload" for DigitalOcean, which imports
+// images from URLs: the file must be the URL of the image. The tags are
+// added as "key:value".
+func uploadImage(opts *upload.Options) ([]upload.Image, error) {
+	if !strings.HasPrefix(opts.File, "http://") && !strings.HasPrefix(opts.File, "https://") {
+		return nil, fmt.Errorf("DigitalOcean imports images from URLs, the file must be one")
+	}
+	if opts.Name == "" {
+		return nil, fmt.Errorf("image name must be specified")
+	}
+	if opts.Public {
+		return nil, fmt.Errorf("custom images can't be made public")
+	}
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regions = []string{"sfo2"}
+	}
+	tags := do.Tags(opts.Tags)
+
+	ctx := context.Background()
+	var images []upload.Image
+	for _, region := range regions {
+		api, err := do.New(&do.Options{
+			Options: &platform.Options{},
+			Region:  region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create DigitalOcean client: %v", err)
+		}
+		if opts.Force {
+			if image, err := api.GetUserImage(ctx, opts.Name, true); err == nil {
+				if err := api.DeleteImage(ctx, image.ID); err != nil {
+					return nil, fmt.Errorf("deleting existing image in %s: %v", region, err)
+				}
+			}
+		}
+		image, err := api.CreateImage(ctx, opts.Name, opts.File, tags...)
+		if err != nil {
+			return nil, fmt.Errorf("creating image in %s: %v", region, err)
+		}
+		images = append(images, upload.Image{Region: region, ID: strconv.Itoa(image.ID)})
+	}
+	return images, nil
+}
@@ -35,14 +35,16 @@ var (
 		Run:   runCreateImage,
 	}
 
-	createImageFamily  string
-	createImageBoard   string
-	createImageVersion string
-	createImageRoot    string
-	createImageName    string
-	createImageLicense string
-	createImageForce   bool
-	createImagePublic  bool
+	createImageFamily   string
+	createImageBoard    string
+	createImageVersion  string
+	createImageRoot     string
+	createImageName     string
+	createImageLicenses []string
+	createImageFeatures []string
+	createImageForce    bool
+	createImagePublic   bool
+	createImageSEV      bool
 )
 
 func init() {
@@ -59,13 +61,18 @@ func init() {
 	cmdCreateImage.Flags().StringVar(&createImageName, "source-name",
 		"flatcar_production_gce.tar.gz",
 		"Storage image name")
-	cmdCreateImage.Flags().StringVar(&createImageLicense, "license",
-		"",
-		"GCE Image license name")
+	cmdCreateImage.Flags().StringSliceVar(&createImageLicenses, "license",
+		nil,
+		"GCE Image license names")
+	cmdCreateImage.Flags().StringSliceVar(&createImageFeatures, "guest-os-features",
+		gcloud.DefaultGuestOSFeatures,
+		"GCE guest OS features, e.g. UEFI_COMPATIBLE, GVNIC or SEV_CAPABLE")
 	cmdCreateImage.Flags().BoolVar(&createImageForce, "force",
 		false, "overwrite existing GCE images without prompt")
 	cmdCreateImage.Flags().BoolVar(&createImagePublic, "public",
 		false, "Set public ACLs on image")
+	cmdCreateImage.Flags().BoolVar(&createImageSEV, "confidential-compute",
+		false, "Mark the image as usable for Confidential VMs")
 	GCloud.AddCommand(cmdCreateImage)
 }
 
@@ -118,18 +125,15 @@ func runCreateImage(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("Creating image in GCE: %v...\n", imageNameGCE)
 
-	var licenses []string
-	if createImageLicense != "" {
-		licenses = append(licenses, createImageLicense)
-	}
-
 	// create image on gce
 	storageSrc := fmt.Sprintf("https://storage.googleapis.com/%v/%v", bucket, imageNameGS)
 	_, pending, err := api.CreateImage(&gcloud.ImageSpec{
-		Name:        imageNameGCE,
-		SourceImage: storageSrc,
-		Family:      createImageFamily,
-		Licenses:    licenses,
+		Name:                imageNameGCE,
+		SourceImage:         storageSrc,
+		Family:              createImageFamily,
+		Licenses:            createImageLicenses,
+		GuestOSFeatures:     createImageFeatures,
+		ConfidentialCompute: createImageSEV,
 	}, createImageForce)
 	if err == nil {
 		err = pending.Wait()
@@ -26,8 +26,9 @@ var (
 	cmdGC = &cobra.Command{
 		Use:   "gc",
 		Short: "GC resources in GCE",
-		Long:  `Delete instances created over the given duration ago.`,
-		RunE:  runGC,
+		Long: `Delete instances and images created by mantle over the given duration ago.
+Images are only deleted if they have the label created-by=mantle.`,
+		RunE: runGC,
 	}
 
 	gcDuration time.Duration
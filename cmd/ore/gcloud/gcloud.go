@@ -46,7 +46,8 @@ func init() {
 	sv(&opts.DiskType, "disktype", "pd-ssd", "disk type")
 	sv(&opts.BaseName, "basename", "kola", "instance name prefix")
 	sv(&opts.Network, "network", "default", "network name")
-	sv(&opts.JSONKeyFile, "json-key", "", "use a service account's JSON key for authentication")
+	sv(&opts.JSONKeyFile, "json-key", "", "use a service account's JSON key, or the JSON credentials of workload identity federation, for authentication")
+	sv(&opts.ImpersonateServiceAccount, "impersonate-service-account", "", "email of a service account to impersonate with the credentials of --json-key or --service-auth")
 	GCloud.PersistentFlags().BoolVar(&opts.ServiceAuth, "service-auth", false, "use non-interactive auth when running within GCE")
 
 	cli.WrapPreRun(GCloud, preauth)
@@ -0,0 +1,88 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/cmd/ore/upload"
+	"github.com/flatcar/mantle/platform/api/gcloud"
+)
+
+func init() {
+	upload.Register("gce", uploadImage)
+}
+
+// uploadImage implements "ore upload" for GCE: the image is uploaded to
+// the default bucket of "ore gcloud upload" and the tags become the
+// labels of the image. GCE images are global, the regions are ignored.
+func uploadImage(uploadOpts *upload.Options) ([]upload.Image, error) {
+	if len(uploadOpts.Regions) != 0 {
+		plog.Noticef("GCE images are global, ignoring the regions %s", strings.Join(uploadOpts.Regions, ", "))
+	}
+	api, err := gcloud.New(&opts)
+	if err != nil {
+		return nil, err
+	}
+	storageAPI, err := storage.New(api.Client())
+	if err != nil {
+		return nil, fmt.Errorf("storage client failed: %v", err)
+	}
+
+	name := uploadOpts.Name
+	if name == "" {
+		if name, err = uploadOpts.Version(); err != nil {
+			return nil, err
+		}
+	}
+	bucket := "users.developer.core-os.net"
+	if user := os.Getenv("USER"); user != "" {
+		name = user + "/" + uploadOpts.Board + "/" + name
+	}
+	imageNameGCE := gceSanitize(name)
+	imageNameGS := name + ".tar.gz"
+
+	alreadyExists, err := fileQuery(storageAPI, bucket, imageNameGS)
+	if err != nil {
+		return nil, err
+	}
+	if alreadyExists && !uploadOpts.Force {
+		plog.Noticef("Reusing gs://%s/%s", bucket, imageNameGS)
+	} else if err := writeFile(storageAPI, bucket, uploadOpts.File, imageNameGS); err != nil {
+		return nil, err
+	}
+
+	_, pending, err := api.CreateImage(&gcloud.ImageSpec{
+		Name:        imageNameGCE,
+		SourceImage: fmt.Sprintf("https://storage.googleapis.com/%v/%v", bucket, imageNameGS),
+		Labels:      uploadOpts.Tags,
+	}, uploadOpts.Force)
+	if err == nil {
+		err = pending.Wait()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating GCE image failed: %v", err)
+	}
+	if uploadOpts.Public {
+		if err := api.SetImagePublic(imageNameGCE); err != nil {
+			return nil, fmt.Errorf("marking GCE image with public ACLs failed: %v", err)
+		}
+	}
+	return []upload.Image{{ID: imageNameGCE}}, nil
+}
@@ -43,6 +43,10 @@ var (
 	uploadFile      string
 	uploadForce     bool
 	uploadPublic    bool
+	uploadSEV       bool
+	uploadFamily    string
+	uploadLicenses  []string
+	uploadFeatures  []string
 )
 
 func init() {
@@ -55,6 +59,10 @@ func init() {
 		"path_to_flatcar_image (build with: ./image_to_vm.sh --format=gce ...)")
 	cmdUpload.Flags().BoolVar(&uploadForce, "force", false, "overwrite existing GS and GCE images without prompt")
 	cmdUpload.Flags().BoolVar(&uploadPublic, "public", false, "Set public ACLs on image")
+	cmdUpload.Flags().BoolVar(&uploadSEV, "confidential-compute", false, "Mark the image as usable for Confidential VMs")
+	cmdUpload.Flags().StringVar(&uploadFamily, "family", "", "GCE image family")
+	cmdUpload.Flags().StringSliceVar(&uploadLicenses, "license", nil, "GCE image license names")
+	cmdUpload.Flags().StringSliceVar(&uploadFeatures, "guest-os-features", gcloud.DefaultGuestOSFeatures, "GCE guest OS features, e.g. UEFI_COMPATIBLE, GVNIC or SEV_CAPABLE")
 	GCloud.AddCommand(cmdUpload)
 }
 
@@ -140,10 +148,15 @@ func runUpload(cmd *cobra.Command, args []string) {
 
 	// create image on gce
 	storageSrc := fmt.Sprintf("https://storage.googleapis.com/%v/%v", uploadBucket, imageNameGS)
-	_, pending, err := api.CreateImage(&gcloud.ImageSpec{
-		Name:        imageNameGCE,
-		SourceImage: storageSrc,
-	}, uploadForce)
+	spec := &gcloud.ImageSpec{
+		Name:                imageNameGCE,
+		SourceImage:         storageSrc,
+		Family:              uploadFamily,
+		Licenses:            uploadLicenses,
+		GuestOSFeatures:     uploadFeatures,
+		ConfidentialCompute: uploadSEV,
+	}
+	_, pending, err := api.CreateImage(spec, uploadForce)
 	if err == nil {
 		err = pending.Wait()
 	}
@@ -159,10 +172,7 @@ func runUpload(cmd *cobra.Command, args []string) {
 		switch ans {
 		case "y", "Y", "yes":
 			fmt.Println("Overriding existing image...")
-			_, pending, err = api.CreateImage(&gcloud.ImageSpec{
-				Name:        imageNameGCE,
-				SourceImage: storageSrc,
-			}, true)
+			_, pending, err = api.CreateImage(spec, true)
 			if err == nil {
 				err = pending.Wait()
 			}
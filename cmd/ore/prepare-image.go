@@ -0,0 +1,90 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+var (
+	cmdPrepareImage = &cobra.Command{
+		Use:   "prepare-image",
+		Short: "Apply image hooks to a local image",
+		Long: `Apply the image hooks of a platform to a copy of a local image before uploading it.
+
+The hooks file is the same JSON file passed to kola with --image-hooks. Hooks other than resize need root privileges.`,
+		Example: `  ore prepare-image --hooks hooks.json --platform gce --input flatcar_production_image.bin --output gce.bin`,
+		RunE:    runPrepareImage,
+	}
+
+	prepareHooksFile string
+	preparePlatform  string
+	prepareInput     string
+	prepareOutput    string
+)
+
+func init() {
+	root.AddCommand(cmdPrepareImage)
+	cmdPrepareImage.Flags().StringVar(&prepareHooksFile, "hooks", "", "JSON file with per-platform image hooks")
+	cmdPrepareImage.Flags().StringVar(&preparePlatform, "platform", "", "platform whose hooks are applied")
+	cmdPrepareImage.Flags().StringVar(&prepareInput, "input", "", "path to the input image")
+	cmdPrepareImage.Flags().StringVar(&prepareOutput, "output", "", "path to write the prepared image to")
+}
+
+func runPrepareImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in prepare-image cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if prepareHooksFile == "" || preparePlatform == "" || prepareInput == "" || prepareOutput == "" {
+		fmt.Fprintf(os.Stderr, "Specify --hooks, --platform, --input and --output\n")
+		os.Exit(2)
+	}
+
+	hooks, err := platform.LoadImageHooks(prepareHooksFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Loading image hooks failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(hooks[preparePlatform]) == 0 {
+		fmt.Fprintf(os.Stderr, "No image hooks for platform %q in %s\n", preparePlatform, prepareHooksFile)
+		os.Exit(1)
+	}
+
+	// prepare in the output directory so the result can be renamed
+	path, err := platform.PrepareImage(prepareInput, filepath.Dir(prepareOutput), hooks[preparePlatform])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Preparing image failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.Rename(path, prepareOutput); err != nil {
+		os.Remove(path)
+		fmt.Fprintf(os.Stderr, "Writing image failed: %v\n", err)
+		os.Exit(1)
+	}
+	// temporary files are created with mode 0600
+	if err := os.Chmod(prepareOutput, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
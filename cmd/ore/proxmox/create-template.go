@@ -0,0 +1,95 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateTemplate = &cobra.Command{
+		Use:   "create-template [options]",
+		Short: "Create a Flatcar template",
+		Long: `Upload a Flatcar disk image and turn it into a VM template that kola can clone.
+
+The image should be the proxmoxve image, e.g.
+flatcar_production_proxmoxve_image.img. Importing disk images needs
+Proxmox VE 8.2 or newer and the "import" content type enabled on the
+ISO storage.
+
+After a successful run, the template VM ID is written to stdout.`,
+		RunE: runCreateTemplate,
+	}
+
+	templateName string
+	imagePath    string
+)
+
+func init() {
+	Proxmox.AddCommand(cmdCreateTemplate)
+	cmdCreateTemplate.Flags().StringVarP(&templateName, "name", "n", "", "template name")
+	cmdCreateTemplate.Flags().StringVar(&imagePath, "file", "", "path to the disk image")
+	cmdCreateTemplate.Flags().StringVar(&options.Storage, "storage", "local-lvm", "storage for the template disk")
+	cmdCreateTemplate.Flags().StringVar(&options.Bridge, "bridge", "vmbr0", "network bridge")
+	cmdCreateTemplate.Flags().StringVar(&options.Pool, "pool", "", "resource pool")
+	cmdCreateTemplate.Flags().IntVar(&options.Memory, "memory", 2048, "memory in MiB")
+	cmdCreateTemplate.Flags().IntVar(&options.Cores, "cores", 2, "CPU cores")
+}
+
+func runCreateTemplate(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in proxmox create-template cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	if err := createTemplate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func createTemplate() error {
+	if templateName == "" {
+		return fmt.Errorf("Template name must be specified")
+	}
+	if imagePath == "" {
+		return fmt.Errorf("Image file must be specified")
+	}
+	ctx := context.Background()
+
+	image, err := API.UploadImage(ctx, imagePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := API.DeleteVolume(ctx, image); err != nil {
+			plog.Errorf("deleting uploaded image %s: %v", image, err)
+		}
+	}()
+
+	vm, err := API.CreateTemplate(ctx, templateName, image)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(vm.ID)
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdGC = &cobra.Command{
+		Use:   "gc",
+		Short: "GC resources in Proxmox VE",
+		Long:  `Delete VMs running or existing for longer than the given duration, along with their config drives.`,
+		RunE:  runGC,
+	}
+
+	gcDuration time.Duration
+	gcPrefix   string
+)
+
+func init() {
+	Proxmox.AddCommand(cmdGC)
+	cmdGC.Flags().DurationVar(&gcDuration, "duration", 5*time.Hour, "how old resources must be before they're considered garbage")
+	cmdGC.Flags().StringVar(&gcPrefix, "prefix", "kola-", "only consider VMs whose name starts with this prefix")
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in proxmox gc cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	if err := API.GC(context.Background(), gcPrefix, gcDuration); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/platform/api/proxmox"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/proxmox")
+
+	Proxmox = &cobra.Command{
+		Use:   "proxmox [command]",
+		Short: "Proxmox VE machine utilities",
+	}
+
+	API     *proxmox.API
+	options proxmox.Options
+)
+
+func init() {
+	Proxmox.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.ProxmoxConfigPath+"\")")
+	Proxmox.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
+	Proxmox.PersistentFlags().StringVar(&options.URL, "url", "", "API URL, e.g. \"https://pve.example.com:8006\" (overrides config file)")
+	Proxmox.PersistentFlags().StringVar(&options.TokenID, "token-id", "", "API token ID in the form USER@REALM!TOKENID (overrides config file)")
+	Proxmox.PersistentFlags().StringVar(&options.TokenSecret, "token-secret", "", "API token secret (overrides config file)")
+	Proxmox.PersistentFlags().StringVar(&options.Node, "node", "", "node to operate on (overrides config file)")
+	Proxmox.PersistentFlags().BoolVar(&options.Insecure, "insecure", false, "skip TLS certificate verification")
+	Proxmox.PersistentFlags().StringVar(&options.ISOStorage, "iso-storage", "local", "storage for uploaded ISO and disk images")
+	cli.WrapPreRun(Proxmox, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	plog.Debugf("Running Proxmox VE preflight check")
+	api, err := proxmox.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create Proxmox VE client: %v", err)
+	}
+	if err := api.PreflightCheck(context.Background()); err != nil {
+		return fmt.Errorf("could not complete Proxmox VE preflight check: %v", err)
+	}
+
+	plog.Debugf("Preflight check success; we have liftoff")
+	API = api
+	return nil
+}
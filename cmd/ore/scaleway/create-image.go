@@ -0,0 +1,97 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateImage = &cobra.Command{
+		Use:   "create-image [options]",
+		Short: "Create image",
+		Long: `Upload a qcow2 image to Object Storage and import it as image.
+
+The image should be the Scaleway image, e.g.
+flatcar_production_scaleway_image.qcow2. If --file is not given, the
+object named by --key must already exist in the bucket.
+
+After a successful run, the image ID is written to stdout.`,
+		RunE: runCreateImage,
+	}
+
+	imageName string
+	imageFile string
+	imageKey  string
+	imageArch string
+)
+
+func init() {
+	Scaleway.AddCommand(cmdCreateImage)
+	cmdCreateImage.Flags().StringVarP(&imageName, "name", "n", "", "image name")
+	cmdCreateImage.Flags().StringVar(&imageFile, "file", "", "path to a local qcow2 image to upload")
+	cmdCreateImage.Flags().StringVar(&options.Bucket, "bucket", "", "Object Storage bucket")
+	cmdCreateImage.Flags().StringVar(&imageKey, "key", "", "object key in the bucket (default: base name of --file)")
+	cmdCreateImage.Flags().StringVar(&imageArch, "arch", "x86_64", "image architecture: x86_64, arm64")
+}
+
+func runCreateImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in scaleway create-image cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	if err := createImage(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func createImage() error {
+	if imageName == "" {
+		return fmt.Errorf("Image name must be specified")
+	}
+	if options.Bucket == "" {
+		return fmt.Errorf("Bucket must be specified")
+	}
+	if imageKey == "" {
+		if imageFile == "" {
+			return fmt.Errorf("Either image file or key must be specified")
+		}
+		imageKey = filepath.Base(imageFile)
+	}
+	ctx := context.Background()
+
+	if imageFile != "" {
+		if err := API.UploadObject(ctx, imageFile, imageKey); err != nil {
+			return err
+		}
+	}
+
+	id, err := API.CreateImage(ctx, imageName, imageKey, imageArch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(id)
+	return nil
+}
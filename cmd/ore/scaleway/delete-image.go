@@ -0,0 +1,58 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdDeleteImage = &cobra.Command{
+		Use:   "delete-image [options]",
+		Short: "Delete image",
+		Long:  `Delete an image and its snapshot.`,
+		RunE:  runDeleteImage,
+	}
+
+	deleteImageID string
+)
+
+func init() {
+	Scaleway.AddCommand(cmdDeleteImage)
+	cmdDeleteImage.Flags().StringVar(&deleteImageID, "id", "", "image ID")
+}
+
+func runDeleteImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in scaleway delete-image cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	if deleteImageID == "" {
+		fmt.Fprintf(os.Stderr, "Image ID must be specified\n")
+		os.Exit(2)
+	}
+
+	if err := API.DeleteImage(context.Background(), deleteImageID); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
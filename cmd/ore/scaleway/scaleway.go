@@ -0,0 +1,65 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/platform/api/scaleway"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/scaleway")
+
+	Scaleway = &cobra.Command{
+		Use:   "scaleway [command]",
+		Short: "Scaleway machine utilities",
+	}
+
+	API     *scaleway.API
+	options scaleway.Options
+)
+
+func init() {
+	Scaleway.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.ScalewayConfigPath+"\")")
+	Scaleway.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
+	Scaleway.PersistentFlags().StringVar(&options.AccessKey, "access-key", "", "access key (overrides config file)")
+	Scaleway.PersistentFlags().StringVar(&options.SecretKey, "secret-key", "", "secret key (overrides config file)")
+	Scaleway.PersistentFlags().StringVar(&options.ProjectID, "project-id", "", "project ID (overrides config file)")
+	Scaleway.PersistentFlags().StringVar(&options.Region, "region", "", "region (default derived from the zone)")
+	Scaleway.PersistentFlags().StringVar(&options.Zone, "zone", "", "zone (default \"fr-par-1\")")
+	cli.WrapPreRun(Scaleway, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	plog.Debugf("Running Scaleway preflight check")
+	api, err := scaleway.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create Scaleway client: %v", err)
+	}
+	if err := api.PreflightCheck(context.Background()); err != nil {
+		return fmt.Errorf("could not complete Scaleway preflight check: %v", err)
+	}
+
+	plog.Debugf("Preflight check success; we have liftoff")
+	API = api
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/sdk"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/upload")
+
+	Upload = &cobra.Command{
+		Use:   "upload",
+		Short: "Upload an image to a cloud",
+		Long: `Upload an image and create the images of a cloud platform from it.
+
+The flags are shared by all platforms, the commands of each platform, e.g. "ore aws upload", offer more control. The credentials are read from the default locations of each platform.
+
+After a successful run, the final line of output will be a line of JSON describing the images created.
+`,
+		Example: `  ore upload --platform=aws \
+	  --file="/home/.../flatcar_production_ami_vmdk_image.vmdk" \
+	  --region=us-east-1,eu-central-1 --public --tag=channel=alpha`,
+		RunE: runUpload,
+	}
+
+	uploadPlatform string
+	uploadTags     []string
+	options        Options
+
+	uploaders = make(map[string]Uploader)
+)
+
+// Options are the settings of an upload, common to all platforms.
+type Options struct {
+	// File is the image to upload, in the format of the platform.
+	File string
+	// Name is the name of the images, the platform derives one from
+	// the version of File if empty.
+	Name  string
+	Board string
+	// Regions are the regions to create the images in, the first being
+	// the one the image is uploaded to. The platform picks a default if
+	// empty.
+	Regions []string
+	// Public makes the images usable by everyone.
+	Public bool
+	Tags   map[string]string
+	// Force replaces existing uploads and images of the same name.
+	Force bool
+}
+
+// Version returns the version of the image from the version.txt next
+// to File.
+func (o *Options) Version() (string, error) {
+	ver, err := sdk.VersionsFromDir(filepath.Dir(o.File))
+	if err != nil {
+		return "", fmt.Errorf("unable to get version from image directory, provide a --name flag or include a version.txt in the image directory: %v", err)
+	}
+	return ver.Version, nil
+}
+
+// Image is an image created by an upload.
+type Image struct {
+	// Region is empty for global images.
+	Region string `json:",omitempty"`
+	ID     string
+}
+
+// Uploader uploads the image of opts to a platform.
+type Uploader func(opts *Options) ([]Image, error)
+
+// Register adds the uploader of a platform.
+func Register(platform string, u Uploader) {
+	if _, ok := uploaders[platform]; ok {
+		panic(fmt.Sprintf("duplicate uploader for %q", platform))
+	}
+	uploaders[platform] = u
+}
+
+// Platforms returns the platforms with an uploader.
+func Platforms() []string {
+	var platforms []string
+	for name := range uploaders {
+		platforms = append(platforms, name)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+func init() {
+	sv := Upload.Flags().StringVar
+
+	sv(&uploadPlatform, "platform", "", "platform to upload to")
+	sv(&options.File, "file", "", "path to the image, or its URL on platforms importing from URLs")
+	sv(&options.Name, "name", "", "name of the images (default: derived from the version.txt of the image)")
+	sv(&options.Board, "board", "amd64-usr", "board of the image")
+	Upload.Flags().StringSliceVar(&options.Regions, "region", nil, "regions to create the images in, the image is uploaded to the first (default: the default region of the platform)")
+	Upload.Flags().BoolVar(&options.Public, "public", false, "make the images public")
+	Upload.Flags().StringSliceVar(&uploadTags, "tag", nil, "key=value tag to attach to the images")
+	Upload.Flags().BoolVar(&options.Force, "force", false, "replace existing uploads and images")
+}
+
+func runUpload(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in ore upload cmd: %v\n", args)
+		os.Exit(2)
+	}
+	uploader, ok := uploaders[uploadPlatform]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "--platform must be one of %s\n", strings.Join(Platforms(), ", "))
+		os.Exit(2)
+	}
+	if options.File == "" {
+		fmt.Fprintf(os.Stderr, "--file is required\n")
+		os.Exit(2)
+	}
+
+	options.Tags = make(map[string]string)
+	for _, tag := range uploadTags {
+		splitTag := strings.SplitN(tag, "=", 2)
+		if len(splitTag) != 2 {
+			fmt.Fprintf(os.Stderr, "invalid tag format; should be key=value, not %v\n", tag)
+			os.Exit(2)
+		}
+		options.Tags[splitTag[0]] = splitTag[1]
+	}
+
+	plog.Infof("Uploading %s to %s", options.File, uploadPlatform)
+	images, err := uploader(&options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Uploading to %s failed: %v\n", uploadPlatform, err)
+		os.Exit(1)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(&struct {
+		Platform string
+		Images   []Image
+	}{
+		Platform: uploadPlatform,
+		Images:   images,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't encode result: %v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdImportOVA = &cobra.Command{
+		Use:   "import-ova [options]",
+		Short: "Import a Flatcar OVA as template",
+		Long: `Import the Flatcar vmware OVA, e.g. flatcar_production_vmware_ova.ova,
+as a VM template that kola can clone with --vsphere-template.`,
+		RunE: runImportOVA,
+	}
+
+	templateName string
+	ovaPath      string
+)
+
+func init() {
+	VSphere.AddCommand(cmdImportOVA)
+	cmdImportOVA.Flags().StringVarP(&templateName, "name", "n", "", "template name")
+	cmdImportOVA.Flags().StringVar(&ovaPath, "file", "", "path to the OVA")
+}
+
+func runImportOVA(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in vsphere import-ova cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if templateName == "" || ovaPath == "" {
+		fmt.Fprintf(os.Stderr, "Template name and OVA file must be specified\n")
+		os.Exit(2)
+	}
+
+	if _, err := API.ImportOVA(context.Background(), templateName, ovaPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/platform/api/vsphere"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/vsphere")
+
+	VSphere = &cobra.Command{
+		Use:   "vsphere [command]",
+		Short: "VMware vSphere machine utilities",
+	}
+
+	API     *vsphere.API
+	options vsphere.Options
+)
+
+func init() {
+	VSphere.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.VSphereConfigPath+"\")")
+	VSphere.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
+	VSphere.PersistentFlags().StringVar(&options.Server, "server", "", "vCenter server (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.User, "user", "", "vCenter user (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.Password, "password", "", "vCenter password (overrides config file)")
+	VSphere.PersistentFlags().BoolVar(&options.Insecure, "insecure", false, "skip TLS certificate verification")
+	VSphere.PersistentFlags().StringVar(&options.Datacenter, "datacenter", "", "datacenter (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.ResourcePool, "resource-pool", "", "resource pool (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.Datastore, "datastore", "", "datastore (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.Network, "network", "", "network (overrides config file)")
+	VSphere.PersistentFlags().StringVar(&options.Folder, "folder", "", "VM folder (overrides config file)")
+	cli.WrapPreRun(VSphere, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	plog.Debugf("Running vSphere preflight check")
+	api, err := vsphere.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create vSphere client: %v", err)
+	}
+	if err := api.PreflightCheck(context.Background()); err != nil {
+		return fmt.Errorf("could not complete vSphere preflight check: %v", err)
+	}
+
+	plog.Debugf("Preflight check success; we have liftoff")
+	API = api
+	return nil
+}
@@ -16,13 +16,12 @@ package main
 
 import (
 	"fmt"
-	"net/url"
-	"path"
 	"strings"
 
 	"github.com/spf13/pflag"
 
 	"github.com/flatcar/mantle/lang/maps"
+	"github.com/flatcar/mantle/release"
 	"github.com/flatcar/mantle/sdk"
 )
 
@@ -32,16 +31,17 @@ var (
 	specVersion       string
 	specAwsPartition  string
 	specPrivateBucket bool
+	specManifest      string
 	gceBoards         = []string{"amd64-usr", "arm64-usr"}
 	azureBoards       = []string{"amd64-usr", "arm64-usr"}
 	awsBoards         = []string{"amd64-usr", "arm64-usr"}
-	azureEnvironments = []azureEnvironmentSpec{
-		azureEnvironmentSpec{
+	azureEnvironments = []release.AzureEnvironmentSpec{
+		release.AzureEnvironmentSpec{
 			SubscriptionName: "AzureCloud",
 		},
 	}
-	awsPartitions = map[string]awsPartitionSpec{
-		"default": awsPartitionSpec{
+	awsPartitions = map[string]release.AWSPartitionSpec{
+		"default": release.AWSPartitionSpec{
 			Name:              "AWS",
 			Profile:           "default",
 			Bucket:            "flatcar-prod-ami-import-eu-central-1",
@@ -72,7 +72,7 @@ var (
 				"me-south-1",
 			},
 		},
-		"china": awsPartitionSpec{
+		"china": release.AWSPartitionSpec{
 			Name:         "AWS China",
 			Profile:      "china",
 			Bucket:       "flatcar-prod-ami-import-cn-north-1",
@@ -82,7 +82,7 @@ var (
 				"cn-northwest-1",
 			},
 		},
-		"developer": awsPartitionSpec{
+		"developer": release.AWSPartitionSpec{
 			Name:         "AWS Developer",
 			Profile:      "default",
 			Bucket:       "flatcar-developer-ami-import-us-west-2",
@@ -100,57 +100,57 @@ var (
 	lts_desc    = "The LTS channel should be used by production clusters. Versions of Flatcar Container Linux are battle-tested within the Stable channel before being promoted."
 	dev_desc    = "The Developer Channel is used for internal test builds."
 
-	specs = map[string]channelSpec{
-		"alpha": channelSpec{
+	specs = map[string]release.Manifest{
+		"alpha": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
+			Destinations: []release.StorageSpec{},
 			GCE:          newGceSpec("alpha", alpha_desc),
 			Azure:        newAzureSpec(azureEnvironments, "publish", "Flatcar Alpha", "", alpha_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "publish", "Flatcar Alpha", "", alpha_desc),
 			AWS:          newAWSSpec(),
 		},
-		"beta": channelSpec{
+		"beta": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
+			Destinations: []release.StorageSpec{},
 			GCE:          newGceSpec("beta", beta_desc),
 			Azure:        newAzureSpec(azureEnvironments, "publish", "Flatcar Beta", "", beta_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "publish", "Flatcar Beta", "", beta_desc),
 			AWS:          newAWSSpec(),
 		},
-		"stable": channelSpec{
+		"stable": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
+			Destinations: []release.StorageSpec{},
 			GCE:          newGceSpec("stable", stable_desc),
 			Azure:        newAzureSpec(azureEnvironments, "publish", "Flatcar Stable", "", stable_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "publish", "Flatcar Stable", "", stable_desc),
 			AWS:          newAWSSpec(),
 		},
-		"edge": channelSpec{
+		"edge": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
+			Destinations: []release.StorageSpec{},
 			GCE:          newGceSpec("edge", edge_desc),
 			Azure:        newAzureSpec(azureEnvironments, "publish", "Flatcar Edge", "", edge_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "publish", "Flatcar Edge", "", edge_desc),
 			AWS:          newAWSSpec(),
 		},
-		"lts": channelSpec{
+		"lts": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
+			Destinations: []release.StorageSpec{},
 			GCE:          newGceSpec("lts", lts_desc),
 			Azure:        newAzureSpec(azureEnvironments, "publish", "Flatcar LTS", "", lts_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "publish", "Flatcar LTS", "", lts_desc),
 			AWS:          newAWSSpec(),
 		},
-		"developer": channelSpec{
+		"developer": release.Manifest{
 			BaseURL:      "http://bincache.flatcar-linux.net/images",
 			Boards:       []string{"amd64-usr", "arm64-usr"},
-			Destinations: []storageSpec{},
-			GCE:          gceSpec{},
+			Destinations: []release.StorageSpec{},
+			GCE:          release.GCESpec{},
 			Azure:        newAzureSpec(azureEnvironments, "developer", "Flatcar Developer Channel", "", dev_desc),
 			AzurePremium: newAzureSpec(azureEnvironments, "developer", "Flatcar Developer Channel", "", dev_desc),
 			AWS:          newAWSSpec(),
@@ -158,8 +158,8 @@ var (
 	}
 )
 
-func newGceSpec(channel, description string) gceSpec {
-	return gceSpec{
+func newGceSpec(channel, description string) release.GCESpec {
+	return release.GCESpec{
 		Project:     "kinvolk-public",
 		Family:      fmt.Sprintf("flatcar-%s", channel),
 		Description: description,
@@ -170,8 +170,8 @@ func newGceSpec(channel, description string) gceSpec {
 	}
 }
 
-func newAzureSpec(environments []azureEnvironmentSpec, container, label, category string, description string) azureSpec {
-	return azureSpec{
+func newAzureSpec(environments []release.AzureEnvironmentSpec, container, label, category string, description string) release.AzureSpec {
+	return release.AzureSpec{
 		Offer:             "Flatcar",
 		Image:             fmt.Sprintf("flatcar_production_azure%s_image.vhd.bz2", category),
 		StorageAccount:    "flatcar",
@@ -186,8 +186,8 @@ func newAzureSpec(environments []azureEnvironmentSpec, container, label, categor
 	}
 }
 
-func newAWSSpec() awsSpec {
-	return awsSpec{
+func newAWSSpec() release.AWSSpec {
+	return release.AWSSpec{
 		BaseName:        "Flatcar",
 		BaseDescription: "Flatcar Container Linux",
 		Prefix:          "flatcar_production_ami_",
@@ -212,30 +212,7 @@ func AddSpecFlags(flags *pflag.FlagSet) {
 		false, "Private GCE Bucket")
 }
 
-func AmiNameArchTag() string {
-	switch specBoard {
-	case "amd64-usr":
-		return ""
-	case "arm64-usr":
-		return "-arm64"
-	default:
-		plog.Fatalf("No AMI name architecture tag defined for board %q", specBoard)
-		return "" // dummy
-	}
-}
-
-func AzureBlobName() string {
-	archTag := ""
-	switch specBoard {
-	case "amd64-usr":
-		archTag = "amd64"
-	case "arm64-usr":
-		archTag = "arm64"
-	}
-	return fmt.Sprintf("flatcar-linux-%s-%s-%s.vhd", specVersion, specChannel, archTag)
-}
-
-func ChannelSpec() channelSpec {
+func ChannelSpec() release.Manifest {
 	if specBoard == "" {
 		plog.Fatal("--board is required")
 	}
@@ -273,7 +250,7 @@ func ChannelSpec() channelSpec {
 		}
 	}
 	if !gceOk {
-		spec.GCE = gceSpec{}
+		spec.GCE = release.GCESpec{}
 	}
 
 	azureOk := false
@@ -284,7 +261,7 @@ func ChannelSpec() channelSpec {
 		}
 	}
 	if !azureOk {
-		spec.Azure = azureSpec{}
+		spec.Azure = release.AzureSpec{}
 	}
 
 	awsOk := false
@@ -295,7 +272,7 @@ func ChannelSpec() channelSpec {
 		}
 	}
 	if !awsOk {
-		spec.AWS = awsSpec{}
+		spec.AWS = release.AWSSpec{}
 	}
 
 	// For the developer channel, use the developer partition
@@ -307,59 +284,31 @@ func ChannelSpec() channelSpec {
 	if !awsPartitionOk {
 		plog.Fatalf("Unknown AWS Partition: %s", specAwsPartition)
 	}
-	spec.AWS.Partitions = []awsPartitionSpec{awsPartition}
+	spec.AWS.Partitions = []release.AWSPartitionSpec{awsPartition}
 
+	spec.Channel = specChannel
+	spec.Version = specVersion
+	spec.Boards = []string{specBoard}
 	return spec
 }
 
-func (cs channelSpec) SourceURL() string {
-	baseURL := cs.BaseURL
-	if gceJSONKeyFile == "none" {
-		baseURL = strings.Replace(baseURL, "gs://", "https://bucket.release.flatcar-linux.net/", 1)
-	}
-
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		panic(err)
-	}
-
-	// We conditionnally drop the '-usr' of the board based on the
-	// URL scheme of the BaseURL.
-	arch := specBoard
-	if u.Scheme != "gs" {
-		arch = strings.TrimSuffix(specBoard, "-usr")
-	}
-
-	u.Path = path.Join(u.Path, arch, specVersion)
-	return u.String()
+// AddManifestFlag adds the flag reading the release manifest from a file,
+// instead of building it from the spec flags.
+func AddManifestFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&specManifest, "manifest", "",
+		"JSON release manifest, replacing --board, --channel, --version and --partition")
 }
 
-func (ss storageSpec) ParentPrefixes() []string {
-	u, err := url.Parse(ss.BaseURL)
-	if err != nil {
-		panic(err)
+// Manifest returns the release manifest of the --manifest file, or else
+// of the spec flags.
+func Manifest() *release.Manifest {
+	if specManifest == "" {
+		spec := ChannelSpec()
+		return &spec
 	}
-	return []string{u.Path, path.Join(u.Path, specBoard)}
-}
-
-func (ss storageSpec) FinalPrefixes() []string {
-	u, err := url.Parse(ss.BaseURL)
+	m, err := release.LoadManifest(specManifest)
 	if err != nil {
-		plog.Panic(err)
+		plog.Fatal(err)
 	}
-
-	prefixes := []string{}
-	if ss.VersionPath {
-		prefixes = append(prefixes,
-			path.Join(u.Path, specBoard, specVersion))
-	}
-	if ss.NamedPath != "" {
-		prefixes = append(prefixes,
-			path.Join(u.Path, specBoard, ss.NamedPath))
-	}
-	if len(prefixes) == 0 {
-		plog.Panicf("Invalid destination: %#v", ss)
-	}
-
-	return prefixes
+	return m
 }
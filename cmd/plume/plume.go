@@ -23,6 +23,7 @@ import (
 
 	"github.com/flatcar/mantle/auth"
 	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/release"
 )
 
 var (
@@ -33,10 +34,12 @@ var (
 	}
 
 	gceJSONKeyFile string
+	parallel       int
 )
 
 func init() {
 	root.PersistentFlags().StringVar(&gceJSONKeyFile, "gce-json-key", "", "use a JSON key for authentication (set to 'none' for unauthorized access)")
+	root.PersistentFlags().IntVar(&parallel, "parallel", 8, "maximum number of concurrent operations in bulk operations, e.g. publishing in many regions")
 }
 
 func getGoogleClient() (*http.Client, error) {
@@ -54,6 +57,32 @@ func getGoogleClient() (*http.Client, error) {
 	return auth.GoogleClient()
 }
 
+// releaseOptions returns the options of pre-release and release given by
+// the flags shared by the commands.
+func releaseOptions() *release.Options {
+	client, err := getGoogleClient()
+	if err != nil {
+		plog.Fatalf("Authentication failed: %v", err)
+	}
+	return &release.Options{
+		Client:                        client,
+		Unauthenticated:               gceJSONKeyFile == "none",
+		AWSCredentialsFile:            awsCredentialsFile,
+		AWSMarketplaceCredentialsFile: awsMarketplaceCredentialsFile,
+		PublishMarketplace:            publishMarketplace,
+		AccessRoleARN:                 accessRoleARN,
+		ProductIDs:                    productIDs,
+		Username:                      username,
+		AzureProfile:                  azureProfile,
+		AzureAuth:                     azureAuth,
+		AzureTestContainer:            azureTestContainer,
+		AzureCategory:                 azureCategory,
+		GCEReleaseKey:                 gceReleaseKey,
+		VerifyKeyFile:                 verifyKeyFile,
+		Parallel:                      parallel,
+	}
+}
+
 func main() {
 	cli.Execute(root)
 }
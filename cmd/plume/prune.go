@@ -27,8 +27,10 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 
+	"github.com/flatcar/mantle/lang/worker"
 	"github.com/flatcar/mantle/platform/api/aws"
 	"github.com/flatcar/mantle/platform/api/azure"
+	"github.com/flatcar/mantle/release"
 )
 
 var (
@@ -92,7 +94,7 @@ func runPrune(cmd *cobra.Command, args []string) {
 	pruneAzure(ctx, &spec)
 }
 
-func pruneAzure(ctx context.Context, spec *channelSpec) {
+func pruneAzure(ctx context.Context, spec *release.Manifest) {
 	if spec.Azure.StorageAccount == "" || azureProfile == "" {
 		plog.Notice("Azure image pruning disabled, skipping.")
 		return
@@ -138,6 +140,7 @@ func pruneAzure(ctx context.Context, spec *channelSpec) {
 			plog.Infof("Got %d blobs for container %q (key %v)", len(blobs), container, key)
 
 			now := time.Now()
+			var obsolete []string
 			for _, blob := range blobs {
 				// Check that the blob's name includes the channel
 				if !strings.Contains(blob.Name, specChannel) {
@@ -165,13 +168,22 @@ func pruneAzure(ctx context.Context, spec *channelSpec) {
 					continue
 				}
 				plog.Infof("Obsolete blob %q: %d days old", blob.Name, daysOld)
-				if !pruneDryRun {
-					plog.Infof("Deleting blob %q in container %q", blob.Name, container)
-					err = api.DeleteBlob(spec.Azure.StorageAccount, *key.Value, container, blob.Name)
-					if err != nil {
-						plog.Warningf("Error deleting blob (%v): %v", blob.Name, err)
-					}
+				obsolete = append(obsolete, blob.Name)
+			}
+			if pruneDryRun {
+				continue
+			}
+
+			key := *key.Value
+			err = worker.ForEach(ctx, parallel, len(obsolete), func(ctx context.Context, i int) error {
+				plog.Infof("Deleting blob %q in container %q", obsolete[i], container)
+				if err := api.DeleteBlob(spec.Azure.StorageAccount, key, container, obsolete[i]); err != nil {
+					return fmt.Errorf("deleting blob %v: %v", obsolete[i], err)
 				}
+				return nil
+			}, worker.LogProgress(plog, "deleting blobs"))
+			if err != nil {
+				plog.Warningf("Error deleting blobs: %v", err)
 			}
 		}
 	}
@@ -186,7 +198,7 @@ type deleteStats struct {
 	deleted      int
 }
 
-func pruneAWS(ctx context.Context, spec *channelSpec) {
+func pruneAWS(ctx context.Context, spec *release.Manifest) {
 	if spec.AWS.Image == "" || awsCredentialsFile == "" {
 		plog.Notice("AWS image pruning disabled.")
 		return
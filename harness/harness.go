@@ -32,6 +32,7 @@ import (
 	"time"
 
 	"github.com/flatcar/mantle/harness/reporters"
+	"github.com/flatcar/mantle/harness/results"
 	"github.com/flatcar/mantle/harness/testresult"
 )
 
@@ -55,6 +56,7 @@ type H struct {
 	cancel   context.CancelFunc
 	ran      bool // Test (or one of its subtests) was executed.
 	failed   bool // Test has failed.
+	infra    bool // Test has failed because of the infrastructure.
 	skipped  bool // Test has been skipped.
 	finished bool // Test function has completed.
 	done     bool // Test is finished and all subtests have completed.
@@ -66,13 +68,21 @@ type H struct {
 	name     string    // Name of test.
 	start    time.Time // Time test started
 	duration time.Duration
-	barrier  chan bool // To signal parallel subtests they may start.
+	ready    chan bool // To signal a parallel test it may start.
 	signal   chan bool // To signal a test is done.
 	sub      []*H      // Queue of subtests to be run in parallel.
 
 	isParallel bool
 
+	// quarantined is set for the tests on the quarantine list of the
+	// suite and their subtests, whose failures don't fail the suite.
+	quarantined bool
+
+	machines []results.Machine
+	metrics  map[string]float64
+
 	reporters reporters.Reporters
+	subtests  *subtestFilter // Subtests to run, see FilterSubtests.
 }
 
 func (c *H) parentContext() context.Context {
@@ -88,7 +98,11 @@ func (h *H) Verbose() bool {
 }
 
 func (c *H) status() testresult.TestResult {
-	if c.Failed() {
+	if c.quarantined && c.Failed() {
+		return testresult.Quarantined
+	} else if c.InfraFailed() {
+		return testresult.Infra
+	} else if c.Failed() {
 		return testresult.Fail
 	} else if c.Skipped() {
 		return testresult.Skip
@@ -110,7 +124,9 @@ func (c *H) flushToParent(format string, args ...interface{}) {
 	// TODO: include test numbers in TAP output.
 	if p.tap != nil {
 		name := strings.Replace(c.name, "#", "", -1)
-		if status == testresult.Fail {
+		if status == testresult.Quarantined {
+			fmt.Fprintf(p.tap, "not ok - %s # TODO quarantined\n", name)
+		} else if status == testresult.Fail || status == testresult.Infra {
 			// Filter passed subtests and their output away
 			rePassBeforeFail := regexp.MustCompile(` *?--- PASS: .*?(\n.*?)+?--- FAIL`)
 			rePassAfterFail := regexp.MustCompile(` *?--- PASS: .*?\n`)
@@ -181,8 +197,9 @@ func (c *H) setRan() {
 }
 
 // Fail marks the function as having failed but continues execution.
+// Failures of quarantined tests don't fail their parent.
 func (c *H) Fail() {
-	if c.parent != nil {
+	if c.parent != nil && (!c.quarantined || c.parent.quarantined) {
 		c.parent.Fail()
 	}
 	c.mu.Lock()
@@ -194,6 +211,26 @@ func (c *H) Fail() {
 	c.failed = true
 }
 
+// InfraFail marks the function as having failed because of the
+// infrastructure it ran on, e.g. a reclaimed spot instance, rather than
+// because of the code under test. It is reported as INFRA instead of FAIL
+// but still fails the suite.
+func (c *H) InfraFail(reason string) {
+	c.log("infrastructure failure: " + reason)
+	c.Fail()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.infra = true
+}
+
+// InfraFailed reports whether the function has failed because of the
+// infrastructure.
+func (c *H) InfraFailed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.infra
+}
+
 // Failed reports whether the function has failed.
 func (c *H) Failed() bool {
 	c.mu.RLock()
@@ -332,6 +369,29 @@ func (h *H) OutputDir() string {
 	return dir
 }
 
+// RecordMachine adds a machine created by the test to its results.
+func (h *H) RecordMachine(m results.Machine) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, o := range h.machines {
+		if o.ID == m.ID {
+			return
+		}
+	}
+	h.machines = append(h.machines, m)
+}
+
+// RecordMetric sets a numeric measurement of the test in its results,
+// replacing any earlier value of the metric.
+func (h *H) RecordMetric(name string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.metrics == nil {
+		h.metrics = make(map[string]float64)
+	}
+	h.metrics[name] = value
+}
+
 // TempDir creates a new directory under OutputDir.
 // No cleanup is required.
 func (h *H) TempDir(prefix string) string {
@@ -380,10 +440,17 @@ func (t *H) Parallel() {
 	// Add to the list of tests to be released by the parent.
 	t.parent.sub = append(t.parent.sub, t)
 
-	t.signal <- true   // Release calling test.
-	<-t.parent.barrier // Wait for the parent test to complete.
-	t.suite.waitParallel()
+	if p := t.suite.opts.Progress; p != nil && t.level == 1 {
+		p.TestQueued(t.name)
+	}
+
+	t.signal <- true // Release calling test.
+	<-t.ready        // Wait for the parent test to complete and a free slot.
 	t.start = time.Now()
+
+	if p := t.suite.opts.Progress; p != nil && t.level == 1 {
+		p.TestStarted(t.name)
+	}
 }
 
 func tRunner(t *H, fn func(t *H)) {
@@ -411,8 +478,13 @@ func tRunner(t *H, fn func(t *H)) {
 			// Run parallel subtests.
 			// Decrease the running count for this test.
 			t.suite.release()
-			// Release the parallel subtests.
-			close(t.barrier)
+			// Release the parallel subtests one by one in the order
+			// they were queued, so tests expected to take longest
+			// start first, see Options.Durations.
+			for _, sub := range t.sub {
+				t.suite.waitParallel()
+				sub.ready <- true
+			}
 			// Wait for subtests to complete.
 			for _, sub := range t.sub {
 				<-sub.signal
@@ -438,6 +510,9 @@ func tRunner(t *H, fn func(t *H)) {
 	}()
 
 	t.start = time.Now()
+	if p := t.suite.opts.Progress; p != nil && t.level == 1 {
+		p.TestStarted(t.name)
+	}
 	fn(t)
 	t.finished = true
 }
@@ -447,17 +522,20 @@ func tRunner(t *H, fn func(t *H)) {
 func (t *H) Run(name string, f func(t *H)) bool {
 	t.hasSub = true
 	testName, ok := t.suite.match.fullName(t, name)
-	if !ok {
+	if !ok || !t.subtests.match(testName) {
 		return true
 	}
 	t = &H{
-		barrier:   make(chan bool),
+		ready:     make(chan bool),
 		signal:    make(chan bool),
 		name:      testName,
 		suite:     t.suite,
 		parent:    t,
 		level:     t.level + 1,
 		reporters: t.reporters,
+		subtests:  t.subtests,
+
+		quarantined: t.quarantined || t.suite.quarantine.match(testName),
 	}
 	t.w = indenter{t}
 	// Indent logs 8 spaces to distinguish them from sub-test headers.
@@ -489,7 +567,7 @@ func (t *H) report() {
 	format := "--- %s: %s (%s)\n"
 
 	status := t.status()
-	if status == testresult.Fail || t.suite.opts.Verbose {
+	if status == testresult.Fail || status == testresult.Infra || status == testresult.Quarantined || t.suite.opts.Verbose {
 		t.flushToParent(format, status, t.name, dstr)
 	}
 
@@ -505,7 +583,14 @@ func (t *H) report() {
 	// could also write verbosely to the 'reporter sink'.  I'm fine with
 	// this being a TODO if you don't want to tackle it in this initial
 	// PR.
+	t.mu.RLock()
+	t.reporters.ReportTestDetails(t.name, t.machines, t.metrics)
+	t.mu.RUnlock()
 	t.reporters.ReportTest(t.name, status, t.duration, t.output.Bytes())
+
+	if p := t.suite.opts.Progress; p != nil && t.level == 1 {
+		p.TestFinished(t.name, status, t.duration)
+	}
 }
 
 // CleanOutputDir creates/empties an output directory and returns the cleaned path.
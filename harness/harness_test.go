@@ -28,6 +28,9 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/flatcar/mantle/harness/reporters"
+	"github.com/flatcar/mantle/harness/results"
 )
 
 func TestMain(m *testing.M) {
@@ -133,6 +136,22 @@ func TestSubTests(t *testing.T) {
 				})
 			})
 		},
+	}, {
+		desc:   "infrastructure failure is reported as such",
+		err:    SuiteFailed,
+		maxPar: 1,
+		output: `
+--- FAIL: infrastructure failure is reported as such (N.NNs)
+    --- INFRA: infrastructure failure is reported as such/#00 (N.NNs)
+            harness_test.go:NNN: ssh: connection refused
+            harness_test.go:NNN: infrastructure failure: spot instance reclaimed
+		`,
+		f: func(t *H) {
+			t.Run("", func(t *H) {
+				t.Errorf("ssh: connection refused")
+				t.InfraFail("spot instance reclaimed")
+			})
+		},
 	}, {
 		desc:   "skipping without message, chatty",
 		chatty: true,
@@ -487,3 +506,70 @@ func TestTempFile(t *testing.T) {
 		t.Errorf("%q missing %q prefix", second, "second")
 	}
 }
+
+func TestDurations(t *testing.T) {
+	var started []string
+	test := func(h *H) {
+		h.Parallel()
+		started = append(started, h.Name())
+	}
+	opts := Options{
+		Parallel: 1,
+		Durations: map[string]time.Duration{
+			"short": time.Minute,
+			"long":  time.Hour,
+			"mid":   10 * time.Minute,
+		},
+	}
+	// unknown is expected to take the mean, between long and mid
+	suite := NewSuite(opts, Tests{
+		"short":   test,
+		"mid":     test,
+		"unknown": test,
+		"long":    test,
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Fatal(err)
+	}
+
+	expect := []string{"long", "unknown", "mid", "short"}
+	if !reflect.DeepEqual(started, expect) {
+		t.Errorf("started %v, expected %v", started, expect)
+	}
+}
+
+func TestParallelReports(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{
+		OutputDir: filepath.Join(dir, "_test_temp"),
+		Parallel:  4,
+		Reporters: reporters.Reporters{
+			reporters.NewJSONReporter("report.json", "fake", "amd64", "1.0"),
+		},
+	}
+	tests := Tests{}
+	for i := 0; i < 4; i++ {
+		tests.Add(fmt.Sprintf("test%d", i), func(h *H) {
+			h.Parallel()
+			for j := 0; j < 4; j++ {
+				h.Run(fmt.Sprintf("sub%d", j), func(h *H) {
+					h.Parallel()
+				})
+			}
+		})
+	}
+	if err := NewSuite(opts, tests).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := results.Read(filepath.Join(opts.OutputDir, "reports", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Tests) != 4*5 {
+		t.Errorf("report has %d tests, expected %d", len(run.Tests), 4*5)
+	}
+}
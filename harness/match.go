@@ -97,6 +97,64 @@ func (m *matcher) fullName(c *H, subname string) (name string, ok bool) {
 	return name, true
 }
 
+// subtestFilter selects the subtests below the test named base. Each
+// alternative holds the regexps the levels of the subtest names must match.
+type subtestFilter struct {
+	base         string
+	alternatives [][]*regexp.Regexp
+}
+
+// match reports whether the subtest with the full name, see H.Name, runs.
+func (f *subtestFilter) match(name string) bool {
+	if f == nil {
+		return true
+	}
+	rel := strings.TrimPrefix(name, f.base+"/")
+	if rel == name {
+		// not below the test of the filter
+		return true
+	}
+	elems := strings.Split(rel, "/")
+	for _, alt := range f.alternatives {
+		ok := true
+		for i, re := range alt {
+			if i >= len(elems) {
+				break
+			}
+			if !re.MatchString(elems[i]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterSubtests runs only the subtests of t matching one of patterns,
+// like the part after the first slash of the -run flag of go test: a
+// pattern is split at slashes into unanchored regexps, each matching the
+// names of the subtests at its level below t. Subtests at the levels below
+// a pattern all run. It must be called before t runs subtests.
+func (t *H) FilterSubtests(patterns []string) error {
+	f := &subtestFilter{base: t.name}
+	for _, pattern := range patterns {
+		var alt []*regexp.Regexp
+		for _, s := range splitRegexp(pattern) {
+			re, err := regexp.Compile(rewrite(s))
+			if err != nil {
+				return fmt.Errorf("invalid subtest pattern %q: %v", pattern, err)
+			}
+			alt = append(alt, re)
+		}
+		f.alternatives = append(f.alternatives, alt)
+	}
+	t.subtests = f
+	return nil
+}
+
 func splitRegexp(s string) []string {
 	a := make([]string, 0, strings.Count(s, "/"))
 	cs := 0
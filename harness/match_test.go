@@ -138,6 +138,42 @@ func TestMatcher(t *testing.T) {
 	}
 }
 
+func TestFilterSubtests(t *testing.T) {
+	testCases := []struct {
+		patterns []string
+		name     string
+		ok       bool
+	}{
+		{[]string{"reload"}, "test/reload", true},
+		{[]string{"reload"}, "test/reload/x", true},
+		{[]string{"reload"}, "test/merge", false},
+		{[]string{"^re"}, "test/unreload", false},
+		{[]string{"reload", "merge"}, "test/merge", true},
+		{[]string{"reload/x"}, "test/reload", true},
+		{[]string{"reload/x"}, "test/reload/x", true},
+		{[]string{"reload/x"}, "test/reload/y", false},
+		{[]string{"/x"}, "test/merge/x", true},
+		// names are rewritten like the subtest names
+		{[]string{"with space"}, "test/with_space", true},
+		// other tests are not filtered
+		{[]string{"reload"}, "other/merge", true},
+	}
+
+	for _, tc := range testCases {
+		h := &H{name: "test", level: 1}
+		if err := h.FilterSubtests(tc.patterns); err != nil {
+			t.Fatal(err)
+		}
+		if ok := h.subtests.match(tc.name); ok != tc.ok {
+			t.Errorf("for patterns %q, match(%q) = %v; want %v", tc.patterns, tc.name, ok, tc.ok)
+		}
+	}
+
+	if err := (&H{name: "test"}).FilterSubtests([]string{"a/("}); err == nil {
+		t.Errorf("invalid pattern accepted")
+	}
+}
+
 func TestNaming(t *testing.T) {
 	m := newMatcher("", "")
 
@@ -0,0 +1,107 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+// Progress is notified about the top-level tests of a suite as they run,
+// e.g. to display the state of a long run. The methods are called
+// concurrently from the goroutines running the tests.
+type Progress interface {
+	// Start is called before any test is run with the number of tests.
+	Start(tests int)
+	// TestStarted is called when a test starts running, and again when
+	// a parallel test got a slot after TestQueued.
+	TestStarted(name string)
+	// TestQueued is called when a parallel test waits for a slot.
+	TestQueued(name string)
+	// TestStatus is called with a short description of what a running
+	// test currently does, see H.Status.
+	TestStatus(name, status string)
+	// TestFinished is called with the result of a test.
+	TestFinished(name string, result testresult.TestResult, duration time.Duration)
+	// Finish is called after all tests finished.
+	Finish()
+}
+
+// Progresses notifies several Progress implementations in order.
+type Progresses []Progress
+
+func (ps Progresses) Start(tests int) {
+	for _, p := range ps {
+		p.Start(tests)
+	}
+}
+
+func (ps Progresses) TestStarted(name string) {
+	for _, p := range ps {
+		p.TestStarted(name)
+	}
+}
+
+func (ps Progresses) TestQueued(name string) {
+	for _, p := range ps {
+		p.TestQueued(name)
+	}
+}
+
+func (ps Progresses) TestStatus(name, status string) {
+	for _, p := range ps {
+		p.TestStatus(name, status)
+	}
+}
+
+func (ps Progresses) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	for _, p := range ps {
+		p.TestFinished(name, result, duration)
+	}
+}
+
+func (ps Progresses) Finish() {
+	for _, p := range ps {
+		p.Finish()
+	}
+}
+
+// topLevel returns the top-level test h belongs to, or nil for the root.
+func (h *H) topLevel() *H {
+	for ; h != nil && h.level > 1; h = h.parent {
+	}
+	if h == nil || h.level != 1 {
+		return nil
+	}
+	return h
+}
+
+// Status describes what the test currently does, e.g. "provisioning
+// machines (1/3 up)", for the progress display of the suite. Subtests
+// update the status of their top-level test.
+func (h *H) Status(format string, args ...interface{}) {
+	p := h.suite.opts.Progress
+	top := h.topLevel()
+	if p == nil || top == nil {
+		return
+	}
+	status := fmt.Sprintf(format, args...)
+	if top != h {
+		status = fmt.Sprintf("%s: %s", h.name[len(top.name)+1:], status)
+	}
+	p.TestStatus(top.name, status)
+}
@@ -0,0 +1,279 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress displays the progress of harness test suites.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+// state tracks the tests of a suite.
+type state struct {
+	mu       sync.Mutex
+	start    time.Time
+	total    int
+	queued   map[string]bool
+	running  map[string]*test
+	results  map[testresult.TestResult]int
+	failures []string
+}
+
+type test struct {
+	start  time.Time
+	status string
+}
+
+func newState() state {
+	return state{
+		queued:  make(map[string]bool),
+		running: make(map[string]*test),
+		results: make(map[testresult.TestResult]int),
+	}
+}
+
+func (s *state) Start(tests int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = time.Now()
+	s.total += tests
+}
+
+func (s *state) TestStarted(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queued, name)
+	s.running[name] = &test{start: time.Now()}
+}
+
+func (s *state) TestQueued(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+	s.queued[name] = true
+}
+
+func (s *state) TestStatus(name, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.running[name]; ok {
+		t.status = status
+	}
+}
+
+func (s *state) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queued, name)
+	delete(s.running, name)
+	s.results[result]++
+	if result == testresult.Fail || result == testresult.Infra || result == testresult.Quarantined {
+		s.failures = append(s.failures, fmt.Sprintf("%s %s (%s)", result, name, fmtDuration(duration)))
+	}
+}
+
+// summary returns a line with the counts of the tests. Must be called with
+// mu held.
+func (s *state) summary() string {
+	done := 0
+	for _, n := range s.results {
+		done += n
+	}
+	return fmt.Sprintf("%d/%d done, %d running, %d queued, %d passed, %d failed, %d infra, %d skipped, %s elapsed",
+		done, s.total, len(s.running), len(s.queued), s.results[testresult.Pass],
+		s.results[testresult.Fail], s.results[testresult.Infra], s.results[testresult.Skip],
+		fmtDuration(time.Since(s.start)))
+}
+
+func fmtDuration(d time.Duration) string {
+	return d.Truncate(time.Second).String()
+}
+
+// Plain prints a line for every change of the state of a test, for
+// terminals without cursor movement and for logs.
+type Plain struct {
+	state
+	w io.Writer
+}
+
+// NewPlain returns a Plain progress writing to w.
+func NewPlain(w io.Writer) *Plain {
+	return &Plain{state: newState(), w: w}
+}
+
+func (p *Plain) printf(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "progress: "+format+"\n", args...)
+}
+
+func (p *Plain) TestStarted(name string) {
+	p.state.TestStarted(name)
+	p.printf("started %s", name)
+}
+
+func (p *Plain) TestStatus(name, status string) {
+	p.state.TestStatus(name, status)
+	p.printf("%s: %s", name, status)
+}
+
+func (p *Plain) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	p.state.TestFinished(name, result, duration)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.printf("%s %s (%s), %s", result, name, fmtDuration(duration), p.summary())
+}
+
+func (p *Plain) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.printf("finished: %s", p.summary())
+}
+
+// maxRunningLines limits the running tests shown by Terminal.
+const maxRunningLines = 20
+
+// Terminal keeps a block with the running tests and their status at the
+// bottom of a terminal, redrawn every second. Failures are printed above
+// it. Other output
+// must be written through the Terminal so the block is redrawn below it.
+type Terminal struct {
+	state
+	w io.Writer
+
+	lines int // height of the drawn block
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewTerminal returns a Terminal progress drawing to the terminal w.
+func NewTerminal(w io.Writer) *Terminal {
+	return &Terminal{state: newState(), w: w}
+}
+
+func (t *Terminal) Start(tests int) {
+	t.state.Start(tests)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		return
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.mu.Lock()
+				t.redraw()
+				t.mu.Unlock()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Write writes p above the block.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	n, err := t.w.Write(p)
+	t.draw()
+	return n, err
+}
+
+// TestFinished prints failures above the block, so they stay visible.
+func (t *Terminal) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	t.state.TestFinished(name, result, duration)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	if result == testresult.Fail || result == testresult.Infra || result == testresult.Quarantined {
+		fmt.Fprintf(t.w, "\x1b[31m%s\x1b[0m\n", t.failures[len(t.failures)-1])
+	}
+	t.draw()
+}
+
+func (t *Terminal) Finish() {
+	t.mu.Lock()
+	stop, done := t.stop, t.done
+	t.stop = nil
+	t.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.redraw()
+	// keep the final block
+	t.lines = 0
+}
+
+// clear removes the block. Must be called with mu held.
+func (t *Terminal) clear() {
+	if t.lines > 0 {
+		// move to the start of the first line of the block and
+		// clear to the end of the screen
+		fmt.Fprintf(t.w, "\r\x1b[%dA\x1b[J", t.lines)
+		t.lines = 0
+	}
+}
+
+func (t *Terminal) redraw() {
+	t.clear()
+	t.draw()
+}
+
+// draw draws the block below the cursor. Must be called with mu held.
+func (t *Terminal) draw() {
+	var names []string
+	for name := range t.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	more := 0
+	if len(names) > maxRunningLines {
+		more = len(names) - maxRunningLines
+		names = names[:maxRunningLines]
+	}
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		test := t.running[name]
+		fmt.Fprintf(&b, "  %-*s %8s  %s\n", width, name, fmtDuration(time.Since(test.start)), test.status)
+	}
+	if more > 0 {
+		fmt.Fprintf(&b, "  ... and %d more\n", more)
+	}
+	fmt.Fprintf(&b, "\x1b[1m%s\x1b[0m\n", t.summary())
+	t.lines = strings.Count(b.String(), "\n")
+	io.WriteString(t.w, b.String())
+}
@@ -0,0 +1,72 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flatcar/mantle/harness"
+)
+
+func TestPlain(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPlain(&out)
+
+	var tests harness.Tests
+	tests.Add("pass", func(h *harness.H) {
+		h.Parallel()
+		h.Status("provisioning machines (%d/%d up)", 1, 2)
+		h.Run("sub", func(h *harness.H) {
+			h.Status("running")
+		})
+	})
+	tests.Add("fail", func(h *harness.H) {
+		h.Parallel()
+		h.Fail()
+	})
+	tests.Add("infra", func(h *harness.H) {
+		h.InfraFail("machine reclaimed")
+	})
+	tests.Add("skip", func(h *harness.H) {
+		h.Skip("skipped")
+	})
+
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: filepath.Join(t.TempDir(), "_progress_temp"),
+		Parallel:  1,
+		Output:    ioutil.Discard,
+		Progress:  p,
+	}, tests)
+	if err := suite.Run(); err != harness.SuiteFailed {
+		t.Fatalf("expected suite to fail, got %v", err)
+	}
+
+	for _, line := range []string{
+		"progress: started pass\n",
+		"progress: pass: provisioning machines (1/2 up)\n",
+		"progress: pass: sub: running\n",
+		"progress: FAIL fail (",
+		"progress: INFRA infra (",
+		"progress: finished: 4/4 done, 0 running, 0 queued, 1 passed, 1 failed, 1 infra, 1 skipped",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("%q not found in output:\n%s", line, out.String())
+		}
+	}
+}
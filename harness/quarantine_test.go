@@ -0,0 +1,88 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	run := func(quarantine []string, tests Tests) (string, error) {
+		suite := NewSuite(Options{
+			OutputDir:  filepath.Join(t.TempDir(), "_quarantine_temp"),
+			Quarantine: quarantine,
+		}, tests)
+		var buf bytes.Buffer
+		err := suite.runTests(&buf, nil)
+		return buf.String(), err
+	}
+
+	flaky := Tests{
+		"cl.flaky": func(h *H) {
+			h.Run("sub", func(h *H) {
+				h.Fail()
+			})
+		},
+		"cl.stable": func(h *H) {},
+	}
+	out, err := run([]string{"cl.fl*"}, flaky)
+	if err != nil {
+		t.Errorf("quarantined failure failed the suite: %v\n%s", err, out)
+	}
+	for _, line := range []string{"--- QUARANTINED: cl.flaky ", "--- QUARANTINED: cl.flaky/sub "} {
+		if !strings.Contains(out, line) {
+			t.Errorf("%q not found in output:\n%s", line, out)
+		}
+	}
+
+	if out, err := run([]string{"cl.other"}, flaky); err != SuiteFailed {
+		t.Errorf("expected the suite to fail, got %v\n%s", err, out)
+	}
+
+	broken := Tests{
+		"cl.flaky":  func(h *H) {},
+		"cl.broken": func(h *H) { h.Fail() },
+	}
+	if out, err := run([]string{"cl.flaky"}, broken); err != SuiteFailed {
+		t.Errorf("expected the suite to fail, got %v\n%s", err, out)
+	}
+}
+
+func TestLoadQuarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine")
+	if err := os.WriteFile(path, []byte("# known flakes\ncl.network.*  # issue 123\n\n  docker.lib-coreos-dockerd-compat\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := LoadQuarantine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cl.network.*", "docker.lib-coreos-dockerd-compat"}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("got %v, expected %v", patterns, expected)
+	}
+
+	if err := os.WriteFile(path, []byte("cl.[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadQuarantine(path); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -15,58 +15,94 @@
 package reporters
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/flatcar/mantle/harness/results"
 	"github.com/flatcar/mantle/harness/testresult"
 )
 
+// jsonReporter writes the results of a run in the format of the results
+// package.
 type jsonReporter struct {
-	Tests    []jsonTest            `json:"tests"`
-	Result   testresult.TestResult `json:"result"`
+	// mu guards details and run.Tests, parallel tests report
+	// concurrently
+	mu       sync.Mutex
+	run      results.Run
+	details  map[string]results.Test
 	filename string
-
-	// Context variables
-	Platform string `json:"platform"`
-	Version  string `json:"version"`
-}
-
-type jsonTest struct {
-	Name     string                `json:"name"`
-	Result   testresult.TestResult `json:"result"`
-	Duration time.Duration         `json:"duration"`
-	Output   string                `json:"output"`
 }
 
-func NewJSONReporter(filename, platform, version string) *jsonReporter {
+func NewJSONReporter(filename, platform, architecture, version string) *jsonReporter {
 	return &jsonReporter{
-		Platform: platform,
-		Version:  version,
+		run: results.Run{
+			SchemaVersion: results.SchemaVersion,
+			Platform:      platform,
+			Architecture:  architecture,
+			Version:       version,
+		},
+		details:  make(map[string]results.Test),
 		filename: filename,
 	}
 }
 
+func (r *jsonReporter) ReportTestDetails(name string, machines []results.Machine, metrics map[string]float64) {
+	t := results.Test{
+		Machines: append([]results.Machine(nil), machines...),
+	}
+	if len(metrics) > 0 {
+		t.Metrics = make(map[string]float64, len(metrics))
+		for k, v := range metrics {
+			t.Metrics[k] = v
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.details[name] = t
+}
+
 func (r *jsonReporter) ReportTest(name string, result testresult.TestResult, duration time.Duration, b []byte) {
-	r.Tests = append(r.Tests, jsonTest{
-		Name:     name,
-		Result:   result,
-		Duration: duration,
-		Output:   string(b),
-	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.details[name]
+	delete(r.details, name)
+	t.Name = name
+	t.Result = result
+	t.Duration = duration
+	t.Output = string(b)
+	r.run.Tests = append(r.run.Tests, t)
 }
 
+// Output writes the report to path, which is the reports directory inside
+// the output directory of the run. The files in the output directory of
+// each test are listed as its artifacts.
 func (r *jsonReporter) Output(path string) error {
-	f, err := os.Create(filepath.Join(path, r.filename))
-	if err != nil {
-		return err
+	outputDir := filepath.Dir(path)
+	for i := range r.run.Tests {
+		t := &r.run.Tests[i]
+		t.Artifacts = nil
+		testDir := filepath.Join(outputDir, t.Name)
+		_ = filepath.Walk(testDir, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(outputDir, p)
+			if err != nil {
+				return nil
+			}
+			t.Artifacts = append(t.Artifacts, results.Artifact{
+				Path: filepath.ToSlash(rel),
+				Size: info.Size(),
+			})
+			return nil
+		})
 	}
-	defer f.Close()
 
-	return json.NewEncoder(f).Encode(r)
+	return results.Write(filepath.Join(path, r.filename), &r.run)
 }
 
 func (r *jsonReporter) SetResult(result testresult.TestResult) {
-	r.Result = result
+	r.run.Result = result
 }
@@ -17,6 +17,7 @@ package reporters
 import (
 	"time"
 
+	"github.com/flatcar/mantle/harness/results"
 	"github.com/flatcar/mantle/harness/testresult"
 )
 
@@ -28,6 +29,17 @@ func (reps Reporters) ReportTest(name string, result testresult.TestResult, dura
 	}
 }
 
+// ReportTestDetails passes the machines and metrics recorded by a test to
+// the reporters implementing DetailsReporter. It is called before
+// ReportTest for the same test.
+func (reps Reporters) ReportTestDetails(name string, machines []results.Machine, metrics map[string]float64) {
+	for _, r := range reps {
+		if d, ok := r.(DetailsReporter); ok {
+			d.ReportTestDetails(name, machines, metrics)
+		}
+	}
+}
+
 func (reps Reporters) Output(path string) error {
 	for _, r := range reps {
 		err := r.Output(path)
@@ -49,3 +61,9 @@ type Reporter interface {
 	Output(string) error
 	SetResult(testresult.TestResult)
 }
+
+// DetailsReporter is implemented by reporters that include the machines
+// and metrics recorded by tests.
+type DetailsReporter interface {
+	ReportTestDetails(name string, machines []results.Machine, metrics map[string]float64)
+}
@@ -0,0 +1,129 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"sort"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+// DiffOptions control which duration changes Diff reports.
+type DiffOptions struct {
+	// SlowdownFactor is how many times longer a test has to take to be
+	// a duration regression, e.g. 1.5.
+	SlowdownFactor float64
+	// MinDuration ignores tests taking less in both runs, whose
+	// durations are mostly noise.
+	MinDuration time.Duration
+}
+
+// RunDiff is the comparison of two runs of the same tests, usually on
+// different versions.
+type RunDiff struct {
+	OldVersion string `json:"old_version"`
+	NewVersion string `json:"new_version"`
+
+	// NewlyFailing tests passed in the old run and fail in the new one.
+	NewlyFailing []TestDiff `json:"newly_failing"`
+	// NewlyPassing tests failed in the old run and pass in the new one.
+	NewlyPassing []TestDiff `json:"newly_passing"`
+	// Slower tests passed in both runs but took a lot longer in the new
+	// one.
+	Slower []TestDiff `json:"slower"`
+	// Added and Removed tests only ran in the new or the old run.
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// TestDiff is a test whose result or duration changed between two runs.
+type TestDiff struct {
+	Name        string                `json:"name"`
+	OldResult   testresult.TestResult `json:"old_result"`
+	NewResult   testresult.TestResult `json:"new_result"`
+	OldDuration time.Duration         `json:"old_duration"`
+	NewDuration time.Duration         `json:"new_duration"`
+}
+
+// Regressed returns whether tests newly fail or got slower.
+func (d *RunDiff) Regressed() bool {
+	return len(d.NewlyFailing) > 0 || len(d.Slower) > 0
+}
+
+// Diff compares the tests of the old and new run. Skipped tests are
+// neither failing nor passing.
+func Diff(old, new *Run, opts DiffOptions) *RunDiff {
+	d := &RunDiff{
+		OldVersion:   old.Version,
+		NewVersion:   new.Version,
+		NewlyFailing: []TestDiff{},
+		NewlyPassing: []TestDiff{},
+		Slower:       []TestDiff{},
+		Added:        []string{},
+		Removed:      []string{},
+	}
+
+	oldTests := make(map[string]Test)
+	for _, t := range old.Tests {
+		oldTests[t.Name] = t
+	}
+	newTests := make(map[string]bool)
+	for _, nt := range new.Tests {
+		newTests[nt.Name] = true
+		ot, ok := oldTests[nt.Name]
+		if !ok {
+			d.Added = append(d.Added, nt.Name)
+			continue
+		}
+		td := TestDiff{
+			Name:        nt.Name,
+			OldResult:   ot.Result,
+			NewResult:   nt.Result,
+			OldDuration: ot.Duration,
+			NewDuration: nt.Duration,
+		}
+		switch {
+		case ot.Result == testresult.Pass && nt.Result == testresult.Fail:
+			d.NewlyFailing = append(d.NewlyFailing, td)
+		case ot.Result == testresult.Fail && nt.Result == testresult.Pass:
+			d.NewlyPassing = append(d.NewlyPassing, td)
+		case ot.Result == testresult.Pass && nt.Result == testresult.Pass && opts.slower(ot.Duration, nt.Duration):
+			d.Slower = append(d.Slower, td)
+		}
+	}
+	for _, ot := range old.Tests {
+		if !newTests[ot.Name] {
+			d.Removed = append(d.Removed, ot.Name)
+		}
+	}
+
+	byName := func(tests []TestDiff) {
+		sort.Slice(tests, func(i, j int) bool { return tests[i].Name < tests[j].Name })
+	}
+	byName(d.NewlyFailing)
+	byName(d.NewlyPassing)
+	byName(d.Slower)
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+func (o DiffOptions) slower(old, new time.Duration) bool {
+	if o.SlowdownFactor <= 0 || (old < o.MinDuration && new < o.MinDuration) {
+		return false
+	}
+	return float64(new) > float64(old)*o.SlowdownFactor
+}
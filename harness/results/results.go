@@ -0,0 +1,136 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package results defines the versioned JSON format of the results of a
+// test run, as written to reports/report.json. Dashboards, the results
+// database and notification hooks should read runs with this package
+// instead of parsing the file with their own types.
+//
+// Fields are only added within a schema version. Removing or changing
+// the meaning of a field increases SchemaVersion, and Read rejects runs
+// of newer versions than it knows.
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+// SchemaVersion is the version of the format written by this package.
+const SchemaVersion = 1
+
+// Run is the result of a test suite on one platform and architecture.
+type Run struct {
+	// SchemaVersion is the version of the format, reports written
+	// before it was versioned have none and are read as version 1.
+	SchemaVersion int                   `json:"schema_version"`
+	Result        testresult.TestResult `json:"result"`
+	Platform      string                `json:"platform"`
+	Architecture  string                `json:"architecture"`
+	Version       string                `json:"version"`
+	Tests         []Test                `json:"tests"`
+}
+
+// Test is the result of a single test or subtest.
+type Test struct {
+	Name   string                `json:"name"`
+	Result testresult.TestResult `json:"result"`
+	// Duration is in nanoseconds.
+	Duration time.Duration `json:"duration"`
+	// Output is the log of the test.
+	Output    string             `json:"output"`
+	Machines  []Machine          `json:"machines,omitempty"`
+	Artifacts []Artifact         `json:"artifacts,omitempty"`
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Machine is a machine created by a test.
+type Machine struct {
+	ID          string `json:"id"`
+	PublicIP    string `json:"public_ip,omitempty"`
+	PrivateIP   string `json:"private_ip,omitempty"`
+	PublicIPv6  string `json:"public_ipv6,omitempty"`
+	PrivateIPv6 string `json:"private_ipv6,omitempty"`
+	// CgroupMode is the cgroup hierarchy the machine booted with, "v1"
+	// or "v2", if it was set.
+	CgroupMode string `json:"cgroup_mode,omitempty"`
+}
+
+// Artifact is a file written by a test, like the console or journal of a
+// machine.
+type Artifact struct {
+	// Path is relative to the output directory of the run and uses
+	// forward slashes.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Counts returns the number of tests per result.
+func (r *Run) Counts() map[testresult.TestResult]int {
+	counts := make(map[testresult.TestResult]int)
+	for _, t := range r.Tests {
+		counts[t.Result]++
+	}
+	return counts
+}
+
+// Parse decodes a run, see Read.
+func Parse(b []byte) (*Run, error) {
+	var r Run
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	switch {
+	case r.SchemaVersion == 0:
+		r.SchemaVersion = 1
+	case r.SchemaVersion > SchemaVersion:
+		return nil, fmt.Errorf("unsupported results schema version %d, at most %d is supported", r.SchemaVersion, SchemaVersion)
+	}
+	return &r, nil
+}
+
+// Read reads the run in the report file path. It fails for runs of newer
+// schema versions.
+func Read(path string) (*Run, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// Write writes the run to path.
+func Write(path string, r *Run) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if r.SchemaVersion == 0 {
+		r.SchemaVersion = SchemaVersion
+	}
+	if err := json.NewEncoder(f).Encode(r); err != nil {
+		return err
+	}
+	return f.Close()
+}
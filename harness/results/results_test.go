@@ -0,0 +1,112 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+func TestParseUnversioned(t *testing.T) {
+	r, err := Parse([]byte(`{"tests":[{"name":"a","result":"PASS","duration":1},{"name":"b","result":"FAIL"}],"result":"FAIL","platform":"qemu","architecture":"amd64","version":"1.2.3"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SchemaVersion != 1 {
+		t.Errorf("schema version %d, expected 1", r.SchemaVersion)
+	}
+	counts := r.Counts()
+	if counts[testresult.Pass] != 1 || counts[testresult.Fail] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestParseNewer(t *testing.T) {
+	if _, err := Parse([]byte(`{"schema_version":1000}`)); err == nil {
+		t.Error("newer schema version was accepted")
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	in := &Run{
+		Result: testresult.Pass,
+		Tests: []Test{{
+			Name:      "a",
+			Result:    testresult.Pass,
+			Machines:  []Machine{{ID: "m1", PublicIP: "10.0.0.2"}},
+			Artifacts: []Artifact{{Path: "a/m1/console.txt", Size: 3}},
+			Metrics:   map[string]float64{"boot_seconds": 4.5},
+		}},
+	}
+	if err := Write(path, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.SchemaVersion != SchemaVersion {
+		t.Errorf("schema version %d, expected %d", out.SchemaVersion, SchemaVersion)
+	}
+	if len(out.Tests) != 1 || out.Tests[0].Machines[0].ID != "m1" || out.Tests[0].Metrics["boot_seconds"] != 4.5 {
+		t.Errorf("unexpected run %+v", out)
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	old := &Run{Version: "3510.0.0", Tests: []Test{
+		{Name: "cl.basic", Result: testresult.Pass, Duration: 40 * time.Second},
+		{Name: "cl.docker", Result: testresult.Pass, Duration: 60 * time.Second},
+		{Name: "cl.etcd", Result: testresult.Fail, Duration: 30 * time.Second},
+		{Name: "cl.quick", Result: testresult.Pass, Duration: time.Second},
+		{Name: "cl.removed", Result: testresult.Pass},
+	}}
+	new := &Run{Version: "3511.0.0", Tests: []Test{
+		{Name: "cl.basic", Result: testresult.Pass, Duration: 90 * time.Second},
+		{Name: "cl.docker", Result: testresult.Fail, Duration: 20 * time.Second},
+		{Name: "cl.etcd", Result: testresult.Pass, Duration: 30 * time.Second},
+		{Name: "cl.quick", Result: testresult.Pass, Duration: 3 * time.Second},
+		{Name: "cl.added", Result: testresult.Skip},
+	}}
+
+	d := Diff(old, new, DiffOptions{SlowdownFactor: 1.5, MinDuration: 10 * time.Second})
+	names := func(tests []TestDiff) []string {
+		var n []string
+		for _, t := range tests {
+			n = append(n, t.Name)
+		}
+		return n
+	}
+	if got := names(d.NewlyFailing); !reflect.DeepEqual(got, []string{"cl.docker"}) {
+		t.Errorf("newly failing %v", got)
+	}
+	if got := names(d.NewlyPassing); !reflect.DeepEqual(got, []string{"cl.etcd"}) {
+		t.Errorf("newly passing %v", got)
+	}
+	if got := names(d.Slower); !reflect.DeepEqual(got, []string{"cl.basic"}) {
+		t.Errorf("slower %v", got)
+	}
+	if !reflect.DeepEqual(d.Added, []string{"cl.added"}) || !reflect.DeepEqual(d.Removed, []string{"cl.removed"}) {
+		t.Errorf("added %v, removed %v", d.Added, d.Removed)
+	}
+	if !d.Regressed() {
+		t.Error("regressions not reported")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 	"runtime/trace"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -75,6 +76,22 @@ type Options struct {
 	Parallel int
 
 	Reporters reporters.Reporters
+
+	// Output receives the test output, defaults to os.Stdout.
+	Output io.Writer
+
+	// Progress, if set, is notified about the state of the tests.
+	Progress Progress
+
+	// Quarantine holds glob patterns of the names of known flaky tests,
+	// see LoadQuarantine. They run, but their failures are reported as
+	// QUARANTINED and don't fail the suite.
+	Quarantine []string
+
+	// Durations holds the expected durations of tests, e.g. from
+	// earlier runs. Tests are started longest first, those without an
+	// expected duration are assumed to take the mean of the others.
+	Durations map[string]time.Duration
 }
 
 // FlagSet can be used to setup options via command line flags.
@@ -123,6 +140,9 @@ func (o *Options) init() {
 	if o.Parallel < 1 {
 		o.Parallel = runtime.GOMAXPROCS(0)
 	}
+	if o.Output == nil {
+		o.Output = os.Stdout
+	}
 }
 
 // Suite is a type passed to a TestMain function to run the actual tests.
@@ -132,6 +152,8 @@ type Suite struct {
 	tests Tests
 	match *matcher
 
+	quarantine quarantine
+
 	// mu protects the following fields which are used to manage
 	// parallel test execution.
 	mu sync.Mutex
@@ -179,6 +201,7 @@ func NewSuite(opts Options, tests Tests) *Suite {
 		opts:          opts,
 		tests:         tests,
 		match:         newMatcher(opts.Match, "Match"),
+		quarantine:    quarantine(opts.Quarantine),
 		startParallel: make(chan bool),
 	}
 }
@@ -270,22 +293,52 @@ func (s *Suite) Run() (err error) {
 		defer timer.Stop()
 	}
 
-	return s.runTests(os.Stdout, tap)
+	if s.opts.Progress != nil {
+		s.opts.Progress.Start(len(s.tests))
+		defer s.opts.Progress.Finish()
+	}
+
+	return s.runTests(s.opts.Output, tap)
+}
+
+// order returns the names of the tests in the order they are started:
+// longest expected duration first, otherwise sorted by name.
+func (s *Suite) order() []string {
+	names := s.tests.List()
+	if len(s.opts.Durations) == 0 {
+		return names
+	}
+
+	var total time.Duration
+	for _, d := range s.opts.Durations {
+		total += d
+	}
+	mean := total / time.Duration(len(s.opts.Durations))
+	expected := func(name string) time.Duration {
+		if d, ok := s.opts.Durations[name]; ok {
+			return d
+		}
+		return mean
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return expected(names[i]) > expected(names[j])
+	})
+	return names
 }
 
 func (s *Suite) runTests(out, tap io.Writer) error {
 	s.running = 1 // Set the count to 1 for the main (sequential) test.
 	t := &H{
 		signal:    make(chan bool),
-		barrier:   make(chan bool),
+		ready:     make(chan bool),
 		w:         out,
 		tap:       tap,
 		suite:     s,
 		reporters: s.opts.Reporters,
 	}
 	tRunner(t, func(t *H) {
-		for name, test := range s.tests {
-			t.Run(name, test)
+		for _, name := range s.order() {
+			t.Run(name, s.tests[name])
 		}
 		// Run catching the signal rather than the tRunner as a separate
 		// goroutine to avoid adding a goroutine during the sequential
@@ -18,6 +18,12 @@ const (
 	Fail TestResult = "FAIL"
 	Skip TestResult = "SKIP"
 	Pass TestResult = "PASS"
+	// Infra is a failure caused by the infrastructure the test ran on
+	// rather than by the code under test.
+	Infra TestResult = "INFRA"
+	// Quarantined is a failure of a test on the quarantine list of the
+	// suite, which doesn't fail the suite.
+	Quarantined TestResult = "QUARANTINED"
 )
 
 type TestResult string
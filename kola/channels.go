@@ -0,0 +1,267 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+// channelStability orders the channels from the most to the least stable.
+var channelStability = []string{"lts", "stable", "beta", "alpha", "edge"}
+
+// ChannelMatrixEntry is a channel and the image to test it with.
+type ChannelMatrixEntry struct {
+	Channel string
+	// Image overrides the image of the platform, by default the
+	// current release of the channel is used where the platform
+	// can look it up.
+	Image string
+}
+
+// ChannelSummary compares the results of the same tests on several
+// channels.
+type ChannelSummary struct {
+	Channels []string `json:"channels"`
+	// Results are the results of each test by channel.
+	Results map[string]map[string]testresult.TestResult `json:"results"`
+	// Versions are the tested versions by channel.
+	Versions    map[string]string   `json:"versions"`
+	Regressions []ChannelRegression `json:"regressions"`
+}
+
+// ChannelRegression is a test failing on a channel while passing on a more
+// stable one.
+type ChannelRegression struct {
+	Test    string `json:"test"`
+	Channel string `json:"channel"`
+	// PassingOn are the more stable channels the test passed on.
+	PassingOn []string `json:"passing_on"`
+}
+
+// setChannelImage selects the image of entry for the platform.
+func setChannelImage(pltfrm string, entry ChannelMatrixEntry) error {
+	image := entry.Image
+	switch pltfrm {
+	case "aws":
+		if image == "" {
+			image = entry.Channel
+		}
+		AWSOptions.AMI = image
+		for i := range AWSMatrix {
+			AWSMatrix[i].AMI = image
+		}
+	case "azure":
+		if image == "" {
+			image = entry.Channel
+		}
+		AzureOptions.Sku = image
+	case "do":
+		if image == "" {
+			image = entry.Channel
+		}
+		DOOptions.Image = image
+	case "gce":
+		if image == "" {
+			image = "projects/kinvolk-public/global/images/family/flatcar-" + entry.Channel
+		}
+		GCEOptions.Image = image
+	case "qemu", "qemu-unpriv":
+		if image == "" {
+			return fmt.Errorf("no image given for channel %s, local images can't be looked up", entry.Channel)
+		}
+		QEMUOptions.DiskImage = image
+	default:
+		return fmt.Errorf("channel matrix is not supported on platform %s", pltfrm)
+	}
+	return nil
+}
+
+// runChannelMatrix runs the tests for each entry of ChannelMatrix one after
+// another. The results of each channel are written to a subdirectory of
+// outputDir named after it and compared in channels.json.
+func runChannelMatrix(patterns []string, offering, pltfrm, outputDir string, sshKeys *[]agent.Key, remove bool) error {
+	runs := make(map[string]*results.Run)
+	var channels, failed []string
+	for _, entry := range ChannelMatrix {
+		if err := setChannelImage(pltfrm, entry); err != nil {
+			return err
+		}
+
+		tapFile := TAPFile
+		if tapFile != "" {
+			ext := filepath.Ext(tapFile)
+			tapFile = strings.TrimSuffix(tapFile, ext) + "-" + entry.Channel + ext
+		}
+
+		channelDir, err := harness.CleanOutputDir(filepath.Join(outputDir, entry.Channel))
+		if err != nil {
+			return err
+		}
+
+		plog.Noticef("Running tests on channel %s", entry.Channel)
+		if err := runPlatform(patterns, entry.Channel, offering, pltfrm, channelDir, tapFile, sshKeys, remove); err != nil {
+			failed = append(failed, entry.Channel)
+		}
+
+		channels = append(channels, entry.Channel)
+		run, err := readChannelRun(pltfrm, channelDir)
+		if err != nil {
+			plog.Warningf("Reading results of channel %s: %v", entry.Channel, err)
+			continue
+		}
+		runs[entry.Channel] = run
+	}
+
+	summary := NewChannelSummary(channels, runs)
+	if err := writeChannelSummary(filepath.Join(outputDir, "channels.json"), summary); err != nil {
+		return err
+	}
+	summary.Print(os.Stdout)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("tests failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// readChannelRun reads the results of the tests of a channel. The runs of
+// an AWS matrix are merged, with the architecture added to the test names.
+func readChannelRun(pltfrm, channelDir string) (*results.Run, error) {
+	if pltfrm != "aws" || len(AWSMatrix) == 0 {
+		return results.Read(filepath.Join(channelDir, "reports", "report.json"))
+	}
+
+	merged := &results.Run{Platform: pltfrm}
+	for _, entry := range AWSMatrix {
+		arch := boardToArch(entry.Board)
+		run, err := results.Read(filepath.Join(channelDir, arch, "reports", "report.json"))
+		if err != nil {
+			return nil, err
+		}
+		merged.Version = run.Version
+		for _, t := range run.Tests {
+			t.Name += " (" + arch + ")"
+			merged.Tests = append(merged.Tests, t)
+		}
+	}
+	return merged, nil
+}
+
+// NewChannelSummary compares the runs of the channels.
+func NewChannelSummary(channels []string, runs map[string]*results.Run) *ChannelSummary {
+	s := &ChannelSummary{
+		Channels:    channels,
+		Results:     make(map[string]map[string]testresult.TestResult),
+		Versions:    make(map[string]string),
+		Regressions: []ChannelRegression{},
+	}
+	for channel, run := range runs {
+		s.Versions[channel] = run.Version
+		for _, t := range run.Tests {
+			if s.Results[t.Name] == nil {
+				s.Results[t.Name] = make(map[string]testresult.TestResult)
+			}
+			s.Results[t.Name][channel] = t.Result
+		}
+	}
+
+	for _, name := range s.testNames() {
+		byChannel := s.Results[name]
+		for i, channel := range channelStability {
+			if byChannel[channel] != testresult.Fail {
+				continue
+			}
+			var passing []string
+			for _, stabler := range channelStability[:i] {
+				if byChannel[stabler] == testresult.Pass {
+					passing = append(passing, stabler)
+				}
+			}
+			if len(passing) > 0 {
+				s.Regressions = append(s.Regressions, ChannelRegression{
+					Test:      name,
+					Channel:   channel,
+					PassingOn: passing,
+				})
+			}
+		}
+	}
+	return s
+}
+
+func (s *ChannelSummary) testNames() []string {
+	var names []string
+	for name := range s.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Print writes a table of the results of each test by channel, followed
+// by the regressions.
+func (s *ChannelSummary) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Test\t%s\n", strings.Join(s.Channels, "\t"))
+	for _, name := range s.testNames() {
+		row := []string{name}
+		for _, channel := range s.Channels {
+			result, ok := s.Results[name][channel]
+			if !ok {
+				result = "-"
+			}
+			row = append(row, string(result))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+
+	if len(s.Regressions) == 0 {
+		fmt.Fprintln(w, "No regressions across channels")
+		return
+	}
+	fmt.Fprintln(w, "Regressions across channels:")
+	for _, r := range s.Regressions {
+		fmt.Fprintf(w, "  %s fails on %s, passes on %s\n", r.Test, r.Channel, strings.Join(r.PassingOn, ", "))
+	}
+}
+
+func writeChannelSummary(path string, s *ChannelSummary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	return f.Close()
+}
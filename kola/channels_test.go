@@ -0,0 +1,63 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+func TestChannelSummary(t *testing.T) {
+	run := func(version string, tests map[string]testresult.TestResult) *results.Run {
+		r := &results.Run{Version: version}
+		for name, result := range tests {
+			r.Tests = append(r.Tests, results.Test{Name: name, Result: result})
+		}
+		return r
+	}
+	runs := map[string]*results.Run{
+		"lts": run("3033.3.18", map[string]testresult.TestResult{
+			"cl.basic":  testresult.Pass,
+			"cl.docker": testresult.Pass,
+			"cl.etcd":   testresult.Fail,
+		}),
+		"stable": run("3510.2.0", map[string]testresult.TestResult{
+			"cl.basic":  testresult.Pass,
+			"cl.docker": testresult.Fail,
+			"cl.etcd":   testresult.Fail,
+		}),
+		"alpha": run("3602.0.0", map[string]testresult.TestResult{
+			"cl.basic":  testresult.Fail,
+			"cl.docker": testresult.Fail,
+			"cl.etcd":   testresult.Pass,
+		}),
+	}
+
+	s := NewChannelSummary([]string{"lts", "stable", "alpha"}, runs)
+	if s.Versions["stable"] != "3510.2.0" {
+		t.Errorf("got stable version %q", s.Versions["stable"])
+	}
+	want := []ChannelRegression{
+		{Test: "cl.basic", Channel: "alpha", PassingOn: []string{"lts", "stable"}},
+		{Test: "cl.docker", Channel: "stable", PassingOn: []string{"lts"}},
+		{Test: "cl.docker", Channel: "alpha", PassingOn: []string{"lts"}},
+	}
+	if !reflect.DeepEqual(s.Regressions, want) {
+		t.Errorf("got regressions %+v, want %+v", s.Regressions, want)
+	}
+}
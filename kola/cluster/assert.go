@@ -0,0 +1,151 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// AssertCmdOutputContains runs cmd on m and fails the test if it fails or
+// its stdout does not contain expected.
+func (t *TestCluster) AssertCmdOutputContains(m platform.Machine, cmd string, expected string) {
+	t.assertCmdOutput(m, cmd, func(stdout string) error {
+		if !strings.Contains(stdout, expected) {
+			return fmt.Errorf("stdout does not contain %q", expected)
+		}
+		return nil
+	})
+}
+
+// AssertCmdOutputMatches runs cmd on m and fails the test if it fails or
+// its stdout, with leading and trailing whitespace trimmed, does not match
+// the regular expression pattern. Use (?m) for patterns anchored to lines.
+func (t *TestCluster) AssertCmdOutputMatches(m platform.Machine, cmd string, pattern string) {
+	re := regexp.MustCompile(pattern)
+	t.assertCmdOutput(m, cmd, func(stdout string) error {
+		if !re.MatchString(stdout) {
+			return fmt.Errorf("stdout does not match %q", pattern)
+		}
+		return nil
+	})
+}
+
+// AssertCmdOutputJSONPath runs cmd on m and fails the test if it fails or
+// the value at path in its JSON output is not expected. The path consists
+// of object keys separated by dots and array indexes in brackets, e.g.
+// "Interfaces[0].Name". Strings are compared as they are, other values in
+// their compact JSON encoding, e.g. "true" or `["a","b"]`.
+func (t *TestCluster) AssertCmdOutputJSONPath(m platform.Machine, cmd string, path string, expected string) {
+	t.assertCmdOutput(m, cmd, func(stdout string) error {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+			return fmt.Errorf("parsing stdout as JSON: %v", err)
+		}
+		got, err := jsonPathValue(doc, path)
+		if err != nil {
+			return err
+		}
+		if got != expected {
+			return fmt.Errorf("%s is %s, expected %s", path, got, expected)
+		}
+		return nil
+	})
+}
+
+// assertCmdOutput runs cmd on m and fails the test with the command, its
+// exit status, stdout and stderr if it fails or check returns an error
+// for its stdout.
+func (t *TestCluster) assertCmdOutput(m platform.Machine, cmd string, check func(stdout string) error) {
+	t.Logf("+ %s", cmd)
+	stdout, stderr, err := m.SSH(cmd)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, cmdReport(m, cmd, stdout, stderr, err))
+	}
+	if err := check(string(stdout)); err != nil {
+		t.Fatalf("%s\n%s", err, cmdReport(m, cmd, stdout, stderr, nil))
+	}
+	if len(stderr) > 0 {
+		for _, line := range strings.Split(string(stderr), "\n") {
+			t.Log(line)
+		}
+	}
+}
+
+// cmdReport describes a run of cmd on m for failure messages.
+func cmdReport(m platform.Machine, cmd string, stdout, stderr []byte, err error) string {
+	status := "0"
+	if exit, ok := err.(*ssh.ExitError); ok {
+		status = strconv.Itoa(exit.ExitStatus())
+	} else if err != nil {
+		status = fmt.Sprintf("unknown (%v)", err)
+	}
+	return fmt.Sprintf("command on %s: %s\nexit status: %s\nstdout:\n%s\nstderr:\n%s", m.ID(), cmd, status, stdout, stderr)
+}
+
+// jsonPathValue returns the value at path in doc, see
+// AssertCmdOutputJSONPath.
+func jsonPathValue(doc interface{}, path string) (string, error) {
+	v := doc
+	for _, elem := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		key := elem
+		var indexes []string
+		if i := strings.Index(elem, "["); i >= 0 {
+			key = elem[:i]
+			for _, index := range strings.Split(elem[i+1:], "[") {
+				if !strings.HasSuffix(index, "]") {
+					return "", fmt.Errorf("invalid path %q", path)
+				}
+				indexes = append(indexes, strings.TrimSuffix(index, "]"))
+			}
+		}
+		if key != "" {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s: %q of a %T", path, key, v)
+			}
+			if v, ok = obj[key]; !ok {
+				return "", fmt.Errorf("%s: no key %q", path, key)
+			}
+		}
+		for _, index := range indexes {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return "", fmt.Errorf("invalid index %q in path %q", index, path)
+			}
+			arr, ok := v.([]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s: index %d of a %T", path, i, v)
+			}
+			if i < 0 || i >= len(arr) {
+				return "", fmt.Errorf("%s: index %d out of %d elements", path, i, len(arr))
+			}
+			v = arr[i]
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,45 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPathValue(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"Interfaces": [{"Name": "lo", "Up": true}, {"Name": "eth0", "Addresses": ["a", "b"], "MTU": 1500}], "matrix": [[1, 2]]}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"Interfaces[1].Name", "eth0"},
+		{".Interfaces[0].Up", "true"},
+		{"Interfaces[1].MTU", "1500"},
+		{"Interfaces[1].Addresses", `["a","b"]`},
+		{"matrix[0][1]", "2"},
+	} {
+		if got, err := jsonPathValue(doc, tt.path); err != nil || got != tt.want {
+			t.Errorf("jsonPathValue(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+	for _, path := range []string{"Interfaces[2].Name", "Interfaces.Name", "Interfaces[0].MTU", "Interfaces[x]", "Interfaces[0"} {
+		if got, err := jsonPathValue(doc, path); err == nil {
+			t.Errorf("jsonPathValue(%q) = %q, want an error", path, got)
+		}
+	}
+}
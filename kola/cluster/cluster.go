@@ -17,11 +17,16 @@ package cluster
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/kola/kolet"
 	"github.com/flatcar/mantle/platform"
 )
 
@@ -32,6 +37,13 @@ type TestCluster struct {
 	platform.Cluster
 	NativeFuncs []string
 
+	// Architecture is the machine architecture, e.g. amd64 or arm64.
+	Architecture string
+	// RunAsUser is the unprivileged user of the test, see SSHAsUser.
+	RunAsUser string
+	// AssetsURL is the base URL of the AssetsDir of the test, if any.
+	AssetsURL string
+
 	// If set to true and a sub-test fails all future sub-tests will be skipped
 	FailFast   bool
 	hasFailure bool
@@ -39,15 +51,22 @@ type TestCluster struct {
 
 // Run runs f as a subtest and reports whether f succeeded.
 func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
+	// subtests get a copy of the cluster with their own H
+	sub := func(h *harness.H) TestCluster {
+		c := *t
+		c.H = h
+		c.hasFailure = false
+		return c
+	}
 	if t.FailFast && t.hasFailure {
 		return t.H.Run(name, func(h *harness.H) {
 			func(c TestCluster) {
 				c.Skip("A previous test has already failed")
-			}(TestCluster{H: h, Cluster: t.Cluster})
+			}(sub(h))
 		})
 	}
 	t.hasFailure = !t.H.Run(name, func(h *harness.H) {
-		f(TestCluster{H: h, Cluster: t.Cluster})
+		f(sub(h))
 	})
 	return !t.hasFailure
 
@@ -80,6 +99,73 @@ func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
 	})
 }
 
+// RunExternal runs the external test binary name, copied to the machines
+// by listing it in the ExternalBinaries of the test, with kolet on m. The
+// subtests reported by the binary become subtests of a subtest named
+// after it, see package kola/kolet for the protocol.
+func (t *TestCluster) RunExternal(name string, m platform.Machine, args ...string) bool {
+	command := fmt.Sprintf("./kolet exec %q", "./"+name)
+	for _, arg := range args {
+		command += fmt.Sprintf(" %q", arg)
+	}
+	return t.Run(name, func(c TestCluster) {
+		client, err := m.SSHClient()
+		if err != nil {
+			c.Fatalf("kolet SSH client: %v", err)
+		}
+		defer client.Close()
+
+		session, err := client.NewSession()
+		if err != nil {
+			c.Fatalf("kolet SSH session: %v", err)
+		}
+		defer session.Close()
+
+		var stderr bytes.Buffer
+		session.Stderr = &stderr
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			c.Fatalf("kolet stdout: %v", err)
+		}
+		if err := session.Start(command); err != nil {
+			c.Fatalf("starting kolet: %v", err)
+		}
+		res, err := kolet.Collect(stdout)
+		// don't block kolet on output nobody reads anymore
+		io.Copy(io.Discard, stdout)
+		werr := session.Wait()
+
+		if len(res.Log) > 0 {
+			c.Logf("%s:\n%s", name, strings.Join(res.Log, "\n"))
+		}
+		for _, st := range res.Subtests {
+			st := st
+			c.Run(st.Name, func(sc TestCluster) {
+				for _, line := range st.Log {
+					sc.Log(line)
+				}
+				switch {
+				case st.Result == testresult.Fail && st.Message == "":
+					sc.Fail()
+				case st.Result == testresult.Fail:
+					sc.Error(st.Message)
+				case st.Result == testresult.Skip:
+					sc.Skip(st.Message)
+				}
+			})
+		}
+		if err != nil {
+			c.Fatalf("kolet: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if werr != nil {
+			c.Errorf("kolet: %v: %s", werr, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if res.ExitStatus != 0 {
+			c.Errorf("%s exited with status %d", name, res.ExitStatus)
+		}
+	})
+}
+
 // ListNativeFunctions returns a slice of function names that can be executed
 // directly on machines in the cluster.
 func (t *TestCluster) ListNativeFunctions() []string {
@@ -105,6 +191,21 @@ func (t *TestCluster) DropFile(localPath string) error {
 	return nil
 }
 
+// UploadProgress returns a platform.TransferProgress logging the progress
+// of uploading what to the test's output in steps of 10%.
+func (t *TestCluster) UploadProgress(what string) platform.TransferProgress {
+	var last int64 = -1
+	return func(done, total int64) {
+		if total <= 0 {
+			return
+		}
+		if step := done * 10 / total; step != last {
+			last = step
+			t.Logf("Uploading %s: %d%% of %d bytes", what, step*10, total)
+		}
+	}
+}
+
 // SSH runs a ssh command on the given machine in the cluster. It differs from
 // Machine.SSH in that stderr is written to the test's output as a 'Log' line.
 // This ensures the output will be correctly accumulated under the correct
@@ -132,12 +233,52 @@ func (t *TestCluster) MustSSH(m platform.Machine, cmd string) []byte {
 	return out
 }
 
-// AssertCmdOutputContains runs cmd via SSH and panics if stdout does not contain expected
-func (t *TestCluster) AssertCmdOutputContains(m platform.Machine, cmd string, expected string) {
-	t.Logf("+ " + cmd)
-	outputBuf := t.MustSSH(m, cmd)
-	output := string(outputBuf)
-	if !strings.Contains(output, expected) {
-		t.Fatalf("cmd %s did not output %s", cmd, expected)
+// userSSHCluster can connect to machines as other users than the default
+// one, like the clusters based on platform.BaseCluster.
+type userSSHCluster interface {
+	UserSSHClient(ip, user string) (*ssh.Client, error)
+}
+
+// SSHAsUser runs cmd on m like SSH, but logged in as the RunAsUser of the
+// test, so it runs in a login session of the user as needed for rootless
+// containers.
+func (t *TestCluster) SSHAsUser(m platform.Machine, cmd string) ([]byte, error) {
+	if t.RunAsUser == "" {
+		return nil, fmt.Errorf("the test has no RunAsUser")
+	}
+	uc, ok := t.Cluster.(userSSHCluster)
+	if !ok {
+		return nil, fmt.Errorf("connecting as another user is not supported on %T", t.Cluster)
 	}
+	client, err := uc.UserSSHClient(m.IP(), t.RunAsUser)
+	if err != nil {
+		return nil, fmt.Errorf("connecting as %s: %v", t.RunAsUser, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	err = session.Run(cmd)
+	if stderr.Len() > 0 {
+		for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+			t.Log(line)
+		}
+	}
+	return bytes.TrimSpace(stdout.Bytes()), err
+}
+
+// MustSSHAsUser runs cmd on m like MustSSH, but logged in as the RunAsUser
+// of the test.
+func (t *TestCluster) MustSSHAsUser(m platform.Machine, cmd string) []byte {
+	out, err := t.SSHAsUser(m, cmd)
+	if err != nil {
+		t.Fatalf("%q as %s failed: output %s, status %v", cmd, t.RunAsUser, out, err)
+	}
+	return out
 }
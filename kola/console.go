@@ -0,0 +1,179 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+)
+
+const (
+	// consoleWatchInterval is how often the output of running machines
+	// is checked.
+	consoleWatchInterval = 10 * time.Second
+	// consoleContextLines is the number of lines shown around a match.
+	consoleContextLines = 5
+)
+
+// consoleWatchdog checks the console patterns of a test against the
+// console and journal output of the machines of a cluster.
+type consoleWatchdog struct {
+	h *harness.H
+	c platform.Cluster
+	t *register.Test
+
+	mu       sync.Mutex
+	reported map[string]bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startConsoleWatchdog starts polling the running machines for patterns
+// which must not appear.
+func startConsoleWatchdog(h *harness.H, c platform.Cluster, t *register.Test) *consoleWatchdog {
+	w := &consoleWatchdog{
+		h:        h,
+		c:        c,
+		t:        t,
+		reported: make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if len(t.ConsoleNoMatch) == 0 {
+		close(w.done)
+		return w
+	}
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(consoleWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				for id, output := range w.liveOutput() {
+					w.checkNoMatch(id, output)
+				}
+			}
+		}
+	}()
+
+	return w
+}
+
+// Stop stops polling. It must be called before machines are destroyed.
+func (w *consoleWatchdog) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Finish checks the final output of all machines, including the ones
+// already destroyed.
+func (w *consoleWatchdog) Finish() {
+	if len(w.t.ConsoleMatch) == 0 && len(w.t.ConsoleNoMatch) == 0 {
+		return
+	}
+
+	outputs := w.liveOutput()
+	consoles := w.c.ConsoleOutput()
+	journals := w.c.JournalOutput()
+	for id, console := range consoles {
+		outputs[id] = joinOutput(console, journals[id])
+	}
+
+	for id, output := range outputs {
+		w.checkNoMatch(id, output)
+		for _, re := range w.t.ConsoleMatch {
+			if !re.Match(output) {
+				w.h.Errorf("Expected %q on machine %s console, last lines:\n%s", re, id, lastLines(output, consoleContextLines))
+			}
+		}
+	}
+}
+
+func (w *consoleWatchdog) liveOutput() map[string][]byte {
+	outputs := make(map[string][]byte)
+	for _, m := range w.c.Machines() {
+		outputs[m.ID()] = joinOutput(m.ConsoleOutput(), m.JournalOutput())
+	}
+	return outputs
+}
+
+func (w *consoleWatchdog) checkNoMatch(id string, output []byte) {
+	for _, re := range w.t.ConsoleNoMatch {
+		key := id + "\x00" + re.String()
+		w.mu.Lock()
+		reported := w.reported[key]
+		w.mu.Unlock()
+		if reported {
+			continue
+		}
+
+		loc := re.FindIndex(output)
+		if loc == nil {
+			continue
+		}
+		w.mu.Lock()
+		w.reported[key] = true
+		w.mu.Unlock()
+		w.h.Errorf("Found %q on machine %s console:\n%s", re, id, surroundingLines(output, loc, consoleContextLines))
+	}
+}
+
+func joinOutput(console, journal string) []byte {
+	return []byte(console + "\n" + journal)
+}
+
+// surroundingLines returns the lines of the match at loc with n lines of
+// context before and after.
+func surroundingLines(output []byte, loc []int, n int) string {
+	start := bytes.LastIndexByte(output[:loc[0]], '\n') + 1
+	for i := 0; i < n && start > 0; i++ {
+		start = bytes.LastIndexByte(output[:start-1], '\n') + 1
+	}
+
+	end := len(output)
+	if i := bytes.IndexByte(output[loc[1]:], '\n'); i >= 0 {
+		end = loc[1] + i
+	}
+	for i := 0; i < n && end < len(output); i++ {
+		next := bytes.IndexByte(output[end+1:], '\n')
+		if next < 0 {
+			end = len(output)
+			break
+		}
+		end += next + 1
+	}
+
+	return string(output[start:end])
+}
+
+// lastLines returns the last n non-empty lines of output.
+func lastLines(output []byte, n int) string {
+	lines := bytes.Split(bytes.TrimRight(output, "\n"), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, []byte("\n")))
+}
@@ -0,0 +1,35 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSurroundingLines(t *testing.T) {
+	output := []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven")
+	find := func(pattern string) []int {
+		return regexp.MustCompile(pattern).FindIndex(output)
+	}
+
+	assert.Equal(t, "three\nfour\nfive", surroundingLines(output, find("ou"), 1))
+	assert.Equal(t, "one\ntwo\nthree", surroundingLines(output, find("one"), 2))
+	assert.Equal(t, "five\nsix\nseven", surroundingLines(output, find("seven"), 2))
+	assert.Equal(t, "two\nthree\nfour\nfive", surroundingLines(output, find("three\nfour"), 1))
+	assert.Equal(t, "six\nseven", lastLines(append(output, '\n'), 2))
+}
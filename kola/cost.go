@@ -0,0 +1,113 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/platform"
+)
+
+// The tags kola adds to the cloud resources of the tests.
+const (
+	TagRunID = "kola-run-id"
+	TagTest  = "kola-test"
+	TagUser  = "kola-user"
+)
+
+// ResourceTags returns the tags of the cloud resources of test in flight:
+// the run ID shared by the resources of the flight, the test name and the
+// user running kola.
+func ResourceTags(flight platform.Flight, test string) map[string]string {
+	tags := map[string]string{
+		TagRunID: flight.GetBaseFlight().Namer().RunID(),
+		TagTest:  test,
+	}
+	if u, err := user.Current(); err == nil {
+		tags[TagUser] = u.Username
+	} else if name := os.Getenv("USER"); name != "" {
+		tags[TagUser] = name
+	}
+	return tags
+}
+
+// InstanceHours estimates the instance-hours of a run, as written to
+// instance-hours.json in its output directory.
+type InstanceHours struct {
+	Platform string  `json:"platform"`
+	RunID    string  `json:"run_id"`
+	Total    float64 `json:"instance_hours"`
+	// Tests maps the names of the tests to their instance-hours.
+	Tests map[string]float64 `json:"tests"`
+}
+
+// instanceHoursCounter adds up the time the machines of the tests of a run
+// were up.
+type instanceHoursCounter struct {
+	lock  sync.Mutex
+	tests map[string]float64
+}
+
+func newInstanceHoursCounter() *instanceHoursCounter {
+	return &instanceHoursCounter{tests: make(map[string]float64)}
+}
+
+// record adds the machine time of c, which must have been destroyed, to
+// the test of h and records it as a metric of the test.
+func (ic *instanceHoursCounter) record(h *harness.H, c platform.Cluster) {
+	mt, ok := c.(interface{ MachineTime() time.Duration })
+	if !ok {
+		return
+	}
+	hours := mt.MachineTime().Hours()
+	h.RecordMetric("instance_hours", hours)
+	if ic == nil {
+		return
+	}
+	ic.lock.Lock()
+	defer ic.lock.Unlock()
+	ic.tests[h.Name()] += hours
+}
+
+// summary returns the instance-hours of the tests recorded so far.
+func (ic *instanceHoursCounter) summary(pltfrm, runID string) *InstanceHours {
+	ic.lock.Lock()
+	defer ic.lock.Unlock()
+	s := &InstanceHours{
+		Platform: pltfrm,
+		RunID:    runID,
+		Tests:    make(map[string]float64, len(ic.tests)),
+	}
+	for name, hours := range ic.tests {
+		s.Tests[name] = hours
+		s.Total += hours
+	}
+	return s
+}
+
+// writeInstanceHours writes s to instance-hours.json in outputDir.
+func writeInstanceHours(outputDir string, s *InstanceHours) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "instance-hours.json"), append(b, '\n'), 0666)
+}
@@ -0,0 +1,50 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstanceHoursSummary(t *testing.T) {
+	ic := newInstanceHoursCounter()
+	ic.tests["cl.basic"] = 0.25
+	ic.tests["cl.etcd"] = 1.5
+
+	s := ic.summary("aws", "abcd1234")
+	if s.Platform != "aws" || s.RunID != "abcd1234" || s.Total != 1.75 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+
+	dir := t.TempDir()
+	if err := writeInstanceHours(dir, s); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "instance-hours.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got InstanceHours
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, s) {
+		t.Errorf("got %+v, want %+v", got, *s)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+// LoadDurations reads the reports/report.json files of earlier runs and
+// returns the mean duration of each test that ran to completion in them,
+// passing or failing, as an estimate of its next duration.
+func LoadDurations(paths []string) (map[string]time.Duration, error) {
+	var runs []*results.Run
+	for _, path := range paths {
+		r, err := results.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return meanDurations(runs), nil
+}
+
+func meanDurations(runs []*results.Run) map[string]time.Duration {
+	total := make(map[string]time.Duration)
+	count := make(map[string]int)
+	for _, r := range runs {
+		for name, d := range testDurations(r) {
+			total[name] += d
+			count[name]++
+		}
+	}
+	durations := make(map[string]time.Duration, len(total))
+	for name, d := range total {
+		durations[name] = d / time.Duration(count[name])
+	}
+	return durations
+}
+
+// testDurations returns the durations of the tests of a run that ran to
+// completion.
+func testDurations(r *results.Run) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, t := range r.Tests {
+		// subtests are part of the duration of their test
+		if strings.Contains(t.Name, "/") {
+			continue
+		}
+		switch t.Result {
+		case testresult.Pass, testresult.Fail, testresult.Quarantined:
+			durations[t.Name] = t.Duration
+		}
+	}
+	return durations
+}
+
+// durationsDBWindow is the number of runs a DurationsDB averages over,
+// older runs weigh less so estimates follow tests that got slower or
+// faster.
+const durationsDBWindow = 10
+
+// DurationsDB holds the durations of tests in earlier runs, see
+// LoadDurationsDB. It is stored as JSON in a local file or in a gs://
+// object shared by the runs of several hosts.
+type DurationsDB struct {
+	Tests map[string]*DurationsDBEntry `json:"tests"`
+}
+
+// DurationsDBEntry is the mean duration of a test over its recent runs.
+type DurationsDBEntry struct {
+	// Duration is in nanoseconds.
+	Duration time.Duration `json:"duration"`
+	Runs     int           `json:"runs"`
+}
+
+// LoadDurationsDB reads the durations database at target, a path or a
+// gs:// URL. A database that doesn't exist yet is empty.
+func LoadDurationsDB(target string) (*DurationsDB, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(target, "gs://") {
+		var u *url.URL
+		if u, err = url.Parse(target); err == nil {
+			data, err = readGCS(u)
+		}
+	} else {
+		data, err = os.ReadFile(target)
+		if os.IsNotExist(err) {
+			data, err = nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading durations database %s: %v", target, err)
+	}
+
+	db := &DurationsDB{}
+	if data != nil {
+		if err := json.Unmarshal(data, db); err != nil {
+			return nil, fmt.Errorf("parsing durations database %s: %v", target, err)
+		}
+	}
+	if db.Tests == nil {
+		db.Tests = make(map[string]*DurationsDBEntry)
+	}
+	return db, nil
+}
+
+// Save writes the database to target, a path or a gs:// URL.
+func (db *DurationsDB) Save(target string) error {
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(target, "gs://") {
+		var u *url.URL
+		if u, err = url.Parse(target); err == nil {
+			err = writeGCS(u, "application/json", data)
+		}
+	} else {
+		err = os.WriteFile(target, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("writing durations database %s: %v", target, err)
+	}
+	return nil
+}
+
+// Update adds the durations of the tests of a run to the database.
+func (db *DurationsDB) Update(r *results.Run) {
+	for name, d := range testDurations(r) {
+		e, ok := db.Tests[name]
+		if !ok {
+			e = &DurationsDBEntry{}
+			db.Tests[name] = e
+		}
+		if e.Runs < durationsDBWindow {
+			e.Runs++
+		}
+		e.Duration += (d - e.Duration) / time.Duration(e.Runs)
+	}
+}
+
+// UpdateFromOutputDir adds the durations of the tests in the reports of
+// the run in outputDir to the database.
+func (db *DurationsDB) UpdateFromOutputDir(outputDir string) error {
+	paths, err := reportPaths(outputDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		r, err := results.Read(p)
+		if err != nil {
+			return err
+		}
+		db.Update(r)
+	}
+	return nil
+}
+
+// Durations returns the estimated duration of each test in the database.
+func (db *DurationsDB) Durations() map[string]time.Duration {
+	durations := make(map[string]time.Duration, len(db.Tests))
+	for name, e := range db.Tests {
+		durations[name] = e.Duration
+	}
+	return durations
+}
+
+// shardTests splits the tests into count shards of about the same total
+// duration and returns those of shard index, counting from 0. Tests are
+// assigned longest first to the shard with the least total duration so
+// far, tests without a known duration are assumed to take the mean. The
+// split only depends on the names of the tests and the durations, so
+// every shard of a run has to use the same.
+func shardTests(tests map[string]*register.Test, durations map[string]time.Duration, index, count int) map[string]*register.Test {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	mean := time.Second
+	if len(durations) > 0 {
+		mean = total / time.Duration(len(durations))
+	}
+	expected := func(name string) time.Duration {
+		if d, ok := durations[name]; ok {
+			return d
+		}
+		return mean
+	}
+
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		return expected(names[i]) > expected(names[j])
+	})
+
+	loads := make([]time.Duration, count)
+	shard := make(map[string]*register.Test)
+	for _, name := range names {
+		min := 0
+		for i := range loads {
+			if loads[i] < loads[min] {
+				min = i
+			}
+		}
+		loads[min] += expected(name)
+		if min == index {
+			shard[name] = tests[name]
+		}
+	}
+	return shard
+}
@@ -0,0 +1,118 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func TestMeanDurations(t *testing.T) {
+	runs := []*results.Run{
+		{Tests: []results.Test{
+			{Name: "cl.basic", Result: testresult.Pass, Duration: 2 * time.Minute},
+			{Name: "cl.basic/sub", Result: testresult.Pass, Duration: time.Minute},
+			{Name: "cl.flaky", Result: testresult.Fail, Duration: 10 * time.Minute},
+			{Name: "cl.skipped", Result: testresult.Skip},
+		}},
+		{Tests: []results.Test{
+			{Name: "cl.basic", Result: testresult.Pass, Duration: 4 * time.Minute},
+			{Name: "cl.flaky", Result: testresult.Infra, Duration: time.Second},
+		}},
+	}
+	durations := meanDurations(runs)
+	expected := map[string]time.Duration{
+		"cl.basic": 3 * time.Minute,
+		"cl.flaky": 10 * time.Minute,
+	}
+	if len(durations) != len(expected) {
+		t.Errorf("got %v, expected %v", durations, expected)
+	}
+	for name, d := range expected {
+		if durations[name] != d {
+			t.Errorf("%s: got %v, expected %v", name, durations[name], d)
+		}
+	}
+}
+
+func TestDurationsDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "durations.json")
+	db, err := LoadDurationsDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < durationsDBWindow; i++ {
+		db.Update(&results.Run{Tests: []results.Test{
+			{Name: "cl.basic", Result: testresult.Pass, Duration: time.Minute},
+		}})
+	}
+	// older runs weigh less once the window is full
+	db.Update(&results.Run{Tests: []results.Test{
+		{Name: "cl.basic", Result: testresult.Pass, Duration: 11 * time.Minute},
+		{Name: "cl.skipped", Result: testresult.Skip},
+	}})
+	if err := db.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = LoadDurationsDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]time.Duration{"cl.basic": 2 * time.Minute}
+	if durations := db.Durations(); !reflect.DeepEqual(durations, expected) {
+		t.Errorf("got %v, expected %v", durations, expected)
+	}
+	if runs := db.Tests["cl.basic"].Runs; runs != durationsDBWindow {
+		t.Errorf("got %d runs, expected %d", runs, durationsDBWindow)
+	}
+}
+
+func TestShardTests(t *testing.T) {
+	tests := make(map[string]*register.Test)
+	for _, name := range []string{"a", "b", "c", "d", "e", "unknown"} {
+		tests[name] = &register.Test{Name: name}
+	}
+	durations := map[string]time.Duration{
+		"a": 8 * time.Minute,
+		"b": 7 * time.Minute,
+		"c": 6 * time.Minute,
+		"d": 5 * time.Minute,
+		"e": 4 * time.Minute,
+	}
+	// unknown takes the mean of 6 minutes and is assigned after c
+	expected := [][]string{
+		{"a", "e", "unknown"},
+		{"b", "c", "d"},
+	}
+	for i, names := range expected {
+		var got []string
+		for name := range shardTests(tests, durations, i, len(expected)) {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, names) {
+			t.Errorf("shard %d: got %v, expected %v", i, got, names)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	// hash functions used by OpenPGP keys
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// plaintextOutputs are kept unencrypted in the output directory so that
+// CI can evaluate the results.
+var plaintextOutputs = []string{"test.tap", "reports"}
+
+// encrypter encrypts src to dst.
+type encrypter struct {
+	ext     string
+	encrypt func(dst io.Writer, src io.Reader) error
+}
+
+// newEncrypter returns an encrypter for the recipient, which is either an
+// age recipient ("age1...", needs the age binary) or the path of an
+// OpenPGP public key file.
+func newEncrypter(recipient string) (*encrypter, error) {
+	if strings.HasPrefix(recipient, "age1") {
+		if _, err := exec.LookPath("age"); err != nil {
+			return nil, fmt.Errorf("encrypting to age recipient: %v", err)
+		}
+		return &encrypter{
+			ext: ".age",
+			encrypt: func(dst io.Writer, src io.Reader) error {
+				var stderr bytes.Buffer
+				cmd := exec.Command("age", "-r", recipient)
+				cmd.Stdin = src
+				cmd.Stdout = dst
+				cmd.Stderr = &stderr
+				if err := cmd.Run(); err != nil {
+					return fmt.Errorf("age: %v: %s", err, stderr.Bytes())
+				}
+				return nil
+			},
+		}, nil
+	}
+
+	key, err := os.ReadFile(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("reading OpenPGP public key: %v", err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing OpenPGP public key %s: %v", recipient, err)
+	}
+
+	return &encrypter{
+		ext: ".gpg",
+		encrypt: func(dst io.Writer, src io.Reader) error {
+			w, err := openpgp.Encrypt(dst, keyring, nil, nil, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, src); err != nil {
+				w.Close()
+				return err
+			}
+			return w.Close()
+		},
+	}, nil
+}
+
+// CheckEncryptRecipient fails early on recipients that can't be used.
+func CheckEncryptRecipient(recipient string) error {
+	_, err := newEncrypter(recipient)
+	return err
+}
+
+// EncryptOutputDir replaces the files in outputDir by copies encrypted to
+// the recipient, except the test results. User data, journals, console
+// output and other diagnostics may contain secrets of the configs used.
+func EncryptOutputDir(outputDir, recipient string) error {
+	e, err := newEncrypter(recipient)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		for _, p := range plaintextOutputs {
+			if rel == p {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		// skip directories, symlinks and sockets
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return encryptFile(e, path)
+	})
+}
+
+func encryptFile(e *encrypter, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+e.ext, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := e.encrypt(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return fmt.Errorf("encrypting %s: %v", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,109 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"crypto"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestEncryptOutputDir(t *testing.T) {
+	// like keys created by GnuPG, declare the preferred hash
+	entity, err := openpgp.NewEntity("kola", "", "kola@example.com", &packet.Config{DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NewEntity sets the preference after signing, sign again to export it
+	for _, id := range entity.Identities {
+		if err := id.SelfSignature.SignUserId(id.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmp := t.TempDir()
+	keyPath := filepath.Join(tmp, "key.asc")
+	keyFile, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(keyFile, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile.Close()
+
+	outputDir := filepath.Join(tmp, "output")
+	files := map[string]string{
+		"test.tap":                 "1..1\n",
+		"reports/report.json":      "{}",
+		"test/machine/user-data":   "secret token",
+		"test/machine/journal.txt": "journal",
+		"properties.json":          "{}",
+	}
+	for name, contents := range files {
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := EncryptOutputDir(outputDir, keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(outputDir, name)
+		if name == "test.tap" || name == "reports/report.json" {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("%s should stay in plaintext: %v", name, err)
+			}
+			continue
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists in plaintext", name)
+		}
+
+		f, err := os.Open(path + ".gpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		md, err := openpgp.ReadMessage(f, openpgp.EntityList{entity}, nil, nil)
+		if err != nil {
+			t.Fatalf("decrypting %s: %v", name, err)
+		}
+		plaintext, err := io.ReadAll(md.UnverifiedBody)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != contents {
+			t.Errorf("%s: got %q, want %q", name, plaintext, contents)
+		}
+	}
+}
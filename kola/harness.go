@@ -16,25 +16,37 @@
 package kola
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/harness/progress"
 	"github.com/flatcar/mantle/harness/reporters"
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
 	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/logsink"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/torcx"
 	"github.com/flatcar/mantle/platform"
@@ -44,8 +56,14 @@ import (
 	equinixmetalapi "github.com/flatcar/mantle/platform/api/equinixmetal"
 	esxapi "github.com/flatcar/mantle/platform/api/esx"
 	gcloudapi "github.com/flatcar/mantle/platform/api/gcloud"
+	kubevirtapi "github.com/flatcar/mantle/platform/api/kubevirt"
 	openstackapi "github.com/flatcar/mantle/platform/api/openstack"
+	pluginapi "github.com/flatcar/mantle/platform/api/plugin"
+	proxmoxapi "github.com/flatcar/mantle/platform/api/proxmox"
+	scalewayapi "github.com/flatcar/mantle/platform/api/scaleway"
+	vsphereapi "github.com/flatcar/mantle/platform/api/vsphere"
 	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/distro"
 	"github.com/flatcar/mantle/platform/machine/aws"
 	"github.com/flatcar/mantle/platform/machine/azure"
 	"github.com/flatcar/mantle/platform/machine/do"
@@ -53,9 +71,16 @@ import (
 	"github.com/flatcar/mantle/platform/machine/esx"
 	"github.com/flatcar/mantle/platform/machine/external"
 	"github.com/flatcar/mantle/platform/machine/gcloud"
+	"github.com/flatcar/mantle/platform/machine/kubevirt"
 	"github.com/flatcar/mantle/platform/machine/openstack"
+	"github.com/flatcar/mantle/platform/machine/plugin"
+	"github.com/flatcar/mantle/platform/machine/proxmox"
 	"github.com/flatcar/mantle/platform/machine/qemu"
+	"github.com/flatcar/mantle/platform/machine/scaleway"
 	"github.com/flatcar/mantle/platform/machine/unprivqemu"
+	"github.com/flatcar/mantle/platform/machine/vsphere"
+	"github.com/flatcar/mantle/platform/metrics"
+	"github.com/flatcar/mantle/platform/tracing"
 	"github.com/flatcar/mantle/system"
 )
 
@@ -69,11 +94,19 @@ var (
 	ESXOptions          = esxapi.Options{Options: &Options}          // glue to set platform options from main
 	ExternalOptions     = external.Options{Options: &Options}        // glue to set platform options from main
 	GCEOptions          = gcloudapi.Options{Options: &Options}       // glue to set platform options from main
+	KubeVirtOptions     = kubevirtapi.Options{Options: &Options}     // glue to set platform options from main
 	OpenStackOptions    = openstackapi.Options{Options: &Options}    // glue to set platform options from main
 	EquinixMetalOptions = equinixmetalapi.Options{Options: &Options} // glue to set platform options from main
+	PluginOptions       = pluginapi.Options{Options: &Options}       // glue to set platform options from main
+	ProxmoxOptions      = proxmoxapi.Options{Options: &Options}      // glue to set platform options from main
+	ScalewayOptions     = scalewayapi.Options{Options: &Options}     // glue to set platform options from main
 	QEMUOptions         = qemu.Options{Options: &Options}            // glue to set platform options from main
+	VSphereOptions      = vsphereapi.Options{Options: &Options}      // glue to set platform options from main
 
 	TestParallelism        int    //glue var to set test parallelism from main
+	NoQuotaCheck           bool   // skip checking the cloud quotas before running the tests
+	Progress               string // if not "", show the progress of the tests: "tui" or "plain"
+	Metrics                bool   // if true, count the tests in the run metrics
 	TAPFile                string // if not "", write TAP results here
 	TorcxManifestFile      string // torcx manifest to expose to tests, if set
 	DevcontainerURL        string // dev container to expose to tests, if set
@@ -87,6 +120,55 @@ var (
 	UpdatePayloadFile string
 	ForceFlatcarKey   bool
 
+	// KubernetesConformance, if set, is the regular expression selecting
+	// the Kubernetes conformance tests run by the kubeadm conformance
+	// tests, which are skipped otherwise.
+	KubernetesConformance string
+
+	// LogSinks receive the journals of the machines of the tests while
+	// they run.
+	LogSinks []logsink.Sink
+
+	// ResourceInterval, if not zero, is the interval at which the
+	// resource usage of the machines is sampled.
+	ResourceInterval time.Duration
+
+	// TestDataDir contains the DataDir of the tests. If empty, a data
+	// directory is looked up next to kola like kolet.
+	TestDataDir string
+
+	// AWSMatrix, if not empty, runs the tests on AWS once per entry, e.g.
+	// on amd64 and arm64, each in its own output subdirectory.
+	AWSMatrix []AWSMatrixEntry
+
+	// ChannelMatrix, if not empty, runs the tests once per channel, each
+	// in its own output subdirectory, and compares the results.
+	ChannelMatrix []ChannelMatrixEntry
+
+	// InfraRetries is how often tests that failed because of the
+	// infrastructure are run again, see RunTests.
+	InfraRetries int
+
+	// Quarantine holds glob patterns of known flaky tests, whose
+	// failures don't fail the run, see harness.LoadQuarantine.
+	Quarantine []string
+
+	// Durations holds the expected durations of tests, see
+	// DurationsDB. The longest tests are started first and shards are
+	// balanced with them.
+	Durations map[string]time.Duration
+
+	// Shards, if more than 1, splits the tests into that many shards of
+	// about the same duration, of which only Shard, counting from 0, is
+	// run. Each shard is meant to run on its own host.
+	Shard  int
+	Shards int
+
+	// Tags, if not empty, selects the tests with any of these tags, and
+	// the tests with any of ExcludeTags are left out.
+	Tags        []string
+	ExcludeTags []string
+
 	consoleChecks = []struct {
 		desc        string
 		match       *regexp.Regexp
@@ -157,12 +239,14 @@ var (
 			match: regexp.MustCompile("panic: (.*)"),
 		},
 		{
-			desc:  "segfault",
-			match: regexp.MustCompile("SIGSEGV|=11/SEGV"),
+			desc:     "segfault",
+			match:    regexp.MustCompile("SIGSEGV|=11/SEGV"),
+			skipFlag: &[]register.Flag{register.NoCrashCheck}[0],
 		},
 		{
-			desc:  "core dump",
-			match: regexp.MustCompile("[Cc]ore dump"),
+			desc:     "core dump",
+			match:    regexp.MustCompile("[Cc]ore dump"),
+			skipFlag: &[]register.Flag{register.NoCrashCheck}[0],
 		},
 		{
 			desc:  "ext4 filesystem corruption led to read-only mount",
@@ -233,20 +317,62 @@ func NewFlight(pltfrm string) (flight platform.Flight, err error) {
 		flight, err = external.NewFlight(&ExternalOptions)
 	case "gce":
 		flight, err = gcloud.NewFlight(&GCEOptions)
+	case "kubevirt":
+		flight, err = kubevirt.NewFlight(&KubeVirtOptions)
 	case "openstack":
 		flight, err = openstack.NewFlight(&OpenStackOptions)
 	case "equinixmetal":
 		flight, err = equinixmetal.NewFlight(&EquinixMetalOptions)
+	case "proxmox":
+		flight, err = proxmox.NewFlight(&ProxmoxOptions)
+	case "scaleway":
+		flight, err = scaleway.NewFlight(&ScalewayOptions)
 	case "qemu":
 		flight, err = qemu.NewFlight(&QEMUOptions)
 	case "qemu-unpriv":
 		flight, err = unprivqemu.NewFlight(&QEMUOptions)
+	case "vsphere":
+		flight, err = vsphere.NewFlight(&VSphereOptions)
 	default:
-		err = fmt.Errorf("invalid platform %q", pltfrm)
+		if !IsPluginPlatform(pltfrm) {
+			err = fmt.Errorf("invalid platform %q", pltfrm)
+			break
+		}
+		PluginOptions.Name = pltfrm
+		flight, err = plugin.NewFlight(&PluginOptions)
 	}
 	return
 }
 
+// IsPluginPlatform reports whether pltfrm is implemented by a plugin, either
+// the one given with --plugin-path or kola-platform-<pltfrm> in $PATH.
+func IsPluginPlatform(pltfrm string) bool {
+	if PluginOptions.Path != "" {
+		return true
+	}
+	_, err := pluginapi.Lookup(pltfrm)
+	return err == nil
+}
+
+// tagsAllowed reports whether a test with tags passes the Tags and
+// ExcludeTags filters.
+func tagsAllowed(tags []string) bool {
+	hasAny := func(filter []string) bool {
+		for _, f := range filter {
+			for _, tag := range tags {
+				if tag == f {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(Tags) > 0 && !hasAny(Tags) {
+		return false
+	}
+	return !hasAny(ExcludeTags)
+}
+
 func FilterTests(tests map[string]*register.Test, patterns []string, channel, offering string, pltfrm string, version semver.Version) (map[string]*register.Test, error) {
 	r := make(map[string]*register.Test)
 
@@ -259,13 +385,13 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 
 	for name, t := range tests {
 		// The filtering is done twice, do not evaluate until we have fetched the version from the machine.
-		if version.Major != 0 && t.SkipFunc != nil && t.SkipFunc(version, channel, architecture(pltfrm), pltfrm) {
+		if version.Major != 0 && t.SkipFunc != nil && t.SkipFunc(version, channel, architecture(), pltfrm) {
 			continue
 		}
 
 		noMatch := true
 		for _, pattern := range patterns {
-			match, err := filepath.Match(pattern, t.Name)
+			match, err := filepath.Match(testPattern(pattern), t.Name)
 			if err != nil {
 				return nil, err
 			}
@@ -279,14 +405,15 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 		}
 		patternNotName := true
 		for _, pattern := range patterns {
-			if t.Name == pattern {
+			if t.Name == testPattern(pattern) {
 				patternNotName = false
 				break
 			}
 		}
 
 		// Check the test's min and end versions when running more than one test
-		if patternNotName && versionOutsideRange(version, t.MinVersion, t.EndVersion) {
+		minVersion, endVersion := t.VersionRange(distro.Lookup(Options.Distribution).Lineage(), channel)
+		if patternNotName && versionOutsideRange(version, minVersion, endVersion) {
 			continue
 		}
 
@@ -309,6 +436,8 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 			return allowed, excluded
 		}
 
+		// tests for other architectures are skipped by runTest, so
+		// the reason shows up in the results
 		isExcluded := false
 		allowed := false
 		for _, platform := range checkPlatforms {
@@ -317,14 +446,30 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 				isExcluded = true
 				break
 			}
-			allowedArchitecture, _ := isAllowed(architecture(platform), t.Architectures, []string{})
-			allowed = allowed || (allowedPlatform && allowedArchitecture)
+			allowed = allowed || allowedPlatform
 		}
 		if isExcluded || !allowed {
 			continue
 		}
 
-		if allowed, excluded := isAllowed(Options.Distribution, t.Distros, t.ExcludeDistros); !allowed || excluded {
+		// tests gated on a distribution also run on its derivatives
+		profile := distro.Lookup(Options.Distribution)
+		isExcluded, allowed = false, false
+		for _, name := range profile.Lineage() {
+			allowedDistro, excluded := isAllowed(name, t.Distros, t.ExcludeDistros)
+			if excluded {
+				isExcluded = true
+				break
+			}
+			allowed = allowed || allowedDistro
+		}
+		if isExcluded || !allowed {
+			continue
+		}
+		// tests for all distributions assume Ignition and Flatcar, those
+		// for cloud-init distributions have to name them or have
+		// userdata for them
+		if profile.CloudInit() && len(t.Distros) == 0 && !t.HasDistroUserData(profile.Lineage()) {
 			continue
 		}
 
@@ -336,12 +481,52 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 			continue
 		}
 
+		if !tagsAllowed(t.Tags) {
+			continue
+		}
+
 		r[name] = t
 	}
 
 	return r, nil
 }
 
+// testPattern returns the part of a pattern of kola run matching the test
+// names, the part after the first slash selects subtests, e.g.
+// "systemd.sysext.*/reload".
+func testPattern(pattern string) string {
+	name, _, _ := strings.Cut(pattern, "/")
+	return name
+}
+
+// subtestPatterns returns the patterns selecting the subtests of the test
+// name, see harness.H.FilterSubtests, or nil if all its subtests run.
+func subtestPatterns(patterns []string, name string) []string {
+	var subtests []string
+	for _, pattern := range patterns {
+		glob, sub, ok := strings.Cut(pattern, "/")
+		if match, _ := filepath.Match(glob, name); !match {
+			continue
+		}
+		if !ok {
+			return nil
+		}
+		subtests = append(subtests, sub)
+	}
+	return subtests
+}
+
+// filterSubtests runs only the subtests of the test of h matching
+// subtests, if any.
+func filterSubtests(h *harness.H, subtests []string) {
+	if subtests == nil {
+		return
+	}
+	if err := h.FilterSubtests(subtests); err != nil {
+		h.Fatal(err)
+	}
+}
+
 // versionOutsideRange checks to see if version is outside [min, end). If end
 // is a zero value, it is ignored and there is no upper bound. If version is a
 // zero value, the bounds are ignored.
@@ -368,6 +553,63 @@ func versionOutsideRange(version, minVersion, endVersion semver.Version) bool {
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. If it already exists it will be erased!
 func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, sshKeys *[]agent.Key, remove bool) error {
+	if len(ChannelMatrix) > 0 {
+		return runChannelMatrix(patterns, offering, pltfrm, outputDir, sshKeys, remove)
+	}
+	return runPlatform(patterns, channel, offering, pltfrm, outputDir, TAPFile, sshKeys, remove)
+}
+
+// runPlatform runs the tests on pltfrm, once for each entry of AWSMatrix
+// if set.
+func runPlatform(patterns []string, channel, offering, pltfrm, outputDir, tapFile string, sshKeys *[]agent.Key, remove bool) error {
+	if pltfrm == "aws" && len(AWSMatrix) > 0 {
+		return runAWSMatrix(patterns, channel, offering, outputDir, tapFile, sshKeys, remove)
+	}
+	return runTests(patterns, channel, offering, pltfrm, outputDir, tapFile, sshKeys, remove)
+}
+
+// AWSMatrixEntry is a board and the AMI and instance type to test it with.
+type AWSMatrixEntry struct {
+	Board        string
+	AMI          string
+	InstanceType string
+}
+
+// runAWSMatrix runs the tests for each entry of AWSMatrix one after another.
+// The results of each architecture are written to a subdirectory of
+// outputDir named after it and to a TAP file with the architecture added
+// to its name.
+func runAWSMatrix(patterns []string, channel, offering, outputDir, tapFile string, sshKeys *[]agent.Key, remove bool) error {
+	var failed []string
+	for _, entry := range AWSMatrix {
+		arch := boardToArch(entry.Board)
+		AWSOptions.Board = entry.Board
+		AWSOptions.AMI = entry.AMI
+		AWSOptions.InstanceType = entry.InstanceType
+
+		archTAPFile := tapFile
+		if archTAPFile != "" {
+			ext := filepath.Ext(archTAPFile)
+			archTAPFile = strings.TrimSuffix(archTAPFile, ext) + "-" + arch + ext
+		}
+
+		archDir, err := harness.CleanOutputDir(filepath.Join(outputDir, arch))
+		if err != nil {
+			return err
+		}
+
+		plog.Noticef("Running tests on %s with AMI %s and instance type %s", entry.Board, entry.AMI, entry.InstanceType)
+		if err := runTests(patterns, channel, offering, "aws", archDir, archTAPFile, sshKeys, remove); err != nil {
+			failed = append(failed, arch)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("tests failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runTests(patterns []string, channel, offering, pltfrm, outputDir, tapFile string, sshKeys *[]agent.Key, remove bool) error {
 	var versionStr string
 
 	// Avoid incurring cost of starting machine in getClusterSemver when
@@ -385,27 +627,19 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 	for name, t := range tests {
 		patternNotName := true
 		for _, pattern := range patterns {
-			if name == pattern {
+			if name == testPattern(pattern) {
 				patternNotName = false
 				break
 			}
 		}
-		if patternNotName && (t.MinVersion != semver.Version{} || t.EndVersion != semver.Version{}) {
+		if patternNotName && t.HasVersionRange() {
 			skipGetVersion = false
 			break
 		}
 	}
 
-	if TorcxManifestFile != "" {
-		TorcxManifest = &torcx.Manifest{}
-		torcxManifestFile, err := os.Open(TorcxManifestFile)
-		if err != nil {
-			return errors.New("Torcx manifest path provided could not be read")
-		}
-		if err := json.NewDecoder(torcxManifestFile).Decode(TorcxManifest); err != nil {
-			return fmt.Errorf("could not parse torcx manifest as valid json: %v", err)
-		}
-		torcxManifestFile.Close()
+	if err := loadTorcxManifest(); err != nil {
+		return err
 	}
 
 	flight, err := NewFlight(pltfrm)
@@ -417,6 +651,14 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		defer flight.Destroy()
 	}
 
+	if qc, ok := flight.(platform.QuotaChecker); ok && !NoQuotaCheck {
+		machines := peakMachines(tests, TestParallelism)
+		plog.Infof("Checking quotas for %d machines...", machines)
+		if err := qc.CheckQuota(machines); err != nil {
+			return err
+		}
+	}
+
 	if !skipGetVersion {
 		plog.Info("Creating cluster to check semver...")
 
@@ -447,19 +689,46 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		}
 	}
 
+	if Shards > 1 {
+		tests = shardTests(tests, Durations, Shard, Shards)
+		plog.Noticef("Running %d tests of shard %d/%d", len(tests), Shard+1, Shards)
+	}
+
 	opts := harness.Options{
 		OutputDir: outputDir,
 		Parallel:  TestParallelism,
 		Verbose:   true,
 		Reporters: reporters.Reporters{
-			reporters.NewJSONReporter("report.json", pltfrm, versionStr),
+			reporters.NewJSONReporter("report.json", pltfrm, architecture(), versionStr),
 		},
+		Quarantine: Quarantine,
+		Durations:  Durations,
 	}
+	tracker := newResultTracker()
+	progresses := harness.Progresses{tracker}
+	if Metrics {
+		progresses = append(progresses, metrics.NewProgress())
+	}
+	if Progress != "" {
+		p, out := newProgress()
+		progresses = append(progresses, p)
+		if out != nil {
+			// route the logs and test output through the progress
+			// display so it can redraw below them
+			opts.Output = out
+			capnslog.SetFormatter(capnslog.NewStringFormatter(out))
+			defer capnslog.SetFormatter(capnslog.NewStringFormatter(os.Stderr))
+		}
+	}
+	opts.Progress = progresses
+	hours := newInstanceHoursCounter()
 	var htests harness.Tests
 	for _, test := range tests {
 		test := test // for the closure
+		subtests := subtestPatterns(patterns, test.Name)
 		run := func(h *harness.H) {
-			runTest(h, test, pltfrm, flight, remove)
+			filterSubtests(h, subtests)
+			runTest(h, test, pltfrm, flight, remove, hours)
 		}
 		htests.Add(test.Name, run)
 	}
@@ -467,9 +736,64 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 	suite := harness.NewSuite(opts, htests)
 	err = suite.Run()
 
-	if TAPFile != "" {
+	// run the tests that failed because of the infrastructure again, each
+	// time in a subdirectory of the output directory
+	retries := 0
+	for retry := 1; err == harness.SuiteFailed && retry <= InfraRetries; retry++ {
+		infra := tracker.with(testresult.Infra)
+		if len(infra) == 0 {
+			break
+		}
+		plog.Noticef("Retrying %d tests that failed because of the infrastructure: %s", len(infra), strings.Join(infra, ", "))
+		var retests harness.Tests
+		for _, name := range infra {
+			retests.Add(name, htests[name])
+		}
+		retryOpts := opts
+		retryOpts.OutputDir = filepath.Join(outputDir, infraRetryDir(retry))
+		retryOpts.Reporters = reporters.Reporters{
+			reporters.NewJSONReporter("report.json", pltfrm, architecture(), versionStr),
+		}
+		if err = harness.NewSuite(retryOpts, retests).Run(); err != nil && err != harness.SuiteFailed {
+			break
+		}
+		retries = retry
+		if len(tracker.with(testresult.Fail)) == 0 && len(tracker.with(testresult.Infra)) == 0 {
+			err = nil
+		} else {
+			err = harness.SuiteFailed
+		}
+	}
+	if failed, infra := tracker.with(testresult.Fail), tracker.with(testresult.Infra); len(infra) > 0 {
+		plog.Errorf("%d tests failed, %d of them because of the infrastructure: %s", len(failed)+len(infra), len(infra), strings.Join(infra, ", "))
+	}
+	if quarantined := tracker.with(testresult.Quarantined); len(quarantined) > 0 {
+		plog.Warningf("%d quarantined tests failed: %s", len(quarantined), strings.Join(quarantined, ", "))
+	}
+
+	summary := hours.summary(pltfrm, flight.GetBaseFlight().Namer().RunID())
+	plog.Noticef("Machines of run %s ran for %.2f instance-hours on %s", summary.RunID, summary.Total, pltfrm)
+	if err2 := writeInstanceHours(outputDir, summary); err2 != nil {
+		plog.Errorf("Writing the instance-hours: %v", err2)
+	}
+
+	if retries > 0 {
+		result := testresult.Pass
+		if err != nil {
+			result = testresult.Fail
+		}
+		// the run only passes if its TAP and report say so
+		if err2 := mergeInfraRetries(outputDir, retries, result); err2 != nil {
+			plog.Errorf("Merging the results of the infrastructure retries: %v", err2)
+			if err == nil {
+				err = err2
+			}
+		}
+	}
+
+	if tapFile != "" {
 		src := filepath.Join(outputDir, "test.tap")
-		if err2 := system.CopyRegularFile(src, TAPFile); err == nil && err2 != nil {
+		if err2 := system.CopyRegularFile(src, tapFile); err == nil && err2 != nil {
 			err = err2
 		}
 	}
@@ -483,6 +807,23 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 	return err
 }
 
+// loadTorcxManifest reads TorcxManifestFile, if set, into TorcxManifest.
+func loadTorcxManifest() error {
+	if TorcxManifestFile == "" {
+		return nil
+	}
+	TorcxManifest = &torcx.Manifest{}
+	torcxManifestFile, err := os.Open(TorcxManifestFile)
+	if err != nil {
+		return errors.New("Torcx manifest path provided could not be read")
+	}
+	defer torcxManifestFile.Close()
+	if err := json.NewDecoder(torcxManifestFile).Decode(TorcxManifest); err != nil {
+		return fmt.Errorf("could not parse torcx manifest as valid json: %v", err)
+	}
+	return nil
+}
+
 // getClusterSemVer returns the CoreOS semantic version via starting a
 // machine and checking
 func getClusterSemver(flight platform.Flight, outputDir string) (*semver.Version, error) {
@@ -508,41 +849,60 @@ func getClusterSemver(flight platform.Flight, outputDir string) (*semver.Version
 		return nil, fmt.Errorf("creating new machine for semver check: %v", err)
 	}
 
-	out, stderr, err := m.SSH("grep ^VERSION_ID= /etc/os-release")
+	out, stderr, err := m.SSH("cat /etc/os-release")
+	if err != nil {
+		return nil, fmt.Errorf("reading /etc/os-release: %v: %s", err, stderr)
+	}
+	ver, err := osReleaseVersion(string(out))
 	if err != nil {
-		return nil, fmt.Errorf("parsing /etc/os-release for VERSION_ID: %v: %s", err, stderr)
+		return nil, err
 	}
-	ver := strings.Split(string(out), "=")[1]
+	plog.Noticef("Using %q as version to filter tests...", ver)
 
-	out, stderr, err = m.SSH("grep ^BUILD_ID= /etc/os-release")
+	profile, err := distro.Get(Options.Distribution)
 	if err != nil {
-		return nil, fmt.Errorf("parsing /etc/os-release for BUILD_ID: %v: %s", err, stderr)
+		return nil, err
 	}
-	build_id := strings.Split(string(out), "=")[1]
-	if strings.HasPrefix(build_id, "dev-main-nightly-") || strings.HasPrefix(build_id, "dev-flatcar-master-") {
+	switch profile.VersionScheme {
+	case distro.VersionFlatcar:
+		return parseCLVersion(ver)
+	case distro.VersionNone:
+		return &semver.Version{}, nil
+	}
+
+	return nil, fmt.Errorf("no case to handle version parsing for distribution %q", Options.Distribution)
+}
+
+// osReleaseVersion returns the version of an image from its /etc/os-release
+// for filtering tests. Development builds are treated as the newest version
+// of their branch.
+func osReleaseVersion(osRelease string) (string, error) {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(osRelease, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[key] = strings.Trim(value, `"`)
+		}
+	}
+	ver, ok := fields["VERSION_ID"]
+	if !ok {
+		return "", fmt.Errorf("no VERSION_ID in /etc/os-release")
+	}
+
+	buildID := fields["BUILD_ID"]
+	if strings.HasPrefix(buildID, "dev-main-nightly-") || strings.HasPrefix(buildID, "dev-flatcar-master-") {
 		// "main" is a nightly build of the main branch,
 		// "flatcar-master" refers to the manifest branch where dev builds are started
 		ver = "999999.99.99"
-	} else if strings.HasPrefix(build_id, "dev-flatcar-") {
+	} else if strings.HasPrefix(buildID, "dev-flatcar-") {
 		// flatcar-MAJOR is a nightly build of the release branch
-		parts := strings.Split(build_id, "-")
+		parts := strings.Split(buildID, "-")
 		major := parts[2]
 		if major == "lts" {
 			major = parts[3]
 		}
 		ver = major + ".99.99"
 	}
-	plog.Noticef("Using %q as version to filter tests...", ver)
-
-	// TODO: add distro specific version handling
-	switch Options.Distribution {
-	case "cl":
-		return parseCLVersion(ver)
-	case "rhcos":
-		return &semver.Version{}, nil
-	}
-
-	return nil, fmt.Errorf("no case to handle version parsing for distribution %q", Options.Distribution)
+	return ver, nil
 }
 
 func parseCLVersion(input string) (*semver.Version, error) {
@@ -554,47 +914,234 @@ func parseCLVersion(input string) (*semver.Version, error) {
 	return version, nil
 }
 
-// runTest is a harness for running a single test.
-// outputDir is where various test logs and data will be written for
-// analysis after the test run. It should already exist.
-func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flight, remove bool) {
-	h.Parallel()
+// peakMachines estimates how many machines the tests need at the same
+// time when running parallel tests at once: the sum of the largest
+// cluster sizes. Tests creating their machines themselves count as one.
+func peakMachines(tests map[string]*register.Test, parallel int) int {
+	var sizes []int
+	for _, t := range tests {
+		size := t.ClusterSize
+		if size < 1 {
+			size = 1
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel < len(sizes) {
+		sizes = sizes[:parallel]
+	}
+	var machines int
+	for _, size := range sizes {
+		machines += size
+	}
+	return machines
+}
 
-	rconf := &platform.RuntimeConfig{
-		OutputDir:          h.OutputDir(),
+// RuntimeConfigFor returns the runtime config of the clusters of test t.
+func RuntimeConfigFor(t *register.Test, outputDir string) *platform.RuntimeConfig {
+	return &platform.RuntimeConfig{
+		OutputDir:          outputDir,
 		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
 		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
 		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
+		ConfigDrive:        t.HasFlag(register.ConfigDrive),
+		RequireIMDSv2:      t.HasFlag(register.RequireIMDSv2),
+		TrustedLaunch:      t.HasFlag(register.RequireTrustedLaunch),
+		ConfidentialVM:     t.HasFlag(register.RequireConfidentialVM),
+		EnableIPv6:         t.HasFlag(register.EnableIPv6),
+		GPU:                t.HasFlag(register.RequireGPU),
+		NestedVirt:         t.HasFlag(register.RequireNestedVirt),
+		CgroupMode:         t.CgroupMode,
 		SSHRetries:         Options.SSHRetries,
 		SSHTimeout:         Options.SSHTimeout,
 		DefaultUser:        t.DefaultUser,
+		RunAsUser:          t.RunAsUser,
+		ReadinessProbes:    t.ReadinessProbes,
+	}
+}
+
+// UserDataFor returns the userdata of test t for the distribution and
+// Ignition version in use.
+func UserDataFor(t *register.Test) *conf.UserData {
+	profile := distro.Lookup(Options.Distribution)
+	return t.UserDataFor(profile.Lineage(), profile.CloudInit(), Options.IgnitionVersion)
+}
+
+// newProgress returns the progress display selected by Progress, falling
+// back to plain output when stderr isn't a terminal. out is set if other
+// output must be written through the display.
+func newProgress() (p harness.Progress, out io.Writer) {
+	if Progress == "tui" && terminal.IsTerminal(int(os.Stderr.Fd())) {
+		t := progress.NewTerminal(os.Stderr)
+		return t, t
+	}
+	return progress.NewPlain(os.Stderr), nil
+}
+
+// runTest is a harness for running a single test.
+// outputDir is where various test logs and data will be written for
+// analysis after the test run. It should already exist. The machine time
+// of the test is added to hours, if not nil.
+func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flight, remove bool, hours *instanceHoursCounter) {
+	skipUnsupportedArchitecture(h, t)
+	skipUnsupportedNestedVirt(h, t, pltfrm)
+	skipUnsupportedSELinuxMode(h, t)
+	h.Parallel()
+
+	ctx, span := tracing.StartSpan(h.Context(), "test",
+		attribute.String("test", t.Name),
+		attribute.String("platform", pltfrm))
+	defer func() {
+		if h.Failed() {
+			span.SetStatus(codes.Error, "test failed")
+		}
+		span.End()
+	}()
+
+	h.Status("creating cluster")
+	rconf := RuntimeConfigFor(t, h.OutputDir())
+	rconf.TraceContext = ctx
+	rconf.Tags = ResourceTags(flight, t.Name)
+	var sinks []logsink.TestSink
+	for _, sink := range LogSinks {
+		ts := sink.Test(t.Name)
+		sinks = append(sinks, ts)
+		rconf.JournalSinks = append(rconf.JournalSinks, ts)
 	}
+	defer func() {
+		// after the machines are destroyed, which ends their journals
+		for _, ts := range sinks {
+			if err := ts.Close(); err != nil {
+				h.Logf("Shipping the journals failed: %v", err)
+			}
+		}
+	}()
 	c, err := flight.NewCluster(rconf)
 	if err != nil {
-		h.Fatalf("Cluster failed: %v", err)
+		// creating the cluster only talks to the platform
+		h.InfraFail(fmt.Sprintf("creating cluster: %v", err))
+		h.FailNow()
 	}
+	// the cause of a failure to provision the machines that points at
+	// the infrastructure, unless the consoles show the OS broke
+	var infraErr error
+	watchdog := startConsoleWatchdog(h, c, t)
+	resources := startResourceCollector(h, c, ResourceInterval)
 	defer func() {
+		h.Status("collecting logs and destroying machines")
+		_, span := tracing.StartSpan(ctx, "teardown")
+		defer span.End()
+		watchdog.Stop()
+		resources.Stop()
+		collectCrashes(h, c, t)
+		if h.Failed() {
+			checkInterruptions(h, c)
+			if Options.Kdump != "" {
+				collectKdump(h, c)
+			}
+		}
 		if remove {
 			c.Destroy()
 		}
+		hours.record(h, c)
+		watchdog.Finish()
+		broken := false
 		for id, output := range c.ConsoleOutput() {
 			for _, badness := range CheckConsole([]byte(output), t) {
 				h.Errorf("Found %s on machine %s console", badness, id)
+				broken = true
 			}
 		}
 		for id, output := range c.JournalOutput() {
 			for _, badness := range CheckConsole([]byte(output), t) {
 				h.Errorf("Found %s on machine %s journal", badness, id)
+				broken = true
 			}
 		}
+		if infraErr != nil && !broken {
+			h.InfraFail(infraErr.Error())
+		}
+	}()
+
+	tcluster := provisionCluster(ctx, h, t, c, &infraErr)
+
+	defer func() {
+		// give some time for the remote journal to be flushed so it can be read
+		// before we run the deferred machine destruction
+		time.Sleep(2 * time.Second)
+
+		for _, m := range c.Machines() {
+			h.RecordMachine(results.Machine{
+				ID:          m.ID(),
+				PublicIP:    m.IP(),
+				PrivateIP:   m.PrivateIP(),
+				PublicIPv6:  m.IPv6(),
+				PrivateIPv6: m.PrivateIPv6(),
+				CgroupMode:  m.RuntimeConf().CgroupMode,
+			})
+		}
 	}()
 
+	runBody(ctx, h, t, tcluster)
+}
+
+// runBody runs t on tc between its Setup and Teardown. Teardown runs
+// even if Setup or Run failed or panicked, as long as the machines exist.
+func runBody(ctx context.Context, h *harness.H, t *register.Test, tc cluster.TestCluster) {
+	if t.Teardown != nil {
+		defer func() {
+			// a failing Teardown would swallow the panic
+			r := recover()
+			if r != nil {
+				h.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+			h.Status("tearing down")
+			_, span := tracing.StartSpan(ctx, "test.teardown")
+			defer span.End()
+			t.Teardown(tc)
+			if r != nil {
+				panic(r)
+			}
+		}()
+	}
+	if t.Setup != nil {
+		h.Status("setting up")
+		func() {
+			_, span := tracing.StartSpan(ctx, "test.setup")
+			defer span.End()
+			t.Setup(tc)
+		}()
+	}
+
+	h.Status("running")
+	_, runSpan := tracing.StartSpan(ctx, "test.run")
+	defer runSpan.End()
+	t.Run(tc)
+}
+
+// provisionCluster starts the machines of t in c and copies kolet to them.
+// If starting the machines failed because of the infrastructure, see
+// isInfraError, the error is stored in infraErr, if not nil.
+func provisionCluster(ctx context.Context, h *harness.H, t *register.Test, c platform.Cluster, infraErr *error) cluster.TestCluster {
+	var assetsURL string
+	if t.AssetsDir != "" {
+		path, err := findDataDir(t.AssetsDir)
+		if err != nil {
+			h.Fatalf("Finding test assets failed: %v", err)
+		}
+		assetsURL, err = c.ServeAssets(path)
+		if err != nil {
+			h.Fatalf("Serving test assets failed: %v", err)
+		}
+	}
+
 	if t.ClusterSize > 0 {
-		var userdata *conf.UserData
-		if Options.IgnitionVersion == "v2" {
-			userdata = t.UserData
-		} else if Options.IgnitionVersion == "v3" {
-			userdata = t.UserDataV3
+		userdata := UserDataFor(t)
+		if userdata != nil && assetsURL != "" {
+			userdata = userdata.Subst("$assets", assetsURL)
 		}
 		if userdata != nil && userdata.Contains("$discovery") {
 			url, err := c.GetDiscoveryURL(t.ClusterSize)
@@ -608,7 +1155,17 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 			userdata = userdata.Subst("$discovery", url)
 		}
 
-		if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
+		h.Status("provisioning %d machines", t.ClusterSize)
+		_, span := tracing.StartSpan(ctx, "machines.create",
+			attribute.Int("count", t.ClusterSize))
+		_, err := platform.NewMachinesWithProgress(c, userdata, t.ClusterSize, func(up int) {
+			h.Status("provisioning machines (%d/%d up)", up, t.ClusterSize)
+		})
+		tracing.End(span, err)
+		if err != nil {
+			if infraErr != nil && isInfraError(err) {
+				*infraErr = err
+			}
 			h.Fatalf("Cluster failed starting machines: %v", err)
 		}
 	}
@@ -621,43 +1178,99 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 
 	// Cluster -> TestCluster
 	tcluster := cluster.TestCluster{
-		H:           h,
-		Cluster:     c,
-		NativeFuncs: names,
-		FailFast:    t.FailFast,
+		H:            h,
+		Cluster:      c,
+		Architecture: architecture(),
+		RunAsUser:    runAsUser(t),
+		AssetsURL:    assetsURL,
+		NativeFuncs:  names,
+		FailFast:     t.FailFast,
 	}
 
 	// drop kolet binary on machines
-	if t.NativeFuncs != nil {
-		ScpKolet(tcluster, architecture(pltfrm))
+	if t.NativeFuncs != nil || len(t.ExternalBinaries) > 0 {
+		h.Status("copying kolet")
+		ScpKolet(tcluster, architecture())
+	}
+	for _, name := range t.ExternalBinaries {
+		h.Status("copying %s", name)
+		scpKolaBinary(tcluster, name, architecture())
 	}
 
-	defer func() {
-		// give some time for the remote journal to be flushed so it can be read
-		// before we run the deferred machine destruction
-		time.Sleep(2 * time.Second)
-	}()
+	if t.DataDir != "" {
+		h.Status("uploading test data")
+		uploadDataDir(tcluster, t.DataDir)
+	}
+
+	return tcluster
+}
+
+// runAsUser returns the name of the RunAsUser of t, if any.
+func runAsUser(t *register.Test) string {
+	if t.RunAsUser == nil {
+		return ""
+	}
+	return t.RunAsUser.Name
+}
 
-	// run test
-	t.Run(tcluster)
+// skipUnsupportedArchitecture skips t if its Architectures don't include
+// the machine architecture.
+func skipUnsupportedArchitecture(h *harness.H, t *register.Test) {
+	if len(t.Architectures) == 0 {
+		return
+	}
+	arch := architecture()
+	for _, a := range t.Architectures {
+		if a == arch {
+			return
+		}
+	}
+	h.Skipf("test only supports %s, machines are %s", strings.Join(t.Architectures, ", "), arch)
+}
+
+// skipUnsupportedNestedVirt skips t if it needs nested virtualization and
+// pltfrm or the host can't provide it.
+func skipUnsupportedNestedVirt(h *harness.H, t *register.Test, pltfrm string) {
+	if !t.HasFlag(register.RequireNestedVirt) {
+		return
+	}
+	if pltfrm != "qemu" && pltfrm != "qemu-unpriv" {
+		h.Skipf("nested virtualization is only supported on QEMU, not %s", pltfrm)
+	}
+	if arch := architecture(); arch != "amd64" || runtime.GOARCH != "amd64" {
+		h.Skipf("nested virtualization is only supported for amd64 machines on amd64 hosts")
+	}
+	if _, err := platform.NestedVirtCPUFeature(); err != nil {
+		h.Skipf("nested virtualization: %v", err)
+	}
 }
 
-// architecture returns the machine architecture of the given platform.
-func architecture(pltfrm string) string {
-	nativeArch := "amd64"
-	if pltfrm == "qemu" && QEMUOptions.Board != "" {
-		nativeArch = boardToArch(QEMUOptions.Board)
+// skipUnsupportedSELinuxMode skips t if it needs another SELinux mode than
+// the one the machines boot in.
+func skipUnsupportedSELinuxMode(h *harness.H, t *register.Test) {
+	if t.SELinuxMode == "" || t.HasFlag(register.NoEnableSelinux) {
+		return
 	}
-	if pltfrm == "equinixmetal" && EquinixMetalOptions.Board != "" {
-		nativeArch = boardToArch(EquinixMetalOptions.Board)
+	if distro.Lookup(Options.Distribution).NoSELinux {
+		h.Skipf("test needs SELinux %s, %s has no SELinux", t.SELinuxMode, Options.Distribution)
 	}
-	if pltfrm == "aws" && AWSOptions.Board != "" {
-		nativeArch = boardToArch(AWSOptions.Board)
+	mode := Options.SELinuxMode
+	if mode == "" {
+		mode = platform.SELinuxEnforcing
 	}
-	if pltfrm == "azure" && AzureOptions.Board != "" {
-		nativeArch = boardToArch(AzureOptions.Board)
+	if t.SELinuxMode != mode {
+		h.Skipf("test needs SELinux %s, machines are %s", t.SELinuxMode, mode)
+	}
+}
+
+// architecture returns the machine architecture. All platforms share the
+// board of Options, the global --board or that of the current AWSMatrix
+// entry.
+func architecture() string {
+	if Options.Board == "" {
+		return "amd64"
 	}
-	return nativeArch
+	return boardToArch(Options.Board)
 }
 
 // returns the arch part of an sdk board name
@@ -682,30 +1295,70 @@ func findExecDir() string {
 
 // ScpKolet searches for a kolet binary and copies it to the machine.
 func ScpKolet(c cluster.TestCluster, mArch string) {
+	scpKolaBinary(c, "kolet", mArch)
+}
+
+// scpKolaBinary searches for a binary shipped with kola for the machine
+// architecture, like kolet, and copies it to the machines.
+func scpKolaBinary(c cluster.TestCluster, name, mArch string) {
 	for _, d := range []string{
 		".",
 		findExecDir(),
 		filepath.Join(findExecDir(), mArch),
 		filepath.Join("/usr/lib/kola", mArch),
 	} {
-		kolet := filepath.Join(d, "kolet")
-		if _, err := os.Stat(kolet); err == nil {
-			if err := c.DropFile(kolet); err != nil {
-				c.Fatalf("dropping kolet binary: %v", err)
+		path := filepath.Join(d, name)
+		if _, err := os.Stat(path); err == nil {
+			if err := c.DropFile(path); err != nil {
+				c.Fatalf("dropping %s binary: %v", name, err)
 			}
 			// The default SELinux rules do not allow init_t to execute user_home_t
-			if Options.Distribution == "rhcos" || Options.Distribution == "fcos" {
+			if distro.Lookup(Options.Distribution).SELinuxKolet {
 				for _, machine := range c.Machines() {
-					out, stderr, err := machine.SSH("sudo chcon -t bin_t kolet")
+					out, stderr, err := machine.SSH(fmt.Sprintf("sudo chcon -t bin_t %q", filepath.Base(name)))
 					if err != nil {
-						c.Fatalf("running chcon on kolet: %s: %s: %v", out, stderr, err)
+						c.Fatalf("running chcon on %s: %s: %s: %v", name, out, stderr, err)
 					}
 				}
 			}
 			return
 		}
 	}
-	c.Fatalf("Unable to locate kolet binary for %s", mArch)
+	c.Fatalf("Unable to locate %s binary for %s", name, mArch)
+}
+
+// uploadDataDir uploads the contents of the test data directory dir to
+// register.MachineDataDir on the machines.
+func uploadDataDir(c cluster.TestCluster, dir string) {
+	path, err := findDataDir(dir)
+	if err != nil {
+		c.Fatal(err)
+	}
+	for _, m := range c.Machines() {
+		if err := platform.UploadDir(m, path, register.MachineDataDir); err != nil {
+			c.Fatalf("uploading %s to %s: %v", path, m.ID(), err)
+		}
+	}
+}
+
+// findDataDir returns the path of the test data directory dir, relative to
+// TestDataDir or else to a data directory next to kola.
+func findDataDir(dir string) (string, error) {
+	bases := []string{TestDataDir}
+	if TestDataDir == "" {
+		bases = []string{
+			"data",
+			filepath.Join(findExecDir(), "data"),
+			"/usr/lib/kola/data",
+		}
+	}
+	for _, base := range bases {
+		path := filepath.Join(base, dir)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("test data directory %s not found in %s", dir, strings.Join(bases, ", "))
 }
 
 // CheckConsole checks some console output for badness and returns short
@@ -736,15 +1389,77 @@ func CheckConsole(output []byte, t *register.Test) []string {
 	return ret
 }
 
+// checkInterruptions marks the test as an infrastructure failure if the
+// platform took away one of its machines.
+func checkInterruptions(h *harness.H, c platform.Cluster) {
+	for _, m := range c.Machines() {
+		im, ok := m.(platform.InterruptibleMachine)
+		if !ok {
+			continue
+		}
+		if reason := im.Interrupted(); reason != "" {
+			h.InfraFail(reason)
+		}
+	}
+}
+
+// collectCrashes fetches the core dumps and kernel oopses of the machines
+// and fails the test for each, unless it expects crashes.
+func collectCrashes(h *harness.H, c platform.Cluster, t *register.Test) {
+	if t.HasFlag(register.NoCrashCheck) {
+		return
+	}
+	for _, m := range c.Machines() {
+		crashes, err := platform.CollectCrashes(m, filepath.Join(h.OutputDir(), m.ID()))
+		if err != nil {
+			// the machine may be down
+			plog.Warningf("collecting crashes of machine %s: %v", m.ID(), err)
+			continue
+		}
+		for _, crash := range crashes {
+			h.Errorf("Unexpected crash on machine %s: %s", m.ID(), crash)
+		}
+	}
+}
+
+// collectKdump fetches the dmesg of kernel crashes from the machines that
+// rebooted after kdump saved it. QEMU machines also look at their disks
+// when they are destroyed.
+func collectKdump(h *harness.H, c platform.Cluster) {
+	for _, m := range c.Machines() {
+		n, err := platform.CollectKdump(m, filepath.Join(h.OutputDir(), m.ID()))
+		if err != nil {
+			plog.Warningf("collecting crash dumps of machine %s: %v", m.ID(), err)
+			continue
+		}
+		if n > 0 {
+			h.Errorf("Found %d kernel crash dumps on machine %s, see its kdump directory", n, m.ID())
+		}
+	}
+}
+
+// SetupOutputDir creates the output directory of a run. Without
+// outputDir, it is created in the WorkspaceDir, after applying its
+// retention policy, and the run is recorded in a manifest there, see
+// FinishRun.
 func SetupOutputDir(outputDir, platform string) (string, error) {
 	defaulted := outputDir == ""
-	defaultBaseDirName := "_kola_temp"
+	defaultBaseDirName := WorkspaceDir
 	defaultDirName := fmt.Sprintf("%s-%s-%d", platform, time.Now().Format("2006-01-02-1504"), os.Getpid())
 
 	if defaulted {
-		if _, err := os.Stat(defaultBaseDirName); os.IsNotExist(err) {
-			if err := os.Mkdir(defaultBaseDirName, 0777); err != nil {
-				return "", err
+		unlock, err := lockWorkspace(defaultBaseDirName)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+		if WorkspaceMaxAge > 0 || WorkspaceMaxSize > 0 {
+			removed, err := pruneWorkspace(defaultBaseDirName, WorkspaceMaxAge, WorkspaceMaxSize)
+			if err != nil {
+				return "", fmt.Errorf("pruning %s: %v", defaultBaseDirName, err)
+			}
+			for _, run := range removed {
+				plog.Infof("Removed old run %s", run.Name)
 			}
 		}
 		outputDir = filepath.Join(defaultBaseDirName, defaultDirName)
@@ -773,6 +1488,9 @@ func SetupOutputDir(outputDir, platform string) (string, error) {
 			os.Remove(tempLinkPath)
 			return "", err
 		}
+		if err := startRun(defaultBaseDirName, defaultDirName, platform); err != nil {
+			return "", err
+		}
 	}
 
 	return outputDir, nil
@@ -0,0 +1,173 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func TestPeakMachines(t *testing.T) {
+	tests := map[string]*register.Test{
+		"a": {ClusterSize: 3},
+		"b": {ClusterSize: 1},
+		"c": {ClusterSize: 0},
+		"d": {ClusterSize: 2},
+	}
+	for _, tt := range []struct {
+		parallel, want int
+	}{
+		{0, 3},
+		{1, 3},
+		{2, 5},
+		{4, 7},
+		{10, 7},
+	} {
+		if got := peakMachines(tests, tt.parallel); got != tt.want {
+			t.Errorf("peakMachines with parallel %d: got %d, want %d", tt.parallel, got, tt.want)
+		}
+	}
+}
+
+func TestOSReleaseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		osRelease string
+		version   string
+	}{
+		{"NAME=\"Flatcar Container Linux by Kinvolk\"\nVERSION_ID=3510.2.0\nBUILD_ID=2023-05-10-1801", "3510.2.0"},
+		{"VERSION_ID=3602.0.0\nBUILD_ID=dev-main-nightly-1234", "999999.99.99"},
+		{"VERSION_ID=3510.2.0\nBUILD_ID=dev-flatcar-3510-nightly", "3510.99.99"},
+		{"VERSION_ID=3033.3.18\nBUILD_ID=dev-flatcar-lts-3033-nightly", "3033.99.99"},
+		{"ID=fedora\nVERSION_ID=\"38\"", "38"},
+	} {
+		version, err := osReleaseVersion(tt.osRelease)
+		if err != nil {
+			t.Errorf("%q: %v", tt.osRelease, err)
+		} else if version != tt.version {
+			t.Errorf("%q: got %q, expected %q", tt.osRelease, version, tt.version)
+		}
+	}
+	if _, err := osReleaseVersion("ID=flatcar"); err == nil {
+		t.Error("missing VERSION_ID was accepted")
+	}
+}
+
+func TestFindDataDir(t *testing.T) {
+	base := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "fixtures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(dir string) { TestDataDir = dir }(TestDataDir)
+	TestDataDir = base
+	if got, err := findDataDir("fixtures"); err != nil || got != filepath.Join(base, "fixtures") {
+		t.Errorf("got %q, %v", got, err)
+	}
+	for _, dir := range []string{"missing", "file"} {
+		if _, err := findDataDir(dir); err == nil {
+			t.Errorf("%s: expected error", dir)
+		}
+	}
+}
+
+func TestRunBodyTeardown(t *testing.T) {
+	var steps []string
+	test := &register.Test{
+		Setup: func(c cluster.TestCluster) {
+			steps = append(steps, "setup")
+		},
+		Run: func(c cluster.TestCluster) {
+			steps = append(steps, "run")
+			c.Fatal("broken")
+		},
+		Teardown: func(c cluster.TestCluster) {
+			steps = append(steps, "teardown")
+		},
+	}
+
+	var htests harness.Tests
+	htests.Add("test", func(h *harness.H) {
+		runBody(h.Context(), h, test, cluster.TestCluster{H: h})
+	})
+	suite := harness.NewSuite(harness.Options{OutputDir: filepath.Join(t.TempDir(), "out"), Parallel: 1}, htests)
+	if err := suite.Run(); err != harness.SuiteFailed {
+		t.Errorf("got %v, want the suite to fail", err)
+	}
+	if !reflect.DeepEqual(steps, []string{"setup", "run", "teardown"}) {
+		t.Errorf("got steps %v", steps)
+	}
+}
+
+func TestSubtestPatterns(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		name     string
+		want     []string
+	}{
+		{[]string{"systemd.sysext.simple/reload"}, "systemd.sysext.simple", []string{"reload"}},
+		{[]string{"systemd.sysext.*/reload/x", "systemd.*/merge"}, "systemd.sysext.simple", []string{"reload/x", "merge"}},
+		// a pattern without subtests runs them all
+		{[]string{"systemd.sysext.simple/reload", "systemd.*"}, "systemd.sysext.simple", nil},
+		{[]string{"cl.basic/reload"}, "systemd.sysext.simple", nil},
+	} {
+		if got := subtestPatterns(tt.patterns, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("subtestPatterns(%q, %q) = %q, want %q", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+	if got := testPattern("systemd.sysext.*/reload/x"); got != "systemd.sysext.*" {
+		t.Errorf("testPattern = %q", got)
+	}
+}
+
+func TestTagsAllowed(t *testing.T) {
+	defer func(tags, exclude []string) { Tags, ExcludeTags = tags, exclude }(Tags, ExcludeTags)
+	for _, tt := range []struct {
+		tags, exclude, test []string
+		want                bool
+	}{
+		{nil, nil, nil, true},
+		{[]string{"network"}, nil, nil, false},
+		{[]string{"network", "slow"}, nil, []string{"slow"}, true},
+		{nil, []string{"slow"}, []string{"network", "slow"}, false},
+		{[]string{"network"}, []string{"slow"}, []string{"network"}, true},
+	} {
+		Tags, ExcludeTags = tt.tags, tt.exclude
+		if got := tagsAllowed(tt.test); got != tt.want {
+			t.Errorf("tags %q, exclude %q: tagsAllowed(%q) = %v, want %v", tt.tags, tt.exclude, tt.test, got, tt.want)
+		}
+	}
+}
+
+func TestArchitecture(t *testing.T) {
+	defer func(board string) { Options.Board = board }(Options.Board)
+	// the global --board as set by main, shared by all platforms
+	QEMUOptions.Board = "arm64-usr"
+	if got := architecture(); got != "arm64" {
+		t.Errorf("architecture() = %q, want arm64", got)
+	}
+	Options.Board = ""
+	if got := architecture(); got != "amd64" {
+		t.Errorf("architecture without a board = %q, want amd64", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/platform"
+)
+
+// isInfraError reports whether an error starting the machines of a test
+// was caused by the infrastructure, which the platforms report with
+// platform.InfraError: e.g. cloud API errors, exhausted quotas or machines
+// that never became reachable. All other errors, like an API rejecting
+// the user data of the test, point at the test or the OS.
+func isInfraError(err error) bool {
+	return platform.IsInfraError(err)
+}
+
+// resultTracker implements harness.Progress to keep the last result of
+// each test, across the runs retrying infrastructure failures.
+type resultTracker struct {
+	mu      sync.Mutex
+	results map[string]testresult.TestResult
+}
+
+func newResultTracker() *resultTracker {
+	return &resultTracker{results: make(map[string]testresult.TestResult)}
+}
+
+func (r *resultTracker) Start(tests int)                {}
+func (r *resultTracker) TestStarted(name string)        {}
+func (r *resultTracker) TestQueued(name string)         {}
+func (r *resultTracker) TestStatus(name, status string) {}
+func (r *resultTracker) Finish()                        {}
+
+func (r *resultTracker) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[name] = result
+}
+
+// with returns the sorted names of the tests whose last result is result.
+func (r *resultTracker) with(result testresult.TestResult) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for name, res := range r.results {
+		if res == result {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// infraRetryDir is the subdirectory of the output directory with the
+// output of the retry of infrastructure failures.
+func infraRetryDir(retry int) string {
+	return fmt.Sprintf("infra-retry-%d", retry)
+}
+
+// mergeInfraRetries replaces the results of the tests run again in the
+// first retries infraRetryDirs of outputDir by their last ones in test.tap
+// and reports/report.json of outputDir, so they show the final results of
+// the run, result.
+func mergeInfraRetries(outputDir string, retries int, result testresult.TestResult) error {
+	tapPath := filepath.Join(outputDir, "test.tap")
+	tap, err := readTAP(tapPath)
+	if err != nil {
+		return err
+	}
+	reportPath := filepath.Join(outputDir, "reports", "report.json")
+	report, err := results.Read(reportPath)
+	if err != nil {
+		return err
+	}
+
+	for retry := 1; retry <= retries; retry++ {
+		dir := infraRetryDir(retry)
+		retryTAP, err := readTAP(filepath.Join(outputDir, dir, "test.tap"))
+		if err != nil {
+			return err
+		}
+		for _, name := range retryTAP.names {
+			tap.set(name, retryTAP.entries[name])
+		}
+		retryReport, err := results.Read(filepath.Join(outputDir, dir, "reports", "report.json"))
+		if err != nil {
+			return err
+		}
+		mergeReport(report, retryReport, dir)
+	}
+	report.Result = result
+
+	if err := os.WriteFile(tapPath, tap.bytes(), 0644); err != nil {
+		return err
+	}
+	return results.Write(reportPath, report)
+}
+
+// tapResults are the entries of a TAP file written by the harness, one per
+// test, in their order.
+type tapResults struct {
+	names   []string
+	entries map[string]string
+}
+
+// readTAP reads the TAP file at path.
+func readTAP(path string) (*tapResults, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &tapResults{entries: make(map[string]string)}
+	var name string
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "ok - "), strings.HasPrefix(line, "not ok - "):
+			name = strings.TrimSuffix(strings.SplitN(line, " - ", 2)[1], "\n")
+			// directives like "# SKIP" follow the name
+			name = strings.SplitN(name, " # ", 2)[0]
+			t.set(name, line)
+		case name != "":
+			// the YAML block with the error of a failed test
+			t.entries[name] += line
+		}
+	}
+	return t, nil
+}
+
+// set replaces the entry of the test name, or adds it at the end.
+func (t *tapResults) set(name, entry string) {
+	if _, ok := t.entries[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.entries[name] = entry
+}
+
+func (t *tapResults) bytes() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "1..%d\n", len(t.names))
+	for _, name := range t.names {
+		b.WriteString(t.entries[name])
+	}
+	return []byte(b.String())
+}
+
+// mergeReport replaces the tests of run, including their subtests, by
+// those of retry, whose artifacts are in dir of the output directory.
+func mergeReport(run, retry *results.Run, dir string) {
+	retried := make(map[string]bool)
+	for _, t := range retry.Tests {
+		retried[strings.SplitN(t.Name, "/", 2)[0]] = true
+	}
+	var tests []results.Test
+	for _, t := range run.Tests {
+		if !retried[strings.SplitN(t.Name, "/", 2)[0]] {
+			tests = append(tests, t)
+		}
+	}
+	for _, t := range retry.Tests {
+		for i := range t.Artifacts {
+			t.Artifacts[i].Path = path.Join(dir, t.Artifacts[i].Path)
+		}
+		tests = append(tests, t)
+	}
+	run.Tests = tests
+}
@@ -0,0 +1,92 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/platform"
+)
+
+func TestIsInfraError(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		err   error
+		infra bool
+	}{
+		{"API error", &platform.InfraError{Err: errors.New("InsufficientInstanceCapacity")}, true},
+		{"rejected request", errors.New("InvalidParameterValue: User data is limited to 16384 bytes"), false},
+		{"config", &platform.ConfigError{Err: errors.New("bad butane")}, false},
+		{"basic checks", &platform.BootError{Machine: "m", Err: errors.New("degraded")}, false},
+		{"unreachable", &platform.BootError{Machine: "m", Err: fmt.Errorf("failed to start: %w", &platform.InfraError{Err: errors.New("i/o timeout")})}, true},
+	} {
+		if got := isInfraError(tt.err); got != tt.infra {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.infra)
+		}
+	}
+}
+
+func writeRun(t *testing.T, dir, tap string, tests ...results.Test) {
+	if err := os.MkdirAll(filepath.Join(dir, "reports"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "test.tap"), []byte(tap), 0666); err != nil {
+		t.Fatal(err)
+	}
+	run := &results.Run{Result: testresult.Fail, Tests: tests}
+	if err := results.Write(filepath.Join(dir, "reports", "report.json"), run); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeInfraRetries(t *testing.T) {
+	dir := t.TempDir()
+	writeRun(t, dir, "1..3\nok - cl.a\nnot ok - cl.b\n  ---\n  Error: \"quota\"\n  ...\nok - cl.c # SKIP\n",
+		results.Test{Name: "cl.a", Result: testresult.Pass},
+		results.Test{Name: "cl.b", Result: testresult.Infra},
+		results.Test{Name: "cl.b/sub", Result: testresult.Infra},
+		results.Test{Name: "cl.c", Result: testresult.Skip})
+	writeRun(t, filepath.Join(dir, infraRetryDir(1)), "1..1\nok - cl.b\n",
+		results.Test{Name: "cl.b", Result: testresult.Pass, Artifacts: []results.Artifact{{Path: "cl.b/console.txt"}}})
+
+	if err := mergeInfraRetries(dir, 1, testresult.Pass); err != nil {
+		t.Fatal(err)
+	}
+
+	tap, err := os.ReadFile(filepath.Join(dir, "test.tap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1..3\nok - cl.a\nok - cl.b\nok - cl.c # SKIP\n"; string(tap) != want {
+		t.Errorf("got TAP %q, want %q", tap, want)
+	}
+
+	run, err := results.Read(filepath.Join(dir, "reports", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Result != testresult.Pass || len(run.Tests) != 3 {
+		t.Fatalf("unexpected report %+v", run)
+	}
+	if b := run.Tests[2]; b.Name != "cl.b" || b.Result != testresult.Pass || b.Artifacts[0].Path != "infra-retry-1/cl.b/console.txt" {
+		t.Errorf("unexpected retried test %+v", b)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kolet implements the protocol external test binaries use to
+// report their results to kola through kolet.
+//
+// An external test binary can be written in any language. kolet runs it
+// on the machine with KOLET_PROTOCOL set to the protocol version and the
+// binary writes one JSON object per line to stdout for each event:
+//
+//	{"type": "start", "test": "mounts"}
+//	{"type": "log", "test": "mounts", "message": "/ is mounted read-write"}
+//	{"type": "result", "test": "mounts", "result": "FAIL", "message": "/usr is writable"}
+//
+// Other output is passed along as log of the binary. kolet prefixes the
+// events with a version event and ends them with an exit event carrying
+// the exit status of the binary, so kola knows the binary ran to
+// completion.
+package kolet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+const (
+	// ProtocolVersion is the version of the protocol spoken by kolet.
+	// Version 1 is running native functions with plain output.
+	ProtocolVersion = 2
+
+	// ProtocolEnv is the environment variable kolet sets to
+	// ProtocolVersion when running an external test binary.
+	ProtocolEnv = "KOLET_PROTOCOL"
+)
+
+// The types of events.
+const (
+	// EventVersion is sent by kolet first, with the protocol version.
+	EventVersion = "version"
+	// EventStart starts the subtest Test.
+	EventStart = "start"
+	// EventLog is output of the subtest Test, or of the binary if Test
+	// is empty.
+	EventLog = "log"
+	// EventResult ends the subtest Test with Result, Message being the
+	// reason for a failure or skip.
+	EventResult = "result"
+	// EventExit is sent by kolet last, with the exit status of the
+	// binary.
+	EventExit = "exit"
+)
+
+// Event is a line of the output of kolet exec.
+type Event struct {
+	Type    string                `json:"type"`
+	Test    string                `json:"test,omitempty"`
+	Message string                `json:"message,omitempty"`
+	Result  testresult.TestResult `json:"result,omitempty"`
+	Version int                   `json:"version,omitempty"`
+	Status  int                   `json:"status,omitempty"`
+}
+
+// parseEvent parses a line written by an external test binary, reporting
+// whether it is an event the binary may send.
+func parseEvent(line []byte) (Event, bool) {
+	var e Event
+	if err := json.Unmarshal(line, &e); err != nil {
+		return e, false
+	}
+	switch e.Type {
+	case EventStart:
+		return e, e.Test != ""
+	case EventLog:
+		return e, true
+	case EventResult:
+		if e.Test == "" {
+			return e, false
+		}
+		switch e.Result {
+		case testresult.Pass, testresult.Fail, testresult.Skip:
+			return e, true
+		}
+	}
+	return e, false
+}
+
+// Exec runs the external test binary cmd and writes the events of the
+// protocol to w. Lines on stdout which are not events and all lines on
+// stderr are turned into log events of the binary. An error is only
+// returned if the binary could not be run, its exit status is reported
+// in the exit event.
+func Exec(cmd *exec.Cmd, w io.Writer) error {
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", ProtocolEnv, ProtocolVersion))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	var lock sync.Mutex
+	enc := json.NewEncoder(w)
+	send := func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		// there is nobody to report a broken connection to kola to
+		_ = enc.Encode(e)
+	}
+
+	send(Event{Type: EventVersion, Version: ProtocolVersion})
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			if e, ok := parseEvent(sc.Bytes()); ok {
+				send(e)
+			} else {
+				send(Event{Type: EventLog, Message: sc.Text()})
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			send(Event{Type: EventLog, Message: sc.Text()})
+		}
+	}()
+	// the pipes must be drained before waiting, which closes them
+	wg.Wait()
+
+	status := 0
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+		status = exitErr.ExitCode()
+	}
+	send(Event{Type: EventExit, Status: status})
+	return nil
+}
+
+// Subtest is a subtest reported by an external test binary.
+type Subtest struct {
+	Name    string
+	Result  testresult.TestResult
+	Message string
+	Log     []string
+}
+
+// Results are the results reported by an external test binary.
+type Results struct {
+	// Subtests in the order they were started.
+	Subtests []*Subtest
+	// Log is the output not belonging to a subtest.
+	Log []string
+	// ExitStatus is the exit status of the binary.
+	ExitStatus int
+}
+
+// Collect reads the events written by kolet exec from r until the exit
+// event. Subtests which did not report a result are failed.
+func Collect(r io.Reader) (*Results, error) {
+	var res Results
+	subtests := make(map[string]*Subtest)
+	subtest := func(name string) *Subtest {
+		st, ok := subtests[name]
+		if !ok {
+			st = &Subtest{Name: name}
+			subtests[name] = st
+			res.Subtests = append(res.Subtests, st)
+		}
+		return st
+	}
+
+	dec := json.NewDecoder(r)
+	versioned := false
+	for {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				err = errors.New("kolet exited before the test binary")
+			}
+			return &res, fmt.Errorf("reading kolet events: %v", err)
+		}
+		if !versioned {
+			if e.Type != EventVersion || e.Version != ProtocolVersion {
+				return &res, fmt.Errorf("kolet does not speak protocol version %d", ProtocolVersion)
+			}
+			versioned = true
+			continue
+		}
+
+		switch e.Type {
+		case EventStart:
+			subtest(e.Test)
+		case EventLog:
+			if e.Test == "" {
+				res.Log = append(res.Log, e.Message)
+			} else {
+				st := subtest(e.Test)
+				st.Log = append(st.Log, e.Message)
+			}
+		case EventResult:
+			st := subtest(e.Test)
+			st.Result = e.Result
+			st.Message = e.Message
+		case EventExit:
+			res.ExitStatus = e.Status
+			for _, st := range res.Subtests {
+				if st.Result == "" {
+					st.Result = testresult.Fail
+					st.Message = "no result reported"
+				}
+			}
+			return &res, nil
+		default:
+			return &res, fmt.Errorf("unknown kolet event %q", e.Type)
+		}
+	}
+}
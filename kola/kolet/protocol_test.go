@@ -0,0 +1,81 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kolet
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+func TestExecCollect(t *testing.T) {
+	script := `
+test "$KOLET_PROTOCOL" = 2 || exit 3
+echo '{"type": "start", "test": "a"}'
+echo '{"type": "log", "test": "a", "message": "checking a"}'
+echo '{"type": "result", "test": "a", "result": "PASS"}'
+echo '{"type": "result", "test": "b", "result": "FAIL", "message": "b is broken"}'
+echo '{"type": "result", "test": "c", "result": "SKIP", "message": "no c"}'
+echo '{"type": "start", "test": "d"}'
+echo '{"type": "exit", "status": 0}'
+echo not json
+exit 1
+`
+	var out bytes.Buffer
+	if err := Exec(exec.Command("sh", "-c", script), &out); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Collect(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Results{
+		Subtests: []*Subtest{
+			{Name: "a", Result: testresult.Pass, Log: []string{"checking a"}},
+			{Name: "b", Result: testresult.Fail, Message: "b is broken"},
+			{Name: "c", Result: testresult.Skip, Message: "no c"},
+			{Name: "d", Result: testresult.Fail, Message: "no result reported"},
+		},
+		// events only kolet may send are passed along as output
+		Log:        []string{`{"type": "exit", "status": 0}`, "not json"},
+		ExitStatus: 1,
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("got %+v, expected %+v", res, expected)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		events string
+	}{
+		{"no version", `{"type": "exit"}`},
+		{"wrong version", `{"type": "version", "version": 1}`},
+		{"no exit", `{"type": "version", "version": 2}
+{"type": "start", "test": "a"}`},
+		{"unknown event", `{"type": "version", "version": 2}
+{"type": "progress"}`},
+	} {
+		if _, err := Collect(strings.NewReader(tt.events)); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
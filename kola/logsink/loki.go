@@ -0,0 +1,189 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/network/journal"
+)
+
+const (
+	// how often the entries of a test are pushed to Loki
+	lokiPushInterval = 5 * time.Second
+	// entries are pushed early once that many are buffered
+	lokiBatchSize = 1000
+)
+
+// Loki ships the journals to a Grafana Loki server. Each machine is a
+// stream labeled with job="kola", the test and the machine ID.
+type Loki struct {
+	pushURL string
+	client  *http.Client
+}
+
+// NewLoki returns the sink of the Loki server at url, e.g.
+// http://loki:3100.
+func NewLoki(url string) *Loki {
+	return &Loki{
+		pushURL: strings.TrimSuffix(url, "/") + "/loki/api/v1/push",
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Test implements Sink.
+func (l *Loki) Test(name string) TestSink {
+	t := &lokiTest{
+		loki:    l,
+		test:    name,
+		streams: make(map[string][][2]string),
+		push:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+type lokiTest struct {
+	loki *Loki
+	test string
+
+	lock sync.Mutex
+	// buffered entries by machine, as Loki timestamp and line pairs
+	streams map[string][][2]string
+	count   int
+
+	push chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (t *lokiTest) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(lokiPushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		case <-t.push:
+		}
+		if err := t.flush(); err != nil {
+			plog.Errorf("Pushing the journals of %s to Loki: %v", t.test, err)
+		}
+	}
+}
+
+// Machine implements platform.JournalSink.
+func (t *lokiTest) Machine(id string) (journal.Formatter, error) {
+	return &lokiFormatter{t: t, machine: id}, nil
+}
+
+func (t *lokiTest) add(machine string, ts time.Time, line string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.streams[machine] = append(t.streams[machine], [2]string{fmt.Sprint(ts.UnixNano()), line})
+	t.count++
+	if t.count >= lokiBatchSize {
+		select {
+		case t.push <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush pushes the buffered entries.
+func (t *lokiTest) flush() error {
+	t.lock.Lock()
+	streams := t.streams
+	t.streams = make(map[string][][2]string)
+	t.count = 0
+	t.lock.Unlock()
+	if len(streams) == 0 {
+		return nil
+	}
+
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var req struct {
+		Streams []stream `json:"streams"`
+	}
+	for machine, values := range streams {
+		req.Streams = append(req.Streams, stream{
+			Stream: map[string]string{"job": "kola", "test": t.test, "machine": machine},
+			Values: values,
+		})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.loki.client.Post(t.loki.pushURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Close implements TestSink.
+func (t *lokiTest) Close() error {
+	close(t.stop)
+	<-t.done
+	return t.flush()
+}
+
+// lokiFormatter turns the journal entries of a machine into Loki lines.
+type lokiFormatter struct {
+	t       *lokiTest
+	machine string
+}
+
+// SetTimezone is a no-op, Loki timestamps are in UTC.
+func (f *lokiFormatter) SetTimezone(tz *time.Location) {}
+
+func (f *lokiFormatter) WriteEntry(entry journal.Entry) error {
+	ts := entry.Realtime()
+	message, ok := entry[journal.FIELD_MESSAGE]
+	if ts.IsZero() || !ok {
+		return nil
+	}
+	identifier := "unknown"
+	if id, ok := entry[journal.FIELD_SYSLOG_IDENTIFIER]; ok {
+		identifier = string(id)
+	}
+	line := identifier
+	if pid, ok := entry[journal.FIELD_PID]; ok {
+		line += "[" + string(pid) + "]"
+	}
+	f.t.add(f.machine, ts, line+": "+string(message))
+	return nil
+}
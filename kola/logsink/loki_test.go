@@ -0,0 +1,97 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/flatcar/mantle/network/journal"
+)
+
+func TestLoki(t *testing.T) {
+	type stream struct {
+		Stream map[string]string
+		Values [][2]string
+	}
+	var lock sync.Mutex
+	var pushed []stream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct{ Streams []stream }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		pushed = append(pushed, req.Streams...)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := New(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := sink.Test("cl.test")
+	f, err := ts.Machine("m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []journal.Entry{
+		{
+			journal.FIELD_REALTIME_TIMESTAMP: []byte("1700000000000001"),
+			journal.FIELD_SYSLOG_IDENTIFIER:  []byte("systemd"),
+			journal.FIELD_PID:                []byte("1"),
+			journal.FIELD_MESSAGE:            []byte("Started kola.service."),
+		},
+		// incomplete entries are skipped
+		{journal.FIELD_MESSAGE: []byte("no timestamp")},
+	} {
+		if err := f.WriteEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []stream{{
+		Stream: map[string]string{"job": "kola", "test": "cl.test", "machine": "m1"},
+		Values: [][2]string{{"1700000000000001000", "systemd[1]: Started kola.service."}},
+	}}
+	if !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("got %+v, expected %+v", pushed, expected)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"ftp://logs", "loki:3100"} {
+		if _, err := New(u); err == nil {
+			t.Errorf("%s: expected error", u)
+		}
+	}
+	if _, err := New("https://loki.example.com"); err != nil {
+		t.Error(err)
+	}
+}
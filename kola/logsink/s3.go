@@ -0,0 +1,102 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsink
+
+import (
+	"bytes"
+	"path"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/coreos/pkg/multierror"
+
+	"github.com/flatcar/mantle/network/journal"
+)
+
+// S3 uploads the journal of each machine to an S3 bucket once the test
+// finished, as <prefix>/<test>/<machine>/journal.txt.
+type S3 struct {
+	bucket   string
+	prefix   string
+	uploader *s3manager.Uploader
+}
+
+// NewS3 returns the sink of the given bucket and key prefix. The
+// credentials are read like by the AWS CLI, region overrides the
+// configured one if not empty.
+func NewS3(bucket, prefix, region string) (*S3, error) {
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{
+		bucket:   bucket,
+		prefix:   path.Clean("/" + prefix)[1:],
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+// Test implements Sink.
+func (s *S3) Test(name string) TestSink {
+	return &s3Test{s3: s, test: name, journals: make(map[string]*bytes.Buffer)}
+}
+
+type s3Test struct {
+	s3   *S3
+	test string
+
+	lock     sync.Mutex
+	journals map[string]*bytes.Buffer
+}
+
+// Machine implements platform.JournalSink.
+func (t *s3Test) Machine(id string) (journal.Formatter, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	buf, ok := t.journals[id]
+	if !ok {
+		buf = &bytes.Buffer{}
+		t.journals[id] = buf
+	}
+	return journal.ShortWriter(buf), nil
+}
+
+// Close implements TestSink.
+func (t *s3Test) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var errs multierror.Error
+	for id, buf := range t.journals {
+		key := path.Join(t.s3.prefix, t.test, id, "journal.txt")
+		if _, err := t.s3.uploader.Upload(&s3manager.UploadInput{
+			Bucket:      aws.String(t.s3.bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(buf.Bytes()),
+			ContentType: aws.String("text/plain"),
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.AsError()
+}
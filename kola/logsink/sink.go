@@ -0,0 +1,63 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logsink ships the journals of the machines of kola tests to log
+// stores while the tests run, in addition to the journal.txt files in the
+// output directory.
+package logsink
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "kola/logsink")
+
+// Sink is a log store the journals of tests are shipped to.
+type Sink interface {
+	// Test returns the sink of the journals of the machines of the
+	// test with the given name.
+	Test(name string) TestSink
+}
+
+// TestSink receives the journals of the machines of a test.
+type TestSink interface {
+	platform.JournalSink
+
+	// Close ships the remaining entries, it is called once the
+	// machines of the test are destroyed.
+	Close() error
+}
+
+// New returns the sink of the log store at rawURL: a Loki server, e.g.
+// http://loki:3100, or an S3 bucket and key prefix, e.g.
+// s3://bucket/kola/run-1.
+func New(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log sink %q: %v", rawURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewLoki(u.String()), nil
+	case "s3":
+		return NewS3(u.Host, u.Path, u.Query().Get("region"))
+	default:
+		return nil, fmt.Errorf("unsupported log sink %q, expected a Loki http(s) URL or an s3 URL", rawURL)
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"google.golang.org/api/googleapi"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/harness/testresult"
+	"github.com/flatcar/mantle/storage"
+)
+
+// Marker is published after a successful run so that release automation
+// can poll for the latest version that passed the tests.
+type Marker struct {
+	Version      string                        `json:"version"`
+	Platform     string                        `json:"platform"`
+	Channel      string                        `json:"channel"`
+	Board        string                        `json:"board"`
+	Time         time.Time                     `json:"time"`
+	ManifestHash string                        `json:"manifest_sha256"`
+	Results      map[testresult.TestResult]int `json:"results"`
+	Reports      []MarkerReport                `json:"reports"`
+}
+
+// MarkerReport summarizes one report.json of the run.
+type MarkerReport struct {
+	Path         string                        `json:"path"`
+	Architecture string                        `json:"architecture"`
+	Results      map[testresult.TestResult]int `json:"results"`
+}
+
+// CheckMarkerTarget fails early on marker targets or signing keys that
+// can't be used.
+func CheckMarkerTarget(target, keyFile string) error {
+	if _, err := markerURL(target); err != nil {
+		return err
+	}
+	_, err := readSigningKey(keyFile)
+	return err
+}
+
+// NewMarker builds the marker for the run in outputDir from its
+// properties.json and test reports. All reports must have passed.
+func NewMarker(outputDir, pltfrm, channel, board string) (*Marker, error) {
+	props, err := os.ReadFile(filepath.Join(outputDir, "properties.json"))
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(props)
+
+	paths, err := reportPaths(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no test reports in %s", outputDir)
+	}
+
+	m := &Marker{
+		Platform:     pltfrm,
+		Channel:      channel,
+		Board:        board,
+		Time:         time.Now().UTC(),
+		ManifestHash: hex.EncodeToString(hash[:]),
+		Results:      make(map[testresult.TestResult]int),
+	}
+	for _, p := range paths {
+		r, err := results.Read(p)
+		if err != nil {
+			return nil, err
+		}
+		if r.Result != testresult.Pass {
+			return nil, fmt.Errorf("%s: run result is %s", p, r.Result)
+		}
+		if r.Version == "" {
+			return nil, fmt.Errorf("%s: OS version unknown", p)
+		}
+		if m.Version == "" {
+			m.Version = r.Version
+		} else if m.Version != r.Version {
+			return nil, fmt.Errorf("%s: version %s differs from %s", p, r.Version, m.Version)
+		}
+
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return nil, err
+		}
+		mr := MarkerReport{
+			Path:         filepath.ToSlash(rel),
+			Architecture: r.Architecture,
+			Results:      r.Counts(),
+		}
+		for res, n := range mr.Results {
+			m.Results[res] += n
+		}
+		m.Reports = append(m.Reports, mr)
+	}
+	return m, nil
+}
+
+// PublishMarker signs the marker with the OpenPGP private key in keyFile
+// and uploads it to target, a gs:// or http(s):// URL. The armored
+// detached signature is uploaded next to it with an added .asc suffix.
+func PublishMarker(m *Marker, target, keyFile string) error {
+	u, err := markerURL(target)
+	if err != nil {
+		return err
+	}
+	signer, err := readSigningKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(data), nil); err != nil {
+		return fmt.Errorf("signing marker: %v", err)
+	}
+
+	// upload the signature first, pollers look for the marker
+	if u.Scheme == "gs" {
+		return publishGCS(u, data, sig.Bytes())
+	}
+	sigURL := *u
+	sigURL.Path += ".asc"
+	if err := httpPut(sigURL.String(), "application/pgp-signature", sig.Bytes()); err != nil {
+		return err
+	}
+	return httpPut(u.String(), "application/json", data)
+}
+
+// reportPaths returns the paths of the reports/report.json files of the
+// run in outputDir.
+func reportPaths(outputDir string) ([]string, error) {
+	// runs of several architectures keep their reports in subdirectories
+	paths, err := filepath.Glob(filepath.Join(outputDir, "reports", "report.json"))
+	if err != nil {
+		return nil, err
+	}
+	archPaths, err := filepath.Glob(filepath.Join(outputDir, "*", "reports", "report.json"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, archPaths...)
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func markerURL(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parsing marker URL: %v", err)
+	}
+	switch u.Scheme {
+	case "gs", "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported marker URL %q: must be gs://, http:// or https://", target)
+	}
+	if u.Host == "" || u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, fmt.Errorf("marker URL %q must name an object", target)
+	}
+	return u, nil
+}
+
+func readSigningKey(keyFile string) (*openpgp.Entity, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("publishing a marker needs an OpenPGP signing key")
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading OpenPGP signing key: %v", err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing OpenPGP signing key %s: %v", keyFile, err)
+	}
+	for _, e := range keyring {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("OpenPGP signing key %s is passphrase protected", keyFile)
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("%s contains no OpenPGP private key", keyFile)
+}
+
+// googleStorageClient returns a client for Google Cloud Storage, using
+// the GCE JSON key file if one was given.
+func googleStorageClient() (*http.Client, error) {
+	if GCEOptions.JSONKeyFile != "" {
+		b, err := os.ReadFile(GCEOptions.JSONKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return auth.GoogleClientFromJSONKey(b)
+	}
+	return auth.GoogleClient()
+}
+
+func publishGCS(u *url.URL, data, sig []byte) error {
+	asc := *u
+	asc.Path += ".asc"
+	if err := writeGCS(&asc, "application/pgp-signature", sig); err != nil {
+		return err
+	}
+	return writeGCS(u, "application/json", data)
+}
+
+// readGCS downloads the gs:// object u, it returns nil if the object
+// doesn't exist.
+func readGCS(u *url.URL) ([]byte, error) {
+	client, err := googleStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	service, err := gs.New(client)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := service.Objects.Get(u.Host, strings.TrimPrefix(u.Path, "/")).Download()
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// writeGCS uploads data to the gs:// object u, replacing it.
+func writeGCS(u *url.URL, contentType string, data []byte) error {
+	client, err := googleStorageClient()
+	if err != nil {
+		return err
+	}
+
+	dir, name := path.Split(u.Path)
+	bucket, err := storage.NewBucket(client, "gs://"+u.Host+dir)
+	if err != nil {
+		return err
+	}
+	bucket.WriteAlways(true)
+
+	o := &gs.Object{
+		Name:         bucket.Prefix() + name,
+		ContentType:  contentType,
+		CacheControl: "no-cache",
+	}
+	return bucket.Upload(context.Background(), o, bytes.NewReader(data))
+}
+
+func httpPut(target, contentType string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT %s: %s: %s", target, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
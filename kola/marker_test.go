@@ -0,0 +1,117 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+func TestPublishMarker(t *testing.T) {
+	entity, err := openpgp.NewEntity("kola", "", "kola@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	keyPath := filepath.Join(tmp, "key.asc")
+	keyFile, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(keyFile, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile.Close()
+
+	outputDir := filepath.Join(tmp, "output")
+	files := map[string]string{
+		"properties.json":           "{}",
+		"amd64/reports/report.json": `{"result":"PASS","architecture":"amd64","version":"3510.2.0","tests":[{"result":"PASS"},{"result":"SKIP"}]}`,
+		"arm64/reports/report.json": `{"result":"PASS","architecture":"arm64","version":"3510.2.0","tests":[{"result":"PASS"}]}`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewMarker(outputDir, "aws", "stable", "amd64-usr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "3510.2.0" || len(m.Reports) != 2 || m.Results[testresult.Pass] != 2 || m.Results[testresult.Skip] != 1 {
+		t.Fatalf("unexpected marker %+v", m)
+	}
+
+	var mu sync.Mutex
+	uploads := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploads[r.URL.Path] = b
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	if err := CheckMarkerTarget(srv.URL+"/stable/latest.json", keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishMarker(m, srv.URL+"/stable/latest.json", keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data, sig := uploads["/stable/latest.json"], uploads["/stable/latest.json.asc"]
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(data), bytes.NewReader(sig)); err != nil {
+		t.Fatalf("verifying marker signature: %v", err)
+	}
+	var published Marker
+	if err := json.Unmarshal(data, &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.ManifestHash != m.ManifestHash {
+		t.Fatalf("published marker %+v differs", published)
+	}
+
+	// failed runs don't get a marker
+	failed := filepath.Join(outputDir, "arm64/reports/report.json")
+	if err := os.WriteFile(failed, []byte(`{"result":"FAIL","version":"3510.2.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMarker(outputDir, "aws", "stable", "amd64-usr"); err == nil {
+		t.Fatal("expected error for failed run")
+	}
+}
@@ -17,10 +17,12 @@ package register
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/coreos/go-semver/semver"
 
 	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -33,8 +35,41 @@ const (
 	NoEnableSelinux                     // don't enable selinux when starting or rebooting a machine
 	NoKernelPanicCheck                  // don't check console output for kernel panic
 	NoVerityCorruptionCheck             // don't check console output for verity corruption
+	ConfigDrive                         // pass userdata on a config drive on platforms supporting it
+	RequireIMDSv2                       // require session tokens for the instance metadata service on AWS
+	RequireTrustedLaunch                // launch instances with vTPM and Secure Boot (Azure Trusted Launch, GCE Shielded VM)
+	RequireConfidentialVM               // launch Confidential VM instances (Azure SEV-SNP, GCE SEV)
+	EnableIPv6                          // enable IPv6 networking on the machines, see conf.Conf.EnableIPv6
+	RequireGPU                          // launch instances with an NVIDIA GPU (AWS g4dn/g5g, GCE A2, Azure NC)
+	RequireNestedVirt                   // let the QEMU machines run KVM guests, skip the test if the host can't
+	NoCrashCheck                        // don't fail the test for core dumps, segfaults and kernel oopses
 )
 
+var flagNames = [...]string{
+	NoSSHKeyInUserData:      "NoSSHKeyInUserData",
+	NoSSHKeyInMetadata:      "NoSSHKeyInMetadata",
+	NoEmergencyShellCheck:   "NoEmergencyShellCheck",
+	NoEnableSelinux:         "NoEnableSelinux",
+	NoKernelPanicCheck:      "NoKernelPanicCheck",
+	NoVerityCorruptionCheck: "NoVerityCorruptionCheck",
+	ConfigDrive:             "ConfigDrive",
+	RequireIMDSv2:           "RequireIMDSv2",
+	RequireTrustedLaunch:    "RequireTrustedLaunch",
+	RequireConfidentialVM:   "RequireConfidentialVM",
+	EnableIPv6:              "EnableIPv6",
+	RequireGPU:              "RequireGPU",
+	RequireNestedVirt:       "RequireNestedVirt",
+	NoCrashCheck:            "NoCrashCheck",
+}
+
+// String returns the name of the flag constant, e.g. "ConfigDrive".
+func (f Flag) String() string {
+	if f >= 0 && int(f) < len(flagNames) && flagNames[f] != "" {
+		return flagNames[f]
+	}
+	return fmt.Sprintf("Flag(%d)", int(f))
+}
+
 // Test provides the main test abstraction for kola. The run function is
 // the actual testing function while the other fields provide ways to
 // statically declare state of the platform.TestCluster before the test
@@ -56,6 +91,30 @@ type Test struct {
 	ExcludeOfferings []string // blacklist of offerings to ignore -- defaults to none
 	Architectures    []string // whitelist of machine architectures supported -- defaults to all
 	Flags            []Flag   // special-case options for this test
+	Tags             []string // free-form labels, e.g. "network" or "slow", listed by kola list
+
+	// DistroUserData maps distributions to the userdata of the test
+	// on them, e.g. a Butane config for fcos or a cloud-config for
+	// debian, overriding UserData and UserDataV3. See UserDataFor.
+	DistroUserData map[string]*conf.UserData
+
+	// SELinuxMode is the SELinux mode the test needs, "enforcing" or
+	// "permissive". It is skipped in runs booting the machines in the
+	// other mode, see --selinux-mode, and on distributions without
+	// SELinux. Runs without --selinux-mode count as enforcing.
+	SELinuxMode string
+
+	// CgroupMode boots the machines of the test with the cgroup v1 or
+	// v2 hierarchy, "v1" or "v2", overriding --cgroup-mode.
+	CgroupMode string
+
+	// Setup and Teardown, if set, run before and after Run on the
+	// provisioned cluster. Teardown runs once Setup started, even if
+	// Setup or Run failed, timed out with a fatal error or panicked, so
+	// cleanup, e.g. of resources outside the cluster, belongs there
+	// rather than at the end of Run.
+	Setup    func(cluster.TestCluster)
+	Teardown func(cluster.TestCluster)
 
 	// FailFast skips any sub-test that occurs after a sub-test has
 	// failed.
@@ -71,14 +130,72 @@ type Test struct {
 	// the name fully matches without globbing.
 	EndVersion semver.Version
 
+	// VersionRanges override MinVersion and EndVersion on some
+	// distributions or channels, see VersionRange. Like those they
+	// are ignored if the name fully matches without globbing.
+	VersionRanges []VersionRange
+
 	// SkipFunc can be used to define if a test should be skip or not based on some
 	// condition on the version, channel, arch and platform.
 	SkipFunc func(version semver.Version, channel, arch, platform string) bool
 
 	// DefaultUser is the user used for SSH connection, it will be created via Ignition when possible.
 	DefaultUser string
+
+	// ExternalBinaries are test binaries copied with kolet to the home
+	// directory of the machines, for TestCluster.RunExternal. They are
+	// looked up in the same directories as kolet, so they must be built
+	// for the architecture of the machines.
+	ExternalBinaries []string
+
+	// DataDir is a directory of fixtures, e.g. configs, container images
+	// or scripts, whose contents are uploaded to MachineDataDir on all
+	// machines of the cluster before Run. It is relative to the test
+	// data directory of kola, see kola.TestDataDir.
+	DataDir string
+
+	// AssetsDir is a directory of assets, e.g. Ignition configs, files
+	// or sysext images, served over HTTP to the machines, see
+	// platform.Cluster.ServeAssets. Its base URL replaces "$assets" in
+	// the userdata and is TestCluster.AssetsURL. It is relative to the
+	// test data directory of kola like DataDir.
+	AssetsDir string
+
+	// RunAsUser is an unprivileged user created on the machines, e.g.
+	// for rootless containers or polkit, whom the test runs commands as
+	// with TestCluster.SSHAsUser. It requires an Ignition v3 config.
+	RunAsUser *conf.User
+
+	// ConsoleMatch are patterns which must appear on the console or in
+	// the journal of every machine by the end of the test.
+	ConsoleMatch []*regexp.Regexp
+
+	// ConsoleNoMatch are patterns which must not appear on the console
+	// or in the journal of any machine. They are checked continuously
+	// while the test runs.
+	ConsoleNoMatch []*regexp.Regexp
+
+	// ReadinessProbes must succeed on every machine before it is
+	// handed to the test, e.g. platform.UnitActiveProbe for a service
+	// the test uses right away, see platform.ReadinessProbe.
+	ReadinessProbes []platform.ReadinessProbe
 }
 
+// VersionRange restricts a test to the versions in [MinVersion,
+// EndVersion) of a distribution or channel, e.g. to run a test on cl from
+// 3185 on but on any fcos version.
+type VersionRange struct {
+	Distro  string // distribution the range applies to, any if empty
+	Channel string // channel the range applies to, any if empty
+
+	MinVersion semver.Version
+	EndVersion semver.Version // no upper bound if zero
+}
+
+// MachineDataDir is where the contents of the DataDir of a test are
+// uploaded to on the machines.
+const MachineDataDir = "/var/lib/kola/data"
+
 // Registered tests live here. Mapping of names to tests.
 var Tests = map[string]*Test{}
 
@@ -91,13 +208,88 @@ func Register(t *Test) {
 		panic(fmt.Sprintf("test %v already registered", t.Name))
 	}
 
-	if (t.EndVersion != semver.Version{}) && !t.MinVersion.LessThan(t.EndVersion) {
+	if !validVersionRange(t.MinVersion, t.EndVersion) {
 		panic(fmt.Sprintf("test %v has an invalid version range", t.Name))
 	}
+	for _, r := range t.VersionRanges {
+		if !validVersionRange(r.MinVersion, r.EndVersion) {
+			panic(fmt.Sprintf("test %v has an invalid version range for distro %q and channel %q", t.Name, r.Distro, r.Channel))
+		}
+	}
 
 	Tests[t.Name] = t
 }
 
+func validVersionRange(minVersion, endVersion semver.Version) bool {
+	return endVersion == semver.Version{} || minVersion.LessThan(endVersion)
+}
+
+// VersionRange returns the versions the test runs on for a distribution,
+// given with the distributions it derives from as lineage, and a channel.
+// The most specific of VersionRanges is used: one for the distribution and
+// channel, for the distribution, or for the channel, with the own
+// distribution preferred over its parents. Otherwise MinVersion and
+// EndVersion apply.
+func (t *Test) VersionRange(lineage []string, channel string) (minVersion, endVersion semver.Version) {
+	for _, distro := range lineage {
+		for _, c := range []string{channel, ""} {
+			for _, r := range t.VersionRanges {
+				if r.Distro == distro && r.Channel == c {
+					return r.MinVersion, r.EndVersion
+				}
+			}
+		}
+	}
+	for _, r := range t.VersionRanges {
+		if r.Distro == "" && r.Channel == channel {
+			return r.MinVersion, r.EndVersion
+		}
+	}
+	return t.MinVersion, t.EndVersion
+}
+
+// HasVersionRange returns whether the test only runs on some versions.
+func (t *Test) HasVersionRange() bool {
+	return t.MinVersion != semver.Version{} || t.EndVersion != semver.Version{} || len(t.VersionRanges) > 0
+}
+
+// UserDataFor returns the userdata of the test for a distribution, given
+// with the distributions it derives from as lineage. The entry of
+// DistroUserData for the distribution, or else for its closest parent, is
+// preferred. Otherwise cloud-init distributions get UserData, which may
+// be a cloud-config or script, and the others UserData or UserDataV3 for
+// the Ignition version, "v2" or "v3".
+func (t *Test) UserDataFor(lineage []string, cloudInit bool, ignitionVersion string) *conf.UserData {
+	if u := t.distroUserData(lineage); u != nil {
+		return u
+	}
+	if cloudInit {
+		return t.UserData
+	}
+	switch ignitionVersion {
+	case "v2":
+		return t.UserData
+	case "v3":
+		return t.UserDataV3
+	}
+	return nil
+}
+
+// HasDistroUserData returns whether DistroUserData has userdata for a
+// distribution, given with its lineage like for UserDataFor.
+func (t *Test) HasDistroUserData(lineage []string) bool {
+	return t.distroUserData(lineage) != nil
+}
+
+func (t *Test) distroUserData(lineage []string) *conf.UserData {
+	for _, distro := range lineage {
+		if u := t.DistroUserData[distro]; u != nil {
+			return u
+		}
+	}
+	return nil
+}
+
 func (t *Test) HasFlag(flag Flag) bool {
 	for _, f := range t.Flags {
 		if f == flag {
@@ -0,0 +1,110 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+func TestVersionRange(t *testing.T) {
+	test := &Test{
+		MinVersion: semver.Version{Major: 3000},
+		VersionRanges: []VersionRange{
+			{Distro: "cl", MinVersion: semver.Version{Major: 3185}},
+			{Distro: "cl", Channel: "lts", MinVersion: semver.Version{Major: 3033}, EndVersion: semver.Version{Major: 3034}},
+			{Distro: "fcos"},
+			{Channel: "alpha", MinVersion: semver.Version{Major: 3600}},
+		},
+	}
+	assert.True(t, test.HasVersionRange())
+
+	for _, tt := range []struct {
+		lineage  []string
+		channel  string
+		min, end semver.Version
+	}{
+		{[]string{"cl"}, "stable", semver.Version{Major: 3185}, semver.Version{}},
+		{[]string{"cl"}, "lts", semver.Version{Major: 3033}, semver.Version{Major: 3034}},
+		// derivatives use the ranges of their parents
+		{[]string{"derivative", "cl"}, "lts", semver.Version{Major: 3033}, semver.Version{Major: 3034}},
+		{[]string{"fcos"}, "alpha", semver.Version{}, semver.Version{}},
+		{[]string{"rhcos"}, "alpha", semver.Version{Major: 3600}, semver.Version{}},
+		{[]string{"rhcos"}, "stable", semver.Version{Major: 3000}, semver.Version{}},
+	} {
+		min, end := test.VersionRange(tt.lineage, tt.channel)
+		assert.Equal(t, tt.min, min, "%v %s", tt.lineage, tt.channel)
+		assert.Equal(t, tt.end, end, "%v %s", tt.lineage, tt.channel)
+	}
+
+	assert.False(t, (&Test{}).HasVersionRange())
+	assert.Panics(t, func() {
+		Register(&Test{
+			Name: "test.invalid-range",
+			VersionRanges: []VersionRange{
+				{Distro: "cl", MinVersion: semver.Version{Major: 2}, EndVersion: semver.Version{Major: 1}},
+			},
+		})
+	})
+}
+
+func TestUserDataFor(t *testing.T) {
+	v2 := conf.Ignition(`{"ignition": {"version": "2.0.0"}}`)
+	v3 := conf.Ignition(`{"ignition": {"version": "3.0.0"}}`)
+	butane := conf.Butane("variant: fcos\nversion: 1.4.0")
+	cloudConfig := conf.CloudConfig("#cloud-config")
+	test := &Test{
+		UserData:   v2,
+		UserDataV3: v3,
+		DistroUserData: map[string]*conf.UserData{
+			"fcos":   butane,
+			"debian": cloudConfig,
+		},
+	}
+
+	for _, tt := range []struct {
+		lineage         []string
+		cloudInit       bool
+		ignitionVersion string
+		want            *conf.UserData
+	}{
+		{[]string{"cl"}, false, "v2", v2},
+		{[]string{"cl"}, false, "v3", v3},
+		{[]string{"fcos"}, false, "v3", butane},
+		// derivatives use the userdata of their parents
+		{[]string{"derivative", "fcos"}, false, "v3", butane},
+		{[]string{"debian"}, true, "", cloudConfig},
+		{[]string{"ubuntu"}, true, "", v2},
+		{[]string{"rhcos"}, false, "v9", nil},
+	} {
+		assert.Same(t, tt.want, test.UserDataFor(tt.lineage, tt.cloudInit, tt.ignitionVersion), "%v", tt.lineage)
+	}
+
+	assert.True(t, test.HasDistroUserData([]string{"derivative", "fcos"}))
+	assert.False(t, test.HasDistroUserData([]string{"cl"}))
+}
+
+func TestFlagString(t *testing.T) {
+	assert.Equal(t, "NoSSHKeyInUserData", NoSSHKeyInUserData.String())
+	assert.Equal(t, "NoCrashCheck", NoCrashCheck.String())
+	assert.Equal(t, "Flag(-1)", Flag(-1).String())
+	for f := NoSSHKeyInUserData; f <= NoCrashCheck; f++ {
+		assert.NotContains(t, f.String(), "Flag(", "flag %d has no name", int(f))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"fmt"
+
+	"github.com/flatcar/mantle/kola/cluster"
+)
+
+// OEMVariant is the per-platform overlay of a test registered with
+// RegisterOEMVariants.
+type OEMVariant struct {
+	// Platform the variant runs on, also appended to the test name.
+	Platform string
+	// Metadata are the keys expected in /run/metadata/coreos.
+	Metadata []string
+}
+
+// RegisterOEMVariants registers one test per variant, named after the
+// base test with the platform of the variant appended. The test runs
+// on the platforms of its variant only and run is handed the variant.
+func RegisterOEMVariants(t *Test, run func(cluster.TestCluster, OEMVariant), variants ...OEMVariant) {
+	if len(t.Platforms) != 0 {
+		panic(fmt.Sprintf("test %v: platforms are set by the OEM variants", t.Name))
+	}
+
+	for _, v := range variants {
+		v := v
+		vt := *t
+		vt.Name = fmt.Sprintf("%s.%s", t.Name, v.Platform)
+		vt.Platforms = []string{v.Platform}
+		vt.Run = func(c cluster.TestCluster) {
+			run(c, v)
+		}
+		Register(&vt)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flatcar/mantle/kola/cluster"
+)
+
+func TestRegisterOEMVariants(t *testing.T) {
+	var ran []string
+	RegisterOEMVariants(&Test{
+		Name:  "test.variants",
+		Flags: []Flag{NoEnableSelinux},
+	}, func(c cluster.TestCluster, v OEMVariant) {
+		ran = append(ran, v.Metadata...)
+	}, OEMVariant{
+		Platform: "azure",
+		Metadata: []string{"COREOS_AZURE_IPV4_DYNAMIC"},
+	}, OEMVariant{
+		Platform: "aws",
+		Metadata: []string{"COREOS_EC2_HOSTNAME"},
+	})
+	defer delete(Tests, "test.variants.azure")
+	defer delete(Tests, "test.variants.aws")
+
+	azure, ok := Tests["test.variants.azure"]
+	assert.True(t, ok)
+	assert.Equal(t, []string{"azure"}, azure.Platforms)
+	assert.Equal(t, []Flag{NoEnableSelinux}, azure.Flags)
+
+	aws, ok := Tests["test.variants.aws"]
+	assert.True(t, ok)
+	assert.Equal(t, []string{"aws"}, aws.Platforms)
+
+	azure.Run(cluster.TestCluster{})
+	aws.Run(cluster.TestCluster{})
+	assert.Equal(t, []string{"COREOS_AZURE_IPV4_DYNAMIC", "COREOS_EC2_HOSTNAME"}, ran)
+}
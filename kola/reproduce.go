@@ -0,0 +1,220 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/harness/reporters"
+	"github.com/flatcar/mantle/harness/results"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+)
+
+// ReproduceOptions controls how often Reproduce runs a test.
+type ReproduceOptions struct {
+	// Iterations is the number of runs, 0 runs until a failure.
+	Iterations int
+
+	// UntilFailure stops at the first failing run.
+	UntilFailure bool
+
+	// KeepCluster runs all iterations on the machines of the first one
+	// instead of provisioning new ones for each run.
+	KeepCluster bool
+}
+
+// Reproduce runs the test named name, optionally followed by a subtest
+// pattern like with kola run, repeatedly to reproduce flaky
+// failures. The output of each run is written to an iteration-NNN
+// subdirectory of outputDir. With a kept cluster the console and journal
+// of the machines are written to the cluster subdirectory instead.
+func Reproduce(name, channel, offering, pltfrm, outputDir string, sshKeys *[]agent.Key, remove bool, opts ReproduceOptions) error {
+	// an exact name ignores the version restrictions of the test
+	tests, err := FilterTests(register.Tests, []string{name}, channel, offering, pltfrm, semver.Version{})
+	if err != nil {
+		return err
+	}
+	t, ok := tests[testPattern(name)]
+	if !ok {
+		return fmt.Errorf("no test named %q for platform %s", testPattern(name), pltfrm)
+	}
+	subtests := subtestPatterns([]string{name}, t.Name)
+
+	if err := loadTorcxManifest(); err != nil {
+		return err
+	}
+
+	flight, err := NewFlight(pltfrm)
+	if err != nil {
+		return fmt.Errorf("creating flight failed: %v", err)
+	}
+	(*flight.GetBaseFlight()).AdditionalSshKeys = sshKeys
+	if remove {
+		defer flight.Destroy()
+	}
+
+	var kept *keptCluster
+	if opts.KeepCluster {
+		kept = &keptCluster{outputDir: filepath.Join(outputDir, "cluster"), t: t}
+		defer kept.destroy(remove)
+	}
+
+	var htests harness.Tests
+	htests.Add(t.Name, func(h *harness.H) {
+		filterSubtests(h, subtests)
+		if kept != nil {
+			kept.runTest(h, pltfrm, flight)
+		} else {
+			runTest(h, t, pltfrm, flight, remove, nil)
+		}
+	})
+
+	var iterations int
+	var failed []int
+	for i := 1; opts.Iterations == 0 || i <= opts.Iterations; i++ {
+		iterations = i
+		iterDir := filepath.Join(outputDir, fmt.Sprintf("iteration-%03d", i))
+		if opts.Iterations > 0 {
+			plog.Noticef("Running %s, iteration %d of %d", name, i, opts.Iterations)
+		} else {
+			plog.Noticef("Running %s, iteration %d", name, i)
+		}
+
+		suite := harness.NewSuite(harness.Options{
+			OutputDir: iterDir,
+			Parallel:  1,
+			Verbose:   true,
+			Reporters: reporters.Reporters{
+				reporters.NewJSONReporter("report.json", pltfrm, architecture(), ""),
+			},
+		}, htests)
+		err := suite.Run()
+		if err == nil {
+			continue
+		}
+		if err != harness.SuiteFailed {
+			return err
+		}
+
+		failed = append(failed, i)
+		plog.Errorf("Iteration %d failed, output in %v", i, iterDir)
+		if opts.UntilFailure || opts.Iterations == 0 {
+			break
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("FAIL, %d of %d iterations failed %v, output in %v\n", len(failed), iterations, failed, outputDir)
+		return fmt.Errorf("%s failed in %d of %d iterations", name, len(failed), iterations)
+	}
+	fmt.Printf("PASS, %d iterations, output in %v\n", iterations, outputDir)
+	return nil
+}
+
+// keptCluster is a cluster provisioned by the first iteration of a test
+// and reused by the later ones.
+type keptCluster struct {
+	outputDir string
+	t         *register.Test
+
+	c  platform.Cluster
+	tc cluster.TestCluster
+}
+
+func (k *keptCluster) runTest(h *harness.H, pltfrm string, flight platform.Flight) {
+	t := k.t
+	skipUnsupportedArchitecture(h, t)
+	skipUnsupportedNestedVirt(h, t, pltfrm)
+	skipUnsupportedSELinuxMode(h, t)
+	if k.c == nil {
+		h.Status("creating cluster")
+		if err := os.MkdirAll(k.outputDir, 0777); err != nil {
+			h.Fatal(err)
+		}
+		rconf := RuntimeConfigFor(t, k.outputDir)
+		rconf.Tags = ResourceTags(flight, t.Name)
+		c, err := flight.NewCluster(rconf)
+		if err != nil {
+			h.Fatalf("Cluster failed: %v", err)
+		}
+		provisioned := false
+		defer func() {
+			// don't reuse a cluster whose machines didn't come up
+			if !provisioned {
+				c.Destroy()
+			}
+		}()
+		k.tc = provisionCluster(h.Context(), h, t, c, nil)
+		k.c = c
+		provisioned = true
+	}
+
+	watchdog := startConsoleWatchdog(h, k.c, t)
+	defer func() {
+		watchdog.Stop()
+		collectCrashes(h, k.c, t)
+		if h.Failed() {
+			checkInterruptions(h, k.c)
+			if Options.Kdump != "" {
+				collectKdump(h, k.c)
+			}
+		}
+		for _, m := range k.c.Machines() {
+			h.RecordMachine(results.Machine{
+				ID:          m.ID(),
+				PublicIP:    m.IP(),
+				PrivateIP:   m.PrivateIP(),
+				PublicIPv6:  m.IPv6(),
+				PrivateIPv6: m.PrivateIPv6(),
+				CgroupMode:  m.RuntimeConf().CgroupMode,
+			})
+		}
+	}()
+
+	tc := k.tc
+	tc.H = h
+	runBody(h.Context(), h, t, tc)
+}
+
+// destroy destroys the cluster if remove is set and reports the badness
+// found in the console and journal output of its machines.
+func (k *keptCluster) destroy(remove bool) {
+	if k.c == nil || !remove {
+		return
+	}
+	// give some time for the remote journal to be flushed so it can be
+	// read before the machines are destroyed
+	time.Sleep(2 * time.Second)
+	k.c.Destroy()
+	for id, output := range k.c.ConsoleOutput() {
+		for _, badness := range CheckConsole([]byte(output), k.t) {
+			plog.Errorf("Found %s on machine %s console", badness, id)
+		}
+	}
+	for id, output := range k.c.JournalOutput() {
+		for _, badness := range CheckConsole([]byte(output), k.t) {
+			plog.Errorf("Found %s on machine %s journal", badness, id)
+		}
+	}
+}
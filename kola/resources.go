@@ -0,0 +1,318 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/platform"
+)
+
+const (
+	// the sector size of /proc/diskstats, independent of the disk
+	diskstatsSectorSize = 512
+)
+
+var (
+	// whole disks, not their partitions
+	diskstatsDisk = regexp.MustCompile(`^(vd[a-z]+|sd[a-z]+|xvd[a-z]+|nvme\d+n\d+)$`)
+	// e.g. "Startup finished in 1.2s (kernel) + 3.4s (initrd) + 1min 5.6s (userspace) = 1min 10.2s"
+	startupFinished = regexp.MustCompile(`Startup finished in (.*) =`)
+	bootPhase       = regexp.MustCompile(`^(.+) \(([a-z ]+)\)$`)
+	timespanPart    = regexp.MustCompile(`^([0-9.]+)(h|min|s|ms|us)$`)
+)
+
+// ResourceSample is the resource usage of a machine at a point in time.
+type ResourceSample struct {
+	Time time.Time `json:"time"`
+	// CPUBusyPercent is the share of the CPU time since the previous
+	// sample, or since the boot for the first one, not spent idle.
+	CPUBusyPercent float64 `json:"cpu_busy_percent"`
+	MemoryUsed     uint64  `json:"memory_used_bytes"`
+	// DiskRead and DiskWritten are counted from the boot.
+	DiskRead    uint64 `json:"disk_read_bytes"`
+	DiskWritten uint64 `json:"disk_written_bytes"`
+
+	// cumulative CPU ticks of the machine
+	cpuBusy, cpuTotal uint64
+}
+
+// ResourceUsage is the resource usage of a machine during a test, as
+// written to resources.json in the output directory of the machine.
+type ResourceUsage struct {
+	// Boot maps the phases of the boot reported by systemd-analyze,
+	// e.g. kernel, initrd and userspace, to their duration in seconds.
+	Boot    map[string]float64 `json:"boot,omitempty"`
+	Samples []ResourceSample   `json:"samples"`
+}
+
+// resourceCollector samples the resource usage of the machines of a
+// cluster over the life of a test.
+type resourceCollector struct {
+	h *harness.H
+	c platform.Cluster
+
+	lock  sync.Mutex
+	usage map[string]*ResourceUsage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startResourceCollector samples the machines of c at the given interval,
+// if it is not zero.
+func startResourceCollector(h *harness.H, c platform.Cluster, interval time.Duration) *resourceCollector {
+	rc := &resourceCollector{
+		h:     h,
+		c:     c,
+		usage: make(map[string]*ResourceUsage),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if interval == 0 {
+		close(rc.done)
+		return rc
+	}
+
+	go func() {
+		defer close(rc.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rc.stop:
+				return
+			case <-ticker.C:
+				rc.sample()
+			}
+		}
+	}()
+	return rc
+}
+
+func (rc *resourceCollector) sample() {
+	for _, m := range rc.c.Machines() {
+		out, _, err := m.SSH("cat /proc/stat /proc/meminfo /proc/diskstats")
+		if err != nil {
+			// the machine may be rebooting
+			continue
+		}
+		s, err := parseResourceSample(out)
+		if err != nil {
+			plog.Warningf("sampling the resource usage of %s: %v", m.ID(), err)
+			continue
+		}
+		s.Time = time.Now()
+
+		rc.lock.Lock()
+		u, ok := rc.usage[m.ID()]
+		if !ok {
+			u = &ResourceUsage{}
+			rc.usage[m.ID()] = u
+		}
+		if n := len(u.Samples); n > 0 && s.cpuTotal > u.Samples[n-1].cpuTotal {
+			prev := u.Samples[n-1]
+			s.CPUBusyPercent = 100 * float64(s.cpuBusy-prev.cpuBusy) / float64(s.cpuTotal-prev.cpuTotal)
+		}
+		u.Samples = append(u.Samples, s)
+		rc.lock.Unlock()
+	}
+}
+
+// Stop stops sampling, reads the boot times of the machines, writes the
+// usage of each machine to its output directory and records the peaks as
+// metrics of the test. It must be called before machines are destroyed.
+func (rc *resourceCollector) Stop() {
+	select {
+	case <-rc.done:
+		// not collecting
+		return
+	default:
+	}
+	close(rc.stop)
+	<-rc.done
+
+	for _, m := range rc.c.Machines() {
+		out, _, err := m.SSH("systemd-analyze time")
+		if err != nil {
+			continue
+		}
+		boot, err := parseBootTimes(string(out))
+		if err != nil {
+			plog.Warningf("reading the boot times of %s: %v", m.ID(), err)
+			continue
+		}
+		if u, ok := rc.usage[m.ID()]; ok {
+			u.Boot = boot
+		} else {
+			rc.usage[m.ID()] = &ResourceUsage{Boot: boot}
+		}
+	}
+
+	for id, u := range rc.usage {
+		b, err := json.MarshalIndent(u, "", "  ")
+		if err != nil {
+			rc.h.Errorf("encoding the resource usage of %s: %v", id, err)
+			continue
+		}
+		dir := filepath.Join(rc.h.OutputDir(), id)
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			rc.h.Errorf("writing the resource usage of %s: %v", id, err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, "resources.json"), b, 0666); err != nil {
+			rc.h.Errorf("writing the resource usage of %s: %v", id, err)
+		}
+	}
+	for name, value := range resourceMetrics(rc.usage) {
+		rc.h.RecordMetric(name, value)
+	}
+}
+
+// resourceMetrics summarizes the usage of the machines of a test: the
+// longest boot phases, the highest CPU and memory usage and the most data
+// read from and written to the disks of a machine.
+func resourceMetrics(usage map[string]*ResourceUsage) map[string]float64 {
+	metrics := make(map[string]float64)
+	peak := func(name string, value float64) {
+		if old, ok := metrics[name]; !ok || value > old {
+			metrics[name] = value
+		}
+	}
+	for _, u := range usage {
+		for phase, secs := range u.Boot {
+			peak("boot_"+strings.ReplaceAll(phase, " ", "_")+"_seconds", secs)
+		}
+		for i, s := range u.Samples {
+			// the first sample covers the boot
+			if i > 0 {
+				peak("cpu_busy_percent_max", s.CPUBusyPercent)
+			}
+			peak("memory_used_bytes_max", float64(s.MemoryUsed))
+			peak("disk_read_bytes", float64(s.DiskRead))
+			peak("disk_written_bytes", float64(s.DiskWritten))
+		}
+	}
+	return metrics
+}
+
+// parseResourceSample parses /proc/stat, /proc/meminfo and /proc/diskstats
+// of a machine.
+func parseResourceSample(out []byte) (ResourceSample, error) {
+	var s ResourceSample
+	var memTotal, memAvailable uint64
+	var haveCPU, haveMem bool
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "cpu":
+			// user nice system idle iowait irq softirq steal
+			for i, f := range fields[1:] {
+				if i >= 8 {
+					break
+				}
+				ticks, err := strconv.ParseUint(f, 10, 64)
+				if err != nil {
+					return s, fmt.Errorf("bad /proc/stat line %q", sc.Text())
+				}
+				s.cpuTotal += ticks
+				if i != 3 && i != 4 {
+					s.cpuBusy += ticks
+				}
+			}
+			haveCPU = true
+		case fields[0] == "MemTotal:" && len(fields) > 1:
+			memTotal, _ = strconv.ParseUint(fields[1], 10, 64)
+		case fields[0] == "MemAvailable:" && len(fields) > 1:
+			memAvailable, _ = strconv.ParseUint(fields[1], 10, 64)
+			haveMem = true
+		case len(fields) >= 10 && diskstatsDisk.MatchString(fields[2]):
+			read, err1 := strconv.ParseUint(fields[5], 10, 64)
+			written, err2 := strconv.ParseUint(fields[9], 10, 64)
+			if err1 != nil || err2 != nil {
+				return s, fmt.Errorf("bad /proc/diskstats line %q", sc.Text())
+			}
+			s.DiskRead += read * diskstatsSectorSize
+			s.DiskWritten += written * diskstatsSectorSize
+		}
+	}
+	if !haveCPU || !haveMem {
+		return s, fmt.Errorf("missing CPU or memory statistics")
+	}
+	if memTotal > memAvailable {
+		s.MemoryUsed = (memTotal - memAvailable) * 1024
+	}
+	if s.cpuTotal > 0 {
+		s.CPUBusyPercent = 100 * float64(s.cpuBusy) / float64(s.cpuTotal)
+	}
+	return s, nil
+}
+
+// parseBootTimes parses the output of systemd-analyze time into the
+// duration of the phases of the boot in seconds.
+func parseBootTimes(out string) (map[string]float64, error) {
+	m := startupFinished.FindStringSubmatch(out)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected systemd-analyze output %q", strings.TrimSpace(out))
+	}
+	boot := make(map[string]float64)
+	for _, phase := range strings.Split(m[1], " + ") {
+		pm := bootPhase.FindStringSubmatch(strings.TrimSpace(phase))
+		if pm == nil {
+			return nil, fmt.Errorf("unexpected boot phase %q", phase)
+		}
+		secs, err := parseTimespan(pm[1])
+		if err != nil {
+			return nil, err
+		}
+		boot[pm[2]] = secs
+	}
+	return boot, nil
+}
+
+// parseTimespan parses a time span formatted by systemd, e.g. "1min 2.5s",
+// into seconds.
+func parseTimespan(span string) (float64, error) {
+	units := map[string]float64{"h": 3600, "min": 60, "s": 1, "ms": 1e-3, "us": 1e-6}
+	var secs float64
+	for _, part := range strings.Fields(span) {
+		m := timespanPart.FindStringSubmatch(part)
+		if m == nil {
+			return 0, fmt.Errorf("bad time span %q", span)
+		}
+		v, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad time span %q", span)
+		}
+		secs += v * units[m[2]]
+	}
+	return secs, nil
+}
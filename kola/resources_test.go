@@ -0,0 +1,114 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResourceSample(t *testing.T) {
+	out := []byte(`cpu  300 0 100 550 50 0 0 0 0 0
+cpu0 150 0 50 275 25 0 0 0 0 0
+intr 12345
+MemTotal:        2000000 kB
+MemFree:          500000 kB
+MemAvailable:    1500000 kB
+ 253       0 vda 100 0 2000 10 50 0 4000 20 0 30 30 0 0 0 0
+ 253       1 vda1 10 0 200 1 5 0 400 2 0 3 3 0 0 0 0
+   7       0 loop0 10 0 100 1 0 0 0 0 0 1 1 0 0 0 0
+`)
+	s, err := parseResourceSample(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CPUBusyPercent != 40 {
+		t.Errorf("CPU busy: got %v, expected 40", s.CPUBusyPercent)
+	}
+	if s.MemoryUsed != 500000*1024 {
+		t.Errorf("memory used: got %d", s.MemoryUsed)
+	}
+	if s.DiskRead != 2000*512 || s.DiskWritten != 4000*512 {
+		t.Errorf("disk: got %d read, %d written", s.DiskRead, s.DiskWritten)
+	}
+
+	if _, err := parseResourceSample([]byte("intr 12345\n")); err == nil {
+		t.Error("expected error without CPU and memory statistics")
+	}
+}
+
+func TestParseBootTimes(t *testing.T) {
+	for _, tt := range []struct {
+		out      string
+		expected map[string]float64
+	}{
+		{
+			"Startup finished in 1.234s (kernel) + 2.5s (initrd) + 1min 3.250s (userspace) = 1min 6.984s\nmulti-user.target reached after 1min 3s in userspace\n",
+			map[string]float64{"kernel": 1.234, "initrd": 2.5, "userspace": 63.25},
+		},
+		{
+			"Startup finished in 2.1s (firmware) + 500ms (loader) + 800ms (kernel) + 4s (userspace) = 7.4s\n",
+			map[string]float64{"firmware": 2.1, "loader": 0.5, "kernel": 0.8, "userspace": 4},
+		},
+	} {
+		boot, err := parseBootTimes(tt.out)
+		if err != nil {
+			t.Errorf("%q: %v", tt.out, err)
+			continue
+		}
+		for phase, secs := range tt.expected {
+			if diff := boot[phase] - secs; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("%q: got %v for %s, expected %v", tt.out, boot[phase], phase, secs)
+			}
+		}
+		if len(boot) != len(tt.expected) {
+			t.Errorf("%q: got %v", tt.out, boot)
+		}
+	}
+
+	if _, err := parseBootTimes("Bootup is not yet finished.\n"); err == nil {
+		t.Error("expected error for an unfinished boot")
+	}
+}
+
+func TestResourceMetrics(t *testing.T) {
+	usage := map[string]*ResourceUsage{
+		"a": {
+			Boot: map[string]float64{"kernel": 1, "userspace": 5},
+			Samples: []ResourceSample{
+				{CPUBusyPercent: 90, MemoryUsed: 100, DiskWritten: 10},
+				{CPUBusyPercent: 20, MemoryUsed: 300, DiskWritten: 20},
+			},
+		},
+		"b": {
+			Boot: map[string]float64{"kernel": 2, "userspace": 4},
+			Samples: []ResourceSample{
+				{CPUBusyPercent: 50, MemoryUsed: 200, DiskRead: 5, DiskWritten: 15},
+				{CPUBusyPercent: 30, MemoryUsed: 200, DiskRead: 7, DiskWritten: 15},
+			},
+		},
+	}
+	expected := map[string]float64{
+		"boot_kernel_seconds":    2,
+		"boot_userspace_seconds": 5,
+		"cpu_busy_percent_max":   30,
+		"memory_used_bytes_max":  300,
+		"disk_read_bytes":        7,
+		"disk_written_bytes":     20,
+	}
+	if got := resourceMetrics(usage); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
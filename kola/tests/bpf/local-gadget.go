@@ -4,11 +4,9 @@ package bpf
 
 import (
 	"bytes"
-	"strings"
 	"text/template"
 
 	"github.com/coreos/go-semver/semver"
-	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/tests/docker"
@@ -116,7 +114,7 @@ func init() {
 }
 
 func localGadgetTest(c cluster.TestCluster) {
-	arch := strings.SplitN(kola.QEMUOptions.Board, "-", 2)[0]
+	arch := c.Architecture
 	gadget := binaries[arch]
 
 	gadget.Arch = arch
@@ -18,7 +18,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
 	"text/template"
 	"time"
@@ -327,16 +326,9 @@ func Serve() error {
 
 func configureHTTPServer(c cluster.TestCluster, srv platform.Machine) {
 	// manually copy Kolet on the host, as the initial size cluster is 0.
-	kola.ScpKolet(c, strings.SplitN(kola.QEMUOptions.Board, "-", 2)[0])
+	kola.ScpKolet(c, c.Architecture)
 
-	in, err := os.Open(kola.DevcontainerFile)
-	if err != nil {
-		c.Fatalf("opening dev container file: %v", err)
-	}
-
-	defer in.Close()
-
-	if err := platform.InstallFile(in, srv, "/var/www/flatcar_developer_container.bin.bz2"); err != nil {
+	if err := platform.UploadFile(srv, kola.DevcontainerFile, "/var/www/flatcar_developer_container.bin.bz2", c.UploadProgress("dev container")); err != nil {
 		c.Fatalf("copying dev container to HTTP server: %v", err)
 	}
 
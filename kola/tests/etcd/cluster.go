@@ -0,0 +1,304 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/util"
+)
+
+const (
+	// etcdImage is the etcd v3 container, arm64 images have an -arm64
+	// suffix.
+	etcdImage = "quay.io/coreos/etcd:v3.5.9"
+
+	// etcdDir holds the data directory and snapshots of a member.
+	etcdDir = "/var/lib/kola-etcd"
+)
+
+// memberUserData runs the etcd container configured by Cluster on the
+// machines of its members.
+var memberUserData = conf.ContainerLinuxConfig(`systemd:
+  units:
+    - name: kola-etcd.service
+      contents: |
+        [Unit]
+        Description=etcd v3 in a container
+        Requires=docker.service
+        After=docker.service
+        [Service]
+        EnvironmentFile=/etc/kola/etcd-image.env
+        ExecStartPre=-/usr/bin/docker rm --force etcd
+        ExecStart=/usr/bin/docker run --name etcd --net host --volume ` + etcdDir + `:` + etcdDir + `:z --env-file /etc/kola/etcd.env ${KOLA_ETCD_IMAGE} /usr/local/bin/etcd
+        ExecStop=/usr/bin/docker stop etcd
+        Restart=on-failure`)
+
+// Member is an etcd member of a Cluster.
+type Member struct {
+	Name    string
+	Machine platform.Machine
+}
+
+// PeerURL returns the URL at which the other members reach m.
+func (m *Member) PeerURL() string {
+	return fmt.Sprintf("http://%s:2380", m.Machine.PrivateIP())
+}
+
+// ClientURL returns the URL at which clients reach m.
+func (m *Member) ClientURL() string {
+	return fmt.Sprintf("http://%s:2379", m.Machine.PrivateIP())
+}
+
+// Cluster is an etcd v3 cluster running in containers on the machines of a
+// test, bootstrapped statically. The machines need memberUserData.
+type Cluster struct {
+	c       cluster.TestCluster
+	image   string
+	Members []*Member
+	// the number of members created, for their names
+	created int
+}
+
+// NewCluster starts an etcd cluster with a member on each of machines and
+// waits for it to be healthy.
+func NewCluster(c cluster.TestCluster, machines []platform.Machine) *Cluster {
+	ec := &Cluster{c: c, image: etcdImage}
+	if c.Architecture == "arm64" {
+		ec.image += "-arm64"
+	}
+	for _, m := range machines {
+		ec.Members = append(ec.Members, ec.newMember(m))
+	}
+	initialCluster := ec.initialCluster()
+	for _, m := range ec.Members {
+		ec.start(m, initialCluster, "new")
+	}
+	ec.WaitHealthy()
+	return ec
+}
+
+func (ec *Cluster) newMember(m platform.Machine) *Member {
+	ec.created++
+	return &Member{Name: fmt.Sprintf("etcd%d", ec.created), Machine: m}
+}
+
+// initialCluster returns the initial cluster configuration of the current
+// members.
+func (ec *Cluster) initialCluster() string {
+	var peers []string
+	for _, m := range ec.Members {
+		peers = append(peers, m.Name+"="+m.PeerURL())
+	}
+	return strings.Join(peers, ",")
+}
+
+// start configures the container of m and starts it.
+func (ec *Cluster) start(m *Member, initialCluster, state string) {
+	env := fmt.Sprintf(`ETCD_NAME=%s
+ETCD_DATA_DIR=%s/data
+ETCD_LISTEN_CLIENT_URLS=http://0.0.0.0:2379
+ETCD_ADVERTISE_CLIENT_URLS=%s
+ETCD_LISTEN_PEER_URLS=http://0.0.0.0:2380
+ETCD_INITIAL_ADVERTISE_PEER_URLS=%s
+ETCD_INITIAL_CLUSTER=%s
+ETCD_INITIAL_CLUSTER_STATE=%s
+ETCD_INITIAL_CLUSTER_TOKEN=kola
+`, m.Name, etcdDir, m.ClientURL(), m.PeerURL(), initialCluster, state)
+	write := func(path, contents string) string {
+		return fmt.Sprintf("echo %s | base64 -d | sudo tee %s >/dev/null",
+			base64.StdEncoding.EncodeToString([]byte(contents)), path)
+	}
+	ec.c.MustSSH(m.Machine, strings.Join([]string{
+		"sudo mkdir -p /etc/kola " + etcdDir,
+		write("/etc/kola/etcd.env", env),
+		write("/etc/kola/etcd-image.env", "KOLA_ETCD_IMAGE="+ec.image+"\n"),
+		// pulling may take longer than the health checks wait
+		"docker pull --quiet " + ec.image,
+		"sudo systemctl start kola-etcd.service",
+	}, " && "))
+}
+
+// Etcdctl runs etcdctl with args, which go through the shell, in the
+// container of m. It talks to the member of m unless args contain --endpoints.
+func (ec *Cluster) Etcdctl(m *Member, args string) ([]byte, error) {
+	return ec.c.SSH(m.Machine, "docker exec etcd etcdctl --command-timeout=10s "+args)
+}
+
+// MustEtcdctl runs Etcdctl and fails the test if it fails.
+func (ec *Cluster) MustEtcdctl(m *Member, args string) []byte {
+	out, err := ec.Etcdctl(m, args)
+	if err != nil {
+		ec.c.Fatalf("etcdctl %s on %s failed: %v: %s", args, m.Name, err, out)
+	}
+	return out
+}
+
+// WaitHealthy waits for all members to be healthy.
+func (ec *Cluster) WaitHealthy() {
+	endpoints := make([]string, len(ec.Members))
+	for i, m := range ec.Members {
+		endpoints[i] = m.ClientURL()
+	}
+	var out []byte
+	if err := util.Retry(30, 5*time.Second, func() error {
+		var err error
+		// etcdctl reports the health on stderr
+		out, err = ec.Etcdctl(ec.Members[0], "endpoint health --endpoints="+strings.Join(endpoints, ",")+" 2>&1")
+		if err != nil {
+			return err
+		}
+		if n := strings.Count(string(out), "is healthy"); n != len(ec.Members) {
+			return fmt.Errorf("%d of %d members are healthy", n, len(ec.Members))
+		}
+		return nil
+	}); err != nil {
+		ec.c.Fatalf("etcd cluster is not healthy: %v: %s", err, out)
+	}
+}
+
+// Put sets key to value through m.
+func (ec *Cluster) Put(m *Member, key, value string) error {
+	_, err := ec.Etcdctl(m, fmt.Sprintf("put %s %s", key, value))
+	return err
+}
+
+// Get returns the value of key read through m with a linearizable read,
+// which needs a quorum, or "" if it does not exist.
+func (ec *Cluster) Get(m *Member, key string) (string, error) {
+	out, err := ec.Etcdctl(m, "get --print-value-only "+key)
+	return strings.TrimSpace(string(out)), err
+}
+
+// status is the output of "etcdctl endpoint status -w json".
+type status struct {
+	Status struct {
+		Header struct {
+			MemberID uint64 `json:"member_id"`
+		} `json:"header"`
+		Leader uint64 `json:"leader"`
+	} `json:"Status"`
+}
+
+// parseStatus parses the status of a single endpoint.
+func parseStatus(out []byte) (status, error) {
+	var s []status
+	if err := json.Unmarshal(out, &s); err != nil {
+		return status{}, fmt.Errorf("parsing endpoint status: %v", err)
+	}
+	if len(s) != 1 {
+		return status{}, fmt.Errorf("expected the status of 1 endpoint, got %d", len(s))
+	}
+	return s[0], nil
+}
+
+// Leader returns the IDs of m and of the leader as seen by m, which is 0
+// if m knows no leader.
+func (ec *Cluster) Leader(m *Member) (id, leader uint64, err error) {
+	out, err := ec.Etcdctl(m, "endpoint status -w json")
+	if err != nil {
+		return 0, 0, err
+	}
+	s, err := parseStatus(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	return s.Status.Header.MemberID, s.Status.Leader, nil
+}
+
+// AddMember adds a member on a new machine to the cluster and waits for
+// the cluster to be healthy.
+func (ec *Cluster) AddMember() *Member {
+	machine, err := ec.c.NewMachine(memberUserData)
+	if err != nil {
+		ec.c.Fatalf("creating machine: %v", err)
+	}
+	m := ec.newMember(machine)
+	ec.MustEtcdctl(ec.Members[0], fmt.Sprintf("member add %s --peer-urls=%s", m.Name, m.PeerURL()))
+	ec.Members = append(ec.Members, m)
+	ec.start(m, ec.initialCluster(), "existing")
+	ec.WaitHealthy()
+	return m
+}
+
+// RemoveMember removes m from the cluster and destroys its machine.
+func (ec *Cluster) RemoveMember(m *Member) {
+	var rest []*Member
+	for _, o := range ec.Members {
+		if o != m {
+			rest = append(rest, o)
+		}
+	}
+	if len(rest) == len(ec.Members) || len(rest) == 0 {
+		ec.c.Fatalf("can't remove %s from the cluster", m.Name)
+	}
+
+	id, _, err := ec.Leader(m)
+	if err != nil {
+		ec.c.Fatalf("getting the ID of %s: %v", m.Name, err)
+	}
+	ec.MustEtcdctl(rest[0], "member remove "+strconv.FormatUint(id, 16))
+	ec.Members = rest
+	m.Machine.Destroy()
+}
+
+// Snapshot saves a snapshot of the data of the cluster taken through m to
+// the output directory of the test and returns its path.
+func (ec *Cluster) Snapshot(m *Member) string {
+	remote := etcdDir + "/snapshot.db"
+	ec.MustEtcdctl(m, "snapshot save "+remote)
+	ec.c.MustSSH(m.Machine, "sudo chmod 0644 "+remote)
+
+	local := filepath.Join(ec.c.OutputDir(), "etcd-snapshot.db")
+	f, err := os.Create(local)
+	if err != nil {
+		ec.c.Fatal(err)
+	}
+	defer f.Close()
+	if err := platform.Download(m.Machine, remote, f, nil); err != nil {
+		ec.c.Fatalf("downloading the snapshot: %v", err)
+	}
+	return local
+}
+
+// Restore replaces the data of all members with the snapshot, stopping
+// the cluster, and waits for the restored cluster to be healthy.
+func (ec *Cluster) Restore(snapshot string) {
+	for _, m := range ec.Members {
+		ec.c.MustSSH(m.Machine, "sudo systemctl stop kola-etcd.service")
+	}
+	initialCluster := ec.initialCluster()
+	for _, m := range ec.Members {
+		if err := platform.UploadFile(m.Machine, snapshot, "/home/core/etcd-snapshot.db", nil); err != nil {
+			ec.c.Fatalf("copying the snapshot to %s: %v", m.Name, err)
+		}
+		ec.c.MustSSH(m.Machine, fmt.Sprintf("sudo mv /home/core/etcd-snapshot.db %[1]s/restore.db && sudo rm -rf %[1]s/data && "+
+			"docker run --rm --volume %[1]s:%[1]s:z %[2]s /usr/local/bin/etcdutl snapshot restore %[1]s/restore.db "+
+			"--data-dir %[1]s/data --name %[3]s --initial-cluster %[4]s --initial-cluster-token kola --initial-advertise-peer-urls %[5]s",
+			etcdDir, ec.image, m.Name, initialCluster, m.PeerURL()))
+		ec.c.MustSSH(m.Machine, "sudo systemctl start kola-etcd.service")
+	}
+	ec.WaitHealthy()
+}
@@ -0,0 +1,165 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	tutil "github.com/flatcar/mantle/kola/tests/util"
+	"github.com/flatcar/mantle/util"
+)
+
+func init() {
+	// the members need the private network between the machines
+	register.Register(&register.Test{
+		Run:              etcdV3Membership,
+		ClusterSize:      3,
+		Name:             "cl.etcd.v3.membership",
+		UserData:         memberUserData,
+		Distros:          []string{"cl"},
+		ExcludePlatforms: []string{"qemu-unpriv"},
+	})
+	register.Register(&register.Test{
+		Run:              etcdV3SnapshotRestore,
+		ClusterSize:      3,
+		Name:             "cl.etcd.v3.snapshot-restore",
+		UserData:         memberUserData,
+		Distros:          []string{"cl"},
+		ExcludePlatforms: []string{"qemu-unpriv"},
+	})
+	register.Register(&register.Test{
+		Run:              etcdV3LeaderFailover,
+		ClusterSize:      3,
+		Name:             "cl.etcd.v3.leader-failover",
+		UserData:         memberUserData,
+		Distros:          []string{"cl"},
+		ExcludePlatforms: []string{"qemu-unpriv"},
+	})
+}
+
+// etcdV3Membership adds a member to the cluster, which must get the
+// existing data, and removes one of the initial members.
+func etcdV3Membership(c cluster.TestCluster) {
+	ec := NewCluster(c, c.Machines())
+	if err := ec.Put(ec.Members[0], "kola", "before"); err != nil {
+		c.Fatalf("put failed: %v", err)
+	}
+
+	added := ec.AddMember()
+	if v, err := ec.Get(added, "kola"); err != nil || v != "before" {
+		c.Fatalf("new member read %q: %v", v, err)
+	}
+
+	ec.RemoveMember(ec.Members[0])
+	out := ec.MustEtcdctl(added, "member list")
+	if n := len(strings.Split(strings.TrimSpace(string(out)), "\n")); n != 3 {
+		c.Fatalf("expected 3 members after the removal, got %d: %s", n, out)
+	}
+	ec.WaitHealthy()
+	if err := ec.Put(added, "kola", "after"); err != nil {
+		c.Fatalf("put after the removal failed: %v", err)
+	}
+}
+
+// etcdV3SnapshotRestore restores the cluster from a snapshot, which drops
+// the changes made after it.
+func etcdV3SnapshotRestore(c cluster.TestCluster) {
+	ec := NewCluster(c, c.Machines())
+	m := ec.Members[0]
+	if err := ec.Put(m, "kola", "snapshotted"); err != nil {
+		c.Fatalf("put failed: %v", err)
+	}
+	snapshot := ec.Snapshot(m)
+	if err := ec.Put(m, "kola", "lost"); err != nil {
+		c.Fatalf("put failed: %v", err)
+	}
+
+	ec.Restore(snapshot)
+	for _, m := range ec.Members {
+		if v, err := ec.Get(m, "kola"); err != nil || v != "snapshotted" {
+			c.Fatalf("%s read %q after the restore: %v", m.Name, v, err)
+		}
+	}
+}
+
+// etcdV3LeaderFailover partitions the leader from the other members,
+// which must elect a new one and keep accepting writes, while the old
+// leader can't serve linearizable reads. Once healed, the old leader
+// catches up.
+func etcdV3LeaderFailover(c cluster.TestCluster) {
+	ec := NewCluster(c, c.Machines())
+
+	var leader *Member
+	var leaderID uint64
+	var followers []*Member
+	for _, m := range ec.Members {
+		id, l, err := ec.Leader(m)
+		if err != nil {
+			c.Fatalf("status of %s: %v", m.Name, err)
+		}
+		if id == l {
+			leader, leaderID = m, id
+		} else {
+			followers = append(followers, m)
+		}
+	}
+	if leader == nil {
+		c.Fatal("the cluster has no leader")
+	}
+
+	for _, f := range followers {
+		tutil.Partition(c, leader.Machine, f.Machine)
+	}
+	if err := util.Retry(30, 2*time.Second, func() error {
+		for _, f := range followers {
+			_, l, err := ec.Leader(f)
+			if err != nil {
+				return err
+			}
+			if l == 0 || l == leaderID {
+				return fmt.Errorf("%s has leader %x", f.Name, l)
+			}
+		}
+		return nil
+	}); err != nil {
+		c.Fatalf("no new leader was elected: %v", err)
+	}
+
+	if err := ec.Put(followers[0], "kola", "failover"); err != nil {
+		c.Fatalf("put on the majority failed: %v", err)
+	}
+	if v, err := ec.Get(leader, "kola"); err == nil {
+		c.Fatalf("the partitioned old leader served a linearizable read: %q", v)
+	}
+
+	tutil.Heal(c, leader.Machine)
+	if err := util.Retry(30, 2*time.Second, func() error {
+		v, err := ec.Get(leader, "kola")
+		if err != nil {
+			return err
+		}
+		if v != "failover" {
+			return fmt.Errorf("read %q", v)
+		}
+		return nil
+	}); err != nil {
+		c.Fatalf("the old leader did not catch up: %v", err)
+	}
+	ec.WaitHealthy()
+}
@@ -97,6 +97,18 @@ storage:
         inline: |
           set linux_append="flatcar.autologin"`),
 	})
+	register.Register(&register.Test{
+		Name:        "cl.ignition.oem.helpers",
+		Run:         oemHelpers,
+		ClusterSize: 1,
+		Distros:     []string{"cl"},
+		// This test changes the grub.cfg which does not work on cloud environments after reboot
+		Platforms:  []string{"qemu", "qemu-unpriv"},
+		MinVersion: semver.Version{Major: 3550},
+		UserData: conf.Ignition(`{ "ignition": { "version": "3.3.0" } }`).
+			AddOEMRelease("kola", "VERSION_ID=1.0").
+			AddOEMGrubConfig(`set linux_append="$linux_append flatcar.autologin"`),
+	})
 	register.Register(&register.Test{
 		Name:        "cl.ignition.oem.wipe",
 		Run:         wipeOEM,
@@ -159,3 +171,16 @@ func wipeOEM(c cluster.TestCluster) {
 		c.Fatalf("should get ext4, got: %s", string(out))
 	}
 }
+
+// oemHelpers checks the OEM contents written with the helpers of conf,
+// keeping the grub.cfg settings of kola.
+func oemHelpers(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	c.AssertCmdOutputContains(m, "cat /usr/share/oem/oem-release", "ID=kola\nVERSION_ID=1.0")
+
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("could not reboot machine: %v", err)
+	}
+	c.MustSSH(m, "grep -qw flatcar.autologin /proc/cmdline")
+}
@@ -94,6 +94,39 @@ var (
 		      ]
 		  }
 	      }`)
+	assetsClient = conf.Ignition(`{
+		  "ignition": {
+		      "version": "2.1.0"
+		  },
+		  "storage": {
+		      "files": [
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/assets",
+			      "contents": {
+				  "source": "$assets/assets"
+			      },
+			      "mode": 420
+			  }
+		      ]
+		  }
+	      }`)
+	assetsClientV3 = conf.Ignition(`{
+		  "ignition": {
+		      "version": "3.0.0"
+		  },
+		  "storage": {
+		      "files": [
+			  {
+			      "path": "/var/resource/assets",
+			      "contents": {
+				  "source": "$assets/assets"
+			      },
+			      "mode": 420
+			  }
+		      ]
+		  }
+	      }`)
 )
 
 func init() {
@@ -115,6 +148,16 @@ func init() {
 		},
 		// This should run on all clouds to test initramfs networking
 	})
+	register.Register(&register.Test{
+		Name:        "coreos.ignition.resource.assets",
+		Run:         resourceAssets,
+		ClusterSize: 1,
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+		AssetsDir:   "coreos.ignition.resource.assets",
+		UserData:    assetsClient,
+		UserDataV3:  assetsClientV3,
+	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.resource.remote",
 		Run:         resourceRemote,
@@ -345,6 +388,18 @@ func resourceLocal(c cluster.TestCluster) {
 	})
 }
 
+// resourceAssets checks that Ignition fetches files from the AssetsDir of
+// the test served by kola.
+func resourceAssets(c cluster.TestCluster) {
+	if c.AssetsURL == "" {
+		c.Fatal("the assets of the test are not served")
+	}
+
+	checkResources(c, c.Machines()[0], map[string]string{
+		"assets": "kola-assets",
+	})
+}
+
 func resourceRemote(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
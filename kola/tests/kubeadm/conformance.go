@@ -0,0 +1,150 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeadm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+const (
+	// conformanceSkip excludes the tests breaking the cluster for the
+	// following ones.
+	conformanceSkip = `\[Disruptive\]`
+	// conformanceWait is how long sonobuoy may run the tests, in minutes.
+	conformanceWait = 180
+)
+
+// conformanceResult is a test in the detailed results of the e2e plugin
+// of sonobuoy, one JSON object per line.
+type conformanceResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details struct {
+		Failure string `json:"failure"`
+	} `json:"details"`
+}
+
+// parseConformanceResults parses the output of
+// "sonobuoy results --mode detailed".
+func parseConformanceResults(out []byte) ([]conformanceResult, error) {
+	var results []conformanceResult
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	// failures may include long logs
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r conformanceResult
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("parsing sonobuoy result %q: %w", line, err)
+		}
+		results = append(results, r)
+	}
+	return results, sc.Err()
+}
+
+// kubeadmConformanceTest runs the Kubernetes conformance tests selected by
+// kola.KubernetesConformance on the cluster with sonobuoy and reports each
+// one that ran as a subtest.
+func kubeadmConformanceTest(c cluster.TestCluster, params map[string]interface{}) {
+	if kola.KubernetesConformance == "" {
+		c.Skip("no Kubernetes conformance tests selected")
+	}
+
+	params["Arch"] = c.Architecture
+	kubectl, err := setup(c, params)
+	if err != nil {
+		c.Fatalf("unable to setup cluster: %v", err)
+	}
+	waitNodesReady(c, kubectl)
+
+	script, err := render(sonobuoyScript, params, true)
+	if err != nil {
+		c.Fatalf("unable to render sonobuoy script: %v", err)
+	}
+	c.MustSSH(kubectl, fmt.Sprintf("echo %s | base64 -d | sudo bash", script))
+
+	sonobuoy := params["DownloadDir"].(string) + "/sonobuoy"
+	plog.Infof("running Kubernetes conformance tests matching %q", kola.KubernetesConformance)
+	// sonobuoy fails if the tests don't finish in time, the results
+	// collected so far are still retrieved
+	if _, err := c.SSH(kubectl, fmt.Sprintf("%s run --plugin e2e --e2e-focus %s --e2e-skip %s --wait %d",
+		sonobuoy, shellQuote(kola.KubernetesConformance), shellQuote(conformanceSkip), conformanceWait)); err != nil {
+		c.Errorf("running sonobuoy: %v", err)
+	}
+	out, err := c.SSH(kubectl, sonobuoy+" retrieve /home/core")
+	if err != nil {
+		c.Fatalf("retrieving the sonobuoy results: %v", err)
+	}
+	tarball := strings.TrimSpace(string(out))
+	saveConformanceResults(c, kubectl, tarball)
+
+	out = c.MustSSH(kubectl, fmt.Sprintf("%s results %s --plugin e2e --mode detailed", sonobuoy, tarball))
+	results, err := parseConformanceResults(out)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		r := r
+		counts[r.Status]++
+		// the tests not selected are reported as skipped
+		if r.Status == "skipped" {
+			continue
+		}
+		c.Run(r.Name, func(c cluster.TestCluster) {
+			if r.Status != "passed" {
+				c.Fatalf("%s: %s", r.Status, r.Details.Failure)
+			}
+		})
+	}
+	c.RecordMetric("conformance_passed", float64(counts["passed"]))
+	c.RecordMetric("conformance_failed", float64(counts["failed"]))
+	if counts["passed"]+counts["failed"] == 0 {
+		c.Fatalf("no conformance test matched %q", kola.KubernetesConformance)
+	}
+}
+
+// saveConformanceResults copies the results tarball of sonobuoy to the
+// output directory of the test.
+func saveConformanceResults(c cluster.TestCluster, m platform.Machine, tarball string) {
+	f, err := os.Create(filepath.Join(c.OutputDir(), "sonobuoy.tar.gz"))
+	if err != nil {
+		c.Errorf("saving the sonobuoy results: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := platform.Download(m, tarball, f, nil); err != nil {
+		c.Errorf("saving the sonobuoy results: %v", err)
+	}
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -17,14 +17,12 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
-	"strings"
 	"text/template"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/coreos/pkg/capnslog"
 
-	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/tests/etcd"
@@ -89,8 +87,10 @@ var (
 			"CRIctlVersion": "v1.26.0",
 			// from https://github.com/kubernetes/release/releases
 			"ReleaseVersion": "v0.14.0",
-			"DownloadDir":    "/opt/bin",
-			"PodSubnet":      "192.168.0.0/17",
+			// from https://github.com/vmware-tanzu/sonobuoy/releases
+			"SonobuoyVersion": "0.56.16",
+			"DownloadDir":     "/opt/bin",
+			"PodSubnet":       "192.168.0.0/17",
 			"arm64": map[string]string{
 				"KubeadmSum": "46c9f489062bdb84574703f7339d140d7e42c9c71b367cd860071108a3c1d38fabda2ef69f9c0ff88f7c80e88d38f96ab2248d4c9a6c9c60b0a4c20fd640d0db",
 				"KubeletSum": "0e4ee1f23bf768c49d09beb13a6b5fad6efc8e3e685e7c5610188763e3af55923fb46158b5e76973a0f9a055f9b30d525b467c53415f965536adc2f04d9cf18d",
@@ -121,8 +121,10 @@ var (
 			"CRIctlVersion": "v1.24.2",
 			// from https://github.com/kubernetes/release/releases
 			"ReleaseVersion": "v0.14.0",
-			"DownloadDir":    "/opt/bin",
-			"PodSubnet":      "192.168.0.0/17",
+			// from https://github.com/vmware-tanzu/sonobuoy/releases
+			"SonobuoyVersion": "0.56.16",
+			"DownloadDir":     "/opt/bin",
+			"PodSubnet":       "192.168.0.0/17",
 			"arm64": map[string]string{
 				"KubeadmSum": "daab8965a4f617d1570d04c031ab4d55fff6aa13a61f0e4045f2338947f9fb0ee3a80fdee57cfe86db885390595460342181e1ec52b89f127ef09c393ae3db7f",
 				"KubeletSum": "7b872a34d86e8aa75455a62a20f5cf16426de2ae54ffb8e0250fead920838df818201b8512c2f8bf4c939e5b21babab371f3a48803e2e861da9e6f8cdd022324",
@@ -147,6 +149,7 @@ var (
 			"CNIVersion":       "v1.1.1",
 			"CRIctlVersion":    "v1.24.2",
 			"ReleaseVersion":   "v0.13.0",
+			"SonobuoyVersion":  "0.56.16",
 			"DownloadDir":      "/opt/bin",
 			"PodSubnet":        "192.168.0.0/17",
 			"arm64": map[string]string{
@@ -232,6 +235,20 @@ func init() {
 						return version.LessThan(semver.Version{Major: 3034}) && platform == "esx"
 					},
 				})
+
+				if cgroupSuffix != "" {
+					continue
+				}
+				register.Register(&register.Test{
+					Name:             fmt.Sprintf("kubeadm.%s.%s.conformance", version, CNI),
+					Distros:          []string{"cl"},
+					ExcludePlatforms: []string{"qemu-unpriv"},
+					Run: func(c cluster.TestCluster) {
+						kubeadmConformanceTest(c, testParams)
+					},
+					MinVersion: semver.Version{Major: major},
+					Flags:      flags,
+				})
 			}
 		}
 	}
@@ -241,27 +258,14 @@ func init() {
 
 // kubeadmBaseTest asserts that the cluster is up and running
 func kubeadmBaseTest(c cluster.TestCluster, params map[string]interface{}) {
-	params["Arch"] = strings.SplitN(kola.QEMUOptions.Board, "-", 2)[0]
+	params["Arch"] = c.Architecture
 	kubectl, err := setup(c, params)
 	if err != nil {
 		c.Fatalf("unable to setup cluster: %v", err)
 	}
 
 	c.Run("node readiness", func(c cluster.TestCluster) {
-		// we let some times to the cluster to be fully booted
-		if err := util.Retry(10, 10*time.Second, func() error {
-			// notice the extra space before "Ready", it's to not catch
-			// "NotReady" nodes
-			out := c.MustSSH(kubectl, "/opt/bin/kubectl get nodes | grep \" Ready\"| wc -l")
-			readyNodesCnt := string(out)
-			if readyNodesCnt != "2" {
-				return fmt.Errorf("ready nodes should be equal to 2: %s", readyNodesCnt)
-			}
-
-			return nil
-		}); err != nil {
-			c.Fatalf("nodes are not ready: %v", err)
-		}
+		waitNodesReady(c, kubectl)
 	})
 	c.Run("nginx deployment", func(c cluster.TestCluster) {
 		// nginx manifest has been deployed through ignition
@@ -298,6 +302,24 @@ func kubeadmBaseTest(c cluster.TestCluster, params map[string]interface{}) {
 	}
 }
 
+// waitNodesReady waits for the master and the worker node to be ready.
+func waitNodesReady(c cluster.TestCluster, kubectl platform.Machine) {
+	// we let some times to the cluster to be fully booted
+	if err := util.Retry(10, 10*time.Second, func() error {
+		// notice the extra space before "Ready", it's to not catch
+		// "NotReady" nodes
+		out := c.MustSSH(kubectl, "/opt/bin/kubectl get nodes | grep \" Ready\"| wc -l")
+		readyNodesCnt := string(out)
+		if readyNodesCnt != "2" {
+			return fmt.Errorf("ready nodes should be equal to 2: %s", readyNodesCnt)
+		}
+
+		return nil
+	}); err != nil {
+		c.Fatalf("nodes are not ready: %v", err)
+	}
+}
+
 // render takes care of template rendering
 // using `b` parameter, we can render in a base64 encoded format
 func render(s string, p map[string]interface{}, b bool) (*bytes.Buffer, error) {
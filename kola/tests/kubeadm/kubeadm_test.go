@@ -119,3 +119,21 @@ func TestRenderTemplate(t *testing.T) {
 		}
 	})
 }
+
+func TestParseConformanceResults(t *testing.T) {
+	out := []byte(`{"name":"[sig-network] DNS should provide DNS for services  [Conformance]","status":"passed","meta":{"path":"e2e|junit_01.xml"}}
+{"name":"[sig-storage] Volumes should be mountable","status":"skipped","meta":{"path":"e2e|junit_01.xml"}}
+
+{"name":"[sig-apps] Job should run a job to completion [Conformance]","status":"failed","meta":{"path":"e2e|junit_01.xml"},"details":{"failure":"timed out","system-out":"..."}}
+`)
+	results, err := parseConformanceResults(out)
+	require.Nil(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "passed", results[0].Status)
+	assert.Equal(t, "skipped", results[1].Status)
+	assert.Equal(t, "[sig-apps] Job should run a job to completion [Conformance]", results[2].Name)
+	assert.Equal(t, "timed out", results[2].Details.Failure)
+
+	_, err = parseConformanceResults([]byte("not json\n"))
+	assert.NotNil(t, err)
+}
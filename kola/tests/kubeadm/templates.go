@@ -483,5 +483,27 @@ systemctl start --quiet coreos-metadata
 ipv4=$(cat /run/metadata/flatcar | grep -v -E '(IPV6|GATEWAY)' | grep IP | grep -E '(PRIVATE|LOCAL|DYNAMIC)' | cut -d = -f 2)
 
 kubeadm join --config worker-config.yaml --node-name "${ipv4}"
+`
+
+	// sonobuoyScript installs sonobuoy on the controller, the download is
+	// verified with the checksums of the release.
+	sonobuoyScript = `#!/bin/bash
+set -euo pipefail
+
+export DOWNLOAD_DIR={{ .DownloadDir }}
+cd "$(mktemp -d)"
+
+for file in sonobuoy_{{ .SonobuoyVersion }}_linux_{{ .Arch }}.tar.gz sonobuoy_{{ .SonobuoyVersion }}_checksums.txt; do
+    curl --retry-delay 1 \
+        --retry 60 \
+        --retry-connrefused \
+        --retry-max-time 60 \
+        --connect-timeout 20 \
+        --fail \
+        -sSLO \
+        "https://github.com/vmware-tanzu/sonobuoy/releases/download/v{{ .SonobuoyVersion }}/${file}"
+done
+sha256sum --check --ignore-missing sonobuoy_{{ .SonobuoyVersion }}_checksums.txt
+tar --extract --file sonobuoy_{{ .SonobuoyVersion }}_linux_{{ .Arch }}.tar.gz --directory "${DOWNLOAD_DIR}" --no-same-owner sonobuoy
 `
 )
@@ -40,54 +40,31 @@ func init() {
 	    }
 	}`)
 
-	register.Register(&register.Test{
-		Name:        "cl.metadata.aws",
-		Run:         verifyAWS,
+	register.RegisterOEMVariants(&register.Test{
+		Name:        "cl.metadata",
 		ClusterSize: 1,
-		Platforms:   []string{"aws"},
 		UserData:    enableMetadataService,
 		Distros:     []string{"cl"},
+	}, verify, register.OEMVariant{
+		Platform: "aws",
+		Metadata: []string{"COREOS_EC2_IPV4_LOCAL", "COREOS_EC2_IPV4_PUBLIC", "COREOS_EC2_HOSTNAME"},
+	}, register.OEMVariant{
+		Platform: "azure",
+		// kola tests do not spawn machines behind a load balancer on Azure
+		// which is required for COREOS_AZURE_IPV4_VIRTUAL to be present
+		Metadata: []string{"COREOS_AZURE_IPV4_DYNAMIC"},
+	}, register.OEMVariant{
+		Platform: "equinixmetal",
+		Metadata: []string{"COREOS_PACKET_HOSTNAME", "COREOS_PACKET_PHONE_HOME_URL", "COREOS_PACKET_IPV4_PUBLIC_0", "COREOS_PACKET_IPV4_PRIVATE_0", "COREOS_PACKET_IPV6_PUBLIC_0"},
 	})
-
-	register.Register(&register.Test{
-		Name:        "cl.metadata.azure",
-		Run:         verifyAzure,
-		ClusterSize: 1,
-		Platforms:   []string{"azure"},
-		UserData:    enableMetadataService,
-		Distros:     []string{"cl"},
-	})
-
-	register.Register(&register.Test{
-		Name:        "cl.metadata.equinixmetal",
-		Run:         verifyEquinixMetal,
-		ClusterSize: 1,
-		Platforms:   []string{"equinixmetal"},
-		UserData:    enableMetadataService,
-		Distros:     []string{"cl"},
-	})
-}
-
-func verifyAWS(c cluster.TestCluster) {
-	verify(c, "COREOS_EC2_IPV4_LOCAL", "COREOS_EC2_IPV4_PUBLIC", "COREOS_EC2_HOSTNAME")
-}
-
-func verifyAzure(c cluster.TestCluster) {
-	verify(c, "COREOS_AZURE_IPV4_DYNAMIC")
-	// kola tests do not spawn machines behind a load balancer on Azure
-	// which is required for COREOS_AZURE_IPV4_VIRTUAL to be present
-}
-
-func verifyEquinixMetal(c cluster.TestCluster) {
-	verify(c, "COREOS_PACKET_HOSTNAME", "COREOS_PACKET_PHONE_HOME_URL", "COREOS_PACKET_IPV4_PUBLIC_0", "COREOS_PACKET_IPV4_PRIVATE_0", "COREOS_PACKET_IPV6_PUBLIC_0")
 }
 
-func verify(c cluster.TestCluster, keys ...string) {
+func verify(c cluster.TestCluster, v register.OEMVariant) {
 	m := c.Machines()[0]
 
 	out := c.MustSSH(m, "cat /run/metadata/coreos")
 
-	for _, key := range keys {
+	for _, key := range v.Metadata {
 		if !strings.Contains(string(out), key) {
 			c.Errorf("%q wasn't found in %q", key, string(out))
 		}
@@ -16,10 +16,12 @@ package misc
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform/conf"
 )
 
 func init() {
@@ -33,6 +35,23 @@ func init() {
 		MinVersion: semver.Version{Major: 1828},
 		Distros:    []string{"cl", "rhcos"},
 	})
+	register.Register(&register.Test{
+		Name:        "cl.aws.imdsv2",
+		Platforms:   []string{"aws"},
+		Run:         awsVerifyIMDSv2,
+		ClusterSize: 1,
+		Flags:       []register.Flag{register.RequireIMDSv2},
+		Distros:     []string{"cl"},
+		UserData: conf.Butane(`---
+variant: flatcar
+version: 1.0.0
+storage:
+  files:
+  - path: /etc/kola-imdsv2
+    contents:
+      inline: ignition
+`),
+	})
 }
 
 // Check invariants on AWS instances.
@@ -41,3 +60,23 @@ func awsVerifyDiskFriendlyName(c cluster.TestCluster) {
 	friendlyName := "/dev/xvda"
 	c.MustSSH(c.Machines()[0], fmt.Sprintf("stat %s", friendlyName))
 }
+
+// Check that Ignition and coreos-metadata work on instances which only
+// allow IMDSv2, i.e. require session tokens for the metadata service.
+func awsVerifyIMDSv2(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	// the config was fetched from the metadata service by Ignition
+	c.AssertCmdOutputContains(m, "cat /etc/kola-imdsv2", "ignition")
+
+	code := c.MustSSH(m, `curl -s -o /dev/null -w '%{http_code}' http://169.254.169.254/latest/meta-data/instance-id`)
+	if string(code) != "401" {
+		c.Fatalf("IMDSv1 request returned %s instead of 401, the instance allows IMDSv1", code)
+	}
+
+	c.MustSSH(m, "sudo systemctl start coreos-metadata.service")
+	metadata := string(c.MustSSH(m, "cat /run/metadata/flatcar"))
+	if !strings.Contains(metadata, "COREOS_EC2_INSTANCE_ID="+m.ID()) {
+		c.Fatalf("coreos-metadata did not fetch the instance ID: %q", metadata)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+	"github.com/flatcar/mantle/platform/machine/unprivqemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         ClockFastForward,
+		ClusterSize: 0,
+		Name:        "cl.clock.fast-forward",
+		Distros:     []string{"cl"},
+		// The real-time clock is set with QEMU
+		Platforms: []string{"qemu", "qemu-unpriv"},
+	})
+}
+
+// the clock must not be synchronized before the test disables NTP
+var noNTPConfig = conf.ContainerLinuxConfig(`systemd:
+  units:
+    - name: systemd-timesyncd.service
+      mask: true`)
+
+// the machine starts in the future, before the year 2038 problem
+var rtcBase = time.Date(2037, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// Verify that a machine starts at the time of its real-time clock and that
+// fast-forwarding its clock runs the calendar timers elapsing in between.
+func ClockFastForward(c cluster.TestCluster) {
+	options := platform.MachineOptions{RTCBase: rtcBase}
+	var m platform.Machine
+	var err error
+	switch pc := c.Cluster.(type) {
+	case *qemu.Cluster:
+		m, err = pc.NewMachineWithOptions(noNTPConfig, options)
+	case *unprivqemu.Cluster:
+		m, err = pc.NewMachineWithOptions(noNTPConfig, options)
+	default:
+		c.Fatalf("unsupported cluster type %T", c.Cluster)
+	}
+	if err != nil {
+		c.Fatal(err)
+	}
+	util.DisableNTP(c, m)
+
+	if now := util.Clock(c, m); now.Before(rtcBase) || now.After(rtcBase.Add(time.Hour)) {
+		c.Fatalf("clock of the machine is at %v, expected shortly after %v", now, rtcBase)
+	}
+
+	// a daily timer counting how often it ran
+	c.MustSSH(m, `sudo systemd-run --unit kola-daily --on-calendar daily /bin/sh -c "echo >>/var/tmp/kola-daily"`)
+	util.FastForward(c, m, 3*24*time.Hour, 6*time.Hour)
+	if out := string(c.MustSSH(m, "wc -l </var/tmp/kola-daily")); out != "3" {
+		c.Fatalf("daily timer ran %s times in 3 days", out)
+	}
+
+	util.SetClock(c, m, rtcBase)
+	if now := util.Clock(c, m); now.Before(rtcBase) || now.After(rtcBase.Add(time.Minute)) {
+		c.Fatalf("clock of the machine is at %v after setting it to %v", now, rtcBase)
+	}
+}
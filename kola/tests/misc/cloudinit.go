@@ -54,6 +54,26 @@ chmod 600 ~core/.ssh/authorized_keys`),
 		// When cl.cloudinit.basic passed we don't need to run this on all clouds
 		Platforms: []string{"qemu", "qemu-unpriv"},
 	})
+	register.Register(&register.Test{
+		Run:         GenericCloudInitBasic,
+		ClusterSize: 1,
+		Name:        "cloudinit.basic",
+		UserData: conf.CloudConfig(`#cloud-config
+write_files:
+  - path: /etc/kola-foo
+    content: bar
+runcmd:
+  - [sh, -c, "echo done > /var/lib/kola-runcmd"]`),
+		Distros: []string{"debian", "ubuntu"},
+	})
+	register.Register(&register.Test{
+		Run:         GenericCloudInitReboot,
+		ClusterSize: 1,
+		Name:        "cloudinit.reboot",
+		Distros:     []string{"debian", "ubuntu"},
+		// rebooting doesn't depend on the cloud
+		Platforms: []string{"qemu", "qemu-unpriv"},
+	})
 }
 
 func CloudInitBasic(c cluster.TestCluster) {
@@ -78,3 +98,36 @@ func CloudInitScript(c cluster.TestCluster) {
 		c.Fatalf("userdata script produced unexpected value %q", out)
 	}
 }
+
+// GenericCloudInitBasic checks that cloud-init applied the cloud-config on
+// distributions provisioned by it.
+func GenericCloudInitBasic(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	c.AssertCmdOutputContains(m, "cloud-init status --long", "status: done")
+	if out := c.MustSSH(m, "cat /etc/kola-foo"); string(out) != "bar" {
+		c.Fatalf("write_files produced unexpected value %q", out)
+	}
+	if out := c.MustSSH(m, "cat /var/lib/kola-runcmd"); string(out) != "done" {
+		c.Fatalf("runcmd produced unexpected value %q", out)
+	}
+}
+
+// GenericCloudInitReboot checks that machines provisioned by cloud-init
+// come back after a reboot without running the config again.
+func GenericCloudInitReboot(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	bootID := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("rebooting: %v", err)
+	}
+	if out := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id"); string(out) == string(bootID) {
+		c.Fatalf("machine didn't reboot")
+	}
+	c.AssertCmdOutputContains(m, "cloud-init status --long", "status: done")
+	// the instance ID didn't change, so cloud-init didn't start over
+	if out := c.MustSSH(m, "ls /var/lib/cloud/instances | wc -l"); string(out) != "1" {
+		c.Fatalf("cloud-init ran for %s instances", out)
+	}
+}
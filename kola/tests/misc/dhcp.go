@@ -0,0 +1,131 @@
+// Copyright 2023 The Flatcar Maintainers.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/local"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+	"github.com/flatcar/mantle/util"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         NetworkDHCPOptions,
+		ClusterSize: 0,
+		Name:        "cl.network.dhcp-options",
+		Distros:     []string{"cl"},
+		// The DHCP server is only scriptable on the local cluster network
+		Platforms:        []string{"qemu"},
+		ExcludePlatforms: []string{"qemu-unpriv"},
+	})
+}
+
+// dhcpOptionsConfig makes networkd use all the options the test hands out,
+// some of them are not used by default.
+var dhcpOptionsConfig = conf.Butane(`---
+variant: flatcar
+version: 1.0.0
+storage:
+  files:
+    - path: /etc/systemd/network/00-dhcp.network
+      contents:
+        inline: |
+          [Match]
+          Name=eth*
+
+          [Network]
+          DHCP=yes
+
+          [DHCPv4]
+          UseMTU=true
+          UseDomains=true
+          UseRoutes=true
+`)
+
+// NetworkDHCPOptions verifies that networkd applies unusual DHCP options
+// and picks up changes to them when renewing a short lease.
+func NetworkDHCPOptions(c cluster.TestCluster) {
+	qc, ok := c.Cluster.(*qemu.Cluster)
+	if !ok {
+		c.Fatal("test only works in qemu")
+	}
+
+	route := local.ClasslessRoute{
+		Destination: net.IPNet{IP: net.IP{192, 168, 100, 0}, Mask: net.CIDRMask(24, 32)},
+		Gateway:     net.IP{10, 0, 0, 1},
+	}
+	opts := local.DHCPOptions{
+		MTU:             1400,
+		ClasslessRoutes: []local.ClasslessRoute{route},
+		SearchDomains:   []string{"kola.example.com"},
+		LeaseTime:       2 * time.Minute,
+	}
+
+	m, err := qc.NewMachineWithDHCPOptions(dhcpOptionsConfig, opts)
+	if err != nil {
+		c.Fatalf("couldn't start machine: %v", err)
+	}
+
+	c.Run("initial", func(c cluster.TestCluster) {
+		checkMTU(c, m, 1400)
+
+		out := string(c.MustSSH(m, "ip -4 route show 192.168.100.0/24"))
+		if !strings.Contains(out, "via 10.0.0.1") {
+			c.Errorf("classless route missing: %q", out)
+		}
+
+		out = string(c.MustSSH(m, "cat /run/systemd/resolve/resolv.conf"))
+		if !strings.Contains(out, "kola.example.com") {
+			c.Errorf("search domain missing: %q", out)
+		}
+	})
+
+	c.Run("renew", func(c cluster.TestCluster) {
+		opts.MTU = 1300
+		if err := qc.SetDHCPOptions(m, opts); err != nil {
+			c.Fatalf("changing DHCP options: %v", err)
+		}
+
+		// the lease is renewed after half of its lifetime
+		if err := util.Retry(20, 10*time.Second, func() error {
+			return getMTU(c, m, 1300)
+		}); err != nil {
+			c.Fatal(err)
+		}
+	})
+}
+
+func getMTU(c cluster.TestCluster, m platform.Machine, expected int) error {
+	out := strings.TrimSpace(string(c.MustSSH(m, "cat /sys/class/net/eth0/mtu")))
+	if out != fmt.Sprint(expected) {
+		return fmt.Errorf("expected MTU %d, got %s", expected, out)
+	}
+	return nil
+}
+
+func checkMTU(c cluster.TestCluster, m platform.Machine, expected int) {
+	if err := getMTU(c, m, expected); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.gce.shielded",
+		Platforms:   []string{"gce"},
+		Run:         gceVerifyShieldedVM,
+		ClusterSize: 1,
+		Flags:       []register.Flag{register.RequireTrustedLaunch},
+		Distros:     []string{"cl"},
+	})
+	register.Register(&register.Test{
+		Name:          "cl.gce.confidential",
+		Platforms:     []string{"gce"},
+		Architectures: []string{"amd64"},
+		Run:           gceVerifyConfidentialVM,
+		ClusterSize:   1,
+		Flags:         []register.Flag{register.RequireConfidentialVM},
+		Distros:       []string{"cl"},
+	})
+}
+
+// Check that a Shielded VM booted with Secure Boot and has a usable vTPM.
+func gceVerifyShieldedVM(c cluster.TestCluster) {
+	verifySecureBootAndTPM(c, c.Machines()[0])
+}
+
+// Check that a Confidential VM runs with SEV memory encryption on top of the
+// Shielded VM features.
+func gceVerifyConfidentialVM(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	verifySecureBootAndTPM(c, m)
+	verifyMemoryEncryption(c, m, "SEV")
+}
@@ -16,9 +16,14 @@ package misc
 
 import (
 	"bytes"
+	"strings"
 
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -42,8 +47,32 @@ func init() {
 		ExcludePlatforms: []string{"azure"},
 		// This should run on all clouds to test the relation of Ignition and cloudinit
 	})
+	register.Register(&register.Test{
+		Run:         InstallISO,
+		ClusterSize: 0,
+		Name:        "cl.install.iso",
+		Distros:     []string{"cl"},
+		// The live ISO is booted with QEMU, the installation covers
+		// bare metal
+		Platforms: []string{"qemu"},
+		SkipFunc: func(version semver.Version, channel, arch, platform string) bool {
+			return kola.QEMUOptions.LiveISO == "" || kola.QEMUOptions.InstallImage == ""
+		},
+	})
 }
 
+var installISOConfig = conf.Ignition(`{
+  "ignition": { "version": "2.0.0" },
+  "storage": {
+    "files": [{
+      "filesystem": "root",
+      "path": "/etc/kola-installed",
+      "contents": { "source": "data:,installed" },
+      "mode": 420
+    }]
+  }
+}`)
+
 // Simulate coreos-install features
 
 // Verify that the coreos-install cloud-config path is used
@@ -55,3 +84,22 @@ func InstallCloudConfig(c cluster.TestCluster) {
 		c.Fatalf("hostname: %q: %v", output, err)
 	}
 }
+
+// Verify that a system installed from the live ISO with flatcar-install
+// boots from the disk and is provisioned with the given Ignition config
+func InstallISO(c cluster.TestCluster) {
+	m := util.InstallFromISO(c, installISOConfig)
+
+	if output := c.MustSSH(m, "cat /etc/kola-installed"); string(output) != "installed" {
+		c.Fatalf("Ignition config not applied: /etc/kola-installed contains %q", output)
+	}
+	// the live system runs from RAM, the installed one from the disk
+	root := string(c.MustSSH(m, "findmnt --noheadings --output SOURCE /"))
+	disk := string(c.MustSSH(m, "readlink -f /dev/disk/by-id/virtio-primary-disk"))
+	if !strings.HasPrefix(root, disk) {
+		c.Fatalf("root filesystem on %s, not on the installation disk %s", root, disk)
+	}
+	util.AssertBootedUsr(c, m, "USR-A")
+	// the root filesystem is resized to the disk on the first boot
+	c.MustSSH(m, "test $(findmnt --noheadings --bytes --output SIZE /) -gt $((8 * 1024 * 1024 * 1024))")
+}
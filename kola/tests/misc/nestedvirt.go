@@ -0,0 +1,39 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.virt.nested",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Run:         nestedVirt,
+		ClusterSize: 1,
+		Flags:       []register.Flag{register.RequireNestedVirt},
+		Distros:     []string{"cl"},
+	})
+}
+
+// Check that the machine can run KVM guests, as needed by workloads like
+// KubeVirt and Kata Containers.
+func nestedVirt(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	c.MustSSH(m, `grep -qwE 'vmx|svm' /proc/cpuinfo`)
+	c.MustSSH(m, "sudo modprobe -a kvm_intel kvm_amd 2>/dev/null; test -c /dev/kvm")
+}
@@ -0,0 +1,87 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         NetbootPXE,
+		ClusterSize: 0,
+		Name:        "cl.boot.pxe",
+		Distros:     []string{"cl"},
+		// Netbooting is served from the local cluster network
+		Platforms: []string{"qemu"},
+		SkipFunc: func(version semver.Version, channel, arch, platform string) bool {
+			return kola.QEMUOptions.PXEKernel == "" || kola.QEMUOptions.PXEInitrd == ""
+		},
+	})
+}
+
+var netbootConfig = conf.Ignition(`{
+  "ignition": { "version": "2.0.0" },
+  "storage": {
+    "files": [{
+      "filesystem": "root",
+      "path": "/etc/kola-netbooted",
+      "contents": { "source": "data:,netbooted" },
+      "mode": 420
+    }]
+  }
+}`)
+
+// an additional kernel argument passed through the iPXE script
+const netbootArg = "kola.netboot=1"
+
+// Verify that a machine boots the PXE images with iPXE and is provisioned
+// with the Ignition config given on the kernel command line
+func NetbootPXE(c cluster.TestCluster) {
+	qc := c.Cluster.(*qemu.Cluster)
+	m, err := qc.NewMachineWithOptions(netbootConfig, platform.MachineOptions{
+		Netboot: &platform.Netboot{
+			Kernel:  kola.QEMUOptions.PXEKernel,
+			Initrd:  kola.QEMUOptions.PXEInitrd,
+			Cmdline: netbootArg,
+		},
+	})
+	if err != nil {
+		c.Fatalf("netbooting machine: %v", err)
+	}
+
+	cmdline := string(c.MustSSH(m, "cat /proc/cmdline"))
+	for _, arg := range []string{"ignition.config.url=", netbootArg} {
+		if !strings.Contains(cmdline, arg) {
+			c.Errorf("kernel command line %q is missing %q", cmdline, arg)
+		}
+	}
+	if output := c.MustSSH(m, "cat /etc/kola-netbooted"); string(output) != "netbooted" {
+		c.Fatalf("Ignition config not applied: /etc/kola-netbooted contains %q", output)
+	}
+	// PXE systems run from RAM
+	if fstype := string(c.MustSSH(m, "findmnt --noheadings --output FSTYPE /")); fstype != "tmpfs" {
+		c.Errorf("root filesystem is %s, expected tmpfs", fstype)
+	}
+}
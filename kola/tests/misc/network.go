@@ -16,6 +16,7 @@ package misc
 
 import (
 	"fmt"
+	"net"
 	"regexp"
 	"sort"
 	"strings"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
 	"github.com/flatcar/mantle/util"
 )
@@ -60,6 +62,19 @@ func init() {
 		ExcludePlatforms: []string{"do"},
 		Distros:          []string{"cl"},
 	})
+	register.Register(&register.Test{
+		Run:         networkIPv6,
+		ClusterSize: 2,
+		Name:        "cl.network.ipv6",
+		Distros:     []string{"cl"},
+		Flags:       []register.Flag{register.EnableIPv6},
+	})
+	register.Register(&register.Test{
+		Run:         networkDNS,
+		ClusterSize: 2,
+		Name:        "cl.network.dns",
+		Distros:     []string{"cl"},
+	})
 	register.Register(&register.Test{
 		MinVersion:  semver.Version{Major: 3185},
 		Run:         wireguard,
@@ -251,3 +266,64 @@ func wireguard(c cluster.TestCluster) {
 	m := c.Machines()[0]
 	c.AssertCmdOutputContains(m, `ip --json address show kv0 | jq -r '.[] | .addr_info | .[] | select( .family == "inet") | .local'`, "10.100.0.2")
 }
+
+// networkIPv6 checks that the machines configured the IPv6 addresses the
+// platform reports and reach each other over IPv6.
+func networkIPv6(c cluster.TestCluster) {
+	m1, m2 := c.Machines()[0], c.Machines()[1]
+	if m1.PrivateIPv6() == "" || m2.PrivateIPv6() == "" {
+		c.Skip("the platform assigned no IPv6 addresses")
+	}
+
+	for _, m := range c.Machines() {
+		addr := net.ParseIP(m.PrivateIPv6()).String()
+		// the address may still be waiting for a router advertisement
+		if err := util.Retry(30, time.Second, func() error {
+			_, err := c.SSH(m, fmt.Sprintf("ip -6 -o addr show scope global | grep -qF ' %s/'", addr))
+			return err
+		}); err != nil {
+			c.Fatalf("%s does not have the IPv6 address %s: %v", m.ID(), addr, err)
+		}
+	}
+
+	c.MustSSH(m1, "ping -6 -c 1 -W 10 "+m2.PrivateIPv6())
+}
+
+// networkDNS checks that the names of the cluster resolve on its machines
+// and follow changes.
+func networkDNS(c cluster.TestCluster) {
+	m1, m2 := c.Machines()[0], c.Machines()[1]
+	name := c.DNSName("peer")
+
+	resolves := func(addr string) {
+		if err := util.Retry(15, time.Second, func() error {
+			out, err := c.SSH(m1, "getent hosts "+name)
+			if addr == "" {
+				if err == nil {
+					return fmt.Errorf("%s still resolves to %q", name, out)
+				}
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("resolving %s: %v", name, err)
+			}
+			if fields := strings.Fields(string(out)); len(fields) == 0 || fields[0] != addr {
+				return fmt.Errorf("%s resolves to %q, expected %s", name, out, addr)
+			}
+			return nil
+		}); err != nil {
+			c.Fatal(err)
+		}
+	}
+
+	for _, m := range []platform.Machine{m2, m1} {
+		if err := c.SetDNSRecord("peer", m.PrivateIP()); err != nil {
+			c.Fatalf("setting %s: %v", name, err)
+		}
+		resolves(m.PrivateIP())
+	}
+	if err := c.SetDNSRecord("peer"); err != nil {
+		c.Fatalf("removing %s: %v", name, err)
+	}
+	resolves("")
+}
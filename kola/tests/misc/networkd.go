@@ -0,0 +1,97 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.network.virtual-interfaces",
+		Run:         virtualInterfaces,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+	register.Register(&register.Test{
+		Name:        "cl.network.isolated-networks",
+		Run:         isolatedNetworks,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+}
+
+// Check that the bonds, VLANs and bridges of the conf helpers come up,
+// on machines with additional network interfaces. The primary interface
+// keeps its default configuration for SSH.
+func virtualInterfaces(c cluster.TestCluster) {
+	userdata := conf.ContainerLinuxConfig("").
+		AddBond("bond0", "active-backup", []string{"eth1", "eth2"}, "Address=192.168.100.2/24").
+		AddVLAN("vlan10", "bond0", 10, "Address=192.168.10.2/24").
+		AddBridge("kola-br0", []string{"eth3"}, "Address=192.168.200.2/24")
+
+	m, err := c.Cluster.(*qemu.Cluster).NewMachineWithOptions(userdata, platform.MachineOptions{
+		AdditionalNICs: 3,
+	})
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	c.MustSSH(m, "grep -qx 'Bonding Mode: fault-tolerance (active-backup)' /proc/net/bonding/bond0")
+	c.MustSSH(m, "grep -qx 'Slave Interface: eth1' /proc/net/bonding/bond0")
+	c.MustSSH(m, "grep -qx 'Slave Interface: eth2' /proc/net/bonding/bond0")
+	c.MustSSH(m, "ip -detail link show vlan10 | grep -q 'vlan protocol 802.1Q id 10'")
+	c.MustSSH(m, "ip -brief address show vlan10 | grep -qF 192.168.10.2/24")
+	c.MustSSH(m, "test -e /sys/class/net/kola-br0/brif/eth3")
+	c.MustSSH(m, "ip -brief address show kola-br0 | grep -qF 192.168.200.2/24")
+}
+
+// Check that machines sharing isolated networks reach each other on
+// them, also over a VLAN, and that machines on another isolated network
+// with the same addresses don't.
+func isolatedNetworks(c cluster.TestCluster) {
+	qc := c.Cluster.(*qemu.Cluster)
+	newMachine := func(host int, networks ...string) platform.Machine {
+		userdata := conf.ContainerLinuxConfig("").
+			AddNetwork("eth1", fmt.Sprintf("Address=192.168.100.%d/24", host)).
+			AddNetwork("eth2").
+			AddVLAN("vlan20", "eth2", 20, fmt.Sprintf("Address=192.168.20.%d/24", host))
+		m, err := qc.NewMachineWithOptions(userdata, platform.MachineOptions{
+			Networks: networks,
+		})
+		if err != nil {
+			c.Fatal(err)
+		}
+		return m
+	}
+
+	m1 := newMachine(1, "storage", "trunk")
+	newMachine(2, "storage", "trunk")
+	m3 := newMachine(3, "other", "other-trunk")
+
+	c.MustSSH(m1, "ping -c 3 -W 5 192.168.100.2")
+	c.MustSSH(m1, "ping -c 3 -W 5 192.168.20.2")
+	if _, err := c.SSH(m3, "ping -c 3 -W 5 192.168.100.1"); err == nil {
+		c.Fatal("machine on another network reached 192.168.100.1")
+	}
+}
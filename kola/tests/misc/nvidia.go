@@ -0,0 +1,41 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.nvidia.driver",
+		Platforms:   []string{"aws", "azure", "gce"},
+		Run:         nvidiaDriver,
+		ClusterSize: 1,
+		Flags:       []register.Flag{register.RequireGPU},
+		Distros:     []string{"cl"},
+		UserData:    util.NvidiaUserData,
+	})
+}
+
+// Check that the NVIDIA driver extension loads and finds the GPU of the
+// instance.
+func nvidiaDriver(c cluster.TestCluster) {
+	for _, gpu := range util.VerifyNvidiaDriver(c, c.Machines()[0]) {
+		c.Log(gpu)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
+)
+
+const rebootStressCycles = 10
+
+func init() {
+	register.Register(&register.Test{
+		Run:         RebootStress,
+		ClusterSize: 1,
+		Name:        "cl.reboot.stress",
+		Distros:     []string{"cl"},
+		// Boot races are not specific to the cloud environment
+		Platforms: []string{"qemu", "qemu-unpriv"},
+	})
+}
+
+// RebootStress reboots the machine several times to catch intermittent
+// boot failures that a single boot may not show.
+func RebootStress(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	machineID := strings.TrimSpace(string(c.MustSSH(m, "cat /etc/machine-id")))
+
+	util.RebootLoop(c, m, rebootStressCycles, func(cycle int) error {
+		if id := strings.TrimSpace(string(c.MustSSH(m, "cat /etc/machine-id"))); id != machineID {
+			return fmt.Errorf("machine ID changed from %q to %q", machineID, id)
+		}
+		// fails if the boot did not finish
+		out, stderr, err := m.SSH("systemd-analyze time")
+		if err != nil {
+			return fmt.Errorf("systemd-analyze time failed: %s: %v: %s", out, err, stderr)
+		}
+		c.Logf("cycle %d: %s", cycle, strings.SplitN(string(out), "\n", 2)[0])
+		return nil
+	})
+}
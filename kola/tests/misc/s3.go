@@ -0,0 +1,52 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         S3Fixture,
+		ClusterSize: 2,
+		Name:        "cl.s3.fixture",
+		Distros:     []string{"cl"},
+		// the fixture is independent of the cloud environment
+		Platforms: []string{"qemu"},
+	})
+}
+
+// S3Fixture checks that a machine can store and fetch objects on the S3
+// fixture served by another machine, using the injected credentials.
+func S3Fixture(c cluster.TestCluster) {
+	server, client := c.Machines()[0], c.Machines()[1]
+
+	s3 := util.StartS3Fixture(c, server)
+	s3.InjectCredentials(c, client)
+
+	// curl signs the requests itself, no S3 client is needed on the machine
+	curl := `. /etc/kola/s3.env && curl -sf --aws-sigv4 "aws:amz:${AWS_DEFAULT_REGION}:s3" --user "${AWS_ACCESS_KEY_ID}:${AWS_SECRET_ACCESS_KEY}"`
+	c.MustSSH(client, `echo kola-object > /tmp/object && `+curl+` -T /tmp/object "${S3_ENDPOINT}/${S3_BUCKET}/object"`)
+
+	out := c.MustSSH(client, curl+` "${S3_ENDPOINT}/${S3_BUCKET}/object"`)
+	if strings.TrimSpace(string(out)) != "kola-object" {
+		c.Fatalf("unexpected object contents: %q", out)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// secureBootVar is the EFI variable holding the Secure Boot state; its last
+// byte is 1 when Secure Boot is enabled.
+const secureBootVar = "/sys/firmware/efi/efivars/SecureBoot-8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// verifySecureBootAndTPM checks that the machine booted with Secure Boot
+// and has a usable TPM.
+func verifySecureBootAndTPM(c cluster.TestCluster, m platform.Machine) {
+	c.MustSSH(m, "test -c /dev/tpmrm0")
+	state := strings.Fields(string(c.MustSSH(m, "od -An -t u1 "+secureBootVar)))
+	if len(state) == 0 || state[len(state)-1] != "1" {
+		c.Fatalf("Secure Boot is not enabled: %v", state)
+	}
+}
+
+// verifyMemoryEncryption checks that the kernel enabled the given AMD
+// memory encryption feature, e.g. "SEV" or "SEV-SNP".
+func verifyMemoryEncryption(c cluster.TestCluster, m platform.Machine, feature string) {
+	out := string(c.MustSSH(m, "dmesg | grep 'Memory Encryption Features active'"))
+	for _, f := range strings.Fields(out) {
+		if f == feature {
+			return
+		}
+	}
+	c.Fatalf("memory encryption feature %s is not active: %q", feature, out)
+}
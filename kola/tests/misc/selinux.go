@@ -30,6 +30,7 @@ func init() {
 		ClusterSize: 1,
 		Name:        "coreos.selinux.enforce",
 		Distros:     []string{"cl", "fcos", "rhcos"},
+		SELinuxMode: platform.SELinuxEnforcing,
 		// This test is normally not related to the cloud environment
 		Platforms: []string{"qemu", "qemu-unpriv"},
 	})
@@ -15,16 +15,9 @@
 package misc
 
 import (
-	"fmt"
-	"regexp"
-	"time"
-
-	"golang.org/x/net/context"
-
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/tests/util"
-	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -86,7 +79,7 @@ func RebootIntoUSRB(c cluster.TestCluster) {
 	// copy kernel
 	c.MustSSH(m, "sudo cp /boot/flatcar/vmlinuz-a /boot/flatcar/vmlinuz-b")
 
-	prioritizeUsr(c, m, "USR-B")
+	util.PrioritizeUsr(c, m, "USR-B")
 	if err := m.Reboot(); err != nil {
 		c.Fatalf("couldn't reboot: %v", err)
 	}
@@ -98,23 +91,11 @@ func RebootIntoUSRB(c cluster.TestCluster) {
 func RecoverBadVerity(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	skipUnlessVerity(c, m)
-
 	util.AssertBootedUsr(c, m, "USR-A")
 
-	// copy USR-A to USR-B
-	c.MustSSH(m, "sudo dd if=/dev/disk/by-partlabel/USR-A of=/dev/disk/by-partlabel/USR-B bs=10M status=none")
-
-	// copy kernel
-	c.MustSSH(m, "sudo cp /boot/flatcar/vmlinuz-a /boot/flatcar/vmlinuz-b")
-
-	// invalidate verity hash on B kernel
-	c.MustSSH(m, fmt.Sprintf("sudo dd of=/boot/flatcar/vmlinuz-b bs=1 seek=%d count=64 conv=notrunc status=none <<<0000000000000000000000000000000000000000000000000000000000000000", getKernelVerityHashOffset(c)))
-
-	prioritizeUsr(c, m, "USR-B")
-	// rebootWithEmergencyShellTimeout also covers the kernel panic timeout of 1 minute before reboot
-	rebootWithEmergencyShellTimeout(c, m)
-	util.AssertBootedUsr(c, m, "USR-A")
+	r := util.NewUsrRollback(c, m)
+	r.StageBadVerity()
+	r.Verify()
 }
 
 // Verify that we reboot into the old image when the new image is an
@@ -124,47 +105,7 @@ func RecoverBadUsr(c cluster.TestCluster) {
 
 	util.AssertBootedUsr(c, m, "USR-A")
 
-	// create filesystem for USR-B
-	c.MustSSH(m, "sudo mkfs.ext4 -q -b 4096 /dev/disk/by-partlabel/USR-B 25600")
-
-	// create verity metadata for USR-B
-	output := c.MustSSH(m, "sudo veritysetup format --hash=sha256 "+
-		"--data-block-size 4096 --hash-block-size 4096 --data-blocks 25600 --hash-offset 104857600 "+
-		"/dev/disk/by-partlabel/USR-B /dev/disk/by-partlabel/USR-B")
-
-	// extract root hash for USR-B
-	match := regexp.MustCompile("\nRoot hash:\\s+([0-9a-f]+)").FindSubmatch(output)
-	if match == nil {
-		c.Fatalf("Couldn't obtain new root hash; output %s", output)
-	}
-	verityHash := match[1]
-
-	// copy kernel
-	c.MustSSH(m, "sudo cp /boot/flatcar/vmlinuz-a /boot/flatcar/vmlinuz-b")
-
-	// update verity hash on B kernel
-	c.MustSSH(m, fmt.Sprintf("sudo dd of=/boot/flatcar/vmlinuz-b bs=1 seek=%d count=64 conv=notrunc status=none <<<%s", getKernelVerityHashOffset(c), verityHash))
-
-	prioritizeUsr(c, m, "USR-B")
-	rebootWithEmergencyShellTimeout(c, m)
-	util.AssertBootedUsr(c, m, "USR-A")
-}
-
-func prioritizeUsr(c cluster.TestCluster, m platform.Machine, usr string) {
-	c.MustSSH(m, "sudo cgpt repair /dev/disk/by-partlabel/"+usr)
-	c.MustSSH(m, "sudo cgpt add -S0 -T1 /dev/disk/by-partlabel/"+usr)
-	c.MustSSH(m, "sudo cgpt prioritize /dev/disk/by-partlabel/"+usr)
-}
-
-// reboot, waiting extra-long for the 5-minute emergency shell timeout
-func rebootWithEmergencyShellTimeout(c cluster.TestCluster, m platform.Machine) {
-	// reboot; wait extra 5 minutes; check machine
-	// this defeats some of the machinery in m.Reboot()
-	if err := platform.StartReboot(m); err != nil {
-		c.Fatal(err)
-	}
-	time.Sleep(5 * time.Minute)
-	if err := platform.CheckMachine(context.TODO(), m); err != nil {
-		c.Fatal(err)
-	}
+	r := util.NewUsrRollback(c, m)
+	r.StageBadUsr()
+	r.Verify()
 }
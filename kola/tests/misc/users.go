@@ -19,6 +19,7 @@ import (
 
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform/conf"
 )
 
 func init() {
@@ -31,6 +32,22 @@ func init() {
 		// This test is normally not related to the cloud environment
 		Platforms: []string{"qemu", "qemu-unpriv"},
 	})
+	register.Register(&register.Test{
+		Run:         CheckRunAsUser,
+		ClusterSize: 1,
+		Name:        "cl.users.run-as-user",
+		Distros:     []string{"cl"},
+		// RunAsUser needs an Ignition v3 config
+		UserData: conf.Butane(`---
+variant: flatcar
+version: 1.0.0`),
+		RunAsUser: &conf.User{
+			Name:   "tester",
+			Groups: []string{"docker"},
+		},
+		// This test is normally not related to the cloud environment
+		Platforms: []string{"qemu", "qemu-unpriv"},
+	})
 }
 
 func CheckUserShells(c cluster.TestCluster) {
@@ -72,3 +89,29 @@ func CheckUserShells(c cluster.TestCluster) {
 		c.Fatalf("Invalid users: %v", badusers)
 	}
 }
+
+// Verify that commands of tests with a RunAsUser run in a login session of
+// the unprivileged user
+func CheckRunAsUser(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	if user := string(c.MustSSHAsUser(m, "id -un")); user != "tester" {
+		c.Fatalf("commands run as %q, expected tester", user)
+	}
+	groups := strings.Fields(string(c.MustSSHAsUser(m, "id -Gn")))
+	hasDocker := false
+	for _, group := range groups {
+		if group == "sudo" || group == "wheel" {
+			c.Errorf("unprivileged user is in group %s", group)
+		}
+		hasDocker = hasDocker || group == "docker"
+	}
+	if !hasDocker {
+		c.Errorf("user is not in the docker group: %v", groups)
+	}
+	// rootless containers need the runtime directory of the session
+	c.MustSSHAsUser(m, `test -d "$XDG_RUNTIME_DIR"`)
+	if _, err := c.SSHAsUser(m, "sudo -n true"); err == nil {
+		c.Errorf("unprivileged user can use sudo")
+	}
+}
@@ -15,16 +15,13 @@
 package misc
 
 import (
-	"bytes"
 	"fmt"
 	"strings"
 
 	"github.com/coreos/go-semver/semver"
-	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/tests/util"
-	"github.com/flatcar/mantle/platform"
 )
 
 func init() {
@@ -57,7 +54,7 @@ func VerityVerify(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
 	// get offset of verity hash within kernel
-	rootOffset := getKernelVerityHashOffset(c)
+	rootOffset := util.KernelVerityHashOffset(c)
 
 	// extract verity hash from kernel
 	ddcmd := fmt.Sprintf("dd if=/boot/flatcar/vmlinuz-a skip=%d count=64 bs=1 status=none", rootOffset)
@@ -77,7 +74,7 @@ func VerityVerify(c cluster.TestCluster) {
 func VerityCorruption(c cluster.TestCluster) {
 	m := c.Machines()[0]
 	// skip unless we are actually using verity
-	skipUnlessVerity(c, m)
+	util.SkipUnlessVerity(c, m)
 
 	// assert that dm shows verity is in use and the device is valid (V)
 	out := c.MustSSH(m, "sudo dmsetup --target verity status usr")
@@ -111,23 +108,3 @@ func VerityCorruption(c cluster.TestCluster) {
 	}
 	// machine will now reboot in a loop but never be reachable again because the only partition it has got corrupted
 }
-
-// get offset of verity hash within kernel
-func getKernelVerityHashOffset(c cluster.TestCluster) int {
-	// the QEMUOptions.Board is also used by other platforms
-	if kola.QEMUOptions.Board == "arm64-usr" {
-		return 512
-	}
-	return 64
-}
-
-func skipUnlessVerity(c cluster.TestCluster, m platform.Machine) {
-	// figure out if we are actually using verity
-	out, err := c.SSH(m, "sudo veritysetup status usr")
-	if err != nil && bytes.Equal(out, []byte("/dev/mapper/usr is inactive.")) {
-		// verity not in use, so skip.
-		c.Skip("verity is not enabled")
-	} else if err != nil {
-		c.Fatalf("failed checking verity status: %s: %v", out, err)
-	}
-}
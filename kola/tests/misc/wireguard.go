@@ -0,0 +1,48 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/platform"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.network.wireguard.overlay",
+		Run:         wireGuardOverlay,
+		ClusterSize: 2,
+		Distros:     []string{"cl"},
+	})
+}
+
+// Check that the machines reach each other and the kola host over the
+// WireGuard overlay of --wireguard-subnet.
+func wireGuardOverlay(c cluster.TestCluster) {
+	m1, m2 := c.Machines()[0], c.Machines()[1]
+	w := m1.RuntimeConf().WireGuard
+	if w == nil {
+		c.Skip("no WireGuard overlay, see --wireguard-subnet")
+	}
+	for _, m := range []platform.Machine{m1, m2} {
+		c.MustSSH(m, fmt.Sprintf("ip -brief address show dev %s | grep -qF %s/", platform.WireGuardInterface, w.Address(m)))
+		c.MustSSH(m, fmt.Sprintf("ping -c 1 -W 5 %s", w.HostAddress()))
+	}
+	c.MustSSH(m1, fmt.Sprintf("ping -c 1 -W 5 %s", w.Address(m2)))
+	c.MustSSH(m2, fmt.Sprintf("ping -c 1 -W 5 %s", w.Address(m1)))
+}
@@ -0,0 +1,122 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package torcx
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/tests/util"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+func init() {
+	// The migration from the Docker of torcx to Docker sysext images,
+	// as documented for users, for images still shipping torcx
+	register.Register(&register.Test{
+		Name:        "torcx.migration.vendor-profile",
+		Run:         migrateToSysext,
+		ClusterSize: 1,
+		Distros:     []string{"cl"},
+		// This test is normally not related to the cloud environment
+		Platforms:  []string{"qemu", "qemu-unpriv"},
+		MinVersion: semver.Version{Major: 3185},
+		EndVersion: semver.Version{Major: 3794},
+		UserData: conf.ContainerLinuxConfig(`
+systemd:
+  units:
+  - name: docker.service
+    enable: true
+`),
+	})
+	register.Register(&register.Test{
+		Name:        "torcx.migration.user-profile",
+		Run:         migrateToSysext,
+		ClusterSize: 1,
+		Distros:     []string{"cl"},
+		// This test is normally not related to the cloud environment
+		Platforms:  []string{"qemu", "qemu-unpriv"},
+		MinVersion: semver.Version{Major: 3185},
+		EndVersion: semver.Version{Major: 3794},
+		UserData: conf.ContainerLinuxConfig(`
+storage:
+  files:
+  - path: /etc/torcx/profiles/kola-docker.json
+    contents:
+      inline: |
+        {
+          "kind": "profile-manifest-v0",
+          "value": {
+            "images": [
+              {
+                "name": "docker",
+                "reference": "com.coreos.cl"
+              }
+            ]
+          }
+        }
+  - path: /etc/torcx/next-profile
+    contents:
+      inline: kola-docker
+systemd:
+  units:
+  - name: docker.service
+    enable: true
+`),
+	})
+}
+
+// migrateToSysext starts Docker workloads with torcx, replaces torcx with
+// the Docker sysext images of the version of the image and checks that
+// the workloads survive a reboot.
+func migrateToSysext(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	c.MustSSH(m, "test -e /run/metadata/torcx")
+
+	// The image is served by kola to not depend on the availability of public registries
+	registry := util.StartRegistry(c)
+	defer registry.Close()
+	registry.Expose(c, m)
+	registry.PushBinaries(c, m, "workload", "sh", "cat", "sleep")
+	image := registry.Image("workload")
+
+	c.MustSSH(m, fmt.Sprintf(`docker run --rm -v kola-data:/data %s sh -c 'echo kola > /data/state'`, image))
+	c.MustSSH(m, fmt.Sprintf(`docker run -d --name kola-workload --restart always %s sleep infinity`, image))
+
+	// Disable torcx and install Docker as sysext images instead
+	c.MustSSH(m, `sudo mkdir -p /etc/systemd/system-generators && sudo touch /etc/systemd/system-generators/torcx-generator && sudo rm -f /etc/torcx/next-profile`)
+	util.InstallDockerSysexts(c, m, util.ImageDockerVersion(c, m))
+
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("could not reboot machine: %v", err)
+	}
+
+	c.MustSSH(m, "test ! -e /run/metadata/torcx")
+	c.MustSSH(m, "test -e /usr/lib/extension-release.d/extension-release.docker")
+	checkWorkloads(c, m, image)
+}
+
+// checkWorkloads checks that the container and volume created before the
+// migration are still around.
+func checkWorkloads(c cluster.TestCluster, m platform.Machine, image string) {
+	// docker.socket starts Docker, which restarts the container
+	c.AssertCmdOutputContains(m, `docker inspect -f '{{.State.Running}}' kola-workload`, "true")
+	c.AssertCmdOutputContains(m, fmt.Sprintf(`docker run --rm -v kola-data:/data %s cat /data/state`, image), "kola")
+}
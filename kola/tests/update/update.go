@@ -15,34 +15,25 @@
 package update
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"strings"
-	"time"
 
-	"github.com/coreos/go-omaha/omaha"
 	"github.com/coreos/go-semver/semver"
 
 	"github.com/flatcar/mantle/kola"
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	tutil "github.com/flatcar/mantle/kola/tests/util"
-	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
-	"github.com/flatcar/mantle/platform/local"
-	"github.com/flatcar/mantle/util"
 )
 
 func init() {
 	register.Register(&register.Test{
 		Name:        "cl.update.payload",
 		Run:         payload,
-		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"Omaha": Serve,
-		},
-		Distros: []string{"cl"},
+		ClusterSize: 0,
+		Distros:     []string{"cl"},
+		// the failing update at the end drops to the emergency shell
+		Flags: []register.Flag{register.NoEmergencyShellCheck},
 		// This test is normally not related to the cloud environment
 		Platforms: []string{"qemu", "qemu-unpriv"},
 		SkipFunc: func(version semver.Version, channel, arch, platform string) bool {
@@ -64,40 +55,20 @@ func init() {
 	})
 }
 
-func Serve() error {
-	omahaserver, err := omaha.NewTrivialServer(":34567")
-	if err != nil {
-		return fmt.Errorf("creating trivial omaha server: %v\n", err)
-	}
-
-	omahawrapper := local.OmahaWrapper{TrivialServer: omahaserver}
-
-	if err = omahawrapper.AddPackage("/updates/update.gz", "update.gz"); err != nil {
-		return fmt.Errorf("bad payload: %v", err)
-	}
-
-	return omahawrapper.Serve()
-}
-
 func payload(c cluster.TestCluster) {
-	addr := configureOmahaServer(c, c.Machines()[0])
+	srv := tutil.NewUpdateServer(c, kola.UpdatePayloadFile)
+	defer srv.Close()
 
-	// create the actual test machine, the machine
-	// that is created by the test registration is
-	// used to host the omaha server
 	m, err := c.NewMachine(nil)
 	if err != nil {
 		c.Fatalf("creating test machine: %v", err)
 	}
 
-	// Machines are intentionally configured post-boot
-	// via SSH to allow for testing versions which predate
-	// Ignition
-	configureMachineForUpdate(c, m, addr)
+	u := tutil.NewUpdater(c, m, srv.URL)
 
 	tutil.AssertBootedUsr(c, m, "USR-A")
 
-	updateMachine(c, m)
+	u.Update()
 
 	tutil.AssertBootedUsr(c, m, "USR-B")
 
@@ -111,119 +82,19 @@ func payload(c cluster.TestCluster) {
 		the SDK.)
 		We configure again to inject the dev-pub-key to correctly verify the downloaded payload
 	*/
-	configureMachineForUpdate(c, m, addr)
+	u.Configure()
 
-	updateMachine(c, m)
+	u.Update()
 
 	tutil.AssertBootedUsr(c, m, "USR-A")
-}
-
-func configureOmahaServer(c cluster.TestCluster, srv platform.Machine) string {
-	in, err := os.Open(kola.UpdatePayloadFile)
-	if err != nil {
-		c.Fatalf("opening update payload: %v", err)
-	}
-	defer in.Close()
-	if err := platform.InstallFile(in, srv, "/updates/update.gz"); err != nil {
-		c.Fatalf("copying update payload to omaha server: %v", err)
-	}
-
-	c.MustSSH(srv, fmt.Sprintf("sudo systemd-run --quiet ./kolet run %s Omaha", c.H.Name()))
-
-	err = util.WaitUntilReady(60*time.Second, 5*time.Second, func() (bool, error) {
-		_, _, err := srv.SSH(fmt.Sprintf("curl %s:34567", srv.PrivateIP()))
-		return err == nil, nil
-	})
-	if err != nil {
-		c.Fatal("timed out waiting for omaha server to become active")
-	}
-
-	return fmt.Sprintf("%s:34567", srv.PrivateIP())
-}
 
-func configureMachineForUpdate(c cluster.TestCluster, m platform.Machine, addr string) {
-	// update atomicly so nothing reading update.conf fails
-	c.MustSSH(m, fmt.Sprintf(`sudo bash -c "cat >/etc/coreos/update.conf.new <<EOF
-GROUP=developer
-SERVER=http://%s/v1/update
-EOF"`, addr))
-	c.MustSSH(m, "sudo mv /etc/coreos/update.conf{.new,}")
+	// both partitions hold the update now, going back to USR-B must work
+	u.Rollback()
 
-	// dev key
-	key := `-----BEGIN PUBLIC KEY-----
-MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzFS5uVJ+pgibcFLD3kbY
-k02Edj0HXq31ZT/Bva1sLp3Ysv+QTv/ezjf0gGFfASdgpz6G+zTipS9AIrQr0yFR
-+tdp1ZsHLGxVwvUoXFftdapqlyj8uQcWjjbN7qJsZu0Ett/qo93hQ5nHW7Sv5dRm
-/ZsDFqk2Uvyaoef4bF9r03wYpZq7K3oALZ2smETv+A5600mj1Xg5M52QFU67UHls
-EFkZphrGjiqiCdp9AAbAvE7a5rFcJf86YR73QX08K8BX7OMzkn3DsqdnWvLB3l3W
-6kvIuP+75SrMNeYAcU8PI1+bzLcAG3VN3jA78zeKALgynUNH50mxuiiU3DO4DZ+p
-5QIDAQAB
------END PUBLIC KEY-----`
-
-	if kola.ForceFlatcarKey {
-		// prod key
-		// https://github.com/flatcar/coreos-overlay/blob/flatcar-master/coreos-base/coreos-au-key/files/official-v2.pub.pem
-		key = `-----BEGIN PUBLIC KEY-----
-MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAw/NZ5Tvc93KynOLPDOxa
-hyAGRKB2NvgF9l2A61SsFw5CuZc/k02u1/BvFehK4XL/eOo90Dt8A2l28D/YKs7g
-2IPUSAnA9hc5OKBbpHsDzisxlAh7kg4FpeeJJWJMzO8NDCG5NZVqXEpGjCmX0qSh
-5MLiTDr9dU2YhLo93/92dKnTvsLjUVv5wnuF55Lt2wJv4CbxVn4hHwotGfSomTBO
-+7o6hE3VIIo1C6lkP+FAqMyWKA9s6U0x4tGxCXszW3hPWOANLIT4m0e55ayxiy5A
-ESEVW/xx6Rul75u925m21AqA6wwaEB6ZPKTnUiWoNKNv1xi8LPIz12+0nuE6iT1K
-jQIDAQAB
------END PUBLIC KEY-----`
-	}
-
-	// inject key
-	c.MustSSH(m, fmt.Sprintf(`sudo bash -c "cat >/etc/coreos/update-payload-key.pub.pem <<EOF
-%s
-EOF"`, key))
-
-	c.MustSSH(m, "sudo mount --bind /etc/coreos/update-payload-key.pub.pem /usr/share/update_engine/update-payload-key.pub.pem")
-
-	// disable reboot so the test has explicit control
-	c.MustSSH(m, "sudo systemctl mask --now locksmithd.service")
-	c.MustSSH(m, "sudo systemctl reset-failed locksmithd.service")
-
-	c.MustSSH(m, "sudo systemctl restart update-engine.service")
-}
-
-func updateMachine(c cluster.TestCluster, m platform.Machine) {
-	c.Logf("Triggering update_engine")
-
-	out, stderr, err := m.SSH("update_engine_client -check_for_update")
-	if err != nil {
-		c.Fatalf("Executing update_engine_client failed: %v: %v: %s", out, err, stderr)
-	}
-
-	err = util.WaitUntilReady(600*time.Second, 10*time.Second, func() (bool, error) {
-		envs, stderr, err := m.SSH("update_engine_client -status 2>/dev/null")
-		if err != nil {
-			return false, fmt.Errorf("checking status failed: %v: %s", err, stderr)
-		}
-
-		return splitNewlineEnv(string(envs))["CURRENT_OP"] == "UPDATE_STATUS_UPDATED_NEED_REBOOT", nil
-	})
-	if err != nil {
-		c.Fatalf("waiting for UPDATE_STATUS_UPDATED_NEED_REBOOT: %v", err)
-	}
-
-	c.Logf("Rebooting test machine")
-
-	if err = m.Reboot(); err != nil {
-		c.Fatalf("reboot failed: %v", err)
-	}
-}
-
-// splits newline-delimited KEY=VAL pairs into a map
-func splitNewlineEnv(envs string) map[string]string {
-	m := make(map[string]string)
-	sc := bufio.NewScanner(strings.NewReader(envs))
-	for sc.Scan() {
-		spl := strings.SplitN(sc.Text(), "=", 2)
-		m[spl[0]] = spl[1]
-	}
-	return m
+	// the updated release must fall back to itself after a failing update
+	r := tutil.NewUsrRollback(c, m)
+	r.StageBadUsr()
+	r.Verify()
 }
 
 func sysextBootLogic(c cluster.TestCluster) {
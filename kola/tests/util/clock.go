@@ -0,0 +1,72 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// DisableNTP stops synchronizing the clock of m, so it stays where
+// SetClock, ShiftClock or the RTCBase of a QEMU machine put it.
+func DisableNTP(c cluster.TestCluster, m platform.Machine) {
+	c.MustSSH(m, "sudo timedatectl set-ntp false")
+	// the alternatives to timesyncd are not known to timedatectl
+	c.MustSSH(m, "sudo systemctl stop ntpd.service chronyd.service 2>/dev/null || true")
+}
+
+// Clock returns the time of the clock of m, in seconds.
+func Clock(c cluster.TestCluster, m platform.Machine) time.Time {
+	out := c.MustSSH(m, "date +%s")
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		c.Fatalf("parsing the time of %s: %v", m.ID(), err)
+	}
+	return time.Unix(secs, 0)
+}
+
+// SetClock sets the clock of m to t. NTP must be disabled, see DisableNTP.
+func SetClock(c cluster.TestCluster, m platform.Machine, t time.Time) {
+	c.MustSSH(m, fmt.Sprintf("sudo date -s @%d", t.Unix()))
+}
+
+// ShiftClock moves the clock of m by d, which may be negative, in
+// seconds. NTP must be disabled, see DisableNTP.
+func ShiftClock(c cluster.TestCluster, m platform.Machine, d time.Duration) {
+	c.MustSSH(m, fmt.Sprintf(`sudo date -s "@$(( $(date +%%s) + %d ))"`, int64(d/time.Second)))
+}
+
+// FastForward moves the clock of m forward by d in steps of step, waiting
+// up to a minute for the jobs started by each step to finish. Calendar
+// timers elapsing in between, e.g. daily ones, thus run like they would in
+// real time, which is not the case for a single jump. Timers relative to
+// the boot or their activation use the monotonic clock and are not
+// affected. NTP must be disabled, see DisableNTP.
+func FastForward(c cluster.TestCluster, m platform.Machine, d, step time.Duration) {
+	for d > 0 {
+		if step > d {
+			step = d
+		}
+		ShiftClock(c, m, step)
+		d -= step
+		// give systemd a moment to queue the jobs of elapsed timers
+		c.MustSSH(m, "sleep 1; for i in $(seq 60); do systemctl list-jobs --no-legend | grep -q . || break; sleep 1; done")
+	}
+}
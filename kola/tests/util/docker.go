@@ -0,0 +1,190 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// ImageDockerVersion returns the version of Docker shipped with the
+// Flatcar image of m.
+func ImageDockerVersion(c cluster.TestCluster, m platform.Machine) string {
+	return string(c.MustSSH(m, `bzcat /usr/share/licenses/licenses.json.bz2 | grep -m 1 -o 'app-emulation/docker[^:]*' | cut -d - -f 3`))
+}
+
+const (
+	dockerSocketUnit = `[Unit]
+Description=Docker Socket for the API
+PartOf=docker.service
+
+[Socket]
+ListenStream=/var/run/docker.sock
+SocketMode=0660
+SocketUser=root
+SocketGroup=docker
+
+[Install]
+WantedBy=sockets.target
+`
+	dockerServiceUnit = `[Unit]
+Description=Docker Application Container Engine
+After=containerd.service docker.socket network-online.target
+Wants=network-online.target
+Requires=containerd.service docker.socket
+
+[Service]
+Type=notify
+ExecStart=/usr/bin/dockerd --host=fd:// --containerd=/run/containerd/containerd.sock
+ExecReload=/bin/kill -s HUP $MAINPID
+LimitNOFILE=1048576
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+TimeoutStartSec=0
+Delegate=yes
+KillMode=process
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+	containerdServiceUnit = `[Unit]
+Description=containerd container runtime
+After=network.target
+
+[Service]
+Delegate=yes
+ExecStartPre=/sbin/modprobe overlay
+ExecStart=/usr/bin/containerd
+KillMode=process
+Restart=always
+LimitNOFILE=1048576
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+
+[Install]
+WantedBy=multi-user.target
+`
+)
+
+// InstallDockerSysexts installs the static Docker binaries of version as
+// the docker and containerd sysext images, like the sysext-bakery does.
+func InstallDockerSysexts(c cluster.TestCluster, m platform.Machine, version string) {
+	dir, err := os.MkdirTemp("", "kola-docker-")
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	arch := "x86_64"
+	if c.Architecture == "arm64" {
+		arch = "aarch64"
+	}
+	url := fmt.Sprintf("https://download.docker.com/linux/static/stable/%s/docker-%s.tgz", arch, version)
+	c.Logf("Downloading %s", url)
+	binaries, err := extractURL(url, dir)
+	if err != nil {
+		c.Fatalf("downloading Docker %s: %v", version, err)
+	}
+
+	docker := &Sysext{
+		Name: "docker",
+		Arch: c.Architecture,
+		Files: map[string]SysextFile{
+			"usr/lib/systemd/system/docker.socket":  {Contents: dockerSocketUnit},
+			"usr/lib/systemd/system/docker.service": {Contents: dockerServiceUnit},
+			"usr/lib/systemd/system/sockets.target.d/10-docker-socket.conf": {
+				Contents: "[Unit]\nUpholds=docker.socket\n",
+			},
+		},
+	}
+	containerd := &Sysext{
+		Name: "containerd",
+		Arch: c.Architecture,
+		Files: map[string]SysextFile{
+			"usr/lib/systemd/system/containerd.service": {Contents: containerdServiceUnit},
+			"usr/lib/systemd/system/multi-user.target.d/10-containerd-service.conf": {
+				Contents: "[Unit]\nUpholds=containerd.service\n",
+			},
+		},
+	}
+	for _, b := range binaries {
+		name := filepath.Base(b)
+		s := docker
+		if strings.HasPrefix(name, "containerd") || name == "ctr" || name == "runc" {
+			s = containerd
+		}
+		s.Files["usr/bin/"+name] = SysextFile{Source: b}
+	}
+
+	InstallSysext(c, m, docker)
+	InstallSysext(c, m, containerd)
+}
+
+// extractURL extracts the regular files of the tar.gz archive at url to
+// dir and returns their paths.
+func extractURL(url, dir string) ([]string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		path := filepath.Join(dir, filepath.Base(hdr.Name))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+)
+
+var (
+	// the shell prompt of the automatic login on the console of the
+	// live system
+	livePrompt = regexp.MustCompile(`core@[^ ]+ [^ ]+ \$ $`)
+	// printed by the command sent by InstallFromISO once it finished,
+	// quoted so the echo of the typed command does not match
+	installResult = regexp.MustCompile(`install result: (\d+)`)
+	rebooting     = regexp.MustCompile(`reboot: Restarting system`)
+)
+
+// InstallFromISO installs Flatcar like on bare metal: it boots a QEMU
+// machine from the live ISO given by --qemu-iso, installs the image given
+// by --qemu-install-image to its blank disk with flatcar-install and the
+// Ignition config rendered from userdata, reboots and returns the machine
+// once the installed system is up.
+func InstallFromISO(c cluster.TestCluster, userdata *conf.UserData) platform.Machine {
+	if kola.QEMUOptions.LiveISO == "" || kola.QEMUOptions.InstallImage == "" {
+		c.Fatal("installing requires --qemu-iso and --qemu-install-image")
+	}
+	qc, ok := c.Cluster.(*qemu.Cluster)
+	if !ok {
+		c.Fatalf("installing from an ISO is not supported on %T", c.Cluster)
+	}
+
+	m, configURL, err := qc.NewLiveMachine(userdata, kola.QEMUOptions.LiveISO)
+	if err != nil {
+		c.Fatalf("booting the live ISO: %v", err)
+	}
+	imageURL, err := qc.ServeFile(m.ID()+"/flatcar_production_image.bin.bz2", kola.QEMUOptions.InstallImage)
+	if err != nil {
+		c.Fatalf("serving the install image: %v", err)
+	}
+
+	console, err := m.(platform.SerialConsoleMachine).SerialConsole()
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer console.Close()
+
+	if _, err := console.Expect(livePrompt, 5*time.Minute); err != nil {
+		c.Fatalf("waiting for the live system: %v", err)
+	}
+	c.Logf("Installing %s from %s", kola.QEMUOptions.InstallImage, kola.QEMUOptions.LiveISO)
+	// the image is downloaded to the tmpfs of the live system since
+	// flatcar-install only fetches signed images from release servers
+	install := fmt.Sprintf("curl -fsS -o /tmp/image.bin.bz2 %s && curl -fsS -o /tmp/ignition.json %s && "+
+		"sudo flatcar-install -d /dev/disk/by-id/virtio-primary-disk -f /tmp/image.bin.bz2 -i /tmp/ignition.json; "+
+		`echo "install ""result: $?"`, imageURL, configURL)
+	if err := console.SendLine(install); err != nil {
+		c.Fatal(err)
+	}
+	out, err := console.Expect(installResult, 15*time.Minute)
+	if err != nil {
+		c.Fatalf("waiting for flatcar-install: %v", err)
+	}
+	if status := installResult.FindStringSubmatch(out)[1]; status != "0" {
+		c.Fatalf("flatcar-install failed with status %s, see the console output", status)
+	}
+
+	c.Logf("Rebooting into the installed system")
+	if err := console.SendLine("sudo systemctl reboot"); err != nil {
+		c.Fatal(err)
+	}
+	// don't mistake the live system for the installed one
+	if _, err := console.Expect(rebooting, 5*time.Minute); err != nil {
+		c.Fatalf("waiting for the reboot: %v", err)
+	}
+	if err := qc.StartInstalledMachine(m); err != nil {
+		c.Fatalf("booting the installed system: %v", err)
+	}
+	return m
+}
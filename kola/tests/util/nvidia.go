@@ -0,0 +1,75 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/util"
+)
+
+// NvidiaDriverSysext is the Flatcar extension with the NVIDIA driver
+// enabled by NvidiaUserData.
+const NvidiaDriverSysext = "nvidia-drivers-535"
+
+// NvidiaUserData enables the NVIDIA driver extension, which Flatcar
+// downloads on the first boot.
+var NvidiaUserData = conf.Butane(`---
+variant: flatcar
+version: 1.0.0
+storage:
+  files:
+    - path: /etc/flatcar/enabled-sysext.conf
+      contents:
+        inline: |
+          ` + NvidiaDriverSysext + `
+`)
+
+// VerifyNvidiaDriver waits up to 10 minutes for the NVIDIA driver
+// extension to be merged and its kernel module to be loaded on m, checks
+// that nvidia-smi works and returns the GPUs it lists.
+func VerifyNvidiaDriver(c cluster.TestCluster, m platform.Machine) []string {
+	// the extension is downloaded and the module may be built first
+	if err := util.Retry(60, 10*time.Second, func() error {
+		if _, err := c.SSH(m, "systemd-sysext list --no-legend | grep -q nvidia-drivers"); err != nil {
+			return fmt.Errorf("the NVIDIA driver extension is not merged")
+		}
+		if _, err := c.SSH(m, "grep -q '^nvidia ' /proc/modules"); err != nil {
+			return fmt.Errorf("the nvidia kernel module is not loaded")
+		}
+		return nil
+	}); err != nil {
+		out, _ := c.SSH(m, "systemd-sysext status; systemctl --failed --no-legend")
+		c.Fatalf("%v: %s", err, out)
+	}
+
+	out := c.MustSSH(m, "nvidia-smi -L")
+	var gpus []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.HasPrefix(line, "GPU ") {
+			gpus = append(gpus, line)
+		}
+	}
+	if len(gpus) == 0 {
+		c.Fatalf("nvidia-smi lists no GPUs: %s", out)
+	}
+	c.MustSSH(m, "nvidia-smi")
+	return gpus
+}
@@ -0,0 +1,50 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// partitionChain is the iptables chain holding the partitions of a
+// machine.
+const partitionChain = "KOLA-PARTITION"
+
+// Partition cuts m off from peers: the traffic between m and their private
+// addresses is dropped in both directions with iptables on m. SSH from
+// kola keeps working. Heal removes the partitions of m.
+func Partition(c cluster.TestCluster, m platform.Machine, peers ...platform.Machine) {
+	cmds := []string{
+		fmt.Sprintf("{ sudo iptables -N %s 2>/dev/null || true; }", partitionChain),
+	}
+	for _, hook := range []string{"INPUT", "OUTPUT"} {
+		cmds = append(cmds, fmt.Sprintf("{ sudo iptables -C %[1]s -j %[2]s 2>/dev/null || sudo iptables -I %[1]s -j %[2]s; }", hook, partitionChain))
+	}
+	for _, p := range peers {
+		cmds = append(cmds,
+			fmt.Sprintf("sudo iptables -A %s -s %s -j DROP", partitionChain, p.PrivateIP()),
+			fmt.Sprintf("sudo iptables -A %s -d %s -j DROP", partitionChain, p.PrivateIP()))
+	}
+	c.MustSSH(m, strings.Join(cmds, " && "))
+}
+
+// Heal removes the partitions of m created by Partition.
+func Heal(c cluster.TestCluster, m platform.Machine) {
+	c.MustSSH(m, fmt.Sprintf("sudo iptables -F %s 2>/dev/null || true", partitionChain))
+}
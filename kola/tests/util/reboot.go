@@ -0,0 +1,118 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// RebootStats holds the durations of the reboot cycles done by RebootLoop,
+// measured from issuing the reboot until the machine passed all checks of
+// the cycle.
+type RebootStats struct {
+	Durations []time.Duration
+}
+
+// Min returns the shortest cycle.
+func (s RebootStats) Min() time.Duration {
+	return s.sorted()[0]
+}
+
+// Max returns the longest cycle.
+func (s RebootStats) Max() time.Duration {
+	d := s.sorted()
+	return d[len(d)-1]
+}
+
+// Median returns the median cycle duration.
+func (s RebootStats) Median() time.Duration {
+	d := s.sorted()
+	if len(d)%2 == 0 {
+		return (d[len(d)/2-1] + d[len(d)/2]) / 2
+	}
+	return d[len(d)/2]
+}
+
+// Mean returns the average cycle duration.
+func (s RebootStats) Mean() time.Duration {
+	var sum time.Duration
+	for _, d := range s.Durations {
+		sum += d
+	}
+	return sum / time.Duration(len(s.Durations))
+}
+
+func (s RebootStats) sorted() []time.Duration {
+	if len(s.Durations) == 0 {
+		return []time.Duration{0}
+	}
+	d := append([]time.Duration(nil), s.Durations...)
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return d
+}
+
+func (s RebootStats) String() string {
+	if len(s.Durations) == 0 {
+		return "no reboots"
+	}
+	return fmt.Sprintf("%d reboots: min %v, median %v, mean %v, max %v", len(s.Durations),
+		s.Min().Round(time.Millisecond), s.Median().Round(time.Millisecond),
+		s.Mean().Round(time.Millisecond), s.Max().Round(time.Millisecond))
+}
+
+// RebootLoop reboots the machine n times. After each boot and the basic
+// checks of the machine, e.g. for failed systemd units, it verifies that
+// the machine actually rebooted and then runs check, if given, with the
+// number of the cycle starting at 1. The test is failed on the first cycle
+// that does not pass, the timing statistics of the passed cycles are
+// logged and returned.
+func RebootLoop(c cluster.TestCluster, m platform.Machine, n int, check func(cycle int) error) RebootStats {
+	var stats RebootStats
+	defer func() {
+		c.Logf("%s", stats)
+	}()
+
+	bootID := getBootID(c, m)
+	for cycle := 1; cycle <= n; cycle++ {
+		start := time.Now()
+		if err := m.Reboot(); err != nil {
+			c.Fatalf("cycle %d/%d: reboot failed: %v", cycle, n, err)
+		}
+		newBootID := getBootID(c, m)
+		if newBootID == bootID {
+			c.Fatalf("cycle %d/%d: boot ID %s did not change, machine did not reboot", cycle, n, bootID)
+		}
+		bootID = newBootID
+
+		if check != nil {
+			if err := check(cycle); err != nil {
+				c.Fatalf("cycle %d/%d: %v", cycle, n, err)
+			}
+		}
+		stats.Durations = append(stats.Durations, time.Since(start))
+	}
+
+	return stats
+}
+
+func getBootID(c cluster.TestCluster, m platform.Machine) string {
+	return strings.TrimSpace(string(c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")))
+}
@@ -0,0 +1,264 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+const (
+	// RegistryAddr is where the machines reach the registry. Container
+	// runtimes pull from registries on the loopback interface without
+	// TLS.
+	RegistryAddr = "127.0.0.1:5000"
+
+	ociManifestType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// Registry is an ephemeral container registry served by kola, so tests
+// don't depend on the availability of public registries. Images are pushed
+// by the test and the machines pull them from RegistryAddr, forwarded to
+// kola through SSH, so it works on every platform.
+type Registry struct {
+	listener net.Listener
+	server   *http.Server
+
+	lock sync.Mutex
+	// blobs by digest
+	blobs map[string][]byte
+	// manifests by repository and tag or digest, e.g. "busybox:latest"
+	// and "busybox@sha256:..."
+	manifests map[string][]byte
+	forwards  []*platform.PortForward
+}
+
+// StartRegistry starts a registry on the host running kola. It must be
+// closed at the end of the test.
+func StartRegistry(c cluster.TestCluster) *Registry {
+	r, err := newRegistry()
+	if err != nil {
+		c.Fatalf("starting registry: %v", err)
+	}
+	return r
+}
+
+func newRegistry() (*Registry, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		listener:  listener,
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+	}
+	r.server = &http.Server{Handler: r}
+	go r.server.Serve(listener)
+	return r, nil
+}
+
+// Close stops the registry and the forwarding to the machines.
+func (r *Registry) Close() error {
+	r.lock.Lock()
+	for _, f := range r.forwards {
+		f.Close()
+	}
+	r.forwards = nil
+	r.lock.Unlock()
+	return r.server.Close()
+}
+
+// Expose makes the registry reachable at RegistryAddr on m.
+func (r *Registry) Expose(c cluster.TestCluster, m platform.Machine) {
+	f, err := platform.ForwardRemotePort(m, RegistryAddr, r.listener.Addr().String())
+	if err != nil {
+		c.Fatalf("forwarding the registry to %s: %v", m.ID(), err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.forwards = append(r.forwards, f)
+}
+
+// Image returns the reference of the image name, e.g. "busybox" or
+// "busybox:1", for the machines.
+func (r *Registry) Image(name string) string {
+	return RegistryAddr + "/" + name
+}
+
+// Push adds an image named name, e.g. "busybox" or "busybox:1", with a
+// single layer for the machine architecture arch. layer is an
+// uncompressed tar archive of the root file system of the image.
+func (r *Registry) Push(name, arch string, layer io.Reader) error {
+	repo, tag := name, "latest"
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		repo, tag = name[:i], name[i+1:]
+	}
+
+	var compressed bytes.Buffer
+	diffID := sha256.New()
+	zw := gzip.NewWriter(&compressed)
+	if _, err := io.Copy(io.MultiWriter(zw, diffID), layer); err != nil {
+		return fmt.Errorf("reading layer: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": arch,
+		"os":           "linux",
+		"config": map[string]interface{}{
+			"Env": []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+		},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{"sha256:" + hex.EncodeToString(diffID.Sum(nil))},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	layerDesc := r.addBlob(ociLayerType, compressed.Bytes())
+	configDesc := r.addBlob(ociConfigType, config)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociManifestType,
+		"config":        configDesc,
+		"layers":        []descriptor{layerDesc},
+	})
+	if err != nil {
+		return err
+	}
+	r.manifests[repo+":"+tag] = manifest
+	r.manifests[repo+"@"+digest(manifest)] = manifest
+	return nil
+}
+
+// PushBinaries pushes an image named name with the given binaries of m
+// and the libraries they need, like GenPodmanScratchContainer but without
+// a container runtime on m.
+func (r *Registry) PushBinaries(c cluster.TestCluster, m platform.Machine, name string, binaries ...string) {
+	client, err := m.SSHClient()
+	if err != nil {
+		c.Fatalf("SSH client: %v", err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		c.Fatalf("SSH session: %v", err)
+	}
+	defer session.Close()
+
+	// the paths are made relative to keep tar quiet, symlinks like
+	// /lib64 are followed so the image has no dangling links
+	cmd := fmt.Sprintf(`set -e -o pipefail; bins=$(which %s); `+
+		`for p in $bins $(ldd $bins | grep -o '/[^ ]*' | sort -u); do echo "${p#/}"; done | `+
+		`sudo tar -c --dereference -C / -T -`, strings.Join(binaries, " "))
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		c.Fatal(err)
+	}
+	if err := session.Start(cmd); err != nil {
+		c.Fatalf("archiving %s: %v", strings.Join(binaries, ", "), err)
+	}
+	perr := r.Push(name, c.Architecture, stdout)
+	if err := session.Wait(); err != nil {
+		c.Fatalf("archiving %s: %v: %s", strings.Join(binaries, ", "), err, stderr.Bytes())
+	}
+	if perr != nil {
+		c.Fatalf("pushing %s: %v", name, perr)
+	}
+}
+
+// descriptor references a blob in a manifest.
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int    `json:"size"`
+}
+
+func (r *Registry) addBlob(mediaType string, data []byte) descriptor {
+	d := digest(data)
+	r.blobs[d] = data
+	return descriptor{MediaType: mediaType, Digest: d, Size: len(data)}
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP implements the pull side of the OCI distribution API.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "the registry is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == req.URL.Path {
+		http.NotFound(w, req)
+		return
+	}
+	if path == "" {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var data []byte
+	if i := strings.LastIndex(path, "/manifests/"); i >= 0 {
+		repo, ref := path[:i], path[i+len("/manifests/"):]
+		sep := ":"
+		if strings.HasPrefix(ref, "sha256:") {
+			sep = "@"
+		}
+		data = r.manifests[repo+sep+ref]
+		w.Header().Set("Content-Type", ociManifestType)
+	} else if i := strings.LastIndex(path, "/blobs/"); i >= 0 {
+		data = r.blobs[path[i+len("/blobs/"):]]
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if data == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", digest(data))
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
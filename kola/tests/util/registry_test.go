@@ -0,0 +1,104 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := newRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	if err := tw.WriteHeader(&tar.Header{Name: "usr/bin/hello", Mode: 0755, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("hello"))
+	tw.Close()
+	if err := r.Push("test/hello:1", "arm64", bytes.NewReader(layer.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	base := "http://" + r.listener.Addr().String() + "/v2/"
+	get := func(path string) ([]byte, *http.Response) {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body, resp
+	}
+
+	if _, resp := get(""); resp.StatusCode != http.StatusOK {
+		t.Errorf("API check: got status %d", resp.StatusCode)
+	}
+	if _, resp := get("test/hello/manifests/latest"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing tag: got status %d", resp.StatusCode)
+	}
+
+	body, resp := get("test/hello/manifests/1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("manifest: got status %d", resp.StatusCode)
+	}
+	manifestDigest := resp.Header.Get("Docker-Content-Digest")
+	if _, resp := get("test/hello/manifests/" + manifestDigest); resp.StatusCode != http.StatusOK {
+		t.Errorf("manifest by digest: got status %d", resp.StatusCode)
+	}
+
+	var manifest struct {
+		Config descriptor
+		Layers []descriptor
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 1 {
+		t.Fatalf("got %d layers", len(manifest.Layers))
+	}
+	for _, d := range append(manifest.Layers, manifest.Config) {
+		blob, resp := get("test/hello/blobs/" + d.Digest)
+		if resp.StatusCode != http.StatusOK || digest(blob) != d.Digest || len(blob) != d.Size {
+			t.Errorf("blob %s: got status %d, digest %s, size %d", d.Digest, resp.StatusCode, digest(blob), len(blob))
+		}
+	}
+
+	config, _ := get("test/hello/blobs/" + manifest.Config.Digest)
+	var image struct {
+		Architecture string
+		RootFS       struct {
+			DiffIDs []string `json:"diff_ids"`
+		}
+	}
+	if err := json.Unmarshal(config, &image); err != nil {
+		t.Fatal(err)
+	}
+	if image.Architecture != "arm64" || len(image.RootFS.DiffIDs) != 1 || image.RootFS.DiffIDs[0] != digest(layer.Bytes()) {
+		t.Errorf("unexpected config %s", config)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// UsrRollback stages a failing update on the /usr partition which is not
+// in use and checks that GRUB falls back to the partition the machine
+// runs from, as it must for every release. Tests using it need the
+// NoEmergencyShellCheck flag, and NoKernelPanicCheck for StageBadVerity.
+type UsrRollback struct {
+	c cluster.TestCluster
+	m platform.Machine
+
+	// Good is the partition the machine runs from, USR-A or USR-B.
+	Good string
+	// Bad is the partition the failing update is staged on.
+	Bad string
+}
+
+// NewUsrRollback marks the partition m booted from as successfully
+// booted, so GRUB falls back to it.
+func NewUsrRollback(c cluster.TestCluster, m platform.Machine) *UsrRollback {
+	good := BootedUsr(c, m)
+	c.MustSSH(m, "sudo flatcar-setgoodroot")
+	return &UsrRollback{
+		c:    c,
+		m:    m,
+		Good: good,
+		Bad:  otherUsr(good),
+	}
+}
+
+// kernel returns the path of the kernel booting usr.
+func (r *UsrRollback) kernel(usr string) string {
+	return "/boot/flatcar/vmlinuz-" + strings.ToLower(strings.TrimPrefix(usr, "USR-"))
+}
+
+// StageBadVerity stages a copy of the good partition whose kernel has a
+// wrong verity hash, so the kernel panics on boot. The test is skipped if
+// the machine doesn't use verity.
+func (r *UsrRollback) StageBadVerity() {
+	SkipUnlessVerity(r.c, r.m)
+
+	r.c.MustSSH(r.m, fmt.Sprintf("sudo dd if=/dev/disk/by-partlabel/%s of=/dev/disk/by-partlabel/%s bs=10M status=none", r.Good, r.Bad))
+	r.c.MustSSH(r.m, fmt.Sprintf("sudo cp %s %s", r.kernel(r.Good), r.kernel(r.Bad)))
+	r.setVerityHash("0000000000000000000000000000000000000000000000000000000000000000")
+}
+
+// StageBadUsr stages an empty file system with a valid verity hash, so
+// the boot fails in the initramfs.
+func (r *UsrRollback) StageBadUsr() {
+	dev := "/dev/disk/by-partlabel/" + r.Bad
+	r.c.MustSSH(r.m, "sudo mkfs.ext4 -q -b 4096 "+dev+" 25600")
+
+	output := r.c.MustSSH(r.m, "sudo veritysetup format --hash=sha256 "+
+		"--data-block-size 4096 --hash-block-size 4096 --data-blocks 25600 --hash-offset 104857600 "+
+		dev+" "+dev)
+	match := regexp.MustCompile("\nRoot hash:\\s+([0-9a-f]+)").FindSubmatch(output)
+	if match == nil {
+		r.c.Fatalf("Couldn't obtain new root hash; output %s", output)
+	}
+
+	r.c.MustSSH(r.m, fmt.Sprintf("sudo cp %s %s", r.kernel(r.Good), r.kernel(r.Bad)))
+	r.setVerityHash(string(match[1]))
+}
+
+// setVerityHash writes hash to the kernel of the bad partition.
+func (r *UsrRollback) setVerityHash(hash string) {
+	r.c.MustSSH(r.m, fmt.Sprintf("sudo dd of=%s bs=1 seek=%d count=64 conv=notrunc status=none <<<%s", r.kernel(r.Bad), KernelVerityHashOffset(r.c), hash))
+}
+
+// Verify makes GRUB try the bad partition once, like after an update,
+// reboots and checks that the machine came back on the good partition
+// with the tries of the bad one used up.
+func (r *UsrRollback) Verify() {
+	PrioritizeUsr(r.c, r.m, r.Bad)
+	// also covers the kernel panic timeout of 1 minute before reboot
+	RebootWithEmergencyShellTimeout(r.c, r.m)
+	AssertBootedUsr(r.c, r.m, r.Good)
+
+	tries := r.c.MustSSH(r.m, fmt.Sprintf(`part=$(readlink -f /dev/disk/by-partlabel/%s) && `+
+		`sudo cgpt show -T -i "$(cat /sys/class/block/${part#/dev/}/partition)" "/dev/$(lsblk -no pkname "$part")"`, r.Bad))
+	if string(tries) != "0" {
+		r.c.Fatalf("%s has %s tries left after failing to boot", r.Bad, tries)
+	}
+}
+
+// PrioritizeUsr makes GRUB boot usr next, trying it once.
+func PrioritizeUsr(c cluster.TestCluster, m platform.Machine, usr string) {
+	c.MustSSH(m, "sudo cgpt repair /dev/disk/by-partlabel/"+usr)
+	c.MustSSH(m, "sudo cgpt add -S0 -T1 /dev/disk/by-partlabel/"+usr)
+	c.MustSSH(m, "sudo cgpt prioritize /dev/disk/by-partlabel/"+usr)
+}
+
+// RebootWithEmergencyShellTimeout reboots m, waiting extra-long for the
+// 5-minute emergency shell timeout of a failed boot.
+func RebootWithEmergencyShellTimeout(c cluster.TestCluster, m platform.Machine) {
+	// reboot; wait extra 5 minutes; check machine
+	// this defeats some of the machinery in m.Reboot()
+	if err := platform.StartReboot(m); err != nil {
+		c.Fatal(err)
+	}
+	time.Sleep(5 * time.Minute)
+	if err := platform.CheckMachine(context.TODO(), m); err != nil {
+		c.Fatal(err)
+	}
+}
+
+// KernelVerityHashOffset returns the offset of the verity hash of /usr
+// in the kernel.
+func KernelVerityHashOffset(c cluster.TestCluster) int {
+	if c.Architecture == "arm64" {
+		return 512
+	}
+	return 64
+}
+
+// SkipUnlessVerity skips the test if m doesn't use verity for /usr.
+func SkipUnlessVerity(c cluster.TestCluster, m platform.Machine) {
+	// figure out if we are actually using verity
+	out, err := c.SSH(m, "sudo veritysetup status usr")
+	if err != nil && bytes.Equal(out, []byte("/dev/mapper/usr is inactive.")) {
+		// verity not in use, so skip.
+		c.Skip("verity is not enabled")
+	} else if err != nil {
+		c.Fatalf("failed checking verity status: %s: %v", out, err)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+	mutil "github.com/flatcar/mantle/util"
+)
+
+const (
+	// S3FixtureImage is the MinIO image serving the S3 fixture.
+	S3FixtureImage = "quay.io/minio/minio:RELEASE.2024-10-13T13-34-11Z"
+
+	s3FixturePort      = 9000
+	s3FixtureContainer = "kola-s3"
+	s3FixtureRegion    = "us-east-1"
+	s3FixtureBucket    = "kola"
+)
+
+// S3Fixture is an ephemeral S3-compatible object storage served by MinIO,
+// with a single bucket. It is started either on a machine of the cluster
+// or on the host running kola and is gone with the test.
+type S3Fixture struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// server is nil if the fixture runs on the host
+	server  platform.Machine
+	runtime string
+}
+
+func newS3Fixture(address string) *S3Fixture {
+	return &S3Fixture{
+		Endpoint:  fmt.Sprintf("http://%s", net.JoinHostPort(address, fmt.Sprint(s3FixturePort))),
+		Region:    s3FixtureRegion,
+		Bucket:    s3FixtureBucket,
+		AccessKey: randomHex(10),
+		SecretKey: randomHex(20),
+	}
+}
+
+func (f *S3Fixture) containerArgs() []string {
+	return []string{"run", "-d", "--rm", "--name", s3FixtureContainer,
+		"-p", fmt.Sprintf("%d:%d", s3FixturePort, s3FixturePort),
+		"-e", "MINIO_ROOT_USER=" + f.AccessKey,
+		"-e", "MINIO_ROOT_PASSWORD=" + f.SecretKey,
+		S3FixtureImage, "server", "/data"}
+}
+
+// StartS3Fixture runs the S3 fixture in a Docker container on server. The
+// endpoint is the private IP of server, so it is reachable by the other
+// machines of the cluster.
+func StartS3Fixture(c cluster.TestCluster, server platform.Machine) *S3Fixture {
+	f := newS3Fixture(server.PrivateIP())
+	f.server = server
+
+	c.MustSSH(server, "docker "+strings.Join(f.containerArgs(), " "))
+
+	ready := platform.HTTPProbe(fmt.Sprintf("http://127.0.0.1:%d/minio/health/ready", s3FixturePort))
+	ready.Timeout = time.Minute
+	if err := ready.Wait(c.Context(), server); err != nil {
+		c.Fatalf("S3 fixture did not become ready: %v", err)
+	}
+
+	c.MustSSH(server, fmt.Sprintf("curl -sf --aws-sigv4 aws:amz:%s:s3 --user %s:%s -X PUT http://127.0.0.1:%d/%s",
+		f.Region, f.AccessKey, f.SecretKey, s3FixturePort, f.Bucket))
+
+	return f
+}
+
+// StartHostS3Fixture runs the S3 fixture in a container on the host running
+// kola with Docker or Podman. address is the address of the host as seen
+// by the machines, it depends on the platform. The fixture must be stopped
+// with Stop.
+func StartHostS3Fixture(c cluster.TestCluster, address string) *S3Fixture {
+	f := newS3Fixture(address)
+
+	for _, runtime := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(runtime); err == nil {
+			f.runtime = runtime
+			break
+		}
+	}
+	if f.runtime == "" {
+		c.Skip("S3 fixture on the host needs docker or podman")
+	}
+
+	if out, err := exec.Command(f.runtime, f.containerArgs()...).CombinedOutput(); err != nil {
+		c.Fatalf("starting S3 fixture: %v: %s", err, out)
+	}
+
+	// the fixture is reached from the host through the published port
+	local := fmt.Sprintf("http://127.0.0.1:%d", s3FixturePort)
+	if err := mutil.Retry(30, 2*time.Second, func() error {
+		resp, err := http.Get(local + "/minio/health/ready")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}); err != nil {
+		f.Stop(c)
+		c.Fatalf("S3 fixture did not become ready: %v", err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(local),
+		Region:           aws.String(f.Region),
+		Credentials:      credentials.NewStaticCredentials(f.AccessKey, f.SecretKey, ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err == nil {
+		_, err = s3.New(sess).CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(f.Bucket)})
+	}
+	if err != nil {
+		f.Stop(c)
+		c.Fatalf("creating S3 fixture bucket: %v", err)
+	}
+
+	return f
+}
+
+// Stop removes the fixture container. Fixtures running on a machine are
+// also gone with the machine.
+func (f *S3Fixture) Stop(c cluster.TestCluster) {
+	if f.server != nil {
+		c.MustSSH(f.server, "docker rm -f "+s3FixtureContainer)
+		return
+	}
+	if out, err := exec.Command(f.runtime, "rm", "-f", s3FixtureContainer).CombinedOutput(); err != nil {
+		c.Errorf("stopping S3 fixture: %v: %s", err, out)
+	}
+}
+
+// Env returns the environment pointing S3 clients to the fixture.
+func (f *S3Fixture) Env() []string {
+	return []string{
+		"AWS_ACCESS_KEY_ID=" + f.AccessKey,
+		"AWS_SECRET_ACCESS_KEY=" + f.SecretKey,
+		"AWS_DEFAULT_REGION=" + f.Region,
+		"AWS_ENDPOINT_URL=" + f.Endpoint,
+		"S3_ENDPOINT=" + f.Endpoint,
+		"S3_BUCKET=" + f.Bucket,
+	}
+}
+
+// InjectCredentials writes the environment of the fixture to
+// /etc/kola/s3.env, to be used as EnvironmentFile of units and readable by
+// the SSH user, and the AWS credentials and config for root of m. All files
+// are only readable by their owner.
+func (f *S3Fixture) InjectCredentials(c cluster.TestCluster, m platform.Machine) {
+	for _, file := range []struct {
+		path, owner, contents string
+	}{
+		{"/etc/kola/s3.env", "$(id -un)", strings.Join(f.Env(), "\n") + "\n"},
+		{"/root/.aws/credentials", "root", fmt.Sprintf("[default]\naws_access_key_id = %s\naws_secret_access_key = %s\n", f.AccessKey, f.SecretKey)},
+		{"/root/.aws/config", "root", fmt.Sprintf("[default]\nregion = %s\nendpoint_url = %s\n", f.Region, f.Endpoint)},
+	} {
+		if err := installSecret(m, file.path, file.owner, file.contents); err != nil {
+			c.Fatalf("installing %s: %v", file.path, err)
+		}
+	}
+}
+
+// installSecret writes contents to path on m with mode 0600, passing them
+// on stdin so they don't show up in the command line.
+func installSecret(m platform.Machine, path, owner, contents string) error {
+	client, err := m.SSHClient()
+	if err != nil {
+		return fmt.Errorf("failed creating SSH client: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdin = strings.NewReader(contents)
+	if out, err := session.CombinedOutput(fmt.Sprintf("sudo install -D -m 0600 -o %s /dev/stdin %s", owner, path)); err != nil {
+		return fmt.Errorf("failed executing install: %q: %v", out, err)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
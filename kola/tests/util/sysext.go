@@ -0,0 +1,214 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+)
+
+// The file systems of sysext images built by Sysext.Build.
+const (
+	SysextSquashfs = "squashfs"
+	SysextExt4     = "ext4"
+)
+
+// SysextFile is a file of a sysext image, either with the given Contents
+// or copied from the local file Source.
+type SysextFile struct {
+	Contents string
+	Source   string
+	// Mode defaults to 0644 for Contents and to the mode of Source.
+	Mode os.FileMode
+}
+
+// Sysext is a systemd-sysext image built on the host running kola, so
+// tests don't have to build it on the machine.
+type Sysext struct {
+	// Name is the name of the image and its extension-release file.
+	Name string
+	// Arch is the machine architecture the image is for, e.g. amd64, or
+	// any if empty.
+	Arch string
+	// Files maps paths below usr/ or opt/, e.g. "usr/bin/docker", to
+	// their contents.
+	Files map[string]SysextFile
+}
+
+// releaseFile returns the path and contents of the extension-release file.
+func (s *Sysext) releaseFile() (string, string) {
+	release := "ID=flatcar\nSYSEXT_LEVEL=1.0\n"
+	switch s.Arch {
+	case "amd64":
+		release += "ARCHITECTURE=x86-64\n"
+	case "arm64":
+		release += "ARCHITECTURE=arm64\n"
+	}
+	return "usr/lib/extension-release.d/extension-release." + s.Name, release
+}
+
+// stage writes the file tree of the image to dir.
+func (s *Sysext) stage(dir string) error {
+	releasePath, release := s.releaseFile()
+	files := map[string]SysextFile{releasePath: {Contents: release}}
+	for p, f := range s.Files {
+		clean := path.Clean(p)
+		if !strings.HasPrefix(clean, "usr/") && !strings.HasPrefix(clean, "opt/") {
+			return fmt.Errorf("%s is not below usr/ or opt/", p)
+		}
+		files[clean] = f
+	}
+
+	for p, f := range files {
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeSysextFile(target, f); err != nil {
+			return fmt.Errorf("writing %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+func writeSysextFile(target string, f SysextFile) error {
+	mode := f.Mode
+	if f.Source == "" {
+		if mode == 0 {
+			mode = 0644
+		}
+		return os.WriteFile(target, []byte(f.Contents), mode)
+	}
+
+	in, err := os.Open(f.Source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if mode == 0 {
+		info, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		mode = info.Mode().Perm()
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Build writes the image to the file out, with the file system format, or
+// squashfs if mksquashfs is installed and else ext4 if format is empty.
+// squashfs images need mksquashfs and ext4 images mkfs.ext4 on the host.
+// The files of ext4 images are owned by the user running kola.
+func (s *Sysext) Build(out, format string) error {
+	if format == "" {
+		format = SysextExt4
+		if _, err := exec.LookPath("mksquashfs"); err == nil {
+			format = SysextSquashfs
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "kola-sysext-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// the directory becomes the root of the extension
+	if err := os.Chmod(dir, 0755); err != nil {
+		return err
+	}
+	if err := s.stage(dir); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch format {
+	case SysextSquashfs:
+		cmd = exec.Command("mksquashfs", dir, out, "-all-root", "-noappend", "-quiet")
+	case SysextExt4:
+		size, err := dirSize(dir)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		// room for the metadata of the file system
+		err = f.Truncate(size + size/5 + 16<<20)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		cmd = exec.Command("mkfs.ext4", "-q", "-F", "-E", "root_owner=0:0", "-d", dir, out)
+	default:
+		return fmt.Errorf("unknown sysext format %q", format)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("building %s image %s: %v: %s", format, s.Name, err, output)
+	}
+	return nil
+}
+
+// dirSize returns the size of the files in dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
+
+// InstallSysext builds the image s and copies it to
+// /etc/extensions/<name>.raw on m. The extensions are not refreshed, which
+// is done with "systemctl restart systemd-sysext".
+func InstallSysext(c cluster.TestCluster, m platform.Machine, s *Sysext) {
+	dir, err := os.MkdirTemp("", "kola-sysext-")
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, s.Name+".raw")
+	if err := s.Build(image, ""); err != nil {
+		c.Fatal(err)
+	}
+	// replace the image atomically, it may be in use
+	target := fmt.Sprintf("/etc/extensions/%s.raw", s.Name)
+	if err := platform.UploadFile(m, image, target+".new", c.UploadProgress(s.Name+".raw")); err != nil {
+		c.Fatalf("copying %s to %s: %v", s.Name, m.ID(), err)
+	}
+	c.MustSSH(m, fmt.Sprintf("sudo mv %[1]s.new %[1]s", target))
+}
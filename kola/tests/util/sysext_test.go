@@ -0,0 +1,92 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSysextStage(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(src, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := &Sysext{
+		Name: "test",
+		Arch: "arm64",
+		Files: map[string]SysextFile{
+			"usr/bin/tool":                     {Source: src},
+			"usr/lib/systemd/system/a.service": {Contents: "[Service]\n"},
+		},
+	}
+	dir := t.TempDir()
+	if err := s.stage(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, expected := range map[string]struct {
+		contents string
+		mode     os.FileMode
+	}{
+		"usr/bin/tool":                                       {"#!/bin/sh\n", 0755},
+		"usr/lib/systemd/system/a.service":                   {"[Service]\n", 0644},
+		"usr/lib/extension-release.d/extension-release.test": {"ID=flatcar\nSYSEXT_LEVEL=1.0\nARCHITECTURE=arm64\n", 0644},
+	} {
+		target := filepath.Join(dir, p)
+		b, err := os.ReadFile(target)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected.contents || info.Mode().Perm() != expected.mode {
+			t.Errorf("%s: got %q with mode %v", p, b, info.Mode().Perm())
+		}
+	}
+
+	s.Files = map[string]SysextFile{"etc/passwd": {}}
+	if err := s.stage(t.TempDir()); err == nil {
+		t.Error("expected error for a file outside of usr/ and opt/")
+	}
+}
+
+func TestSysextBuildExt4(t *testing.T) {
+	for _, tool := range []string{"mkfs.ext4", "debugfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	s := &Sysext{
+		Name:  "test",
+		Files: map[string]SysextFile{"usr/share/test": {Contents: "sysext works\n"}},
+	}
+	image := filepath.Join(t.TempDir(), "test.raw")
+	if err := s.Build(image, SysextExt4); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("debugfs", "-R", "cat /usr/share/test", image).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "sysext works\n" {
+		t.Errorf("got %q", out)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-omaha/omaha"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+	"github.com/flatcar/mantle/platform/machine/unprivqemu"
+	"github.com/flatcar/mantle/util"
+)
+
+// The states of update_engine reported as CURRENT_OP.
+const (
+	UpdateStatusIdle              = "UPDATE_STATUS_IDLE"
+	UpdateStatusCheckingForUpdate = "UPDATE_STATUS_CHECKING_FOR_UPDATE"
+	UpdateStatusUpdateAvailable   = "UPDATE_STATUS_UPDATE_AVAILABLE"
+	UpdateStatusDownloading       = "UPDATE_STATUS_DOWNLOADING"
+	UpdateStatusVerifying         = "UPDATE_STATUS_VERIFYING"
+	UpdateStatusFinalizing        = "UPDATE_STATUS_FINALIZING"
+	UpdateStatusNeedReboot        = "UPDATE_STATUS_UPDATED_NEED_REBOOT"
+	UpdateStatusErrorEvent        = "UPDATE_STATUS_REPORTING_ERROR_EVENT"
+)
+
+const (
+	// developer key of the SDK, which signs the payloads of test builds
+	devUpdateKey = `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzFS5uVJ+pgibcFLD3kbY
+k02Edj0HXq31ZT/Bva1sLp3Ysv+QTv/ezjf0gGFfASdgpz6G+zTipS9AIrQr0yFR
++tdp1ZsHLGxVwvUoXFftdapqlyj8uQcWjjbN7qJsZu0Ett/qo93hQ5nHW7Sv5dRm
+/ZsDFqk2Uvyaoef4bF9r03wYpZq7K3oALZ2smETv+A5600mj1Xg5M52QFU67UHls
+EFkZphrGjiqiCdp9AAbAvE7a5rFcJf86YR73QX08K8BX7OMzkn3DsqdnWvLB3l3W
+6kvIuP+75SrMNeYAcU8PI1+bzLcAG3VN3jA78zeKALgynUNH50mxuiiU3DO4DZ+p
+5QIDAQAB
+-----END PUBLIC KEY-----`
+
+	// production key
+	// https://github.com/flatcar/coreos-overlay/blob/flatcar-master/coreos-base/coreos-au-key/files/official-v2.pub.pem
+	prodUpdateKey = `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAw/NZ5Tvc93KynOLPDOxa
+hyAGRKB2NvgF9l2A61SsFw5CuZc/k02u1/BvFehK4XL/eOo90Dt8A2l28D/YKs7g
+2IPUSAnA9hc5OKBbpHsDzisxlAh7kg4FpeeJJWJMzO8NDCG5NZVqXEpGjCmX0qSh
+5MLiTDr9dU2YhLo93/92dKnTvsLjUVv5wnuF55Lt2wJv4CbxVn4hHwotGfSomTBO
++7o6hE3VIIo1C6lkP+FAqMyWKA9s6U0x4tGxCXszW3hPWOANLIT4m0e55ayxiy5A
+ESEVW/xx6Rul75u925m21AqA6wwaEB6ZPKTnUiWoNKNv1xi8LPIz12+0nuE6iT1K
+jQIDAQAB
+-----END PUBLIC KEY-----`
+
+	// slirp address of the host for unprivileged QEMU machines
+	unprivQEMUHostIP = "10.0.2.2"
+)
+
+// UpdateServer serves an update payload to the machines of a test with an
+// Omaha server running in kola, so no machine has to host it.
+type UpdateServer struct {
+	// URL is the update server to configure on the machines.
+	URL string
+
+	c cluster.TestCluster
+	// server is only set if owned by the UpdateServer
+	server *omaha.TrivialServer
+}
+
+// NewUpdateServer serves the update payload at path, e.g.
+// kola.UpdatePayloadFile. It only works on QEMU, where the machines can
+// reach kola. The server must be closed at the end of the test.
+func NewUpdateServer(c cluster.TestCluster, path string) *UpdateServer {
+	switch qc := c.Cluster.(type) {
+	case *qemu.Cluster:
+		// the cluster already runs an Omaha server in its network
+		// namespace
+		if err := qc.OmahaServer.AddPackage(path, "update.gz"); err != nil {
+			c.Fatalf("bad update payload: %v", err)
+		}
+		hostport, err := qc.GetOmahaHostPort()
+		if err != nil {
+			c.Fatalf("getting Omaha server address: %v", err)
+		}
+		return &UpdateServer{URL: fmt.Sprintf("http://%s/v1/update/", hostport), c: c}
+	case *unprivqemu.Cluster:
+		server, err := omaha.NewTrivialServer("127.0.0.1:0")
+		if err != nil {
+			c.Fatalf("creating Omaha server: %v", err)
+		}
+		if err := server.AddPackage(path, "update.gz"); err != nil {
+			server.Destroy()
+			c.Fatalf("bad update payload: %v", err)
+		}
+		go server.Serve()
+		_, port, err := net.SplitHostPort(server.Addr().String())
+		if err != nil {
+			server.Destroy()
+			c.Fatal(err)
+		}
+		return &UpdateServer{
+			URL:    fmt.Sprintf("http://%s/v1/update/", net.JoinHostPort(unprivQEMUHostIP, port)),
+			c:      c,
+			server: server,
+		}
+	default:
+		c.Fatalf("serving updates is not supported on %T", c.Cluster)
+	}
+	return nil
+}
+
+// Close stops serving the payload.
+func (s *UpdateServer) Close() {
+	if s.server == nil {
+		return
+	}
+	if err := s.server.Destroy(); err != nil {
+		s.c.Logf("Error destroying Omaha server: %v", err)
+	}
+}
+
+// Updater drives update_engine on a machine through the phases of an
+// update: downloading and applying it, rebooting into the updated /usr
+// partition and rolling back to the previous one.
+type Updater struct {
+	c      cluster.TestCluster
+	m      platform.Machine
+	server string
+
+	// Timeout is how long downloading and applying an update may take.
+	Timeout time.Duration
+}
+
+// NewUpdater makes m use the Omaha server at server, see Configure.
+func NewUpdater(c cluster.TestCluster, m platform.Machine, server string) *Updater {
+	u := &Updater{
+		c:       c,
+		m:       m,
+		server:  server,
+		Timeout: 10 * time.Minute,
+	}
+	u.Configure()
+	return u
+}
+
+// Configure points update_engine to the update server and makes it trust
+// the key the payload is signed with. Updating to an official release
+// replaces the key, so it has to be configured again before the next
+// update. Machines are configured after booting via SSH to allow for
+// testing releases which predate Ignition. Automatic reboots are
+// disabled so the test has explicit control.
+func (u *Updater) Configure() {
+	updateConf, err := conf.UpdateConf(u.server, "developer", "")
+	if err != nil {
+		u.c.Fatal(err)
+	}
+	// update atomically so nothing reading update.conf fails
+	u.c.MustSSH(u.m, fmt.Sprintf(`sudo bash -c "cat >/etc/coreos/update.conf.new <<EOF
+%sEOF"`, updateConf))
+	u.c.MustSSH(u.m, "sudo mv /etc/coreos/update.conf{.new,}")
+
+	key := devUpdateKey
+	if kola.ForceFlatcarKey {
+		key = prodUpdateKey
+	}
+	u.c.MustSSH(u.m, fmt.Sprintf(`sudo bash -c "cat >/etc/coreos/update-payload-key.pub.pem <<EOF
+%s
+EOF"`, key))
+	u.c.MustSSH(u.m, "sudo mount --bind /etc/coreos/update-payload-key.pub.pem /usr/share/update_engine/update-payload-key.pub.pem")
+
+	u.c.MustSSH(u.m, "sudo systemctl mask --now locksmithd.service")
+	u.c.MustSSH(u.m, "sudo systemctl reset-failed locksmithd.service")
+
+	u.c.MustSSH(u.m, "sudo systemctl restart update-engine.service")
+}
+
+// Status returns the status of update_engine, e.g. CURRENT_OP and
+// NEW_VERSION.
+func (u *Updater) Status() (map[string]string, error) {
+	out, stderr, err := u.m.SSH("update_engine_client -status 2>/dev/null")
+	if err != nil {
+		return nil, fmt.Errorf("checking status failed: %v: %s", err, stderr)
+	}
+	return splitNewlineEnv(string(out)), nil
+}
+
+// Apply checks for an update and waits until update_engine downloaded and
+// applied it to the other /usr partition, logging the phases it goes
+// through.
+func (u *Updater) Apply() {
+	u.c.Logf("Triggering update_engine")
+	out, stderr, err := u.m.SSH("update_engine_client -check_for_update")
+	if err != nil {
+		u.c.Fatalf("Executing update_engine_client failed: %v: %v: %s", out, err, stderr)
+	}
+
+	var op string
+	err = util.WaitUntilReady(u.Timeout, 10*time.Second, func() (bool, error) {
+		status, err := u.Status()
+		if err != nil {
+			return false, err
+		}
+		if status["CURRENT_OP"] != op {
+			op = status["CURRENT_OP"]
+			u.c.Logf("update_engine: %s", op)
+		}
+		if op == UpdateStatusErrorEvent {
+			return false, fmt.Errorf("update_engine failed applying the update")
+		}
+		return op == UpdateStatusNeedReboot, nil
+	})
+	if err != nil {
+		u.c.Fatalf("waiting for %s: %v", UpdateStatusNeedReboot, err)
+	}
+}
+
+// Reboot reboots into the updated partition and checks /usr is on it.
+func (u *Updater) Reboot() {
+	next := otherUsr(BootedUsr(u.c, u.m))
+	u.c.Logf("Rebooting into %s", next)
+	if err := u.m.Reboot(); err != nil {
+		u.c.Fatalf("reboot failed: %v", err)
+	}
+	AssertBootedUsr(u.c, u.m, next)
+}
+
+// Update applies an update and reboots into it.
+func (u *Updater) Update() {
+	u.Apply()
+	u.Reboot()
+}
+
+// Rollback makes the /usr partition which is not in use the preferred one
+// and reboots into it, like an administrator reverting an update.
+func (u *Updater) Rollback() {
+	prev := otherUsr(BootedUsr(u.c, u.m))
+	u.c.Logf("Rolling back to %s", prev)
+	u.c.MustSSH(u.m, fmt.Sprintf(`sudo cgpt prioritize "$(readlink -f /dev/disk/by-partlabel/%s)"`, prev))
+	if err := u.m.Reboot(); err != nil {
+		u.c.Fatalf("reboot failed: %v", err)
+	}
+	AssertBootedUsr(u.c, u.m, prev)
+}
+
+// BootedUsr returns the label of the partition of /usr, USR-A or USR-B.
+func BootedUsr(c cluster.TestCluster, m platform.Machine) string {
+	usrdev := GetUsrDeviceNode(c, m)
+	for _, usr := range []string{"USR-A", "USR-B"} {
+		target := c.MustSSH(m, "readlink -f /dev/disk/by-partlabel/"+usr)
+		if usrdev == string(target) {
+			return usr
+		}
+	}
+	c.Fatalf("/usr is on %s, neither USR-A nor USR-B", usrdev)
+	return ""
+}
+
+func otherUsr(usr string) string {
+	if usr == "USR-A" {
+		return "USR-B"
+	}
+	return "USR-A"
+}
+
+// splits newline-delimited KEY=VAL pairs into a map
+func splitNewlineEnv(envs string) map[string]string {
+	m := make(map[string]string)
+	sc := bufio.NewScanner(strings.NewReader(envs))
+	for sc.Scan() {
+		spl := strings.SplitN(sc.Text(), "=", 2)
+		if len(spl) == 2 {
+			m[spl[0]] = spl[1]
+		}
+	}
+	return m
+}
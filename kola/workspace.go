@@ -0,0 +1,313 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WorkspaceDir is the directory in which the output directories of the
+// runs are created if none is given.
+const WorkspaceDir = "_kola_temp"
+
+// runsDirName is the directory of the workspace holding the run
+// manifests, which also serve as the locks of the running runs. They are
+// kept outside of the output directories because the harness empties
+// those.
+const runsDirName = ".runs"
+
+var (
+	// WorkspaceMaxAge and WorkspaceMaxSize, if not zero, are the
+	// retention policy applied to the workspace before a run: finished
+	// runs older than WorkspaceMaxAge are removed, then the oldest ones
+	// until the workspace is smaller than WorkspaceMaxSize bytes.
+	WorkspaceMaxAge  time.Duration
+	WorkspaceMaxSize int64
+
+	// runManifest is the locked manifest of the run of this process.
+	runManifest *os.File
+)
+
+// RunManifest describes a run in the workspace.
+type RunManifest struct {
+	Platform string     `json:"platform"`
+	Command  []string   `json:"command"`
+	Host     string     `json:"host"`
+	PID      int        `json:"pid"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Passed   bool       `json:"passed"`
+}
+
+// WorkspaceRun is a run found in the workspace.
+type WorkspaceRun struct {
+	// Name is the name of the output directory of the run.
+	Name string
+	// Manifest is nil for runs of kola versions without manifests.
+	Manifest *RunManifest
+	// Active is set if the run's process still holds its lock.
+	Active bool
+	// Started is the start of the run, or the modification time of its
+	// output directory without a manifest.
+	Started time.Time
+	Size    int64
+}
+
+// Status returns "running", "passed", "failed" or "unknown", if the run
+// ended without recording its result.
+func (r *WorkspaceRun) Status() string {
+	switch {
+	case r.Active:
+		return "running"
+	case r.Manifest == nil || r.Manifest.Finished == nil:
+		return "unknown"
+	case r.Manifest.Passed:
+		return "passed"
+	default:
+		return "failed"
+	}
+}
+
+// lockWorkspace takes the lock of the workspace dir, serializing the
+// creation of runs with pruning. The returned function releases it.
+func lockWorkspace(dir string) (func(), error) {
+	if err := os.MkdirAll(filepath.Join(dir, runsDirName), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, runsDirName, ".lock"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking workspace %s: %v", dir, err)
+	}
+	return func() { f.Close() }, nil
+}
+
+// startRun records the manifest of the run name in the workspace dir and
+// keeps it locked until the process exits.
+func startRun(dir, name, platform string) error {
+	f, err := os.OpenFile(filepath.Join(dir, runsDirName, name+".json"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return fmt.Errorf("locking run %s: %v", name, err)
+	}
+	host, _ := os.Hostname()
+	m := RunManifest{
+		Platform: platform,
+		Command:  os.Args,
+		Host:     host,
+		PID:      os.Getpid(),
+		Started:  time.Now().UTC(),
+	}
+	if err := writeManifest(f, &m); err != nil {
+		f.Close()
+		return err
+	}
+	runManifest = f
+	return nil
+}
+
+// FinishRun records the end and the result of the run in its manifest,
+// if the output directory was created in the workspace.
+func FinishRun(runErr error) error {
+	if runManifest == nil {
+		return nil
+	}
+	defer func() {
+		runManifest.Close()
+		runManifest = nil
+	}()
+
+	var m RunManifest
+	if _, err := runManifest.Seek(0, 0); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(runManifest).Decode(&m); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	m.Finished = &now
+	m.Passed = runErr == nil
+	return writeManifest(runManifest, &m)
+}
+
+func writeManifest(f *os.File, m *RunManifest) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	return enc.Encode(m)
+}
+
+// ListWorkspace returns the runs in the workspace dir, the oldest first.
+func ListWorkspace(dir string) ([]WorkspaceRun, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var runs []WorkspaceRun
+	for _, e := range entries {
+		// skip the latest symlinks and the manifests
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		run := WorkspaceRun{Name: e.Name()}
+		if info, err := e.Info(); err == nil {
+			run.Started = info.ModTime()
+		}
+		if err := readRunManifest(dir, &run); err != nil {
+			return nil, err
+		}
+		run.Size, err = dirSize(filepath.Join(dir, run.Name))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Started.Before(runs[j].Started)
+	})
+	return runs, nil
+}
+
+// readRunManifest fills in the manifest and the state of run, if it has
+// a manifest.
+func readRunManifest(dir string, run *WorkspaceRun) error {
+	f, err := os.Open(filepath.Join(dir, runsDirName, run.Name+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		run.Active = true
+	} else if err != nil {
+		return err
+	}
+	var m RunManifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		// a run which is just starting
+		if run.Active {
+			return nil
+		}
+		return fmt.Errorf("reading the manifest of run %s: %v", run.Name, err)
+	}
+	run.Manifest = &m
+	run.Started = m.Started
+	return nil
+}
+
+// PruneWorkspace removes the runs of the workspace dir which are not
+// running and older than maxAge, then the oldest ones until the workspace
+// is smaller than maxSize bytes. Zero values disable the limits. It
+// returns the removed runs.
+func PruneWorkspace(dir string, maxAge time.Duration, maxSize int64) ([]WorkspaceRun, error) {
+	unlock, err := lockWorkspace(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return pruneWorkspace(dir, maxAge, maxSize)
+}
+
+func pruneWorkspace(dir string, maxAge time.Duration, maxSize int64) ([]WorkspaceRun, error) {
+	runs, err := ListWorkspace(dir)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, run := range runs {
+		total += run.Size
+	}
+
+	var removed []WorkspaceRun
+	for _, run := range runs {
+		if run.Active {
+			continue
+		}
+		tooOld := maxAge > 0 && time.Since(run.Started) > maxAge
+		tooBig := maxSize > 0 && total > maxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, run.Name)); err != nil {
+			return removed, err
+		}
+		if err := os.Remove(filepath.Join(dir, runsDirName, run.Name+".json")); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		total -= run.Size
+		removed = append(removed, run)
+	}
+	if len(removed) > 0 {
+		removeDanglingLinks(dir)
+	}
+	return removed, nil
+}
+
+// removeDanglingLinks removes the <platform>-latest symlinks of the
+// workspace dir to removed runs.
+func removeDanglingLinks(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			os.Remove(path)
+		}
+	}
+}
+
+// dirSize returns the size of the files in dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		// files of running runs come and go
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
@@ -0,0 +1,100 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	addRun := func(name string, size int, age time.Duration) {
+		runDir := filepath.Join(dir, name)
+		if err := os.Mkdir(runDir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(runDir, "journal.txt"), make([]byte, size), 0666); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(runDir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// runs of older versions without manifests
+	addRun("qemu-old", 100, 48*time.Hour)
+	addRun("qemu-big", 1000, 24*time.Hour)
+	if err := os.Symlink("qemu-old", filepath.Join(dir, "qemu-latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addRun("qemu-running", 10, 0)
+	if err := startRun(dir, "qemu-running", "qemu"); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	defer FinishRun(nil)
+
+	runs, err := ListWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, run := range runs {
+		names = append(names, run.Name+":"+run.Status())
+	}
+	if want := []string{"qemu-old:unknown", "qemu-big:unknown", "qemu-running:running"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got runs %q, want %q", names, want)
+	}
+
+	removed, err := PruneWorkspace(dir, 36*time.Hour, 0)
+	if err != nil || len(removed) != 1 || removed[0].Name != "qemu-old" {
+		t.Fatalf("pruning by age removed %v: %v", removed, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "qemu-latest")); !os.IsNotExist(err) {
+		t.Errorf("the dangling latest link was kept: %v", err)
+	}
+
+	// the running run is kept even though it is over the size
+	removed, err = PruneWorkspace(dir, 0, 5)
+	if err != nil || len(removed) != 1 || removed[0].Name != "qemu-big" {
+		t.Fatalf("pruning by size removed %v: %v", removed, err)
+	}
+
+	if err := FinishRun(errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = ListWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Status() != "failed" || runs[0].Manifest.Platform != "qemu" {
+		t.Fatalf("got runs %+v after the run finished", runs)
+	}
+	removed, err = PruneWorkspace(dir, 0, 5)
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("pruning the finished run removed %v: %v", removed, err)
+	}
+}
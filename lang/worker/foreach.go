@@ -0,0 +1,84 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/pkg/multierror"
+	"golang.org/x/net/context"
+)
+
+// Progress is called by ForEach each time an item is finished, err is the
+// error returned for the item.
+type Progress func(done, total int, err error)
+
+// LogProgress returns a Progress logging the number of finished and failed
+// items of an operation described by what, e.g. "deleting images".
+func LogProgress(plog *capnslog.PackageLogger, what string) Progress {
+	failed := 0
+	return func(done, total int, err error) {
+		if err != nil {
+			failed++
+		}
+		plog.Infof("%s: %d/%d done, %d failed", what, done, total, failed)
+	}
+}
+
+// ForEach calls fn for every index in [0, n) with at most limit calls
+// running concurrently. Unlike a WorkerGroup, a failing item doesn't abort
+// the others, which suits bulk operations like deleting or copying
+// resources in many regions. The returned error aggregates the errors of
+// all failed items. progress may be nil; calls to it are serialized.
+func ForEach(ctx context.Context, limit, n int, fn func(ctx context.Context, i int) error, progress Progress) error {
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		done   int
+		errors multierror.Error
+	)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return append(errors, ctx.Err()).AsError()
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := fn(ctx, i)
+			<-sem
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil {
+				errors = append(errors, err)
+			}
+			if progress != nil {
+				progress(done, n, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.AsError()
+}
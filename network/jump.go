@@ -5,28 +5,49 @@ package network
 import (
 	"fmt"
 	"io/ioutil"
+	"os/user"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// NewJumpDialer initializes a RetryDialer with SSH Proxy Jump.
-func NewJumpDialer(addr, user, keyfile string) (*RetryDialer, error) {
-	key, err := ioutil.ReadFile(keyfile)
-	if err != nil {
-		return nil, fmt.Errorf("reading private key: %w", err)
+// NewJumpDialer initializes a RetryDialer with SSH Proxy Jump. If keyfile
+// is empty, the keys of the SSH agent of the user are used, see
+// LocalAgent, and if username is empty, the name of the local user.
+func NewJumpDialer(addr, username, keyfile string) (*RetryDialer, error) {
+	var auth ssh.AuthMethod
+	if keyfile != "" {
+		key, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing private key: %w", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else {
+		a, err := LocalAgent()
+		if err != nil {
+			return nil, err
+		}
+		auth = ssh.PublicKeysCallback(a.Signers)
 	}
 
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return nil, fmt.Errorf("parsing private key: %w", err)
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("looking up the local user: %w", err)
+		}
+		username = u.Username
 	}
 
 	cfg := &ssh.ClientConfig{
-		User: user,
+		User: username,
 		// this is only used for testing - it's ok to live with that.
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
+			auth,
 		},
 	}
 
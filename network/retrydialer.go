@@ -17,6 +17,8 @@ package network
 import (
 	"net"
 	"time"
+
+	"github.com/flatcar/mantle/util"
 )
 
 const (
@@ -28,13 +30,23 @@ const (
 
 	// DefaultRetries sets the default number of retries for RetryDialer.
 	DefaultRetries = 7
+
+	// DefaultBackoff sets the default delay after the first failed try
+	// of RetryDialer, doubled after each further try.
+	DefaultBackoff = 250 * time.Millisecond
+
+	// DefaultMaxBackoff sets the default maximum delay between tries of
+	// RetryDialer.
+	DefaultMaxBackoff = 4 * time.Second
 )
 
 // RetryDialer is intended to timeout quickly and retry connecting instead
 // of just failing. Particularly useful for waiting on a booting machine.
 type RetryDialer struct {
 	Dialer
-	Retries int
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
 }
 
 // NewRetryDialer initializes a RetryDialer with reasonable default settings.
@@ -44,17 +56,19 @@ func NewRetryDialer() *RetryDialer {
 			Timeout:   DefaultTimeout,
 			KeepAlive: DefaultKeepAlive,
 		},
-		Retries: DefaultRetries,
+		Retries:    DefaultRetries,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
 	}
 }
 
-// Dial connects to a remote address, retrying on failure.
+// Dial connects to a remote address, retrying on failure with an
+// exponential backoff.
 func (d *RetryDialer) Dial(network, address string) (c net.Conn, err error) {
-	for i := 0; i < d.Retries; i++ {
+	err = util.RetryBackoff(d.Retries, d.Backoff, d.MaxBackoff, func(error) bool { return true }, func() error {
+		var err error
 		c, err = d.Dialer.Dial(network, address)
-		if err == nil {
-			return
-		}
-	}
+		return err
+	})
 	return
 }
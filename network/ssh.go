@@ -22,15 +22,24 @@ import (
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/flatcar/mantle/util"
 )
 
 const (
 	defaultPort = 22
 	defaultUser = "core"
 	rsaKeySize  = 2048
+
+	// handshakeRetries is the number of tries to establish an SSH
+	// connection when the handshake fails with a transient error.
+	handshakeRetries = 4
+	handshakeBackoff = 500 * time.Millisecond
+	handshakeMaxWait = 4 * time.Second
 )
 
 // Dialer is an interface for anything compatible with net.Dialer
@@ -104,6 +113,19 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	return a, nil
 }
 
+// LocalAgent connects to the SSH agent of the user at $SSH_AUTH_SOCK.
+func LocalAgent() (agent.ExtendedAgent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("no SSH agent: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the SSH agent: %w", err)
+	}
+	return agent.NewClient(conn), nil
+}
+
 // Close closes the unix socket of the agent.
 func (a *SSHAgent) Close() error {
 	a.listener.Close()
@@ -126,24 +148,32 @@ func ensurePortSuffix(host string, port int) string {
 	}
 }
 
-func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*ssh.Client, error) {
+func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (client *ssh.Client, err error) {
 	sshcfg := ssh.ClientConfig{
 		User:            user,
 		Auth:            auth,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 	addr := ensurePortSuffix(host, defaultPort)
-	tcpconn, err := a.Dial("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
+	err = util.RetryBackoff(handshakeRetries, handshakeBackoff, handshakeMaxWait, isTransientSSHError, func() error {
+		tcpconn, err := a.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
 
-	sshconn, chans, reqs, err := ssh.NewClientConn(tcpconn, addr, &sshcfg)
+		sshconn, chans, reqs, err := ssh.NewClientConn(tcpconn, addr, &sshcfg)
+		if err != nil {
+			tcpconn.Close()
+			return err
+		}
+
+		client = ssh.NewClient(sshconn, chans, reqs)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	client := ssh.NewClient(sshconn, chans, reqs)
 	err = agent.ForwardToAgent(client, a)
 	if err != nil {
 		client.Close()
@@ -153,6 +183,15 @@ func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*
 	return client, nil
 }
 
+// isTransientSSHError reports whether err is one of the errors seen while
+// sshd is still starting or restarting, like a connection reset during the
+// handshake.
+func isTransientSSHError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset by peer") ||
+		strings.HasSuffix(msg, "EOF")
+}
+
 // NewClient connects to the given host via SSH, the client will support
 // agent forwarding but it must also be enabled per-session.
 func (a *SSHAgent) NewClient(host string) (*ssh.Client, error) {
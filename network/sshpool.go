@@ -0,0 +1,206 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultKeepAliveInterval is how often ClientPool checks that a
+	// shared connection is alive.
+	DefaultKeepAliveInterval = 10 * time.Second
+
+	// DefaultKeepAliveTimeout is how long ClientPool waits for the reply
+	// to a keepalive before closing the connection.
+	DefaultKeepAliveTimeout = 15 * time.Second
+)
+
+// ClientPool keeps one SSH connection per host and multiplexes sessions
+// over it, instead of connecting for every command. Connections are
+// checked with keepalives and closed when the host stops replying, e.g.
+// because it rebooted, after which the next session reconnects.
+type ClientPool struct {
+	dial func(host string) (*ssh.Client, error)
+
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+
+	lock    sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	*ssh.Client
+	done chan struct{}
+}
+
+func (c *pooledClient) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// NewClientPool returns a ClientPool connecting to hosts with dial.
+func NewClientPool(dial func(host string) (*ssh.Client, error)) *ClientPool {
+	return &ClientPool{
+		dial:              dial,
+		KeepAliveInterval: DefaultKeepAliveInterval,
+		KeepAliveTimeout:  DefaultKeepAliveTimeout,
+		clients:           make(map[string]*pooledClient),
+	}
+}
+
+// client returns the shared connection to host, connecting if there is
+// none or it was lost.
+func (p *ClientPool) client(host string) (*pooledClient, error) {
+	p.lock.Lock()
+	c, ok := p.clients[host]
+	p.lock.Unlock()
+	if ok && c.alive() {
+		return c, nil
+	}
+
+	// dial without holding the lock, it can take a while
+	client, err := p.dial(host)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if c, ok := p.clients[host]; ok && c.alive() {
+		// connected concurrently
+		client.Close()
+		return c, nil
+	}
+	c = &pooledClient{
+		Client: client,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		c.Wait()
+		close(c.done)
+	}()
+	go p.keepAlive(c)
+	p.clients[host] = c
+	return c, nil
+}
+
+func (p *ClientPool) keepAlive(c *pooledClient) {
+	ticker := time.NewTicker(p.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := c.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case err := <-reply:
+			if err != nil {
+				c.Close()
+				return
+			}
+		case <-time.After(p.KeepAliveTimeout):
+			c.Close()
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// NewSession opens a session to host over the shared connection. If the
+// connection was lost it reconnects once, and if the host refuses more
+// sessions on the connection it uses a separate one. The returned
+// function closes the session and must be called when done with it.
+func (p *ClientPool) NewSession(host string) (*ssh.Session, func(), error) {
+	var err error
+	for try := 0; try < 2; try++ {
+		var c *pooledClient
+		c, err = p.client(host)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var session *ssh.Session
+		session, err = c.NewSession()
+		if err == nil {
+			return session, func() { session.Close() }, nil
+		}
+
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			// sshd limits the sessions per connection
+			// (MaxSessions)
+			return p.dedicatedSession(host)
+		}
+
+		// the connection is dead, reconnect
+		c.Close()
+		<-c.done
+	}
+	return nil, nil, err
+}
+
+func (p *ClientPool) dedicatedSession(host string) (*ssh.Session, func(), error) {
+	client, err := p.dial(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return session, func() {
+		session.Close()
+		client.Close()
+	}, nil
+}
+
+// Drop closes the shared connection to host, if any.
+func (p *ClientPool) Drop(host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if c, ok := p.clients[host]; ok {
+		c.Close()
+		delete(p.clients, host)
+	}
+}
+
+// Close closes all shared connections.
+func (p *ClientPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for host, c := range p.clients {
+		c.Close()
+		delete(p.clients, host)
+	}
+}
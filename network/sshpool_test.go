@@ -0,0 +1,70 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/network/mockssh"
+)
+
+func TestClientPool(t *testing.T) {
+	var clients []*ssh.Client
+	pool := NewClientPool(func(host string) (*ssh.Client, error) {
+		c := mockssh.NewMockClient(func(s *mockssh.Session) {
+			s.Stdout.Write([]byte(s.Exec))
+			s.Exit(0)
+		})
+		clients = append(clients, c)
+		return c, nil
+	})
+	defer pool.Close()
+
+	run := func(cmd string) {
+		session, done, err := pool.NewSession("host")
+		if err != nil {
+			t.Fatalf("NewSession failed: %v", err)
+		}
+		defer done()
+		out, err := session.Output(cmd)
+		if err != nil {
+			t.Fatalf("running %q failed: %v", cmd, err)
+		}
+		if string(out) != cmd {
+			t.Errorf("got output %q, want %q", out, cmd)
+		}
+	}
+
+	run("true")
+	run("uptime")
+	if len(clients) != 1 {
+		t.Fatalf("expected one connection to be shared, got %d", len(clients))
+	}
+
+	// a lost connection, e.g. after a reboot, is replaced
+	clients[0].Close()
+	run("uptime")
+	if len(clients) != 2 {
+		t.Fatalf("expected a reconnect, got %d connections", len(clients))
+	}
+
+	pool.Drop("host")
+	run("true")
+	if len(clients) != 3 {
+		t.Fatalf("expected a new connection after Drop, got %d connections", len(clients))
+	}
+}
@@ -31,26 +31,22 @@ type releaseAMIs struct {
 }
 
 var amiCache struct {
-	alphaOnce sync.Once
-	alphaAMIs *releaseAMIs
-
-	betaOnce sync.Once
-	betaAMIs *releaseAMIs
-
-	stableOnce sync.Once
-	stableAMIs *releaseAMIs
+	sync.Mutex
+	// channel AMIs by "channel/board"
+	amis map[string]*releaseAMIs
 }
 
 // resolveAMI is used to minimize network requests while allowing resolution of
-// release channels to specific AMI ids.
+// release channels to specific AMI ids for the given board.
 // If any issue occurs attempting to resolve a given AMI, e.g. a network error,
 // this method panics.
-func resolveAMI(ami string, region string) string {
+func resolveAMI(ami, region, board string) string {
 	resolveChannel := func(channel string) *releaseAMIs {
-		resp, err := http.DefaultClient.Get(fmt.Sprintf("https://%s.release.flatcar-linux.net/amd64-usr/current/flatcar_production_ami_all.json", channel))
+		resp, err := http.DefaultClient.Get(fmt.Sprintf("https://%s.release.flatcar-linux.net/%s/current/flatcar_production_ami_all.json", channel, board))
 		if err != nil {
 			panic(fmt.Errorf("unable to fetch %v AMI json: %v", channel, err))
 		}
+		defer resp.Body.Close()
 
 		var amis releaseAMIs
 		err = json.NewDecoder(resp.Body).Decode(&amis)
@@ -60,31 +56,31 @@ func resolveAMI(ami string, region string) string {
 		return &amis
 	}
 
-	var channelAmis *releaseAMIs
 	switch ami {
-	case "alpha":
-		amiCache.alphaOnce.Do(func() {
-			amiCache.alphaAMIs = resolveChannel(ami)
-		})
-		channelAmis = amiCache.alphaAMIs
-	case "beta":
-		amiCache.betaOnce.Do(func() {
-			amiCache.betaAMIs = resolveChannel(ami)
-		})
-		channelAmis = amiCache.betaAMIs
-	case "stable":
-		amiCache.stableOnce.Do(func() {
-			amiCache.stableAMIs = resolveChannel(ami)
-		})
-		channelAmis = amiCache.stableAMIs
+	case "alpha", "beta", "stable", "lts":
 	default:
 		return ami
 	}
+	if board == "" {
+		board = "amd64-usr"
+	}
+
+	amiCache.Lock()
+	key := ami + "/" + board
+	if amiCache.amis == nil {
+		amiCache.amis = make(map[string]*releaseAMIs)
+	}
+	channelAmis, ok := amiCache.amis[key]
+	if !ok {
+		channelAmis = resolveChannel(ami)
+		amiCache.amis[key] = channelAmis
+	}
+	amiCache.Unlock()
 
-	for _, ami := range channelAmis.AMIS {
-		if ami.Name == region {
-			return ami.HVM
+	for _, a := range channelAmis.AMIS {
+		if a.Name == region {
+			return a.HVM
 		}
 	}
-	panic(fmt.Sprintf("could not find %v ami in %+v", ami, amiCache.alphaAMIs.AMIS))
+	panic(fmt.Sprintf("could not find %v %v ami in %+v", ami, board, channelAmis.AMIS))
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -29,6 +30,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/throttle"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/aws")
@@ -42,12 +44,27 @@ type Options struct {
 	CredentialsFile string
 	// The profile to use when resolving credentials, if applicable
 	Profile string
+	// Profiles, if set, are used instead of Profile to distribute the
+	// clusters of a flight round-robin across several accounts.
+	Profiles []string
 
 	// AccessKeyID is the optional access key to use. It will override all other sources
 	AccessKeyID string
 	// SecretKey is the optional secret key to use. It will override all other sources
 	SecretKey string
 
+	// RoleARN is the optional IAM role to assume with the credentials
+	// resolved above or, if WebIdentityTokenFile is set, with a web
+	// identity token.
+	RoleARN string
+	// ExternalID is passed when assuming RoleARN, if the role requires it.
+	ExternalID string
+	// RoleSessionName names the role session, defaults to "mantle".
+	RoleSessionName string
+	// WebIdentityTokenFile is the path to an OIDC token to assume RoleARN
+	// with, or WebIdentityGitHubActions to request one from GitHub Actions.
+	WebIdentityTokenFile string
+
 	// AMI is the AWS AMI to launch EC2 instances with.
 	// If it is one of the special strings alpha|beta|stable, it will be resolved
 	// to an actual ID.
@@ -55,6 +72,18 @@ type Options struct {
 	InstanceType       string
 	SecurityGroup      string
 	IAMInstanceProfile string
+	// GPUInstanceType is the instance type for tests requiring a GPU,
+	// if empty one with an NVIDIA GPU for the architecture of the board.
+	GPUInstanceType string
+	// IMDSv2Only launches instances which require session tokens for the
+	// instance metadata service.
+	IMDSv2Only bool
+	// Spot launches spot instances, falling back to on-demand instances
+	// if there is no spot capacity.
+	Spot bool
+	// SpotMaxPrice is the maximum hourly price for spot instances,
+	// defaults to the on-demand price.
+	SpotMaxPrice string
 }
 
 type API struct {
@@ -68,30 +97,57 @@ type API struct {
 
 // New creates a new AWS API wrapper. It uses credentials from any of the
 // standard credentials sources, including the environment and the profile
-// configured in ~/.aws.
+// configured in ~/.aws, which may use SSO, a web identity token or a role.
+// If opts.RoleARN is set, that role is assumed on top.
 // No validation is done that credentials exist and before using the API a
 // preflight check is recommended via api.PreflightCheck
 // Note that this method may modify Options to update the AMI ID
 func New(opts *Options) (*API, error) {
-	awsCfg := aws.Config{Region: aws.String(opts.Region)}
+	awsCfg := aws.Config{
+		Region: aws.String(opts.Region),
+		// the default retryer backs off with jitter, but gives up on
+		// throttled calls too early for large parallel runs
+		Retryer: client.DefaultRetryer{
+			NumMaxRetries:    throttle.MaxRetries,
+			MinThrottleDelay: throttle.MinDelay,
+			MaxThrottleDelay: throttle.MaxDelay,
+		},
+	}
+	// without static keys the session resolves the credentials itself, so
+	// that profiles with SSO, roles or credential processes work
+	var sharedConfigFiles []string
 	if opts.AccessKeyID != "" {
 		awsCfg.Credentials = credentials.NewStaticCredentials(opts.AccessKeyID, opts.SecretKey, "")
 	} else if opts.CredentialsFile != "" {
-		awsCfg.Credentials = credentials.NewSharedCredentials(opts.CredentialsFile, opts.Profile)
-	} else {
-		awsCfg.Credentials = credentials.NewEnvCredentials()
+		sharedConfigFiles = []string{defaults.SharedConfigFilename(), opts.CredentialsFile}
 	}
 
 	sess, err := session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: sharedConfigFiles,
 		Profile:           opts.Profile,
 		Config:            awsCfg,
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	opts.AMI = resolveAMI(opts.AMI, opts.Region)
+	roleCreds, err := roleCredentials(sess, opts)
+	if err != nil {
+		return nil, err
+	}
+	if roleCreds != nil {
+		sess = sess.Copy(&aws.Config{Credentials: roleCreds})
+	}
+	sess.Handlers.Send.PushFront(throttleHandler)
+	sess.Handlers.Retry.PushBack(throttledHandler)
+	sess.Handlers.Complete.PushBack(auditHandler)
+	sess.Handlers.Complete.PushBack(metricsHandler)
+
+	var board string
+	if opts.Options != nil {
+		board = opts.Board
+	}
+	opts.AMI = resolveAMI(opts.AMI, opts.Region, board)
 
 	api := &API{
 		session:     sess,
@@ -105,10 +161,21 @@ func New(opts *Options) (*API, error) {
 	return api, nil
 }
 
-// GC removes AWS resources that are at least gracePeriod old.
-// It attempts to only operate on resources that were created by a mantle tool.
+// GC removes AWS resources that are at least gracePeriod old: instances,
+// detached volumes, key pairs and images. It only operates on resources
+// tagged CreatedBy=mantle. The security group and its network are shared
+// by the runs and kept.
 func (a *API) GC(gracePeriod time.Duration) error {
-	return a.gcEC2(gracePeriod)
+	if err := a.gcEC2(gracePeriod); err != nil {
+		return err
+	}
+	if err := a.gcVolumes(gracePeriod); err != nil {
+		return err
+	}
+	if err := a.gcKeyPairs(gracePeriod); err != nil {
+		return err
+	}
+	return a.gcImages(gracePeriod)
 }
 
 // PreflightCheck validates that the aws configuration provided has valid
@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/metrics"
+	"github.com/flatcar/mantle/platform/throttle"
+)
+
+// throttleHandler delays each attempt of a request until the API rate
+// budget of the service allows it.
+func throttleHandler(r *request.Request) {
+	if err := throttle.Wait(r.Context(), r.ClientInfo.ServiceName); err != nil {
+		r.Error = awserr.New(request.CanceledErrorCode, "waiting for the API rate budget", err)
+		r.Retryable = aws.Bool(false)
+	}
+}
+
+// throttledHandler counts requests retried because of rate limits.
+func throttledHandler(r *request.Request) {
+	if request.IsErrorThrottle(r.Error) {
+		metrics.APIThrottled(r.ClientInfo.ServiceName)
+	}
+}
+
+// metricsHandler counts requests and their failures in the run metrics.
+func metricsHandler(r *request.Request) {
+	metrics.APICall(r.ClientInfo.ServiceName, r.Error != nil)
+}
+
+// auditHandler records mutating requests in the audit log.
+func auditHandler(r *request.Request) {
+	if r.Operation == nil || !audit.IsMutatingAction(r.Operation.Name) || !audit.Enabled() {
+		return
+	}
+	ids := make(map[string]bool)
+	var resources []string
+	collect := func(id string) {
+		if id != "" && !ids[id] {
+			ids[id] = true
+			resources = append(resources, id)
+		}
+	}
+	resourceIDs(reflect.ValueOf(r.Params), "", collect, 0)
+	resourceIDs(reflect.ValueOf(r.Data), "", collect, 0)
+	audit.Record(r.ClientInfo.ServiceName, r.Operation.Name, resources, r.Error)
+}
+
+// resourceIDs walks the input or output shape of a request and passes the
+// values of all fields naming resources (e.g. InstanceId, GroupIds,
+// RoleName, Bucket and Key) to fn.
+func resourceIDs(v reflect.Value, field string, fn func(string), depth int) {
+	if depth > 8 || !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			resourceIDs(v.Elem(), field, fn, depth+1)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			resourceIDs(v.Field(i), t.Field(i).Name, fn, depth+1)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			resourceIDs(v.Index(i), field, fn, depth+1)
+		}
+	case reflect.String:
+		if isResourceField(field) {
+			fn(v.String())
+		}
+	}
+}
+
+func isResourceField(name string) bool {
+	switch name {
+	case "Bucket", "Key", "Arn":
+		return true
+	}
+	for _, suffix := range []string{"Id", "Ids", "Arn", "Name"} {
+		if strings.HasSuffix(name, suffix) {
+			// skip names of devices, zones and the like which
+			// don't identify a resource owned by the account
+			return !strings.HasSuffix(name, "DeviceName") &&
+				!strings.HasSuffix(name, "ZoneName") &&
+				name != "ClientToken"
+		}
+	}
+	return false
+}
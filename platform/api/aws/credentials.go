@@ -0,0 +1,113 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	// WebIdentityGitHubActions as Options.WebIdentityTokenFile requests
+	// the web identity token from GitHub Actions instead of reading it
+	// from a file.
+	WebIdentityGitHubActions = "github-actions"
+
+	defaultRoleSessionName = "mantle"
+	webIdentityAudience    = "sts.amazonaws.com"
+)
+
+// roleCredentials returns the credentials of opts.RoleARN, assumed with the
+// web identity token of opts.WebIdentityTokenFile or, without one, with the
+// credentials of sess. It returns nil if no role is set.
+func roleCredentials(sess *session.Session, opts *Options) (*credentials.Credentials, error) {
+	if opts.RoleARN == "" {
+		if opts.WebIdentityTokenFile != "" || opts.ExternalID != "" {
+			return nil, fmt.Errorf("a web identity token or external ID requires a role ARN")
+		}
+		return nil, nil
+	}
+
+	sessionName := opts.RoleSessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+
+	if opts.WebIdentityTokenFile != "" {
+		if opts.ExternalID != "" {
+			return nil, fmt.Errorf("an external ID can't be used with a web identity token")
+		}
+		var fetcher stscreds.TokenFetcher = stscreds.FetchTokenPath(opts.WebIdentityTokenFile)
+		if opts.WebIdentityTokenFile == WebIdentityGitHubActions {
+			fetcher = githubActionsToken{}
+		}
+		p := stscreds.NewWebIdentityRoleProviderWithOptions(sts.New(sess), opts.RoleARN, sessionName, fetcher)
+		return credentials.NewCredentials(p), nil
+	}
+
+	return stscreds.NewCredentials(sess, opts.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = sessionName
+		if opts.ExternalID != "" {
+			p.ExternalID = &opts.ExternalID
+		}
+	}), nil
+}
+
+// githubActionsToken fetches OIDC tokens for STS from the token service of
+// GitHub Actions, available to jobs with the id-token: write permission.
+type githubActionsToken struct{}
+
+func (githubActionsToken) FetchToken(ctx credentials.Context) ([]byte, error) {
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	if requestURL == "" {
+		return nil, fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL is not set")
+	}
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("audience", webIdentityAudience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting GitHub Actions token: %s", resp.Status)
+	}
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return []byte(body.Value), nil
+}
@@ -16,6 +16,7 @@ package aws
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -24,6 +25,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 
+	"github.com/flatcar/mantle/lang/maps"
+	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/util"
 )
 
@@ -31,6 +34,17 @@ func (a *API) AddKey(name, key string) error {
 	_, err := a.ec2.ImportKeyPair(&ec2.ImportKeyPairInput{
 		KeyName:           &name,
 		PublicKeyMaterial: []byte(key),
+		TagSpecifications: []*ec2.TagSpecification{
+			&ec2.TagSpecification{
+				ResourceType: aws.String(ec2.ResourceTypeKeyPair),
+				Tags: []*ec2.Tag{
+					&ec2.Tag{
+						Key:   aws.String("CreatedBy"),
+						Value: aws.String("mantle"),
+					},
+				},
+			},
+		},
 	})
 
 	return err
@@ -44,8 +58,20 @@ func (a *API) DeleteKey(name string) error {
 	return err
 }
 
-// CreateInstances creates EC2 instances with a given name tag, optional ssh key name, user data. The image ID, instance type, and security group set in the API will be used. CreateInstances will block until all instances are running and have an IP address.
-func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*ec2.Instance, error) {
+// gpuInstanceType returns the instance type of instances with a GPU.
+func (a *API) gpuInstanceType() string {
+	switch {
+	case a.opts.GPUInstanceType != "":
+		return a.opts.GPUInstanceType
+	case a.opts.Board == "arm64-usr":
+		return "g5g.xlarge"
+	default:
+		return "g4dn.xlarge"
+	}
+}
+
+// CreateInstances creates count EC2 instances with a given name tag, optional ssh key name, user data. The image ID, instance type, and security group set in the API will be used. If imdsv2Only or the IMDSv2Only option is set, the instance metadata service requires session tokens. If gpu is set, the instance type of GPU instances is used instead. The instances and their volumes are tagged with tags, in addition to the Name and CreatedBy tags. CreateInstances will block until all instances are running and have an IP address.
+func (a *API) CreateInstances(name, keyname, userdata string, count uint64, imdsv2Only, gpu bool, tags map[string]string) ([]*ec2.Instance, error) {
 	cnt := int64(count)
 
 	var ud *string
@@ -56,22 +82,22 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 
 	err := a.ensureInstanceProfile(a.opts.IAMInstanceProfile)
 	if err != nil {
-		return nil, fmt.Errorf("error verifying IAM instance profile: %v", err)
+		return nil, infraError(fmt.Errorf("error verifying IAM instance profile: %w", err))
 	}
 
 	sgId, err := a.getSecurityGroupID(a.opts.SecurityGroup)
 	if err != nil {
-		return nil, fmt.Errorf("error resolving security group: %v", err)
+		return nil, infraError(fmt.Errorf("error resolving security group: %w", err))
 	}
 
 	vpcId, err := a.getVPCID(sgId)
 	if err != nil {
-		return nil, fmt.Errorf("error resolving vpc: %v", err)
+		return nil, infraError(fmt.Errorf("error resolving vpc: %w", err))
 	}
 
 	subnetIds, err := a.getSubnetIDs(vpcId)
 	if err != nil {
-		return nil, fmt.Errorf("error resolving subnets: %v", err)
+		return nil, infraError(fmt.Errorf("error resolving subnets: %w", err))
 	}
 
 	key := &keyname
@@ -79,6 +105,50 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 		key = nil
 	}
 
+	var metadataOptions *ec2.InstanceMetadataOptionsRequest
+	if imdsv2Only || a.opts.IMDSv2Only {
+		metadataOptions = &ec2.InstanceMetadataOptionsRequest{
+			HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+			HttpTokens:   aws.String(ec2.HttpTokensStateRequired),
+		}
+	}
+
+	instanceTags := []*ec2.Tag{
+		&ec2.Tag{
+			Key:   aws.String("Name"),
+			Value: aws.String(name),
+		},
+		&ec2.Tag{
+			Key:   aws.String("CreatedBy"),
+			Value: aws.String("mantle"),
+		},
+	}
+	for _, k := range maps.SortedKeys(tags) {
+		instanceTags = append(instanceTags, &ec2.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(tags[k]),
+		})
+	}
+
+	var marketOptions *ec2.InstanceMarketOptionsRequest
+	if a.opts.Spot {
+		marketOptions = &ec2.InstanceMarketOptionsRequest{
+			MarketType: aws.String(ec2.MarketTypeSpot),
+			SpotOptions: &ec2.SpotMarketOptions{
+				SpotInstanceType:             aws.String(ec2.SpotInstanceTypeOneTime),
+				InstanceInterruptionBehavior: aws.String(ec2.InstanceInterruptionBehaviorTerminate),
+			},
+		}
+		if a.opts.SpotMaxPrice != "" {
+			marketOptions.SpotOptions.MaxPrice = aws.String(a.opts.SpotMaxPrice)
+		}
+	}
+
+	instanceType := a.opts.InstanceType
+	if gpu {
+		instanceType = a.gpuInstanceType()
+	}
+
 	var reservations *ec2.Reservation
 
 	for _, subnetId := range subnetIds {
@@ -87,26 +157,25 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 			MinCount:         &cnt,
 			MaxCount:         &cnt,
 			KeyName:          key,
-			InstanceType:     &a.opts.InstanceType,
+			InstanceType:     &instanceType,
 			SecurityGroupIds: []*string{&sgId},
 			SubnetId:         &subnetId,
 			UserData:         ud,
 			IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
 				Name: &a.opts.IAMInstanceProfile,
 			},
+			MetadataOptions:       metadataOptions,
+			InstanceMarketOptions: marketOptions,
 			TagSpecifications: []*ec2.TagSpecification{
 				&ec2.TagSpecification{
 					ResourceType: aws.String(ec2.ResourceTypeInstance),
-					Tags: []*ec2.Tag{
-						&ec2.Tag{
-							Key:   aws.String("Name"),
-							Value: aws.String(name),
-						},
-						&ec2.Tag{
-							Key:   aws.String("CreatedBy"),
-							Value: aws.String("mantle"),
-						},
-					},
+					Tags:         instanceTags,
+				},
+				// the volumes outlive the instance if they are not
+				// deleted on termination
+				&ec2.TagSpecification{
+					ResourceType: aws.String(ec2.ResourceTypeVolume),
+					Tags:         instanceTags,
 				},
 			},
 		}
@@ -121,6 +190,11 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 		}, func() error {
 			var ierr error
 			reservations, ierr = a.ec2.RunInstances(&inst)
+			if ierr != nil && inst.InstanceMarketOptions != nil && isSpotCapacityError(ierr) {
+				plog.Warningf("no spot capacity, falling back to on-demand instances: %v", ierr)
+				inst.InstanceMarketOptions = nil
+				reservations, ierr = a.ec2.RunInstances(&inst)
+			}
 			return ierr
 		})
 
@@ -130,7 +204,7 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error running instances: %v", err)
+		return nil, infraError(fmt.Errorf("error running instances: %w", err))
 	}
 
 	ids := make([]string, len(reservations.Instances))
@@ -168,12 +242,83 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 	})
 	if err != nil {
 		a.TerminateInstances(ids)
-		return nil, fmt.Errorf("waiting for instances to run: %v", err)
+		// the instances were accepted, but AWS did not run them
+		return nil, &platform.InfraError{Err: fmt.Errorf("waiting for instances to run: %v", err)}
 	}
 
 	return insts, nil
 }
 
+// isSpotCapacityError returns whether the error of a spot request is
+// caused by missing capacity or a too low price.
+func isSpotCapacityError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch awsErr.Code() {
+	case "InsufficientInstanceCapacity", "SpotMaxPriceTooLow", "MaxSpotInstanceCountExceeded", "UnfulfillableCapacity":
+		return true
+	}
+	return false
+}
+
+// isInfraError reports whether an error of an EC2 call was caused by AWS
+// rather than by the request: throttling, exhausted capacity or quotas,
+// service errors or failures to reach AWS.
+func isInfraError(err error) bool {
+	if platform.IsNetworkError(err) {
+		return true
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && (reqErr.StatusCode() == 429 || reqErr.StatusCode() >= 500) {
+		return true
+	}
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	if isSpotCapacityError(awsErr) {
+		return true
+	}
+	switch awsErr.Code() {
+	case "RequestError", "ResponseTimeout", "RequestLimitExceeded", "Throttling", "ThrottlingException",
+		"InsufficientInstanceCapacity", "InsufficientHostCapacity", "InsufficientCapacity",
+		"InstanceLimitExceeded", "VcpuLimitExceeded", "InsufficientFreeAddressesInSubnet",
+		"AddressLimitExceeded", "Unavailable", "ServiceUnavailable", "InternalError", "InternalFailure":
+		return true
+	}
+	return false
+}
+
+// infraError returns err as platform.InfraError if isInfraError reports it
+// as caused by AWS.
+func infraError(err error) error {
+	if isInfraError(err) {
+		return &platform.InfraError{Err: err}
+	}
+	return err
+}
+
+// SpotInterruption returns the reason if the spot instance was interrupted
+// by AWS, or "" if it is running or was stopped otherwise.
+func (a *API) SpotInterruption(id string) (string, error) {
+	desc, err := a.ec2.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{id}),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, reservation := range desc.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.StateReason != nil && aws.StringValue(instance.StateReason.Code) == "Server.SpotInstanceTermination" {
+				return fmt.Sprintf("spot instance %s interrupted: %s", id, aws.StringValue(instance.StateReason.Message)), nil
+			}
+		}
+	}
+	return "", nil
+}
+
 // gcEC2 will terminate ec2 instances older than gracePeriod.
 // It will only operate on ec2 instances tagged with 'mantle' to avoid stomping
 // on other resources in the account.
@@ -219,6 +364,70 @@ func (a *API) gcEC2(gracePeriod time.Duration) error {
 	return a.TerminateInstances(toTerminate)
 }
 
+// gcVolumes deletes the detached volumes tagged by mantle older than
+// gracePeriod.
+func (a *API) gcVolumes(gracePeriod time.Duration) error {
+	durationAgo := time.Now().Add(-1 * gracePeriod)
+
+	volumes, err := a.ec2.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			&ec2.Filter{
+				Name:   aws.String("tag:CreatedBy"),
+				Values: aws.StringSlice([]string{"mantle"}),
+			},
+			&ec2.Filter{
+				Name:   aws.String("status"),
+				Values: aws.StringSlice([]string{ec2.VolumeStateAvailable}),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error describing volumes: %v", err)
+	}
+
+	for _, volume := range volumes.Volumes {
+		if volume.CreateTime == nil || volume.CreateTime.After(durationAgo) {
+			plog.Debugf("ec2: skipping volume %s due to being too new", *volume.VolumeId)
+			continue
+		}
+		if _, err := a.ec2.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: volume.VolumeId}); err != nil {
+			return fmt.Errorf("couldn't delete volume %v: %v", *volume.VolumeId, err)
+		}
+		plog.Infof("Deleted volume %s", *volume.VolumeId)
+	}
+	return nil
+}
+
+// gcKeyPairs deletes the key pairs tagged by mantle older than
+// gracePeriod.
+func (a *API) gcKeyPairs(gracePeriod time.Duration) error {
+	durationAgo := time.Now().Add(-1 * gracePeriod)
+
+	keys, err := a.ec2.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{
+		Filters: []*ec2.Filter{
+			&ec2.Filter{
+				Name:   aws.String("tag:CreatedBy"),
+				Values: aws.StringSlice([]string{"mantle"}),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error describing key pairs: %v", err)
+	}
+
+	for _, key := range keys.KeyPairs {
+		if key.CreateTime == nil || key.CreateTime.After(durationAgo) {
+			plog.Debugf("ec2: skipping key pair %s due to being too new", *key.KeyName)
+			continue
+		}
+		if err := a.DeleteKey(*key.KeyName); err != nil {
+			return fmt.Errorf("couldn't delete key pair %v: %v", *key.KeyName, err)
+		}
+		plog.Infof("Deleted key pair %s", *key.KeyName)
+	}
+	return nil
+}
+
 // TerminateInstances schedules EC2 instances to be terminated.
 func (a *API) TerminateInstances(ids []string) error {
 	if len(ids) == 0 {
@@ -243,6 +452,24 @@ func (a *API) TerminateInstances(ids []string) error {
 	return nil
 }
 
+// SetMetadataOptions changes whether the instance metadata service of the
+// instances requires session tokens (IMDSv2).
+func (a *API) SetMetadataOptions(ids []string, requireTokens bool) error {
+	tokens := ec2.HttpTokensStateOptional
+	if requireTokens {
+		tokens = ec2.HttpTokensStateRequired
+	}
+	for _, id := range ids {
+		if _, err := a.ec2.ModifyInstanceMetadataOptions(&ec2.ModifyInstanceMetadataOptionsInput{
+			InstanceId: aws.String(id),
+			HttpTokens: aws.String(tokens),
+		}); err != nil {
+			return fmt.Errorf("modifying metadata options of %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
 func (a *API) CreateTags(resources []string, tags map[string]string) error {
 	if len(tags) == 0 {
 		return nil
@@ -15,6 +15,7 @@
 package aws
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -28,6 +29,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
+
+	"github.com/flatcar/mantle/lang/worker"
 )
 
 // The default size of Container Linux disks on AWS, in GiB. See discussion in
@@ -543,13 +546,14 @@ func (a *API) GrantLaunchPermission(imageID string, userIDs []string) error {
 	return nil
 }
 
-func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]string, error) {
-	type result struct {
-		region  string
-		imageID string
-		err     error
-	}
+// MaxConcurrentImageCopies is the number of regions CopyImage copies an
+// image to at the same time.
+const MaxConcurrentImageCopies = 8
 
+// CopyImage copies an image with its tags and launch permissions to the
+// given regions. It returns the IDs of the copies by region, including
+// those of the copies that failed after being started.
+func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]string, error) {
 	image, err := a.describeImage(sourceImageID)
 	if err != nil {
 		return nil, err
@@ -576,38 +580,26 @@ func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]stri
 	}
 	launchPermissions := describeAttributeRes.LaunchPermissions
 
-	var wg sync.WaitGroup
-	ch := make(chan result, len(regions))
-	for _, region := range regions {
+	var mu sync.Mutex
+	amis := make(map[string]string)
+	err = worker.ForEach(context.Background(), MaxConcurrentImageCopies, len(regions), func(ctx context.Context, i int) error {
 		opts := *a.opts
-		opts.Region = region
+		opts.Region = regions[i]
 		aa, err := New(&opts)
 		if err != nil {
-			break
+			return fmt.Errorf("creating client for %v: %v", regions[i], err)
 		}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			res := result{region: aa.opts.Region}
-			res.imageID, res.err = aa.copyImageIn(a.opts.Region, sourceImageID,
-				*image.Name, *image.Description,
-				image.Tags, snapshot.Tags,
-				launchPermissions)
-			ch <- res
-		}()
-	}
-	wg.Wait()
-	close(ch)
-
-	amis := make(map[string]string)
-	for res := range ch {
-		if res.imageID != "" {
-			amis[res.region] = res.imageID
-		}
-		if err == nil {
-			err = res.err
+		imageID, err := aa.copyImageIn(a.opts.Region, sourceImageID,
+			*image.Name, *image.Description,
+			image.Tags, snapshot.Tags,
+			launchPermissions)
+		if imageID != "" {
+			mu.Lock()
+			amis[regions[i]] = imageID
+			mu.Unlock()
 		}
-	}
+		return err
+	}, worker.LogProgress(plog, "copying image "+sourceImageID))
 	return amis, err
 }
 
@@ -638,7 +630,7 @@ func (a *API) copyImageIn(sourceRegion, sourceImageID, name, description string,
 		w.Delay = request.ConstantWaiterDelay(30 * time.Second)
 	})
 	if err != nil {
-		return "", fmt.Errorf("couldn't copy image to %v: %v", a.opts.Region, err)
+		return imageID, fmt.Errorf("couldn't copy image to %v: %v", a.opts.Region, err)
 	}
 
 	if len(imageTags) > 0 {
@@ -647,21 +639,21 @@ func (a *API) copyImageIn(sourceRegion, sourceImageID, name, description string,
 			Tags:      imageTags,
 		})
 		if err != nil {
-			return "", fmt.Errorf("couldn't create image tags: %v", err)
+			return imageID, fmt.Errorf("couldn't create image tags: %v", err)
 		}
 	}
 
 	if len(snapshotTags) > 0 {
 		image, err := a.describeImage(imageID)
 		if err != nil {
-			return "", err
+			return imageID, err
 		}
 		_, err = a.ec2.CreateTags(&ec2.CreateTagsInput{
 			Resources: []*string{image.BlockDeviceMappings[0].Ebs.SnapshotId},
 			Tags:      snapshotTags,
 		})
 		if err != nil {
-			return "", fmt.Errorf("couldn't create snapshot tags: %v", err)
+			return imageID, fmt.Errorf("couldn't create snapshot tags: %v", err)
 		}
 	}
 
@@ -674,7 +666,7 @@ func (a *API) copyImageIn(sourceRegion, sourceImageID, name, description string,
 			},
 		})
 		if err != nil {
-			return "", fmt.Errorf("couldn't grant launch permissions: %v", err)
+			return imageID, fmt.Errorf("couldn't grant launch permissions: %v", err)
 		}
 	}
 
@@ -688,7 +680,7 @@ func (a *API) copyImageIn(sourceRegion, sourceImageID, name, description string,
 	// plume release.
 	_, err = a.FindImage(name)
 	if err != nil {
-		return "", fmt.Errorf("checking for duplicate images: %v", err)
+		return imageID, fmt.Errorf("checking for duplicate images: %v", err)
 	}
 
 	return imageID, nil
@@ -808,6 +800,76 @@ func (a *API) PublishImage(imageID string) error {
 	return nil
 }
 
+// TagImage adds tags to an image and its snapshot.
+func (a *API) TagImage(imageID string, tags map[string]string) error {
+	image, err := a.describeImage(imageID)
+	if err != nil {
+		return err
+	}
+	snapshotID, err := getImageSnapshotID(image)
+	if err != nil {
+		return err
+	}
+	return a.CreateTags([]string{imageID, snapshotID}, tags)
+}
+
+// DeleteImage deregisters an image and deletes its snapshot.
+func (a *API) DeleteImage(imageID string) error {
+	image, err := a.describeImage(imageID)
+	if err != nil {
+		return err
+	}
+	// copies still in progress have no snapshot yet
+	snapshotID, _ := getImageSnapshotID(image)
+	if _, err := a.ec2.DeregisterImage(&ec2.DeregisterImageInput{ImageId: &imageID}); err != nil {
+		return fmt.Errorf("couldn't deregister image %v: %v", imageID, err)
+	}
+	plog.Infof("Deregistered image %s in %s", imageID, a.opts.Region)
+	if snapshotID != "" {
+		if _, err := a.ec2.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: &snapshotID}); err != nil {
+			return fmt.Errorf("couldn't delete snapshot %v: %v", snapshotID, err)
+		}
+		plog.Infof("Deleted snapshot %s in %s", snapshotID, a.opts.Region)
+	}
+	return nil
+}
+
+// gcImages deletes the images owned by the account and tagged by mantle
+// older than gracePeriod, along with their snapshots. Images are not
+// tagged by mantle unless asked to, e.g. by ore aws upload --tags
+// CreatedBy=mantle, as released images must never be collected.
+func (a *API) gcImages(gracePeriod time.Duration) error {
+	durationAgo := time.Now().Add(-1 * gracePeriod)
+
+	images, err := a.ec2.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			&ec2.Filter{
+				Name:   aws.String("tag:CreatedBy"),
+				Values: aws.StringSlice([]string{"mantle"}),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error describing images: %v", err)
+	}
+
+	for _, image := range images.Images {
+		created, err := time.Parse(time.RFC3339, aws.StringValue(image.CreationDate))
+		if err != nil {
+			return fmt.Errorf("couldn't parse creation date of %v: %v", *image.ImageId, err)
+		}
+		if created.After(durationAgo) {
+			plog.Debugf("ec2: skipping image %s due to being too new", *image.ImageId)
+			continue
+		}
+		if err := a.DeleteImage(*image.ImageId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getImageSnapshotID(image *ec2.Image) (string, error) {
 	// The EBS volume is usually listed before the ephemeral volume, but
 	// not always, e.g. ami-fddb0490 or ami-8cd40ce1 in cn-north-1
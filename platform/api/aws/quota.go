@@ -0,0 +1,139 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// vCPUQuota is a Service Quotas limit on the vCPUs of running instances
+// of some instance families.
+type vCPUQuota struct {
+	name           string
+	onDemand, spot string
+}
+
+var (
+	standardQuota = vCPUQuota{"standard (A, C, D, H, I, M, R, T, Z) instance vCPUs", "L-1216C47A", "L-34B43A08"}
+	fQuota        = vCPUQuota{"F instance vCPUs", "L-74FC7D96", "L-88CF9481"}
+	gQuota        = vCPUQuota{"G and VT instance vCPUs", "L-DB2E81BA", "L-3819A6DF"}
+	infQuota      = vCPUQuota{"Inf instance vCPUs", "L-1945791B", "L-B5D1601B"}
+	pQuota        = vCPUQuota{"P instance vCPUs", "L-417A185B", "L-7212CCBC"}
+	xQuota        = vCPUQuota{"X instance vCPUs", "L-7295265B", "L-E3A00192"}
+
+	// vCPUQuotas maps the instance family prefix of an instance type to
+	// its quota
+	vCPUQuotas = map[string]vCPUQuota{
+		"a": standardQuota, "c": standardQuota, "d": standardQuota,
+		"h": standardQuota, "i": standardQuota, "m": standardQuota,
+		"r": standardQuota, "t": standardQuota, "z": standardQuota,
+		"f": fQuota, "g": gQuota, "vt": gQuota, "inf": infQuota,
+		"p": pQuota, "x": xQuota,
+	}
+)
+
+// instanceFamily returns the letters before the generation of an instance
+// type, e.g. "inf" for "inf1.xlarge".
+func instanceFamily(instanceType string) string {
+	if i := strings.IndexFunc(instanceType, unicode.IsDigit); i >= 0 {
+		return instanceType[:i]
+	}
+	return instanceType
+}
+
+// CheckQuota checks that the vCPU quota of the instance family of the
+// configured instance type leaves room for the given number of instances.
+func (a *API) CheckQuota(machines int) error {
+	quota, ok := vCPUQuotas[instanceFamily(a.opts.InstanceType)]
+	if !ok {
+		plog.Warningf("not checking quota of unknown instance family of %s", a.opts.InstanceType)
+		return nil
+	}
+	code := quota.onDemand
+	if a.opts.Spot {
+		code = quota.spot
+	}
+
+	res, err := servicequotas.New(a.session).GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("ec2"),
+		QuotaCode:   aws.String(code),
+	})
+	if err != nil {
+		return fmt.Errorf("getting quota %s: %v", code, err)
+	}
+	if res.Quota == nil {
+		return fmt.Errorf("no value for quota %s", code)
+	}
+
+	types, err := a.ec2.DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []*string{aws.String(a.opts.InstanceType)},
+	})
+	if err != nil {
+		return fmt.Errorf("describing instance type %s: %v", a.opts.InstanceType, err)
+	}
+	if len(types.InstanceTypes) == 0 || types.InstanceTypes[0].VCpuInfo == nil {
+		return fmt.Errorf("no vCPU information for instance type %s", a.opts.InstanceType)
+	}
+	vcpus := aws.Int64Value(types.InstanceTypes[0].VCpuInfo.DefaultVCpus)
+
+	// the quota counts the vCPUs of all running instances of the families
+	var usage int64
+	err = a.ec2.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{"pending", "running"}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			for _, inst := range r.Instances {
+				if vCPUQuotas[instanceFamily(aws.StringValue(inst.InstanceType))] != quota {
+					continue
+				}
+				spot := aws.StringValue(inst.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot
+				if spot != a.opts.Spot || inst.CpuOptions == nil {
+					continue
+				}
+				usage += aws.Int64Value(inst.CpuOptions.CoreCount) * aws.Int64Value(inst.CpuOptions.ThreadsPerCore)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("describing instances: %v", err)
+	}
+
+	name := quota.name
+	if a.opts.Spot {
+		name = "spot " + name
+	}
+	return platform.CheckQuotas([]platform.Quota{
+		{
+			Name:  fmt.Sprintf("%s in %s", name, a.opts.Region),
+			Limit: aws.Float64Value(res.Quota.Value),
+			Usage: float64(usage),
+			Need:  float64(int64(machines) * vcpus),
+		},
+	})
+}
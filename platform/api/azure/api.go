@@ -15,8 +15,10 @@
 package azure
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -29,29 +31,40 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2020-10-01/resources"
 	armStorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
 	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/coreos/pkg/capnslog"
 
 	internalAuth "github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/lang/worker"
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/throttle"
 )
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/azure")
 )
 
+// maxConcurrentRequests limits bulk operations like GC so they don't
+// exhaust the ARM request quota.
+const maxConcurrentRequests = 8
+
 type API struct {
-	client      management.Client
-	rgClient    resources.GroupsClient
-	depClient   resources.DeploymentsClient
-	imgClient   compute.ImagesClient
-	compClient  compute.VirtualMachinesClient
-	vmImgClient compute.VirtualMachineImagesClient
-	netClient   network.VirtualNetworksClient
-	subClient   network.SubnetsClient
-	ipClient    network.PublicIPAddressesClient
-	intClient   network.InterfacesClient
-	accClient   armStorage.AccountsClient
-	Opts        *Options
+	client       management.Client
+	rgClient     resources.GroupsClient
+	depClient    resources.DeploymentsClient
+	imgClient    compute.ImagesClient
+	compClient   compute.VirtualMachinesClient
+	vmImgClient  compute.VirtualMachineImagesClient
+	skuClient    compute.ResourceSkusClient
+	usgClient    compute.UsageClient
+	netClient    network.VirtualNetworksClient
+	subClient    network.SubnetsClient
+	ipClient     network.PublicIPAddressesClient
+	intClient    network.InterfacesClient
+	netUsgClient network.UsagesClient
+	accClient    armStorage.AccountsClient
+	Opts         *Options
 }
 
 type Network struct {
@@ -61,6 +74,12 @@ type Network struct {
 // New creates a new Azure client. If no publish settings file is provided or
 // can't be parsed, an anonymous client is created.
 func New(opts *Options) (*API, error) {
+	switch opts.SecurityType {
+	case "", SecurityTypeTrustedLaunch, SecurityTypeConfidentialVM:
+	default:
+		return nil, fmt.Errorf("invalid Azure security type %q: must be %q or %q", opts.SecurityType, SecurityTypeTrustedLaunch, SecurityTypeConfidentialVM)
+	}
+
 	conf := management.DefaultConfig()
 	conf.APIVersion = "2015-04-01"
 
@@ -72,17 +91,25 @@ func New(opts *Options) (*API, error) {
 		opts.StorageEndpointSuffix = storage.DefaultBaseURL
 	}
 
-	profiles, err := internalAuth.ReadAzureProfile(opts.AzureProfile)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read Azure profile: %v", err)
+	if err := checkCredentials(opts); err != nil {
+		return nil, err
 	}
 
-	subOpts := profiles.SubscriptionOptions(opts.AzureSubscription)
-	if subOpts == nil {
-		return nil, fmt.Errorf("Azure subscription named %q doesn't exist in %q", opts.AzureSubscription, opts.AzureProfile)
+	// without a credentials file the profile is optional
+	subOpts := &internalAuth.Options{}
+	if usesCredentialsFile(opts) || opts.AzureProfile != "" {
+		profiles, err := internalAuth.ReadAzureProfile(opts.AzureProfile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Azure profile: %v", err)
+		}
+
+		subOpts = profiles.SubscriptionOptions(opts.AzureSubscription)
+		if subOpts == nil {
+			return nil, fmt.Errorf("Azure subscription named %q doesn't exist in %q", opts.AzureSubscription, opts.AzureProfile)
+		}
 	}
 
-	if os.Getenv("AZURE_AUTH_LOCATION") == "" {
+	if usesCredentialsFile(opts) && os.Getenv("AZURE_AUTH_LOCATION") == "" {
 		if opts.AzureAuthLocation == "" {
 			user, err := user.Current()
 			if err != nil {
@@ -97,6 +124,9 @@ func New(opts *Options) (*API, error) {
 	if opts.SubscriptionID == "" {
 		opts.SubscriptionID = subOpts.SubscriptionID
 	}
+	if opts.SubscriptionID == "" {
+		return nil, fmt.Errorf("Azure %s credentials need a subscription ID", opts.Credentials)
+	}
 
 	if opts.SubscriptionName == "" {
 		opts.SubscriptionName = subOpts.SubscriptionName
@@ -115,6 +145,7 @@ func New(opts *Options) (*API, error) {
 	}
 
 	var client management.Client
+	var err error
 	if opts.ManagementCertificate != nil {
 		client, err = management.NewClientFromConfig(opts.SubscriptionID, opts.ManagementCertificate, conf)
 		if err != nil {
@@ -138,54 +169,89 @@ func New(opts *Options) (*API, error) {
 }
 
 func (a *API) SetupClients() error {
-	auther, err := auth.NewAuthorizerFromFile(resources.DefaultBaseURI)
+	auther, err := a.newAuthorizer(resources.DefaultBaseURI)
 	if err != nil {
 		return err
 	}
-	settings, err := auth.GetSettingsFromFile()
-	if err != nil {
-		return err
+	subscriptionID := a.Opts.SubscriptionID
+	if usesCredentialsFile(a.Opts) {
+		settings, err := auth.GetSettingsFromFile()
+		if err != nil {
+			return err
+		}
+		subscriptionID = settings.GetSubscriptionID()
 	}
-	a.rgClient = resources.NewGroupsClient(settings.GetSubscriptionID())
+	a.rgClient = resources.NewGroupsClient(subscriptionID)
 	a.rgClient.Authorizer = auther
+	a.rgClient.Sender = apiSender(a.rgClient.Sender)
 
-	a.depClient = resources.NewDeploymentsClient(settings.GetSubscriptionID())
+	a.depClient = resources.NewDeploymentsClient(subscriptionID)
 	a.depClient.Authorizer = auther
+	a.depClient.Sender = apiSender(a.depClient.Sender)
 
-	auther, err = auth.NewAuthorizerFromFile(compute.DefaultBaseURI)
+	auther, err = a.newAuthorizer(compute.DefaultBaseURI)
 	if err != nil {
 		return err
 	}
-	a.imgClient = compute.NewImagesClient(settings.GetSubscriptionID())
+	a.imgClient = compute.NewImagesClient(subscriptionID)
 	a.imgClient.Authorizer = auther
-	a.compClient = compute.NewVirtualMachinesClient(settings.GetSubscriptionID())
+	a.imgClient.Sender = apiSender(a.imgClient.Sender)
+	a.compClient = compute.NewVirtualMachinesClient(subscriptionID)
 	a.compClient.Authorizer = auther
-	a.vmImgClient = compute.NewVirtualMachineImagesClient(settings.GetSubscriptionID())
+	a.compClient.Sender = apiSender(a.compClient.Sender)
+	a.vmImgClient = compute.NewVirtualMachineImagesClient(subscriptionID)
 	a.vmImgClient.Authorizer = auther
-
-	auther, err = auth.NewAuthorizerFromFile(network.DefaultBaseURI)
+	a.vmImgClient.Sender = apiSender(a.vmImgClient.Sender)
+	a.skuClient = compute.NewResourceSkusClient(subscriptionID)
+	a.skuClient.Authorizer = auther
+	a.skuClient.Sender = apiSender(a.skuClient.Sender)
+	a.usgClient = compute.NewUsageClient(subscriptionID)
+	a.usgClient.Authorizer = auther
+	a.usgClient.Sender = apiSender(a.usgClient.Sender)
+
+	auther, err = a.newAuthorizer(network.DefaultBaseURI)
 	if err != nil {
 		return err
 	}
-	a.netClient = network.NewVirtualNetworksClient(settings.GetSubscriptionID())
+	a.netClient = network.NewVirtualNetworksClient(subscriptionID)
 	a.netClient.Authorizer = auther
-	a.subClient = network.NewSubnetsClient(settings.GetSubscriptionID())
+	a.netClient.Sender = apiSender(a.netClient.Sender)
+	a.subClient = network.NewSubnetsClient(subscriptionID)
 	a.subClient.Authorizer = auther
-	a.ipClient = network.NewPublicIPAddressesClient(settings.GetSubscriptionID())
+	a.subClient.Sender = apiSender(a.subClient.Sender)
+	a.ipClient = network.NewPublicIPAddressesClient(subscriptionID)
 	a.ipClient.Authorizer = auther
-	a.intClient = network.NewInterfacesClient(settings.GetSubscriptionID())
+	a.ipClient.Sender = apiSender(a.ipClient.Sender)
+	a.intClient = network.NewInterfacesClient(subscriptionID)
 	a.intClient.Authorizer = auther
+	a.intClient.Sender = apiSender(a.intClient.Sender)
+	a.netUsgClient = network.NewUsagesClient(subscriptionID)
+	a.netUsgClient.Authorizer = auther
+	a.netUsgClient.Sender = apiSender(a.netUsgClient.Sender)
 
-	auther, err = auth.NewAuthorizerFromFile(armStorage.DefaultBaseURI)
+	auther, err = a.newAuthorizer(armStorage.DefaultBaseURI)
 	if err != nil {
 		return err
 	}
-	a.accClient = armStorage.NewAccountsClient(settings.GetSubscriptionID())
+	a.accClient = armStorage.NewAccountsClient(subscriptionID)
 	a.accClient.Authorizer = auther
+	a.accClient.Sender = apiSender(a.accClient.Sender)
 
 	return nil
 }
 
+// apiSender sends requests through s within the API rate budget,
+// retrying throttled ones, and records mutating requests in the audit log.
+func apiSender(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		return throttle.Do("azure", r, func(r *http.Request) (*http.Response, error) {
+			resp, err := s.Do(r)
+			audit.RecordHTTP("azure", r, resp, err)
+			return resp, err
+		})
+	})
+}
+
 func randomNameEx(prefix, separator string) string {
 	b := make([]byte, 5)
 	rand.Read(b)
@@ -207,20 +273,28 @@ func (a *API) GC(gracePeriod time.Duration) error {
 		return fmt.Errorf("listing resource groups: %v", err)
 	}
 
+	var names []string
 	for _, l := range *listGroups.Value {
 		if strings.HasPrefix(*l.Name, "kola-cluster") {
-			createdAt := *l.Tags["createdAt"]
-			timeCreated, err := time.Parse(time.RFC3339, createdAt)
+			createdAt, ok := l.Tags["createdAt"]
+			if !ok || createdAt == nil {
+				plog.Warningf("skipping resource group %v without createdAt tag", *l.Name)
+				continue
+			}
+			timeCreated, err := time.Parse(time.RFC3339, *createdAt)
 			if err != nil {
 				return fmt.Errorf("error parsing time: %v", err)
 			}
 			if !timeCreated.After(durationAgo) {
-				if err = a.TerminateResourceGroup(*l.Name); err != nil {
-					return err
-				}
+				names = append(names, *l.Name)
 			}
 		}
 	}
 
-	return nil
+	return worker.ForEach(context.Background(), maxConcurrentRequests, len(names), func(ctx context.Context, i int) error {
+		if err := a.TerminateResourceGroup(names[i]); err != nil {
+			return fmt.Errorf("deleting resource group %v: %v", names[i], err)
+		}
+		return nil
+	}, worker.LogProgress(plog, "deleting resource groups"))
 }
@@ -0,0 +1,170 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	autorestAzure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+)
+
+// The ways the clients authenticate, see Options.Credentials.
+const (
+	CredentialsFile             = "file"
+	CredentialsWorkloadIdentity = "workload-identity"
+	CredentialsMSI              = "msi"
+)
+
+// federatedTokenAudience is the audience of the OIDC tokens Azure AD
+// exchanges for access tokens of workload identities.
+const federatedTokenAudience = "api://AzureADTokenExchange"
+
+// checkCredentials validates the credentials of opts and fills in the
+// client, tenant and subscription from the environment. The subscription
+// may also come from the Azure profile.
+func checkCredentials(opts *Options) error {
+	switch opts.Credentials {
+	case "", CredentialsFile:
+		return nil
+	case CredentialsWorkloadIdentity, CredentialsMSI:
+	default:
+		return fmt.Errorf("invalid Azure credentials %q: must be %q, %q or %q", opts.Credentials, CredentialsFile, CredentialsWorkloadIdentity, CredentialsMSI)
+	}
+
+	if opts.ClientID == "" {
+		opts.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if opts.TenantID == "" {
+		opts.TenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+	if opts.SubscriptionID == "" {
+		opts.SubscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
+	}
+	if opts.Credentials == CredentialsWorkloadIdentity && (opts.ClientID == "" || opts.TenantID == "") {
+		return fmt.Errorf("Azure workload identity credentials need a client and a tenant ID")
+	}
+	return nil
+}
+
+// usesCredentialsFile returns whether the clients authenticate with the
+// service principal of the AzureAuthLocation file.
+func usesCredentialsFile(opts *Options) bool {
+	return opts.Credentials == "" || opts.Credentials == CredentialsFile
+}
+
+// newAuthorizer returns the authorizer of the clients of the Azure
+// Resource Manager API at resourceBaseURI.
+func (a *API) newAuthorizer(resourceBaseURI string) (autorest.Authorizer, error) {
+	switch a.Opts.Credentials {
+	case CredentialsWorkloadIdentity:
+		token, err := newFederatedToken(a.Opts.ClientID, a.Opts.TenantID, autorestAzure.PublicCloud.ResourceManagerEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		return autorest.NewBearerAuthorizer(token), nil
+	case CredentialsMSI:
+		msi := auth.NewMSIConfig()
+		msi.ClientID = a.Opts.ClientID
+		return msi.Authorizer()
+	default:
+		return auth.NewAuthorizerFromFile(resourceBaseURI)
+	}
+}
+
+// newFederatedToken returns a token for resource of the workload identity
+// clientID, exchanging the OIDC tokens of the environment, see
+// federatedToken.
+func newFederatedToken(clientID, tenantID, resource string) (*adal.ServicePrincipalToken, error) {
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = autorestAzure.PublicCloud.ActiveDirectoryEndpoint
+	}
+	oauthConfig, err := adal.NewOAuthConfig(authority, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, resource, &federatedSecret{token: federatedToken})
+}
+
+// federatedSecret authenticates a service principal with a federated
+// OIDC token, fetched again on every refresh since they are short-lived.
+type federatedSecret struct {
+	token func() (string, error)
+}
+
+func (s *federatedSecret) SetAuthenticationValues(spt *adal.ServicePrincipalToken, v *url.Values) error {
+	token, err := s.token()
+	if err != nil {
+		return fmt.Errorf("getting federated token: %v", err)
+	}
+	v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	v.Set("client_assertion", token)
+	return nil
+}
+
+// federatedToken returns the OIDC token of the environment, from the file
+// AZURE_FEDERATED_TOKEN_FILE, as on AKS, or from the token service of
+// GitHub Actions.
+func federatedToken() (string, error) {
+	if path := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); path != "" {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	if requestURL == "" {
+		return "", fmt.Errorf("neither AZURE_FEDERATED_TOKEN_FILE nor ACTIONS_ID_TOKEN_REQUEST_URL is set")
+	}
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("audience", federatedTokenAudience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting GitHub Actions token: %s", resp.Status)
+	}
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.Value, nil
+}
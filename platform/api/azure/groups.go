@@ -23,16 +23,21 @@ import (
 	"github.com/flatcar/mantle/util"
 )
 
-func (a *API) CreateResourceGroup(prefix string) (string, error) {
+// CreateResourceGroup creates a resource group named after prefix, tagged
+// with tags in addition to the createdAt and createdBy tags.
+func (a *API) CreateResourceGroup(prefix string, tags map[string]string) (string, error) {
 	name := randomName(prefix)
-	tags := map[string]*string{
+	groupTags := map[string]*string{
 		"createdAt": util.StrToPtr(time.Now().Format(time.RFC3339)),
 		"createdBy": util.StrToPtr("mantle"),
 	}
+	for k, v := range tags {
+		groupTags[k] = util.StrToPtr(v)
+	}
 	plog.Infof("Creating ResourceGroup %s", name)
 	_, err := a.rgClient.CreateOrUpdate(context.TODO(), name, resources.Group{
 		Location: &a.Opts.Location,
-		Tags:     tags,
+		Tags:     groupTags,
 	})
 	if err != nil {
 		return "", err
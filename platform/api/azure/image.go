@@ -22,6 +22,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/classic/management"
@@ -85,17 +86,45 @@ const (
 )
 
 type paramValue struct {
-	Value string `json:"value"`
+	Value interface{} `json:"value"`
 }
 type galleryParams struct {
-	GalleriesName       paramValue `json:"galleries_name"`
-	ImageName           paramValue `json:"image_name"`
-	ImageVersion        paramValue `json:"image_version"`
-	StorageAccountsName paramValue `json:"storageAccounts_name"`
-	VhdUri              paramValue `json:"vhd_uri"`
-	Location            paramValue `json:"location"`
-	Architecture        paramValue `json:"architecture"`
-	HyperVGeneration    paramValue `json:"hyperVGeneration"`
+	GalleriesName       paramValue  `json:"galleries_name"`
+	ImageName           paramValue  `json:"image_name"`
+	ImageVersion        paramValue  `json:"image_version"`
+	StorageAccountsName paramValue  `json:"storageAccounts_name"`
+	VhdUri              paramValue  `json:"vhd_uri"`
+	Location            paramValue  `json:"location"`
+	Architecture        paramValue  `json:"architecture"`
+	HyperVGeneration    paramValue  `json:"hyperVGeneration"`
+	SecurityType        paramValue  `json:"securityType"`
+	Publisher           *paramValue `json:"publisher,omitempty"`
+	Offer               *paramValue `json:"offer,omitempty"`
+	Sku                 *paramValue `json:"sku,omitempty"`
+	ReplicationMode     *paramValue `json:"replication_mode,omitempty"`
+	TargetRegions       *paramValue `json:"target_regions,omitempty"`
+	ExcludeFromLatest   *paramValue `json:"exclude_from_latest,omitempty"`
+}
+
+// galleryTargetRegion is a region an image version is replicated to.
+type galleryTargetRegion struct {
+	Name                 string `json:"name"`
+	RegionalReplicaCount int    `json:"regionalReplicaCount"`
+	StorageAccountType   string `json:"storageAccountType"`
+}
+
+// gallerySecurityType returns the SecurityType feature of gallery images.
+// Trusted Launch and Confidential VMs need Gen2 images, and the latter are
+// only available on x64, so advertise whatever the image can support to let
+// tests request either security type.
+func gallerySecurityType(board, hyperVGeneration string) string {
+	if hyperVGeneration != "V2" {
+		return "Standard"
+	}
+	if azureArchForBoard(board) == "x64" {
+		return "TrustedLaunchAndConfidentialVmSupported"
+	}
+	return "TrustedLaunchSupported"
 }
 
 func azureArchForBoard(board string) string {
@@ -108,24 +137,30 @@ func azureArchForBoard(board string) string {
 	return ""
 }
 
-// CreateGalleryImage creates an Azure Compute Gallery with 1 image version referencing the blob as the disk
-func (a *API) CreateGalleryImage(name, resourceGroup, storageAccount, blobURI string) (string, error) {
-	plog.Infof("Creating Gallery Image %s", name)
-	galleryName := randomNameEx(galleryNamePrefix, "")
-	template := make(map[string]interface{})
-	err := json.Unmarshal(galleryImageTemplate, &template)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal gallery template: %w", err)
-	}
-	galleryParams := galleryParams{
-		GalleriesName:       paramValue{galleryName},
+// newGalleryParams returns the parameters of the gallery template for an
+// image version of the blob.
+func (a *API) newGalleryParams(gallery, name, version, storageAccount, blobURI string) galleryParams {
+	return galleryParams{
+		GalleriesName:       paramValue{gallery},
 		ImageName:           paramValue{name},
-		ImageVersion:        paramValue{imageVersion},
+		ImageVersion:        paramValue{version},
 		StorageAccountsName: paramValue{storageAccount},
 		VhdUri:              paramValue{blobURI},
 		Location:            paramValue{a.Opts.Location},
 		Architecture:        paramValue{azureArchForBoard(a.Opts.Board)},
 		HyperVGeneration:    paramValue{a.Opts.HyperVGeneration},
+		SecurityType:        paramValue{gallerySecurityType(a.Opts.Board, a.Opts.HyperVGeneration)},
+	}
+}
+
+// deployGallery deploys the gallery template, creating or updating the
+// gallery, the image definition and the image version, and returns the ID
+// of the image version.
+func (a *API) deployGallery(deployment, resourceGroup string, galleryParams galleryParams) (string, error) {
+	template := make(map[string]interface{})
+	err := json.Unmarshal(galleryImageTemplate, &template)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal gallery template: %w", err)
 	}
 	params := make(map[string]interface{})
 	paramsData, err := json.Marshal(&galleryParams)
@@ -139,7 +174,7 @@ func (a *API) CreateGalleryImage(name, resourceGroup, storageAccount, blobURI st
 
 	future, err := a.depClient.CreateOrUpdate(context.TODO(),
 		resourceGroup,
-		deploymentName,
+		deployment,
 		resources.Deployment{
 			Properties: &resources.DeploymentProperties{
 				Template:   template,
@@ -156,10 +191,88 @@ func (a *API) CreateGalleryImage(name, resourceGroup, storageAccount, blobURI st
 		return "", err
 	}
 	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s/versions/%s",
-		a.Opts.SubscriptionID, resourceGroup, galleryName, name, imageVersion)
+		a.Opts.SubscriptionID, resourceGroup, galleryParams.GalleriesName.Value, galleryParams.ImageName.Value, galleryParams.ImageVersion.Value)
 	return id, nil
 }
 
+// CreateGalleryImage creates an Azure Compute Gallery with 1 image version referencing the blob as the disk
+func (a *API) CreateGalleryImage(name, resourceGroup, storageAccount, blobURI string) (string, error) {
+	plog.Infof("Creating Gallery Image %s", name)
+	galleryName := randomNameEx(galleryNamePrefix, "")
+	return a.deployGallery(deploymentName, resourceGroup, a.newGalleryParams(galleryName, name, imageVersion, storageAccount, blobURI))
+}
+
+// GalleryImageVersion is an image version published to an Azure Compute
+// Gallery by PublishGalleryImage.
+type GalleryImageVersion struct {
+	// Gallery, Image and Version name the gallery, the image definition
+	// and the version, e.g. "flatcar", "flatcar-stable" and "3510.2.0".
+	// The gallery and the image definition are created if needed.
+	Gallery string
+	Image   string
+	Version string
+	// Publisher, Offer and Sku identify the image definition.
+	Publisher string
+	Offer     string
+	Sku       string
+
+	// ResourceGroup holds the gallery and StorageAccount, the account of
+	// the blob at BlobURI.
+	ResourceGroup  string
+	StorageAccount string
+	BlobURI        string
+
+	// TargetRegions maps regions to the number of replicas of the
+	// version in them. The location of the API is always a target
+	// region, with 1 replica unless given.
+	TargetRegions map[string]int
+	// ExcludeFromLatest keeps VMs using the "latest" version from using
+	// this version.
+	ExcludeFromLatest bool
+}
+
+// PublishGalleryImage publishes the blob as a version of an image in an
+// Azure Compute Gallery, fully replicated to the target regions, and
+// returns the ID of the version.
+func (a *API) PublishGalleryImage(v *GalleryImageVersion) (string, error) {
+	plog.Infof("Publishing %s version %s to gallery %s", v.Image, v.Version, v.Gallery)
+	targetRegions := []galleryTargetRegion{{
+		Name:                 a.Opts.Location,
+		RegionalReplicaCount: 1,
+		StorageAccountType:   "Standard_LRS",
+	}}
+	for region, count := range v.TargetRegions {
+		if region == a.Opts.Location {
+			targetRegions[0].RegionalReplicaCount = count
+			continue
+		}
+		targetRegions = append(targetRegions, galleryTargetRegion{
+			Name:                 region,
+			RegionalReplicaCount: count,
+			StorageAccountType:   "Standard_LRS",
+		})
+	}
+	others := targetRegions[1:]
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Name < others[j].Name
+	})
+
+	params := a.newGalleryParams(v.Gallery, v.Image, v.Version, v.StorageAccount, v.BlobURI)
+	params.Publisher = &paramValue{v.Publisher}
+	params.Offer = &paramValue{v.Offer}
+	params.Sku = &paramValue{v.Sku}
+	params.ReplicationMode = &paramValue{"Full"}
+	params.TargetRegions = &paramValue{targetRegions}
+	params.ExcludeFromLatest = &paramValue{v.ExcludeFromLatest}
+
+	// deployments of the same name would replace each other
+	deployment := fmt.Sprintf("%s-%s-%s", v.Gallery, v.Image, v.Version)
+	if len(deployment) > 64 {
+		deployment = deployment[:64]
+	}
+	return a.deployGallery(deployment, v.ResourceGroup, params)
+}
+
 // CreateImage creates a managed image referencing the blob as the disk
 func (a *API) CreateImage(name, resourceGroup, blobURI string) (compute.Image, error) {
 	plog.Infof("Creating Image %s", name)
@@ -187,6 +300,25 @@ func (a *API) CreateImage(name, resourceGroup, blobURI string) (compute.Image, e
 	return future.Result(a.imgClient)
 }
 
+// TagImage adds tags to a managed image.
+func (a *API) TagImage(name, resourceGroup string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	imageTags := make(map[string]*string, len(tags))
+	for key, value := range tags {
+		value := value
+		imageTags[key] = &value
+	}
+	future, err := a.imgClient.Update(context.TODO(), resourceGroup, name, compute.ImageUpdate{
+		Tags: imageTags,
+	})
+	if err != nil {
+		return err
+	}
+	return future.WaitForCompletionRef(context.TODO(), a.imgClient.Client)
+}
+
 // resolveImage is used to ensure that either a Version or DiskURI/BlobURL/ImageFile
 // are provided present for a run. If neither is given via arguments
 // it attempts to parse the Version from the version.txt in the Sku's
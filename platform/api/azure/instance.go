@@ -15,12 +15,16 @@
 package azure
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-03-01/compute"
@@ -31,6 +35,16 @@ import (
 
 var forceDelete = true
 
+const (
+	SecurityTypeTrustedLaunch  = "TrustedLaunch"
+	SecurityTypeConfidentialVM = "ConfidentialVM"
+
+	// confidentialVMAPIVersion is the first compute API version that
+	// knows about Confidential VMs. The vendored SDK predates it, so
+	// CVM requests are upgraded by hand in confidentialVMRequest.
+	confidentialVMAPIVersion = "2022-03-01"
+)
+
 type Machine struct {
 	ID               string
 	PublicIPAddress  string
@@ -39,7 +53,7 @@ type Machine struct {
 	PublicIPName     string
 }
 
-func (a *API) getVMParameters(name, userdata, sshkey, storageAccountURI string, ip *network.PublicIPAddress, nic *network.Interface) compute.VirtualMachine {
+func (a *API) getVMParameters(name, userdata, sshkey, storageAccountURI, securityType string, gpu bool, ip *network.PublicIPAddress, nic *network.Interface) compute.VirtualMachine {
 	osProfile := compute.OSProfile{
 		AdminUsername: util.StrToPtr("core"),
 		ComputerName:  &name,
@@ -126,6 +140,22 @@ func (a *API) getVMParameters(name, userdata, sshkey, storageAccountURI string,
 		},
 	}
 
+	if securityType != "" {
+		vm.VirtualMachineProperties.SecurityProfile = &compute.SecurityProfile{
+			SecurityType: compute.SecurityTypes(securityType),
+			UefiSettings: &compute.UefiSettings{
+				SecureBootEnabled: util.BoolToPtr(!a.Opts.DisableSecureBoot),
+				VTpmEnabled:       util.BoolToPtr(true),
+			},
+		}
+	}
+	if securityType == SecurityTypeConfidentialVM && a.Opts.ConfidentialVMSize != "" {
+		vm.VirtualMachineProperties.HardwareProfile.VMSize = compute.VirtualMachineSizeTypes(a.Opts.ConfidentialVMSize)
+	}
+	if gpu && a.Opts.GPUVMSize != "" {
+		vm.VirtualMachineProperties.HardwareProfile.VMSize = compute.VirtualMachineSizeTypes(a.Opts.GPUVMSize)
+	}
+
 	// I don't think it would be an issue to have empty user-data set but better
 	// to be safe than sorry.
 	if ud != "" {
@@ -141,7 +171,70 @@ func (a *API) getVMParameters(name, userdata, sshkey, storageAccountURI string,
 	return vm
 }
 
-func (a *API) CreateInstance(name, userdata, sshkey, resourceGroup, storageAccount string, network Network) (*Machine, error) {
+// confidentialVMRequest rewrites a prepared CreateOrUpdate request for a
+// newer API version and marks the OS disk for VM guest state encryption,
+// which Azure requires for Confidential VMs.
+func confidentialVMRequest(req *http.Request) error {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body.Close()
+
+	var vm map[string]interface{}
+	if err := json.Unmarshal(body, &vm); err != nil {
+		return err
+	}
+	osDisk, ok := lookupJSONObject(vm, "properties", "storageProfile", "osDisk", "managedDisk")
+	if !ok {
+		return fmt.Errorf("request has no OS managed disk")
+	}
+	osDisk["securityProfile"] = map[string]interface{}{
+		"securityEncryptionType": "VMGuestStateOnly",
+	}
+	body, err = json.Marshal(vm)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	q.Set("api-version", confidentialVMAPIVersion)
+	req.URL.RawQuery = q.Encode()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func lookupJSONObject(obj map[string]interface{}, path ...string) (map[string]interface{}, bool) {
+	for _, key := range path {
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		obj = next
+	}
+	return obj, true
+}
+
+func (a *API) createVM(resourceGroup, name, securityType string, vmParams compute.VirtualMachine) (compute.VirtualMachinesCreateOrUpdateFuture, error) {
+	if securityType != SecurityTypeConfidentialVM {
+		return a.compClient.CreateOrUpdate(context.TODO(), resourceGroup, name, vmParams)
+	}
+	req, err := a.compClient.CreateOrUpdatePreparer(context.TODO(), resourceGroup, name, vmParams)
+	if err != nil {
+		return compute.VirtualMachinesCreateOrUpdateFuture{}, err
+	}
+	if err := confidentialVMRequest(req); err != nil {
+		return compute.VirtualMachinesCreateOrUpdateFuture{}, fmt.Errorf("preparing confidential VM request: %v", err)
+	}
+	return a.compClient.CreateOrUpdateSender(req)
+}
+
+// CreateInstance creates a VM. securityType is empty for a standard VM or one
+// of SecurityTypeTrustedLaunch and SecurityTypeConfidentialVM. gpu creates it
+// with the GPUVMSize.
+func (a *API) CreateInstance(name, userdata, sshkey, resourceGroup, storageAccount, securityType string, gpu bool, network Network) (*Machine, error) {
 	subnet := network.subnet
 
 	ip, err := a.createPublicIP(resourceGroup)
@@ -160,10 +253,10 @@ func (a *API) CreateInstance(name, userdata, sshkey, resourceGroup, storageAccou
 		return nil, fmt.Errorf("couldn't get NIC name")
 	}
 
-	vmParams := a.getVMParameters(name, userdata, sshkey, fmt.Sprintf("https://%s.blob.core.windows.net/", storageAccount), ip, nic)
+	vmParams := a.getVMParameters(name, userdata, sshkey, fmt.Sprintf("https://%s.blob.core.windows.net/", storageAccount), securityType, gpu, ip, nic)
 	plog.Infof("Creating Instance %s", name)
 
-	future, err := a.compClient.CreateOrUpdate(context.TODO(), resourceGroup, name, vmParams)
+	future, err := a.createVM(resourceGroup, name, securityType, vmParams)
 	if err != nil {
 		return nil, err
 	}
@@ -242,7 +335,19 @@ func (a *API) TerminateInstance(machine *Machine, resourceGroup string) error {
 	return nil
 }
 
+// GetConsoleOutput returns the boot diagnostics serial console log of the
+// VM, retrying while the log is not available.
 func (a *API) GetConsoleOutput(name, resourceGroup, storageAccount string) ([]byte, error) {
+	return a.getConsoleOutput(name, resourceGroup, storageAccount, 6)
+}
+
+// PollConsoleOutput is like GetConsoleOutput but tries only once, for
+// polling the log while the VM runs.
+func (a *API) PollConsoleOutput(name, resourceGroup, storageAccount string) ([]byte, error) {
+	return a.getConsoleOutput(name, resourceGroup, storageAccount, 1)
+}
+
+func (a *API) getConsoleOutput(name, resourceGroup, storageAccount string, tries int) ([]byte, error) {
 	kr, err := a.GetStorageServiceKeysARM(storageAccount, resourceGroup)
 	if err != nil {
 		return nil, fmt.Errorf("retrieving storage service keys: %v", err)
@@ -280,7 +385,7 @@ func (a *API) GetConsoleOutput(name, resourceGroup, storageAccount string) ([]by
 	}
 
 	var data io.ReadCloser
-	err = util.Retry(6, 10*time.Second, func() error {
+	err = util.Retry(tries, 10*time.Second, func() error {
 		data, err = a.GetBlob(storageAccount, key, container, blobname)
 		if err != nil {
 			return fmt.Errorf("could not get blob for container %q, blobname %q: %v", container, blobname, err)
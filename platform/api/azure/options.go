@@ -25,6 +25,17 @@ type Options struct {
 	AzureAuthLocation string
 	AzureSubscription string
 
+	// Credentials selects how the clients authenticate, see
+	// CredentialsFile, CredentialsWorkloadIdentity and CredentialsMSI.
+	// Without a credentials file, the subscription is SubscriptionID or
+	// AZURE_SUBSCRIPTION_ID and the Azure profile is optional.
+	Credentials string
+	// ClientID and TenantID identify the workload identity or the
+	// user-assigned managed identity, defaulting to AZURE_CLIENT_ID
+	// and AZURE_TENANT_ID.
+	ClientID string
+	TenantID string
+
 	BlobURL          string
 	ImageFile        string
 	DiskURI          string
@@ -39,6 +50,20 @@ type Options struct {
 	UseGallery       bool
 	UsePrivateIPs    bool
 
+	// SecurityType is the security type used for all instances: empty for
+	// a standard VM, "TrustedLaunch" or "ConfidentialVM". Tests may
+	// request either type for their own instances.
+	SecurityType string
+	// DisableSecureBoot turns off UEFI Secure Boot on Trusted Launch and
+	// Confidential VM instances. The vTPM is always enabled.
+	DisableSecureBoot bool
+	// ConfidentialVMSize is the machine size used for Confidential VM
+	// instances, which need one of the SEV-SNP capable series.
+	ConfidentialVMSize string
+	// GPUVMSize is the machine size used for tests requiring a GPU,
+	// which need one of the N-series.
+	GPUVMSize string
+
 	SubscriptionName string
 	SubscriptionID   string
 
@@ -0,0 +1,116 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// CheckQuota checks that the regional quotas for vCPUs, the vCPUs of the
+// VM size family, virtual machines and public IP addresses leave room for
+// the given number of instances.
+func (a *API) CheckQuota(machines int) error {
+	ctx := context.TODO()
+	size := a.Opts.Size
+	if a.Opts.SecurityType == SecurityTypeConfidentialVM && a.Opts.ConfidentialVMSize != "" {
+		size = a.Opts.ConfidentialVMSize
+	}
+
+	var family string
+	var vcpus float64
+	skus, err := a.skuClient.ListComplete(ctx, fmt.Sprintf("location eq '%s'", a.Opts.Location))
+	if err != nil {
+		return fmt.Errorf("listing VM sizes: %v", err)
+	}
+	for ; skus.NotDone(); err = skus.NextWithContext(ctx) {
+		if err != nil {
+			return fmt.Errorf("listing VM sizes: %v", err)
+		}
+		sku := skus.Value()
+		if sku.ResourceType == nil || *sku.ResourceType != "virtualMachines" || sku.Name == nil || !strings.EqualFold(*sku.Name, size) {
+			continue
+		}
+		if sku.Family != nil {
+			family = *sku.Family
+		}
+		if sku.Capabilities != nil {
+			for _, c := range *sku.Capabilities {
+				if c.Name != nil && *c.Name == "vCPUs" && c.Value != nil {
+					vcpus, _ = strconv.ParseFloat(*c.Value, 64)
+				}
+			}
+		}
+		break
+	}
+	if family == "" || vcpus == 0 {
+		return fmt.Errorf("couldn't find VM size %s in %s", size, a.Opts.Location)
+	}
+
+	n := float64(machines)
+	need := map[string]float64{
+		"cores":           n * vcpus,
+		family:            n * vcpus,
+		"virtualMachines": n,
+	}
+	var quotas []platform.Quota
+	usages, err := a.usgClient.ListComplete(ctx, a.Opts.Location)
+	if err != nil {
+		return fmt.Errorf("listing compute usages: %v", err)
+	}
+	for ; usages.NotDone(); err = usages.NextWithContext(ctx) {
+		if err != nil {
+			return fmt.Errorf("listing compute usages: %v", err)
+		}
+		u := usages.Value()
+		if u.Name == nil || u.Name.Value == nil || u.Limit == nil || u.CurrentValue == nil {
+			continue
+		}
+		if v, ok := need[*u.Name.Value]; ok {
+			quotas = append(quotas, platform.Quota{
+				Name:  fmt.Sprintf("%s in %s", *u.Name.Value, a.Opts.Location),
+				Limit: float64(*u.Limit),
+				Usage: float64(*u.CurrentValue),
+				Need:  v,
+			})
+		}
+	}
+
+	// every instance gets a public IP address
+	netUsages, err := a.netUsgClient.ListComplete(ctx, a.Opts.Location)
+	if err != nil {
+		return fmt.Errorf("listing network usages: %v", err)
+	}
+	for ; netUsages.NotDone(); err = netUsages.NextWithContext(ctx) {
+		if err != nil {
+			return fmt.Errorf("listing network usages: %v", err)
+		}
+		u := netUsages.Value()
+		if u.Name == nil || u.Name.Value == nil || *u.Name.Value != "PublicIPAddresses" || u.Limit == nil || u.CurrentValue == nil {
+			continue
+		}
+		quotas = append(quotas, platform.Quota{
+			Name:  fmt.Sprintf("%s in %s", *u.Name.Value, a.Opts.Location),
+			Limit: float64(*u.Limit),
+			Usage: float64(*u.CurrentValue),
+			Need:  n,
+		})
+	}
+	return platform.CheckQuotas(quotas)
+}
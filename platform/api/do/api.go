@@ -17,6 +17,8 @@ package do
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
@@ -26,13 +28,33 @@ import (
 
 	"github.com/flatcar/mantle/auth"
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/throttle"
 	"github.com/flatcar/mantle/util"
 )
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/do")
+
+	invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
 )
 
+// Tags adapts key-value tags to DigitalOcean, whose tags are plain names,
+// as sorted "key:value" names. Characters other than letters, digits, '_'
+// and '-' are replaced with '_'.
+func Tags(tags map[string]string) []string {
+	var names []string
+	for k, v := range tags {
+		name := invalidTagChars.ReplaceAllString(k, "_") + ":" + invalidTagChars.ReplaceAllString(v, "_")
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type Options struct {
 	*platform.Options
 
@@ -49,12 +71,19 @@ type Options struct {
 	Size string
 	// Numeric image ID, {alpha, beta, stable}, or user image name
 	Image string
+	// VPC UUID or name, droplets are placed into the region's default
+	// VPC if empty
+	VPC string
+	// Connect to the droplets via their private IPs, e.g. when running
+	// from inside the VPC
+	UsePrivateIPs bool
 }
 
 type API struct {
 	c     *godo.Client
 	opts  *Options
 	image godo.DropletCreateImage
+	vpcID string
 }
 
 func New(opts *Options) (*API, error) {
@@ -77,7 +106,9 @@ func New(opts *Options) (*API, error) {
 	}
 
 	ctx := context.TODO()
-	client := godo.NewClient(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}))
+	httpClient := oauth2.NewClient(ctx, &tokenSource{opts.AccessToken})
+	httpClient.Transport = throttle.Transport("digitalocean", audit.Transport("digitalocean", httpClient.Transport))
+	client := godo.NewClient(httpClient)
 
 	a := &API{
 		c:    client,
@@ -90,15 +121,23 @@ func New(opts *Options) (*API, error) {
 		return nil, err
 	}
 
+	if opts.VPC != "" {
+		a.vpcID, err = a.resolveVPC(ctx, opts.VPC)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return a, nil
 }
 
-func (a *API) CreateImage(ctx context.Context, name, url string) (*godo.Image, error) {
+func (a *API) CreateImage(ctx context.Context, name, url string, tags ...string) (*godo.Image, error) {
 	imageCreateRequest := godo.CustomImageCreateRequest{
 		Name:         name,
 		Url:          url,
 		Region:       a.opts.Region,
 		Distribution: "CoreOS",
+		Tags:         tags,
 	}
 	image, _, err := a.c.Images.Create(ctx, &imageCreateRequest)
 	if err != nil {
@@ -143,6 +182,40 @@ func (a *API) resolveImage(ctx context.Context, imageSpec string) (godo.DropletC
 	return godo.DropletCreateImage{}, fmt.Errorf("couldn't resolve image %q in %v", imageSpec, a.opts.Region)
 }
 
+// UsePrivateIPs reports whether machines are reached via their private IPs.
+func (a *API) UsePrivateIPs() bool {
+	return a.opts.UsePrivateIPs
+}
+
+// resolveVPC returns the ID of the VPC with the given UUID or name in the
+// configured region.
+func (a *API) resolveVPC(ctx context.Context, vpcSpec string) (string, error) {
+	page := godo.ListOptions{
+		Page:    1,
+		PerPage: 200,
+	}
+	for {
+		vpcs, _, err := a.c.VPCs.List(ctx, &page)
+		if err != nil {
+			return "", fmt.Errorf("listing VPCs: %v", err)
+		}
+		for _, vpc := range vpcs {
+			if vpc.ID != vpcSpec && vpc.Name != vpcSpec {
+				continue
+			}
+			if vpc.RegionSlug != a.opts.Region {
+				return "", fmt.Errorf("VPC %q is in %v, not in %v", vpcSpec, vpc.RegionSlug, a.opts.Region)
+			}
+			return vpc.ID, nil
+		}
+		if len(vpcs) < page.PerPage {
+			break
+		}
+		page.Page += 1
+	}
+	return "", fmt.Errorf("couldn't find VPC %q in %v", vpcSpec, a.opts.Region)
+}
+
 func (a *API) PreflightCheck(ctx context.Context) error {
 	_, _, err := a.c.Account.Get(ctx)
 	if err != nil {
@@ -151,7 +224,8 @@ func (a *API) PreflightCheck(ctx context.Context) error {
 	return nil
 }
 
-func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, userdata string) (*godo.Droplet, error) {
+// CreateDroplet creates a droplet tagged "mantle" and with tags.
+func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, userdata string, tags ...string) (*godo.Droplet, error) {
 	var droplet *godo.Droplet
 	var err error
 	// DO frequently gives us 422 errors saying "Please try again". Retry every 10 seconds
@@ -163,10 +237,11 @@ func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, user
 			Size:              a.opts.Size,
 			Image:             a.image,
 			SSHKeys:           []godo.DropletCreateSSHKey{{ID: sshKeyID}},
-			IPv6:              false,
+			IPv6:              true,
 			PrivateNetworking: true,
+			VPCUUID:           a.vpcID,
 			UserData:          userdata,
-			Tags:              []string{"mantle"},
+			Tags:              append([]string{"mantle"}, tags...),
 		})
 		if err != nil {
 			plog.Errorf("Error creating droplet: %v. Retrying...", err)
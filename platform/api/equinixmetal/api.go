@@ -23,8 +23,10 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
@@ -39,7 +41,9 @@ import (
 	"github.com/flatcar/mantle/platform/api/equinixmetal/storage/gcs"
 	"github.com/flatcar/mantle/platform/api/equinixmetal/storage/sshstorage"
 	"github.com/flatcar/mantle/platform/api/gcloud"
+	"github.com/flatcar/mantle/platform/audit"
 	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/throttle"
 	ms "github.com/flatcar/mantle/storage"
 	"github.com/flatcar/mantle/util"
 )
@@ -52,6 +56,10 @@ const (
 	installPollInterval   = 5 * time.Second
 	apiRetries            = 3
 	apiRetryInterval      = 5 * time.Second
+
+	// nextAvailableReservation lets Equinix Metal pick any free
+	// hardware reservation of the project
+	nextAvailableReservation = "next-available"
 )
 
 var (
@@ -123,12 +131,25 @@ type Options struct {
 	LaunchTimeout time.Duration
 	// InstallTimeout specifies the timeout used for waiting for installation to finish.
 	InstallTimeout time.Duration
+
+	// HardwareReservations are the IDs of the reserved hardware to create
+	// devices on, "next-available" picks any free reservation.
+	HardwareReservations []string
+	// SpotInstance creates devices on the spot market.
+	SpotInstance bool
+	// SpotPriceMax is the maximum bid in USD per hour for spot instances.
+	SpotPriceMax float64
 }
 
 type API struct {
 	c       *packngo.Client
 	storage storage.Storage
 	opts    *Options
+
+	// reserved maps the hardware reservations in use to their device,
+	// the device ID is empty while the device is being created
+	reservedLock sync.Mutex
+	reserved     map[string]string
 }
 
 type Console interface {
@@ -254,12 +275,24 @@ func New(opts *Options) (*API, error) {
 		return nil, fmt.Errorf("install timeout can't be negative, is %v", opts.InstallTimeout)
 	}
 
-	client := packngo.NewClientWithAuth("github.com/flatcar/mantle", opts.ApiKey, nil)
+	if opts.SpotInstance {
+		if len(opts.HardwareReservations) > 0 {
+			return nil, fmt.Errorf("spot instances can't use hardware reservations")
+		}
+		if opts.SpotPriceMax <= 0 {
+			return nil, fmt.Errorf("spot instances need a maximum price")
+		}
+	}
+
+	client := packngo.NewClientWithAuth("github.com/flatcar/mantle", opts.ApiKey, &http.Client{
+		Transport: throttle.Transport("equinixmetal", audit.Transport("equinixmetal", nil)),
+	})
 
 	return &API{
-		c:       client,
-		storage: storage,
-		opts:    opts,
+		c:        client,
+		storage:  storage,
+		opts:     opts,
+		reserved: make(map[string]string),
 	}, nil
 }
 
@@ -368,9 +401,75 @@ func (a *API) DeleteDevice(deviceID string) error {
 	if err != nil {
 		return fmt.Errorf("deleting device %q: %v", deviceID, err)
 	}
+	a.releaseReservation(deviceID)
 	return nil
 }
 
+// SpotTerminationTime returns when a spot market device gets reclaimed, nil
+// if it is not scheduled for termination. A device which is already gone
+// is reported as reclaimed now.
+func (a *API) SpotTerminationTime(deviceID string) (*time.Time, error) {
+	device, response, err := a.c.Devices.Get(deviceID, nil)
+	if err != nil {
+		if response != nil && response.StatusCode == 404 {
+			now := time.Now()
+			return &now, nil
+		}
+		return nil, fmt.Errorf("querying device: %v", err)
+	}
+	if device.TerminationTime == nil {
+		return nil, nil
+	}
+	return &device.TerminationTime.Time, nil
+}
+
+// acquireReservation returns a free hardware reservation of the configured
+// ones, or "" if none are configured.
+func (a *API) acquireReservation() (string, error) {
+	if len(a.opts.HardwareReservations) == 0 {
+		return "", nil
+	}
+
+	a.reservedLock.Lock()
+	defer a.reservedLock.Unlock()
+	for _, r := range a.opts.HardwareReservations {
+		if r == nextAvailableReservation {
+			return r, nil
+		}
+		if _, ok := a.reserved[r]; !ok {
+			a.reserved[r] = ""
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("all %d hardware reservations are in use", len(a.opts.HardwareReservations))
+}
+
+// assignReservation records the device created on the reservation, or
+// releases the reservation if deviceID is empty.
+func (a *API) assignReservation(reservation, deviceID string) {
+	if reservation == "" || reservation == nextAvailableReservation {
+		return
+	}
+
+	a.reservedLock.Lock()
+	defer a.reservedLock.Unlock()
+	if deviceID == "" {
+		delete(a.reserved, reservation)
+	} else {
+		a.reserved[reservation] = deviceID
+	}
+}
+
+func (a *API) releaseReservation(deviceID string) {
+	a.reservedLock.Lock()
+	defer a.reservedLock.Unlock()
+	for r, id := range a.reserved {
+		if id == deviceID {
+			delete(a.reserved, r)
+		}
+	}
+}
+
 func (a *API) GetDeviceAddress(device *packngo.Device, family int, public bool) string {
 	for _, address := range device.Network {
 		if address.AddressFamily == family && address.Public == public {
@@ -626,6 +725,15 @@ func (a *API) createDevice(hostname, ipxeScriptURL, id string) (*packngo.Device,
 				IPXEScriptURL: &ipxeScriptURL,
 				Hostname:      &hostname,
 			})
+			if err != nil && response != nil && response.StatusCode == 404 {
+				// the device is gone, e.g. a reclaimed spot instance
+				plog.Warningf("Device %s to recycle is gone, creating a new instance", id)
+				a.releaseReservation(id)
+				id = ""
+				err = nil
+				tries++
+				continue
+			}
 			if err != nil {
 				err = fmt.Errorf("updating device: %w", err)
 				continue
@@ -647,18 +755,32 @@ func (a *API) createDevice(hostname, ipxeScriptURL, id string) (*packngo.Device,
 				a.opts.Facility = ""
 			}
 
+			var reservation string
+			reservation, err = a.acquireReservation()
+			if err != nil {
+				return nil, err
+			}
+
 			device, response, err = a.c.Devices.Create(&packngo.DeviceCreateRequest{
-				ProjectID:     a.opts.Project,
-				Facility:      []string{a.opts.Facility},
-				Plan:          a.opts.Plan,
-				BillingCycle:  "hourly",
-				Hostname:      hostname,
-				OS:            "custom_ipxe",
-				IPXEScriptURL: ipxeScriptURL,
-				Tags:          []string{"mantle"},
-				AlwaysPXE:     alwaysPXE,
-				Metro:         a.opts.Metro,
+				ProjectID:             a.opts.Project,
+				Facility:              []string{a.opts.Facility},
+				Plan:                  a.opts.Plan,
+				BillingCycle:          "hourly",
+				Hostname:              hostname,
+				OS:                    "custom_ipxe",
+				IPXEScriptURL:         ipxeScriptURL,
+				Tags:                  []string{"mantle"},
+				AlwaysPXE:             alwaysPXE,
+				Metro:                 a.opts.Metro,
+				HardwareReservationID: reservation,
+				SpotInstance:          a.opts.SpotInstance,
+				SpotPriceMax:          a.opts.SpotPriceMax,
 			})
+			if err == nil {
+				a.assignReservation(reservation, device.ID)
+			} else {
+				a.assignReservation(reservation, "")
+			}
 		}
 
 		if err == nil || response.StatusCode != 500 {
@@ -23,10 +23,14 @@ import (
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/compute/v1"
 
 	"github.com/flatcar/mantle/auth"
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/throttle"
 )
 
 var (
@@ -43,6 +47,29 @@ type Options struct {
 	JSONKeyFile string
 	GVNIC       bool
 	ServiceAuth bool
+	// ImpersonateServiceAccount is the email of a service account to
+	// impersonate with the credentials of JSONKeyFile or ServiceAuth.
+	ImpersonateServiceAccount string
+
+	// Shielded VM options, all of them are enabled for tests requiring
+	// Trusted Launch
+	SecureBoot          bool
+	VTPM                bool
+	IntegrityMonitoring bool
+	// ConfidentialCompute launches AMD SEV instances with the
+	// ConfidentialMachineType, it is enabled for tests requiring
+	// Confidential VMs
+	ConfidentialCompute     bool
+	ConfidentialMachineType string
+	// GPUMachineType is the machine type, with attached NVIDIA GPUs, for
+	// tests requiring a GPU
+	GPUMachineType string
+
+	// Projects, if set, are used instead of Project to distribute the
+	// clusters of a flight round-robin across several projects. Each
+	// entry is a project, optionally followed by "=" and the JSON key
+	// file to use for it instead of JSONKeyFile.
+	Projects []string
 	*platform.Options
 }
 
@@ -71,7 +98,9 @@ func New(opts *Options) (*API, error) {
 		err    error
 	)
 
-	if opts.ServiceAuth {
+	if opts.ImpersonateServiceAccount != "" {
+		client, err = impersonatedClient(opts)
+	} else if opts.ServiceAuth {
 		client = auth.GoogleServiceClient()
 	} else if opts.JSONKeyFile != "" {
 		b, err := ioutil.ReadFile(opts.JSONKeyFile)
@@ -86,6 +115,7 @@ func New(opts *Options) (*API, error) {
 	if err != nil {
 		return nil, err
 	}
+	client.Transport = throttle.Transport("gce", audit.Transport("gce", client.Transport))
 
 	capi, err := compute.New(client)
 	if err != nil {
@@ -101,10 +131,37 @@ func New(opts *Options) (*API, error) {
 	return api, nil
 }
 
+// impersonatedClient returns a client for opts.ImpersonateServiceAccount,
+// which is impersonated with the credentials of the JSON key file or of
+// the GCE metadata service.
+func impersonatedClient(opts *Options) (*http.Client, error) {
+	var ts oauth2.TokenSource
+	if opts.ServiceAuth {
+		ts = auth.GoogleServiceTokenSource()
+	} else if opts.JSONKeyFile != "" {
+		b, err := ioutil.ReadFile(opts.JSONKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		ts, err = auth.GoogleTokenSourceFromJSONKey(b, compute.CloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("impersonating %s requires a JSON key or service auth", opts.ImpersonateServiceAccount)
+	}
+	return auth.GoogleImpersonatedClient(ts, opts.ImpersonateServiceAccount), nil
+}
+
 func (a *API) Client() *http.Client {
 	return a.client
 }
 
+// GC removes the instances and images created by mantle that are at
+// least gracePeriod old.
 func (a *API) GC(gracePeriod time.Duration) error {
-	return a.gcInstances(gracePeriod)
+	if err := a.gcInstances(gracePeriod); err != nil {
+		return err
+	}
+	return a.gcImages(context.Background(), gracePeriod)
 }
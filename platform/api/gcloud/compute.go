@@ -15,8 +15,8 @@
 package gcloud
 
 import (
-	"crypto/rand"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -24,14 +24,32 @@ import (
 	"google.golang.org/api/compute/v1"
 )
 
-func (a *API) vmname() string {
-	b := make([]byte, 10)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", a.options.BaseName, b)
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// Labels adapts tags to the syntax of GCE labels: lowercase letters,
+// digits, '_' and '-', up to 63 characters. Other characters are replaced
+// with '-'.
+func Labels(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		labels[labelValue(k)] = labelValue(v)
+	}
+	return labels
+}
+
+func labelValue(s string) string {
+	s = invalidLabelChars.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
 }
 
 // Taken from: https://github.com/golang/build/blob/master/buildlet/gce.go
-func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Instance {
+func (a *API) mkinstance(userdata, name string, keys []*agent.Key, shielded, confidential, gpu bool, labels map[string]string) *compute.Instance {
 	mantle := "mantle"
 	metadataItems := []*compute.MetadataItems{
 		&compute.MetadataItems{
@@ -62,6 +80,7 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 	instance := &compute.Instance{
 		Name:        name,
 		MachineType: instancePrefix + "/zones/" + a.options.Zone + "/machineTypes/" + a.options.MachineType,
+		Labels:      Labels(labels),
 		Metadata: &compute.Metadata{
 			Items: metadataItems,
 		},
@@ -80,7 +99,7 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 					DiskName:    name,
 					SourceImage: a.options.Image,
 					DiskType:    "/zones/" + a.options.Zone + "/diskTypes/" + a.options.DiskType,
-					DiskSizeGb:  12,
+					DiskSizeGb:  diskSizeGB,
 				},
 			},
 		},
@@ -97,6 +116,35 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 			},
 		},
 	}
+	// a Confidential VM is also a Shielded VM
+	shielded = shielded || confidential
+	if shielded || a.options.SecureBoot || a.options.VTPM || a.options.IntegrityMonitoring {
+		instance.ShieldedInstanceConfig = &compute.ShieldedInstanceConfig{
+			EnableSecureBoot:          shielded || a.options.SecureBoot,
+			EnableVtpm:                shielded || a.options.VTPM,
+			EnableIntegrityMonitoring: shielded || a.options.IntegrityMonitoring,
+		}
+	}
+	if confidential || a.options.ConfidentialCompute {
+		instance.ConfidentialInstanceConfig = &compute.ConfidentialInstanceConfig{
+			EnableConfidentialCompute: true,
+		}
+		// confidential instances can't be live migrated
+		instance.Scheduling = &compute.Scheduling{
+			OnHostMaintenance: "TERMINATE",
+		}
+		if a.options.ConfidentialMachineType != "" {
+			instance.MachineType = instancePrefix + "/zones/" + a.options.Zone + "/machineTypes/" + a.options.ConfidentialMachineType
+		}
+	}
+	if gpu {
+		instance.MachineType = instancePrefix + "/zones/" + a.options.Zone + "/machineTypes/" + a.options.GPUMachineType
+		// instances with GPUs can't be live migrated
+		instance.Scheduling = &compute.Scheduling{
+			OnHostMaintenance: "TERMINATE",
+		}
+	}
+
 	// add cloud config
 	if userdata != "" {
 		instance.Metadata.Items = append(instance.Metadata.Items, &compute.MetadataItems{
@@ -109,16 +157,19 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 
 }
 
-// CreateInstance creates a Google Compute Engine instance.
-func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Instance, error) {
-	name := a.vmname()
-	inst := a.mkinstance(userdata, name, keys)
+// CreateInstance creates a Google Compute Engine instance named name.
+// shielded enables all Shielded VM options, confidential launches a
+// Confidential VM and gpu one with the GPUMachineType, in addition to the
+// options given in Options. The instance is labeled with labels, see
+// Labels.
+func (a *API) CreateInstance(name, userdata string, keys []*agent.Key, shielded, confidential, gpu bool, labels map[string]string) (*compute.Instance, error) {
+	inst := a.mkinstance(userdata, name, keys, shielded, confidential, gpu, labels)
 
 	plog.Debugf("Creating instance %q", name)
 
 	op, err := a.compute.Instances.Insert(a.options.Project, a.options.Zone, inst).Do()
 	if err != nil {
-		return nil, fmt.Errorf("failed to request new GCE instance: %v\n", err)
+		return nil, infraError(fmt.Errorf("failed to request new GCE instance: %w", err))
 	}
 
 	doable := a.compute.ZoneOperations.Get(a.options.Project, a.options.Zone, op.Name)
@@ -128,7 +179,7 @@ func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Insta
 
 	inst, err = a.compute.Instances.Get(a.options.Project, a.options.Zone, name).Do()
 	if err != nil {
-		return nil, fmt.Errorf("failed getting instance %s details after creation: %v", name, err)
+		return nil, infraError(fmt.Errorf("failed getting instance %s details after creation: %w", name, err))
 	}
 
 	plog.Debugf("Created instance %q", name)
@@ -170,6 +221,20 @@ func (a *API) GetConsoleOutput(name string) (string, error) {
 	return out.Contents, nil
 }
 
+// GetConsoleOutputFrom returns the console output of the instance from byte
+// offset start on, and the offset to continue from in the next call.
+func (a *API) GetConsoleOutputFrom(name string, start int64) (string, int64, error) {
+	out, err := a.compute.Instances.GetSerialPortOutput(a.options.Project, a.options.Zone, name).Start(start).Do()
+	if err != nil {
+		return "", start, fmt.Errorf("failed to retrieve console output for %q: %v", name, err)
+	}
+	if out.Start > start {
+		// the instance only keeps the last 1 MiB of output
+		plog.Warningf("Lost %d bytes of console output of %q", out.Start-start, name)
+	}
+	return out.Contents, out.Next, nil
+}
+
 // Taken from: https://github.com/golang/build/blob/master/buildlet/gce.go
 func InstanceIPs(inst *compute.Instance) (intIP, extIP string) {
 	for _, iface := range inst.NetworkInterfaces {
@@ -185,6 +250,22 @@ func InstanceIPs(inst *compute.Instance) (intIP, extIP string) {
 	return
 }
 
+// InstanceIPv6s returns the internal and external IPv6 addresses of inst,
+// which are only assigned in dual-stack subnets.
+func InstanceIPv6s(inst *compute.Instance) (intIPv6, extIPv6 string) {
+	for _, iface := range inst.NetworkInterfaces {
+		if iface.Ipv6Address != "" {
+			intIPv6 = iface.Ipv6Address
+		}
+		for _, accessConfig := range iface.Ipv6AccessConfigs {
+			if accessConfig.Type == "DIRECT_IPV6" {
+				extIPv6 = accessConfig.ExternalIpv6
+			}
+		}
+	}
+	return
+}
+
 func (a *API) gcInstances(gracePeriod time.Duration) error {
 	threshold := time.Now().Add(-gracePeriod)
 
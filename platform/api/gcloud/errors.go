@@ -0,0 +1,69 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"errors"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// isInfraError reports whether an error of a GCE call was caused by GCE
+// rather than by the request: rate limits, exhausted quotas, service
+// errors or failures to reach GCE.
+func isInfraError(err error) bool {
+	if platform.IsNetworkError(err) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == 429 || apiErr.Code >= 500 {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		switch e.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "backendError", "internalError":
+			return true
+		}
+	}
+	return false
+}
+
+// isInfraOperationError reports whether one of the errors of a failed
+// operation was caused by GCE, e.g. a zone without capacity left.
+func isInfraOperationError(errs []*compute.OperationErrorErrors) bool {
+	for _, e := range errs {
+		switch e.Code {
+		case "ZONE_RESOURCE_POOL_EXHAUSTED", "ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS",
+			"QUOTA_EXCEEDED", "RESOURCE_OPERATION_RATE_EXCEEDED", "INTERNAL_ERROR":
+			return true
+		}
+	}
+	return false
+}
+
+// infraError returns err as platform.InfraError if isInfraError reports it
+// as caused by GCE.
+func infraError(err error) error {
+	if isInfraError(err) {
+		return &platform.InfraError{Err: err}
+	}
+	return err
+}
@@ -17,6 +17,7 @@ package gcloud
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/compute/v1"
@@ -31,12 +32,26 @@ const (
 	DeprecationStateDeleted    DeprecationState = "DELETED"
 )
 
+// DefaultGuestOSFeatures are the guest OS features of images whose
+// ImageSpec doesn't list any.
+var DefaultGuestOSFeatures = []string{
+	"VIRTIO_SCSI_MULTIQUEUE",
+	"UEFI_COMPATIBLE",
+	"GVNIC",
+}
+
 type ImageSpec struct {
 	SourceImage string
 	Family      string
 	Name        string
 	Description string
 	Licenses    []string // short names
+	Labels      map[string]string
+	// GuestOSFeatures are the features supported by the image, e.g.
+	// UEFI_COMPATIBLE or GVNIC, DefaultGuestOSFeatures if empty.
+	GuestOSFeatures []string
+	// ConfidentialCompute marks the image as usable for Confidential VMs
+	ConfidentialCompute bool
 }
 
 // CreateImage creates an image on GCE and returns operation details and
@@ -70,22 +85,30 @@ func (a *API) CreateImage(spec *ImageSpec, overwrite bool) (*compute.Operation,
 		}
 	}
 
+	features := spec.GuestOSFeatures
+	if len(features) == 0 {
+		features = DefaultGuestOSFeatures
+	}
+	if spec.ConfidentialCompute {
+		// copy, not to modify the slice of the caller
+		features = append(features[:len(features):len(features)], "SEV_CAPABLE")
+	}
+	var guestOsFeatures []*compute.GuestOsFeature
+	seen := make(map[string]bool)
+	for _, f := range features {
+		if !seen[f] {
+			seen[f] = true
+			guestOsFeatures = append(guestOsFeatures, &compute.GuestOsFeature{Type: f})
+		}
+	}
+
 	image := &compute.Image{
-		Family:      spec.Family,
-		Name:        spec.Name,
-		Description: spec.Description,
-		Licenses:    licenses,
-		GuestOsFeatures: []*compute.GuestOsFeature{
-			&compute.GuestOsFeature{
-				Type: "VIRTIO_SCSI_MULTIQUEUE",
-			},
-			&compute.GuestOsFeature{
-				Type: "UEFI_COMPATIBLE",
-			},
-			&compute.GuestOsFeature{
-				Type: "GVNIC",
-			},
-		},
+		Family:          spec.Family,
+		Name:            spec.Name,
+		Description:     spec.Description,
+		Licenses:        licenses,
+		Labels:          spec.Labels,
+		GuestOsFeatures: guestOsFeatures,
 		RawDisk: &compute.ImageRawDisk{
 			Source: spec.SourceImage,
 		},
@@ -155,6 +178,43 @@ func (a *API) DeleteImage(name string) (*Pending, error) {
 	return a.NewPending(op.Name, opReq), nil
 }
 
+// gcImages deletes the images labeled created-by=mantle older than
+// gracePeriod. Images are not labeled unless asked to, e.g. by ore upload
+// --tag created-by=mantle, as released images must never be collected.
+func (a *API) gcImages(ctx context.Context, gracePeriod time.Duration) error {
+	threshold := time.Now().Add(-gracePeriod)
+
+	images, err := a.ListImages(ctx, "")
+	if err != nil {
+		return err
+	}
+	var pendings []*Pending
+	for _, image := range images {
+		if image.Labels["created-by"] != "mantle" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, image.CreationTimestamp)
+		if err != nil {
+			return fmt.Errorf("couldn't parse %q: %v", image.CreationTimestamp, err)
+		}
+		if created.After(threshold) {
+			continue
+		}
+		plog.Infof("Deleting image %s", image.Name)
+		pending, err := a.DeleteImage(image.Name)
+		if err != nil {
+			return err
+		}
+		pendings = append(pendings, pending)
+	}
+	for _, pending := range pendings {
+		if err := pending.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // https://cloud.google.com/compute/docs/images/managing-access-custom-images#share-images-publicly
 func (a *API) SetImagePublic(name string) error {
 	// The IAM policy binding to allow all authenticated users to
@@ -20,6 +20,8 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
+
+	"github.com/flatcar/mantle/platform"
 )
 
 type doable interface {
@@ -61,7 +63,7 @@ func (p *Pending) Wait() error {
 		} else {
 			failures++
 			if failures > 5 {
-				return fmt.Errorf("Fetching %q status failed: %v", p.desc, err)
+				return infraError(fmt.Errorf("Fetching %q status failed: %w", p.desc, err))
 			}
 		}
 		if op != nil && op.Status == "DONE" {
@@ -71,7 +73,11 @@ func (p *Pending) Wait() error {
 	}
 	if op.Error != nil {
 		if len(op.Error.Errors) > 0 {
-			return fmt.Errorf("Operation %q failed: %+v", p.desc, op.Error.Errors)
+			err := fmt.Errorf("Operation %q failed: %+v", p.desc, op.Error.Errors)
+			if isInfraOperationError(op.Error.Errors) {
+				return &platform.InfraError{Err: err}
+			}
+			return err
 		}
 		return fmt.Errorf("Operation %q failed to start", p.desc)
 	}
@@ -90,7 +96,7 @@ func (p *Pending) defaultProgress(desc string, elapsed time.Duration, op *comput
 	}
 
 	if p.Timeout > 0 && elapsed > p.Timeout {
-		return fmt.Errorf("Failed to wait for operation %q: %v", desc, err)
+		return &platform.InfraError{Err: fmt.Errorf("Failed to wait for operation %q: %v", desc, err)}
 	}
 
 	return nil
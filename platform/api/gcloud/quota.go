@@ -0,0 +1,76 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// diskSizeGB is the size of the boot disk of the instances.
+const diskSizeGB = 12
+
+// CheckQuota checks that the regional quotas for CPUs, the CPUs of the
+// machine family, instances, external addresses and disks leave room for
+// the given number of instances.
+func (a *API) CheckQuota(machines int) error {
+	machineType := a.options.MachineType
+	if a.options.ConfidentialCompute && a.options.ConfidentialMachineType != "" {
+		machineType = a.options.ConfidentialMachineType
+	}
+	mt, err := a.compute.MachineTypes.Get(a.options.Project, a.options.Zone, machineType).Do()
+	if err != nil {
+		return fmt.Errorf("getting machine type %s: %v", machineType, err)
+	}
+
+	region := a.options.Zone
+	if i := strings.LastIndex(region, "-"); i > 0 {
+		region = region[:i]
+	}
+	r, err := a.compute.Regions.Get(a.options.Project, region).Do()
+	if err != nil {
+		return fmt.Errorf("getting region %s: %v", region, err)
+	}
+
+	n := float64(machines)
+	cpus := n * float64(mt.GuestCpus)
+	diskMetric := "SSD_TOTAL_GB"
+	if a.options.DiskType == "pd-standard" {
+		diskMetric = "DISKS_TOTAL_GB"
+	}
+	need := map[string]float64{
+		"CPUS":             cpus,
+		"INSTANCES":        n,
+		"IN_USE_ADDRESSES": n,
+		diskMetric:         n * diskSizeGB,
+		// e.g. N2D_CPUS, families without own quota only count as CPUS
+		strings.ToUpper(strings.SplitN(machineType, "-", 2)[0]) + "_CPUS": cpus,
+	}
+
+	var quotas []platform.Quota
+	for _, q := range r.Quotas {
+		if v, ok := need[q.Metric]; ok {
+			quotas = append(quotas, platform.Quota{
+				Name:  fmt.Sprintf("%s in %s", q.Metric, region),
+				Limit: q.Limit,
+				Usage: q.Usage,
+				Need:  v,
+			})
+		}
+	}
+	return platform.CheckQuotas(quotas)
+}
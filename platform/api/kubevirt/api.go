@@ -0,0 +1,227 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubevirt
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/platform"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/kubevirt")
+)
+
+const (
+	// createdByLabel marks the resources created by Mantle for GC
+	createdByLabel = "created-by"
+	createdByValue = "mantle"
+)
+
+type Options struct {
+	*platform.Options
+
+	// Kubeconfig file. Defaults to $KUBECONFIG or $HOME/.kube/config.
+	ConfigPath string
+	// Context of the kubeconfig, defaults to the current context
+	Context string
+	// Namespace of the created resources, defaults to the one of the
+	// context or "default"
+	Namespace string
+
+	// Image is the containerDisk image holding the Flatcar kubevirt image
+	Image string
+	// Memory of the VMs, e.g. "2Gi"
+	Memory string
+	// CPUs of the VMs
+	CPUs int
+}
+
+type API struct {
+	c       *http.Client
+	opts    *Options
+	profile *auth.KubeProfile
+}
+
+func New(opts *Options) (*API, error) {
+	profile, err := auth.ReadKubeConfig(opts.ConfigPath, opts.Context)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read kubeconfig: %v", err)
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = profile.Namespace
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: profile.Insecure}
+	if len(profile.CAData) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(profile.CAData) {
+			return nil, fmt.Errorf("couldn't parse the certificate authority of the kubeconfig")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(profile.ClientCertData) != 0 {
+		cert, err := tls.X509KeyPair(profile.ClientCertData, profile.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("parsing client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+
+	return &API{
+		c: &http.Client{
+			Transport: tr,
+			Timeout:   time.Minute,
+		},
+		opts:    opts,
+		profile: profile,
+	}, nil
+}
+
+// PreflightCheck checks that the KubeVirt API is served and the
+// namespace is accessible.
+func (a *API) PreflightCheck(ctx context.Context) error {
+	var list struct{}
+	return a.get(ctx, a.vmiPath(""), &list)
+}
+
+func (a *API) vmiPath(name string) string {
+	p := fmt.Sprintf("/apis/kubevirt.io/v1/namespaces/%s/virtualmachineinstances", a.opts.Namespace)
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+func (a *API) corePath(resource, name string) string {
+	p := fmt.Sprintf("/api/v1/namespaces/%s/%s", a.opts.Namespace, resource)
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+// apiError is returned for non-2xx responses.
+type apiError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func (a *API) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(a.profile.Server, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.profile.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(a.profile.Token))
+	}
+
+	resp, err := a.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// errors are returned as Status objects
+		var status struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &status) == nil && status.Message != "" {
+			message = status.Message
+		}
+		return &apiError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    message,
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+func (a *API) get(ctx context.Context, path string, result interface{}) error {
+	return a.do(ctx, http.MethodGet, path, nil, result)
+}
+
+// delete removes a resource, it is not an error if it does not exist.
+func (a *API) delete(ctx context.Context, path string) error {
+	if err := a.do(ctx, http.MethodDelete, path, nil, nil); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/util"
+)
+
+// VMI is a KubeVirt VirtualMachineInstance.
+type VMI struct {
+	Name string
+	UID  string
+	IP   string
+	// IPv6 is the IPv6 address on the pod network of dual-stack
+	// clusters.
+	IPv6 string
+}
+
+type objectMeta struct {
+	Name              string            `json:"name"`
+	UID               string            `json:"uid,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+}
+
+type vmiStatus struct {
+	Phase      string `json:"phase"`
+	Interfaces []struct {
+		IPAddress   string   `json:"ipAddress"`
+		IPAddresses []string `json:"ipAddresses"`
+	} `json:"interfaces"`
+}
+
+func userDataSecret(name string) string {
+	return name + "-userdata"
+}
+
+// CreateVMI creates a VMI booting the configured containerDisk image.
+// The userdata is stored in a secret and passed to the VMI on a config
+// drive. The VMI and the secret are labeled with the cluster name.
+func (a *API) CreateVMI(ctx context.Context, name, cluster string, userdata []byte) (*VMI, error) {
+	if a.opts.Image == "" {
+		return nil, fmt.Errorf("KubeVirt containerDisk image must be specified")
+	}
+
+	labels := map[string]string{
+		createdByLabel:        createdByValue,
+		"mantle/kola-cluster": cluster,
+	}
+
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   objectMeta{Name: userDataSecret(name), Labels: labels},
+		"type":       "Opaque",
+		// the data is base64 encoded by the JSON marshaller
+		"data": map[string][]byte{"userdata": userdata},
+	}
+	if err := a.do(ctx, http.MethodPost, a.corePath("secrets", ""), secret, nil); err != nil {
+		return nil, fmt.Errorf("creating userdata secret: %v", err)
+	}
+
+	domain := map[string]interface{}{
+		"resources": map[string]interface{}{
+			"requests": map[string]string{"memory": a.memory()},
+		},
+		"devices": map[string]interface{}{
+			"disks": []interface{}{
+				map[string]interface{}{"name": "containerdisk", "disk": map[string]string{"bus": "virtio"}},
+				map[string]interface{}{"name": "configdrive", "disk": map[string]string{"bus": "virtio"}},
+			},
+			"interfaces": []interface{}{
+				map[string]interface{}{"name": "default", "masquerade": map[string]string{}},
+			},
+			// stream the serial console to a container log
+			"logSerialConsole": true,
+		},
+	}
+	if a.opts.CPUs != 0 {
+		domain["cpu"] = map[string]int{"cores": a.opts.CPUs}
+	}
+
+	vmi := map[string]interface{}{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachineInstance",
+		"metadata":   objectMeta{Name: name, Labels: labels},
+		"spec": map[string]interface{}{
+			"domain": domain,
+			"networks": []interface{}{
+				map[string]interface{}{"name": "default", "pod": map[string]string{}},
+			},
+			"volumes": []interface{}{
+				map[string]interface{}{
+					"name":          "containerdisk",
+					"containerDisk": map[string]string{"image": a.opts.Image},
+				},
+				map[string]interface{}{
+					"name": "configdrive",
+					"cloudInitConfigDrive": map[string]interface{}{
+						"userDataSecretRef": map[string]string{"name": userDataSecret(name)},
+					},
+				},
+			},
+		},
+	}
+
+	var created struct {
+		Metadata objectMeta `json:"metadata"`
+	}
+	if err := a.do(ctx, http.MethodPost, a.vmiPath(""), vmi, &created); err != nil {
+		a.delete(ctx, a.corePath("secrets", userDataSecret(name)))
+		return nil, fmt.Errorf("creating VMI: %v", err)
+	}
+
+	return &VMI{
+		Name: name,
+		UID:  created.Metadata.UID,
+	}, nil
+}
+
+func (a *API) memory() string {
+	if a.opts.Memory == "" {
+		return "2Gi"
+	}
+	return a.opts.Memory
+}
+
+// WaitForIP waits until the VMI is running and has an IP address on the
+// pod network.
+func (a *API) WaitForIP(ctx context.Context, vmi *VMI, timeout time.Duration) error {
+	return util.WaitUntilReady(timeout, 5*time.Second, func() (bool, error) {
+		var v struct {
+			Status vmiStatus `json:"status"`
+		}
+		if err := a.get(ctx, a.vmiPath(vmi.Name), &v); err != nil {
+			return false, err
+		}
+		switch v.Status.Phase {
+		case "Failed", "Succeeded":
+			return false, fmt.Errorf("VMI %s is %s", vmi.Name, strings.ToLower(v.Status.Phase))
+		case "Running":
+			if len(v.Status.Interfaces) > 0 && v.Status.Interfaces[0].IPAddress != "" {
+				vmi.IP = v.Status.Interfaces[0].IPAddress
+				for _, ip := range v.Status.Interfaces[0].IPAddresses {
+					if strings.Contains(ip, ":") {
+						vmi.IPv6 = ip
+						break
+					}
+				}
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// ConsoleOutput returns the serial console log of the VMI, it is only
+// available as long as the VMI exists.
+func (a *API) ConsoleOutput(ctx context.Context, vmi *VMI) (string, error) {
+	var pods struct {
+		Items []struct {
+			Metadata objectMeta `json:"metadata"`
+		} `json:"items"`
+	}
+	query := url.Values{"labelSelector": {"kubevirt.io/created-by=" + vmi.UID}}
+	if err := a.get(ctx, a.corePath("pods", "")+"?"+query.Encode(), &pods); err != nil {
+		return "", fmt.Errorf("finding virt-launcher pod: %v", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no virt-launcher pod for VMI %s", vmi.Name)
+	}
+
+	var log []byte
+	query = url.Values{"container": {"guest-console-log"}}
+	if err := a.get(ctx, a.corePath("pods", pods.Items[0].Metadata.Name)+"/log?"+query.Encode(), &log); err != nil {
+		return "", fmt.Errorf("getting console log: %v", err)
+	}
+	return string(log), nil
+}
+
+// DeleteVMI removes the VMI and its userdata secret.
+func (a *API) DeleteVMI(ctx context.Context, name string) error {
+	if err := a.delete(ctx, a.vmiPath(name)); err != nil {
+		return fmt.Errorf("deleting VMI %s: %v", name, err)
+	}
+	if err := a.delete(ctx, a.corePath("secrets", userDataSecret(name))); err != nil {
+		return fmt.Errorf("deleting userdata secret of %s: %v", name, err)
+	}
+	return nil
+}
+
+// GC removes VMIs and userdata secrets created by Mantle longer than
+// gracePeriod ago.
+func (a *API) GC(ctx context.Context, gracePeriod time.Duration) error {
+	query := "?" + url.Values{"labelSelector": {createdByLabel + "=" + createdByValue}}.Encode()
+
+	for _, path := range []string{a.vmiPath(""), a.corePath("secrets", "")} {
+		var list struct {
+			Items []struct {
+				Metadata objectMeta `json:"metadata"`
+			} `json:"items"`
+		}
+		if err := a.get(ctx, path+query, &list); err != nil {
+			return fmt.Errorf("listing %s: %v", path, err)
+		}
+		for _, item := range list.Items {
+			created := item.Metadata.CreationTimestamp
+			if created == nil || time.Since(*created) < gracePeriod {
+				continue
+			}
+			plog.Infof("deleting %s/%s", path, item.Metadata.Name)
+			if err := a.delete(ctx, path+"/"+item.Metadata.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -73,6 +73,8 @@ type Options struct {
 	User string
 	// Keyfile is the abs. path to private SSH key file for the User on the Host
 	Keyfile string
+	// ConfigDrive passes the userdata on a config drive instead of the metadata service
+	ConfigDrive bool
 }
 
 type Server struct {
@@ -270,7 +272,12 @@ func (a *API) PreflightCheck() error {
 	return nil
 }
 
-func (a *API) CreateServer(name, sshKeyID, userdata string) (*Server, error) {
+// CreateServer creates a server with the given userdata. If configDrive or
+// the ConfigDrive option is set, the userdata is also passed on a config
+// drive so that it is available without the metadata service.
+func (a *API) CreateServer(name, sshKeyID, userdata string, configDrive bool) (*Server, error) {
+	configDrive = configDrive || a.opts.ConfigDrive
+
 	networkID := a.opts.Network
 	if networkID == "" {
 		networks, err := a.getNetworks()
@@ -299,7 +306,8 @@ func (a *API) CreateServer(name, sshKeyID, userdata string) (*Server, error) {
 					UUID: networkID,
 				},
 			},
-			UserData: []byte(userdata),
+			UserData:    []byte(userdata),
+			ConfigDrive: &configDrive,
 		},
 		KeyName: sshKeyID,
 	}).Extract()
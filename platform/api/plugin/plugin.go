@@ -0,0 +1,314 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin lets kola run tests on platforms implemented by external
+// programs. A plugin is an executable named kola-platform-<name> which
+// serves a Provider with Serve. kola starts it for --platform=<name> and
+// talks JSON-RPC to it over its stdin and stdout, its stderr is passed
+// through.
+//
+// Plugins of third parties can be run in a Sandbox, as another user,
+// without the environment of kola and with a seccomp filter. Their only
+// way to interact with kola is the Provider interface, and their replies
+// are checked before kola uses them.
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/plugin")
+)
+
+// ProtocolVersion is increased on incompatible changes of the Provider
+// interface or its types.
+const ProtocolVersion = 1
+
+// ExecutablePrefix is the prefix of the names of plugin executables.
+const ExecutablePrefix = "kola-platform-"
+
+// Provider creates and destroys machines on a platform. Its methods may
+// be called concurrently.
+type Provider interface {
+	// Init is called once before any other method.
+	Init(req InitRequest) (*InitResponse, error)
+	// CreateMachine boots a machine with the user data and returns once
+	// its IP addresses are known.
+	CreateMachine(req CreateMachineRequest) (*Machine, error)
+	// DestroyMachine deletes the machine with the given ID.
+	DestroyMachine(id string) error
+	// ConsoleOutput returns the serial console output of the machine, or
+	// "" if the platform has no console access.
+	ConsoleOutput(id string) (string, error)
+	// Cleanup is called last and removes resources shared by the
+	// machines, e.g. uploaded SSH keys.
+	Cleanup() error
+}
+
+type InitRequest struct {
+	// Platform is the name the plugin was started for.
+	Platform string
+	Board    string
+	// Options are given with --plugin-opt key=value.
+	Options map[string]string
+}
+
+type InitResponse struct {
+	// CTPlatform is the Container Linux Config platform used to render
+	// configs, "custom" if empty.
+	CTPlatform string
+	// IgnitionVars replace variables like $public_ipv4 in Ignition
+	// configs, e.g. by "${COREOS_CUSTOM_PUBLIC_IPV4}".
+	IgnitionVars map[string]string
+}
+
+type CreateMachineRequest struct {
+	Name string
+	// UserData is the rendered Ignition config or cloud-config.
+	UserData string
+	// SSHKeys are authorized_keys lines for platforms passing keys in
+	// their metadata. They are also part of UserData.
+	SSHKeys []string
+	// OutputDir is where the plugin may write logs of the machine.
+	OutputDir string
+}
+
+type Machine struct {
+	ID        string
+	PublicIP  string
+	PrivateIP string
+	// PublicIPv6 and PrivateIPv6 are optional, PrivateIPv6 defaults
+	// to PublicIPv6.
+	PublicIPv6  string
+	PrivateIPv6 string
+}
+
+// Empty is the argument or reply of calls without one.
+type Empty struct{}
+
+// Options configures the plugin platform.
+type Options struct {
+	*platform.Options
+
+	// Name of the platform, e.g. "foo" for kola-platform-foo.
+	Name string
+	// Path of the plugin executable, kola-platform-<Name> in $PATH if
+	// empty.
+	Path string
+	// PluginOptions are passed to the plugin in InitRequest.
+	PluginOptions map[string]string
+	// Sandbox runs the plugin in a Sandbox as SandboxUser.
+	Sandbox     bool
+	SandboxUser string
+}
+
+// Sandbox restricts a plugin running code of third parties on the host.
+// The plugin runs as User, only gets PATH, LANG, LC_ALL, TZ and TMPDIR of
+// the environment, so no cloud credentials, and can't use syscalls giving
+// access to other processes, the kernel or the mounts of the host.
+// Starting it needs root, and User must be able to execute the plugin.
+type Sandbox struct {
+	// User the plugin runs as, "nobody" if empty.
+	User string
+}
+
+// Lookup returns the path of the plugin executable for the platform.
+func Lookup(name string) (string, error) {
+	return exec.LookPath(ExecutablePrefix + name)
+}
+
+// server wraps a Provider for net/rpc.
+type server struct {
+	p Provider
+}
+
+func (s *server) Handshake(version int, reply *int) error {
+	*reply = ProtocolVersion
+	if version != ProtocolVersion {
+		return fmt.Errorf("plugin speaks protocol version %d, not %d", ProtocolVersion, version)
+	}
+	return nil
+}
+
+func (s *server) Init(req InitRequest, reply *InitResponse) error {
+	res, err := s.p.Init(req)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		*reply = *res
+	}
+	return nil
+}
+
+func (s *server) CreateMachine(req CreateMachineRequest, reply *Machine) error {
+	m, err := s.p.CreateMachine(req)
+	if err != nil {
+		return err
+	}
+	*reply = *m
+	return nil
+}
+
+func (s *server) DestroyMachine(id string, reply *Empty) error {
+	return s.p.DestroyMachine(id)
+}
+
+func (s *server) ConsoleOutput(id string, reply *string) error {
+	out, err := s.p.ConsoleOutput(id)
+	*reply = out
+	return err
+}
+
+func (s *server) Cleanup(args Empty, reply *Empty) error {
+	return s.p.Cleanup()
+}
+
+// Serve serves the Provider on stdin and stdout until kola closes them.
+// Plugins must not write anything else to stdout, logs go to stderr.
+func Serve(p Provider) {
+	serve(p, stdio{os.Stdin, os.Stdout})
+}
+
+func serve(p Provider, conn io.ReadWriteCloser) {
+	s := rpc.NewServer()
+	if err := s.RegisterName("Provider", &server{p}); err != nil {
+		panic(err)
+	}
+	s.ServeCodec(jsonrpc.NewServerCodec(conn))
+}
+
+// stdio joins a reader and a writer into a connection.
+type stdio struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (s stdio) Close() error {
+	werr := s.WriteCloser.Close()
+	if err := s.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return werr
+}
+
+// Client is a Provider implemented by a running plugin.
+type Client struct {
+	cmd *exec.Cmd
+	rpc *rpc.Client
+}
+
+var _ Provider = &Client{}
+
+// Start runs the plugin executable, in sandbox if it is not nil, and
+// checks that it speaks the same protocol version.
+func Start(path string, sandbox *Sandbox) (*Client, error) {
+	cmd := exec.Command(path)
+	if sandbox != nil {
+		var err error
+		if cmd, err = sandbox.command(path); err != nil {
+			return nil, fmt.Errorf("sandboxing plugin %s: %v", path, err)
+		}
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting plugin %s: %v", path, err)
+	}
+	plog.Debugf("started plugin %s with PID %d", path, cmd.Process.Pid)
+
+	c := newClient(stdio{stdout, stdin})
+	c.cmd = cmd
+	if err := c.handshake(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("plugin %s: %v", path, err)
+	}
+	return c, nil
+}
+
+func newClient(conn io.ReadWriteCloser) *Client {
+	return &Client{rpc: jsonrpc.NewClient(conn)}
+}
+
+func (c *Client) handshake() error {
+	var version int
+	return c.rpc.Call("Provider.Handshake", ProtocolVersion, &version)
+}
+
+func (c *Client) Init(req InitRequest) (*InitResponse, error) {
+	var res InitResponse
+	if err := c.rpc.Call("Provider.Init", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) CreateMachine(req CreateMachineRequest) (*Machine, error) {
+	var m Machine
+	if err := c.rpc.Call("Provider.CreateMachine", req, &m); err != nil {
+		return nil, err
+	}
+	if m.ID == "" {
+		return nil, fmt.Errorf("plugin returned no machine ID")
+	}
+	for _, ip := range []string{m.PublicIP, m.PrivateIP, m.PublicIPv6, m.PrivateIPv6} {
+		if ip != "" && net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("plugin returned invalid IP address %q", ip)
+		}
+	}
+	return &m, nil
+}
+
+func (c *Client) DestroyMachine(id string) error {
+	return c.rpc.Call("Provider.DestroyMachine", id, &Empty{})
+}
+
+func (c *Client) ConsoleOutput(id string) (string, error) {
+	var out string
+	err := c.rpc.Call("Provider.ConsoleOutput", id, &out)
+	return out, err
+}
+
+func (c *Client) Cleanup() error {
+	return c.rpc.Call("Provider.Cleanup", Empty{}, &Empty{})
+}
+
+// Close stops the plugin by closing its stdin and waits for it to exit.
+func (c *Client) Close() error {
+	err := c.rpc.Close()
+	if c.cmd != nil {
+		if werr := c.cmd.Wait(); werr != nil {
+			return fmt.Errorf("plugin exited: %v", werr)
+		}
+	}
+	return err
+}
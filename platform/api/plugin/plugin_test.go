@@ -0,0 +1,101 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+type fakeProvider struct {
+	mu       sync.Mutex
+	machines map[string]CreateMachineRequest
+}
+
+func (p *fakeProvider) Init(req InitRequest) (*InitResponse, error) {
+	if req.Options["region"] != "moon" {
+		return nil, fmt.Errorf("unexpected options %v", req.Options)
+	}
+	return &InitResponse{IgnitionVars: map[string]string{"$public_ipv4": "${COREOS_CUSTOM_PUBLIC_IPV4}"}}, nil
+}
+
+func (p *fakeProvider) CreateMachine(req CreateMachineRequest) (*Machine, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := fmt.Sprintf("m%d", len(p.machines))
+	p.machines[id] = req
+	return &Machine{ID: id, PublicIP: "192.0.2.1", PrivateIP: "10.0.0.1"}, nil
+}
+
+func (p *fakeProvider) DestroyMachine(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.machines[id]; !ok {
+		return fmt.Errorf("no machine %s", id)
+	}
+	delete(p.machines, id)
+	return nil
+}
+
+func (p *fakeProvider) ConsoleOutput(id string) (string, error) {
+	return "console of " + id, nil
+}
+
+func (p *fakeProvider) Cleanup() error {
+	return nil
+}
+
+func TestClientServer(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	p := &fakeProvider{machines: make(map[string]CreateMachineRequest)}
+	go serve(p, serverConn)
+	c := newClient(clientConn)
+	defer c.Close()
+
+	if err := c.handshake(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Init(InitRequest{Platform: "fake", Options: map[string]string{"region": "moon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IgnitionVars["$public_ipv4"] != "${COREOS_CUSTOM_PUBLIC_IPV4}" {
+		t.Errorf("unexpected init response %+v", res)
+	}
+
+	m, err := c.CreateMachine(CreateMachineRequest{Name: "kola-1", UserData: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PublicIP != "192.0.2.1" || m.PrivateIP != "10.0.0.1" {
+		t.Errorf("unexpected machine %+v", m)
+	}
+	out, err := c.ConsoleOutput(m.ID)
+	if err != nil || out != "console of "+m.ID {
+		t.Errorf("unexpected console output %q: %v", out, err)
+	}
+	if err := c.DestroyMachine(m.ID); err != nil {
+		t.Fatal(err)
+	}
+	// errors of the provider are passed through
+	if err := c.DestroyMachine(m.ID); err == nil || err.Error() != "no machine "+m.ID {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := c.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && (amd64 || arm64)
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxEnv is set when kola runs itself to execute a sandboxed plugin,
+// to the path of the plugin.
+const sandboxEnv = "_KOLA_PLUGIN_SANDBOX"
+
+const (
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+
+	// x32 syscalls on amd64 have the numbers of the x86_64 ones with
+	// this bit set
+	x32SyscallBit = 0x40000000
+)
+
+// sandboxEnvAllowed are the variables of the environment of kola passed to
+// sandboxed plugins. All others, e.g. cloud credentials, are dropped.
+var sandboxEnvAllowed = []string{"PATH", "LANG", "LC_ALL", "TZ", "TMPDIR"}
+
+// sandboxDeniedSyscalls fail with EPERM in sandboxed plugins. They give
+// access to other processes, the kernel or the mounts of the host, which
+// no plugin needs to manage machines.
+var sandboxDeniedSyscalls = []uint32{
+	unix.SYS_ADD_KEY,
+	unix.SYS_BPF,
+	unix.SYS_CHROOT,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_PTRACE,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETNS,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+func init() {
+	if path := os.Getenv(sandboxEnv); path != "" {
+		if err := execSandboxed(path); err != nil {
+			fmt.Fprintf(os.Stderr, "starting sandboxed plugin %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// command returns the command running the plugin at path in the sandbox:
+// kola itself as the user of the sandbox with only the allowed environment,
+// which installs the seccomp filter and executes the plugin in init.
+func (s *Sandbox) command(path string) (*exec.Cmd, error) {
+	name := s.User
+	if name == "" {
+		name = "nobody"
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UID of user %s: %v", name, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GID of user %s: %v", name, err)
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("running the plugin as user %s needs root", name)
+	}
+
+	// /proc/self/exe works even if the user may not search the
+	// directories of kola
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Env = append(sandboxEnviron(os.Environ()), sandboxEnv+"="+path)
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+// sandboxEnviron returns the allowed variables of environ, with HOME set
+// to the root directory.
+func sandboxEnviron(environ []string) []string {
+	env := []string{"HOME=/"}
+	for _, kv := range environ {
+		for _, key := range sandboxEnvAllowed {
+			if strings.HasPrefix(kv, key+"=") {
+				env = append(env, kv)
+			}
+		}
+	}
+	return env
+}
+
+// execSandboxed installs the seccomp filter and executes the plugin at
+// path in place of kola.
+func execSandboxed(path string) error {
+	// the filter applies to the thread executing the plugin
+	runtime.LockOSThread()
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, sandboxEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %v", err)
+	}
+	filter := seccompFilter()
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("installing seccomp filter: %v", err)
+	}
+	runtime.KeepAlive(filter)
+
+	return syscall.Exec(path, []string{path}, env)
+}
+
+// seccompFilter returns the BPF program denying sandboxDeniedSyscalls and
+// all syscalls of other architectures, e.g. i386 on amd64.
+func seccompFilter() []unix.SockFilter {
+	n := len(sandboxDeniedSyscalls)
+	filter := []unix.SockFilter{
+		// offsetof(struct seccomp_data, arch)
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: auditArch, Jt: 1},
+		{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetErrno | uint32(unix.EPERM)},
+		// offsetof(struct seccomp_data, nr)
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, K: x32SyscallBit, Jt: uint8(n + 1)},
+	}
+	for i, nr := range sandboxDeniedSyscalls {
+		filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: nr, Jt: uint8(n - i)})
+	}
+	return append(filter,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetErrno | uint32(unix.EPERM)})
+}
+
+// Chown hands path over to the user a sandboxed plugin runs as, so the
+// plugin may write to it.
+func (c *Client) Chown(path string) error {
+	if c.cmd == nil || c.cmd.SysProcAttr == nil || c.cmd.SysProcAttr.Credential == nil {
+		return nil
+	}
+	cred := c.cmd.SysProcAttr.Credential
+	return os.Chown(path, int(cred.Uid), int(cred.Gid))
+}
@@ -0,0 +1,90 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && (amd64 || arm64)
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runFilter interprets the instructions used by seccompFilter.
+func runFilter(t *testing.T, filter []unix.SockFilter, arch, nr uint32) uint32 {
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		ins := filter[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = map[uint32]uint32{0: nr, 4: arch}[ins.K]
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if acc == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			if acc >= ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %+v", ins)
+		}
+	}
+	t.Fatal("filter did not return")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	filter := seccompFilter()
+	eperm := seccompRetErrno | uint32(unix.EPERM)
+	for _, tt := range []struct {
+		name     string
+		arch, nr uint32
+		want     uint32
+	}{
+		{"read", auditArch, unix.SYS_READ, seccompRetAllow},
+		{"ptrace", auditArch, unix.SYS_PTRACE, eperm},
+		{"mount", auditArch, unix.SYS_MOUNT, eperm},
+		{"userfaultfd", auditArch, unix.SYS_USERFAULTFD, eperm},
+		{"x32", auditArch, x32SyscallBit | unix.SYS_READ, eperm},
+		{"other arch", unix.AUDIT_ARCH_I386, unix.SYS_READ, eperm},
+	} {
+		if got := runFilter(t, filter, tt.arch, tt.nr); got != tt.want {
+			t.Errorf("%s: got %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSandboxEnviron(t *testing.T) {
+	got := sandboxEnviron([]string{
+		"PATH=/usr/bin",
+		"HOME=/root",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"GOOGLE_APPLICATION_CREDENTIALS=/root/key.json",
+		"PATHS=no",
+		"TZ=UTC",
+	})
+	want := []string{"HOME=/", "PATH=/usr/bin", "TZ=UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux || !(amd64 || arm64)
+
+package plugin
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func (s *Sandbox) command(path string) (*exec.Cmd, error) {
+	return nil, errors.New("sandboxing plugins is only supported on Linux on amd64 and arm64")
+}
+
+// Chown does nothing, plugins are never sandboxed here.
+func (c *Client) Chown(path string) error {
+	return nil
+}
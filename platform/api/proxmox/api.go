@@ -0,0 +1,251 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/util"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/proxmox")
+)
+
+type Options struct {
+	*platform.Options
+
+	// Config file. Defaults to $HOME/.config/proxmox.json.
+	ConfigPath string
+	// Profile name
+	Profile string
+
+	// API endpoint, e.g. "https://pve.example.com:8006" (overrides config profile)
+	URL string
+	// API token ID in the form USER@REALM!TOKENID (overrides config profile)
+	TokenID string
+	// API token secret (overrides config profile)
+	TokenSecret string
+	// Node to create VMs on (overrides config profile)
+	Node string
+	// Skip TLS certificate verification, Proxmox uses self-signed
+	// certificates by default
+	Insecure bool
+
+	// Template is the VM ID of the Flatcar template to clone
+	Template int
+	// Storage holding the cloned VM disks; empty keeps the template storage
+	Storage string
+	// ISOStorage is where config drives are uploaded to
+	ISOStorage string
+	// Pool is an optional resource pool for created VMs
+	Pool string
+	// Bridge is the network bridge of the first NIC; empty keeps the template setting
+	Bridge string
+	// Memory in MiB; zero keeps the template setting
+	Memory int
+	// Cores per VM; zero keeps the template setting
+	Cores int
+}
+
+type API struct {
+	c    *http.Client
+	opts *Options
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.URL == "" || opts.TokenID == "" || opts.TokenSecret == "" || opts.Node == "" {
+		profiles, err := auth.ReadProxmoxConfig(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Proxmox config: %v", err)
+		}
+
+		if opts.Profile == "" {
+			opts.Profile = "default"
+		}
+		profile, ok := profiles[opts.Profile]
+		if !ok {
+			return nil, fmt.Errorf("no such profile %q", opts.Profile)
+		}
+		if opts.URL == "" {
+			opts.URL = profile.URL
+		}
+		if opts.TokenID == "" {
+			opts.TokenID = profile.TokenID
+		}
+		if opts.TokenSecret == "" {
+			opts.TokenSecret = profile.TokenSecret
+		}
+		if opts.Node == "" {
+			opts.Node = profile.Node
+		}
+		if !opts.Insecure {
+			opts.Insecure = profile.Insecure
+		}
+	}
+
+	if opts.URL == "" {
+		return nil, fmt.Errorf("Proxmox API URL must be specified")
+	}
+	if opts.Node == "" {
+		return nil, fmt.Errorf("Proxmox node must be specified")
+	}
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	return &API{
+		c: &http.Client{
+			Transport: tr,
+			Timeout:   10 * time.Minute,
+		},
+		opts: opts,
+	}, nil
+}
+
+// PreflightCheck checks that the API is reachable and the credentials are
+// valid for the configured node.
+func (a *API) PreflightCheck(ctx context.Context) error {
+	var status struct {
+		Uptime int `json:"uptime"`
+	}
+	return a.get(ctx, a.nodePath("status"), &status)
+}
+
+func (a *API) nodePath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/nodes/%s/", url.PathEscape(a.opts.Node)) + fmt.Sprintf(format, args...)
+}
+
+// apiError is returned for non-2xx responses.
+type apiError struct {
+	Method  string
+	Path    string
+	Status  string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+func (a *API) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.opts.URL+"/api2/json"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", a.opts.TokenID, a.opts.TokenSecret))
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+func (a *API) do(req *http.Request, result interface{}) error {
+	resp, err := a.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Status:  resp.Status,
+			Message: strings.TrimSpace(string(body)),
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	// all responses are wrapped in a "data" object
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{result}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+func (a *API) get(ctx context.Context, path string, result interface{}) error {
+	req, err := a.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return a.do(req, result)
+}
+
+func (a *API) send(ctx context.Context, method, path string, params url.Values, result interface{}) error {
+	req, err := a.newRequest(ctx, method, path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(req, result)
+}
+
+// task runs an asynchronous API call and waits for the returned task to
+// finish.
+func (a *API) task(ctx context.Context, method, path string, params url.Values) error {
+	var upid string
+	if err := a.send(ctx, method, path, params, &upid); err != nil {
+		return err
+	}
+	return a.waitTask(ctx, upid)
+}
+
+func (a *API) waitTask(ctx context.Context, upid string) error {
+	if upid == "" {
+		// synchronous call, nothing to wait for
+		return nil
+	}
+
+	var status struct {
+		Status     string `json:"status"`
+		ExitStatus string `json:"exitstatus"`
+	}
+	err := util.WaitUntilReady(20*time.Minute, 2*time.Second, func() (bool, error) {
+		if err := a.get(ctx, a.nodePath("tasks/%s/status", url.PathEscape(upid)), &status); err != nil {
+			return false, err
+		}
+		return status.Status == "stopped", nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for task %s: %v", upid, err)
+	}
+	if status.ExitStatus != "OK" {
+		return fmt.Errorf("task %s failed: %s", upid, status.ExitStatus)
+	}
+	return nil
+}
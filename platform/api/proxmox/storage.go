@@ -0,0 +1,140 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+// UploadISO uploads an ISO image to the configured ISO storage and returns
+// its volume ID.
+func (a *API) UploadISO(ctx context.Context, path string) (string, error) {
+	return a.upload(ctx, a.isoStorage(), "iso", path)
+}
+
+// UploadImage uploads a disk image to the configured ISO storage so that
+// it can be imported with CreateTemplate. This needs Proxmox VE 8.2 or
+// newer and a storage with the "import" content type enabled.
+func (a *API) UploadImage(ctx context.Context, path string) (string, error) {
+	return a.upload(ctx, a.isoStorage(), "import", path)
+}
+
+func (a *API) isoStorage() string {
+	if a.opts.ISOStorage == "" {
+		return "local"
+	}
+	return a.opts.ISOStorage
+}
+
+func (a *API) upload(ctx context.Context, storage, content, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+
+	// stream the multipart body instead of buffering whole disk images
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			if err := mw.WriteField("content", content); err != nil {
+				return err
+			}
+			part, err := mw.CreateFormFile("filename", name)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, f); err != nil {
+				return err
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	req, err := a.newRequest(ctx, "POST", a.nodePath("storage/%s/upload", url.PathEscape(storage)), pr)
+	if err != nil {
+		pr.Close()
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var upid string
+	if err := a.do(req, &upid); err != nil {
+		return "", fmt.Errorf("uploading %s: %v", path, err)
+	}
+	if err := a.waitTask(ctx, upid); err != nil {
+		return "", fmt.Errorf("uploading %s: %v", path, err)
+	}
+
+	return fmt.Sprintf("%s:%s/%s", storage, content, name), nil
+}
+
+// DeleteVolume removes a volume given by its volume ID.
+func (a *API) DeleteVolume(ctx context.Context, volid string) error {
+	storage := strings.SplitN(volid, ":", 2)[0]
+	return a.task(ctx, "DELETE", a.nodePath("storage/%s/content/%s", url.PathEscape(storage), url.PathEscape(volid)), nil)
+}
+
+// MakeConfigDrive writes a NoCloud config drive ISO holding the userdata
+// to dir and returns its path. Flatcar's proxmoxve OEM reads Ignition
+// configs from the "user-data" file of such a drive.
+func MakeConfigDrive(dir, instanceID string, userdata []byte) (string, error) {
+	root := filepath.Join(dir, "cidata")
+	if err := os.MkdirAll(root, 0777); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(root, "user-data"), userdata, 0644); err != nil {
+		return "", err
+	}
+	md := conf.MetaData{InstanceID: instanceID, Hostname: instanceID}
+	metadata, err := md.NoCloudMetaData()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(root, "meta-data"), metadata, 0644); err != nil {
+		return "", err
+	}
+
+	iso := filepath.Join(dir, instanceID+"-cidata.iso")
+	var tool string
+	for _, candidate := range []string{"genisoimage", "mkisofs", "xorrisofs"} {
+		if _, err := exec.LookPath(candidate); err == nil {
+			tool = candidate
+			break
+		}
+	}
+	if tool == "" {
+		return "", fmt.Errorf("creating config drive: none of genisoimage, mkisofs or xorrisofs found")
+	}
+	out, err := exec.Command(tool, "-quiet", "-output", iso, "-volid", "cidata", "-joliet", "-rock", root).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("creating config drive: %s: %v", out, err)
+	}
+	return iso, nil
+}
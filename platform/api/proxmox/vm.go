@@ -0,0 +1,337 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/util"
+)
+
+// createdPrefix starts the line of the description of cloned VMs with
+// their creation time, see createdAt.
+const createdPrefix = "mantle-created: "
+
+// VM is a Proxmox VE QEMU guest.
+type VM struct {
+	ID     int
+	Name   string
+	Uptime time.Duration
+}
+
+// nextID asks the cluster for a free VM ID.
+func (a *API) nextID(ctx context.Context) (int, error) {
+	var id string
+	if err := a.get(ctx, "/cluster/nextid", &id); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// CreateVM clones the configured template into a new VM, attaches the
+// config drive volume configDrive if not empty, and starts the VM.
+func (a *API) CreateVM(ctx context.Context, name, configDrive string) (*VM, error) {
+	if a.opts.Template == 0 {
+		return nil, fmt.Errorf("Proxmox template VM ID must be specified")
+	}
+
+	id, err := a.nextID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting next VM ID: %v", err)
+	}
+	vm := &VM{ID: id, Name: name}
+
+	params := url.Values{
+		"newid": {strconv.Itoa(id)},
+		"name":  {name},
+		// GC keeps VMs which are not started yet by their age
+		"description": {createdPrefix + time.Now().UTC().Format(time.RFC3339)},
+	}
+	if a.opts.Storage != "" {
+		// storage may only be given for full clones
+		params.Set("full", "1")
+		params.Set("storage", a.opts.Storage)
+	}
+	if a.opts.Pool != "" {
+		params.Set("pool", a.opts.Pool)
+	}
+	if err := a.task(ctx, "POST", a.nodePath("qemu/%d/clone", a.opts.Template), params); err != nil {
+		return nil, fmt.Errorf("cloning template %d: %v", a.opts.Template, err)
+	}
+
+	config := url.Values{
+		// the IP address is discovered through the guest agent
+		"agent": {"1"},
+	}
+	if configDrive != "" {
+		config.Set("ide2", configDrive+",media=cdrom")
+	}
+	if a.opts.Memory != 0 {
+		config.Set("memory", strconv.Itoa(a.opts.Memory))
+	}
+	if a.opts.Cores != 0 {
+		config.Set("cores", strconv.Itoa(a.opts.Cores))
+	}
+	if a.opts.Bridge != "" {
+		config.Set("net0", "virtio,bridge="+a.opts.Bridge)
+	}
+	if err := a.task(ctx, "POST", a.nodePath("qemu/%d/config", id), config); err != nil {
+		a.DeleteVM(ctx, id)
+		return nil, fmt.Errorf("configuring VM %d: %v", id, err)
+	}
+
+	if err := a.task(ctx, "POST", a.nodePath("qemu/%d/status/start", id), url.Values{}); err != nil {
+		a.DeleteVM(ctx, id)
+		return nil, fmt.Errorf("starting VM %d: %v", id, err)
+	}
+
+	return vm, nil
+}
+
+// DeleteVM stops and removes the VM including its disks.
+func (a *API) DeleteVM(ctx context.Context, id int) error {
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := a.get(ctx, a.nodePath("qemu/%d/status/current", id), &status); err != nil {
+		return err
+	}
+	if status.Status != "stopped" {
+		if err := a.task(ctx, "POST", a.nodePath("qemu/%d/status/stop", id), url.Values{}); err != nil {
+			return fmt.Errorf("stopping VM %d: %v", id, err)
+		}
+	}
+
+	params := url.Values{
+		"purge":                      {"1"},
+		"destroy-unreferenced-disks": {"1"},
+	}
+	if err := a.task(ctx, "DELETE", a.nodePath("qemu/%d?%s", id, params.Encode()), nil); err != nil {
+		return fmt.Errorf("deleting VM %d: %v", id, err)
+	}
+	return nil
+}
+
+// GetVMIP waits until the guest agent reports an IPv4 address for the VM.
+// The global IPv6 address reported along with it, if any, is returned as
+// well.
+func (a *API) GetVMIP(ctx context.Context, id int, timeout time.Duration) (ip, ipv6 string, err error) {
+	err = util.WaitUntilReady(timeout, 5*time.Second, func() (bool, error) {
+		var result struct {
+			Result []struct {
+				Name      string `json:"name"`
+				Addresses []struct {
+					Type    string `json:"ip-address-type"`
+					Address string `json:"ip-address"`
+				} `json:"ip-addresses"`
+			} `json:"result"`
+		}
+		if err := a.get(ctx, a.nodePath("qemu/%d/agent/network-get-interfaces", id), &result); err != nil {
+			// the agent is not running until the machine booted
+			plog.Debugf("waiting for guest agent of VM %d: %v", id, err)
+			return false, nil
+		}
+		for _, iface := range result.Result {
+			for _, addr := range iface.Addresses {
+				parsed := net.ParseIP(addr.Address)
+				if parsed == nil || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() {
+					continue
+				}
+				switch addr.Type {
+				case "ipv4":
+					if ip == "" {
+						ip = addr.Address
+					}
+				case "ipv6":
+					if ipv6 == "" {
+						ipv6 = addr.Address
+					}
+				}
+			}
+		}
+		return ip != "", nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("getting IP address of VM %d: %v", id, err)
+	}
+	return ip, ipv6, nil
+}
+
+// ListVMs returns the VMs on the node whose name starts with prefix.
+func (a *API) ListVMs(ctx context.Context, prefix string) ([]VM, error) {
+	var list []struct {
+		VMID     int    `json:"vmid"`
+		Name     string `json:"name"`
+		Template int    `json:"template"`
+		Uptime   int64  `json:"uptime"`
+	}
+	if err := a.get(ctx, a.nodePath("qemu"), &list); err != nil {
+		return nil, err
+	}
+
+	var vms []VM
+	for _, vm := range list {
+		if vm.Template == 0 && strings.HasPrefix(vm.Name, prefix) {
+			vms = append(vms, VM{
+				ID:     vm.VMID,
+				Name:   vm.Name,
+				Uptime: time.Duration(vm.Uptime) * time.Second,
+			})
+		}
+	}
+	return vms, nil
+}
+
+// createdAt returns the creation time of the VM from its description, or
+// from the ctime Proxmox VE records in its meta property, or the zero time
+// if neither is set.
+func (a *API) createdAt(ctx context.Context, id int) (time.Time, error) {
+	var config struct {
+		Description string `json:"description"`
+		Meta        string `json:"meta"`
+	}
+	if err := a.get(ctx, a.nodePath("qemu/%d/config", id), &config); err != nil {
+		return time.Time{}, fmt.Errorf("getting config of VM %d: %v", id, err)
+	}
+	for _, line := range strings.Split(config.Description, "\n") {
+		if strings.HasPrefix(line, createdPrefix) {
+			if t, err := time.Parse(time.RFC3339, strings.TrimPrefix(line, createdPrefix)); err == nil {
+				return t, nil
+			}
+		}
+	}
+	for _, field := range strings.Split(config.Meta, ",") {
+		if strings.HasPrefix(field, "ctime=") {
+			if ctime, err := strconv.ParseInt(strings.TrimPrefix(field, "ctime="), 10, 64); err == nil {
+				return time.Unix(ctime, 0), nil
+			}
+		}
+	}
+	return time.Time{}, nil
+}
+
+// CreateTemplate creates a new template named name from a disk image
+// volume previously uploaded with UploadImage.
+func (a *API) CreateTemplate(ctx context.Context, name, image string) (*VM, error) {
+	id, err := a.nextID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting next VM ID: %v", err)
+	}
+
+	storage := a.opts.Storage
+	if storage == "" {
+		storage = "local-lvm"
+	}
+	bridge := a.opts.Bridge
+	if bridge == "" {
+		bridge = "vmbr0"
+	}
+	memory := a.opts.Memory
+	if memory == 0 {
+		memory = 2048
+	}
+	cores := a.opts.Cores
+	if cores == 0 {
+		cores = 2
+	}
+
+	params := url.Values{
+		"vmid":   {strconv.Itoa(id)},
+		"name":   {name},
+		"ostype": {"l26"},
+		"memory": {strconv.Itoa(memory)},
+		"cores":  {strconv.Itoa(cores)},
+		"scsihw": {"virtio-scsi-pci"},
+		"scsi0":  {fmt.Sprintf("%s:0,import-from=%s", storage, image)},
+		"boot":   {"order=scsi0"},
+		"net0":   {"virtio,bridge=" + bridge},
+		"agent":  {"1"},
+		// capture the console on the serial port
+		"serial0": {"socket"},
+		"vga":     {"serial0"},
+	}
+	if a.opts.Pool != "" {
+		params.Set("pool", a.opts.Pool)
+	}
+	if err := a.task(ctx, "POST", a.nodePath("qemu"), params); err != nil {
+		return nil, fmt.Errorf("creating VM %d: %v", id, err)
+	}
+
+	if err := a.send(ctx, "POST", a.nodePath("qemu/%d/template", id), url.Values{}, nil); err != nil {
+		a.DeleteVM(ctx, id)
+		return nil, fmt.Errorf("converting VM %d to template: %v", id, err)
+	}
+
+	return &VM{ID: id, Name: name}, nil
+}
+
+// GC removes VMs whose name starts with prefix and which have been
+// running, or if they are stopped, exist for longer than gracePeriod,
+// along with leftover config drives. Stopped VMs without a known creation
+// time are kept.
+func (a *API) GC(ctx context.Context, prefix string, gracePeriod time.Duration) error {
+	vms, err := a.ListVMs(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("listing VMs: %v", err)
+	}
+
+	keep := make(map[string]bool)
+	for _, vm := range vms {
+		if vm.Uptime != 0 && vm.Uptime < gracePeriod {
+			keep[vm.Name] = true
+			continue
+		}
+		if vm.Uptime == 0 {
+			// stopped, or cloned by a concurrent run and not started yet
+			created, err := a.createdAt(ctx, vm.ID)
+			if err != nil {
+				return err
+			}
+			if created.IsZero() || time.Since(created) < gracePeriod {
+				keep[vm.Name] = true
+				continue
+			}
+		}
+		plog.Infof("deleting VM %d (%s)", vm.ID, vm.Name)
+		if err := a.DeleteVM(ctx, vm.ID); err != nil {
+			return err
+		}
+	}
+
+	var content []struct {
+		VolID string `json:"volid"`
+	}
+	if err := a.get(ctx, a.nodePath("storage/%s/content?content=iso", url.PathEscape(a.isoStorage())), &content); err != nil {
+		return fmt.Errorf("listing ISO images: %v", err)
+	}
+	for _, c := range content {
+		name := strings.TrimSuffix(c.VolID[strings.LastIndex(c.VolID, "/")+1:], "-cidata.iso")
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(c.VolID, "-cidata.iso") || keep[name] {
+			continue
+		}
+		plog.Infof("deleting config drive %s", c.VolID)
+		if err := a.DeleteVolume(ctx, c.VolID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
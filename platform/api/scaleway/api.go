@@ -0,0 +1,208 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/audit"
+	"github.com/flatcar/mantle/platform/throttle"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/scaleway")
+)
+
+const (
+	apiEndpoint = "https://api.scaleway.com"
+
+	// createdByTag is added to all created resources and used by GC.
+	createdByTag = "created-by=mantle"
+)
+
+type Options struct {
+	*platform.Options
+
+	// Config file. Defaults to $HOME/.config/scaleway.json.
+	ConfigPath string
+	// Profile name
+	Profile string
+	// Access key (overrides config profile)
+	AccessKey string
+	// Secret key (overrides config profile)
+	SecretKey string
+	// Project ID (overrides config profile)
+	ProjectID string
+
+	// Region (e.g. "fr-par")
+	Region string
+	// Zone (e.g. "fr-par-1")
+	Zone string
+	// Commercial type of the instances (e.g. "DEV1-S")
+	InstanceType string
+	// Image ID
+	Image string
+	// Bucket holding images to import
+	Bucket string
+}
+
+type API struct {
+	c    *http.Client
+	opts *Options
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.SecretKey == "" || opts.ProjectID == "" {
+		profiles, err := auth.ReadScalewayConfig(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Scaleway config: %v", err)
+		}
+
+		if opts.Profile == "" {
+			opts.Profile = "default"
+		}
+		profile, ok := profiles[opts.Profile]
+		if !ok {
+			return nil, fmt.Errorf("no such profile %q", opts.Profile)
+		}
+		if opts.AccessKey == "" {
+			opts.AccessKey = profile.AccessKey
+		}
+		if opts.SecretKey == "" {
+			opts.SecretKey = profile.SecretKey
+		}
+		if opts.ProjectID == "" {
+			opts.ProjectID = profile.ProjectID
+		}
+		if opts.Region == "" {
+			opts.Region = profile.Region
+		}
+		if opts.Zone == "" {
+			opts.Zone = profile.Zone
+		}
+	}
+
+	if opts.Zone == "" {
+		opts.Zone = "fr-par-1"
+	}
+	if opts.Region == "" {
+		// zones are named after their region, e.g. fr-par-1
+		opts.Region = opts.Zone[:strings.LastIndex(opts.Zone, "-")]
+	}
+
+	return &API{
+		c: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: throttle.Transport("scaleway", audit.Transport("scaleway", nil)),
+		},
+		opts: opts,
+	}, nil
+}
+
+// PreflightCheck checks that the credentials are valid.
+func (a *API) PreflightCheck(ctx context.Context) error {
+	var out struct {
+		Servers []server `json:"servers"`
+	}
+	return a.call(ctx, "GET", a.zonePath("servers?per_page=1"), nil, &out)
+}
+
+func (a *API) zonePath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/instance/v1/zones/%s/", a.opts.Zone) + fmt.Sprintf(format, args...)
+}
+
+// apiError is returned for non-2xx responses.
+type apiError struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %d: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// call sends in as JSON and decodes the response into out. in may be nil
+// or an io.Reader, which is sent as plain text.
+func (a *API) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	contentType := "application/json"
+	switch v := in.(type) {
+	case nil:
+	case io.Reader:
+		body = v
+		contentType = "text/plain"
+	default:
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiEndpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", a.opts.SecretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := a.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{
+			Method:  method,
+			Path:    path,
+			Status:  resp.StatusCode,
+			Message: strings.TrimSpace(string(data)),
+		}
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/flatcar/mantle/util"
+)
+
+// UploadObject uploads a local file to the configured Object Storage
+// bucket, which is S3-compatible.
+func (a *API) UploadObject(ctx context.Context, path, key string) error {
+	if a.opts.Bucket == "" {
+		return fmt.Errorf("Scaleway bucket must be specified")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(a.opts.AccessKey, a.opts.SecretKey, ""),
+		Endpoint:    aws.String(fmt.Sprintf("https://s3.%s.scw.cloud", a.opts.Region)),
+		Region:      aws.String(a.opts.Region),
+	})
+	if err != nil {
+		return err
+	}
+
+	plog.Infof("uploading %s to s3://%s/%s", path, a.opts.Bucket, key)
+	_, err = s3manager.NewUploader(sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Body:   f,
+		Bucket: aws.String(a.opts.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading %s: %v", path, err)
+	}
+	return nil
+}
+
+// CreateImage imports a qcow2 image from the configured Object Storage
+// bucket as snapshot and registers an image with it as root volume. The
+// image ID is returned.
+func (a *API) CreateImage(ctx context.Context, name, key, arch string) (string, error) {
+	var snap struct {
+		Snapshot struct {
+			ID string `json:"id"`
+		} `json:"snapshot"`
+	}
+	if err := a.call(ctx, "POST", a.zonePath("snapshots"), map[string]interface{}{
+		"name":        name,
+		"project":     a.opts.ProjectID,
+		"volume_type": "l_ssd",
+		"bucket":      a.opts.Bucket,
+		"key":         key,
+		"tags":        []string{createdByTag},
+	}, &snap); err != nil {
+		return "", fmt.Errorf("importing snapshot: %v", err)
+	}
+	snapshotID := snap.Snapshot.ID
+
+	err := util.WaitUntilReady(30*time.Minute, 15*time.Second, func() (bool, error) {
+		var out struct {
+			Snapshot struct {
+				State string `json:"state"`
+			} `json:"snapshot"`
+		}
+		if err := a.call(ctx, "GET", a.zonePath("snapshots/%s", snapshotID), nil, &out); err != nil {
+			return false, err
+		}
+		if out.Snapshot.State == "error" {
+			return false, fmt.Errorf("snapshot %s failed to import", snapshotID)
+		}
+		return out.Snapshot.State == "available", nil
+	})
+	if err != nil {
+		a.DeleteSnapshot(ctx, snapshotID)
+		return "", fmt.Errorf("waiting for snapshot %s: %v", snapshotID, err)
+	}
+
+	var img struct {
+		Image struct {
+			ID string `json:"id"`
+		} `json:"image"`
+	}
+	if err := a.call(ctx, "POST", a.zonePath("images"), map[string]interface{}{
+		"name":        name,
+		"root_volume": snapshotID,
+		"arch":        arch,
+		"project":     a.opts.ProjectID,
+		"tags":        []string{createdByTag},
+	}, &img); err != nil {
+		a.DeleteSnapshot(ctx, snapshotID)
+		return "", fmt.Errorf("creating image: %v", err)
+	}
+
+	return img.Image.ID, nil
+}
+
+// DeleteImage removes an image and its root volume snapshot.
+func (a *API) DeleteImage(ctx context.Context, id string) error {
+	var out struct {
+		Image struct {
+			RootVolume struct {
+				ID string `json:"id"`
+			} `json:"root_volume"`
+		} `json:"image"`
+	}
+	if err := a.call(ctx, "GET", a.zonePath("images/%s", id), nil, &out); err != nil {
+		return fmt.Errorf("getting image %s: %v", id, err)
+	}
+	if err := a.call(ctx, "DELETE", a.zonePath("images/%s", id), nil, nil); err != nil {
+		return fmt.Errorf("deleting image %s: %v", id, err)
+	}
+	return a.DeleteSnapshot(ctx, out.Image.RootVolume.ID)
+}
+
+// DeleteSnapshot removes a snapshot.
+func (a *API) DeleteSnapshot(ctx context.Context, id string) error {
+	if err := a.call(ctx, "DELETE", a.zonePath("snapshots/%s", id), nil, nil); err != nil && !isNotFound(err) {
+		return fmt.Errorf("deleting snapshot %s: %v", id, err)
+	}
+	return nil
+}
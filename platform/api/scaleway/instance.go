@@ -0,0 +1,219 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/util"
+)
+
+type server struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Tags         []string  `json:"tags"`
+	CreationDate time.Time `json:"creation_date"`
+	PublicIP     *struct {
+		Address string `json:"address"`
+	} `json:"public_ip"`
+	PublicIPs []struct {
+		Address string `json:"address"`
+		Family  string `json:"family"`
+	} `json:"public_ips"`
+	Volumes map[string]struct {
+		ID string `json:"id"`
+	} `json:"volumes"`
+	PrivateNICs []struct {
+		ID               string `json:"id"`
+		PrivateNetworkID string `json:"private_network_id"`
+	} `json:"private_nics"`
+}
+
+// Server is a Scaleway instance.
+type Server struct {
+	ID         string
+	Name       string
+	PublicIP   string
+	PrivateIP  string
+	PublicIPv6 string
+}
+
+func (s *server) publicIPv4() string {
+	for _, ip := range s.PublicIPs {
+		if ip.Family == "inet" {
+			return ip.Address
+		}
+	}
+	if s.PublicIP != nil {
+		return s.PublicIP.Address
+	}
+	return ""
+}
+
+func (s *server) publicIPv6() string {
+	for _, ip := range s.PublicIPs {
+		if ip.Family == "inet6" {
+			return ip.Address
+		}
+	}
+	return ""
+}
+
+func (a *API) getServer(ctx context.Context, id string) (*server, error) {
+	var out struct {
+		Server server `json:"server"`
+	}
+	if err := a.call(ctx, "GET", a.zonePath("servers/%s", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Server, nil
+}
+
+// CreateServer creates and boots an instance with the given userdata. If
+// privateNetworkID is not empty, the instance is attached to that private
+// network as well.
+func (a *API) CreateServer(ctx context.Context, name, userdata, privateNetworkID string) (*Server, error) {
+	in := map[string]interface{}{
+		"name":                name,
+		"commercial_type":     a.opts.InstanceType,
+		"image":               a.opts.Image,
+		"project":             a.opts.ProjectID,
+		"tags":                []string{createdByTag},
+		"dynamic_ip_required": true,
+	}
+	var out struct {
+		Server server `json:"server"`
+	}
+	if err := a.call(ctx, "POST", a.zonePath("servers"), in, &out); err != nil {
+		return nil, fmt.Errorf("creating server: %v", err)
+	}
+	s := &Server{ID: out.Server.ID, Name: out.Server.Name}
+
+	if err := a.call(ctx, "PATCH", a.zonePath("servers/%s/user_data/cloud-init", s.ID), strings.NewReader(userdata), nil); err != nil {
+		a.DeleteServer(ctx, s.ID)
+		return nil, fmt.Errorf("setting userdata of server %s: %v", s.ID, err)
+	}
+
+	var nicID string
+	if privateNetworkID != "" {
+		var nic struct {
+			PrivateNIC struct {
+				ID string `json:"id"`
+			} `json:"private_nic"`
+		}
+		if err := a.call(ctx, "POST", a.zonePath("servers/%s/private_nics", s.ID), map[string]string{
+			"private_network_id": privateNetworkID,
+		}, &nic); err != nil {
+			a.DeleteServer(ctx, s.ID)
+			return nil, fmt.Errorf("attaching server %s to private network %s: %v", s.ID, privateNetworkID, err)
+		}
+		nicID = nic.PrivateNIC.ID
+	}
+
+	if err := a.action(ctx, s.ID, "poweron"); err != nil {
+		a.DeleteServer(ctx, s.ID)
+		return nil, err
+	}
+
+	err := util.WaitUntilReady(10*time.Minute, 10*time.Second, func() (bool, error) {
+		srv, err := a.getServer(ctx, s.ID)
+		if err != nil {
+			return false, err
+		}
+		s.PublicIP = srv.publicIPv4()
+		s.PublicIPv6 = srv.publicIPv6()
+		return srv.State == "running" && s.PublicIP != "", nil
+	})
+	if err != nil {
+		a.DeleteServer(ctx, s.ID)
+		return nil, fmt.Errorf("waiting for server %s to run: %v", s.ID, err)
+	}
+
+	s.PrivateIP = s.PublicIP
+	if nicID != "" {
+		s.PrivateIP, err = a.privateNICIP(ctx, nicID)
+		if err != nil {
+			a.DeleteServer(ctx, s.ID)
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (a *API) action(ctx context.Context, id, action string) error {
+	if err := a.call(ctx, "POST", a.zonePath("servers/%s/action", id), map[string]string{
+		"action": action,
+	}, nil); err != nil {
+		return fmt.Errorf("%s server %s: %v", action, id, err)
+	}
+	return nil
+}
+
+// DeleteServer terminates an instance, which also removes its volumes and
+// releases its dynamic IP.
+func (a *API) DeleteServer(ctx context.Context, id string) error {
+	srv, err := a.getServer(ctx, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if srv.State == "stopped" {
+		// terminate only works for running servers, the volumes of
+		// stopped servers are left behind and need to be removed
+		// separately
+		if err := a.call(ctx, "DELETE", a.zonePath("servers/%s", id), nil, nil); err != nil {
+			return fmt.Errorf("deleting server %s: %v", id, err)
+		}
+		for _, vol := range srv.Volumes {
+			if err := a.call(ctx, "DELETE", a.zonePath("volumes/%s", vol.ID), nil, nil); err != nil && !isNotFound(err) {
+				return fmt.Errorf("deleting volume %s: %v", vol.ID, err)
+			}
+		}
+		return nil
+	}
+
+	return a.action(ctx, id, "terminate")
+}
+
+// GC terminates instances created by mantle more than gracePeriod ago.
+func (a *API) GC(ctx context.Context, gracePeriod time.Duration) error {
+	threshold := time.Now().Add(-gracePeriod)
+
+	var out struct {
+		Servers []server `json:"servers"`
+	}
+	if err := a.call(ctx, "GET", a.zonePath("servers?per_page=100&tags=%s", createdByTag), nil, &out); err != nil {
+		return fmt.Errorf("listing servers: %v", err)
+	}
+	for _, srv := range out.Servers {
+		if srv.CreationDate.After(threshold) {
+			continue
+		}
+		plog.Infof("deleting server %s (%s)", srv.ID, srv.Name)
+		if err := a.DeleteServer(ctx, srv.ID); err != nil {
+			return err
+		}
+	}
+
+	return a.gcPrivateNetworks(ctx, threshold)
+}
@@ -0,0 +1,108 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/util"
+)
+
+func (a *API) vpcPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/vpc/v2/regions/%s/", a.opts.Region) + fmt.Sprintf(format, args...)
+}
+
+// CreatePrivateNetwork creates a private network so that the instances of
+// a cluster can talk to each other on private addresses.
+func (a *API) CreatePrivateNetwork(ctx context.Context, name string) (string, error) {
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := a.call(ctx, "POST", a.vpcPath("private-networks"), map[string]interface{}{
+		"name":       name,
+		"project_id": a.opts.ProjectID,
+		"tags":       []string{createdByTag},
+	}, &out); err != nil {
+		return "", fmt.Errorf("creating private network: %v", err)
+	}
+	return out.ID, nil
+}
+
+// DeletePrivateNetwork removes a private network. All instances must have
+// been detached from it.
+func (a *API) DeletePrivateNetwork(ctx context.Context, id string) error {
+	// detaching terminated instances is asynchronous
+	return util.Retry(12, 10*time.Second, func() error {
+		err := a.call(ctx, "DELETE", a.vpcPath("private-networks/%s", id), nil, nil)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("deleting private network %s: %v", id, err)
+		}
+		return nil
+	})
+}
+
+// privateNICIP waits for IPAM to assign an IPv4 address to the private NIC.
+func (a *API) privateNICIP(ctx context.Context, nicID string) (string, error) {
+	var ip string
+	err := util.WaitUntilReady(5*time.Minute, 5*time.Second, func() (bool, error) {
+		var out struct {
+			IPs []struct {
+				Address string `json:"address"`
+				IsIPv6  bool   `json:"is_ipv6"`
+			} `json:"ips"`
+		}
+		path := fmt.Sprintf("/ipam/v1/regions/%s/ips?resource_id=%s", a.opts.Region, nicID)
+		if err := a.call(ctx, "GET", path, nil, &out); err != nil {
+			return false, err
+		}
+		for _, addr := range out.IPs {
+			if !addr.IsIPv6 {
+				ip = strings.SplitN(addr.Address, "/", 2)[0]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("getting private IP of NIC %s: %v", nicID, err)
+	}
+	return ip, nil
+}
+
+func (a *API) gcPrivateNetworks(ctx context.Context, threshold time.Time) error {
+	var out struct {
+		PrivateNetworks []struct {
+			ID        string    `json:"id"`
+			Name      string    `json:"name"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"private_networks"`
+	}
+	if err := a.call(ctx, "GET", a.vpcPath("private-networks?page_size=100&tags=%s", createdByTag), nil, &out); err != nil {
+		return fmt.Errorf("listing private networks: %v", err)
+	}
+	for _, pn := range out.PrivateNetworks {
+		if pn.CreatedAt.After(threshold) {
+			continue
+		}
+		plog.Infof("deleting private network %s (%s)", pn.ID, pn.Name)
+		if err := a.DeletePrivateNetwork(ctx, pn.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
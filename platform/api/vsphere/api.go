@@ -0,0 +1,199 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+
+	"github.com/flatcar/mantle/auth"
+	"github.com/flatcar/mantle/platform"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/vsphere")
+)
+
+type Options struct {
+	*platform.Options
+
+	// Config file. Defaults to $HOME/.config/vsphere.json.
+	ConfigPath string
+	// Profile name
+	Profile string
+
+	// vCenter host name (overrides config profile)
+	Server string
+	// vCenter user (overrides config profile)
+	User string
+	// vCenter password (overrides config profile)
+	Password string
+	// Skip TLS certificate verification
+	Insecure bool
+
+	// Inventory paths, empty ones use the vCenter defaults (override config profile)
+	Datacenter   string
+	ResourcePool string
+	Datastore    string
+	Network      string
+	Folder       string
+
+	// Template is the inventory path of the Flatcar VM template to clone
+	Template string
+	// OVAPath is imported as template for the flight if Template is empty
+	OVAPath string
+	// Memory in MiB; zero keeps the template setting
+	Memory int
+	// CPUs per VM; zero keeps the template setting
+	CPUs int
+}
+
+type API struct {
+	opts   *Options
+	client *govmomi.Client
+
+	finder     *find.Finder
+	datacenter *object.Datacenter
+	pool       *object.ResourcePool
+	datastore  *object.Datastore
+	network    object.NetworkReference
+	folder     *object.Folder
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.Server == "" || opts.User == "" || opts.Password == "" {
+		profiles, err := auth.ReadVSphereConfig(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read vSphere config: %v", err)
+		}
+
+		if opts.Profile == "" {
+			opts.Profile = "default"
+		}
+		profile, ok := profiles[opts.Profile]
+		if !ok {
+			return nil, fmt.Errorf("no such profile %q", opts.Profile)
+		}
+		if opts.Server == "" {
+			opts.Server = profile.Server
+		}
+		if opts.User == "" {
+			opts.User = profile.User
+		}
+		if opts.Password == "" {
+			opts.Password = profile.Password
+		}
+		if !opts.Insecure {
+			opts.Insecure = profile.Insecure
+		}
+		if opts.Datacenter == "" {
+			opts.Datacenter = profile.Datacenter
+		}
+		if opts.ResourcePool == "" {
+			opts.ResourcePool = profile.ResourcePool
+		}
+		if opts.Datastore == "" {
+			opts.Datastore = profile.Datastore
+		}
+		if opts.Network == "" {
+			opts.Network = profile.Network
+		}
+		if opts.Folder == "" {
+			opts.Folder = profile.Folder
+		}
+	}
+
+	if opts.Server == "" {
+		return nil, fmt.Errorf("vCenter server must be specified")
+	}
+
+	u, err := soap.ParseURL(opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("parsing vCenter URL: %v", err)
+	}
+	u.User = url.UserPassword(opts.User, opts.Password)
+
+	ctx := context.Background()
+	client, err := govmomi.NewClient(ctx, u, opts.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to vCenter: %v", err)
+	}
+
+	a := &API{
+		opts:   opts,
+		client: client,
+	}
+	if err := a.resolveInventory(ctx); err != nil {
+		client.Logout(ctx)
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// resolveInventory looks up the inventory objects machines are placed in.
+func (a *API) resolveInventory(ctx context.Context) error {
+	var err error
+	a.finder = find.NewFinder(a.client.Client, true)
+
+	if a.datacenter, err = a.finder.DatacenterOrDefault(ctx, a.opts.Datacenter); err != nil {
+		return fmt.Errorf("finding datacenter: %v", err)
+	}
+	a.finder.SetDatacenter(a.datacenter)
+
+	if a.pool, err = a.finder.ResourcePoolOrDefault(ctx, a.opts.ResourcePool); err != nil {
+		return fmt.Errorf("finding resource pool: %v", err)
+	}
+	if a.datastore, err = a.finder.DatastoreOrDefault(ctx, a.opts.Datastore); err != nil {
+		return fmt.Errorf("finding datastore: %v", err)
+	}
+	if a.network, err = a.finder.NetworkOrDefault(ctx, a.opts.Network); err != nil {
+		return fmt.Errorf("finding network: %v", err)
+	}
+
+	if a.opts.Folder == "" {
+		folders, err := a.datacenter.Folders(ctx)
+		if err != nil {
+			return fmt.Errorf("getting datacenter folders: %v", err)
+		}
+		a.folder = folders.VmFolder
+	} else if a.folder, err = a.finder.Folder(ctx, a.opts.Folder); err != nil {
+		return fmt.Errorf("finding folder: %v", err)
+	}
+
+	return nil
+}
+
+// PreflightCheck checks that the vCenter session is valid.
+func (a *API) PreflightCheck(ctx context.Context) error {
+	var mgr mo.SessionManager
+	c := a.client.Client
+	return mo.RetrieveProperties(ctx, c, c.ServiceContent.PropertyCollector, *c.ServiceContent.SessionManager, &mgr)
+}
+
+// Close logs out of the vCenter session.
+func (a *API) Close() {
+	if err := a.client.Logout(context.Background()); err != nil {
+		plog.Debugf("logging out of vCenter: %v", err)
+	}
+}
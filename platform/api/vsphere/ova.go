@@ -0,0 +1,159 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// ovaEntry is a file inside an OVA tarball.
+type ovaEntry struct {
+	io.Reader
+	f *os.File
+}
+
+func (e *ovaEntry) Close() error {
+	return e.f.Close()
+}
+
+// openOVA returns the first file of the OVA at ovaPath whose base name
+// matches pattern, along with its size.
+func openOVA(ovaPath, pattern string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(ovaPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := tar.NewReader(f)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+
+		matched, err := path.Match(pattern, path.Base(h.Name))
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		if matched {
+			return &ovaEntry{r, f}, h.Size, nil
+		}
+	}
+
+	f.Close()
+	return nil, 0, fmt.Errorf("no file matching %q in %s", pattern, ovaPath)
+}
+
+// ImportOVA imports the OVA at ovaPath as a VM template named name.
+func (a *API) ImportOVA(ctx context.Context, name, ovaPath string) (*object.VirtualMachine, error) {
+	r, _, err := openOVA(ovaPath, "*.ovf")
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading OVF descriptor: %v", err)
+	}
+
+	envelope, err := ovf.Unmarshal(bytes.NewReader(descriptor))
+	if err != nil {
+		return nil, fmt.Errorf("parsing OVF descriptor: %v", err)
+	}
+	// map all networks of the OVF to the configured network
+	var networks []types.OvfNetworkMapping
+	if envelope.Network != nil {
+		for _, n := range envelope.Network.Networks {
+			networks = append(networks, types.OvfNetworkMapping{
+				Name:    n.Name,
+				Network: a.network.Reference(),
+			})
+		}
+	}
+
+	cisp := types.OvfCreateImportSpecParams{
+		EntityName:     name,
+		NetworkMapping: networks,
+		OvfManagerCommonParams: types.OvfManagerCommonParams{
+			Locale: "US",
+		},
+	}
+	cisr, err := ovf.NewManager(a.client.Client).CreateImportSpec(ctx, string(descriptor), a.pool, a.datastore, cisp)
+	if err != nil {
+		return nil, fmt.Errorf("creating import spec: %v", err)
+	}
+	if cisr.Error != nil {
+		return nil, errors.New(cisr.Error[0].LocalizedMessage)
+	}
+
+	lease, err := a.pool.ImportVApp(ctx, cisr.ImportSpec, a.folder, nil)
+	if err != nil {
+		return nil, fmt.Errorf("importing vApp: %v", err)
+	}
+	info, err := lease.Wait(ctx, cisr.FileItem)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for import lease: %v", err)
+	}
+
+	upload := func() error {
+		updater := lease.StartUpdater(ctx, info)
+		defer updater.Done()
+
+		for _, item := range info.Items {
+			plog.Infof("uploading %s", item.Path)
+			f, size, err := openOVA(ovaPath, item.Path)
+			if err != nil {
+				return err
+			}
+			err = lease.Upload(ctx, item, f, soap.Upload{ContentLength: size})
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("uploading %s: %v", item.Path, err)
+			}
+		}
+		return nil
+	}
+	if err := upload(); err != nil {
+		lease.Abort(ctx, nil)
+		return nil, err
+	}
+	if err := lease.Complete(ctx); err != nil {
+		return nil, fmt.Errorf("completing import lease: %v", err)
+	}
+
+	vm := object.NewVirtualMachine(a.client.Client, info.Entity)
+	if err := vm.MarkAsTemplate(ctx); err != nil {
+		a.destroy(ctx, vm)
+		return nil, fmt.Errorf("marking %s as template: %v", name, err)
+	}
+	return vm, nil
+}
@@ -0,0 +1,313 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// VM is a virtual machine created by CreateVM.
+type VM struct {
+	Name      string
+	IPAddress string
+	// IPv6Address is the global IPv6 address VMware Tools reported
+	// along with IPAddress, if any.
+	IPv6Address string
+
+	vm     *object.VirtualMachine
+	serial object.DatastorePath
+}
+
+// CreateVM clones template into a new VM named name, passes userdata as
+// Ignition config through the guestinfo properties and powers it on.
+func (a *API) CreateVM(ctx context.Context, name, template string, userdata []byte) (*VM, error) {
+	tmpl, err := a.finder.VirtualMachine(ctx, template)
+	if err != nil {
+		return nil, fmt.Errorf("finding template: %v", err)
+	}
+
+	config := &types.VirtualMachineConfigSpec{
+		ExtraConfig: []types.BaseOptionValue{
+			&types.OptionValue{Key: "guestinfo.ignition.config.data", Value: base64.StdEncoding.EncodeToString(userdata)},
+			&types.OptionValue{Key: "guestinfo.ignition.config.data.encoding", Value: "base64"},
+		},
+		MemoryMB: int64(a.opts.Memory),
+		NumCPUs:  int32(a.opts.CPUs),
+	}
+
+	folderRef := a.folder.Reference()
+	poolRef := a.pool.Reference()
+	datastoreRef := a.datastore.Reference()
+	spec := types.VirtualMachineCloneSpec{
+		Location: types.VirtualMachineRelocateSpec{
+			Folder:    &folderRef,
+			Pool:      &poolRef,
+			Datastore: &datastoreRef,
+		},
+		Config: config,
+	}
+	if a.opts.Network != "" {
+		devices, err := tmpl.Device(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting template devices: %v", err)
+		}
+		change, err := a.nicChange(ctx, devices)
+		if err != nil {
+			return nil, err
+		}
+		spec.Location.DeviceChange = []types.BaseVirtualDeviceConfigSpec{change}
+	}
+
+	task, err := tmpl.Clone(ctx, a.folder, name, spec)
+	if err != nil {
+		return nil, fmt.Errorf("cloning template: %v", err)
+	}
+	result, err := task.WaitForResult(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cloning template: %v", err)
+	}
+
+	vm := &VM{
+		Name: name,
+		vm:   object.NewVirtualMachine(a.client.Client, result.Result.(types.ManagedObjectReference)),
+	}
+
+	if vm.serial, err = a.addSerialPort(ctx, vm.vm); err != nil {
+		a.destroy(ctx, vm.vm)
+		return nil, err
+	}
+
+	task, err = vm.vm.PowerOn(ctx)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		a.DeleteVM(ctx, vm)
+		return nil, fmt.Errorf("powering on VM: %v", err)
+	}
+
+	if vm.IPAddress, vm.IPv6Address, err = a.waitForIP(ctx, vm.vm); err != nil {
+		a.DeleteVM(ctx, vm)
+		return nil, err
+	}
+
+	return vm, nil
+}
+
+// nicChange points the first network card to the configured network.
+func (a *API) nicChange(ctx context.Context, devices object.VirtualDeviceList) (types.BaseVirtualDeviceConfigSpec, error) {
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(nics) == 0 {
+		return nil, fmt.Errorf("template has no network card")
+	}
+	backing, err := a.network.EthernetCardBackingInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting network backing: %v", err)
+	}
+	nic := nics[0].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+	nic.Backing = backing
+	return &types.VirtualDeviceConfigSpec{
+		Operation: types.VirtualDeviceConfigSpecOperationEdit,
+		Device:    nics[0],
+	}, nil
+}
+
+// addSerialPort logs the serial console to a file in the VM directory.
+func (a *API) addSerialPort(ctx context.Context, vm *object.VirtualMachine) (object.DatastorePath, error) {
+	var serialPath object.DatastorePath
+
+	var mvm mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"config.files.logDirectory"}, &mvm); err != nil {
+		return serialPath, fmt.Errorf("getting log directory: %v", err)
+	}
+	if !serialPath.FromString(mvm.Config.Files.LogDirectory) {
+		return serialPath, fmt.Errorf("invalid log directory %q", mvm.Config.Files.LogDirectory)
+	}
+	serialPath.Path = path.Join(serialPath.Path, "serial.out")
+
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		return serialPath, fmt.Errorf("getting VM devices: %v", err)
+	}
+	serial, err := devices.CreateSerialPort()
+	if err != nil {
+		return serialPath, fmt.Errorf("creating serial port: %v", err)
+	}
+	if err := vm.AddDevice(ctx, devices.ConnectSerialPort(serial, serialPath.String(), false, "")); err != nil {
+		return serialPath, fmt.Errorf("adding serial port: %v", err)
+	}
+	return serialPath, nil
+}
+
+func (a *API) waitForIP(ctx context.Context, vm *object.VirtualMachine) (ip, ipv6 string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	ips, err := vm.WaitForNetIP(ctx, true)
+	if err != nil {
+		return "", "", fmt.Errorf("waiting for IP address: %v", err)
+	}
+	for _, addrs := range ips {
+		for _, addr := range addrs {
+			parsed := net.ParseIP(addr)
+			if parsed == nil || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() {
+				continue
+			}
+			if ip == "" {
+				ip = addr
+			}
+			if ipv6 == "" && parsed.To4() == nil {
+				ipv6 = addr
+			}
+		}
+	}
+	if ip == "" {
+		return "", "", fmt.Errorf("no usable IP address reported")
+	}
+	return ip, ipv6, nil
+}
+
+// ConsoleOutput returns the serial console log of the VM.
+func (a *API) ConsoleOutput(ctx context.Context, vm *VM) (string, error) {
+	ds, err := a.finder.Datastore(ctx, vm.serial.Datastore)
+	if err != nil {
+		return "", fmt.Errorf("finding datastore: %v", err)
+	}
+	r, _, err := ds.Download(ctx, vm.serial.Path, &soap.DefaultDownload)
+	if err != nil {
+		return "", fmt.Errorf("downloading console log: %v", err)
+	}
+	defer r.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("reading console log: %v", err)
+	}
+	return string(buf), nil
+}
+
+// DeleteVM powers off and destroys the VM, including the files which
+// vSphere does not know about like the console log.
+func (a *API) DeleteVM(ctx context.Context, vm *VM) error {
+	if err := a.destroy(ctx, vm.vm); err != nil {
+		return err
+	}
+
+	ds, err := a.finder.Datastore(ctx, vm.serial.Datastore)
+	if err != nil {
+		return fmt.Errorf("finding datastore: %v", err)
+	}
+	fm := ds.NewFileManager(a.datacenter, true)
+	if err := fm.Delete(ctx, path.Dir(vm.serial.Path)); err != nil && !isNotFound(err) {
+		return fmt.Errorf("deleting VM directory: %v", err)
+	}
+	return nil
+}
+
+func (a *API) destroy(ctx context.Context, vm *object.VirtualMachine) error {
+	state, err := vm.PowerState(ctx)
+	if err != nil {
+		return fmt.Errorf("getting power state: %v", err)
+	}
+	if state == types.VirtualMachinePowerStatePoweredOn {
+		task, err := vm.PowerOff(ctx)
+		if err != nil {
+			return fmt.Errorf("powering off VM: %v", err)
+		}
+		if err := task.Wait(ctx); err != nil {
+			return fmt.Errorf("powering off VM: %v", err)
+		}
+	}
+
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return fmt.Errorf("destroying VM: %v", err)
+	}
+	return task.Wait(ctx)
+}
+
+// DeleteTemplate removes a template created by ImportOVA.
+func (a *API) DeleteTemplate(ctx context.Context, name string) error {
+	vm, err := a.finder.VirtualMachine(ctx, name)
+	if err != nil {
+		return fmt.Errorf("finding template: %v", err)
+	}
+	return a.destroy(ctx, vm)
+}
+
+func isNotFound(err error) bool {
+	if soap.IsSoapFault(err) {
+		_, ok := soap.ToSoapFault(err).VimFault().(types.FileNotFound)
+		return ok
+	}
+	if soap.IsVimFault(err) {
+		_, ok := soap.ToVimFault(err).(*types.FileNotFound)
+		return ok
+	}
+	return strings.Contains(err.Error(), "was not found")
+}
+
+// GC removes VMs and templates in the configured folder whose name
+// starts with prefix and which were created more than gracePeriod ago.
+func (a *API) GC(ctx context.Context, prefix string, gracePeriod time.Duration) error {
+	vms, err := a.finder.VirtualMachineList(ctx, path.Join(a.folder.InventoryPath, prefix+"*"))
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("listing VMs: %v", err)
+	}
+
+	for _, vm := range vms {
+		var mvm mo.VirtualMachine
+		if err := vm.Properties(ctx, vm.Reference(), []string{"config.createDate", "config.template", "config.files.logDirectory"}, &mvm); err != nil {
+			return fmt.Errorf("getting properties of %s: %v", vm.Name(), err)
+		}
+		if mvm.Config == nil || mvm.Config.CreateDate == nil || time.Since(*mvm.Config.CreateDate) < gracePeriod {
+			continue
+		}
+
+		plog.Infof("deleting %s", vm.Name())
+		if mvm.Config.Template {
+			err = a.destroy(ctx, vm)
+		} else {
+			var dir object.DatastorePath
+			dir.FromString(mvm.Config.Files.LogDirectory)
+			err = a.DeleteVM(ctx, &VM{
+				Name:   vm.Name(),
+				vm:     vm,
+				serial: object.DatastorePath{Datastore: dir.Datastore, Path: path.Join(dir.Path, "serial.out")},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
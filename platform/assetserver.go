@@ -0,0 +1,110 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// AssetServer serves directories of test assets, e.g. Ignition configs,
+// files or sysext images, over HTTP to the machines, so tests don't need
+// external hosting for what the machines fetch.
+type AssetServer struct {
+	listener net.Listener
+	server   *http.Server
+	baseURL  string
+
+	mu   sync.Mutex
+	dirs map[string]http.Handler
+}
+
+// NewAssetServer serves directories on l. host is the address machines
+// reach the server at; the port of l is used if host has none.
+func NewAssetServer(l net.Listener, host string) (*AssetServer, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		_, port, err := net.SplitHostPort(l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	s := &AssetServer{
+		listener: l,
+		baseURL:  "http://" + host,
+		dirs:     make(map[string]http.Handler),
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveAsset)}
+	go s.server.Serve(l)
+
+	return s, nil
+}
+
+func (s *AssetServer) serveAsset(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	s.mu.Lock()
+	h, ok := s.dirs[prefix]
+	s.mu.Unlock()
+	if !ok || (r.Method != "GET" && r.Method != "HEAD") {
+		plog.Warningf("Asset server: %s %s from %s not found", r.Method, r.URL.Path, r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+	plog.Debugf("Asset server: serving %s to %s", r.URL.Path, r.RemoteAddr)
+	h.ServeHTTP(w, r)
+}
+
+// URL returns the base URL of the server.
+func (s *AssetServer) URL() string {
+	return s.baseURL
+}
+
+// Serve publishes the contents of dir under a random path and returns its
+// URL, without a trailing slash.
+func (s *AssetServer) Serve(dir string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	prefix := "/" + hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.dirs[prefix] = http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	s.mu.Unlock()
+	return s.baseURL + prefix, nil
+}
+
+// Remove stops serving the directory published at url by Serve.
+func (s *AssetServer) Remove(url string) error {
+	prefix := strings.TrimPrefix(url, s.baseURL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.dirs[prefix]; !ok {
+		return fmt.Errorf("%s is not served by the asset server", url)
+	}
+	delete(s.dirs, prefix)
+	return nil
+}
+
+// Close stops the server.
+func (s *AssetServer) Close() error {
+	return s.server.Close()
+}
@@ -0,0 +1,74 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssetServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kola-assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.ign"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewAssetServer(l, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	url, err := s.Serve(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(url string) int {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get(url + "/config.ign"); code != http.StatusOK {
+		t.Errorf("served asset: got %d", code)
+	}
+	if code := get(url + "/missing"); code != http.StatusNotFound {
+		t.Errorf("missing asset: got %d", code)
+	}
+	if code := get(s.URL() + "/config.ign"); code != http.StatusNotFound {
+		t.Errorf("asset outside of a served directory: got %d", code)
+	}
+
+	if err := s.Remove(url); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(url + "/config.ign"); code != http.StatusNotFound {
+		t.Errorf("removed asset: got %d", code)
+	}
+}
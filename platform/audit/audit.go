@@ -0,0 +1,191 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the mutating cloud API calls made by mantle, so
+// what a run did in a shared account can be reviewed afterwards.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/platform/metrics"
+)
+
+// Entry is a single mutating API call.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Service   string    `json:"service"`
+	Action    string    `json:"action"`
+	Resources []string  `json:"resources,omitempty"`
+	Result    string    `json:"result"`
+}
+
+var (
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries []Entry
+)
+
+// Open starts recording entries to the given file as JSON lines. If the
+// file is removed while the log is open, e.g. because the output
+// directory was cleaned, it is recreated with all entries recorded so far.
+func Open(p string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if file != nil {
+		return fmt.Errorf("audit log %q is already open", path)
+	}
+	path = p
+	entries = nil
+	return reopen()
+}
+
+// Close stops recording entries, after recreating the file if it was
+// removed since the last entry.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if err := reopen(); err != nil {
+			return err
+		}
+	}
+	err := file.Close()
+	file = nil
+	path = ""
+	return err
+}
+
+// Enabled reports whether an audit log is open.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return file != nil
+}
+
+// reopen (re)creates the log file with all entries recorded so far.
+// Must be called with mu held.
+func reopen() error {
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	file = f
+	return nil
+}
+
+// Record adds an entry for a call of action on service affecting the
+// given resources. err is the outcome of the call.
+func Record(service, action string, resources []string, err error) {
+	result := "success"
+	if err != nil {
+		result = err.Error()
+	}
+	add(Entry{
+		Time:      time.Now().UTC(),
+		Service:   service,
+		Action:    action,
+		Resources: resources,
+		Result:    result,
+	})
+}
+
+func add(e Entry) {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return
+	}
+	entries = append(entries, e)
+	if _, err := os.Stat(path); err != nil {
+		if err := reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "audit: recreating %s: %v\n", path, err)
+		}
+		return
+	}
+	if err := json.NewEncoder(file).Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "audit: writing %s: %v\n", path, err)
+	}
+}
+
+// IsMutatingAction reports whether an API action name changes state, going
+// by the read-only prefixes used by the cloud SDKs.
+func IsMutatingAction(action string) bool {
+	for _, prefix := range []string{"Describe", "List", "Get", "Head", "Lookup", "Search"} {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+type transport struct {
+	service string
+	rt      http.RoundTripper
+}
+
+// Transport wraps rt to record all HTTP requests other than GET, HEAD and
+// OPTIONS as entries of the given service. The action is the HTTP method
+// and the resource is the request path, which is how REST APIs name the
+// affected objects.
+func Transport(service string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{service: service, rt: rt}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	RecordHTTP(t.service, req, resp, err)
+	return resp, err
+}
+
+// RecordHTTP adds an entry for an HTTP request unless it is a GET, HEAD or
+// OPTIONS request. It is used by Transport and by clients which don't
+// allow replacing their transport. All requests are also counted in the
+// run metrics, failing with an error or a 4xx or 5xx status.
+func RecordHTTP(service string, req *http.Request, resp *http.Response, err error) {
+	metrics.APICall(service, err != nil || resp.StatusCode >= 400)
+
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return
+	}
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("%s", resp.Status)
+	}
+	Record(service, req.Method, []string{req.URL.Path}, err)
+}
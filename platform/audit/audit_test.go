@@ -0,0 +1,88 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := Open(path); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: Transport("test", nil)}
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/instances"},
+		{"POST", "/instances"},
+		{"DELETE", "/missing"},
+	} {
+		r, err := http.NewRequest(req.method, srv.URL+req.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// entries survive the file being removed, e.g. by cleaning the
+	// output directory
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	Record("ec2", "TerminateInstances", []string{"i-1"}, nil)
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, Entry{Service: e.Service, Action: e.Action, Resources: e.Resources, Result: e.Result})
+	}
+	want := []Entry{
+		{Service: "test", Action: "POST", Resources: []string{"/instances"}, Result: "success"},
+		{Service: "test", Action: "DELETE", Resources: []string{"/missing"}, Result: "404 Not Found"},
+		{Service: "ec2", Action: "TerminateInstances", Resources: []string{"i-1"}, Result: "success"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
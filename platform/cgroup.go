@@ -0,0 +1,47 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+// CgroupMode returns the cgroup hierarchy m booted with, conf.CgroupV1 or
+// conf.CgroupV2.
+func CgroupMode(m Machine) (string, error) {
+	out, stderr, err := m.SSH("stat -f -c %T /sys/fs/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("stat /sys/fs/cgroup: %s: %s", err, stderr)
+	}
+	if strings.TrimSpace(string(out)) == "cgroup2fs" {
+		return conf.CgroupV2, nil
+	}
+	return conf.CgroupV1, nil
+}
+
+// CheckCgroupMode fails if m did not boot with the cgroup hierarchy mode.
+func CheckCgroupMode(m Machine, mode string) error {
+	got, err := CgroupMode(m)
+	if err != nil {
+		return err
+	}
+	if got != mode {
+		return fmt.Errorf("cgroup %s is mounted, expected %s", got, mode)
+	}
+	return nil
+}
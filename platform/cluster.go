@@ -19,14 +19,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
-	"github.com/pborman/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 
+	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/distro"
+	"github.com/flatcar/mantle/platform/tracing"
 	"github.com/flatcar/mantle/util"
 )
 
@@ -34,20 +38,67 @@ type BaseCluster struct {
 	machlock   sync.Mutex
 	machmap    map[string]Machine
 	consolemap map[string]string
+	// when the running machines were added, and the time the removed
+	// ones ran
+	machstart map[string]time.Time
+	machtime  time.Duration
+
+	// sshPool holds the connections used by SSH, one per machine
+	sshPool *network.ClientPool
 
 	bf    *BaseFlight
 	name  string
 	rconf *RuntimeConfig
+
+	// names set with SetDNSRecord
+	dnslock    sync.Mutex
+	dnsRecords DNSRecords
+
+	// URLs returned by ServeAssets
+	assetLock sync.Mutex
+	assetURLs []string
 }
 
 func NewBaseCluster(bf *BaseFlight, rconf *RuntimeConfig) (*BaseCluster, error) {
+	name, err := bf.namer.Name()
+	if err != nil {
+		return nil, err
+	}
+
 	bc := &BaseCluster{
 		bf:         bf,
 		machmap:    make(map[string]Machine),
 		consolemap: make(map[string]string),
-		name:       fmt.Sprintf("%s-%s", bf.baseopts.BaseName, uuid.New()),
+		machstart:  make(map[string]time.Time),
+		dnsRecords: make(DNSRecords),
+		name:       name,
 		rconf:      rconf,
 	}
+	bc.sshPool = network.NewClientPool(bc.SSHClient)
+	profile := distro.Lookup(bf.baseopts.Distribution)
+	if bc.rconf.OSReleaseID == "" {
+		bc.rconf.OSReleaseID = profile.OSReleaseID
+	}
+	if bc.rconf.DefaultUser == "" {
+		bc.rconf.DefaultUser = profile.DefaultUser
+	}
+	if profile.NoSELinux {
+		bc.rconf.NoEnableSelinux = true
+	}
+	if bc.rconf.SELinuxMode == "" {
+		bc.rconf.SELinuxMode = bf.baseopts.SELinuxMode
+	}
+	if bc.rconf.CgroupMode == "" {
+		bc.rconf.CgroupMode = bf.baseopts.CgroupMode
+	}
+	bc.rconf.CloudInit = profile.CloudInit()
+	if bf.baseopts.WireGuardSubnet != "" {
+		host, err := bf.wireGuard()
+		if err != nil {
+			return nil, err
+		}
+		bc.rconf.WireGuard = newWireGuardMesh(host)
+	}
 
 	return bc, nil
 }
@@ -83,23 +134,18 @@ func (bc *BaseCluster) PasswordSSHClient(ip string, user string, password string
 	return sshClient, nil
 }
 
-// SSH executes the given command, cmd, on the given Machine, m. It returns the
-// stdout and stderr of the command and an error.
-// Leading and trailing whitespace is trimmed from each.
+// SSH executes the given command, cmd, on the given Machine, m, over the
+// connection shared by all commands run on m, reconnecting if it was lost,
+// e.g. after a reboot. It returns the stdout and stderr of the command and
+// an error. Leading and trailing whitespace is trimmed from each.
 func (bc *BaseCluster) SSH(m Machine, cmd string) ([]byte, []byte, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	client, err := bc.SSHClient(m.IP())
+	session, done, err := bc.sshPool.NewSession(m.IP())
 	if err != nil {
 		return nil, nil, err
 	}
-	defer client.Close()
-
-	session, err := client.NewSession()
-	if err != nil {
-		return nil, nil, err
-	}
-	defer session.Close()
+	defer done()
 
 	session.Stdout = &stdout
 	session.Stderr = &stderr
@@ -123,25 +169,83 @@ func (bc *BaseCluster) AddMach(m Machine) {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
 	bc.machmap[m.ID()] = m
+	bc.machstart[m.ID()] = time.Now()
 }
 
 func (bc *BaseCluster) DelMach(m Machine) {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
 	delete(bc.machmap, m.ID())
+	if start, ok := bc.machstart[m.ID()]; ok {
+		bc.machtime += time.Since(start)
+		delete(bc.machstart, m.ID())
+	}
 	bc.consolemap[m.ID()] = m.ConsoleOutput()
+	bc.sshPool.Drop(m.IP())
+}
+
+// MachineTime returns the total time the machines of the cluster ran, from
+// when they were up until they were destroyed or now. It estimates the
+// instance-hours billed by clouds.
+func (bc *BaseCluster) MachineTime() time.Duration {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	total := bc.machtime
+	for _, start := range bc.machstart {
+		total += time.Since(start)
+	}
+	return total
 }
 
 func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
 	return bc.bf.Keys()
 }
 
-func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[string]string) (*conf.Conf, error) {
+// RenderUserData renders userdata with RenderUnservedUserData and passes the
+// result through ServeUserData. Errors are returned as ConfigError.
+func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[string]string) (c *conf.Conf, err error) {
+	_, span := tracing.StartSpan(bc.rconf.TraceContext, "ignition.render",
+		attribute.String("platform", string(bc.Platform())))
+	defer func() {
+		tracing.End(span, err)
+		if err != nil {
+			err = &ConfigError{Err: err}
+		}
+	}()
+
+	conf, err := bc.RenderUnservedUserData(userdata, ignitionVars)
+	if err != nil {
+		return nil, err
+	}
+	return bc.ServeUserData(conf)
+}
+
+// ServeUserData returns a pointer config for Ignition configs when the
+// flight serves them over HTTP(S), otherwise it returns c unchanged.
+// Platforms which add to the config after rendering it must call this
+// after their changes.
+func (bc *BaseCluster) ServeUserData(c *conf.Conf) (*conf.Conf, error) {
+	if bc.bf.baseopts.IgnitionDelivery == "" || !c.IsIgnition() {
+		return c, nil
+	}
+	s, err := bc.bf.IgnitionServer()
+	if err != nil {
+		return nil, err
+	}
+	return s.Serve(c)
+}
+
+// RenderUnservedUserData renders userdata into the full config for a
+// machine of the cluster.
+func (bc *BaseCluster) RenderUnservedUserData(userdata *conf.UserData, ignitionVars map[string]string) (*conf.Conf, error) {
+	profile := bc.DistroProfile()
 	if userdata == nil {
-		switch bc.IgnitionVersion() {
-		case "v2":
+		switch {
+		case profile.CloudInit():
+			userdata = conf.Empty()
+		case bc.IgnitionVersion() == "v2":
 			userdata = conf.Ignition(`{"ignition": {"version": "2.0.0"}}`)
-		case "v3":
+		case bc.IgnitionVersion() == "v3":
 			userdata = conf.Ignition(`{"ignition": {"version": "3.0.0"}}`)
 		default:
 			return nil, fmt.Errorf("unknown ignition version")
@@ -150,7 +254,7 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 
 	u := bc.rconf.DefaultUser
 	if u == "" {
-		u = "core"
+		u = profile.DefaultUser
 	}
 
 	userdata.User = u
@@ -166,13 +270,19 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 		userdata = conf.AddSSHKeys(userdata, bc.bf.AdditionalSshKeys)
 	}
 
-	conf, err := userdata.Render(bc.bf.ctPlatform)
+	var conf *conf.Conf
+	var err error
+	if profile.CloudInit() {
+		conf, err = userdata.RenderCloudInit()
+	} else {
+		conf, err = userdata.Render(bc.bf.ctPlatform)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// By default, the user is added to the sudo group (for initial operations like enabling SELinux).
-	if u != "core" {
+	if u != profile.DefaultUser {
 		if err := conf.AddUserToGroups(u, []string{"sudo"}); err != nil {
 			return nil, fmt.Errorf("adding user to group: %w", err)
 		}
@@ -189,19 +299,44 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 		}
 
 		conf.CopyKeys(keys)
+
+		if bc.rconf.RunAsUser != nil {
+			if err := conf.AddUser(*bc.rconf.RunAsUser, keys); err != nil {
+				return nil, fmt.Errorf("adding user %s: %w", bc.rconf.RunAsUser.Name, err)
+			}
+		}
+	}
+
+	for _, f := range profile.Files {
+		conf.AddFile(f.Path, "root", f.Contents, f.Mode)
+	}
+
+	if bc.bf.baseopts.Kdump != "" {
+		conf.AddKdump(bc.bf.baseopts.Kdump)
+	}
+	conf.KeepCoreDumps()
+
+	if bc.rconf.EnableIPv6 {
+		conf.EnableIPv6()
 	}
 
-	// disable Zincati & Pinger by default
-	if bc.Distribution() == "fcos" {
-		conf.AddFile("/etc/fedora-coreos-pinger/config.d/90-disable-reporting.toml", "root", `[reporting]
-enabled = false`, 0644)
-		conf.AddFile("/etc/zincati/config.d/90-disable-auto-updates.toml", "root", `[updates]
-enabled = false`, 0644)
+	if bc.rconf.SELinuxMode != "" && !bc.rconf.NoEnableSelinux {
+		conf.SetSELinuxMode(bc.rconf.SELinuxMode, profile.SELinuxType)
+	}
+	if bc.rconf.CgroupMode != "" {
+		conf.SetCgroupMode(bc.rconf.CgroupMode)
+	}
+
+	if servers := bc.bf.baseopts.DNSServers; len(servers) > 0 && !bc.bf.localResolver {
+		conf.AddDNSServers(servers)
+	}
+	if hosts := bc.hostsFile(); hosts != "" {
+		conf.AddHosts(hosts)
 	}
 
 	if bc.bf.baseopts.OSContainer != "" {
-		if bc.Distribution() != "rhcos" {
-			return nil, fmt.Errorf("oscontainer is only supported on the rhcos distribution")
+		if profile.Updater != distro.UpdaterPivot {
+			return nil, fmt.Errorf("oscontainer is only supported on distributions updated by pivot")
 		}
 		conf.AddSystemdUnitDropin("pivot.service", "00-before-sshd.conf", `[Unit]
 Before=sshd.service`)
@@ -235,6 +370,39 @@ func (bc *BaseCluster) Destroy() {
 	for _, m := range bc.Machines() {
 		m.Destroy()
 	}
+	bc.sshPool.Close()
+
+	bc.assetLock.Lock()
+	defer bc.assetLock.Unlock()
+	if len(bc.assetURLs) > 0 {
+		s, _ := bc.bf.AssetServer()
+		for _, url := range bc.assetURLs {
+			if err := s.Remove(url); err != nil {
+				plog.Errorf("Error removing test assets: %v", err)
+			}
+		}
+		bc.assetURLs = nil
+	}
+}
+
+// ServeAssets serves dir with the asset server of the flight, see
+// BaseFlight.AssetServer.
+func (bc *BaseCluster) ServeAssets(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	s, err := bc.bf.AssetServer()
+	if err != nil {
+		return "", err
+	}
+	url, err := s.Serve(dir)
+	if err != nil {
+		return "", err
+	}
+	bc.assetLock.Lock()
+	bc.assetURLs = append(bc.assetURLs, url)
+	bc.assetLock.Unlock()
+	return url, nil
 }
 
 // XXX(mischief): i don't really think this belongs here, but it completes the
@@ -265,6 +433,11 @@ func (bc *BaseCluster) Distribution() string {
 	return bc.bf.baseopts.Distribution
 }
 
+// DistroProfile returns the profile of the distribution under test.
+func (bc *BaseCluster) DistroProfile() *distro.Profile {
+	return distro.Lookup(bc.Distribution())
+}
+
 func (bc *BaseCluster) IgnitionVersion() string {
 	return bc.bf.baseopts.IgnitionVersion
 }
@@ -273,6 +446,12 @@ func (bc *BaseCluster) Platform() Name {
 	return bc.bf.Platform()
 }
 
+// NewResourceName returns a new unique name for a temporary resource, such
+// as an instance, of the cluster.
+func (bc *BaseCluster) NewResourceName() (string, error) {
+	return bc.bf.namer.Name()
+}
+
 func (bc *BaseCluster) Name() string {
 	return bc.name
 }
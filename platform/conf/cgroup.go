@@ -0,0 +1,37 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+// The cgroup hierarchies machines boot with, see SetCgroupMode.
+const (
+	CgroupV1 = "v1"
+	CgroupV2 = "v2"
+)
+
+// CgroupModes are the valid modes of SetCgroupMode.
+var CgroupModes = []string{CgroupV1, CgroupV2}
+
+// SetCgroupMode boots the machine with the legacy cgroup v1 hierarchy or
+// the unified cgroup v2 one, see AddKernelArgs. For v1 it also creates
+// /etc/flatcar-cgroupv1, which Flatcar checks for the hierarchy.
+func (c *Conf) SetCgroupMode(mode string) {
+	switch mode {
+	case CgroupV1:
+		c.AddFile("/etc/flatcar-cgroupv1", "root", "", 0644)
+		c.AddKernelArgs("systemd.unified_cgroup_hierarchy=0", "systemd.legacy_systemd_cgroup_controller")
+	case CgroupV2:
+		c.AddKernelArgs("systemd.unified_cgroup_hierarchy=1")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/crypto/ssh/agent"
+	"gopkg.in/yaml.v3"
+)
+
+// RenderCloudInit is like Render for distributions provisioned by
+// cloud-init instead of Ignition. Cloud-configs are kept as they are,
+// including the keys coreos-cloudinit doesn't know, and scripts are passed
+// through. Ignition configs can't be rendered.
+func (u *UserData) RenderCloudInit() (*Conf, error) {
+	c := &Conf{user: u.User}
+
+	switch u.kind {
+	case kindEmpty:
+		c.cloudinit = map[string]interface{}{}
+	case kindCloudConfig:
+		c.cloudinit = map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(u.data), &c.cloudinit); err != nil {
+			return nil, fmt.Errorf("parsing cloud-config: %v", err)
+		}
+	case kindScript:
+		c.script = u.data
+	default:
+		return nil, fmt.Errorf("cloud-init doesn't support Ignition configs")
+	}
+
+	if len(u.extraKeys) > 0 {
+		c.CopyKeys(u.extraKeys)
+	}
+	for _, edit := range u.edits {
+		edit(c)
+	}
+
+	return c, nil
+}
+
+// cloudInitList returns the list under key, or nil if it isn't set.
+func (c *Conf) cloudInitList(key string) []interface{} {
+	l, _ := c.cloudinit[key].([]interface{})
+	return l
+}
+
+// daemonReloadCloudInit makes systemd pick up the units written by the
+// config before any of them is enabled.
+func (c *Conf) daemonReloadCloudInit() {
+	reload := []interface{}{"systemctl", "daemon-reload"}
+	cmds := c.cloudInitList("runcmd")
+	if len(cmds) > 0 && reflect.DeepEqual(cmds[0], reload) {
+		return
+	}
+	c.cloudinit["runcmd"] = append([]interface{}{reload}, cmds...)
+}
+
+func (c *Conf) addFileCloudInit(path, filesystem, contents string, mode int) {
+	c.cloudinit["write_files"] = append(c.cloudInitList("write_files"), map[string]interface{}{
+		"path":        path,
+		"content":     contents,
+		"owner":       "root:root",
+		"permissions": fmt.Sprintf("%#o", mode),
+	})
+}
+
+// addSystemdUnitCloudInit writes the unit and enables it from runcmd, so
+// unlike with Ignition it is started late in the first boot, after
+// cloud-init's final stage began.
+func (c *Conf) addSystemdUnitCloudInit(name, contents string, enable bool) {
+	if contents != "" {
+		c.addFileCloudInit("/etc/systemd/system/"+name, "root", contents, 0644)
+	}
+	c.daemonReloadCloudInit()
+	if enable {
+		c.cloudinit["runcmd"] = append(c.cloudInitList("runcmd"), []interface{}{"systemctl", "enable", "--now", "--no-block", name})
+	}
+}
+
+// addSystemdDropinCloudInit writes the drop-in, which only applies to
+// units (re)started after cloud-init's final stage began.
+func (c *Conf) addSystemdDropinCloudInit(service, name, contents string) {
+	c.addFileCloudInit(fmt.Sprintf("/etc/systemd/system/%s.d/%s", service, name), "root", contents, 0644)
+	c.daemonReloadCloudInit()
+}
+
+func (c *Conf) copyKeysCloudInit(keys []*agent.Key) {
+	c.cloudinit["ssh_authorized_keys"] = append(c.cloudInitList("ssh_authorized_keys"), stringsToList(keysToStrings(keys))...)
+}
+
+// cloudInitUser returns the entry of user in the users list, adding it if
+// needed. The default user of the distribution is kept.
+func (c *Conf) cloudInitUser(user string) map[string]interface{} {
+	users := c.cloudInitList("users")
+	if len(users) == 0 {
+		users = []interface{}{"default"}
+	}
+	for _, u := range users {
+		if m, ok := u.(map[string]interface{}); ok && m["name"] == user {
+			return m
+		}
+	}
+	m := map[string]interface{}{
+		"name":  user,
+		"shell": "/bin/bash",
+	}
+	c.cloudinit["users"] = append(users, m)
+	return m
+}
+
+func (c *Conf) addUserToGroupsCloudInit(user string, groups []string) {
+	m := c.cloudInitUser(user)
+	var all []string
+	if existing, ok := m["groups"].(string); ok && existing != "" {
+		all = strings.Split(existing, ",")
+	}
+	for _, g := range groups {
+		all = append(all, g)
+		// like on Flatcar, the sudo group doesn't need a password
+		if g == "sudo" {
+			m["sudo"] = "ALL=(ALL) NOPASSWD:ALL"
+		}
+	}
+	m["groups"] = strings.Join(all, ",")
+}
+
+func (c *Conf) addUserPasswordCloudInit(user, passwordHash string) {
+	m := c.cloudInitUser(user)
+	m["passwd"] = passwordHash
+	m["lock_passwd"] = false
+}
+
+func (c *Conf) addUserSSHKeysCloudInit(user string, keys []string) {
+	m := c.cloudInitUser(user)
+	existing, _ := m["ssh_authorized_keys"].([]interface{})
+	m["ssh_authorized_keys"] = append(existing, stringsToList(keys)...)
+}
+
+func stringsToList(strs []string) []interface{} {
+	l := make([]interface{}, len(strs))
+	for i, s := range strs {
+		l[i] = s
+	}
+	return l
+}
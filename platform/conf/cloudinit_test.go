@@ -0,0 +1,107 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderCloudInit(t *testing.T) {
+	u := CloudConfig(`#cloud-config
+package_update: false
+runcmd:
+  - echo hello`)
+	c, err := u.RenderCloudInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddFile("/etc/foo", "root", "bar", 0600)
+	c.AddSystemdUnit("foo.service", "[Service]\nExecStart=/bin/true", true)
+	c.AddSystemdUnitDropin("ssh.service", "10-debug.conf", "[Service]\nEnvironment=DEBUG=1")
+	if err := c.AddUserToGroups("test", []string{"sudo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddUserSSHKeys("test", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	str := c.String()
+	if !strings.HasPrefix(str, "#cloud-config\n") {
+		t.Fatalf("missing #cloud-config header: %s", str)
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal([]byte(str), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		// keys unknown to coreos-cloudinit are kept
+		"package_update": false,
+		"runcmd": []interface{}{
+			[]interface{}{"systemctl", "daemon-reload"},
+			"echo hello",
+			[]interface{}{"systemctl", "enable", "--now", "--no-block", "foo.service"},
+		},
+		"write_files": []interface{}{
+			map[string]interface{}{"path": "/etc/foo", "content": "bar", "owner": "root:root", "permissions": "0600"},
+			map[string]interface{}{"path": "/etc/systemd/system/foo.service", "content": "[Service]\nExecStart=/bin/true", "owner": "root:root", "permissions": "0644"},
+			map[string]interface{}{"path": "/etc/systemd/system/ssh.service.d/10-debug.conf", "content": "[Service]\nEnvironment=DEBUG=1", "owner": "root:root", "permissions": "0644"},
+		},
+		"users": []interface{}{
+			"default",
+			map[string]interface{}{
+				"name":                "test",
+				"shell":               "/bin/bash",
+				"groups":              "sudo",
+				"sudo":                "ALL=(ALL) NOPASSWD:ALL",
+				"ssh_authorized_keys": []interface{}{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestRenderCloudInitKinds(t *testing.T) {
+	c, err := Empty().RenderCloudInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IsEmpty() || c.IsIgnition() || c.String() != "#cloud-config\n{}\n" {
+		t.Errorf("unexpected empty config %q", c.String())
+	}
+
+	c, err = Script("#!/bin/sh\necho @SSH_KEYS@").RenderCloudInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != "#!/bin/sh\necho @SSH_KEYS@" {
+		t.Errorf("script was modified: %q", c.String())
+	}
+
+	for _, u := range []*UserData{
+		Ignition(`{"ignition": {"version": "3.0.0"}}`),
+		ContainerLinuxConfig(""),
+		Butane("variant: flatcar\nversion: 1.0.0"),
+	} {
+		if _, err := u.RenderCloudInit(); err == nil {
+			t.Errorf("rendered %v for cloud-init", u.kind)
+		}
+	}
+}
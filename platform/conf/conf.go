@@ -52,6 +52,7 @@ import (
 	ignvalidate "github.com/flatcar/ignition/config/validate"
 	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/crypto/ssh/agent"
+	"gopkg.in/yaml.v3"
 )
 
 type kind int
@@ -75,6 +76,9 @@ type UserData struct {
 	extraKeys []*agent.Key // SSH keys to be injected during rendering
 	// user to create.
 	User string
+
+	// edits are applied to the rendered Conf, see edit.
+	edits []func(*Conf)
 }
 
 // Conf is a configuration for a Container Linux machine. It may be either a
@@ -90,8 +94,10 @@ type Conf struct {
 	ignitionV32 *v32types.Config
 	ignitionV33 *v33types.Config
 	cloudconfig *cci.CloudConfig
-	script      string
-	user        string
+	// cloudinit is a cloud-config for cloud-init, see RenderCloudInit
+	cloudinit map[string]interface{}
+	script    string
+	user      string
 }
 
 func Empty() *UserData {
@@ -182,6 +188,14 @@ func (u *UserData) AddKey(key agent.Key) *UserData {
 	return &ret
 }
 
+// edit returns a copy of the UserData which applies f to the Conf it
+// renders to.
+func (u *UserData) edit(f func(*Conf)) *UserData {
+	ret := *u
+	ret.edits = append(append([]func(*Conf){}, u.edits...), f)
+	return &ret
+}
+
 func (u *UserData) IsIgnitionCompatible() bool {
 	return u.kind == kindIgnition || u.kind == kindContainerLinuxConfig || u.kind == kindButane
 }
@@ -351,6 +365,9 @@ func (u *UserData) Render(ctPlatform string) (*Conf, error) {
 		// not a no-op in the zero-key case
 		c.CopyKeys(u.extraKeys)
 	}
+	for _, edit := range u.edits {
+		edit(c)
+	}
 
 	return c, nil
 }
@@ -386,6 +403,9 @@ func (c *Conf) String() string {
 		return string(buf)
 	} else if c.cloudconfig != nil {
 		return c.cloudconfig.String()
+	} else if c.cloudinit != nil {
+		buf, _ := yaml.Marshal(c.cloudinit)
+		return "#cloud-config\n" + string(buf)
 	} else if c.script != "" {
 		return c.script
 	}
@@ -675,6 +695,8 @@ func (c *Conf) AddFile(path, filesystem, contents string, mode int) {
 		c.addFileV1(path, filesystem, contents, mode)
 	} else if c.cloudconfig != nil {
 		c.addFileCloudConfig(path, filesystem, contents, mode)
+	} else if c.cloudinit != nil {
+		c.addFileCloudInit(path, filesystem, contents, mode)
 	} else {
 		panic(fmt.Errorf("unimplemented case in AddFile"))
 	}
@@ -821,6 +843,8 @@ func (c *Conf) AddSystemdUnit(name, contents string, enable bool) {
 		c.addSystemdUnitV33(name, contents, enable)
 	} else if c.cloudconfig != nil {
 		c.addSystemdUnitCloudConfig(name, contents, enable)
+	} else if c.cloudinit != nil {
+		c.addSystemdUnitCloudInit(name, contents, enable)
 	}
 }
 
@@ -1065,6 +1089,8 @@ func (c *Conf) AddSystemdUnitDropin(service, name, contents string) {
 		c.addSystemdDropinV33(service, name, contents)
 	} else if c.cloudconfig != nil {
 		c.addSystemdDropinCloudConfig(service, name, contents)
+	} else if c.cloudinit != nil {
+		c.addSystemdDropinCloudInit(service, name, contents)
 	}
 }
 
@@ -1268,6 +1294,8 @@ func (c *Conf) CopyKeys(keys []*agent.Key) {
 		c.copyKeysIgnitionV33(keys)
 	} else if c.cloudconfig != nil {
 		c.copyKeysCloudConfig(keys)
+	} else if c.cloudinit != nil {
+		c.copyKeysCloudInit(keys)
 	} else if c.script != "" {
 		c.copyKeysScript(keys)
 	}
@@ -1288,7 +1316,7 @@ func (c *Conf) IsIgnition() bool {
 }
 
 func (c *Conf) IsEmpty() bool {
-	return !c.IsIgnition() && c.cloudconfig == nil && c.script == ""
+	return !c.IsIgnition() && c.cloudconfig == nil && c.cloudinit == nil && c.script == ""
 }
 
 func AddSSHKeys(userdata *UserData, keys *[]agent.Key) *UserData {
@@ -1310,6 +1338,8 @@ func (c *Conf) AddUserToGroups(user string, groups []string) error {
 		c.addUserToGroupsV32(user, groups)
 	} else if c.ignitionV33 != nil {
 		c.addUserToGroupsV33(user, groups)
+	} else if c.cloudinit != nil {
+		c.addUserToGroupsCloudInit(user, groups)
 	} else {
 		err = fmt.Errorf("missing addUserToGroups implementation for this config type")
 	}
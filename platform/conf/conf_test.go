@@ -128,3 +128,415 @@ func TestConfAddUserToGroups(t *testing.T) {
 		}
 	}
 }
+
+func TestConfAddUser(t *testing.T) {
+	agent, err := network.NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+
+	keys, err := agent.List()
+	if err != nil {
+		t.Fatalf("agent.List failed: %v", err)
+	}
+
+	user := User{
+		Name:         "tester",
+		Groups:       []string{"docker"},
+		PasswordHash: "$6$salt$hash",
+	}
+	for i, tt := range []*UserData{
+		Ignition(`{ "ignition": { "version": "3.0.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		Butane("variant: flatcar\nversion: 1.0.0"),
+	} {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+		conf.CopyKeys(keys)
+		if err := conf.AddUser(user, keys); err != nil {
+			t.Errorf("adding user to config %d: %v", i, err)
+			continue
+		}
+
+		str := conf.String()
+		for _, s := range []string{`"name":"tester"`, `"docker"`, `"passwordHash":"$6$salt$hash"`, " core@default"} {
+			if !strings.Contains(str, s) {
+				t.Errorf("%s not found in config %d: %s", s, i, str)
+			}
+		}
+		// the keys of the default user are kept
+		if strings.Count(str, "ssh-rsa ") != 2*len(keys) {
+			t.Errorf("expected the keys for both users in config %d: %s", i, str)
+		}
+	}
+
+	conf, err := Ignition(`{ "ignition": { "version": "2.2.0" } }`).Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.AddUser(user, keys); err == nil {
+		t.Error("adding a user to an Ignition v2 config should fail")
+	}
+}
+
+func TestConfAddKdump(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.2.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.AddKdump("256M")
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d after adding kdump: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, unit := range []string{"kola-kdump-setup.service", "kola-kdump-load.service", "kola-kdump-save.service"} {
+			if !strings.Contains(str, unit) {
+				t.Errorf("%s not found in config %d: %s", unit, i, str)
+			}
+		}
+	}
+}
+
+func TestConfSetCgroupMode(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.2.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		for _, mode := range CgroupModes {
+			conf, err := tt.Render("")
+			if err != nil {
+				t.Errorf("failed to parse config %d: %v", i, err)
+				continue
+			}
+
+			conf.SetCgroupMode(mode)
+
+			if conf.IsIgnition() && !conf.ValidConfig() {
+				t.Errorf("invalid config %d after setting cgroup %s: %s", i, mode, conf.String())
+				continue
+			}
+			str := conf.String()
+			if !strings.Contains(str, "ConditionKernelCommandLine=!systemd.") {
+				t.Errorf("kernel arguments unit not found in config %d for cgroup %s: %s", i, mode, str)
+			}
+			if strings.Contains(str, "/etc/flatcar-cgroupv1") != (mode == CgroupV1) {
+				t.Errorf("unexpected /etc/flatcar-cgroupv1 in config %d for cgroup %s: %s", i, mode, str)
+			}
+		}
+	}
+}
+
+func TestUserDataNetworkd(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.2.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		u := tt.AddBond("bond0", "active-backup", []string{"eth0", "eth1"}, "DHCP=yes").
+			AddVLAN("vlan10", "bond0", 10, "Address=192.168.10.2/24").
+			AddBridge("br0", []string{"eth2"})
+		conf, err := u.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, path := range []string{
+			"/etc/systemd/network/30-kola-bond0.netdev",
+			"/etc/systemd/network/30-kola-bond0.network",
+			"/etc/systemd/network/30-kola-eth0.network",
+			"/etc/systemd/network/30-kola-eth1.network",
+			"/etc/systemd/network/30-kola-vlan10.netdev",
+			"/etc/systemd/network/30-kola-vlan10.network",
+			"/etc/systemd/network/30-kola-bond0.network.d/kola-vlan-vlan10.conf",
+			"/etc/systemd/network/30-kola-br0.netdev",
+			"/etc/systemd/network/30-kola-eth2.network",
+		} {
+			if !strings.Contains(str, path) {
+				t.Errorf("%s not found in config %d: %s", path, i, str)
+			}
+		}
+	}
+
+	// the original UserData is unchanged
+	conf, err := tests[0].Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := conf.String(); strings.Contains(str, "30-kola-") {
+		t.Errorf("networkd files in the original config: %s", str)
+	}
+}
+
+func TestUserDataOEM(t *testing.T) {
+	tests := []struct {
+		userdata *UserData
+		paths    []string
+	}{
+		{ContainerLinuxConfig(""), []string{`"filesystem":"oem","path":"/oem-release"`, `"filesystem":"oem","path":"/grub.cfg"`}},
+		{Ignition(`{ "ignition": { "version": "2.2.0" } }`), []string{`"filesystem":"oem","path":"/oem-release"`, `"filesystem":"oem","path":"/grub.cfg"`}},
+		{Ignition(`{ "ignition": { "version": "3.0.0" } }`), []string{`"path":"/usr/share/oem/oem-release"`, `"path":"/usr/share/oem/grub.cfg"`}},
+		{Ignition(`{ "ignition": { "version": "3.3.0" } }`), []string{`"path":"/usr/share/oem/oem-release"`, `"path":"/usr/share/oem/grub.cfg"`}},
+	}
+
+	for i, tt := range tests {
+		u := tt.userdata.AddOEMRelease("test", "VERSION_ID=1.0").
+			AddOEMGrubConfig(`set linux_append="flatcar.autologin"`).
+			AddOEMGrubConfig(`set linux_append="$linux_append quiet"`)
+		conf, err := u.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+		if !conf.ValidConfig() {
+			t.Errorf("invalid config %d: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, path := range tt.paths {
+			if !strings.Contains(str, path) {
+				t.Errorf("%s not found in config %d: %s", path, i, str)
+			}
+		}
+		if strings.Count(str, `"name":"oem"`) > 1 {
+			t.Errorf("OEM filesystem defined more than once in config %d: %s", i, str)
+		}
+	}
+}
+
+func TestConfPointerConfig(t *testing.T) {
+	tests := []struct {
+		userdata *UserData
+		ca       []byte
+		ok       bool
+	}{
+		{Ignition(`{ "ignition": { "version": "2.0.0" } }`), nil, true},
+		{Ignition(`{ "ignition": { "version": "2.0.0" } }`), []byte("ca"), false},
+		{Ignition(`{ "ignition": { "version": "2.2.0" } }`), []byte("ca"), true},
+		{Ignition(`{ "ignition": { "version": "3.3.0" } }`), []byte("ca"), true},
+		{CloudConfig("#cloud-config"), nil, false},
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.userdata.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		pointer, err := conf.PointerConfig("https://10.0.0.1:8080/config.ign", conf.Bytes(), tt.ca)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("expected error for config %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to create pointer config for %d: %v", i, err)
+			continue
+		}
+		if !pointer.ValidConfig() {
+			t.Errorf("invalid pointer config %d: %s", i, pointer.String())
+			continue
+		}
+		str := pointer.String()
+		if !strings.Contains(str, "https://10.0.0.1:8080/config.ign") || !strings.Contains(str, "sha512-") {
+			t.Errorf("config reference not found in pointer config %d: %s", i, str)
+		}
+		if tt.ca != nil && !strings.Contains(str, "certificateAuthorities") {
+			t.Errorf("certificate authority not found in pointer config %d: %s", i, str)
+		}
+	}
+}
+
+func TestConfAddSystemdUserUnit(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		Ignition(`{ "ignition": { "version": "2.3.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.AddSystemdUserUnit("core", "kola-test.service", `[Service]
+ExecStart=/usr/bin/sleep infinity
+[Install]
+WantedBy=default.target
+`, true)
+		conf.EnableLinger("core")
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d after adding user unit: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, s := range []string{"/etc/systemd/user/kola-test.service", "kola-enable-user-kola-test.service.service", "/var/lib/systemd/linger/core"} {
+			if !strings.Contains(str, s) {
+				t.Errorf("%s not found in config %d: %s", s, i, str)
+			}
+		}
+	}
+}
+
+func TestConfAddSysctlAndKernelModule(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.AddSysctl("net/ipv4/ip_forward", "1")
+		conf.AddKernelModule("br_netfilter", "")
+		conf.AddKernelModule("dummy", "numdummies=2")
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d after adding sysctl and modules: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, s := range []string{"/etc/sysctl.d/90-kola-net.ipv4.ip_forward.conf", "/etc/modules-load.d/kola-br_netfilter.conf", "/etc/modules-load.d/kola-dummy.conf", "/etc/modprobe.d/kola-dummy.conf"} {
+			if !strings.Contains(str, s) {
+				t.Errorf("%s not found in config %d: %s", s, i, str)
+			}
+		}
+		if strings.Contains(str, "/etc/modprobe.d/kola-br_netfilter.conf") {
+			t.Errorf("unexpected modprobe options in config %d: %s", i, str)
+		}
+	}
+}
+
+func TestConfEnableIPv6(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.EnableIPv6()
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d after enabling IPv6: %s", i, conf.String())
+			continue
+		}
+		str := conf.String()
+		for _, s := range []string{"/etc/sysctl.d/90-kola-net.ipv6.conf.all.disable_ipv6.conf", "/etc/systemd/network/zz-default.network.d/10-kola-ipv6.conf"} {
+			if !strings.Contains(str, s) {
+				t.Errorf("%s not found in config %d: %s", s, i, str)
+			}
+		}
+	}
+}
+
+func TestConfSetSELinuxMode(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		Ignition(`{ "ignition": { "version": "3.3.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.SetSELinuxMode("permissive", "mcs")
+
+		if conf.IsIgnition() && !conf.ValidConfig() {
+			t.Errorf("invalid config %d after setting the SELinux mode: %s", i, conf.String())
+			continue
+		}
+		if str := conf.String(); !strings.Contains(str, "/etc/selinux/config") {
+			t.Errorf("SELinux config not found in config %d: %s", i, str)
+		}
+	}
+}
+
+func TestConfSetUpdateServer(t *testing.T) {
+	tests := []struct {
+		server, group, appid string
+		ok                   bool
+	}{
+		{"http://10.0.0.1:34567/v1/update/", "developer", "", true},
+		{"https://nebraska.example.com/v1/update/", "stable", "{e96281a6-d1af-4bde-9a0a-97b76e56dc57}", true},
+		{"10.0.0.1:34567/v1/update/", "developer", "", false},
+		{"http://10.0.0.1/v1/update/", "", "", false},
+		{"http://10.0.0.1/v1/update/", "developer\nSERVER=http://evil/", "", false},
+	}
+
+	for i, tt := range tests {
+		conf, err := Ignition(`{ "ignition": { "version": "3.3.0" } }`).Render("")
+		if err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		err = conf.SetUpdateServer(tt.server, tt.group, tt.appid)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("expected error for update server %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to set update server %d: %v", i, err)
+			continue
+		}
+		if !conf.ValidConfig() {
+			t.Errorf("invalid config %d after setting update server: %s", i, conf.String())
+		}
+		if !strings.Contains(conf.String(), UpdateConfPath) {
+			t.Errorf("%s not found in config %d: %s", UpdateConfPath, i, conf.String())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+// coredumpConf makes systemd-coredump keep the core dumps of crashing
+// processes on disk, where kola collects them, up to a size that still
+// fits small test machines.
+const coredumpConf = `[Coredump]
+Storage=external
+Compress=yes
+ProcessSizeMax=1G
+ExternalSizeMax=1G
+`
+
+// KeepCoreDumps makes systemd-coredump save the core dumps of crashing
+// processes, see platform.CollectCrashes.
+func (c *Conf) KeepCoreDumps() {
+	c.AddFile("/etc/systemd/coredump.conf.d/90-kola.conf", "root", coredumpConf, 0644)
+}
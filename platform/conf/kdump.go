@@ -0,0 +1,105 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"strings"
+)
+
+// KdumpDir is where the machines save the dmesg of crashed kernels, one
+// directory per crash.
+const KdumpDir = "/var/crash"
+
+const kdumpScript = `#!/bin/bash
+# Installed by kola to collect the dmesg of kernel panics.
+set -euo pipefail
+
+case "$1" in
+setup)
+	# the crash kernel memory can only be reserved at boot
+	if mountpoint -q /oem; then
+		oem=/oem
+	else
+		oem=/usr/share/oem
+	fi
+	echo 'set linux_append="$linux_append crashkernel=@CRASHKERNEL@"' >>"${oem}/grub.cfg"
+	systemctl --no-block reboot
+	;;
+load)
+	kexec -p /usr/boot/vmlinuz --reuse-cmdline \
+		--append="irqpoll nr_cpus=1 reset_devices systemd.unit=kola-kdump-save.service"
+	;;
+save)
+	dir="@KDUMPDIR@/$(date +%Y%m%d-%H%M%S)"
+	mkdir -p "${dir}"
+	if command -v vmcore-dmesg >/dev/null; then
+		vmcore-dmesg /proc/vmcore >"${dir}/vmcore-dmesg.txt.tmp"
+	else
+		makedumpfile --dump-dmesg /proc/vmcore "${dir}/vmcore-dmesg.txt.tmp"
+	fi
+	mv "${dir}/vmcore-dmesg.txt.tmp" "${dir}/vmcore-dmesg.txt"
+	sync
+	systemctl --no-block reboot
+	;;
+esac
+`
+
+// AddKdump enables kdump with crashKernel (e.g. "256M") reserved for the
+// crash kernel. The kernel argument only takes effect after a reboot, so
+// the first boot reboots once before sshd is started. After a kernel
+// panic the crash kernel saves vmcore-dmesg.txt in a new directory in
+// KdumpDir and reboots the machine.
+func (c *Conf) AddKdump(crashKernel string) {
+	script := strings.NewReplacer("@CRASHKERNEL@", crashKernel, "@KDUMPDIR@", KdumpDir).Replace(kdumpScript)
+	c.AddFile("/opt/kola/kdump", "root", script, 0755)
+
+	c.AddSystemdUnit("kola-kdump-setup.service", `[Unit]
+Description=Reserve memory for the kdump crash kernel
+ConditionKernelCommandLine=!crashkernel
+ConditionPathExists=!/proc/vmcore
+Before=sshd.socket sshd.service
+
+[Service]
+Type=oneshot
+ExecStart=/opt/kola/kdump setup
+
+[Install]
+WantedBy=multi-user.target
+`, true)
+	c.AddSystemdUnit("kola-kdump-load.service", `[Unit]
+Description=Load the kdump crash kernel
+ConditionKernelCommandLine=crashkernel
+ConditionPathExists=!/proc/vmcore
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/opt/kola/kdump load
+
+[Install]
+WantedBy=multi-user.target
+`, true)
+	// started by the crash kernel via systemd.unit=
+	c.AddSystemdUnit("kola-kdump-save.service", `[Unit]
+Description=Save the dmesg of the crashed kernel
+ConditionPathExists=/proc/vmcore
+Requires=local-fs.target
+After=local-fs.target
+
+[Service]
+Type=oneshot
+ExecStart=/opt/kola/kdump save
+`, false)
+}
@@ -0,0 +1,38 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddSysctl sets the kernel parameter key (e.g. "net.ipv4.ip_forward",
+// "/" separators are accepted as well) to value on boot with a file in
+// /etc/sysctl.d.
+func (c *Conf) AddSysctl(key, value string) {
+	key = strings.Replace(strings.Trim(key, "/"), "/", ".", -1)
+	c.AddFile(fmt.Sprintf("/etc/sysctl.d/90-kola-%s.conf", key), "root", fmt.Sprintf("%s = %s\n", key, value), 0644)
+}
+
+// AddKernelModule loads the kernel module name on boot with a file in
+// /etc/modules-load.d. If options is set, it is passed to the module with
+// a file in /etc/modprobe.d.
+func (c *Conf) AddKernelModule(name, options string) {
+	c.AddFile(fmt.Sprintf("/etc/modules-load.d/kola-%s.conf", name), "root", name+"\n", 0644)
+	if options != "" {
+		c.AddFile(fmt.Sprintf("/etc/modprobe.d/kola-%s.conf", name), "root", fmt.Sprintf("options %s %s\n", name, options), 0644)
+	}
+}
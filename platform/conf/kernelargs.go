@@ -0,0 +1,61 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const kernelArgsScript = `#!/bin/bash
+# Installed by kola to add kernel arguments.
+set -euo pipefail
+
+if mountpoint -q /oem; then
+	oem=/oem
+else
+	oem=/usr/share/oem
+fi
+echo 'set linux_append="$linux_append @ARGS@"' >>"${oem}/grub.cfg"
+systemctl --no-block reboot
+`
+
+// AddKernelArgs boots the machine with the kernel arguments args, added
+// to the grub.cfg of the OEM partition. They only take effect after a
+// reboot, so the first boot reboots once before sshd is started.
+func (c *Conf) AddKernelArgs(args ...string) {
+	if len(args) == 0 {
+		return
+	}
+	joined := strings.Join(args, " ")
+	h := fnv.New32a()
+	h.Write([]byte(joined))
+	name := fmt.Sprintf("kola-kernel-args-%08x", h.Sum32())
+
+	c.AddFile("/opt/kola/"+name, "root", strings.Replace(kernelArgsScript, "@ARGS@", joined, 1), 0755)
+	c.AddSystemdUnit(name+".service", `[Unit]
+Description=Add kernel arguments for kola
+ConditionKernelCommandLine=!`+args[len(args)-1]+`
+Before=sshd.socket sshd.service
+
+[Service]
+Type=oneshot
+ExecStart=/opt/kola/`+name+`
+
+[Install]
+WantedBy=multi-user.target
+`, true)
+}
@@ -0,0 +1,197 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetaData is the instance metadata passed to cloud-init next to the
+// user-data by the NoCloud and ConfigDrive datasources, for distributions
+// which use cloud-init instead of Ignition.
+type MetaData struct {
+	// InstanceID identifies the machine. cloud-init runs its
+	// per-instance modules again when it changes.
+	InstanceID string
+	Hostname   string
+	// Network configures the interfaces of the machine. If nil,
+	// cloud-init configures the first interface with DHCP.
+	Network *NetworkConfig
+}
+
+// NetworkConfig is a network configuration in version 2 of the cloud-init
+// format, which is the netplan format.
+type NetworkConfig struct {
+	// Ethernets maps IDs, which are the interface names unless Match is
+	// set, to the configuration of the interfaces.
+	Ethernets map[string]EthernetConfig `yaml:"ethernets"`
+}
+
+// EthernetConfig is the configuration of an ethernet interface.
+type EthernetConfig struct {
+	Match *MatchConfig `yaml:"match,omitempty"`
+	// SetName renames the interface selected by Match.
+	SetName string `yaml:"set-name,omitempty"`
+	DHCP4   bool   `yaml:"dhcp4,omitempty"`
+	DHCP6   bool   `yaml:"dhcp6,omitempty"`
+	// Addresses are static addresses in CIDR notation, e.g.
+	// "10.0.0.2/24".
+	Addresses   []string     `yaml:"addresses,omitempty"`
+	Gateway4    string       `yaml:"gateway4,omitempty"`
+	Gateway6    string       `yaml:"gateway6,omitempty"`
+	Nameservers *Nameservers `yaml:"nameservers,omitempty"`
+}
+
+// MatchConfig selects an interface by its MAC address or name.
+type MatchConfig struct {
+	MACAddress string `yaml:"macaddress,omitempty"`
+	Name       string `yaml:"name,omitempty"`
+}
+
+// Nameservers are the DNS servers and search domains of an interface.
+type Nameservers struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+// NoCloudMetaData returns the meta-data file of the NoCloud datasource.
+func (m *MetaData) NoCloudMetaData() ([]byte, error) {
+	if m.InstanceID == "" {
+		return nil, fmt.Errorf("meta-data needs an instance ID")
+	}
+	return yaml.Marshal(struct {
+		InstanceID    string `yaml:"instance-id"`
+		LocalHostname string `yaml:"local-hostname,omitempty"`
+	}{m.InstanceID, m.Hostname})
+}
+
+// NoCloudNetworkConfig returns the network-config file of the NoCloud
+// datasource, or nil if Network is not set.
+func (m *MetaData) NoCloudNetworkConfig() ([]byte, error) {
+	if m.Network == nil {
+		return nil, nil
+	}
+	return yaml.Marshal(struct {
+		Version   int                       `yaml:"version"`
+		Ethernets map[string]EthernetConfig `yaml:"ethernets"`
+	}{2, m.Network.Ethernets})
+}
+
+// ConfigDriveMetaData returns the openstack/latest/meta_data.json file of
+// a config drive.
+func (m *MetaData) ConfigDriveMetaData() ([]byte, error) {
+	if m.InstanceID == "" {
+		return nil, fmt.Errorf("meta-data needs an instance ID")
+	}
+	md := map[string]string{"uuid": m.InstanceID}
+	if m.Hostname != "" {
+		md["hostname"] = m.Hostname
+		md["name"] = m.Hostname
+	}
+	return json.Marshal(md)
+}
+
+// ConfigDriveNetworkData returns the openstack/latest/network_data.json
+// file of a config drive, or nil if Network is not set. The OpenStack
+// format identifies interfaces by their MAC address, so all interfaces
+// need a Match with one.
+func (m *MetaData) ConfigDriveNetworkData() ([]byte, error) {
+	if m.Network == nil {
+		return nil, nil
+	}
+
+	type route struct {
+		Network string `json:"network"`
+		Netmask string `json:"netmask"`
+		Gateway string `json:"gateway"`
+	}
+	type network struct {
+		ID        string  `json:"id"`
+		Link      string  `json:"link"`
+		Type      string  `json:"type"`
+		IPAddress string  `json:"ip_address,omitempty"`
+		Netmask   string  `json:"netmask,omitempty"`
+		Routes    []route `json:"routes,omitempty"`
+	}
+	type link struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		MAC  string `json:"ethernet_mac_address"`
+	}
+	type service struct {
+		Type    string `json:"type"`
+		Address string `json:"address"`
+	}
+	var data struct {
+		Links    []link    `json:"links"`
+		Networks []network `json:"networks"`
+		Services []service `json:"services"`
+	}
+
+	// cloud-init doesn't accept null lists
+	data.Services = []service{}
+
+	ids := make([]string, 0, len(m.Network.Ethernets))
+	for id := range m.Network.Ethernets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		eth := m.Network.Ethernets[id]
+		if eth.Match == nil || eth.Match.MACAddress == "" {
+			return nil, fmt.Errorf("interface %q needs a MAC address for a config drive", id)
+		}
+		data.Links = append(data.Links, link{ID: id, Type: "phy", MAC: eth.Match.MACAddress})
+		if eth.DHCP4 {
+			data.Networks = append(data.Networks, network{ID: fmt.Sprintf("network%d", len(data.Networks)), Link: id, Type: "ipv4_dhcp"})
+		}
+		if eth.DHCP6 {
+			data.Networks = append(data.Networks, network{ID: fmt.Sprintf("network%d", len(data.Networks)), Link: id, Type: "ipv6_dhcp"})
+		}
+		for _, addr := range eth.Addresses {
+			ip, ipnet, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, fmt.Errorf("interface %q: %v", id, err)
+			}
+			n := network{
+				ID:        fmt.Sprintf("network%d", len(data.Networks)),
+				Link:      id,
+				Type:      "ipv4",
+				IPAddress: ip.String(),
+				Netmask:   net.IP(ipnet.Mask).String(),
+			}
+			gateway, all := eth.Gateway4, "0.0.0.0"
+			if ip.To4() == nil {
+				n.Type = "ipv6"
+				gateway, all = eth.Gateway6, "::"
+			}
+			if gateway != "" {
+				n.Routes = []route{{Network: all, Netmask: all, Gateway: gateway}}
+			}
+			data.Networks = append(data.Networks, n)
+		}
+		if eth.Nameservers != nil {
+			for _, addr := range eth.Nameservers.Addresses {
+				data.Services = append(data.Services, service{Type: "dns", Address: addr})
+			}
+		}
+	}
+	return json.Marshal(data)
+}
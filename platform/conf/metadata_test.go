@@ -0,0 +1,123 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNoCloud(t *testing.T) {
+	md := MetaData{
+		InstanceID: "i-1",
+		Hostname:   "node1",
+		Network: &NetworkConfig{
+			Ethernets: map[string]EthernetConfig{
+				"eth0": {
+					Match:       &MatchConfig{MACAddress: "52:54:00:12:34:56"},
+					SetName:     "eth0",
+					Addresses:   []string{"10.0.0.2/24"},
+					Gateway4:    "10.0.0.1",
+					Nameservers: &Nameservers{Addresses: []string{"10.0.0.1"}},
+				},
+			},
+		},
+	}
+
+	meta, err := md.NoCloudMetaData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(meta) != "instance-id: i-1\nlocal-hostname: node1\n" {
+		t.Errorf("unexpected meta-data:\n%s", meta)
+	}
+
+	network, err := md.NoCloudNetworkConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `version: 2
+ethernets:
+    eth0:
+        match:
+            macaddress: "52:54:00:12:34:56"
+        set-name: eth0
+        addresses:
+            - 10.0.0.2/24
+        gateway4: 10.0.0.1
+        nameservers:
+            addresses:
+                - 10.0.0.1
+`
+	if string(network) != want {
+		t.Errorf("unexpected network-config:\n%s", network)
+	}
+
+	if _, err := (&MetaData{}).NoCloudMetaData(); err == nil {
+		t.Error("meta-data without an instance ID succeeded")
+	}
+}
+
+func TestConfigDrive(t *testing.T) {
+	md := MetaData{
+		InstanceID: "i-1",
+		Network: &NetworkConfig{
+			Ethernets: map[string]EthernetConfig{
+				"eth0": {
+					Match:     &MatchConfig{MACAddress: "52:54:00:12:34:56"},
+					DHCP6:     true,
+					Addresses: []string{"10.0.0.2/24"},
+					Gateway4:  "10.0.0.1",
+				},
+			},
+		},
+	}
+
+	meta, err := md.ConfigDriveMetaData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(meta) != `{"uuid":"i-1"}` {
+		t.Errorf("unexpected meta_data.json: %s", meta)
+	}
+
+	b, err := md.ConfigDriveNetworkData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(`{
+		"links": [{"id": "eth0", "type": "phy", "ethernet_mac_address": "52:54:00:12:34:56"}],
+		"networks": [
+			{"id": "network0", "link": "eth0", "type": "ipv6_dhcp"},
+			{"id": "network1", "link": "eth0", "type": "ipv4", "ip_address": "10.0.0.2", "netmask": "255.255.255.0",
+			 "routes": [{"network": "0.0.0.0", "netmask": "0.0.0.0", "gateway": "10.0.0.1"}]}
+		],
+		"services": []
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected network_data.json: %s", b)
+	}
+
+	delete(md.Network.Ethernets, "eth0")
+	md.Network.Ethernets["eth1"] = EthernetConfig{DHCP4: true}
+	if _, err := md.ConfigDriveNetworkData(); err == nil {
+		t.Error("network data without a MAC address succeeded")
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import "strings"
+
+// ipv6Dropin makes the default network configuration of Flatcar accept
+// router advertisements, even on networks where networkd would not
+// enable IPv6 by itself, e.g. without IPv6 forwarding.
+const ipv6Dropin = `[Network]
+IPv6AcceptRA=yes
+LinkLocalAddressing=yes
+`
+
+// EnableIPv6 enables IPv6 on the machines for dual-stack and IPv6-only
+// tests: the kernel parameters disabling it are reset, e.g. if an image
+// or OEM sets them, and the default network configuration accepts router
+// advertisements.
+func (c *Conf) EnableIPv6() {
+	c.AddSysctl("net.ipv6.conf.all.disable_ipv6", "0")
+	c.AddSysctl("net.ipv6.conf.default.disable_ipv6", "0")
+	c.AddFile("/etc/systemd/network/zz-default.network.d/10-kola-ipv6.conf", "root", ipv6Dropin, 0644)
+}
+
+// AddDNSServers makes systemd-resolved use the DNS servers for all names
+// instead of those of the network.
+func (c *Conf) AddDNSServers(servers []string) {
+	c.AddFile("/etc/systemd/resolved.conf.d/90-kola-dns.conf", "root",
+		"[Resolve]\nDNS="+strings.Join(servers, " ")+"\nDomains=~.\n", 0644)
+}
+
+// AddHosts replaces /etc/hosts with hosts.
+func (c *Conf) AddHosts(hosts string) {
+	c.AddFile("/etc/hosts", "root", hosts, 0644)
+}
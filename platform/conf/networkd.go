@@ -0,0 +1,101 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import "fmt"
+
+// networkdFile returns the path of the systemd-networkd file of the
+// interface with the given extension, e.g. ".network". The files sort
+// before zz-default.network of Flatcar, which configures all other
+// interfaces with DHCP.
+func networkdFile(name, ext string) string {
+	return "/etc/systemd/network/30-kola-" + name + ext
+}
+
+// addNetworkdNetwork configures the interface name with the settings of
+// the [Network] section.
+func (c *Conf) addNetworkdNetwork(name string, network []string) {
+	contents := fmt.Sprintf("[Match]\nName=%s\n\n[Network]\n", name)
+	for _, setting := range network {
+		contents += setting + "\n"
+	}
+	c.AddFile(networkdFile(name, ".network"), "root", contents, 0644)
+}
+
+// AddNetwork configures the existing interface name, e.g. eth1, with
+// systemd-networkd. network holds the settings of the [Network] section,
+// e.g. "DHCP=yes" or "Address=192.168.0.2/24". Interfaces configured with
+// AddNetwork, AddBond, AddBridge or AddVLAN can be parents of VLANs.
+func (c *Conf) AddNetwork(name string, network ...string) {
+	c.addNetworkdNetwork(name, network)
+}
+
+// AddBond creates the bond interface name of the interfaces members,
+// configured like AddNetwork. mode is the bonding mode, e.g.
+// active-backup or 802.3ad, links are monitored every 100ms.
+func (c *Conf) AddBond(name, mode string, members []string, network ...string) {
+	c.AddFile(networkdFile(name, ".netdev"), "root",
+		fmt.Sprintf("[NetDev]\nName=%s\nKind=bond\n\n[Bond]\nMode=%s\nMIIMonitorSec=100ms\n", name, mode), 0644)
+	c.addNetworkdNetwork(name, network)
+	for _, member := range members {
+		c.addNetworkdNetwork(member, []string{"Bond=" + name})
+	}
+}
+
+// AddBridge creates the bridge interface name with the interfaces ports,
+// configured like AddNetwork.
+func (c *Conf) AddBridge(name string, ports []string, network ...string) {
+	c.AddFile(networkdFile(name, ".netdev"), "root",
+		fmt.Sprintf("[NetDev]\nName=%s\nKind=bridge\n", name), 0644)
+	c.addNetworkdNetwork(name, network)
+	for _, port := range ports {
+		c.addNetworkdNetwork(port, []string{"Bridge=" + name})
+	}
+}
+
+// AddVLAN creates the VLAN interface name with the VLAN id on top of the
+// interface parent, configured like AddNetwork. The parent has to be
+// configured with AddNetwork, AddBond, AddBridge or AddVLAN too.
+func (c *Conf) AddVLAN(name, parent string, id int, network ...string) {
+	c.AddFile(networkdFile(name, ".netdev"), "root",
+		fmt.Sprintf("[NetDev]\nName=%s\nKind=vlan\n\n[VLAN]\nId=%d\n", name, id), 0644)
+	c.addNetworkdNetwork(name, network)
+	c.AddFile(networkdFile(parent, ".network.d/kola-vlan-"+name+".conf"), "root",
+		"[Network]\nVLAN="+name+"\n", 0644)
+}
+
+// AddNetwork returns a copy of the UserData configuring an interface
+// when rendered, see Conf.AddNetwork.
+func (u *UserData) AddNetwork(name string, network ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddNetwork(name, network...) })
+}
+
+// AddBond returns a copy of the UserData creating a bond when rendered,
+// see Conf.AddBond.
+func (u *UserData) AddBond(name, mode string, members []string, network ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddBond(name, mode, members, network...) })
+}
+
+// AddBridge returns a copy of the UserData creating a bridge when
+// rendered, see Conf.AddBridge.
+func (u *UserData) AddBridge(name string, ports []string, network ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddBridge(name, ports, network...) })
+}
+
+// AddVLAN returns a copy of the UserData creating a VLAN when rendered,
+// see Conf.AddVLAN.
+func (u *UserData) AddVLAN(name, parent string, id int, network ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddVLAN(name, parent, id, network...) })
+}
@@ -0,0 +1,209 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+
+	v3types "github.com/coreos/ignition/v2/config/v3_0/types"
+	v31types "github.com/coreos/ignition/v2/config/v3_1/types"
+	v32types "github.com/coreos/ignition/v2/config/v3_2/types"
+	v33types "github.com/coreos/ignition/v2/config/v3_3/types"
+	v22types "github.com/flatcar/ignition/config/v2_2/types"
+	v23types "github.com/flatcar/ignition/config/v2_3/types"
+	"github.com/vincent-petithory/dataurl"
+)
+
+const (
+	// OEMDir is where the OEM partition is mounted on Flatcar.
+	OEMDir = "/usr/share/oem"
+
+	// oemFilesystem is the name of the OEM partition in Ignition v2
+	// configs, see the cl.ignition.oem tests.
+	oemFilesystem = "oem"
+)
+
+// AddOEMFile writes the file path, relative to the OEM partition, e.g.
+// "grub.cfg", with contents, replacing the file of the image. It supports
+// Ignition v2.2 and up; Ignition v3 configs rely on Flatcar mounting the
+// OEM partition for Ignition, since 3550.
+func (c *Conf) AddOEMFile(path, contents string, mode int) {
+	c.addOEMFile(path, contents, mode, false)
+}
+
+// AddOEMRelease writes the oem-release of the OEM partition for the OEM
+// id, e.g. "azure", with the additional fields, e.g. "VERSION_ID=1.0",
+// to simulate the OEM contents of a cloud. See AddOEMFile.
+func (c *Conf) AddOEMRelease(id string, fields ...string) {
+	contents := "ID=" + id + "\n"
+	for _, field := range fields {
+		contents += field + "\n"
+	}
+	c.AddOEMFile("oem-release", contents, 0644)
+}
+
+// AddOEMGrubConfig appends the lines, e.g. `set linux_append="..."`, to
+// the grub.cfg of the OEM partition, keeping the settings of the image.
+// Like AddKernelArgs they take effect on the next boot. See AddOEMFile.
+func (c *Conf) AddOEMGrubConfig(lines ...string) {
+	c.addOEMFile("grub.cfg", strings.Join(lines, "\n")+"\n", 0644, true)
+}
+
+func (c *Conf) addOEMFile(path, contents string, mode int, appendContents bool) {
+	path = strings.TrimPrefix(path, "/")
+	source := dataurl.EncodeBytes([]byte(contents))
+	overwrite := !appendContents
+	if c.ignitionV33 != nil {
+		file := v33types.File{
+			Node:          v33types.Node{Path: OEMDir + "/" + path},
+			FileEmbedded1: v33types.FileEmbedded1{Mode: &mode},
+		}
+		if appendContents {
+			file.Append = []v33types.Resource{{Source: &source}}
+		} else {
+			file.Overwrite = &overwrite
+			file.Contents = v33types.Resource{Source: &source}
+		}
+		c.MergeV33(v33types.Config{
+			Ignition: v33types.Ignition{Version: "3.3.0"},
+			Storage:  v33types.Storage{Files: []v33types.File{file}},
+		})
+	} else if c.ignitionV32 != nil {
+		file := v32types.File{
+			Node:          v32types.Node{Path: OEMDir + "/" + path},
+			FileEmbedded1: v32types.FileEmbedded1{Mode: &mode},
+		}
+		if appendContents {
+			file.Append = []v32types.Resource{{Source: &source}}
+		} else {
+			file.Overwrite = &overwrite
+			file.Contents = v32types.Resource{Source: &source}
+		}
+		c.MergeV32(v32types.Config{
+			Ignition: v32types.Ignition{Version: "3.2.0"},
+			Storage:  v32types.Storage{Files: []v32types.File{file}},
+		})
+	} else if c.ignitionV31 != nil {
+		file := v31types.File{
+			Node:          v31types.Node{Path: OEMDir + "/" + path},
+			FileEmbedded1: v31types.FileEmbedded1{Mode: &mode},
+		}
+		if appendContents {
+			file.Append = []v31types.Resource{{Source: &source}}
+		} else {
+			file.Overwrite = &overwrite
+			file.Contents = v31types.Resource{Source: &source}
+		}
+		c.MergeV31(v31types.Config{
+			Ignition: v31types.Ignition{Version: "3.1.0"},
+			Storage:  v31types.Storage{Files: []v31types.File{file}},
+		})
+	} else if c.ignitionV3 != nil {
+		file := v3types.File{
+			Node:          v3types.Node{Path: OEMDir + "/" + path},
+			FileEmbedded1: v3types.FileEmbedded1{Mode: &mode},
+		}
+		if appendContents {
+			file.Append = []v3types.FileContents{{Source: &source}}
+		} else {
+			file.Overwrite = &overwrite
+			file.Contents = v3types.FileContents{Source: &source}
+		}
+		c.MergeV3(v3types.Config{
+			Ignition: v3types.Ignition{Version: "3.0.0"},
+			Storage:  v3types.Storage{Files: []v3types.File{file}},
+		})
+	} else if c.ignitionV23 != nil {
+		if !hasFilesystemV23(c.ignitionV23.Storage.Filesystems, oemFilesystem) {
+			c.ignitionV23.Storage.Filesystems = append(c.ignitionV23.Storage.Filesystems, v23types.Filesystem{
+				Name: oemFilesystem,
+				Mount: &v23types.Mount{
+					Device: "/dev/disk/by-label/OEM",
+					Format: "btrfs",
+				},
+			})
+		}
+		c.ignitionV23.Storage.Files = append(c.ignitionV23.Storage.Files, v23types.File{
+			Node: v23types.Node{
+				Filesystem: oemFilesystem,
+				Path:       "/" + path,
+			},
+			FileEmbedded1: v23types.FileEmbedded1{
+				Append:   appendContents,
+				Contents: v23types.FileContents{Source: source},
+				Mode:     &mode,
+			},
+		})
+	} else if c.ignitionV22 != nil {
+		if !hasFilesystemV22(c.ignitionV22.Storage.Filesystems, oemFilesystem) {
+			c.ignitionV22.Storage.Filesystems = append(c.ignitionV22.Storage.Filesystems, v22types.Filesystem{
+				Name: oemFilesystem,
+				Mount: &v22types.Mount{
+					Device: "/dev/disk/by-label/OEM",
+					Format: "btrfs",
+				},
+			})
+		}
+		c.ignitionV22.Storage.Files = append(c.ignitionV22.Storage.Files, v22types.File{
+			Node: v22types.Node{
+				Filesystem: oemFilesystem,
+				Path:       "/" + path,
+			},
+			FileEmbedded1: v22types.FileEmbedded1{
+				Append:   appendContents,
+				Contents: v22types.FileContents{Source: source},
+				Mode:     &mode,
+			},
+		})
+	} else {
+		panic(fmt.Errorf("OEM files are only supported with Ignition v2.2 and up"))
+	}
+}
+
+func hasFilesystemV22(filesystems []v22types.Filesystem, name string) bool {
+	for _, fs := range filesystems {
+		if fs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFilesystemV23(filesystems []v23types.Filesystem, name string) bool {
+	for _, fs := range filesystems {
+		if fs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddOEMFile adds a file to the OEM partition, see Conf.AddOEMFile.
+func (u *UserData) AddOEMFile(path, contents string, mode int) *UserData {
+	return u.edit(func(c *Conf) { c.AddOEMFile(path, contents, mode) })
+}
+
+// AddOEMRelease writes the oem-release of the OEM partition, see
+// Conf.AddOEMRelease.
+func (u *UserData) AddOEMRelease(id string, fields ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddOEMRelease(id, fields...) })
+}
+
+// AddOEMGrubConfig appends to the grub.cfg of the OEM partition, see
+// Conf.AddOEMGrubConfig.
+func (u *UserData) AddOEMGrubConfig(lines ...string) *UserData {
+	return u.edit(func(c *Conf) { c.AddOEMGrubConfig(lines...) })
+}
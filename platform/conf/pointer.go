@@ -0,0 +1,92 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+// ignitionVersion returns the version of an Ignition config, or "" for
+// other kinds of userdata.
+func (c *Conf) ignitionVersion() string {
+	switch {
+	case c.ignitionV1 != nil:
+		return "1"
+	case c.ignitionV2 != nil:
+		return "2.0.0"
+	case c.ignitionV21 != nil:
+		return c.ignitionV21.Ignition.Version
+	case c.ignitionV22 != nil:
+		return c.ignitionV22.Ignition.Version
+	case c.ignitionV23 != nil:
+		return c.ignitionV23.Ignition.Version
+	case c.ignitionV3 != nil:
+		return c.ignitionV3.Ignition.Version
+	case c.ignitionV31 != nil:
+		return c.ignitionV31.Ignition.Version
+	case c.ignitionV32 != nil:
+		return c.ignitionV32.Ignition.Version
+	case c.ignitionV33 != nil:
+		return c.ignitionV33.Ignition.Version
+	}
+	return ""
+}
+
+// PointerConfig returns a config of the same Ignition version which
+// replaces itself with the config served at source, verified by the
+// SHA-512 of data. If ca is set, the PEM encoded certificate is trusted for
+// fetching the config over HTTPS.
+func (c *Conf) PointerConfig(source string, data []byte, ca []byte) (*Conf, error) {
+	version := c.ignitionVersion()
+	switch {
+	case version == "":
+		return nil, fmt.Errorf("only Ignition configs can be fetched from a URL")
+	case version == "1":
+		return nil, fmt.Errorf("Ignition v1 configs can't reference other configs")
+	case ca != nil && (strings.HasPrefix(version, "2.0") || strings.HasPrefix(version, "2.1")):
+		return nil, fmt.Errorf("Ignition %s configs can't trust custom certificate authorities", version)
+	}
+
+	sum := sha512.Sum512(data)
+	ignition := map[string]interface{}{
+		"version": version,
+		"config": map[string]interface{}{
+			"replace": map[string]interface{}{
+				"source":       source,
+				"verification": map[string]string{"hash": "sha512-" + hex.EncodeToString(sum[:])},
+			},
+		},
+	}
+	if ca != nil {
+		ignition["security"] = map[string]interface{}{
+			"tls": map[string]interface{}{
+				"certificateAuthorities": []map[string]string{
+					{"source": dataurl.New(ca, "text/plain").String()},
+				},
+			},
+		}
+	}
+	buf, err := json.Marshal(map[string]interface{}{"ignition": ignition})
+	if err != nil {
+		return nil, err
+	}
+	return Ignition(string(buf)).Render("")
+}
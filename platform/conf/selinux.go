@@ -0,0 +1,25 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+// SetSELinuxMode makes the machine load the SELinux policy policyType,
+// "targeted" if empty, in mode, "enforcing" or "permissive", from the
+// first boot on.
+func (c *Conf) SetSELinuxMode(mode, policyType string) {
+	if policyType == "" {
+		policyType = "targeted"
+	}
+	c.AddFile("/etc/selinux/config", "root", "SELINUX="+mode+"\nSELINUXTYPE="+policyType+"\n", 0644)
+}
@@ -0,0 +1,69 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// UpdateConfPath is the configuration file of update_engine. Releases
+// before the rename to Flatcar read /etc/coreos/update.conf, which is a
+// symlink to it on current releases.
+const UpdateConfPath = "/etc/flatcar/update.conf"
+
+// UpdateConf returns the contents of update.conf making update_engine use
+// the Omaha server at server (e.g. "http://10.0.0.1:34567/v1/update/") and
+// the update group. appid overrides the application ID sent to the
+// server, e.g. for Nebraska instances serving other products, it is left
+// out if empty.
+func UpdateConf(server, group, appid string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid update server %q: %v", server, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid update server %q: needs to be an http:// or https:// URL", server)
+	}
+	for name, value := range map[string]string{"group": group, "appid": appid} {
+		if strings.IndexFunc(value, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		}) >= 0 {
+			return "", fmt.Errorf("invalid update %s %q: must not contain whitespace", name, value)
+		}
+	}
+	if group == "" {
+		return "", fmt.Errorf("update group must not be empty")
+	}
+
+	contents := fmt.Sprintf("GROUP=%s\nSERVER=%s\n", group, server)
+	if appid != "" {
+		contents += fmt.Sprintf("FLATCAR_RELEASE_APPID=%s\n", appid)
+	}
+	return contents, nil
+}
+
+// SetUpdateServer writes UpdateConfPath to make update_engine use the
+// Omaha server at server with the update group and appid, see UpdateConf.
+func (c *Conf) SetUpdateServer(server, group, appid string) error {
+	contents, err := UpdateConf(server, group, appid)
+	if err != nil {
+		return err
+	}
+	c.AddFile(UpdateConfPath, "root", contents, 0644)
+	return nil
+}
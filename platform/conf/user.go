@@ -0,0 +1,237 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+
+	v3types "github.com/coreos/ignition/v2/config/v3_0/types"
+	v31types "github.com/coreos/ignition/v2/config/v3_1/types"
+	v32types "github.com/coreos/ignition/v2/config/v3_2/types"
+	v33types "github.com/coreos/ignition/v2/config/v3_3/types"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// User is an additional, unprivileged user of a machine.
+type User struct {
+	Name string
+	// Groups are the supplementary groups of the user, e.g. docker.
+	Groups []string
+	// PasswordHash is the crypt(3) hash of the password of the user,
+	// if it needs one, e.g. to authenticate to polkit.
+	PasswordHash string
+}
+
+// AddUser creates u with the given SSH keys. Like AddUserToGroups it is
+// only implemented for Ignition v3 and cloud-init configs.
+func (c *Conf) AddUser(u User, keys []*agent.Key) error {
+	if err := c.AddUserToGroups(u.Name, u.Groups); err != nil {
+		return err
+	}
+	if u.PasswordHash != "" {
+		if err := c.AddUserPassword(u.Name, u.PasswordHash); err != nil {
+			return err
+		}
+	}
+	return c.AddUserSSHKeys(u.Name, keys)
+}
+
+// AddUserPassword sets the password of user to the crypt(3) hash
+// passwordHash.
+func (c *Conf) AddUserPassword(user, passwordHash string) error {
+	var err error
+
+	if c.ignitionV3 != nil {
+		c.addUserPasswordV3(user, passwordHash)
+	} else if c.ignitionV31 != nil {
+		c.addUserPasswordV31(user, passwordHash)
+	} else if c.ignitionV32 != nil {
+		c.addUserPasswordV32(user, passwordHash)
+	} else if c.ignitionV33 != nil {
+		c.addUserPasswordV33(user, passwordHash)
+	} else if c.cloudinit != nil {
+		c.addUserPasswordCloudInit(user, passwordHash)
+	} else {
+		err = fmt.Errorf("missing addUserPassword implementation for this config type")
+	}
+
+	return err
+}
+
+// AddUserSSHKeys authorizes keys to log in as user, like CopyKeys does for
+// the default user.
+func (c *Conf) AddUserSSHKeys(user string, keys []*agent.Key) error {
+	var err error
+
+	if c.ignitionV3 != nil {
+		c.addUserSSHKeysV3(user, keysToStrings(keys))
+	} else if c.ignitionV31 != nil {
+		c.addUserSSHKeysV31(user, keysToStrings(keys))
+	} else if c.ignitionV32 != nil {
+		c.addUserSSHKeysV32(user, keysToStrings(keys))
+	} else if c.ignitionV33 != nil {
+		c.addUserSSHKeysV33(user, keysToStrings(keys))
+	} else if c.cloudinit != nil {
+		c.addUserSSHKeysCloudInit(user, keysToStrings(keys))
+	} else {
+		err = fmt.Errorf("missing addUserSSHKeys implementation for this config type")
+	}
+
+	return err
+}
+
+func (c *Conf) addUserPasswordV3(user, passwordHash string) {
+	c.MergeV3(v3types.Config{
+		Ignition: v3types.Ignition{
+			Version: "3.0.0",
+		},
+		Passwd: v3types.Passwd{
+			Users: []v3types.PasswdUser{
+				{
+					Name:         user,
+					PasswordHash: &passwordHash,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserSSHKeysV3(user string, keys []string) {
+	var keyObjs []v3types.SSHAuthorizedKey
+	for _, key := range keys {
+		keyObjs = append(keyObjs, v3types.SSHAuthorizedKey(key))
+	}
+	c.MergeV3(v3types.Config{
+		Ignition: v3types.Ignition{
+			Version: "3.0.0",
+		},
+		Passwd: v3types.Passwd{
+			Users: []v3types.PasswdUser{
+				{
+					Name:              user,
+					SSHAuthorizedKeys: keyObjs,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserPasswordV31(user, passwordHash string) {
+	c.MergeV31(v31types.Config{
+		Ignition: v31types.Ignition{
+			Version: "3.1.0",
+		},
+		Passwd: v31types.Passwd{
+			Users: []v31types.PasswdUser{
+				{
+					Name:         user,
+					PasswordHash: &passwordHash,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserSSHKeysV31(user string, keys []string) {
+	var keyObjs []v31types.SSHAuthorizedKey
+	for _, key := range keys {
+		keyObjs = append(keyObjs, v31types.SSHAuthorizedKey(key))
+	}
+	c.MergeV31(v31types.Config{
+		Ignition: v31types.Ignition{
+			Version: "3.1.0",
+		},
+		Passwd: v31types.Passwd{
+			Users: []v31types.PasswdUser{
+				{
+					Name:              user,
+					SSHAuthorizedKeys: keyObjs,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserPasswordV32(user, passwordHash string) {
+	c.MergeV32(v32types.Config{
+		Ignition: v32types.Ignition{
+			Version: "3.2.0",
+		},
+		Passwd: v32types.Passwd{
+			Users: []v32types.PasswdUser{
+				{
+					Name:         user,
+					PasswordHash: &passwordHash,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserSSHKeysV32(user string, keys []string) {
+	var keyObjs []v32types.SSHAuthorizedKey
+	for _, key := range keys {
+		keyObjs = append(keyObjs, v32types.SSHAuthorizedKey(key))
+	}
+	c.MergeV32(v32types.Config{
+		Ignition: v32types.Ignition{
+			Version: "3.2.0",
+		},
+		Passwd: v32types.Passwd{
+			Users: []v32types.PasswdUser{
+				{
+					Name:              user,
+					SSHAuthorizedKeys: keyObjs,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserPasswordV33(user, passwordHash string) {
+	c.MergeV33(v33types.Config{
+		Ignition: v33types.Ignition{
+			Version: "3.3.0",
+		},
+		Passwd: v33types.Passwd{
+			Users: []v33types.PasswdUser{
+				{
+					Name:         user,
+					PasswordHash: &passwordHash,
+				},
+			},
+		},
+	})
+}
+
+func (c *Conf) addUserSSHKeysV33(user string, keys []string) {
+	var keyObjs []v33types.SSHAuthorizedKey
+	for _, key := range keys {
+		keyObjs = append(keyObjs, v33types.SSHAuthorizedKey(key))
+	}
+	c.MergeV33(v33types.Config{
+		Ignition: v33types.Ignition{
+			Version: "3.3.0",
+		},
+		Passwd: v33types.Passwd{
+			Users: []v33types.PasswdUser{
+				{
+					Name:              user,
+					SSHAuthorizedKeys: keyObjs,
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"path"
+)
+
+// AddSystemdUserUnit adds the systemd user unit name for user. Ignition
+// only handles system units and the files it writes are owned by root, so
+// the unit is written to /etc/systemd/user with a drop-in restricting it to
+// the user manager of user via ConditionUser=. If enable is set, the unit
+// is enabled with "systemctl --global enable" on boot, before any user
+// manager is started; its contents then need an [Install] section, e.g.
+// WantedBy=default.target.
+func (c *Conf) AddSystemdUserUnit(user, name, contents string, enable bool) {
+	dir := "/etc/systemd/user"
+	c.AddFile(path.Join(dir, name), "root", contents, 0644)
+	c.AddFile(path.Join(dir, name+".d", "10-kola-user.conf"), "root", fmt.Sprintf(`[Unit]
+ConditionUser=%s
+`, user), 0644)
+	if !enable {
+		return
+	}
+	c.AddSystemdUnit(fmt.Sprintf("kola-enable-user-%s.service", name), fmt.Sprintf(`[Unit]
+Description=Enable the systemd user unit %[1]s
+ConditionPathExists=!%[2]s/default.target.wants/%[1]s
+Before=systemd-logind.service systemd-user-sessions.service
+[Service]
+Type=oneshot
+ExecStart=/usr/bin/systemctl --global enable %[1]s
+[Install]
+WantedBy=multi-user.target
+`, name, dir), true)
+}
+
+// EnableLinger makes systemd start the user manager of user on boot and
+// keep it running without a login session, so user units are started
+// right away.
+func (c *Conf) EnableLinger(user string) {
+	c.AddFile(path.Join("/var/lib/systemd/linger", user), "root", "", 0644)
+}
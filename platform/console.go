@@ -0,0 +1,125 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConsoleStreamInterval is how often a ConsoleStream fetches new output.
+const ConsoleStreamInterval = 10 * time.Second
+
+// ConsoleFetcher returns the serial console output of a machine produced
+// since its previous call.
+type ConsoleFetcher func() ([]byte, error)
+
+// ConsoleStream continuously records the serial console of a cloud machine
+// to a file, so the output is visible while the machine runs and kept if
+// it never comes up, like the console of QEMU machines.
+type ConsoleStream struct {
+	fetch ConsoleFetcher
+
+	lock sync.Mutex
+	f    *os.File
+	buf  bytes.Buffer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewConsoleStream starts polling fetch every interval, appending the
+// output to the file at path.
+func NewConsoleStream(path string, interval time.Duration, fetch ConsoleFetcher) (*ConsoleStream, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ConsoleStream{
+		fetch: fetch,
+		f:     f,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				// the console is often not available yet while
+				// the machine boots
+				if err := s.poll(); err != nil {
+					plog.Debugf("Polling console: %v", err)
+				}
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *ConsoleStream) poll() error {
+	data, err := s.fetch()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	s.buf.Write(data)
+	if _, err := s.f.Write(data); err != nil {
+		return fmt.Errorf("writing console: %v", err)
+	}
+	return nil
+}
+
+// Output returns the console output recorded so far.
+func (s *ConsoleStream) Output() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.buf.String()
+}
+
+// Close stops polling, fetches the remaining output and closes the file.
+// It must be called before the machine is destroyed.
+func (s *ConsoleStream) Close() error {
+	close(s.stop)
+	<-s.done
+
+	err := s.poll()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsoleStream(t *testing.T) {
+	var lock sync.Mutex
+	chunks := []string{"", "GRUB\n", "Linux version\n", "login: "}
+	fetch := func() ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(chunks) == 0 {
+			return nil, errors.New("no more output")
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return []byte(chunk), nil
+	}
+
+	path := filepath.Join(t.TempDir(), "console.txt")
+	s, err := NewConsoleStream(path, time.Millisecond, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "GRUB\nLinux version\nlogin: "
+	deadline := time.Now().Add(10 * time.Second)
+	for s.Output() != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if out := s.Output(); out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+
+	if err := s.Close(); err == nil {
+		t.Error("expected the error of the final fetch")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("got file %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// coreDumpMaxSize is the size of the largest compressed core dump
+	// copied from the machines, only the info of larger ones is.
+	coreDumpMaxSize = 64 << 20
+
+	// taintDie is the taint flag of kernels that oopsed.
+	taintDie = 1 << 7
+)
+
+var coreDumpStorage = regexp.MustCompile(`(?m)^\s*Storage: (/\S+)`)
+
+// coreDump is an entry of coredumpctl --json=short list.
+type coreDump struct {
+	PID      int    `json:"pid"`
+	Signal   int    `json:"sig"`
+	Exe      string `json:"exe"`
+	Corefile string `json:"corefile"`
+	Size     int64  `json:"size"`
+}
+
+// parseCoreDumps parses the output of coredumpctl --json=short list, which
+// is empty if there are none.
+func parseCoreDumps(out []byte) ([]coreDump, error) {
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil, nil
+	}
+	var dumps []coreDump
+	if err := json.Unmarshal(out, &dumps); err != nil {
+		return nil, fmt.Errorf("parsing coredumpctl output: %v", err)
+	}
+	return dumps, nil
+}
+
+// CollectCrashes copies the core dumps saved by systemd-coredump on the
+// running machine m, with their info, to the coredump directory in dir,
+// and the kernel log to kernel-oops.txt if the kernel oopsed. It returns a
+// description of each crash.
+func CollectCrashes(m Machine, dir string) ([]string, error) {
+	var crashes []string
+
+	out, stderr, err := m.SSH("cat /proc/sys/kernel/tainted")
+	if err != nil {
+		return nil, fmt.Errorf("reading the kernel taint: %v: %s", err, stderr)
+	}
+	if taint, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64); err == nil && taint&taintDie != 0 {
+		dmesg, stderr, err := m.SSH("sudo dmesg")
+		if err != nil {
+			return nil, fmt.Errorf("reading the kernel log: %v: %s", err, stderr)
+		}
+		if err := writeCrashFile(dir, "kernel-oops.txt", dmesg); err != nil {
+			return nil, err
+		}
+		crashes = append(crashes, "kernel oops")
+	}
+
+	// coredumpctl fails if there are no core dumps
+	out, stderr, err = m.SSH("if command -v coredumpctl >/dev/null; then sudo coredumpctl --no-pager --json=short list 2>/dev/null || true; fi")
+	if err != nil {
+		return nil, fmt.Errorf("listing core dumps: %v: %s", err, stderr)
+	}
+	dumps, err := parseCoreDumps(out)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dumps {
+		name := fmt.Sprintf("%d-%s", d.PID, filepath.Base(d.Exe))
+		info, stderr, err := m.SSH(fmt.Sprintf("sudo coredumpctl --no-pager info %d", d.PID))
+		if err != nil {
+			return nil, fmt.Errorf("reading the info of core dump %s: %v: %s", name, err, stderr)
+		}
+		if err := writeCrashFile(filepath.Join(dir, "coredump"), name+".txt", info); err != nil {
+			return nil, err
+		}
+		if match := coreDumpStorage.FindSubmatch(info); match != nil && d.Corefile == "present" && d.Size <= coreDumpMaxSize {
+			core, stderr, err := m.SSH("sudo cat " + string(match[1]))
+			if err != nil {
+				return nil, fmt.Errorf("reading core dump %s: %v: %s", name, err, stderr)
+			}
+			if err := writeCrashFile(filepath.Join(dir, "coredump"), filepath.Base(string(match[1])), core); err != nil {
+				return nil, err
+			}
+		}
+		crashes = append(crashes, fmt.Sprintf("%s (PID %d) dumped core on signal %d", d.Exe, d.PID, d.Signal))
+	}
+	return crashes, nil
+}
+
+func writeCrashFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
@@ -0,0 +1,47 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"testing"
+)
+
+func TestParseCoreDumps(t *testing.T) {
+	out := []byte(`[{"time":1697123456789012,"pid":1234,"uid":500,"gid":500,"sig":11,"corefile":"present","exe":"/usr/bin/sleep","size":20480},` +
+		`{"time":1697123457000000,"pid":99,"uid":0,"gid":0,"sig":6,"corefile":"missing","exe":"/usr/lib/systemd/systemd-journald","size":null}]` + "\n")
+	dumps, err := parseCoreDumps(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []coreDump{
+		{PID: 1234, Signal: 11, Exe: "/usr/bin/sleep", Corefile: "present", Size: 20480},
+		{PID: 99, Signal: 6, Exe: "/usr/lib/systemd/systemd-journald", Corefile: "missing"},
+	}
+	if len(dumps) != len(expected) {
+		t.Fatalf("got %d core dumps, expected %d", len(dumps), len(expected))
+	}
+	for i := range expected {
+		if dumps[i] != expected[i] {
+			t.Errorf("core dump %d: got %+v, expected %+v", i, dumps[i], expected[i])
+		}
+	}
+
+	if dumps, err := parseCoreDumps([]byte("\n")); err != nil || len(dumps) != 0 {
+		t.Errorf("no core dumps: got %v, %v", dumps, err)
+	}
+	if _, err := parseCoreDumps([]byte("No coredumps found.")); err == nil {
+		t.Error("expected an error for unparsable output")
+	}
+}
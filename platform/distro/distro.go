@@ -0,0 +1,297 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package distro describes the per-distribution behavior of kola in
+// declarative profiles. The built-in profiles cover Flatcar ("cl"),
+// Fedora CoreOS, RHCOS and the Debian and Ubuntu cloud images; derivatives
+// can register their own profiles from a JSON file without touching the
+// test harness.
+package distro
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Update mechanisms a distribution can use.
+const (
+	UpdaterUpdateEngine = "update-engine"
+	UpdaterZincati      = "zincati"
+	UpdaterPivot        = "pivot"
+)
+
+// Provisioning mechanisms reading the machine config on the first boot.
+const (
+	ProvisioningIgnition = "ignition"
+	// ProvisioningCloudInit is used by generic distributions, they get
+	// cloud-configs and scripts only.
+	ProvisioningCloudInit = "cloud-init"
+)
+
+// Version schemes used to parse the OS version for test version gating.
+const (
+	// VersionFlatcar parses MAJOR.MINOR.PATCH Flatcar versions.
+	VersionFlatcar = "flatcar"
+	// VersionNone disables version gating, all tests are considered
+	// applicable.
+	VersionNone = "none"
+)
+
+// File is a file added to the configuration of every machine.
+type File struct {
+	Path     string `json:"path"`
+	Contents string `json:"contents"`
+	Mode     int    `json:"mode"`
+}
+
+// Profile holds everything kola needs to know about a distribution.
+type Profile struct {
+	// Name is the value passed to --distro and listed in the Distros
+	// field of tests.
+	Name string `json:"name"`
+	// Parent names a distribution whose tests also run on this one,
+	// e.g. "cl" for Flatcar derivatives.
+	Parent string `json:"parent,omitempty"`
+	// OSReleaseID is the expected ID in /etc/os-release. CheckMachine
+	// skips the check if it is empty.
+	OSReleaseID string `json:"os_release_id,omitempty"`
+	// DefaultUser is the SSH user when a test does not set its own.
+	DefaultUser string `json:"default_user"`
+	// Provisioning is the mechanism applying the machine config,
+	// defaults to ProvisioningIgnition.
+	Provisioning string `json:"provisioning,omitempty"`
+	// IgnitionVersion is the default config flavor, "v2" or "v3". It
+	// is ignored for cloud-init distributions.
+	IgnitionVersion string `json:"ignition_version,omitempty"`
+	// Updater is the update mechanism of the distribution.
+	Updater string `json:"updater,omitempty"`
+	// VersionScheme selects how the OS version is parsed.
+	VersionScheme string `json:"version_scheme,omitempty"`
+	// MangleImage enables the Flatcar specific disk image modifications
+	// on QEMU, like console logging.
+	MangleImage bool `json:"mangle_image,omitempty"`
+	// SELinuxKolet relabels the kolet binary so that systemd may
+	// execute it from the home directory.
+	SELinuxKolet bool `json:"selinux_kolet,omitempty"`
+	// NoSELinux skips enabling SELinux when machines start, for
+	// distributions without it.
+	NoSELinux bool `json:"no_selinux,omitempty"`
+	// SELinuxType is the policy in /etc/selinux/config, written when
+	// machines boot in a given SELinux mode, defaults to "targeted".
+	SELinuxType string `json:"selinux_type,omitempty"`
+	// Files are added to every machine config.
+	Files []File `json:"files,omitempty"`
+}
+
+var (
+	lock     sync.RWMutex
+	profiles = map[string]*Profile{}
+)
+
+func init() {
+	for _, p := range []*Profile{
+		{
+			Name:            "cl",
+			OSReleaseID:     "flatcar",
+			DefaultUser:     "core",
+			IgnitionVersion: "v2",
+			Updater:         UpdaterUpdateEngine,
+			VersionScheme:   VersionFlatcar,
+			MangleImage:     true,
+			SELinuxType:     "mcs",
+		},
+		{
+			Name:            "fcos",
+			OSReleaseID:     "fedora",
+			DefaultUser:     "core",
+			IgnitionVersion: "v3",
+			Updater:         UpdaterZincati,
+			SELinuxKolet:    true,
+			// disable Zincati & Pinger by default
+			Files: []File{
+				{
+					Path:     "/etc/fedora-coreos-pinger/config.d/90-disable-reporting.toml",
+					Contents: "[reporting]\nenabled = false",
+					Mode:     0644,
+				},
+				{
+					Path:     "/etc/zincati/config.d/90-disable-auto-updates.toml",
+					Contents: "[updates]\nenabled = false",
+					Mode:     0644,
+				},
+			},
+		},
+		{
+			Name:            "rhcos",
+			OSReleaseID:     "rhcos",
+			DefaultUser:     "core",
+			IgnitionVersion: "v3",
+			Updater:         UpdaterPivot,
+			VersionScheme:   VersionNone,
+			SELinuxKolet:    true,
+		},
+		{
+			Name:          "debian",
+			OSReleaseID:   "debian",
+			DefaultUser:   "debian",
+			Provisioning:  ProvisioningCloudInit,
+			VersionScheme: VersionNone,
+			NoSELinux:     true,
+		},
+		{
+			Name:          "ubuntu",
+			OSReleaseID:   "ubuntu",
+			DefaultUser:   "ubuntu",
+			Provisioning:  ProvisioningCloudInit,
+			VersionScheme: VersionNone,
+			NoSELinux:     true,
+		},
+	} {
+		if err := Register(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds a profile, replacing a previously registered profile
+// with the same name.
+func Register(p *Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("distro profile has no name")
+	}
+	if p.DefaultUser == "" {
+		p.DefaultUser = "core"
+	}
+	if p.Provisioning == "" {
+		p.Provisioning = ProvisioningIgnition
+	}
+	switch p.Provisioning {
+	case ProvisioningIgnition:
+		switch p.IgnitionVersion {
+		case "v2", "v3":
+		default:
+			return fmt.Errorf("distro profile %q: unknown ignition version %q", p.Name, p.IgnitionVersion)
+		}
+	case ProvisioningCloudInit:
+	default:
+		return fmt.Errorf("distro profile %q: unknown provisioning %q", p.Name, p.Provisioning)
+	}
+	switch p.VersionScheme {
+	case "", VersionFlatcar, VersionNone:
+	default:
+		return fmt.Errorf("distro profile %q: unknown version scheme %q", p.Name, p.VersionScheme)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	profiles[p.Name] = p
+	return nil
+}
+
+// Get returns the profile registered for name.
+func Get(name string) (*Profile, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown distribution %q", name)
+	}
+	return p, nil
+}
+
+// Lookup is like Get but returns a profile with only the defaults set
+// for unknown distributions.
+func Lookup(name string) *Profile {
+	if p, err := Get(name); err == nil {
+		return p
+	}
+	return &Profile{Name: name, DefaultUser: "core", Provisioning: ProvisioningIgnition}
+}
+
+// CloudInit reports whether machines of the distribution are provisioned
+// by cloud-init.
+func (p *Profile) CloudInit() bool {
+	return p.Provisioning == ProvisioningCloudInit
+}
+
+// Names returns the sorted names of all registered profiles.
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lineage returns the name of the profile followed by its ancestors.
+func (p *Profile) Lineage() []string {
+	names := []string{p.Name}
+	seen := map[string]bool{p.Name: true}
+	for parent := p.Parent; parent != "" && !seen[parent]; {
+		names = append(names, parent)
+		seen[parent] = true
+		pp, err := Get(parent)
+		if err != nil {
+			break
+		}
+		parent = pp.Parent
+	}
+	return names
+}
+
+// LoadFile registers the profiles from a JSON file holding a list of
+// profiles. Unset fields of a profile with a parent are inherited from
+// the parent profile.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, r := range raw {
+		var head struct {
+			Parent string `json:"parent"`
+		}
+		if err := json.Unmarshal(r, &head); err != nil {
+			return fmt.Errorf("parsing %s: %v", path, err)
+		}
+		p := &Profile{}
+		if head.Parent != "" {
+			parent, err := Get(head.Parent)
+			if err != nil {
+				return fmt.Errorf("parsing %s: %v", path, err)
+			}
+			*p = *parent
+			// the name must come from the file
+			p.Name = ""
+		}
+		if err := json.Unmarshal(r, p); err != nil {
+			return fmt.Errorf("parsing %s: %v", path, err)
+		}
+		if err := Register(p); err != nil {
+			return fmt.Errorf("parsing %s: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.Nil(t, os.WriteFile(path, []byte(`[
+		{"name": "derived", "parent": "cl", "os_release_id": "derived"},
+		{"name": "grandchild", "parent": "derived", "default_user": "admin"}
+	]`), 0644))
+	require.Nil(t, LoadFile(path))
+
+	p, err := Get("derived")
+	require.Nil(t, err)
+	assert.Equal(t, "derived", p.OSReleaseID)
+	assert.Equal(t, "v2", p.IgnitionVersion)
+	assert.Equal(t, VersionFlatcar, p.VersionScheme)
+	assert.True(t, p.MangleImage)
+
+	p, err = Get("grandchild")
+	require.Nil(t, err)
+	assert.Equal(t, "admin", p.DefaultUser)
+	assert.Equal(t, []string{"grandchild", "derived", "cl"}, p.Lineage())
+
+	assert.Contains(t, Names(), "grandchild")
+	_, err = Get("missing")
+	assert.NotNil(t, err)
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.Nil(t, os.WriteFile(path, []byte(`[{"name": "broken", "ignition_version": "v9"}]`), 0644))
+	assert.NotNil(t, LoadFile(path))
+
+	require.Nil(t, os.WriteFile(path, []byte(`[{"name": "orphan", "parent": "missing"}]`), 0644))
+	assert.NotNil(t, LoadFile(path))
+}
+
+func TestCloudInitProfiles(t *testing.T) {
+	p, err := Get("debian")
+	require.Nil(t, err)
+	assert.True(t, p.CloudInit())
+	assert.Equal(t, "debian", p.DefaultUser)
+	assert.Equal(t, "", p.IgnitionVersion)
+
+	cl, err := Get("cl")
+	require.Nil(t, err)
+	assert.False(t, cl.CloudInit())
+	assert.Equal(t, ProvisioningIgnition, cl.Provisioning)
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.Nil(t, os.WriteFile(path, []byte(`[{"name": "mydebian", "parent": "debian", "os_release_id": "mydebian"}]`), 0644))
+	require.Nil(t, LoadFile(path))
+	p, err = Get("mydebian")
+	require.Nil(t, err)
+	assert.True(t, p.CloudInit())
+
+	require.Nil(t, os.WriteFile(path, []byte(`[{"name": "broken", "provisioning": "kickstart"}]`), 0644))
+	assert.NotNil(t, LoadFile(path))
+}
@@ -0,0 +1,133 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DNSDomain is the domain of the names created for the machines of a
+// cluster, see Cluster.SetDNSRecord.
+const DNSDomain = "kola.internal"
+
+// hostsMarker ends the lines of /etc/hosts managed by kola.
+const hostsMarker = " # kola"
+
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// CheckDNSName returns an error if name, e.g. "etcd" or "member1.etcd",
+// is not a valid lowercase DNS name.
+func CheckDNSName(name string) error {
+	for _, label := range strings.Split(name, ".") {
+		if !dnsLabel.MatchString(label) {
+			return fmt.Errorf("invalid DNS name %q", name)
+		}
+	}
+	return nil
+}
+
+// DNSRecords maps fully qualified names to their addresses.
+type DNSRecords map[string][]string
+
+// Set points fqdn at the addresses, replacing its previous ones, or
+// removes it if there are none.
+func (r DNSRecords) Set(fqdn string, addrs []string) error {
+	for _, addr := range addrs {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("invalid address %q for %s", addr, fqdn)
+		}
+	}
+	if len(addrs) == 0 {
+		delete(r, fqdn)
+	} else {
+		r[fqdn] = append([]string(nil), addrs...)
+	}
+	return nil
+}
+
+// Hosts renders the records in the format of /etc/hosts, one line per
+// address, sorted by name.
+func (r DNSRecords) Hosts() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		for _, addr := range r[name] {
+			lines = append(lines, addr+" "+name)
+		}
+	}
+	return lines
+}
+
+// DNSName returns the fully qualified name of the record name of the
+// cluster, e.g. "etcd.<cluster name>.kola.internal".
+func (bc *BaseCluster) DNSName(name string) string {
+	return name + "." + bc.name + "." + DNSDomain
+}
+
+// SetDNSRecord points the name, see DNSName, at the addresses, replacing
+// its previous ones, or removes it if there are none. The machines of the
+// cluster resolve the names through /etc/hosts, which is updated on the
+// running machines and written by the userdata of new ones.
+func (bc *BaseCluster) SetDNSRecord(name string, addrs ...string) error {
+	if err := CheckDNSName(name); err != nil {
+		return err
+	}
+
+	bc.dnslock.Lock()
+	defer bc.dnslock.Unlock()
+	if err := bc.dnsRecords.Set(bc.DNSName(name), addrs); err != nil {
+		return err
+	}
+
+	var hosts strings.Builder
+	for _, line := range bc.dnsRecords.Hosts() {
+		hosts.WriteString(line + hostsMarker + "\n")
+	}
+	// keep the entries not managed by kola and replace the file
+	// atomically, resolvers may read it at any time
+	cmd := "sudo sh -c " + shellQuote(fmt.Sprintf(
+		"{ grep -v '%s$' /etc/hosts || true; } > /etc/hosts.kola && printf '%%s' %s >> /etc/hosts.kola && mv /etc/hosts.kola /etc/hosts",
+		hostsMarker, shellQuote(hosts.String())))
+	for _, m := range bc.Machines() {
+		if _, stderr, err := bc.SSH(m, cmd); err != nil {
+			return fmt.Errorf("updating /etc/hosts of %s: %v: %s", m.ID(), err, stderr)
+		}
+	}
+	return nil
+}
+
+// hostsFile returns the /etc/hosts of new machines with the records of the
+// cluster, or "" if there are none.
+func (bc *BaseCluster) hostsFile() string {
+	bc.dnslock.Lock()
+	defer bc.dnslock.Unlock()
+	if len(bc.dnsRecords) == 0 {
+		return ""
+	}
+	hosts := "127.0.0.1 localhost\n::1 localhost\n"
+	for _, line := range bc.dnsRecords.Hosts() {
+		hosts += line + hostsMarker + "\n"
+	}
+	return hosts
+}
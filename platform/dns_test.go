@@ -0,0 +1,65 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckDNSName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"etcd":         true,
+		"member1.etcd": true,
+		"a-b":          true,
+		"":             false,
+		"Etcd":         false,
+		"-etcd":        false,
+		"etcd.":        false,
+		"etcd_1":       false,
+	} {
+		if err := CheckDNSName(name); (err == nil) != valid {
+			t.Errorf("CheckDNSName(%q): got %v", name, err)
+		}
+	}
+}
+
+func TestDNSRecords(t *testing.T) {
+	r := make(DNSRecords)
+	if err := r.Set("b.kola.internal", []string{"10.0.0.3", "fd00::3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("a.kola.internal", []string{"10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("a.kola.internal", []string{"bad"}); err == nil {
+		t.Error("invalid address accepted")
+	}
+	expected := []string{
+		"10.0.0.2 a.kola.internal",
+		"10.0.0.3 b.kola.internal",
+		"fd00::3 b.kola.internal",
+	}
+	if lines := r.Hosts(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %q, expected %q", lines, expected)
+	}
+
+	if err := r.Set("b.kola.internal", nil); err != nil {
+		t.Fatal(err)
+	}
+	if lines := r.Hosts(); !reflect.DeepEqual(lines, expected[:1]) {
+		t.Errorf("after removal got %q", lines)
+	}
+}
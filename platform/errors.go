@@ -0,0 +1,90 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"errors"
+	"net"
+)
+
+// InfraError is an error caused by the infrastructure machines run on,
+// e.g. a failing cloud API, an exhausted quota or a machine that never
+// became reachable over SSH, rather than by the OS under test.
+type InfraError struct {
+	Err error
+}
+
+func (e *InfraError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InfraError) Unwrap() error {
+	return e.Err
+}
+
+// BootError is an error of a machine that was created but did not come up
+// or failed the basic checks, which may be caused by the OS under test
+// unless it wraps an InfraError.
+type BootError struct {
+	Machine string
+	Err     error
+}
+
+func (e *BootError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BootError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is an error rendering the config of a machine, which is a
+// problem of the test rather than of the infrastructure.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// IsInfraError reports whether err is or wraps an InfraError.
+func IsInfraError(err error) bool {
+	var ie *InfraError
+	return errors.As(err, &ie)
+}
+
+// IsBootError reports whether err is or wraps a BootError.
+func IsBootError(err error) bool {
+	var be *BootError
+	return errors.As(err, &be)
+}
+
+// IsConfigError reports whether err is or wraps a ConfigError.
+func IsConfigError(err error) bool {
+	var ce *ConfigError
+	return errors.As(err, &ce)
+}
+
+// IsNetworkError reports whether err is or wraps a network error, e.g. a
+// timeout or a refused connection.
+func IsNetworkError(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne)
+}
@@ -17,12 +17,13 @@ package platform
 
 import (
 	"fmt"
+	"net"
 	"sync"
 
-	"github.com/pborman/uuid"
 	"golang.org/x/crypto/ssh/agent"
 
 	"github.com/flatcar/mantle/network"
+	"github.com/flatcar/mantle/platform/naming"
 )
 
 type BaseFlight struct {
@@ -30,15 +31,37 @@ type BaseFlight struct {
 	clustermap  map[string]Cluster
 
 	name       string
+	namer      *naming.Namer
 	platform   Name
 	ctPlatform string
 	baseopts   *Options
 
 	agent             *network.SSHAgent
 	AdditionalSshKeys *[]agent.Key
+
+	ignitionLock   sync.Mutex
+	ignitionServer *IgnitionServer
+
+	assetLock   sync.Mutex
+	assetServer *AssetServer
+
+	wireGuardLock sync.Mutex
+	wireGuardHost *wireGuardHost
+
+	// the machines get their DNS servers from the platform
+	localResolver bool
 }
 
+// NewBaseFlight creates a BaseFlight which connects to the machines
+// directly or through opts.JumpHost.
 func NewBaseFlight(opts *Options, platform Name, ctPlatform string) (*BaseFlight, error) {
+	if opts.JumpHost != "" {
+		d, err := network.NewJumpDialer(opts.JumpHost, opts.JumpUser, opts.JumpKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to jump host %s: %w", opts.JumpHost, err)
+		}
+		return NewBaseFlightWithDialer(opts, platform, ctPlatform, d)
+	}
 	return NewBaseFlightWithDialer(opts, platform, ctPlatform, network.NewRetryDialer())
 }
 
@@ -48,9 +71,16 @@ func NewBaseFlightWithDialer(opts *Options, platform Name, ctPlatform string, di
 		return nil, err
 	}
 
+	namer := naming.NewNamer(opts.BaseName, naming.MaxLength(string(platform)))
+	name, err := namer.Name()
+	if err != nil {
+		return nil, err
+	}
+
 	bf := &BaseFlight{
 		clustermap: make(map[string]Cluster),
-		name:       fmt.Sprintf("%s-%s", opts.BaseName, uuid.New()),
+		name:       name,
+		namer:      namer,
 		platform:   platform,
 		ctPlatform: ctPlatform,
 		baseopts:   opts,
@@ -68,6 +98,12 @@ func (bf *BaseFlight) Name() string {
 	return bf.name
 }
 
+// Namer returns the Namer used to name the temporary resources of the
+// flight, such as instances, networks, keypairs and buckets.
+func (bf *BaseFlight) Namer() *naming.Namer {
+	return bf.namer
+}
+
 func (bf *BaseFlight) Platform() Name {
 	return bf.platform
 }
@@ -99,16 +135,136 @@ func (bf *BaseFlight) Keys() ([]*agent.Key, error) {
 }
 
 // Destroy destroys each Cluster in the Flight and closes the SSH agent.
+// SetIgnitionServer sets the server for IgnitionDelivery, for platforms
+// where machines can't reach a server started on IgnitionServerAddr.
+func (bf *BaseFlight) SetIgnitionServer(s *IgnitionServer) {
+	bf.ignitionLock.Lock()
+	defer bf.ignitionLock.Unlock()
+	bf.ignitionServer = s
+}
+
+// IgnitionServer returns the server for IgnitionDelivery, starting it on
+// IgnitionServerAddr on first use.
+func (bf *BaseFlight) IgnitionServer() (*IgnitionServer, error) {
+	bf.ignitionLock.Lock()
+	defer bf.ignitionLock.Unlock()
+	if bf.ignitionServer != nil {
+		return bf.ignitionServer, nil
+	}
+	if bf.baseopts.IgnitionServerAddr == "" {
+		return nil, fmt.Errorf("serving Ignition configs on %s needs an Ignition server address", bf.platform)
+	}
+	host, port, err := net.SplitHostPort(bf.baseopts.IgnitionServerAddr)
+	if err != nil {
+		host, port = bf.baseopts.IgnitionServerAddr, "0"
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort("", port))
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewIgnitionServer(l, bf.baseopts.IgnitionDelivery, host)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	plog.Infof("Serving Ignition configs at %s", s.URL())
+	bf.ignitionServer = s
+	return s, nil
+}
+
+// SetAssetServer sets the server for Cluster.ServeAssets, for platforms
+// where machines can't reach a server started on AssetServerAddr.
+func (bf *BaseFlight) SetAssetServer(s *AssetServer) {
+	bf.assetLock.Lock()
+	defer bf.assetLock.Unlock()
+	bf.assetServer = s
+}
+
+// AssetServer returns the server for Cluster.ServeAssets, starting it on
+// AssetServerAddr on first use.
+func (bf *BaseFlight) AssetServer() (*AssetServer, error) {
+	bf.assetLock.Lock()
+	defer bf.assetLock.Unlock()
+	if bf.assetServer != nil {
+		return bf.assetServer, nil
+	}
+	if bf.baseopts.AssetServerAddr == "" {
+		return nil, fmt.Errorf("serving test assets on %s needs an asset server address", bf.platform)
+	}
+	host, port, err := net.SplitHostPort(bf.baseopts.AssetServerAddr)
+	if err != nil {
+		host, port = bf.baseopts.AssetServerAddr, "0"
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort("", port))
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewAssetServer(l, host)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	plog.Infof("Serving test assets at %s", s.URL())
+	bf.assetServer = s
+	return s, nil
+}
+
+// SetLocalResolver tells the clusters that the machines use a DNS server of
+// the platform which forwards to DNSServers, so the userdata doesn't
+// configure them.
+func (bf *BaseFlight) SetLocalResolver() {
+	bf.localResolver = true
+}
+
 func (bf *BaseFlight) Destroy() {
 	for _, c := range bf.Clusters() {
 		c.Destroy()
 	}
 
+	bf.ignitionLock.Lock()
+	if bf.ignitionServer != nil {
+		if err := bf.ignitionServer.Close(); err != nil {
+			plog.Errorf("Error closing Ignition server: %v", err)
+		}
+	}
+	bf.ignitionLock.Unlock()
+
+	bf.assetLock.Lock()
+	if bf.assetServer != nil {
+		if err := bf.assetServer.Close(); err != nil {
+			plog.Errorf("Error closing asset server: %v", err)
+		}
+	}
+	bf.assetLock.Unlock()
+
+	bf.wireGuardLock.Lock()
+	if bf.wireGuardHost != nil {
+		if err := bf.wireGuardHost.Close(); err != nil {
+			plog.Errorf("Error removing WireGuard interface: %v", err)
+		}
+	}
+	bf.wireGuardLock.Unlock()
+
 	if err := bf.agent.Close(); err != nil {
 		plog.Errorf("Error closing agent: %v", err)
 	}
 }
 
+// wireGuard returns the WireGuard interface of the kola host, creating it
+// on first use.
+func (bf *BaseFlight) wireGuard() (*wireGuardHost, error) {
+	bf.wireGuardLock.Lock()
+	defer bf.wireGuardLock.Unlock()
+	if bf.wireGuardHost == nil {
+		h, err := newWireGuardHost(bf.baseopts.WireGuardSubnet)
+		if err != nil {
+			return nil, fmt.Errorf("creating WireGuard interface: %v", err)
+		}
+		bf.wireGuardHost = h
+	}
+	return bf.wireGuardHost, nil
+}
+
 // Options will return the base options for the current
 // flight
 func (bf *BaseFlight) Options() *Options {
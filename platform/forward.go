@@ -0,0 +1,188 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PortForward forwards the TCP connections to a local address to an
+// address reachable from a machine, or the other way round, through an SSH
+// connection to it.
+type PortForward struct {
+	listener net.Listener
+	client   *ssh.Client
+	target   string
+	dial     func() (net.Conn, error)
+
+	lock   sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// ForwardPort forwards connections to local on the host to remote as seen
+// from m, e.g. "localhost:2379" for a service only listening on the
+// loopback interface of m. Both are host:port addresses, an empty host of
+// remote is localhost and an empty local is a free port on the loopback
+// interface of the host, see Addr.
+func ForwardPort(m Machine, local, remote string) (*PortForward, error) {
+	host, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote address %q: %v", remote, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if local == "" {
+		local = "127.0.0.1:0"
+	}
+
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+	listener, err := net.Listen("tcp", local)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	target := net.JoinHostPort(host, port)
+	return newPortForward(listener, client, target, func() (net.Conn, error) {
+		return client.Dial("tcp", target)
+	}), nil
+}
+
+// ForwardRemotePort forwards connections to remote on m to local as seen
+// from the host, e.g. to make a server of kola reachable by the machine
+// without opening firewalls. remote is a host:port address on the loopback
+// interface of m, e.g. "127.0.0.1:5000", see Addr.
+func ForwardRemotePort(m Machine, remote, local string) (*PortForward, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+	listener, err := client.Listen("tcp", remote)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed listening on %s of the machine: %v", remote, err)
+	}
+
+	return newPortForward(listener, client, local, func() (net.Conn, error) {
+		return net.Dial("tcp", local)
+	}), nil
+}
+
+func newPortForward(listener net.Listener, client *ssh.Client, target string, dial func() (net.Conn, error)) *PortForward {
+	f := &PortForward{
+		listener: listener,
+		client:   client,
+		target:   target,
+		dial:     dial,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	f.wg.Add(1)
+	go f.accept()
+	return f
+}
+
+// Addr returns the address connections are forwarded from, on the host
+// for ForwardPort and on the machine for ForwardRemotePort.
+func (f *PortForward) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *PortForward) accept() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !f.track(conn) {
+			conn.Close()
+			return
+		}
+		f.wg.Add(1)
+		go f.forward(conn)
+	}
+}
+
+// track registers conn to be closed by Close, unless the forwarding is
+// already closed.
+func (f *PortForward) track(conn net.Conn) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *PortForward) untrack(conn net.Conn) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.conns, conn)
+}
+
+func (f *PortForward) forward(in net.Conn) {
+	defer f.wg.Done()
+	defer f.untrack(in)
+	defer in.Close()
+
+	out, err := f.dial()
+	if err != nil {
+		plog.Errorf("Forwarding connection to %s: %v", f.target, err)
+		return
+	}
+	defer out.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(out, in)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(in, out)
+		done <- struct{}{}
+	}()
+	// a connection closed by either side ends the forwarding
+	<-done
+}
+
+// Close stops forwarding, closing all forwarded connections and the SSH
+// connection.
+func (f *PortForward) Close() error {
+	f.lock.Lock()
+	f.closed = true
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.lock.Unlock()
+
+	err := f.listener.Close()
+	if cerr := f.client.Close(); err == nil {
+		err = cerr
+	}
+	f.wg.Wait()
+	return err
+}
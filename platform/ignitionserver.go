@@ -0,0 +1,167 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+// IgnitionServer serves rendered Ignition configs over HTTP(S), so machines
+// only get a small pointer config as userdata. This tests the remote config
+// fetching of Ignition and avoids the userdata size limits of the
+// platforms.
+type IgnitionServer struct {
+	listener net.Listener
+	server   *http.Server
+	baseURL  string
+	ca       []byte
+
+	mu      sync.Mutex
+	configs map[string][]byte
+}
+
+// NewIgnitionServer serves configs on l. scheme is "http" or "https", for
+// https a self-signed certificate is generated and trusted by the pointer
+// configs. host is the address machines reach the server at; the port of l
+// is used if host has none.
+func NewIgnitionServer(l net.Listener, scheme, host string) (*IgnitionServer, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		_, port, err := net.SplitHostPort(l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	s := &IgnitionServer{
+		listener: l,
+		baseURL:  fmt.Sprintf("%s://%s", scheme, host),
+		configs:  make(map[string][]byte),
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveConfig)}
+
+	switch scheme {
+	case "http":
+		go s.server.Serve(l)
+	case "https":
+		hostname, _, _ := net.SplitHostPort(host)
+		cert, ca, err := selfSignedCertificate(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("creating certificate: %v", err)
+		}
+		s.ca = ca
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		go s.server.ServeTLS(l, "", "")
+	default:
+		return nil, fmt.Errorf("unsupported Ignition server scheme %q", scheme)
+	}
+
+	return s, nil
+}
+
+// selfSignedCertificate returns a certificate for hostname and its PEM
+// encoding, to be trusted as certificate authority by the machines.
+func selfSignedCertificate(hostname string) (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kola Ignition server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+func (s *IgnitionServer) serveConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.configs[r.URL.Path]
+	s.mu.Unlock()
+	if !ok || (r.Method != "GET" && r.Method != "HEAD") {
+		plog.Warningf("Ignition server: %s %s from %s not found", r.Method, r.URL.Path, r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+	plog.Debugf("Ignition server: serving %s to %s", r.URL.Path, r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// URL returns the base URL of the server.
+func (s *IgnitionServer) URL() string {
+	return s.baseURL
+}
+
+// Serve publishes the config c under a random path and returns a pointer
+// config replacing itself with it.
+func (s *IgnitionServer) Serve(c *conf.Conf) (*conf.Conf, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	path := "/" + hex.EncodeToString(b) + ".ign"
+	data := c.Bytes()
+
+	pointer, err := c.PointerConfig(s.baseURL+path, data, s.ca)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.configs[path] = data
+	s.mu.Unlock()
+	return pointer, nil
+}
+
+// Close stops the server.
+func (s *IgnitionServer) Close() error {
+	return s.server.Close()
+}
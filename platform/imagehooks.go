@@ -0,0 +1,239 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/flatcar/mantle/system/exec"
+	"github.com/flatcar/mantle/util"
+)
+
+// ImageHook is a declarative transformation applied to a disk image before
+// it is booted or uploaded. Exactly one field must be set.
+type ImageHook struct {
+	// Resize grows the image to the given size in bytes, optional
+	// suffixes "K", "M", "G", "T" allowed. The root filesystem is
+	// extended on first boot.
+	Resize string `json:"resize,omitempty"`
+	// Console is the kernel console set in the OEM grub.cfg, e.g.
+	// "ttyS0,115200".
+	Console string `json:"console,omitempty"`
+	// OEMCpio is a cpio archive, optionally gzipped, extracted into the
+	// OEM partition.
+	OEMCpio string `json:"oem_cpio,omitempty"`
+}
+
+// ImageHooks maps platform names to the hooks applied to their images, in
+// order.
+type ImageHooks map[string][]ImageHook
+
+// LoadImageHooks reads image hooks from a JSON file such as:
+//
+//	{
+//	  "azure": [{"resize": "30G"}, {"console": "ttyS0,115200"}],
+//	  "qemu": [{"oem_cpio": "oem.cpio.gz"}]
+//	}
+func LoadImageHooks(path string) (ImageHooks, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks ImageHooks
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for name, list := range hooks {
+		for i, h := range list {
+			if err := h.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: hook %d for %s: %v", path, i, name, err)
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// Validate checks that exactly one transformation is set.
+func (h ImageHook) Validate() error {
+	set := 0
+	for _, v := range []string{h.Resize, h.Console, h.OEMCpio} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of resize, console and oem_cpio must be set")
+	}
+	if h.Resize != "" {
+		if _, err := parseDiskSize(h.Resize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h ImageHook) String() string {
+	switch {
+	case h.Resize != "":
+		return "resize to " + h.Resize
+	case h.Console != "":
+		return "set console " + h.Console
+	default:
+		return "extract " + h.OEMCpio + " into OEM partition"
+	}
+}
+
+// ApplyImageHooks applies hooks in order to the raw Container Linux image
+// at path, modifying it in place. Hooks other than Resize mount the OEM
+// partition and need root privileges.
+func ApplyImageHooks(path string, hooks []ImageHook) error {
+	for _, h := range hooks {
+		if err := h.Validate(); err != nil {
+			return err
+		}
+		plog.Infof("Image hook: %v", h)
+		var err error
+		switch {
+		case h.Resize != "":
+			err = resizeImage(path, h.Resize)
+		case h.Console != "":
+			err = withOEMPartition(path, func(oemdir string) error {
+				return appendGrubConfig(oemdir, fmt.Sprintf("set linux_console=\"console=%s\"\n", h.Console))
+			})
+		case h.OEMCpio != "":
+			err = withOEMPartition(path, func(oemdir string) error {
+				return extractCpio(h.OEMCpio, oemdir)
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("image hook %q: %v", h, err)
+		}
+	}
+	return nil
+}
+
+// PrepareImage copies the image at inputPath to a temporary file in the
+// directory dir and applies hooks to the copy. Images which aren't raw are
+// converted to raw for the hooks and back to their format afterwards. The
+// caller must remove the returned file.
+func PrepareImage(inputPath, dir string, hooks []ImageHook) (string, error) {
+	info, err := util.GetImageInfo(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("getting image info: %v", err)
+	}
+
+	rawPath, err := mkpath(dir)
+	if err != nil {
+		return "", err
+	}
+	if info.Format == "raw" {
+		err = copySparse(inputPath, rawPath)
+	} else {
+		err = convertImage(inputPath, rawPath, "raw")
+	}
+	if err == nil {
+		err = ApplyImageHooks(rawPath, hooks)
+	}
+	if err != nil {
+		os.Remove(rawPath)
+		return "", err
+	}
+	if info.Format == "raw" {
+		return rawPath, nil
+	}
+	defer os.Remove(rawPath)
+
+	outputPath, err := mkpath(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := convertImage(rawPath, outputPath, info.Format); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// MakeDiskTemplate applies the image hooks to a copy of the image like
+// PrepareImage and returns an FD to the copy, which is a deleted file.
+func MakeDiskTemplate(inputPath string, hooks []ImageHook) (*os.File, error) {
+	path, err := PrepareImage(inputPath, "/var/tmp", hooks)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	return os.Open(path)
+}
+
+func resizeImage(path, size string) error {
+	cmd := exec.Command("qemu-img", "resize", "-f", "raw", path, size)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("resizing: %v", err)
+	}
+	return nil
+}
+
+func convertImage(inputPath, outputPath, format string) error {
+	args := []string{"convert", "-O", format}
+	if format == "vpc" {
+		// Azure only accepts fixed size VHDs with the exact size
+		args = append(args, "-o", "subformat=fixed,force_size")
+	}
+	cmd := exec.Command("qemu-img", append(args, inputPath, outputPath)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("converting to %s: %v", format, err)
+	}
+	return nil
+}
+
+// extractCpio extracts the optionally gzipped cpio archive into dir.
+func extractCpio(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	magic, err := br.Peek(2)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", archive, err)
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	cmd := exec.Command("cpio", "--extract", "--make-directories", "--unconditional", "--preserve-modification-time", "--quiet", "-D", dir)
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("extracting %s: %v", archive, err)
+	}
+	return nil
+}
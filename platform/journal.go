@@ -30,15 +30,54 @@ import (
 	"github.com/flatcar/mantle/util"
 )
 
+// JournalSink receives the journal entries of the machines of a cluster
+// while they run, in addition to journal.txt, e.g. to ship them to a log
+// store.
+type JournalSink interface {
+	// Machine returns the formatter the entries of the machine with the
+	// given ID are written to.
+	Machine(id string) (journal.Formatter, error)
+}
+
 // Journal manages recording the journal of a Machine.
 type Journal struct {
 	journal     io.WriteCloser
 	journalRaw  io.WriteCloser
 	journalPath string
 	recorder    *journal.Recorder
+	formatter   *sinkFormatter
 	cancel      context.CancelFunc
 }
 
+// sinkFormatter writes the journal entries to journal.txt and the sinks
+// of the machine.
+type sinkFormatter struct {
+	journal.Formatter
+	sinks    []journal.Formatter
+	attached bool
+}
+
+func (f *sinkFormatter) SetTimezone(tz *time.Location) {
+	f.Formatter.SetTimezone(tz)
+	for _, s := range f.sinks {
+		s.SetTimezone(tz)
+	}
+}
+
+func (f *sinkFormatter) WriteEntry(entry journal.Entry) error {
+	// a broken sink must not stop recording journal.txt, it is dropped
+	sinks := f.sinks[:0]
+	for _, s := range f.sinks {
+		if err := s.WriteEntry(entry); err != nil {
+			plog.Errorf("Dropping journal sink: %v", err)
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+	f.sinks = sinks
+	return f.Formatter.WriteEntry(entry)
+}
+
 // wrapper that also closes the underlying file
 type gzWriteCloser struct {
 	*gzip.Writer
@@ -80,21 +119,35 @@ func NewJournal(dir string) (*Journal, error) {
 		Writer:     jrz,
 	}
 
+	formatter := &sinkFormatter{Formatter: journal.ShortWriter(j)}
 	return &Journal{
 		journal:     j,
 		journalRaw:  jrzc,
-		recorder:    journal.NewRecorder(journal.ShortWriter(j), jrzc),
+		recorder:    journal.NewRecorder(formatter, jrzc),
+		formatter:   formatter,
 		journalPath: p,
 	}, nil
 }
 
-// Start begins/resumes streaming the system journal to journal.txt.
+// Start begins/resumes streaming the system journal to journal.txt and the
+// JournalSinks of the runtime config of m.
 func (j *Journal) Start(ctx context.Context, m Machine) error {
 	if j.cancel != nil {
 		j.cancel()
 		j.cancel = nil
 		j.recorder.Wait() // Just need to consume the status.
 	}
+	if !j.formatter.attached {
+		for _, sink := range m.RuntimeConf().JournalSinks {
+			f, err := sink.Machine(m.ID())
+			if err != nil {
+				plog.Errorf("Journal sink of %s: %v", m.ID(), err)
+				continue
+			}
+			j.formatter.sinks = append(j.formatter.sinks, f)
+		}
+		j.formatter.attached = true
+	}
 	ctx, cancel := context.WithCancel(ctx)
 
 	var lastErr error
@@ -115,7 +168,13 @@ func (j *Journal) Start(ctx context.Context, m Machine) error {
 	rc := m.RuntimeConf()
 	if err := util.WaitUntilReady(rc.SSHTimeout*time.Duration(rc.SSHRetries), rc.SSHTimeout, start); err != nil {
 		cancel()
-		return fmt.Errorf("ssh journalctl failed: %v: %v", err, lastErr)
+		err = fmt.Errorf("ssh journalctl failed: %v: %v", err, lastErr)
+		// a machine unreachable over the network, unlike one refusing
+		// the SSH keys, points at the infrastructure
+		if IsNetworkError(lastErr) {
+			return &InfraError{Err: err}
+		}
+		return err
 	}
 
 	j.cancel = cancel
@@ -0,0 +1,103 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+// KdumpPanicMarker is printed on the console by panicking kernels.
+const KdumpPanicMarker = "Kernel panic - not syncing"
+
+// kdumpFile is the file saved by the crash kernel in each crash directory.
+const kdumpFile = "vmcore-dmesg.txt"
+
+// CollectKdump copies the dmesg of kernel crashes saved by kdump on the
+// running machine m to the kdump directory in dir. It returns the number
+// of crashes found.
+func CollectKdump(m Machine, dir string) (int, error) {
+	out, stderr, err := m.SSH(fmt.Sprintf("sudo find %s -name %s", conf.KdumpDir, kdumpFile))
+	if err != nil {
+		return 0, fmt.Errorf("listing crash dumps: %v: %s", err, stderr)
+	}
+	paths := strings.Fields(string(out))
+	for _, path := range paths {
+		data, stderr, err := m.SSH("sudo cat " + path)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %v: %s", path, err, stderr)
+		}
+		if err := writeKdump(dir, path, data); err != nil {
+			return 0, err
+		}
+	}
+	return len(paths), nil
+}
+
+// CollectKdumpFromDisk copies the dmesg of kernel crashes saved by kdump
+// from the ROOT partition of the disk image of a stopped machine to the
+// kdump directory in dir. The disk image may be in any format qemu-img
+// understands. It returns the number of crashes found.
+func CollectKdumpFromDisk(diskPath, dir string) (int, error) {
+	tmp, err := ioutil.TempFile("", "kola-kdump-")
+	if err != nil {
+		return 0, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := convertImage(diskPath, tmp.Name(), "raw"); err != nil {
+		return 0, err
+	}
+
+	var found int
+	err = withPartition(tmp.Name(), 9, func(rootdir string) error {
+		paths, err := filepath.Glob(filepath.Join(rootdir, conf.KdumpDir, "*", kdumpFile))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(rootdir, path)
+			if err != nil {
+				return err
+			}
+			if err := writeKdump(dir, "/"+rel, data); err != nil {
+				return err
+			}
+			found++
+		}
+		return nil
+	})
+	return found, err
+}
+
+// writeKdump writes the crash dmesg saved at path on the machine to dir
+// as kdump/<crash directory>-vmcore-dmesg.txt.
+func writeKdump(dir, path string, data []byte) error {
+	kdumpDir := filepath.Join(dir, "kdump")
+	if err := os.MkdirAll(kdumpDir, 0777); err != nil {
+		return err
+	}
+	name := filepath.Base(filepath.Dir(path)) + "-" + kdumpFile
+	return ioutil.WriteFile(filepath.Join(kdumpDir, name), data, 0644)
+}
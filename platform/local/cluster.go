@@ -20,8 +20,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
@@ -38,6 +40,13 @@ type LocalCluster struct {
 	*platform.BaseCluster
 	flight      *LocalFlight
 	OmahaServer OmahaWrapper
+
+	dnsLock    sync.Mutex
+	dnsRecords platform.DNSRecords
+
+	// bridges of the isolated networks by name, see NewNetworkTap
+	networksLock sync.Mutex
+	networks     map[string]string
 }
 
 func (lc *LocalCluster) NewCommand(name string, arg ...string) exec.Cmd {
@@ -46,14 +55,7 @@ func (lc *LocalCluster) NewCommand(name string, arg ...string) exec.Cmd {
 }
 
 func (lc *LocalCluster) hostIP() string {
-	// hackydoo
-	bridge := "br0"
-	for _, seg := range lc.flight.Dnsmasq.Segments {
-		if bridge == seg.BridgeName {
-			return seg.BridgeIf.DHCPv4[0].IP.String()
-		}
-	}
-	panic("Not a valid bridge!")
+	return lc.flight.hostIP()
 }
 
 func (lc *LocalCluster) etcdEndpoint() string {
@@ -93,6 +95,39 @@ func (lc *LocalCluster) GetOmahaHostPort() (string, error) {
 	return net.JoinHostPort(lc.hostIP(), port), nil
 }
 
+// ServeFile serves the file at path to the machines of the cluster under
+// name, which must be unique in the cluster, with the Omaha server and
+// returns its URL.
+func (lc *LocalCluster) ServeFile(name, path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	hostport, err := lc.GetOmahaHostPort()
+	if err != nil {
+		return "", err
+	}
+	urlPath := "/files/" + name
+	lc.OmahaServer.Mux.HandleFunc(urlPath, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	})
+	return fmt.Sprintf("http://%s%s", hostport, urlPath), nil
+}
+
+// ServeAssets serves dir to the machines of the cluster with the Omaha
+// server, see Cluster.ServeAssets.
+func (lc *LocalCluster) ServeAssets(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	hostport, err := lc.GetOmahaHostPort()
+	if err != nil {
+		return "", err
+	}
+	urlPath := fmt.Sprintf("/assets/%d", rand.Int())
+	lc.OmahaServer.Mux.Handle(urlPath+"/", http.StripPrefix(urlPath, http.FileServer(http.Dir(dir))))
+	return fmt.Sprintf("http://%s%s", hostport, urlPath), nil
+}
+
 func (lc *LocalCluster) NewTap(bridge string) (*TunTap, error) {
 	nsExit, err := ns.Enter(lc.flight.nshandle)
 	if err != nil {
@@ -130,4 +165,13 @@ func (lc *LocalCluster) GetNsHandle() netns.NsHandle {
 func (lc *LocalCluster) Destroy() {
 	// does not lc.flight.DelCluster() since we are not the top-level object
 	lc.MultiDestructor.Destroy()
+	lc.destroyNetworks()
+
+	lc.dnsLock.Lock()
+	defer lc.dnsLock.Unlock()
+	if lc.dnsRecords != nil {
+		if err := lc.flight.Dnsmasq.ClearDNSRecords(lc.Name()); err != nil {
+			plog.Errorf("Error removing DNS records: %v", err)
+		}
+	}
 }
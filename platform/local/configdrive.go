@@ -15,27 +15,113 @@
 package local
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path"
 
 	"github.com/flatcar/mantle/platform/conf"
 )
 
 // MakeConfigDrive creates a config drive directory tree under outputDir
-// and returns the path to the top level directory.
-func MakeConfigDrive(userdata *conf.Conf, outputDir string) (string, error) {
+// and returns the path to the top level directory. The metadata md is
+// written next to the userdata if it is not nil.
+func MakeConfigDrive(userdata *conf.Conf, md *conf.MetaData, outputDir string) (string, error) {
 	drivePath := path.Join(outputDir, "config-2")
-	userPath := path.Join(drivePath, "openstack/latest/user_data")
+	latest := path.Join(drivePath, "openstack/latest")
 
-	if err := os.MkdirAll(path.Dir(userPath), 0777); err != nil {
+	if err := os.MkdirAll(latest, 0777); err != nil {
 		os.RemoveAll(drivePath)
 		return "", err
 	}
 
-	if err := userdata.WriteFile(userPath); err != nil {
+	if err := userdata.WriteFile(path.Join(latest, "user_data")); err != nil {
 		os.RemoveAll(drivePath)
 		return "", err
 	}
 
+	if md != nil {
+		files := []struct {
+			name string
+			data func() ([]byte, error)
+		}{
+			{"meta_data.json", md.ConfigDriveMetaData},
+			{"network_data.json", md.ConfigDriveNetworkData},
+		}
+		for _, f := range files {
+			if err := writeMetaData(path.Join(latest, f.name), f.data); err != nil {
+				os.RemoveAll(drivePath)
+				return "", err
+			}
+		}
+	}
+
 	return drivePath, nil
 }
+
+// MakeNoCloud creates the files of the cloud-init NoCloud datasource,
+// user-data, meta-data and network-config if md has a network
+// configuration, in a cidata directory under outputDir and returns its
+// path. cloud-init reads them from a file system labeled cidata.
+func MakeNoCloud(userdata *conf.Conf, md *conf.MetaData, outputDir string) (string, error) {
+	seedPath := path.Join(outputDir, "cidata")
+	if err := os.MkdirAll(seedPath, 0777); err != nil {
+		return "", err
+	}
+
+	if err := userdata.WriteFile(path.Join(seedPath, "user-data")); err != nil {
+		os.RemoveAll(seedPath)
+		return "", err
+	}
+	files := []struct {
+		name string
+		data func() ([]byte, error)
+	}{
+		{"meta-data", md.NoCloudMetaData},
+		{"network-config", md.NoCloudNetworkConfig},
+	}
+	for _, f := range files {
+		if err := writeMetaData(path.Join(seedPath, f.name), f.data); err != nil {
+			os.RemoveAll(seedPath)
+			return "", err
+		}
+	}
+
+	return seedPath, nil
+}
+
+// MakeNoCloudISO is like MakeNoCloud but returns the path of an ISO image
+// of the cidata directory, for machines without access to the host file
+// system. It needs genisoimage, mkisofs or xorrisofs.
+func MakeNoCloudISO(userdata *conf.Conf, md *conf.MetaData, outputDir string) (string, error) {
+	seedPath, err := MakeNoCloud(userdata, md, outputDir)
+	if err != nil {
+		return "", err
+	}
+
+	var tool string
+	for _, candidate := range []string{"genisoimage", "mkisofs", "xorrisofs"} {
+		if _, err := exec.LookPath(candidate); err == nil {
+			tool = candidate
+			break
+		}
+	}
+	if tool == "" {
+		return "", fmt.Errorf("creating NoCloud seed: none of genisoimage, mkisofs or xorrisofs found")
+	}
+	iso := path.Join(outputDir, "cidata.iso")
+	out, err := exec.Command(tool, "-quiet", "-output", iso, "-volid", "cidata", "-joliet", "-rock", seedPath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("creating NoCloud seed: %s: %v", out, err)
+	}
+	return iso, nil
+}
+
+// writeMetaData writes the result of data to name, unless it is nil.
+func writeMetaData(name string, data func() ([]byte, error)) error {
+	b, err := data()
+	if err != nil || b == nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
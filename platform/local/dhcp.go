@@ -0,0 +1,211 @@
+// Copyright 2023 The Flatcar Maintainers.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// minLeaseTime is the shortest lease dnsmasq is willing to hand out.
+const minLeaseTime = 2 * time.Minute
+
+// ClasslessRoute is a single entry of the DHCP classless static route
+// option (RFC 3442, option 121).
+type ClasslessRoute struct {
+	Destination net.IPNet
+	Gateway     net.IP
+}
+
+// DHCPOptions holds the scriptable DHCPv4 settings handed out to a single
+// interface in addition to the defaults of the segment.
+type DHCPOptions struct {
+	// MTU is sent as option 26 if non-zero.
+	MTU int
+
+	// ClasslessRoutes are sent as option 121 if not empty.
+	ClasslessRoutes []ClasslessRoute
+
+	// SearchDomains are sent as option 119 if not empty.
+	SearchDomains []string
+
+	// LeaseTime overrides the lease time of the interface if non-zero.
+	// dnsmasq refuses leases shorter than two minutes.
+	LeaseTime time.Duration
+
+	// BootFile is sent as option 67 if set, e.g. the URL of an iPXE
+	// script, see LocalCluster.ServeNetboot.
+	BootFile string
+
+	// Raw holds additional dnsmasq dhcp-option values, e.g.
+	// "option:ntp-server,10.0.0.1".
+	Raw []string
+}
+
+// dhcpLines renders the options as dnsmasq dhcp-option lines restricted
+// to the given tag.
+func (o *DHCPOptions) dhcpLines(tag string) []string {
+	var lines []string
+	if o.MTU != 0 {
+		lines = append(lines, fmt.Sprintf("tag:%s,option:mtu,%d", tag, o.MTU))
+	}
+	if len(o.ClasslessRoutes) > 0 {
+		var routes []string
+		for _, r := range o.ClasslessRoutes {
+			routes = append(routes, r.Destination.String(), r.Gateway.String())
+		}
+		lines = append(lines, fmt.Sprintf("tag:%s,option:classless-static-route,%s", tag, strings.Join(routes, ",")))
+	}
+	if len(o.SearchDomains) > 0 {
+		lines = append(lines, fmt.Sprintf("tag:%s,option:domain-search,%s", tag, strings.Join(o.SearchDomains, ",")))
+	}
+	if o.BootFile != "" {
+		lines = append(lines, fmt.Sprintf("tag:%s,option:bootfile-name,%s", tag, o.BootFile))
+	}
+	for _, raw := range o.Raw {
+		lines = append(lines, fmt.Sprintf("tag:%s,%s", tag, raw))
+	}
+	return lines
+}
+
+func (o *DHCPOptions) validate() error {
+	if o.MTU != 0 && (o.MTU < 68 || o.MTU > 65535) {
+		return fmt.Errorf("invalid MTU %d", o.MTU)
+	}
+	if o.LeaseTime != 0 && o.LeaseTime < minLeaseTime {
+		return fmt.Errorf("lease time %v is shorter than %v", o.LeaseTime, minLeaseTime)
+	}
+	for _, r := range o.ClasslessRoutes {
+		if r.Destination.IP.To4() == nil || r.Gateway.To4() == nil {
+			return fmt.Errorf("classless route %v via %v is not IPv4", r.Destination.String(), r.Gateway)
+		}
+	}
+	return nil
+}
+
+// Tag returns the dnsmasq tag set for all requests of the interface.
+func (i *Interface) Tag() string {
+	return "kola" + strings.ReplaceAll(i.HardwareAddr.String(), ":", "")
+}
+
+// dhcpHost renders the dhcp-host entry of the interface.
+func (i *Interface) dhcpHost(leaseTime time.Duration) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s,set:%s", i.HardwareAddr, i.Tag())
+	for _, addr := range i.DHCPv4 {
+		fmt.Fprintf(&buf, ",%s", addr.IP)
+	}
+	for _, addr := range i.DHCPv6 {
+		fmt.Fprintf(&buf, ",%s", addr.IP)
+	}
+	if leaseTime != 0 {
+		fmt.Fprintf(&buf, ",%d", int(leaseTime.Seconds()))
+	}
+	return buf.String()
+}
+
+// writeDHCPFiles renders the host and option files read by dnsmasq. The
+// caller must hold dm.mu.
+func (dm *Dnsmasq) writeDHCPFiles() error {
+	var hosts, opts bytes.Buffer
+	for _, seg := range dm.Segments {
+		for _, in := range seg.Interfaces {
+			var leaseTime time.Duration
+			if o, ok := dm.dhcpOptions[in.Tag()]; ok {
+				leaseTime = o.LeaseTime
+				for _, line := range o.dhcpLines(in.Tag()) {
+					fmt.Fprintln(&opts, line)
+				}
+			}
+			fmt.Fprintln(&hosts, in.dhcpHost(leaseTime))
+		}
+	}
+
+	if err := writeFileAtomic(dm.hostsFile(), hosts.Bytes()); err != nil {
+		return fmt.Errorf("writing dnsmasq hosts file: %v", err)
+	}
+	if err := writeFileAtomic(dm.optsFile(), opts.Bytes()); err != nil {
+		return fmt.Errorf("writing dnsmasq options file: %v", err)
+	}
+	return nil
+}
+
+func (dm *Dnsmasq) hostsFile() string {
+	return filepath.Join(dm.dir, "hosts")
+}
+
+func (dm *Dnsmasq) optsFile() string {
+	return filepath.Join(dm.dir, "opts")
+}
+
+func (dm *Dnsmasq) tftpDir() string {
+	return filepath.Join(dm.dir, "tftp")
+}
+
+// WriteTFTPFile makes data available on the TFTP server of dnsmasq under
+// name.
+func (dm *Dnsmasq) WriteTFTPFile(name string, data []byte) error {
+	return writeFileAtomic(filepath.Join(dm.tftpDir(), name), data)
+}
+
+// SetDHCPOptions changes the DHCP options handed out to the interface. The
+// options take effect for new leases immediately; already booted machines
+// only pick them up once they renew or rebind their lease.
+func (dm *Dnsmasq) SetDHCPOptions(in *Interface, opts DHCPOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.dhcpOptions[in.Tag()] = opts
+	return dm.reload()
+}
+
+// ClearDHCPOptions restores the default DHCP options of the interface.
+func (dm *Dnsmasq) ClearDHCPOptions(in *Interface) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	delete(dm.dhcpOptions, in.Tag())
+	return dm.reload()
+}
+
+// reload rewrites the DHCP files and tells dnsmasq to read them again. The
+// caller must hold dm.mu.
+func (dm *Dnsmasq) reload() error {
+	if err := dm.writeDHCPFiles(); err != nil {
+		return err
+	}
+	if err := dm.dnsmasq.Process.Signal(syscall.SIGHUP); err != nil {
+		return fmt.Errorf("reloading dnsmasq: %v", err)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
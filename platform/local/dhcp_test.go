@@ -0,0 +1,61 @@
+// Copyright 2023 The Flatcar Maintainers.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDHCPOptions(t *testing.T) {
+	in := newInterface(0, 2)
+
+	t.Run("Host", func(t *testing.T) {
+		assert.Equal(t, "02:00:00:00:00:02,set:kola020000000002,10.0.0.2,fd00::2", in.dhcpHost(0))
+		assert.Equal(t, "02:00:00:00:00:02,set:kola020000000002,10.0.0.2,fd00::2,300", in.dhcpHost(5*time.Minute))
+	})
+	t.Run("Lines", func(t *testing.T) {
+		opts := DHCPOptions{
+			MTU: 1400,
+			ClasslessRoutes: []ClasslessRoute{{
+				Destination: net.IPNet{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(24, 32)},
+				Gateway:     net.IP{10, 0, 0, 1},
+			}},
+			SearchDomains: []string{"example.com", "example.org"},
+			BootFile:      "tftp://10.0.0.1/boot.ipxe",
+			Raw:           []string{"option:ntp-server,10.0.0.1"},
+		}
+		require.Nil(t, opts.validate())
+		assert.Equal(t, []string{
+			"tag:kola020000000002,option:mtu,1400",
+			"tag:kola020000000002,option:classless-static-route,192.168.0.0/24,10.0.0.1",
+			"tag:kola020000000002,option:domain-search,example.com,example.org",
+			"tag:kola020000000002,option:bootfile-name,tftp://10.0.0.1/boot.ipxe",
+			"tag:kola020000000002,option:ntp-server,10.0.0.1",
+		}, opts.dhcpLines(in.Tag()))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		assert.NotNil(t, (&DHCPOptions{MTU: 10}).validate())
+		assert.NotNil(t, (&DHCPOptions{LeaseTime: time.Minute}).validate())
+		assert.NotNil(t, (&DHCPOptions{ClasslessRoutes: []ClasslessRoute{{
+			Destination: net.IPNet{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)},
+			Gateway:     net.ParseIP("fd00::1"),
+		}}}).validate())
+	})
+}
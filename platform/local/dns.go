@@ -0,0 +1,75 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+func (dm *Dnsmasq) dnsHostsDir() string {
+	return filepath.Join(dm.dir, "dns")
+}
+
+// SetDNSRecords replaces the names served by dnsmasq for the cluster.
+// dnsmasq notices the change of its hosts directory by itself.
+func (dm *Dnsmasq) SetDNSRecords(cluster string, records platform.DNSRecords) error {
+	var buf bytes.Buffer
+	for _, line := range records.Hosts() {
+		fmt.Fprintln(&buf, line)
+	}
+	// dnsmasq ignores dotfiles, so the file only changes once complete
+	path := filepath.Join(dm.dnsHostsDir(), cluster)
+	tmp := filepath.Join(dm.dnsHostsDir(), "."+cluster)
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing DNS records: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing DNS records: %v", err)
+	}
+	return nil
+}
+
+// ClearDNSRecords removes the names served by dnsmasq for the cluster.
+func (dm *Dnsmasq) ClearDNSRecords(cluster string) error {
+	err := os.Remove(filepath.Join(dm.dnsHostsDir(), cluster))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetDNSRecord points the name, see DNSName, at the addresses, replacing
+// its previous ones, or removes it if there are none. The machines
+// resolve the names of all clusters of the flight with dnsmasq.
+func (lc *LocalCluster) SetDNSRecord(name string, addrs ...string) error {
+	if err := platform.CheckDNSName(name); err != nil {
+		return err
+	}
+
+	lc.dnsLock.Lock()
+	defer lc.dnsLock.Unlock()
+	if lc.dnsRecords == nil {
+		lc.dnsRecords = make(platform.DNSRecords)
+	}
+	if err := lc.dnsRecords.Set(lc.DNSName(name), addrs); err != nil {
+		return err
+	}
+	return lc.flight.Dnsmasq.SetDNSRecords(lc.Name(), lc.dnsRecords)
+}
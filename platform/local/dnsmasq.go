@@ -20,8 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/coreos/go-iptables/iptables"
@@ -29,6 +31,7 @@ import (
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
 
+	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/system/exec"
 	"github.com/flatcar/mantle/system/ns"
 	"github.com/flatcar/mantle/util"
@@ -48,7 +51,10 @@ type Interface struct {
 	HardwareAddr net.HardwareAddr
 	DHCPv4       []net.IPNet
 	DHCPv6       []net.IPNet
-	//SLAAC net.IPAddr
+	// SLAAC is the address the machine configures from the router
+	// advertisements in the prefix of DHCPv6, networkd derives it
+	// from the MAC address (EUI-64).
+	SLAAC net.IPNet
 }
 
 type Segment struct {
@@ -66,6 +72,16 @@ type Segment struct {
 type Dnsmasq struct {
 	Segments []*Segment
 	dnsmasq  *exec.ExecCmd
+
+	// DNSServers are the servers dnsmasq forwards the queries of the
+	// machines to.
+	DNSServers []string
+
+	// dir holds the host and option files that can be changed at
+	// runtime, see SetDHCPOptions and SetDNSRecords.
+	dir         string
+	mu          sync.Mutex
+	dhcpOptions map[string]DHCPOptions
 }
 
 const (
@@ -89,10 +105,19 @@ leasefile-ro
 log-facility=-
 pid-file=
 
-# hardcode DNS servers to avoid using systemd-resolved on the unreachable 127.0.0.53
-dhcp-option=6,1.1.1.1,1.0.0.1,8.8.8.8
+# the machines resolve through dnsmasq (0.0.0.0 is special), which serves
+# the names of the clusters and forwards the others to explicit servers,
+# avoiding systemd-resolved on the unreachable 127.0.0.53
+dhcp-option=6,0.0.0.0
 no-resolv
 no-hosts
+{{range .DNSServers}}
+server={{.}}
+{{end}}
+
+# cluster names, see SetDNSRecords, reloaded on changes
+local=/{{.DNSDomain}}/
+hostsdir={{.DNSHostsDir}}
 
 enable-ra
 
@@ -111,19 +136,25 @@ dhcp-range={{.IP}},static
 dhcp-range={{.IP}},ra-names,slaac
 {{end}}
 
-{{range .Interfaces}}
-dhcp-host={{.HardwareAddr}}{{template "ips" .DHCPv4}}{{template "ips" .DHCPv6}}
-{{end}}
 {{end}}
 
-{{define "ips"}}{{range .}}{{printf ",%s" .IP}}{{end}}{{end}}
+# per-interface hosts and options, reloaded on SIGHUP
+dhcp-hostsfile={{.HostsFile}}
+dhcp-optsfile={{.OptsFile}}
+
+# iPXE scripts of netbooted machines, see WriteTFTPFile
+enable-tftp
+tftp-root={{.TFTPDir}}
 `
 )
 
+// defaultDNSServers are used without Options.DNSServers.
+var defaultDNSServers = []string{"1.1.1.1", "1.0.0.1", "8.8.8.8"}
+
 var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/local")
 
 func newInterface(s byte, i uint16) *Interface {
-	return &Interface{
+	in := &Interface{
 		HardwareAddr: net.HardwareAddr{0x02, s, 0, 0, byte(i / 256), byte(i % 256)},
 		DHCPv4: []net.IPNet{{
 			IP:   net.IP{10, s, byte(i / 256), byte(i % 256)},
@@ -132,6 +163,23 @@ func newInterface(s byte, i uint16) *Interface {
 			IP:   net.IP{0xfd, s, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(i / 256), byte(i % 256)},
 			Mask: net.CIDRMask(64, 128)}},
 	}
+	in.SLAAC = net.IPNet{
+		IP:   eui64(in.DHCPv6[0].IP, in.HardwareAddr),
+		Mask: net.CIDRMask(64, 128),
+	}
+	return in
+}
+
+// eui64 returns the address in the /64 prefix of ip with the modified
+// EUI-64 interface identifier of mac.
+func eui64(ip net.IP, mac net.HardwareAddr) net.IP {
+	addr := make(net.IP, net.IPv6len)
+	copy(addr, ip.To16()[:8])
+	addr[8] = mac[0] ^ 0x02
+	addr[9], addr[10] = mac[1], mac[2]
+	addr[11], addr[12] = 0xff, 0xfe
+	addr[13], addr[14], addr[15] = mac[3], mac[4], mac[5]
+	return addr
 }
 
 // configureNAT creates and append a NAT rule
@@ -427,8 +475,16 @@ func newSegment(s byte) (*Segment, error) {
 	return seg, nil
 }
 
-func NewDnsmasq() (*Dnsmasq, error) {
-	dm := &Dnsmasq{}
+// NewDnsmasq sets up the machine network and starts dnsmasq, forwarding
+// DNS queries to dnsServers, or to public resolvers if there are none.
+func NewDnsmasq(dnsServers []string) (*Dnsmasq, error) {
+	if len(dnsServers) == 0 {
+		dnsServers = defaultDNSServers
+	}
+	dm := &Dnsmasq{
+		DNSServers:  dnsServers,
+		dhcpOptions: make(map[string]DHCPOptions),
+	}
 	for s := byte(0); s < numSegments; s++ {
 		seg, err := newSegment(s)
 		if err != nil {
@@ -437,6 +493,24 @@ func NewDnsmasq() (*Dnsmasq, error) {
 		dm.Segments = append(dm.Segments, seg)
 	}
 
+	dir, err := os.MkdirTemp("", "kola-dnsmasq-")
+	if err != nil {
+		return nil, fmt.Errorf("creating dnsmasq directory failed: %v", err)
+	}
+	dm.dir = dir
+	if err := os.Mkdir(dm.tftpDir(), 0755); err != nil {
+		os.RemoveAll(dm.dir)
+		return nil, fmt.Errorf("creating TFTP directory failed: %v", err)
+	}
+	if err := os.Mkdir(dm.dnsHostsDir(), 0755); err != nil {
+		os.RemoveAll(dm.dir)
+		return nil, fmt.Errorf("creating DNS hosts directory failed: %v", err)
+	}
+	if err := dm.writeDHCPFiles(); err != nil {
+		os.RemoveAll(dm.dir)
+		return nil, err
+	}
+
 	// setup lo
 	lo, err := netlink.LinkByName("lo")
 	if err != nil {
@@ -476,7 +550,14 @@ func NewDnsmasq() (*Dnsmasq, error) {
 			template.New("dnsmasq").Parse(quietConfig + commonConfig))
 	}
 
-	if err = configTemplate.Execute(cfg, dm); err != nil {
+	if err = configTemplate.Execute(cfg, struct {
+		*Dnsmasq
+		HostsFile   string
+		OptsFile    string
+		TFTPDir     string
+		DNSDomain   string
+		DNSHostsDir string
+	}{dm, dm.hostsFile(), dm.optsFile(), dm.tftpDir(), platform.DNSDomain, dm.dnsHostsDir()}); err != nil {
 		cfg.Close()
 		dm.Destroy()
 		return nil, err
@@ -510,4 +591,8 @@ func (dm *Dnsmasq) Destroy() {
 			plog.Errorf("unable to close segment listener: %v", err)
 		}
 	}
+
+	if err := os.RemoveAll(dm.dir); err != nil {
+		plog.Errorf("Error removing dnsmasq directory: %v", err)
+	}
 }
@@ -61,3 +61,8 @@ func TestGenerateVethPair(t *testing.T) {
 		assert.ErrorIs(t, err, ErrIncorrectSeed)
 	})
 }
+
+func TestInterfaceSLAAC(t *testing.T) {
+	in := newInterface(2, 0x1234)
+	assert.Equal(t, "fd02::2:ff:fe00:1234", in.SLAAC.IP.String())
+}
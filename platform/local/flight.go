@@ -17,6 +17,7 @@ package local
 
 import (
 	"fmt"
+	"net"
 	"sync/atomic"
 
 	"github.com/coreos/go-omaha/omaha"
@@ -41,6 +42,10 @@ type LocalFlight struct {
 	NTPServer  *ntp.Server
 	nshandle   netns.NsHandle
 	listenPort int32
+
+	// counters for the isolated networks of the clusters
+	networkCounter      uint32
+	hardwareAddrCounter uint32
 }
 
 func NewLocalFlight(opts *platform.Options, platformName platform.Name) (*LocalFlight, error) {
@@ -72,12 +77,13 @@ func NewLocalFlight(opts *platform.Options, platformName platform.Name) (*LocalF
 	}
 	defer nsExit()
 
-	lf.Dnsmasq, err = NewDnsmasq()
+	lf.Dnsmasq, err = NewDnsmasq(opts.DNSServers)
 	if err != nil {
 		lf.Destroy()
 		return nil, fmt.Errorf("creating new dnsmasq failed: %v", err)
 	}
 	lf.AddDestructor(lf.Dnsmasq)
+	lf.SetLocalResolver()
 
 	lf.SimpleEtcd, err = NewSimpleEtcd()
 	if err != nil {
@@ -86,6 +92,21 @@ func NewLocalFlight(opts *platform.Options, platformName platform.Name) (*LocalF
 	}
 	lf.AddDestructor(lf.SimpleEtcd)
 
+	if opts.IgnitionDelivery != "" {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			lf.Destroy()
+			return nil, fmt.Errorf("listening for Ignition server failed: %v", err)
+		}
+		s, err := platform.NewIgnitionServer(l, opts.IgnitionDelivery, lf.hostIP())
+		if err != nil {
+			l.Close()
+			lf.Destroy()
+			return nil, fmt.Errorf("creating Ignition server failed: %v", err)
+		}
+		lf.SetIgnitionServer(s)
+	}
+
 	lf.NTPServer, err = ntp.NewServer(":123")
 	if err != nil {
 		lf.Destroy()
@@ -132,6 +153,17 @@ func (lf *LocalFlight) NewCluster(rconf *platform.RuntimeConfig) (*LocalCluster,
 	return lc, nil
 }
 
+func (lf *LocalFlight) hostIP() string {
+	// hackydoo
+	bridge := "br0"
+	for _, seg := range lf.Dnsmasq.Segments {
+		if bridge == seg.BridgeName {
+			return seg.BridgeIf.DHCPv4[0].IP.String()
+		}
+	}
+	panic("Not a valid bridge!")
+}
+
 func (lf *LocalFlight) newListenPort() int {
 	return int(atomic.AddInt32(&lf.listenPort, 1))
 }
@@ -0,0 +1,71 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// ServeNetboot makes the machine with the interface in boot nb over the
+// network: DHCP points its iPXE firmware to a script on the TFTP server of
+// dnsmasq, which loads the kernel and initrd over HTTP and boots with the
+// Ignition config at configPath given on the kernel command line. name
+// must be unique in the cluster, dhcp holds further DHCP options of the
+// interface.
+func (lc *LocalCluster) ServeNetboot(name string, in *Interface, nb platform.Netboot, configPath string, dhcp DHCPOptions) error {
+	kernelURL, err := lc.ServeFile(name+"/"+filepath.Base(nb.Kernel), nb.Kernel)
+	if err != nil {
+		return fmt.Errorf("serving kernel: %v", err)
+	}
+	initrdURL, err := lc.ServeFile(name+"/"+filepath.Base(nb.Initrd), nb.Initrd)
+	if err != nil {
+		return fmt.Errorf("serving initrd: %v", err)
+	}
+	configURL, err := lc.ServeFile(name+"/"+filepath.Base(configPath), configPath)
+	if err != nil {
+		return fmt.Errorf("serving Ignition config: %v", err)
+	}
+
+	script := ipxeScript(kernelURL, initrdURL, configURL, nb.Cmdline)
+	if err := lc.flight.Dnsmasq.WriteTFTPFile(name+".ipxe", []byte(script)); err != nil {
+		return fmt.Errorf("writing iPXE script: %v", err)
+	}
+	dhcp.BootFile = fmt.Sprintf("tftp://%s/%s.ipxe", lc.hostIP(), name)
+	return lc.flight.Dnsmasq.SetDHCPOptions(in, dhcp)
+}
+
+// ipxeScript renders the iPXE script booting the PXE images with the
+// Ignition config at configURL.
+func ipxeScript(kernelURL, initrdURL, configURL, cmdline string) string {
+	args := []string{
+		// the initrd argument is required by UEFI firmware
+		"initrd=" + filepath.Base(initrdURL),
+		"flatcar.first_boot=1",
+		"ignition.config.url=" + configURL,
+		"console=ttyS0,115200n8",
+	}
+	if cmdline != "" {
+		args = append(args, cmdline)
+	}
+	return fmt.Sprintf(`#!ipxe
+kernel %s %s
+initrd %s
+boot
+`, kernelURL, strings.Join(args, " "), initrdURL)
+}
@@ -0,0 +1,34 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPXEScript(t *testing.T) {
+	script := ipxeScript(
+		"http://10.0.0.1:8080/files/m/flatcar_production_pxe.vmlinuz",
+		"http://10.0.0.1:8080/files/m/flatcar_production_pxe_image.cpio.gz",
+		"http://10.0.0.1:8080/files/m/ignition.json",
+		"systemd.log_level=debug")
+	assert.Equal(t, `#!ipxe
+kernel http://10.0.0.1:8080/files/m/flatcar_production_pxe.vmlinuz initrd=flatcar_production_pxe_image.cpio.gz flatcar.first_boot=1 ignition.config.url=http://10.0.0.1:8080/files/m/ignition.json console=ttyS0,115200n8 systemd.log_level=debug
+initrd http://10.0.0.1:8080/files/m/flatcar_production_pxe_image.cpio.gz
+boot
+`, script)
+}
@@ -0,0 +1,112 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/flatcar/mantle/system/ns"
+)
+
+// NewNetworkTap returns a tap attached to the isolated network name of
+// the cluster and a hardware address for the interface of the machine
+// using it. The network is an L2 bridge without DHCP or a route to the
+// host, created when first used and removed with the cluster.
+func (lc *LocalCluster) NewNetworkTap(name string) (*TunTap, net.HardwareAddr, error) {
+	bridge, err := lc.network(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	tap, err := lc.NewTap(bridge)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tap, lc.flight.newHardwareAddr(), nil
+}
+
+// network returns the bridge of the isolated network name, creating it
+// if needed.
+func (lc *LocalCluster) network(name string) (string, error) {
+	lc.networksLock.Lock()
+	defer lc.networksLock.Unlock()
+
+	if bridge, ok := lc.networks[name]; ok {
+		return bridge, nil
+	}
+
+	nsExit, err := ns.Enter(lc.flight.nshandle)
+	if err != nil {
+		return "", err
+	}
+	defer nsExit()
+
+	br := &netlink.Bridge{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: fmt.Sprintf("kbr%d", atomic.AddUint32(&lc.flight.networkCounter, 1)),
+		},
+	}
+	if err := netlink.LinkAdd(br); err != nil {
+		return "", fmt.Errorf("creating bridge for network %q failed: %v", name, err)
+	}
+	if err := netlink.LinkSetUp(br); err != nil {
+		netlink.LinkDel(br)
+		return "", fmt.Errorf("bridge up for network %q failed: %v", name, err)
+	}
+
+	if lc.networks == nil {
+		lc.networks = make(map[string]string)
+	}
+	lc.networks[name] = br.Name
+	return br.Name, nil
+}
+
+// destroyNetworks removes the bridges of the isolated networks.
+func (lc *LocalCluster) destroyNetworks() {
+	lc.networksLock.Lock()
+	defer lc.networksLock.Unlock()
+
+	if len(lc.networks) == 0 {
+		return
+	}
+
+	nsExit, err := ns.Enter(lc.flight.nshandle)
+	if err != nil {
+		plog.Errorf("Error removing networks: %v", err)
+		return
+	}
+	defer nsExit()
+
+	for name, bridge := range lc.networks {
+		link, err := netlink.LinkByName(bridge)
+		if err == nil {
+			err = netlink.LinkDel(link)
+		}
+		if err != nil {
+			plog.Errorf("Error removing network %q: %v", name, err)
+		}
+	}
+	lc.networks = nil
+}
+
+// newHardwareAddr returns a locally administered hardware address unique
+// in the flight, outside of the range of the dnsmasq interfaces.
+func (lf *LocalFlight) newHardwareAddr() net.HardwareAddr {
+	n := atomic.AddUint32(&lf.hardwareAddrCounter, 1)
+	return net.HardwareAddr{0x02, 0xfe, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+}
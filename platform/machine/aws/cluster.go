@@ -19,12 +19,14 @@ import (
 	"path/filepath"
 
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/aws"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
 type cluster struct {
 	*platform.BaseCluster
 	flight *flight
+	api    *aws.API
 }
 
 func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
@@ -40,7 +42,7 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 	if !ac.RuntimeConf().NoSSHKeyInMetadata {
 		keyname = ac.flight.Name()
 	}
-	instances, err := ac.flight.api.CreateInstances(ac.Name(), keyname, conf.String(), 1)
+	instances, err := ac.api.CreateInstances(ac.Name(), keyname, conf.String(), 1, ac.RuntimeConf().RequireIMDSv2, ac.RuntimeConf().GPU, ac.RuntimeConf().Tags)
 	if err != nil {
 		return nil, err
 	}
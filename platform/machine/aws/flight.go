@@ -16,6 +16,8 @@
 package aws
 
 import (
+	"sync"
+
 	"github.com/coreos/pkg/capnslog"
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
 
@@ -33,8 +35,12 @@ var (
 
 type flight struct {
 	*platform.BaseFlight
-	api      *aws.API
-	keyAdded bool
+	// apis holds an API per account, see aws.Options.Profiles.
+	apis      []*aws.API
+	keysAdded int
+
+	mu   sync.Mutex
+	next int
 }
 
 // NewFlight creates an instance of a Flight suitable for spawning
@@ -43,10 +49,23 @@ type flight struct {
 // NewFlight will consume the environment variables $AWS_REGION,
 // $AWS_ACCESS_KEY_ID, and $AWS_SECRET_ACCESS_KEY to determine the region to
 // spawn instances in and the credentials to use to authenticate.
+//
+// If opts.Profiles is set, the clusters are created round-robin in the
+// accounts of these profiles.
 func NewFlight(opts *aws.Options) (platform.Flight, error) {
-	api, err := aws.New(opts)
-	if err != nil {
-		return nil, err
+	profiles := opts.Profiles
+	if len(profiles) == 0 {
+		profiles = []string{opts.Profile}
+	}
+	var apis []*aws.API
+	for _, profile := range profiles {
+		o := *opts
+		o.Profile = profile
+		api, err := aws.New(&o)
+		if err != nil {
+			return nil, err
+		}
+		apis = append(apis, api)
 	}
 
 	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.EC2)
@@ -56,7 +75,7 @@ func NewFlight(opts *aws.Options) (platform.Flight, error) {
 
 	af := &flight{
 		BaseFlight: bf,
-		api:        api,
+		apis:       apis,
 	}
 
 	keys, err := af.Keys()
@@ -64,15 +83,26 @@ func NewFlight(opts *aws.Options) (platform.Flight, error) {
 		af.Destroy()
 		return nil, err
 	}
-	if err := api.AddKey(af.Name(), keys[0].String()); err != nil {
-		af.Destroy()
-		return nil, err
+	for _, api := range apis {
+		if err := api.AddKey(af.Name(), keys[0].String()); err != nil {
+			af.Destroy()
+			return nil, err
+		}
+		af.keysAdded++
 	}
-	af.keyAdded = true
 
 	return af, nil
 }
 
+// nextAPI returns the API of the account for the next cluster.
+func (af *flight) nextAPI() *aws.API {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+	api := af.apis[af.next%len(af.apis)]
+	af.next++
+	return api
+}
+
 // NewCluster creates an instance of a Cluster suitable for spawning
 // instances on Amazon Web Services' Elastic Compute platform.
 func (af *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
@@ -84,6 +114,7 @@ func (af *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, e
 	ac := &cluster{
 		BaseCluster: bc,
 		flight:      af,
+		api:         af.nextAPI(),
 	}
 
 	af.AddCluster(ac)
@@ -92,11 +123,23 @@ func (af *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, e
 }
 
 func (af *flight) Destroy() {
-	if af.keyAdded {
-		if err := af.api.DeleteKey(af.Name()); err != nil {
+	for _, api := range af.apis[:af.keysAdded] {
+		if err := api.DeleteKey(af.Name()); err != nil {
 			plog.Errorf("Error deleting key %v: %v", af.Name(), err)
 		}
 	}
 
 	af.BaseFlight.Destroy()
 }
+
+// CheckQuota implements platform.QuotaChecker. The machines are spread
+// evenly across the accounts.
+func (af *flight) CheckQuota(machines int) error {
+	perAccount := (machines + len(af.apis) - 1) / len(af.apis)
+	for _, api := range af.apis {
+		if err := api.CheckQuota(perAccount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
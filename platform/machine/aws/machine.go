@@ -21,6 +21,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"golang.org/x/crypto/ssh"
 
@@ -48,6 +49,16 @@ func (am *machine) PrivateIP() string {
 	return *am.mach.PrivateIpAddress
 }
 
+func (am *machine) IPv6() string {
+	return aws.StringValue(am.mach.Ipv6Address)
+}
+
+// PrivateIPv6 returns the same address as IPv6, VPC IPv6 addresses are
+// global.
+func (am *machine) PrivateIPv6() string {
+	return am.IPv6()
+}
+
 func (am *machine) RuntimeConf() platform.RuntimeConfig {
 	return am.cluster.RuntimeConf()
 }
@@ -64,17 +75,33 @@ func (am *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return am.cluster.SSH(am, cmd)
 }
 
+func (am *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(am, local, remote)
+}
+
 func (am *machine) Reboot() error {
 	return platform.RebootMachine(am, am.journal)
 }
 
+// Interrupted implements platform.InterruptibleMachine.
+func (am *machine) Interrupted() string {
+	if aws.StringValue(am.mach.InstanceLifecycle) != ec2.InstanceLifecycleTypeSpot {
+		return ""
+	}
+	reason, err := am.cluster.api.SpotInterruption(am.ID())
+	if err != nil {
+		plog.Warningf("Error checking spot interruption of %v: %v", am.ID(), err)
+	}
+	return reason
+}
+
 func (am *machine) Destroy() {
-	origConsole, err := am.cluster.flight.api.GetConsoleOutput(am.ID())
+	origConsole, err := am.cluster.api.GetConsoleOutput(am.ID())
 	if err != nil {
 		plog.Warningf("Error retrieving console log for %v: %v", am.ID(), err)
 	}
 
-	if err := am.cluster.flight.api.TerminateInstances([]string{am.ID()}); err != nil {
+	if err := am.cluster.api.TerminateInstances([]string{am.ID()}); err != nil {
 		plog.Errorf("Error terminating instance %v: %v", am.ID(), err)
 	}
 
@@ -100,7 +127,7 @@ func (am *machine) saveConsole(origConsole string) error {
 	// logs are different from the pre-termination logs.
 	err := util.WaitUntilReady(30*time.Second, 10*time.Second, func() (bool, error) {
 		var err error
-		am.console, err = am.cluster.flight.api.GetConsoleOutput(am.ID())
+		am.console, err = am.cluster.api.GetConsoleOutput(am.ID())
 		if err != nil {
 			return false, err
 		}
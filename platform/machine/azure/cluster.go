@@ -15,8 +15,6 @@
 package azure
 
 import (
-	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
 
@@ -34,10 +32,19 @@ type cluster struct {
 	Network        azure.Network
 }
 
-func (ac *cluster) vmname() string {
-	b := make([]byte, 5)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", ac.Name()[0:13], b)
+// securityType returns the Azure security type for new machines. Tests
+// requiring a security type override the one given on the command line; a
+// Confidential VM also provides everything a Trusted Launch VM does.
+func (ac *cluster) securityType() string {
+	rconf := ac.RuntimeConf()
+	securityType := ac.flight.Api.Opts.SecurityType
+	switch {
+	case rconf.ConfidentialVM:
+		securityType = azure.SecurityTypeConfidentialVM
+	case rconf.TrustedLaunch && securityType == "":
+		securityType = azure.SecurityTypeTrustedLaunch
+	}
+	return securityType
 }
 
 func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
@@ -48,7 +55,12 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	instance, err := ac.flight.Api.CreateInstance(ac.vmname(), conf.String(), ac.sshKey, ac.ResourceGroup, ac.StorageAccount, ac.Network)
+	name, err := ac.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := ac.flight.Api.CreateInstance(name, conf.String(), ac.sshKey, ac.ResourceGroup, ac.StorageAccount, ac.securityType(), ac.RuntimeConf().GPU, ac.Network)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +76,11 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
+	if err := mach.streamConsole(); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
 	confPath := filepath.Join(mach.dir, "user-data")
 	if err := conf.WriteFile(confPath); err != nil {
 		mach.Destroy()
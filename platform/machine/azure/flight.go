@@ -16,6 +16,7 @@ package azure
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
@@ -84,7 +85,7 @@ func NewFlight(opts *azure.Options) (platform.Flight, error) {
 		blobName := imageName + ".vhd"
 		container := "temp"
 
-		af.ImageResourceGroup, err = af.Api.CreateResourceGroup("kola-cluster-image")
+		af.ImageResourceGroup, err = af.Api.CreateResourceGroup("kola-cluster-image", nil)
 		if err != nil {
 			return nil, err
 		}
@@ -119,8 +120,16 @@ func NewFlight(opts *azure.Options) (platform.Flight, error) {
 				break
 			}
 		} else if opts.ImageFile != "" {
+			imageFile := opts.ImageFile
+			if len(opts.ImageHooks) > 0 {
+				imageFile, err = platform.PrepareImage(opts.ImageFile, "/var/tmp", opts.ImageHooks)
+				if err != nil {
+					return nil, fmt.Errorf("applying image hooks failed: %v", err)
+				}
+				defer os.Remove(imageFile)
+			}
 			for _, k := range *kr.Keys {
-				if err := af.Api.UploadBlob(af.ImageStorageAccount, *k.Value, opts.ImageFile, container, blobName, true); err != nil {
+				if err := af.Api.UploadBlob(af.ImageStorageAccount, *k.Value, imageFile, container, blobName, true); err != nil {
 					return nil, fmt.Errorf("Uploading blob failed: %v", err)
 				}
 				break
@@ -177,7 +186,7 @@ func (af *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, e
 		ac.StorageAccount = af.ImageStorageAccount
 		ac.Network = af.Network
 	} else {
-		ac.ResourceGroup, err = af.Api.CreateResourceGroup("kola-cluster")
+		ac.ResourceGroup, err = af.Api.CreateResourceGroup("kola-cluster", rconf.Tags)
 		if err != nil {
 			return nil, err
 		}
@@ -208,3 +217,8 @@ func (af *flight) Destroy() {
 		}
 	}
 }
+
+// CheckQuota implements platform.QuotaChecker.
+func (af *flight) CheckQuota(machines int) error {
+	return af.Api.CheckQuota(machines)
+}
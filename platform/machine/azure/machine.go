@@ -16,7 +16,6 @@ package azure
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
@@ -30,7 +29,7 @@ type machine struct {
 	mach    *azure.Machine
 	dir     string
 	journal *platform.Journal
-	console []byte
+	console *platform.ConsoleStream
 }
 
 func (am *machine) ID() string {
@@ -45,6 +44,15 @@ func (am *machine) PrivateIP() string {
 	return am.mach.PrivateIPAddress
 }
 
+// IPv6 returns an empty string, the NICs only have an IPv4 configuration.
+func (am *machine) IPv6() string {
+	return ""
+}
+
+func (am *machine) PrivateIPv6() string {
+	return ""
+}
+
 func (am *machine) RuntimeConf() platform.RuntimeConfig {
 	return am.cluster.RuntimeConf()
 }
@@ -73,6 +81,10 @@ func (am *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return am.cluster.SSH(am, cmd)
 }
 
+func (am *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(am, local, remote)
+}
+
 func (am *machine) Reboot() error {
 	err := platform.RebootMachine(am, am.journal)
 	if err != nil {
@@ -88,9 +100,11 @@ func (am *machine) Reboot() error {
 }
 
 func (am *machine) Destroy() {
-	if err := am.saveConsole(); err != nil {
-		// log error, but do not fail to terminate instance
-		plog.Warningf("Saving console for instance %v: %v", am.ID(), err)
+	if am.console != nil {
+		if err := am.console.Close(); err != nil {
+			// log error, but do not fail to terminate instance
+			plog.Warningf("Saving console for instance %v: %v", am.ID(), err)
+		}
 	}
 
 	if err := am.cluster.flight.Api.TerminateInstance(am.mach, am.ResourceGroup()); err != nil {
@@ -105,28 +119,33 @@ func (am *machine) Destroy() {
 }
 
 func (am *machine) ConsoleOutput() string {
-	return string(am.console)
-}
-
-func (am *machine) saveConsole() error {
-	var err error
-	am.console, err = am.cluster.flight.Api.GetConsoleOutput(am.ID(), am.ResourceGroup(), am.cluster.StorageAccount)
-	if err != nil {
-		return err
-	}
-
-	path := filepath.Join(am.dir, "console.txt")
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return err
+	if am.console == nil {
+		return ""
 	}
-	defer f.Close()
-	_, err = f.Write(am.console)
-	if err != nil {
-		return fmt.Errorf("failed writing console to file: %v", err)
+	return am.console.Output()
+}
+
+// streamConsole starts recording the serial console to console.txt. Boot
+// diagnostics only provide the whole log, so each poll records the part
+// not seen before.
+func (am *machine) streamConsole() error {
+	var seen int
+	fetch := func() ([]byte, error) {
+		data, err := am.cluster.flight.Api.PollConsoleOutput(am.ID(), am.ResourceGroup(), am.cluster.StorageAccount)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < seen {
+			return nil, fmt.Errorf("console log shrank from %d to %d bytes", seen, len(data))
+		}
+		data = data[seen:]
+		seen += len(data)
+		return data, nil
 	}
 
-	return nil
+	var err error
+	am.console, err = platform.NewConsoleStream(filepath.Join(am.dir, "console.txt"), platform.ConsoleStreamInterval, fetch)
+	return err
 }
 
 func (am *machine) JournalOutput() string {
@@ -16,12 +16,12 @@ package do
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/do"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -40,7 +40,12 @@ func (dc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	droplet, err := dc.flight.api.CreateDroplet(context.TODO(), dc.vmname(), dc.sshKeyID, conf.String())
+	name, err := dc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	droplet, err := dc.flight.api.CreateDroplet(context.TODO(), name, dc.sshKeyID, conf.String(), do.Tags(dc.RuntimeConf().Tags)...)
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +64,8 @@ func (dc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		mach.Destroy()
 		return nil, fmt.Errorf("couldn't get private IP address for droplet: %v", err)
 	}
+	// not every region supports IPv6
+	mach.publicIPv6, _ = droplet.PublicIPv6()
 
 	dir := filepath.Join(dc.RuntimeConf().OutputDir, mach.ID())
 	if err := os.Mkdir(dir, 0777); err != nil {
@@ -87,12 +94,6 @@ func (dc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 	return mach, nil
 }
 
-func (dc *cluster) vmname() string {
-	b := make([]byte, 5)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", dc.Name()[0:13], b)
-}
-
 func (dc *cluster) Destroy() {
 	dc.BaseCluster.Destroy()
 	dc.flight.DelCluster(dc)
@@ -25,11 +25,12 @@ import (
 )
 
 type machine struct {
-	cluster   *cluster
-	droplet   *godo.Droplet
-	journal   *platform.Journal
-	publicIP  string
-	privateIP string
+	cluster    *cluster
+	droplet    *godo.Droplet
+	journal    *platform.Journal
+	publicIP   string
+	privateIP  string
+	publicIPv6 string
 }
 
 func (dm *machine) ID() string {
@@ -37,6 +38,9 @@ func (dm *machine) ID() string {
 }
 
 func (dm *machine) IP() string {
+	if dm.cluster.flight.api.UsePrivateIPs() {
+		return dm.privateIP
+	}
 	return dm.publicIP
 }
 
@@ -44,6 +48,15 @@ func (dm *machine) PrivateIP() string {
 	return dm.privateIP
 }
 
+func (dm *machine) IPv6() string {
+	return dm.publicIPv6
+}
+
+// PrivateIPv6 returns the public IPv6 address, VPCs are IPv4 only.
+func (dm *machine) PrivateIPv6() string {
+	return dm.publicIPv6
+}
+
 func (dm *machine) RuntimeConf() platform.RuntimeConfig {
 	return dm.cluster.RuntimeConf()
 }
@@ -60,6 +73,10 @@ func (dm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return dm.cluster.SSH(dm, cmd)
 }
 
+func (dm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(dm, local, remote)
+}
+
 func (dm *machine) Reboot() error {
 	return platform.RebootMachine(dm, dm.journal)
 }
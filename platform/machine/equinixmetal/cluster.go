@@ -15,7 +15,6 @@
 package equinixmetal
 
 import (
-	"crypto/rand"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -42,7 +41,10 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	vmname := pc.vmname()
+	vmname, err := pc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
 	// Stream the console somewhere temporary until we have a machine ID
 	consolePath := filepath.Join(pc.RuntimeConf().OutputDir, "console-"+vmname+".txt")
 	var cons *console
@@ -97,6 +99,7 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		}
 		mach.publicIP = pc.flight.api.GetDeviceAddress(device, 4, true)
 		mach.privateIP = pc.flight.api.GetDeviceAddress(device, 4, false)
+		mach.publicIPv6 = pc.flight.api.GetDeviceAddress(device, 6, true)
 		if mach.publicIP == "" || mach.privateIP == "" {
 			pc.flight.api.DeleteDevice(mach.ID())
 			err = fmt.Errorf("couldn't find IP addresses for device")
@@ -135,6 +138,10 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 			continue // provisioning error
 		}
 
+		if pc.flight.spot {
+			mach.watchSpotReclaim()
+		}
+
 		pc.AddMach(mach)
 
 		return mach, nil
@@ -144,12 +151,6 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 	return nil, err
 }
 
-func (pc *cluster) vmname() string {
-	b := make([]byte, 5)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", pc.Name()[0:13], b)
-}
-
 func (pc *cluster) Destroy() {
 	pc.BaseCluster.Destroy()
 	pc.flight.DelCluster(pc)
@@ -39,6 +39,9 @@ type flight struct {
 	// to be recycled by EM in order to minimize the
 	// number of created devices.
 	devicesPool chan string
+	// spot is set if the devices are spot instances which can be
+	// reclaimed during the test
+	spot bool
 }
 
 func NewFlight(opts *equinixmetal.Options) (platform.Flight, error) {
@@ -56,6 +59,7 @@ func NewFlight(opts *equinixmetal.Options) (platform.Flight, error) {
 		BaseFlight:  bf,
 		api:         api,
 		devicesPool: make(chan string, 1000),
+		spot:        opts.SpotInstance,
 	}
 
 	keys, err := pf.Keys()
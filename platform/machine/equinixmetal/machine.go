@@ -15,7 +15,10 @@
 package equinixmetal
 
 import (
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -24,12 +27,79 @@ import (
 )
 
 type machine struct {
-	cluster   *cluster
-	device    *packngo.Device
-	journal   *platform.Journal
-	console   *console
-	publicIP  string
-	privateIP string
+	cluster    *cluster
+	device     *packngo.Device
+	journal    *platform.Journal
+	console    *console
+	publicIP   string
+	privateIP  string
+	publicIPv6 string
+
+	// set for spot instances, see watchSpotReclaim
+	stopWatch     chan struct{}
+	reclaimedLock sync.Mutex
+	reclaimedAt   *time.Time
+}
+
+const spotPollInterval = time.Minute
+
+// watchSpotReclaim polls the termination time of the spot instance until
+// the machine is destroyed, so that a failing test can be attributed to
+// the spot market reclaiming the device.
+func (pm *machine) watchSpotReclaim() {
+	pm.stopWatch = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(spotPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pm.stopWatch:
+				return
+			case <-ticker.C:
+			}
+
+			t, err := pm.cluster.flight.api.SpotTerminationTime(pm.ID())
+			if err != nil {
+				plog.Debugf("checking spot termination of %s: %v", pm.ID(), err)
+				continue
+			}
+			if t != nil {
+				plog.Warningf("Spot instance %s is reclaimed at %v, test failures may be caused by it", pm.ID(), t)
+				pm.reclaimedLock.Lock()
+				pm.reclaimedAt = t
+				pm.reclaimedLock.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// Interrupted implements platform.InterruptibleMachine.
+func (pm *machine) Interrupted() string {
+	if !pm.cluster.flight.spot {
+		return ""
+	}
+	pm.reclaimedLock.Lock()
+	defer pm.reclaimedLock.Unlock()
+	if pm.reclaimedAt == nil {
+		// the watcher polls only once a minute
+		t, err := pm.cluster.flight.api.SpotTerminationTime(pm.ID())
+		if err != nil {
+			plog.Warningf("Error checking spot termination of %v: %v", pm.ID(), err)
+			return ""
+		}
+		pm.reclaimedAt = t
+	}
+	if pm.reclaimedAt == nil {
+		return ""
+	}
+	return fmt.Sprintf("spot instance %s reclaimed at %v", pm.ID(), pm.reclaimedAt)
+}
+
+func (pm *machine) reclaimed() bool {
+	pm.reclaimedLock.Lock()
+	defer pm.reclaimedLock.Unlock()
+	return pm.reclaimedAt != nil
 }
 
 func (pm *machine) ID() string {
@@ -44,6 +114,16 @@ func (pm *machine) PrivateIP() string {
 	return pm.privateIP
 }
 
+func (pm *machine) IPv6() string {
+	return pm.publicIPv6
+}
+
+// PrivateIPv6 returns the public IPv6 address, devices have no private
+// one.
+func (pm *machine) PrivateIPv6() string {
+	return pm.publicIPv6
+}
+
 func (pm *machine) RuntimeConf() platform.RuntimeConfig {
 	return pm.cluster.RuntimeConf()
 }
@@ -60,17 +140,33 @@ func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return pm.cluster.SSH(pm, cmd)
 }
 
+func (pm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(pm, local, remote)
+}
+
 func (pm *machine) Reboot() error {
 	return platform.RebootMachine(pm, pm.journal)
 }
 
 func (pm *machine) Destroy() {
+	if pm.stopWatch != nil {
+		close(pm.stopWatch)
+	}
+
 	// Instead of actually deleting the device.
 	// We add it to the devices pool in order to mark it
 	// as "ready to be used" by other tests.
+	// A reclaimed spot instance can't be reused.
 	id := pm.ID()
-	pm.cluster.flight.devicesPool <- id
-	plog.Infof("device %s added to the pool", id)
+	if pm.reclaimed() {
+		plog.Warningf("not recycling reclaimed spot instance %s", id)
+		if err := pm.cluster.flight.api.DeleteDevice(id); err != nil {
+			plog.Debugf("deleting reclaimed device %s: %v", id, err)
+		}
+	} else {
+		pm.cluster.flight.devicesPool <- id
+		plog.Infof("device %s added to the pool", id)
+	}
 
 	// The serial console SSH client needs to be manually closed in order to prevent program from
 	// freezing on `done` channel in the `Output()` console's method.
@@ -16,7 +16,6 @@ package esx
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
 
@@ -30,12 +29,6 @@ type cluster struct {
 	flight *flight
 }
 
-func (ec *cluster) vmname() string {
-	b := make([]byte, 5)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", ec.Name(), b)
-}
-
 func (ec *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
 	conf, err := ec.RenderUserData(userdata, map[string]string{
 		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
@@ -96,7 +89,12 @@ ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=$(ip addr show ens1
 ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 `, false)
 
-	instance, err := ec.flight.api.CreateDevice(ec.vmname(), conf, ipPairMaybe)
+	name, err := ec.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := ec.flight.api.CreateDevice(name, conf, ipPairMaybe)
 	if err != nil {
 		if ipPairMaybe != nil {
 			plog.Debugf("Setting static IP addresses %v and %v as available", (*ipPairMaybe).Public, (*ipPairMaybe).Private)
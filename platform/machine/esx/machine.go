@@ -46,6 +46,15 @@ func (em *machine) PrivateIP() string {
 	return em.mach.IPAddress
 }
 
+// IPv6 returns an empty string, IPv6 addresses are not collected on ESX.
+func (em *machine) IPv6() string {
+	return ""
+}
+
+func (em *machine) PrivateIPv6() string {
+	return ""
+}
+
 func (em *machine) RuntimeConf() platform.RuntimeConfig {
 	return em.cluster.RuntimeConf()
 }
@@ -62,6 +71,10 @@ func (em *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return em.cluster.SSH(em, cmd)
 }
 
+func (em *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(em, local, remote)
+}
+
 func (em *machine) Reboot() error {
 	return platform.RebootMachine(em, em.journal)
 }
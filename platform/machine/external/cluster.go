@@ -33,7 +33,7 @@ type cluster struct {
 }
 
 func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
-	conf, err := pc.RenderUserData(userdata, map[string]string{
+	conf, err := pc.RenderUnservedUserData(userdata, map[string]string{
 		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
 		"$private_ipv4": "${COREOS_CUSTOM_PRIVATE_IPV4}",
 	})
@@ -54,6 +54,10 @@ ExecStart=/usr/bin/mkdir --parent /run/metadata
 ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=$(ip addr show $(ip route get 1 | head -n 1 | cut -d ' ' -f 5) | grep -m 1 -Po "inet \K[\d.]+")\nCOREOS_CUSTOM_PUBLIC_IPV4=$(ip addr show $(ip route get 1 | head -n 1 | cut -d ' ' -f 5) | grep -m 1 -Po "inet \K[\d.]+")" > ${OUTPUT}'
 ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 `, false)
+	conf, err = pc.ServeUserData(conf)
+	if err != nil {
+		return nil, err
+	}
 
 	var cons *console
 	var pcons Console // need a nil interface value if unused
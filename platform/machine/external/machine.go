@@ -40,6 +40,15 @@ func (pm *machine) PrivateIP() string {
 	return pm.ipAddr
 }
 
+// IPv6 returns an empty string, only the address of the machine given to kola is known.
+func (pm *machine) IPv6() string {
+	return ""
+}
+
+func (pm *machine) PrivateIPv6() string {
+	return ""
+}
+
 func (pm *machine) RuntimeConf() platform.RuntimeConfig {
 	return pm.cluster.RuntimeConf()
 }
@@ -56,6 +65,10 @@ func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return pm.cluster.SSH(pm, cmd)
 }
 
+func (pm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(pm, local, remote)
+}
+
 func (pm *machine) Reboot() error {
 	return platform.RebootMachine(pm, pm.journal)
 }
@@ -29,6 +29,7 @@ import (
 type cluster struct {
 	*platform.BaseCluster
 	flight *flight
+	api    *gcloud.API
 }
 
 // Calling in parallel is ok
@@ -49,18 +50,26 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		}
 	}
 
-	instance, err := gc.flight.api.CreateInstance(conf.String(), keys)
+	name, err := gc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := gc.api.CreateInstance(name, conf.String(), keys, gc.RuntimeConf().TrustedLaunch, gc.RuntimeConf().ConfidentialVM, gc.RuntimeConf().GPU, gc.RuntimeConf().Tags)
 	if err != nil {
 		return nil, err
 	}
 
 	intip, extip := gcloud.InstanceIPs(instance)
+	intipv6, extipv6 := gcloud.InstanceIPv6s(instance)
 
 	gm := &machine{
-		gc:    gc,
-		name:  instance.Name,
-		intIP: intip,
-		extIP: extip,
+		gc:      gc,
+		name:    instance.Name,
+		intIP:   intip,
+		extIP:   extip,
+		intIPv6: intipv6,
+		extIPv6: extipv6,
 	}
 
 	gm.dir = filepath.Join(gc.RuntimeConf().OutputDir, gm.ID())
@@ -69,6 +78,11 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
+	if err := gm.streamConsole(); err != nil {
+		gm.Destroy()
+		return nil, err
+	}
+
 	confPath := filepath.Join(gm.dir, "user-data")
 	if err := conf.WriteFile(confPath); err != nil {
 		gm.Destroy()
@@ -17,6 +17,9 @@
 package gcloud
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/coreos/pkg/capnslog"
 
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
@@ -26,7 +29,11 @@ import (
 
 type flight struct {
 	*platform.BaseFlight
-	api *gcloud.API
+	// apis holds an API per project, see gcloud.Options.Projects.
+	apis []*gcloud.API
+
+	mu   sync.Mutex
+	next int
 }
 
 const (
@@ -37,10 +44,26 @@ var (
 	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/gcloud")
 )
 
+// NewFlight creates an instance of a Flight suitable for spawning
+// instances on Google Compute Engine. If opts.Projects is set, the
+// clusters are created round-robin in these projects.
 func NewFlight(opts *gcloud.Options) (platform.Flight, error) {
-	api, err := gcloud.New(opts)
-	if err != nil {
-		return nil, err
+	projects := opts.Projects
+	if len(projects) == 0 {
+		projects = []string{opts.Project}
+	}
+	var apis []*gcloud.API
+	for _, project := range projects {
+		o := *opts
+		o.Project = project
+		if p, keyFile, ok := strings.Cut(project, "="); ok {
+			o.Project, o.JSONKeyFile = p, keyFile
+		}
+		api, err := gcloud.New(&o)
+		if err != nil {
+			return nil, err
+		}
+		apis = append(apis, api)
 	}
 
 	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.GCE)
@@ -50,12 +73,21 @@ func NewFlight(opts *gcloud.Options) (platform.Flight, error) {
 
 	gf := &flight{
 		BaseFlight: bf,
-		api:        api,
+		apis:       apis,
 	}
 
 	return gf, nil
 }
 
+// nextAPI returns the API of the project for the next cluster.
+func (gf *flight) nextAPI() *gcloud.API {
+	gf.mu.Lock()
+	defer gf.mu.Unlock()
+	api := gf.apis[gf.next%len(gf.apis)]
+	gf.next++
+	return api
+}
+
 func (gf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
 	bc, err := platform.NewBaseCluster(gf.BaseFlight, rconf)
 	if err != nil {
@@ -65,9 +97,22 @@ func (gf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, e
 	gc := &cluster{
 		BaseCluster: bc,
 		flight:      gf,
+		api:         gf.nextAPI(),
 	}
 
 	gf.AddCluster(gc)
 
 	return gc, nil
 }
+
+// CheckQuota implements platform.QuotaChecker. The machines are spread
+// evenly across the projects.
+func (gf *flight) CheckQuota(machines int) error {
+	perProject := (machines + len(gf.apis) - 1) / len(gf.apis)
+	for _, api := range gf.apis {
+		if err := api.CheckQuota(perProject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -15,7 +15,6 @@
 package gcloud
 
 import (
-	"os"
 	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
@@ -28,9 +27,11 @@ type machine struct {
 	name    string
 	intIP   string
 	extIP   string
+	intIPv6 string
+	extIPv6 string
 	dir     string
 	journal *platform.Journal
-	console string
+	console *platform.ConsoleStream
 }
 
 func (gm *machine) ID() string {
@@ -45,6 +46,19 @@ func (gm *machine) PrivateIP() string {
 	return gm.intIP
 }
 
+func (gm *machine) IPv6() string {
+	return gm.extIPv6
+}
+
+// PrivateIPv6 returns the internal IPv6 address, or the external one in
+// subnets with external IPv6 access only.
+func (gm *machine) PrivateIPv6() string {
+	if gm.intIPv6 != "" {
+		return gm.intIPv6
+	}
+	return gm.extIPv6
+}
+
 func (gm *machine) RuntimeConf() platform.RuntimeConfig {
 	return gm.gc.RuntimeConf()
 }
@@ -61,16 +75,22 @@ func (gm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return gm.gc.SSH(gm, cmd)
 }
 
+func (gm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(gm, local, remote)
+}
+
 func (gm *machine) Reboot() error {
 	return platform.RebootMachine(gm, gm.journal)
 }
 
 func (gm *machine) Destroy() {
-	if err := gm.saveConsole(); err != nil {
-		plog.Errorf("Error saving console for instance %v: %v", gm.ID(), err)
+	if gm.console != nil {
+		if err := gm.console.Close(); err != nil {
+			plog.Errorf("Error saving console for instance %v: %v", gm.ID(), err)
+		}
 	}
 
-	if err := gm.gc.flight.api.TerminateInstance(gm.name); err != nil {
+	if err := gm.gc.api.TerminateInstance(gm.name); err != nil {
 		plog.Errorf("Error terminating instance %v: %v", gm.ID(), err)
 	}
 
@@ -82,25 +102,28 @@ func (gm *machine) Destroy() {
 }
 
 func (gm *machine) ConsoleOutput() string {
-	return gm.console
-}
-
-func (gm *machine) saveConsole() error {
-	var err error
-	gm.console, err = gm.gc.flight.api.GetConsoleOutput(gm.name)
-	if err != nil {
-		return err
+	if gm.console == nil {
+		return ""
 	}
+	return gm.console.Output()
+}
 
-	path := filepath.Join(gm.dir, "console.txt")
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return err
+// streamConsole starts recording the serial console to console.txt,
+// paging through the output with the offsets returned by GCE.
+func (gm *machine) streamConsole() error {
+	var next int64
+	fetch := func() ([]byte, error) {
+		out, n, err := gm.gc.api.GetConsoleOutputFrom(gm.name, next)
+		if err != nil {
+			return nil, err
+		}
+		next = n
+		return []byte(out), nil
 	}
-	defer f.Close()
-	f.WriteString(gm.console)
 
-	return nil
+	var err error
+	gm.console, err = platform.NewConsoleStream(filepath.Join(gm.dir, "console.txt"), platform.ConsoleStreamInterval, fetch)
+	return err
 }
 
 func (gm *machine) JournalOutput() string {
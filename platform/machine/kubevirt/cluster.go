@@ -0,0 +1,87 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubevirt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+}
+
+func (kc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := kc.RenderUserData(userdata, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := kc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(kc.RuntimeConf().OutputDir, name)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	vmi, err := kc.flight.api.CreateVMI(ctx, name, kc.Name(), conf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster: kc,
+		vmi:     vmi,
+		dir:     dir,
+	}
+
+	if err := kc.flight.api.WaitForIP(ctx, vmi, 10*time.Minute); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	kc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (kc *cluster) Destroy() {
+	kc.BaseCluster.Destroy()
+	kc.flight.DelCluster(kc)
+}
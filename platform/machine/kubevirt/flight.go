@@ -0,0 +1,71 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubevirt
+
+import (
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/kubevirt"
+)
+
+const (
+	Platform platform.Name = "kubevirt"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/kubevirt")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api *kubevirt.API
+}
+
+func NewFlight(opts *kubevirt.Options) (platform.Flight, error) {
+	api, err := kubevirt.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	kf := &flight{
+		BaseFlight: bf,
+		api:        api,
+	}
+
+	return kf, nil
+}
+
+func (kf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(kf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	kc := &cluster{
+		BaseCluster: bc,
+		flight:      kf,
+	}
+
+	kf.AddCluster(kc)
+
+	return kc, nil
+}
@@ -0,0 +1,127 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubevirt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/kubevirt"
+)
+
+type machine struct {
+	cluster *cluster
+	vmi     *kubevirt.VMI
+	dir     string
+	journal *platform.Journal
+	console string
+}
+
+func (kvm *machine) ID() string {
+	return kvm.vmi.Name
+}
+
+func (kvm *machine) IP() string {
+	return kvm.vmi.IP
+}
+
+func (kvm *machine) PrivateIP() string {
+	return kvm.vmi.IP
+}
+
+func (kvm *machine) IPv6() string {
+	return kvm.vmi.IPv6
+}
+
+func (kvm *machine) PrivateIPv6() string {
+	return kvm.vmi.IPv6
+}
+
+func (kvm *machine) RuntimeConf() platform.RuntimeConfig {
+	return kvm.cluster.RuntimeConf()
+}
+
+func (kvm *machine) SSHClient() (*ssh.Client, error) {
+	return kvm.cluster.SSHClient(kvm.IP())
+}
+
+func (kvm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return kvm.cluster.PasswordSSHClient(kvm.IP(), user, password)
+}
+
+func (kvm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return kvm.cluster.SSH(kvm, cmd)
+}
+
+func (kvm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(kvm, local, remote)
+}
+
+func (kvm *machine) Reboot() error {
+	return platform.RebootMachine(kvm, kvm.journal)
+}
+
+func (kvm *machine) Destroy() {
+	ctx := context.TODO()
+
+	// the console log is removed along with the VMI
+	if err := kvm.saveConsole(ctx); err != nil {
+		plog.Errorf("Error saving console for VMI %v: %v", kvm.ID(), err)
+	}
+
+	if err := kvm.cluster.flight.api.DeleteVMI(ctx, kvm.vmi.Name); err != nil {
+		plog.Errorf("Error deleting VMI %v: %v", kvm.ID(), err)
+	}
+
+	if kvm.journal != nil {
+		kvm.journal.Destroy()
+	}
+
+	kvm.cluster.DelMach(kvm)
+}
+
+func (kvm *machine) saveConsole(ctx context.Context) error {
+	var err error
+	kvm.console, err = kvm.cluster.flight.api.ConsoleOutput(ctx, kvm.vmi)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(kvm.dir, "console.txt"), []byte(kvm.console), 0666)
+}
+
+func (kvm *machine) ConsoleOutput() string {
+	return kvm.console
+}
+
+func (kvm *machine) JournalOutput() string {
+	if kvm.journal == nil {
+		return ""
+	}
+
+	data, err := kvm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for VMI %v: %v", kvm.ID(), err)
+	}
+	return string(data)
+}
+
+func (kvm *machine) Board() string {
+	return kvm.cluster.flight.Options().Board
+}
@@ -15,8 +15,6 @@
 package openstack
 
 import (
-	"crypto/rand"
-	"fmt"
 	"os"
 	"path/filepath"
 
@@ -42,7 +40,12 @@ func (oc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 	if !oc.RuntimeConf().NoSSHKeyInMetadata {
 		keyname = oc.flight.Name()
 	}
-	instance, err := oc.flight.api.CreateServer(oc.vmname(), keyname, conf.String())
+	name, err := oc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := oc.flight.api.CreateServer(name, keyname, conf.String(), oc.RuntimeConf().ConfigDrive)
 	if err != nil {
 		return nil, err
 	}
@@ -79,12 +82,6 @@ func (oc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 	return mach, nil
 }
 
-func (oc *cluster) vmname() string {
-	b := make([]byte, 5)
-	rand.Read(b)
-	return fmt.Sprintf("%s-%x", oc.Name()[0:13], b)
-}
-
 func (oc *cluster) Destroy() {
 	oc.BaseCluster.Destroy()
 	oc.flight.DelCluster(oc)
@@ -43,42 +43,33 @@ func (om *machine) IP() string {
 	}
 
 	// we try to get the IPv4 address.
-	for _, addrs := range om.mach.Server.Addresses {
-		addrs, ok := addrs.([]interface{})
-		if !ok {
-			continue
-		}
-
-		for _, addr := range addrs {
-			a, ok := addr.(map[string]interface{})
-			if !ok {
-				continue
-			}
+	return om.fixedIP(4)
+}
 
-			iptype, ok := a["OS-EXT-IPS:type"].(string)
-			if !ok || iptype != "fixed" {
-				continue
-			}
+func (om *machine) PrivateIP() string {
+	if ip := om.fixedIP(4); ip != "" {
+		return ip
+	}
+	return om.IP()
+}
 
-			version, ok := a["version"].(float64)
-			if !ok || version != 4 {
-				continue
-			}
+// IPv6 returns the fixed IPv6 address, floating IPs are IPv4 only.
+func (om *machine) IPv6() string {
+	return om.fixedIP(6)
+}
 
-			if ip, ok := a["addr"].(string); ok {
-				return ip
-			}
-		}
-	}
-	return ""
+func (om *machine) PrivateIPv6() string {
+	return om.fixedIP(6)
 }
 
-func (om *machine) PrivateIP() string {
+// fixedIP returns the first fixed address of the IP version of the server.
+func (om *machine) fixedIP(version float64) string {
 	for _, addrs := range om.mach.Server.Addresses {
 		addrs, ok := addrs.([]interface{})
 		if !ok {
 			continue
 		}
+
 		for _, addr := range addrs {
 			a, ok := addr.(map[string]interface{})
 			if !ok {
@@ -90,8 +81,8 @@ func (om *machine) PrivateIP() string {
 				continue
 			}
 
-			version, ok := a["version"].(float64)
-			if !ok || version != 4 {
+			v, ok := a["version"].(float64)
+			if !ok || v != version {
 				continue
 			}
 
@@ -100,7 +91,7 @@ func (om *machine) PrivateIP() string {
 			}
 		}
 	}
-	return om.IP()
+	return ""
 }
 
 func (om *machine) RuntimeConf() platform.RuntimeConfig {
@@ -119,6 +110,10 @@ func (om *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return om.cluster.SSH(om, cmd)
 }
 
+func (om *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(om, local, remote)
+}
+
 func (om *machine) Reboot() error {
 	return platform.RebootMachine(om, om.journal)
 }
@@ -0,0 +1,114 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/plugin"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+}
+
+func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := pc.RenderUserData(userdata, pc.flight.ignitionVars)
+	if err != nil {
+		return nil, err
+	}
+
+	var sshKeys []string
+	if !pc.RuntimeConf().NoSSHKeyInMetadata {
+		keys, err := pc.Keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			sshKeys = append(sshKeys, key.String())
+		}
+	}
+
+	name, err := pc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(pc.RuntimeConf().OutputDir, name)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+	if err := pc.flight.client.Chown(dir); err != nil {
+		return nil, err
+	}
+
+	m, err := pc.flight.client.CreateMachine(plugin.CreateMachineRequest{
+		Name:      name,
+		UserData:  conf.String(),
+		SSHKeys:   sshKeys,
+		OutputDir: dir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating machine: %v", err)
+	}
+
+	mach := &machine{
+		cluster:  pc,
+		id:       m.ID,
+		ip:       m.PublicIP,
+		privIP:   m.PrivateIP,
+		ipv6:     m.PublicIPv6,
+		privIPv6: m.PrivateIPv6,
+	}
+	if mach.privIP == "" {
+		mach.privIP = mach.ip
+	}
+	if mach.privIPv6 == "" {
+		mach.privIPv6 = mach.ipv6
+	}
+	if mach.ip == "" {
+		mach.Destroy()
+		return nil, fmt.Errorf("plugin returned no IP address for machine %s", m.ID)
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	pc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (pc *cluster) Destroy() {
+	pc.BaseCluster.Destroy()
+	pc.flight.DelCluster(pc)
+}
@@ -0,0 +1,106 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/plugin"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/plugin")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	client       *plugin.Client
+	ignitionVars map[string]string
+}
+
+// NewFlight starts the plugin implementing the platform opts.Name.
+func NewFlight(opts *plugin.Options) (platform.Flight, error) {
+	path := opts.Path
+	if path == "" {
+		var err error
+		path, err = plugin.Lookup(opts.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sandbox *plugin.Sandbox
+	if opts.Sandbox {
+		sandbox = &plugin.Sandbox{User: opts.SandboxUser}
+	}
+	client, err := plugin.Start(path, sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Init(plugin.InitRequest{
+		Platform: opts.Name,
+		Board:    opts.Board,
+		Options:  opts.PluginOptions,
+	})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	ctPlatform := res.CTPlatform
+	if ctPlatform == "" {
+		ctPlatform = ctplatform.Custom
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, platform.Name(opts.Name), ctPlatform)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &flight{
+		BaseFlight:   bf,
+		client:       client,
+		ignitionVars: res.IgnitionVars,
+	}, nil
+}
+
+func (pf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(pf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &cluster{
+		BaseCluster: bc,
+		flight:      pf,
+	}
+
+	pf.AddCluster(pc)
+
+	return pc, nil
+}
+
+func (pf *flight) Destroy() {
+	pf.BaseFlight.Destroy()
+
+	if err := pf.client.Cleanup(); err != nil {
+		plog.Errorf("Error cleaning up plugin: %v", err)
+	}
+	if err := pf.client.Close(); err != nil {
+		plog.Errorf("Error stopping plugin: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+type machine struct {
+	cluster  *cluster
+	journal  *platform.Journal
+	console  string
+	id       string
+	ip       string
+	privIP   string
+	ipv6     string
+	privIPv6 string
+}
+
+func (pm *machine) ID() string {
+	return pm.id
+}
+
+func (pm *machine) IP() string {
+	return pm.ip
+}
+
+func (pm *machine) PrivateIP() string {
+	return pm.privIP
+}
+
+func (pm *machine) IPv6() string {
+	return pm.ipv6
+}
+
+func (pm *machine) PrivateIPv6() string {
+	return pm.privIPv6
+}
+
+func (pm *machine) RuntimeConf() platform.RuntimeConfig {
+	return pm.cluster.RuntimeConf()
+}
+
+func (pm *machine) SSHClient() (*ssh.Client, error) {
+	return pm.cluster.SSHClient(pm.IP())
+}
+
+func (pm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return pm.cluster.PasswordSSHClient(pm.IP(), user, password)
+}
+
+func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return pm.cluster.SSH(pm, cmd)
+}
+
+func (pm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(pm, local, remote)
+}
+
+func (pm *machine) Reboot() error {
+	return platform.RebootMachine(pm, pm.journal)
+}
+
+func (pm *machine) Destroy() {
+	client := pm.cluster.flight.client
+	if console, err := client.ConsoleOutput(pm.id); err != nil {
+		plog.Errorf("Error fetching console of machine %v: %v", pm.id, err)
+	} else {
+		pm.console = console
+	}
+
+	if err := client.DestroyMachine(pm.id); err != nil {
+		plog.Errorf("Error destroying machine %v: %v", pm.id, err)
+	}
+
+	if pm.journal != nil {
+		pm.journal.Destroy()
+	}
+
+	pm.cluster.DelMach(pm)
+}
+
+func (pm *machine) ConsoleOutput() string {
+	return pm.console
+}
+
+func (pm *machine) JournalOutput() string {
+	if pm.journal == nil {
+		return ""
+	}
+
+	data, err := pm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for machine %v: %v", pm.id, err)
+	}
+	return string(data)
+}
+
+func (pm *machine) Board() string {
+	return pm.cluster.flight.Options().Board
+}
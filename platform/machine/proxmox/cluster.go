@@ -0,0 +1,105 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/proxmox"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+// ipTimeout is how long we wait for the guest agent to report an address.
+const ipTimeout = 10 * time.Minute
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+}
+
+func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := pc.RenderUserData(userdata, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := pc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(pc.RuntimeConf().OutputDir, name)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	iso, err := proxmox.MakeConfigDrive(dir, name, conf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	configDrive, err := pc.flight.api.UploadISO(ctx, iso)
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := pc.flight.api.CreateVM(ctx, name, configDrive)
+	if err != nil {
+		if err := pc.flight.api.DeleteVolume(ctx, configDrive); err != nil {
+			plog.Errorf("Error deleting config drive %v: %v", configDrive, err)
+		}
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster:     pc,
+		vm:          vm,
+		configDrive: configDrive,
+	}
+
+	mach.ip, mach.ipv6, err = pc.flight.api.GetVMIP(ctx, vm.ID, ipTimeout)
+	if err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	pc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (pc *cluster) Destroy() {
+	pc.BaseCluster.Destroy()
+	pc.flight.DelCluster(pc)
+}
@@ -0,0 +1,75 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/proxmox"
+)
+
+const (
+	Platform platform.Name = "proxmox"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/proxmox")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api *proxmox.API
+}
+
+// NewFlight creates an instance of a Flight suitable for spawning
+// instances on Proxmox VE.
+func NewFlight(opts *proxmox.Options) (platform.Flight, error) {
+	api, err := proxmox.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	pf := &flight{
+		BaseFlight: bf,
+		api:        api,
+	}
+
+	return pf, nil
+}
+
+// NewCluster creates an instance of a Cluster suitable for spawning
+// instances on Proxmox VE.
+func (pf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(pf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &cluster{
+		BaseCluster: bc,
+		flight:      pf,
+	}
+
+	pf.AddCluster(pc)
+
+	return pc, nil
+}
@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxmox
+
+import (
+	"context"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/proxmox"
+)
+
+type machine struct {
+	cluster     *cluster
+	vm          *proxmox.VM
+	configDrive string
+	journal     *platform.Journal
+	ip          string
+	ipv6        string
+}
+
+func (pm *machine) ID() string {
+	return strconv.Itoa(pm.vm.ID)
+}
+
+func (pm *machine) IP() string {
+	return pm.ip
+}
+
+func (pm *machine) PrivateIP() string {
+	return pm.ip
+}
+
+func (pm *machine) IPv6() string {
+	return pm.ipv6
+}
+
+func (pm *machine) PrivateIPv6() string {
+	return pm.ipv6
+}
+
+func (pm *machine) RuntimeConf() platform.RuntimeConfig {
+	return pm.cluster.RuntimeConf()
+}
+
+func (pm *machine) SSHClient() (*ssh.Client, error) {
+	return pm.cluster.SSHClient(pm.IP())
+}
+
+func (pm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return pm.cluster.PasswordSSHClient(pm.IP(), user, password)
+}
+
+func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return pm.cluster.SSH(pm, cmd)
+}
+
+func (pm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(pm, local, remote)
+}
+
+func (pm *machine) Reboot() error {
+	return platform.RebootMachine(pm, pm.journal)
+}
+
+func (pm *machine) Destroy() {
+	ctx := context.TODO()
+	if err := pm.cluster.flight.api.DeleteVM(ctx, pm.vm.ID); err != nil {
+		plog.Errorf("Error deleting VM %v: %v", pm.vm.ID, err)
+	}
+	if err := pm.cluster.flight.api.DeleteVolume(ctx, pm.configDrive); err != nil {
+		plog.Errorf("Error deleting config drive %v: %v", pm.configDrive, err)
+	}
+
+	if pm.journal != nil {
+		pm.journal.Destroy()
+	}
+
+	pm.cluster.DelMach(pm)
+}
+
+func (pm *machine) ConsoleOutput() string {
+	// Proxmox VE provides no API for retrieving the serial console log
+	return ""
+}
+
+func (pm *machine) JournalOutput() string {
+	if pm.journal == nil {
+		return ""
+	}
+
+	data, err := pm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for VM %v: %v", pm.vm.ID, err)
+	}
+	return string(data)
+}
+
+func (pm *machine) Board() string {
+	return pm.cluster.flight.Options().Board
+}
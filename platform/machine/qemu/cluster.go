@@ -48,12 +48,47 @@ func (qc *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 }
 
 func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error) {
+	return qc.newMachine(userdata, options, nil)
+}
+
+// NewMachineWithDHCPOptions creates a machine whose interface is handed out
+// the given DHCP options from the very first boot on.
+func (qc *Cluster) NewMachineWithDHCPOptions(userdata *conf.UserData, dhcp local.DHCPOptions) (platform.Machine, error) {
+	options := platform.MachineOptions{
+		ExtraPrimaryDiskSize: qc.flight.opts.ExtraBaseDiskSize,
+	}
+	return qc.newMachine(userdata, options, &dhcp)
+}
+
+// SetDHCPOptions changes the DHCP options handed out to m. The machine
+// only sees the change after renewing its lease.
+func (qc *Cluster) SetDHCPOptions(m platform.Machine, dhcp local.DHCPOptions) error {
+	qm, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return qc.flight.Dnsmasq.SetDHCPOptions(qm.netif, dhcp)
+}
+
+// ClearDHCPOptions restores the default DHCP options handed out to m.
+func (qc *Cluster) ClearDHCPOptions(m platform.Machine) error {
+	qm, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return qc.flight.Dnsmasq.ClearDHCPOptions(qm.netif)
+}
+
+func (qc *Cluster) newMachine(userdata *conf.UserData, options platform.MachineOptions, dhcp *local.DHCPOptions) (platform.Machine, error) {
 	id := uuid.New()
+	options.NestedVirt = options.NestedVirt || qc.flight.opts.NestedVirt || qc.RuntimeConf().NestedVirt
 
 	dir := filepath.Join(qc.RuntimeConf().OutputDir, id)
 	if err := os.Mkdir(dir, 0777); err != nil {
 		return nil, err
 	}
+	// no hostname, the machines keep the one of the image
+	md := &conf.MetaData{InstanceID: id}
 
 	// hacky solution for cloud config ip substitution
 	// NOTE: escaping is not supported
@@ -61,7 +96,14 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	netif := qc.flight.Dnsmasq.GetInterface("br0")
 	ip := strings.Split(netif.DHCPv4[0].String(), "/")[0]
 
-	conf, err := qc.RenderUserData(userdata, map[string]string{
+	if dhcp != nil {
+		if err := qc.flight.Dnsmasq.SetDHCPOptions(netif, *dhcp); err != nil {
+			qc.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	conf, err := qc.RenderUnservedUserData(userdata, map[string]string{
 		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
 		"$private_ipv4": "${COREOS_CUSTOM_PRIVATE_IPV4}",
 	})
@@ -71,7 +113,10 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	}
 	qc.mu.Unlock()
 
-	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
+	// cloud-init distributions read the metadata from the NoCloud seed
+	cloudInit := qc.DistroProfile().CloudInit()
+	if !cloudInit {
+		conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
 Description=QEMU metadata agent
 After=nss-lookup.target
 After=network-online.target
@@ -84,6 +129,11 @@ ExecStart=/usr/bin/mkdir --parent /run/metadata
 ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=`+ip+`\nCOREOS_CUSTOM_PUBLIC_IPV4=`+ip+`\n" > ${OUTPUT}'
 ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 `, false)
+	}
+	conf, err = qc.ServeUserData(conf)
+	if err != nil {
+		return nil, err
+	}
 
 	var confPath string
 	if conf.IsIgnition() {
@@ -91,27 +141,51 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 		if err := conf.WriteFile(confPath); err != nil {
 			return nil, err
 		}
+	} else if cloudInit {
+		confPath, err = local.MakeNoCloudISO(conf, md, dir)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		confPath, err = local.MakeConfigDrive(conf, dir)
+		confPath, err = local.MakeConfigDrive(conf, md, dir)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if options.Netboot != nil {
+		if !conf.IsIgnition() {
+			return nil, fmt.Errorf("netbooting requires an Ignition config")
+		}
+		var opts local.DHCPOptions
+		if dhcp != nil {
+			opts = *dhcp
+		}
+		if err := qc.ServeNetboot(id, netif, *options.Netboot, confPath, opts); err != nil {
+			return nil, err
+		}
+	}
+
 	journal, err := platform.NewJournal(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	consoleSocket, err := platform.NewQEMUConsoleSocket()
+	if err != nil {
+		return nil, err
+	}
+
 	qm := &machine{
-		qc:          qc,
-		id:          id,
-		netif:       netif,
-		journal:     journal,
-		consolePath: filepath.Join(dir, "console.txt"),
+		qc:            qc,
+		id:            id,
+		netif:         netif,
+		journal:       journal,
+		consolePath:   filepath.Join(dir, "console.txt"),
+		consoleSocket: consoleSocket,
 	}
 
-	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
+	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, qm.consoleSocket, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +209,35 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 	fdnum += 1
 	extraFiles = append(extraFiles, tap.File)
 
+	for i := 1; i <= options.AdditionalNICs; i++ {
+		nic := qc.flight.Dnsmasq.GetInterface("br0")
+		tap, err := qc.NewTap("br0")
+		if err != nil {
+			qc.mu.Unlock()
+			return nil, err
+		}
+		defer tap.Close()
+		id := fmt.Sprintf("tap%d", i)
+		qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=%s,fd=%d", id, fdnum),
+			"-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev="+id+",mac="+nic.HardwareAddr.String()))
+		fdnum += 1
+		extraFiles = append(extraFiles, tap.File)
+	}
+
+	for i, network := range options.Networks {
+		tap, mac, err := qc.NewNetworkTap(network)
+		if err != nil {
+			qc.mu.Unlock()
+			return nil, err
+		}
+		defer tap.Close()
+		id := fmt.Sprintf("net%d", i)
+		qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=%s,fd=%d", id, fdnum),
+			"-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev="+id+",mac="+mac.String()))
+		fdnum += 1
+		extraFiles = append(extraFiles, tap.File)
+	}
+
 	plog.Debugf("NewMachine: %q, %q, %q", qmCmd, qm.IP(), qm.PrivateIP())
 
 	qm.qemu = qm.qc.NewCommand(qmCmd[0], qmCmd[1:]...)
@@ -152,9 +255,24 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 
 	plog.Debugf("qemu PID (manual cleanup needed if --remove=false): %v", qm.qemu.Pid())
 
-	if err := platform.StartMachine(qm, qm.journal); err != nil {
-		qm.Destroy()
-		return nil, err
+	if qc.flight.opts.Kdump != "" && options.Netboot == nil {
+		// keep the nameless primary disk around for collecting crash
+		// dumps after the machine is gone
+		qm.disk, err = os.Open(fmt.Sprintf("/proc/self/fd/%d", extraFiles[0].Fd()))
+		if err != nil {
+			qm.Destroy()
+			return nil, fmt.Errorf("reopening primary disk: %v", err)
+		}
+	}
+
+	qm.confPath = confPath
+
+	// the live system is not provisioned, see NewLiveMachine
+	if options.LiveISO == "" {
+		if err := platform.StartMachine(qm, qm.journal); err != nil {
+			qm.Destroy()
+			return nil, err
+		}
 	}
 
 	qc.AddMach(qm)
@@ -162,6 +280,41 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 	return qm, nil
 }
 
+// NewLiveMachine boots a machine once from the live ISO at iso, with a
+// blank primary disk to install Flatcar to, e.g. with flatcar-install
+// through the serial console. It returns without waiting for the live
+// system, together with the URL serving the Ignition config rendered from
+// userdata to the machine, which the installed system is meant to be
+// provisioned with. After installing and rebooting, the machine can only be
+// used once StartInstalledMachine returned.
+func (qc *Cluster) NewLiveMachine(userdata *conf.UserData, iso string) (platform.Machine, string, error) {
+	m, err := qc.newMachine(userdata, platform.MachineOptions{LiveISO: iso}, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	qm := m.(*machine)
+	if filepath.Base(qm.confPath) != "ignition.json" {
+		qm.Destroy()
+		return nil, "", fmt.Errorf("installing from a live ISO requires an Ignition config")
+	}
+	url, err := qc.ServeFile(qm.id+"/ignition.json", qm.confPath)
+	if err != nil {
+		qm.Destroy()
+		return nil, "", err
+	}
+	return qm, url, nil
+}
+
+// StartInstalledMachine waits for a machine created by NewLiveMachine to
+// boot the installed system, like a new machine of the cluster.
+func (qc *Cluster) StartInstalledMachine(m platform.Machine) error {
+	qm, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return platform.StartMachine(qm, qm.journal)
+}
+
 func (qc *Cluster) Destroy() {
 	qc.LocalCluster.Destroy()
 	qc.flight.DelCluster(qc)
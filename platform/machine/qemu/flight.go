@@ -22,6 +22,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/distro"
 	"github.com/flatcar/mantle/platform/local"
 	"github.com/flatcar/mantle/util"
 )
@@ -44,6 +45,21 @@ type Options struct {
 
 	ExtraBaseDiskSize string
 
+	// LiveISO and InstallImage are the live ISO and the compressed
+	// disk image (flatcar_production_image.bin.bz2) for tests
+	// installing Flatcar like on bare metal.
+	LiveISO      string
+	InstallImage string
+
+	// PXEKernel and PXEInitrd are the PXE images for tests booting
+	// machines over the network.
+	PXEKernel string
+	PXEInitrd string
+
+	// NestedVirt lets all machines run KVM guests, not only the ones
+	// of tests with the RequireNestedVirt flag.
+	NestedVirt bool
+
 	*platform.Options
 }
 
@@ -71,7 +87,7 @@ func NewFlight(opts *Options) (platform.Flight, error) {
 		diskImagePath: opts.DiskImage,
 	}
 
-	if opts.Distribution != "cl" {
+	if !distro.Lookup(opts.Distribution).MangleImage {
 		// don't apply CL-specific mangling
 		opts.UseVanillaImage = true
 	}
@@ -90,11 +106,19 @@ func NewFlight(opts *Options) (platform.Flight, error) {
 	}
 	if !opts.UseVanillaImage {
 		plog.Debug("enabling console logging in base disk")
-		qf.diskImageFile, err = platform.MakeCLDiskTemplate(opts.DiskImage)
+		qf.diskImageFile, err = platform.MakeCLDiskTemplate(opts.DiskImage, opts.ImageHooks)
 		if err != nil {
 			qf.Destroy()
 			return nil, fmt.Errorf("creating disk image file failed: %v", err)
 		}
+	} else if len(opts.ImageHooks) > 0 {
+		qf.diskImageFile, err = platform.MakeDiskTemplate(opts.DiskImage, opts.ImageHooks)
+		if err != nil {
+			qf.Destroy()
+			return nil, fmt.Errorf("applying image hooks failed: %v", err)
+		}
+	}
+	if qf.diskImageFile != nil {
 		// The template file has already been deleted, ensuring that
 		// it will be cleaned up on exit.  Use a path to it that
 		// will remain stable for the lifetime of the flight without
@@ -15,7 +15,11 @@
 package qemu
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 
@@ -25,13 +29,16 @@ import (
 )
 
 type machine struct {
-	qc          *Cluster
-	id          string
-	qemu        exec.Cmd
-	netif       *local.Interface
-	journal     *platform.Journal
-	consolePath string
-	console     string
+	qc            *Cluster
+	id            string
+	qemu          exec.Cmd
+	netif         *local.Interface
+	journal       *platform.Journal
+	confPath      string
+	consolePath   string
+	consoleSocket string
+	console       string
+	disk          *os.File // primary disk, only kept with kdump enabled
 }
 
 func (m *machine) ID() string {
@@ -46,6 +53,16 @@ func (m *machine) PrivateIP() string {
 	return m.netif.DHCPv4[0].IP.String()
 }
 
+// IPv6 returns the SLAAC address of the machine on the network of the
+// cluster.
+func (m *machine) IPv6() string {
+	return m.netif.SLAAC.IP.String()
+}
+
+func (m *machine) PrivateIPv6() string {
+	return m.netif.SLAAC.IP.String()
+}
+
 func (m *machine) RuntimeConf() platform.RuntimeConfig {
 	return m.qc.RuntimeConf()
 }
@@ -62,6 +79,10 @@ func (m *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return m.qc.SSH(m, cmd)
 }
 
+func (m *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(m, local, remote)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal)
 }
@@ -73,12 +94,28 @@ func (m *machine) Destroy() {
 
 	m.journal.Destroy()
 
+	if err := platform.RemoveQEMUConsoleSocket(m.consoleSocket); err != nil {
+		plog.Errorf("Error removing console socket for instance %v: %v", m.ID(), err)
+	}
+
 	if buf, err := ioutil.ReadFile(m.consolePath); err == nil {
 		m.console = string(buf)
 	} else {
 		plog.Errorf("Error reading console for instance %v: %v", m.ID(), err)
 	}
 
+	if m.disk != nil {
+		if strings.Contains(m.console, platform.KdumpPanicMarker) {
+			dir := filepath.Join(m.qc.RuntimeConf().OutputDir, m.id)
+			if n, err := platform.CollectKdumpFromDisk(fmt.Sprintf("/proc/self/fd/%d", m.disk.Fd()), dir); err != nil {
+				plog.Errorf("Error collecting crash dumps of instance %v: %v", m.ID(), err)
+			} else if n > 0 {
+				plog.Noticef("Collected %d crash dumps of instance %v", n, m.ID())
+			}
+		}
+		m.disk.Close()
+	}
+
 	m.qc.DelMach(m)
 }
 
@@ -86,6 +123,10 @@ func (m *machine) ConsoleOutput() string {
 	return m.console
 }
 
+func (m *machine) SerialConsole() (*platform.SerialConsole, error) {
+	return platform.ConnectQEMUConsole(m.consoleSocket)
+}
+
 func (m *machine) JournalOutput() string {
 	if m.journal == nil {
 		return ""
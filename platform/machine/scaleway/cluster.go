@@ -0,0 +1,86 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight           *flight
+	privateNetworkID string
+}
+
+func (sc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := sc.RenderUserData(userdata, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := sc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := sc.flight.api.CreateServer(context.TODO(), name, conf.String(), sc.privateNetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster: sc,
+		server:  server,
+	}
+
+	dir := filepath.Join(sc.RuntimeConf().OutputDir, mach.ID())
+	if err := os.Mkdir(dir, 0777); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	sc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (sc *cluster) Destroy() {
+	sc.BaseCluster.Destroy()
+	if err := sc.flight.api.DeletePrivateNetwork(context.TODO(), sc.privateNetworkID); err != nil {
+		plog.Errorf("Error deleting private network %v: %v", sc.privateNetworkID, err)
+	}
+	sc.flight.DelCluster(sc)
+}
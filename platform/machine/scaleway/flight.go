@@ -0,0 +1,83 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/scaleway"
+)
+
+const (
+	Platform platform.Name = "scaleway"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/scaleway")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api *scaleway.API
+}
+
+// NewFlight creates an instance of a Flight suitable for spawning
+// instances on Scaleway.
+func NewFlight(opts *scaleway.Options) (platform.Flight, error) {
+	api, err := scaleway.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &flight{
+		BaseFlight: bf,
+		api:        api,
+	}
+
+	return sf, nil
+}
+
+// NewCluster creates an instance of a Cluster suitable for spawning
+// instances on Scaleway. Each cluster gets its own private network.
+func (sf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(sf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &cluster{
+		BaseCluster: bc,
+		flight:      sf,
+	}
+
+	sc.privateNetworkID, err = sf.api.CreatePrivateNetwork(context.TODO(), bc.Name())
+	if err != nil {
+		sc.BaseCluster.Destroy()
+		return nil, err
+	}
+
+	sf.AddCluster(sc)
+
+	return sc, nil
+}
@@ -0,0 +1,109 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"context"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/scaleway"
+)
+
+type machine struct {
+	cluster *cluster
+	server  *scaleway.Server
+	journal *platform.Journal
+}
+
+func (sm *machine) ID() string {
+	return sm.server.ID
+}
+
+func (sm *machine) IP() string {
+	return sm.server.PublicIP
+}
+
+func (sm *machine) PrivateIP() string {
+	return sm.server.PrivateIP
+}
+
+func (sm *machine) IPv6() string {
+	return sm.server.PublicIPv6
+}
+
+// PrivateIPv6 returns the public IPv6 address, private networks are
+// attached with IPv4 only.
+func (sm *machine) PrivateIPv6() string {
+	return sm.server.PublicIPv6
+}
+
+func (sm *machine) RuntimeConf() platform.RuntimeConfig {
+	return sm.cluster.RuntimeConf()
+}
+
+func (sm *machine) SSHClient() (*ssh.Client, error) {
+	return sm.cluster.SSHClient(sm.IP())
+}
+
+func (sm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return sm.cluster.PasswordSSHClient(sm.IP(), user, password)
+}
+
+func (sm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return sm.cluster.SSH(sm, cmd)
+}
+
+func (sm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(sm, local, remote)
+}
+
+func (sm *machine) Reboot() error {
+	return platform.RebootMachine(sm, sm.journal)
+}
+
+func (sm *machine) Destroy() {
+	if err := sm.cluster.flight.api.DeleteServer(context.TODO(), sm.ID()); err != nil {
+		plog.Errorf("Error deleting server %v: %v", sm.ID(), err)
+	}
+
+	if sm.journal != nil {
+		sm.journal.Destroy()
+	}
+
+	sm.cluster.DelMach(sm)
+}
+
+func (sm *machine) ConsoleOutput() string {
+	// Scaleway provides no API for retrieving the serial console log
+	return ""
+}
+
+func (sm *machine) JournalOutput() string {
+	if sm.journal == nil {
+		return ""
+	}
+
+	data, err := sm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for server %v: %v", sm.ID(), err)
+	}
+	return string(data)
+}
+
+func (sm *machine) Board() string {
+	return sm.cluster.flight.Options().Board
+}
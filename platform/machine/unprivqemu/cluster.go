@@ -31,6 +31,7 @@ import (
 
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/local"
 	"github.com/flatcar/mantle/system/exec"
 	"github.com/flatcar/mantle/util"
 )
@@ -54,12 +55,17 @@ func (qc *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 }
 
 func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error) {
+	if options.AdditionalNICs > 0 || len(options.Networks) > 0 {
+		return nil, fmt.Errorf("additional network interfaces are only supported on qemu")
+	}
 	id := uuid.New()
+	options.NestedVirt = options.NestedVirt || qc.flight.opts.NestedVirt || qc.RuntimeConf().NestedVirt
 
 	dir := filepath.Join(qc.RuntimeConf().OutputDir, id)
 	if err := os.Mkdir(dir, 0777); err != nil {
 		return nil, err
 	}
+	md := &conf.MetaData{InstanceID: id}
 
 	// hacky solution for cloud config ip substitution
 	// NOTE: escaping is not supported
@@ -110,9 +116,14 @@ LinkLocalAddressing=no
 		if err := conf.WriteFile(confPath); err != nil {
 			return nil, err
 		}
+	} else if qc.DistroProfile().CloudInit() {
+		confPath, err = local.MakeNoCloudISO(conf, md, dir)
+		if err != nil {
+			return nil, err
+		}
 	} else if conf.IsEmpty() {
 	} else {
-		return nil, fmt.Errorf("unprivileged qemu only supports Ignition or empty configs")
+		return nil, fmt.Errorf("unprivileged qemu only supports Ignition, cloud-init or empty configs")
 	}
 
 	journal, err := platform.NewJournal(dir)
@@ -120,15 +131,21 @@ LinkLocalAddressing=no
 		return nil, err
 	}
 
+	consoleSocket, err := platform.NewQEMUConsoleSocket()
+	if err != nil {
+		return nil, err
+	}
+
 	qm := &machine{
-		qc:          qc,
-		id:          id,
-		journal:     journal,
-		consolePath: filepath.Join(dir, "console.txt"),
-		privateAddr: privateAddr,
+		qc:            qc,
+		id:            id,
+		journal:       journal,
+		consolePath:   filepath.Join(dir, "console.txt"),
+		consoleSocket: consoleSocket,
+		privateAddr:   privateAddr,
 	}
 
-	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
+	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, qm.consoleSocket, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
 	if err != nil {
 		return nil, err
 	}
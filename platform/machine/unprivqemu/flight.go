@@ -15,6 +15,7 @@
 package unprivqemu
 
 import (
+	"fmt"
 	"net"
 	"os"
 
@@ -54,6 +55,42 @@ func NewFlight(opts *qemu.Options) (platform.Flight, error) {
 		diskImagePath: opts.DiskImage,
 	}
 
+	if opts.IgnitionDelivery != "" {
+		// QEMU user networking forwards the first host address of the
+		// machine network to the loopback interface of the host
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		s, err := platform.NewIgnitionServer(l, opts.IgnitionDelivery, "10.0.2.2")
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		bf.SetIgnitionServer(s)
+	}
+
+	// see the Ignition server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s, err := platform.NewAssetServer(l, "10.0.2.2")
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	bf.SetAssetServer(s)
+
+	if len(opts.ImageHooks) > 0 {
+		qf.diskImageFile, err = platform.MakeDiskTemplate(opts.DiskImage, opts.ImageHooks)
+		if err != nil {
+			return nil, fmt.Errorf("applying image hooks failed: %v", err)
+		}
+		// see the qemu platform
+		qf.diskImagePath = fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), qf.diskImageFile.Fd())
+	}
+
 	return qf, nil
 }
 
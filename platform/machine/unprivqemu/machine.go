@@ -24,14 +24,15 @@ import (
 )
 
 type machine struct {
-	qc          *Cluster
-	id          string
-	qemu        exec.Cmd
-	journal     *platform.Journal
-	consolePath string
-	console     string
-	ip          string
-	privateAddr string
+	qc            *Cluster
+	id            string
+	qemu          exec.Cmd
+	journal       *platform.Journal
+	consolePath   string
+	consoleSocket string
+	console       string
+	ip            string
+	privateAddr   string
 }
 
 func (m *machine) ID() string {
@@ -46,6 +47,15 @@ func (m *machine) PrivateIP() string {
 	return m.privateAddr
 }
 
+// IPv6 returns an empty string, the machines are only reachable over IPv4.
+func (m *machine) IPv6() string {
+	return ""
+}
+
+func (m *machine) PrivateIPv6() string {
+	return ""
+}
+
 func (m *machine) RuntimeConf() platform.RuntimeConfig {
 	return m.qc.RuntimeConf()
 }
@@ -62,6 +72,10 @@ func (m *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return m.qc.SSH(m, cmd)
 }
 
+func (m *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(m, local, remote)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal)
 }
@@ -73,6 +87,10 @@ func (m *machine) Destroy() {
 
 	m.journal.Destroy()
 
+	if err := platform.RemoveQEMUConsoleSocket(m.consoleSocket); err != nil {
+		plog.Errorf("Error removing console socket for instance %v: %v", m.ID(), err)
+	}
+
 	if buf, err := ioutil.ReadFile(m.consolePath); err == nil {
 		m.console = string(buf)
 	} else {
@@ -86,6 +104,10 @@ func (m *machine) ConsoleOutput() string {
 	return m.console
 }
 
+func (m *machine) SerialConsole() (*platform.SerialConsole, error) {
+	return platform.ConnectQEMUConsole(m.consoleSocket)
+}
+
 func (m *machine) JournalOutput() string {
 	if m.journal == nil {
 		return ""
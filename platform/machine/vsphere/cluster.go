@@ -0,0 +1,80 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+}
+
+func (vc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := vc.RenderUserData(userdata, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := vc.NewResourceName()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(vc.RuntimeConf().OutputDir, name)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	vm, err := vc.flight.api.CreateVM(context.TODO(), name, vc.flight.template, conf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster: vc,
+		vm:      vm,
+		dir:     dir,
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	vc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (vc *cluster) Destroy() {
+	vc.BaseCluster.Destroy()
+	vc.flight.DelCluster(vc)
+}
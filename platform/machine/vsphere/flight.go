@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/vsphere"
+)
+
+const (
+	Platform platform.Name = "vsphere"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/vsphere")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api *vsphere.API
+
+	// template is the VM template machines are cloned from
+	template         string
+	importedTemplate bool
+}
+
+// NewFlight creates an instance of a Flight suitable for spawning
+// instances on VMware vSphere. Without a template, the OVA is imported
+// as a template for the lifetime of the flight.
+func NewFlight(opts *vsphere.Options) (platform.Flight, error) {
+	if opts.Template == "" && opts.OVAPath == "" {
+		return nil, fmt.Errorf("vSphere template or OVA path must be specified")
+	}
+
+	api, err := vsphere.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		api.Close()
+		return nil, err
+	}
+
+	vf := &flight{
+		BaseFlight: bf,
+		api:        api,
+		template:   opts.Template,
+	}
+
+	if vf.template == "" {
+		name, err := bf.Namer().Name()
+		if err != nil {
+			vf.Destroy()
+			return nil, err
+		}
+		plog.Infof("Importing %s as template %s", opts.OVAPath, name)
+		if _, err := api.ImportOVA(context.TODO(), name, opts.OVAPath); err != nil {
+			vf.Destroy()
+			return nil, fmt.Errorf("importing OVA: %v", err)
+		}
+		vf.template = name
+		vf.importedTemplate = true
+	}
+
+	return vf, nil
+}
+
+// NewCluster creates an instance of a Cluster suitable for spawning
+// instances on VMware vSphere.
+func (vf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(vf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	vc := &cluster{
+		BaseCluster: bc,
+		flight:      vf,
+	}
+
+	vf.AddCluster(vc)
+
+	return vc, nil
+}
+
+func (vf *flight) Destroy() {
+	vf.BaseFlight.Destroy()
+
+	if vf.importedTemplate {
+		if err := vf.api.DeleteTemplate(context.TODO(), vf.template); err != nil {
+			plog.Errorf("Error deleting template %v: %v", vf.template, err)
+		}
+	}
+	vf.api.Close()
+}
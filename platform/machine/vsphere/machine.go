@@ -0,0 +1,127 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsphere
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/vsphere"
+)
+
+type machine struct {
+	cluster *cluster
+	vm      *vsphere.VM
+	dir     string
+	journal *platform.Journal
+	console string
+}
+
+func (vsm *machine) ID() string {
+	return vsm.vm.Name
+}
+
+func (vsm *machine) IP() string {
+	return vsm.vm.IPAddress
+}
+
+func (vsm *machine) PrivateIP() string {
+	return vsm.vm.IPAddress
+}
+
+func (vsm *machine) IPv6() string {
+	return vsm.vm.IPv6Address
+}
+
+func (vsm *machine) PrivateIPv6() string {
+	return vsm.vm.IPv6Address
+}
+
+func (vsm *machine) RuntimeConf() platform.RuntimeConfig {
+	return vsm.cluster.RuntimeConf()
+}
+
+func (vsm *machine) SSHClient() (*ssh.Client, error) {
+	return vsm.cluster.SSHClient(vsm.IP())
+}
+
+func (vsm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return vsm.cluster.PasswordSSHClient(vsm.IP(), user, password)
+}
+
+func (vsm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return vsm.cluster.SSH(vsm, cmd)
+}
+
+func (vsm *machine) ForwardPort(local, remote string) (*platform.PortForward, error) {
+	return platform.ForwardPort(vsm, local, remote)
+}
+
+func (vsm *machine) Reboot() error {
+	return platform.RebootMachine(vsm, vsm.journal)
+}
+
+func (vsm *machine) Destroy() {
+	ctx := context.TODO()
+
+	// the console log is removed along with the VM
+	if err := vsm.saveConsole(ctx); err != nil {
+		plog.Errorf("Error saving console for VM %v: %v", vsm.ID(), err)
+	}
+
+	if err := vsm.cluster.flight.api.DeleteVM(ctx, vsm.vm); err != nil {
+		plog.Errorf("Error deleting VM %v: %v", vsm.ID(), err)
+	}
+
+	if vsm.journal != nil {
+		vsm.journal.Destroy()
+	}
+
+	vsm.cluster.DelMach(vsm)
+}
+
+func (vsm *machine) saveConsole(ctx context.Context) error {
+	var err error
+	vsm.console, err = vsm.cluster.flight.api.ConsoleOutput(ctx, vsm.vm)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(vsm.dir, "console.txt"), []byte(vsm.console), 0666)
+}
+
+func (vsm *machine) ConsoleOutput() string {
+	return vsm.console
+}
+
+func (vsm *machine) JournalOutput() string {
+	if vsm.journal == nil {
+		return ""
+	}
+
+	data, err := vsm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for VM %v: %v", vsm.ID(), err)
+	}
+	return string(data)
+}
+
+func (vsm *machine) Board() string {
+	return vsm.cluster.flight.Options().Board
+}
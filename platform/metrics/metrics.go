@@ -0,0 +1,209 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics collects Prometheus metrics about a run, like the
+// number of tests and machines and the cloud API errors, and serves them
+// over HTTP so long runs can be monitored.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	testsTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kola_tests",
+		Help: "Number of tests selected for the run.",
+	})
+	testsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kola_tests_started_total",
+		Help: "Number of tests that started running.",
+	})
+	testsRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kola_tests_running",
+		Help: "Number of tests currently running.",
+	})
+	testsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kola_tests_finished_total",
+		Help: "Number of finished tests by result.",
+	}, []string{"result"})
+	testDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kola_test_duration_seconds",
+		Help:    "Duration of finished tests.",
+		Buckets: prometheus.ExponentialBuckets(15, 2, 9),
+	})
+	machinesProvisioned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kola_machines_provisioned_total",
+		Help: "Number of machines that booted and passed the basic checks, or failed them.",
+	}, []string{"result"})
+	bootDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kola_machine_boot_duration_seconds",
+		Help:    "Time from starting a machine until it passed the basic checks.",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 8),
+	})
+	apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kola_cloud_api_calls_total",
+		Help: "Number of cloud API calls by service.",
+	}, []string{"service"})
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kola_cloud_api_errors_total",
+		Help: "Number of failed cloud API calls by service.",
+	}, []string{"service"})
+	apiThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kola_cloud_api_throttled_total",
+		Help: "Number of cloud API calls retried because of rate limits by service.",
+	}, []string{"service"})
+)
+
+func init() {
+	registry.MustRegister(testsTotal, testsStarted, testsRunning,
+		testsFinished, testDuration, machinesProvisioned, bootDuration,
+		apiCalls, apiErrors, apiThrottled)
+}
+
+var (
+	serverLock sync.Mutex
+	server     *http.Server
+)
+
+// Serve starts serving the metrics at /metrics on addr, a host:port to
+// listen on. It returns the address actually listened on, e.g. with the
+// port chosen for ":0".
+func Serve(addr string) (string, error) {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+	if server != nil {
+		return "", fmt.Errorf("metrics are already served")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("listening for metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server = &http.Server{Handler: mux}
+	go server.Serve(l)
+	return l.Addr().String(), nil
+}
+
+// Close stops serving the metrics.
+func Close() error {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+	if server == nil {
+		return nil
+	}
+	err := server.Close()
+	server = nil
+	return err
+}
+
+// Handler returns a handler serving the metrics in the Prometheus
+// exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// MachineStarted records the outcome of booting a machine, started at
+// the given time.
+func MachineStarted(start time.Time, err error) {
+	if err != nil {
+		machinesProvisioned.WithLabelValues("failed").Inc()
+		return
+	}
+	machinesProvisioned.WithLabelValues("success").Inc()
+	bootDuration.Observe(time.Since(start).Seconds())
+}
+
+// APICall records a call of a cloud API service and whether it failed.
+func APICall(service string, failed bool) {
+	apiCalls.WithLabelValues(service).Inc()
+	if failed {
+		apiErrors.WithLabelValues(service).Inc()
+	}
+}
+
+// APIThrottled records a call of a cloud API service retried because of
+// rate limits.
+func APIThrottled(service string) {
+	apiThrottled.WithLabelValues(service).Inc()
+}
+
+// Progress implements harness.Progress to count the tests of a suite.
+type Progress struct {
+	mu      sync.Mutex
+	started map[string]bool
+	running map[string]bool
+}
+
+// NewProgress returns a Progress counting tests in the metrics.
+func NewProgress() *Progress {
+	return &Progress{
+		started: make(map[string]bool),
+		running: make(map[string]bool),
+	}
+}
+
+func (p *Progress) Start(tests int) {
+	testsTotal.Set(float64(tests))
+}
+
+func (p *Progress) TestStarted(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// parallel tests are started again after waiting for a slot
+	if !p.started[name] {
+		p.started[name] = true
+		testsStarted.Inc()
+	}
+	if !p.running[name] {
+		p.running[name] = true
+		testsRunning.Inc()
+	}
+}
+
+func (p *Progress) TestQueued(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running[name] {
+		delete(p.running, name)
+		testsRunning.Dec()
+	}
+}
+
+func (p *Progress) TestStatus(name, status string) {}
+
+func (p *Progress) TestFinished(name string, result testresult.TestResult, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running[name] {
+		delete(p.running, name)
+		testsRunning.Dec()
+	}
+	testsFinished.WithLabelValues(string(result)).Inc()
+	testDuration.Observe(duration.Seconds())
+}
+
+func (p *Progress) Finish() {}
@@ -0,0 +1,66 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+func TestServe(t *testing.T) {
+	addr, err := Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	p := NewProgress()
+	p.Start(2)
+	p.TestStarted("a")
+	p.TestQueued("a")
+	p.TestStarted("a")
+	p.TestStarted("b")
+	p.TestFinished("a", testresult.Pass, time.Minute)
+	MachineStarted(time.Now().Add(-time.Minute), nil)
+	APICall("ec2", true)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"kola_tests 2",
+		"kola_tests_started_total 2",
+		"kola_tests_running 1",
+		`kola_tests_finished_total{result="PASS"} 1`,
+		`kola_machines_provisioned_total{result="success"} 1`,
+		"kola_machine_boot_duration_seconds_count 1",
+		`kola_cloud_api_errors_total{service="ec2"} 1`,
+	} {
+		if !strings.Contains(string(b), line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, b)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package naming generates the names of the temporary cloud resources
+// (instances, networks, keypairs, buckets) created during a run.
+//
+// Every name has the form <prefix>-<run id>-<hash>, so garbage collectors
+// can match leftovers by prefix and tell runs apart by run id.
+package naming
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pborman/uuid"
+)
+
+const (
+	// DefaultMaxLength fits a DNS label, which is what most providers
+	// derive the hostname from.
+	DefaultMaxLength = 63
+
+	runIDLength = 8
+	hashBytes   = 5
+	maxAttempts = 16
+)
+
+// maxLengths holds the name length limit of the providers that do not use
+// DefaultMaxLength.
+var maxLengths = map[string]int{
+	"aws":     255,
+	"azure":   64,
+	"esx":     80,
+	"vsphere": 80,
+}
+
+// MaxLength returns the name length limit of the given platform.
+func MaxLength(platform string) int {
+	if l, ok := maxLengths[platform]; ok {
+		return l
+	}
+	return DefaultMaxLength
+}
+
+// Namer hands out unique resource names for a single run. It is safe for
+// concurrent use.
+type Namer struct {
+	prefix string
+	runID  string
+	maxLen int
+
+	lock sync.Mutex
+	used map[string]struct{}
+}
+
+// NewNamer returns a Namer for a new run, generating names no longer than
+// maxLen. prefix is lowercased and characters other than letters, digits
+// and '-' are replaced with '-'.
+func NewNamer(prefix string, maxLen int) *Namer {
+	return NewNamerWithRunID(prefix, uuid.New()[:runIDLength], maxLen)
+}
+
+// NewNamerWithRunID is like NewNamer but uses the given run id.
+func NewNamerWithRunID(prefix, runID string, maxLen int) *Namer {
+	return &Namer{
+		prefix: sanitize(prefix),
+		runID:  sanitize(runID),
+		maxLen: maxLen,
+		used:   make(map[string]struct{}),
+	}
+}
+
+// Prefix returns the sanitized prefix every name starts with.
+func (n *Namer) Prefix() string {
+	return n.prefix
+}
+
+// RunID returns the run id embedded in every name.
+func (n *Namer) RunID() string {
+	return n.runID
+}
+
+// Name returns a new name which has not been handed out by n before.
+func (n *Namer) Name() (string, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for i := 0; i < maxAttempts; i++ {
+		b := make([]byte, hashBytes)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generating name: %v", err)
+		}
+		name, err := n.compose(fmt.Sprintf("%x", b))
+		if err != nil {
+			return "", err
+		}
+		if _, ok := n.used[name]; ok {
+			continue
+		}
+		n.used[name] = struct{}{}
+		return name, nil
+	}
+	return "", fmt.Errorf("no unique name found after %d attempts", maxAttempts)
+}
+
+// compose joins the name parts, trimming the run id first and the prefix
+// second if the result would exceed the length limit. The hash is never
+// trimmed.
+func (n *Namer) compose(hash string) (string, error) {
+	prefix, runID := n.prefix, n.runID
+	if over := len(prefix) + len(runID) + len(hash) + 2 - n.maxLen; over > 0 {
+		if over < len(runID) {
+			runID = runID[:len(runID)-over]
+		} else {
+			// Dropping the run id also drops its separator.
+			over -= len(runID) + 1
+			runID = ""
+			if over >= len(prefix) {
+				return "", fmt.Errorf("name length limit %d is too short", n.maxLen)
+			}
+			if over > 0 {
+				prefix = strings.TrimRight(prefix[:len(prefix)-over], "-")
+			}
+		}
+	}
+
+	parts := []string{}
+	for _, p := range []string{prefix, runID, hash} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, s)
+}
@@ -0,0 +1,70 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		runID  string
+		maxLen int
+		want   string
+	}{
+		{"kola", "1a2b3c4d", 63, `^kola-1a2b3c4d-[0-9a-f]{10}$`},
+		{"Kola_Test", "1a2b3c4d", 63, `^kola-test-1a2b3c4d-[0-9a-f]{10}$`},
+		{"kola", "1a2b3c4d", 20, `^kola-1a2b-[0-9a-f]{10}$`},
+		{"kola", "1a2b3c4d", 15, `^kola-[0-9a-f]{10}$`},
+		{"kola-test", "1a2b3c4d", 15, `^kola-[0-9a-f]{10}$`},
+	} {
+		n := NewNamerWithRunID(tt.prefix, tt.runID, tt.maxLen)
+		name, err := n.Name()
+		if err != nil {
+			t.Errorf("%q/%d: %v", tt.prefix, tt.maxLen, err)
+			continue
+		}
+		if len(name) > tt.maxLen {
+			t.Errorf("%q/%d: %q exceeds length limit", tt.prefix, tt.maxLen, name)
+		}
+		if !regexp.MustCompile(tt.want).MatchString(name) {
+			t.Errorf("%q/%d: got %q, want match for %s", tt.prefix, tt.maxLen, name, tt.want)
+		}
+	}
+}
+
+func TestNameTooShort(t *testing.T) {
+	n := NewNamerWithRunID("kola", "1a2b3c4d", 11)
+	if name, err := n.Name(); err == nil {
+		t.Errorf("expected error, got %q", name)
+	}
+}
+
+func TestNameUnique(t *testing.T) {
+	n := NewNamer("kola", DefaultMaxLength)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		name, err := n.Name()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[name] {
+			t.Fatalf("duplicate name %q", name)
+		}
+		seen[name] = true
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NestedVirtCPUFeature returns the CPU feature passed to QEMU to expose the
+// virtualization extensions of the host to the machines, vmx or svm, or an
+// error if the host can't run nested virtual machines.
+func NestedVirtCPUFeature() (string, error) {
+	cpuinfo, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return "", err
+	}
+	return nestedVirtCPUFeature(cpuinfo, func(module string) (string, error) {
+		b, err := os.ReadFile("/sys/module/" + module + "/parameters/nested")
+		return string(b), err
+	})
+}
+
+// nestedVirtCPUFeature checks the flags in cpuinfo and the nested
+// parameter of the KVM module, as returned by nested.
+func nestedVirtCPUFeature(cpuinfo []byte, nested func(module string) (string, error)) (string, error) {
+	var feature, module string
+	sc := bufio.NewScanner(bytes.NewReader(cpuinfo))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "flags" {
+			continue
+		}
+		for _, flag := range strings.Fields(value) {
+			switch flag {
+			case "vmx":
+				feature, module = "vmx", "kvm_intel"
+			case "svm":
+				feature, module = "svm", "kvm_amd"
+			}
+		}
+		break
+	}
+	if feature == "" {
+		return "", fmt.Errorf("the host CPU has no virtualization extensions")
+	}
+
+	value, err := nested(module)
+	if err != nil {
+		return "", fmt.Errorf("%s is not loaded: %v", module, err)
+	}
+	switch strings.TrimSpace(value) {
+	case "Y", "1":
+		return feature, nil
+	default:
+		return "", fmt.Errorf("nested virtualization is disabled, load %s with nested=1", module)
+	}
+}
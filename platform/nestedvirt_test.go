@@ -0,0 +1,49 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNestedVirtCPUFeature(t *testing.T) {
+	const intel = "processor\t: 0\nflags\t\t: fpu vme vmx ept\n\nprocessor\t: 1\nflags\t\t: fpu vme vmx ept\n"
+	const amd = "processor\t: 0\nflags\t\t: fpu svm npt\n"
+	const none = "processor\t: 0\nflags\t\t: fpu vme hypervisor\n"
+
+	for _, tt := range []struct {
+		cpuinfo string
+		nested  map[string]string
+		feature string
+	}{
+		{intel, map[string]string{"kvm_intel": "Y\n"}, "vmx"},
+		{intel, map[string]string{"kvm_intel": "N\n"}, ""},
+		{intel, map[string]string{"kvm_amd": "1\n"}, ""},
+		{amd, map[string]string{"kvm_amd": "1\n"}, "svm"},
+		{amd, map[string]string{"kvm_amd": "0\n"}, ""},
+		{none, map[string]string{"kvm_intel": "Y\n"}, ""},
+	} {
+		feature, err := nestedVirtCPUFeature([]byte(tt.cpuinfo), func(module string) (string, error) {
+			if v, ok := tt.nested[module]; ok {
+				return v, nil
+			}
+			return "", errors.New("no such file or directory")
+		})
+		if feature != tt.feature || (err == nil) != (tt.feature != "") {
+			t.Errorf("%q with %v: got %q, %v, expected %q", tt.cpuinfo, tt.nested, feature, err, tt.feature)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
@@ -49,6 +50,15 @@ type Machine interface {
 	// PrivateIP returns the machine's private IP.
 	PrivateIP() string
 
+	// IPv6 returns the machine's public IPv6 address, or an empty
+	// string if the platform did not assign one.
+	IPv6() string
+
+	// PrivateIPv6 returns the IPv6 address the other machines of the
+	// cluster reach the machine at, or an empty string. IPv6 addresses
+	// are global on most platforms, so it is often the same as IPv6.
+	PrivateIPv6() string
+
 	// RuntimeConf returns the cluster's runtime configuration.
 	RuntimeConf() RuntimeConfig
 
@@ -61,6 +71,10 @@ type Machine interface {
 	// SSH runs a single command over a new SSH connection.
 	SSH(cmd string) ([]byte, []byte, error)
 
+	// ForwardPort forwards connections to the local address to the
+	// remote address as seen from the machine, see ForwardPort.
+	ForwardPort(local, remote string) (*PortForward, error)
+
 	// Reboot restarts the machine and waits for it to come back.
 	Reboot() error
 
@@ -80,6 +94,16 @@ type Machine interface {
 	Board() string
 }
 
+// InterruptibleMachine is implemented by machines the platform can take
+// away while a test runs, e.g. spot instances.
+type InterruptibleMachine interface {
+	Machine
+
+	// Interrupted returns why the platform reclaimed the machine, or ""
+	// if it did not.
+	Interrupted() string
+}
+
 // Cluster represents a cluster of machines within a single Flight.
 type Cluster interface {
 	// Platform returns the name of the platform.
@@ -113,6 +137,20 @@ type Cluster interface {
 	// IgnitionVersion returns the version of Ignition supported by the
 	// cluster
 	IgnitionVersion() string
+
+	// DNSName returns the fully qualified name of the record name of the
+	// cluster in DNSDomain.
+	DNSName(name string) string
+
+	// SetDNSRecord points the name, see DNSName, at the addresses, which
+	// the machines of the cluster can then resolve. Without addresses the
+	// name is removed.
+	SetDNSRecord(name string, addrs ...string) error
+
+	// ServeAssets serves the contents of the directory dir over HTTP
+	// to the machines until the cluster is destroyed and returns the
+	// base URL of the files, without a trailing slash.
+	ServeAssets(dir string) (string, error)
 }
 
 // Flight represents a group of Clusters within a single platform.
@@ -160,12 +198,63 @@ type Options struct {
 	// Board is the board used by the image
 	Board string
 
+	// ImageHooks are applied to local images before they are booted or
+	// uploaded by the platform.
+	ImageHooks []ImageHook
+
+	// Kdump, if set, is the memory reserved for the kdump crash kernel,
+	// e.g. "256M". The dmesg of kernel panics is collected from the
+	// machines.
+	Kdump string
+
+	// DNSServers, if set, are the DNS servers the machines use instead of
+	// those of the platform.
+	DNSServers []string
+
+	// SELinuxMode, if set to SELinuxEnforcing or SELinuxPermissive,
+	// makes machines boot in that mode, which is checked when they
+	// start. Otherwise SELinux is switched to enforcing after the boot.
+	SELinuxMode string
+
+	// CgroupMode, if set to conf.CgroupV1 or conf.CgroupV2, boots the
+	// machines with that cgroup hierarchy, which is checked when they
+	// start.
+	CgroupMode string
+
+	// IgnitionDelivery, if set to "http" or "https", makes machines fetch
+	// their Ignition config from a server run by kola; the userdata only
+	// contains a pointer config.
+	IgnitionDelivery string
+	// IgnitionServerAddr is the host[:port] at which machines reach the
+	// Ignition server, which listens on that port on all addresses. Local
+	// platforms use the host side of their machine network.
+	IgnitionServerAddr string
+
+	// AssetServerAddr is the host[:port] at which machines reach the
+	// server of the test assets, see Cluster.ServeAssets, which listens on
+	// that port on all addresses. Local platforms use the host side of
+	// their machine network.
+	AssetServerAddr string
+
 	// How many times to retry establishing an SSH connection when
 	// creating a journal or when doing a machine check.
 	SSHRetries int
 	// A duration of a single try of establishing the connection
 	// when creating a journal or when doing a machine check.
 	SSHTimeout time.Duration
+
+	// JumpHost, if set, is the host[:port] of an SSH bastion through
+	// which all SSH connections to the machines go, for machines in
+	// private networks. JumpUser defaults to the local user and the
+	// keys of the SSH agent are used unless JumpKeyFile is set.
+	JumpHost    string
+	JumpUser    string
+	JumpKeyFile string
+
+	// WireGuardSubnet, if set, is the IPv4 subnet of a WireGuard overlay
+	// joining the kola host and the machines of each cluster, see
+	// WireGuardMesh.
+	WireGuardSubnet string
 }
 
 // RuntimeConfig contains cluster-specific configuration.
@@ -176,11 +265,54 @@ type RuntimeConfig struct {
 	NoSSHKeyInMetadata bool          // don't add SSH key to platform metadata
 	NoEnableSelinux    bool          // don't enable selinux when starting or rebooting a machine
 	AllowFailedUnits   bool          // don't fail CheckMachine if a systemd unit has failed
+	ConfigDrive        bool          // pass userdata on a config drive on platforms supporting it
+	RequireIMDSv2      bool          // require session tokens for the instance metadata service on AWS
+	TrustedLaunch      bool          // launch Trusted Launch or Shielded VM instances on Azure and GCE
+	ConfidentialVM     bool          // launch Confidential VM instances on Azure and GCE
+	EnableIPv6         bool          // enable IPv6 networking in the userdata of the machines
+	GPU                bool          // launch instances with an NVIDIA GPU on AWS, Azure and GCE
+	NestedVirt         bool          // let QEMU machines run KVM guests
+	SELinuxMode        string        // see SELinuxMode field in Options
+	CgroupMode         string        // cgroup hierarchy of the machines, overriding CgroupMode in Options
 	SSHRetries         int           // see SSHRetries field in Options
 	SSHTimeout         time.Duration // see SSHTimeout field in Options
 
 	// DefaultUser is the user used for SSH connection, it will be created via Ignition when possible.
 	DefaultUser string
+
+	// RunAsUser is created on the machines with the SSH keys of the
+	// default user, if set.
+	RunAsUser *conf.User
+
+	// JournalSinks receive the journal entries of the machines while
+	// they run, in addition to journal.txt.
+	JournalSinks []JournalSink
+
+	// Tags label the cloud resources of the cluster, e.g. with the run
+	// and test they belong to. Platforms supporting tags or labels add
+	// them to the resources they create, adapted to their syntax.
+	Tags map[string]string
+
+	// OSReleaseID is the expected ID in /etc/os-release, empty skips the check.
+	// Defaults to the one of the distribution profile.
+	OSReleaseID string
+
+	// CloudInit makes CheckMachine wait for cloud-init and fail if it
+	// reported errors. It is set for cloud-init distributions.
+	CloudInit bool
+
+	// WireGuard is the overlay the machines join when they start, it
+	// is set if Options.WireGuardSubnet is.
+	WireGuard *WireGuardMesh
+
+	// ReadinessProbes are waited for in order by CheckMachine once the
+	// machine booted, before checking for failed units. Platforms may
+	// add their own to those of the test.
+	ReadinessProbes []ReadinessProbe
+
+	// TraceContext carries the span the spans of the cluster are recorded
+	// under, nil records them as root spans.
+	TraceContext context.Context
 }
 
 // Wrap a StdoutPipe as a io.ReadCloser
@@ -289,7 +421,15 @@ func InstallFile(in io.Reader, m Machine, to string) error {
 // NewMachines spawns n instances in cluster c, with
 // each instance passed the same userdata.
 func NewMachines(c Cluster, userdata *conf.UserData, n int) ([]Machine, error) {
+	return NewMachinesWithProgress(c, userdata, n, nil)
+}
+
+// NewMachinesWithProgress is like NewMachines but calls progress, if not
+// nil, with the number of machines up each time a machine came up. Network
+// errors creating the machines are returned as InfraError.
+func NewMachinesWithProgress(c Cluster, userdata *conf.UserData, n int, progress func(up int)) ([]Machine, error) {
 	var wg sync.WaitGroup
+	var up int32
 
 	mchan := make(chan Machine, n)
 	errchan := make(chan error, n)
@@ -300,10 +440,16 @@ func NewMachines(c Cluster, userdata *conf.UserData, n int) ([]Machine, error) {
 			defer wg.Done()
 			m, err := c.NewMachine(userdata)
 			if err != nil {
+				if IsNetworkError(err) && !IsBootError(err) {
+					err = &InfraError{Err: err}
+				}
 				errchan <- err
 			}
 			if m != nil {
 				mchan <- m
+				if progress != nil {
+					progress(int(atomic.AddInt32(&up, 1)))
+				}
 			}
 		}()
 	}
@@ -360,19 +506,34 @@ func CheckMachine(ctx context.Context, m Machine) error {
 		return fmt.Errorf("ssh unreachable or system not ready: %v", err)
 	}
 
-	// ensure we're talking to a Container Linux system
-	out, stderr, err := m.SSH("grep ^ID= /etc/os-release")
-	if err != nil {
-		return fmt.Errorf("no /etc/os-release file: %v: %s", err, stderr)
+	if rc.CloudInit {
+		out, stderr, err := m.SSH("cloud-init status --wait")
+		if err != nil {
+			return fmt.Errorf("cloud-init failed: %s: %v: %s", out, err, stderr)
+		}
 	}
 
-	if !bytes.Equal(out, []byte("ID=flatcar")) {
-		return fmt.Errorf("not a Flatcar Container Linux instance")
+	// ensure we're talking to the expected distribution
+	if id := rc.OSReleaseID; id != "" {
+		out, stderr, err := m.SSH("grep ^ID= /etc/os-release")
+		if err != nil {
+			return fmt.Errorf("no /etc/os-release file: %v: %s", err, stderr)
+		}
+
+		if !bytes.Equal(out, []byte("ID="+id)) {
+			return fmt.Errorf("not a %q instance: %s", id, out)
+		}
+	}
+
+	for _, probe := range rc.ReadinessProbes {
+		if err := probe.Wait(ctx, m); err != nil {
+			return fmt.Errorf("machine not ready: %w", err)
+		}
 	}
 
 	if !m.RuntimeConf().AllowFailedUnits {
 		// ensure no systemd units failed during boot
-		out, stderr, err = m.SSH("systemctl --no-legend --state failed list-units")
+		out, stderr, err := m.SSH("systemctl --no-legend --state failed list-units")
 		if err != nil {
 			return fmt.Errorf("systemctl: %s: %v: %s", out, err, stderr)
 		}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	origExec "os/exec"
 	"path/filepath"
@@ -36,6 +37,47 @@ import (
 type MachineOptions struct {
 	AdditionalDisks      []Disk
 	ExtraPrimaryDiskSize string
+
+	// LiveISO boots the machine once from this live ISO image, with a
+	// blank primary disk to install Flatcar to instead of the disk image.
+	LiveISO string
+
+	// Netboot boots the machine over the network with iPXE instead of
+	// from the disk image. The machine has no primary disk.
+	Netboot *Netboot
+
+	// RTCBase is the time the real-time clock of the machine starts at
+	// instead of the current time, e.g. to test certificate expiry.
+	// NTP must be disabled in the config to keep the clock of the
+	// system at it.
+	RTCBase time.Time
+
+	// NestedVirt exposes the virtualization extensions of the host CPU
+	// so the machine can run KVM guests, see NestedVirtCPUFeature.
+	NestedVirt bool
+
+	// AdditionalNICs is the number of network interfaces in addition to
+	// the primary one, eth1 and up, attached to the same network. They
+	// get addresses with DHCP unless configured otherwise, e.g. with
+	// conf.UserData.AddBond. Only supported on qemu.
+	AdditionalNICs int
+
+	// Networks attaches a network interface for each entry, following
+	// the primary and additional ones, to the isolated network of the
+	// cluster with that name. Machines using the same name share an L2
+	// segment without DHCP, so the interfaces need static addresses,
+	// e.g. with conf.UserData.AddNetwork. Only supported on qemu.
+	Networks []string
+}
+
+// Netboot holds the PXE images a machine boots over the network.
+type Netboot struct {
+	Kernel string // path to the kernel, flatcar_production_pxe.vmlinuz
+	Initrd string // path to the initrd, flatcar_production_pxe_image.cpio.gz
+
+	// Cmdline holds kernel arguments in addition to the ones booting
+	// the machine with its Ignition config.
+	Cmdline string
 }
 
 type Disk struct {
@@ -52,16 +94,15 @@ var (
 	primaryDiskOptions   = []string{"serial=primary-disk"}
 )
 
+// size of the blank primary disk of machines booting a live ISO, large
+// enough for the partitions of the disk image
+const installDiskSize = "12G"
+
 // Copy Container Linux input image and specialize copy for running kola tests.
-// Return FD to the copy, which is a deleted file.
+// The image hooks, if any, are applied to the copy after enabling console
+// logging. Return FD to the copy, which is a deleted file.
 // This is not mandatory; the tests will do their best without it.
-func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
-	seterr := func(err error) {
-		if result == nil {
-			result = err
-		}
-	}
-
+func MakeCLDiskTemplate(inputPath string, hooks []ImageHook) (*os.File, error) {
 	// create output file
 	outputPath, err := mkpath("/var/tmp")
 	if err != nil {
@@ -69,21 +110,76 @@ func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
 	}
 	defer os.Remove(outputPath)
 
-	// copy file
-	// cp is used since it supports sparse and reflink.
+	if err := copySparse(inputPath, outputPath); err != nil {
+		return nil, err
+	}
+
+	// write console settings to grub.cfg
+	err = withOEMPartition(outputPath, func(oemdir string) error {
+		return appendGrubConfig(oemdir, "set linux_console=\"console=ttyS0,115200\"\n")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ApplyImageHooks(outputPath, hooks); err != nil {
+		return nil, err
+	}
+
+	// return fd to output file
+	output, err := os.Open(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %v: %v", outputPath, err)
+	}
+	return output, nil
+}
+
+// copySparse copies a disk image. cp is used since it supports sparse and
+// reflink.
+func copySparse(inputPath, outputPath string) error {
 	cp := exec.Command("cp", "--force",
 		"--sparse=always", "--reflink=auto",
 		inputPath, outputPath)
 	cp.Stdout = os.Stdout
 	cp.Stderr = os.Stderr
 	if err := cp.Run(); err != nil {
-		return nil, fmt.Errorf("copying file: %v", err)
+		return fmt.Errorf("copying file: %v", err)
+	}
+	return nil
+}
+
+// appendGrubConfig appends settings to the grub.cfg in the OEM partition.
+func appendGrubConfig(oemdir, settings string) error {
+	f, err := os.OpenFile(filepath.Join(oemdir, "grub.cfg"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("opening grub.cfg: %v", err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(settings); err != nil {
+		return fmt.Errorf("writing grub.cfg: %v", err)
+	}
+	return nil
+}
+
+// withOEMPartition mounts the OEM partition of the raw Container Linux
+// image at imagePath and calls fn with the mount point.
+func withOEMPartition(imagePath string, fn func(oemdir string) error) error {
+	return withPartition(imagePath, 6, fn)
+}
+
+// withPartition mounts the partition with the given number of the raw disk
+// image and calls fn with the mount point.
+func withPartition(imagePath string, partition int, fn func(dir string) error) (result error) {
+	seterr := func(err error) {
+		if result == nil {
+			result = err
+		}
 	}
 
 	// create mount point
 	tmpdir, err := ioutil.TempDir("", "kola-qemu-")
 	if err != nil {
-		return nil, fmt.Errorf("making temporary directory: %v", err)
+		return fmt.Errorf("making temporary directory: %v", err)
 	}
 	defer func() {
 		if err := os.Remove(tmpdir); err != nil {
@@ -92,22 +188,22 @@ func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
 	}()
 
 	// set up loop device
-	cmd := exec.Command("losetup", "-Pf", "--show", outputPath)
+	cmd := exec.Command("losetup", "-Pf", "--show", imagePath)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("getting stdout pipe: %v", err)
+		return fmt.Errorf("getting stdout pipe: %v", err)
 	}
 	defer stdout.Close()
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("running losetup: %v", err)
+		return fmt.Errorf("running losetup: %v", err)
 	}
 	buf, err := ioutil.ReadAll(stdout)
 	if err != nil {
 		cmd.Wait()
-		return nil, fmt.Errorf("reading losetup output: %v", err)
+		return fmt.Errorf("reading losetup output: %v", err)
 	}
 	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("setting up loop device: %v", err)
+		return fmt.Errorf("setting up loop device: %v", err)
 	}
 	loopdev := strings.TrimSpace(string(buf))
 	defer func() {
@@ -116,35 +212,35 @@ func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
 		}
 	}()
 
-	// wait for OEM block device
-	oemdev := loopdev + "p6"
+	// wait for partition block device
+	partdev := fmt.Sprintf("%sp%d", loopdev, partition)
 	err = util.RetryConditional(1000, 5*time.Millisecond, os.IsNotExist,
 		func() error {
-			_, err := os.Stat(oemdev)
+			_, err := os.Stat(partdev)
 			return err
 		})
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("timed out waiting for device node %s; did you specify a qcow image by mistake?", oemdev)
+			return fmt.Errorf("timed out waiting for device node %s; did you specify a qcow image by mistake?", partdev)
 		}
-		return nil, fmt.Errorf("failed to get loop device %s: %v", oemdev, err)
+		return fmt.Errorf("failed to get loop device %s: %v", partdev, err)
 	}
 
-	// mount OEM partition, wait for exclusive access to the file system in case some other process also mounted an identical OEM btrfs filesystem
+	// mount partition, wait for exclusive access to the file system in case some other process also mounted an identical btrfs filesystem, e.g. OEM
 	err = util.RetryConditional(600, 1000*time.Millisecond, func(err error) bool {
 		if exitCode, ok := err.(*origExec.ExitError); ok && exitCode.ProcessState.ExitCode() == 32 {
-			plog.Noticef("waiting for exclusive access to the OEM btrfs filesystem")
+			plog.Noticef("waiting for exclusive access to the btrfs filesystem on %s", partdev)
 			return true
 		}
 		return false
 	}, func() error {
-		return exec.Command("mount", oemdev, tmpdir).Run()
+		return exec.Command("mount", partdev, tmpdir).Run()
 	})
 	if err != nil {
 		if exitCode, ok := err.(*origExec.ExitError); ok && exitCode.ProcessState.ExitCode() == 32 {
-			return nil, fmt.Errorf("timed out waiting to mount the OEM btrfs filesystem exclusively from %s on %s: %v", oemdev, tmpdir, err)
+			return fmt.Errorf("timed out waiting to mount the btrfs filesystem exclusively from %s on %s: %v", partdev, tmpdir, err)
 		}
-		return nil, fmt.Errorf("mounting OEM partition %s on %s: %v", oemdev, tmpdir, err)
+		return fmt.Errorf("mounting partition %s on %s: %v", partdev, tmpdir, err)
 	}
 	defer func() {
 		if err := exec.Command("umount", tmpdir).Run(); err != nil {
@@ -152,22 +248,7 @@ func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
 		}
 	}()
 
-	// write console settings to grub.cfg
-	f, err := os.OpenFile(filepath.Join(tmpdir, "grub.cfg"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("opening grub.cfg: %v", err)
-	}
-	defer f.Close()
-	if _, err = f.WriteString("set linux_console=\"console=ttyS0,115200\"\n"); err != nil {
-		return nil, fmt.Errorf("writing grub.cfg: %v", err)
-	}
-
-	// return fd to output file
-	output, err = os.Open(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("opening %v: %v", outputPath, err)
-	}
-	return
+	return fn(tmpdir)
 }
 
 func (d Disk) getOpts() string {
@@ -290,7 +371,10 @@ func mkpath(basedir string) (string, error) {
 	return f.Name(), nil
 }
 
-func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImagePath string, isIgnition bool, options MachineOptions) ([]string, []*os.File, error) {
+// CreateQEMUCommand returns the command line of a QEMU machine. The serial
+// console is logged to consolePath and, if consoleSocket is set, can be
+// connected to with ConnectQEMUConsole.
+func CreateQEMUCommand(board, uuid, biosImage, consolePath, consoleSocket, confPath, diskImagePath string, isIgnition bool, options MachineOptions) ([]string, []*os.File, error) {
 	var qmCmd []string
 
 	// As we expand this list of supported native + board
@@ -301,11 +385,19 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 	combo := runtime.GOARCH + "--" + board
 	switch combo {
 	case "amd64--amd64-usr":
+		cpu := "host"
+		if options.NestedVirt {
+			feature, err := NestedVirtCPUFeature()
+			if err != nil {
+				return nil, nil, fmt.Errorf("nested virtualization: %v", err)
+			}
+			cpu += ",+" + feature
+		}
 		qmBinary = "qemu-system-x86_64"
 		qmCmd = []string{
 			"qemu-system-x86_64",
 			"-machine", "accel=kvm",
-			"-cpu", "host",
+			"-cpu", cpu,
 			"-m", "2512",
 		}
 	case "amd64--arm64-usr":
@@ -335,21 +427,36 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 	default:
 		panic("host-guest combo not supported: " + combo)
 	}
+	if options.NestedVirt && combo != "amd64--amd64-usr" {
+		return nil, nil, fmt.Errorf("nested virtualization is not supported for %s", combo)
+	}
 
 	qmCmd = append(qmCmd,
 		"-bios", biosImage,
 		"-smp", "4",
 		"-uuid", uuid,
 		"-display", "none",
-		"-chardev", "file,id=log,path="+consolePath,
+		"-chardev", consoleChardev(consolePath, consoleSocket),
 		"-serial", "chardev:log",
 		"-object", "rng-random,filename=/dev/urandom,id=rng0",
 		"-device", "virtio-rng-pci,rng=rng0",
 	)
+	if !options.RTCBase.IsZero() {
+		qmCmd = append(qmCmd, "-rtc", "base="+options.RTCBase.UTC().Format("2006-01-02T15:04:05"))
+	}
 
-	if isIgnition {
+	if options.Netboot != nil {
+		// the Ignition config is only passed on the kernel command
+		// line, which is what netbooting is tested for
+		qmCmd = append(qmCmd, "-boot", "order=n")
+	} else if isIgnition {
 		qmCmd = append(qmCmd,
 			"-fw_cfg", "name=opt/org.flatcar-linux/config,file="+confPath)
+	} else if strings.HasSuffix(confPath, ".iso") {
+		// a NoCloud seed for cloud-init, found by its label
+		qmCmd = append(qmCmd,
+			"-drive", "if=none,id=cfg,format=raw,readonly=on,file="+confPath,
+			"-device", Virtio(board, "blk", "drive=cfg"))
 	} else {
 		qmCmd = append(qmCmd,
 			"-fsdev", "local,id=cfg,security_model=none,readonly=on,path="+confPath,
@@ -376,13 +483,26 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 		plog.Debugf("disabling auto-read-only for QEMU drives")
 	}
 
-	allDisks := append([]Disk{
-		{
-			BackingFile:   diskImagePath,
-			DeviceOpts:    primaryDiskOptions,
-			ExtraDiskSize: options.ExtraPrimaryDiskSize,
-		},
-	}, options.AdditionalDisks...)
+	primaryDisk := Disk{
+		BackingFile:   diskImagePath,
+		DeviceOpts:    primaryDiskOptions,
+		ExtraDiskSize: options.ExtraPrimaryDiskSize,
+	}
+	if options.LiveISO != "" {
+		if board != "amd64-usr" {
+			return nil, nil, fmt.Errorf("booting a live ISO is not supported on %s", board)
+		}
+		primaryDisk = Disk{
+			Size:       installDiskSize,
+			DeviceOpts: primaryDiskOptions,
+		}
+		// after the first boot the machine boots from the disk
+		qmCmd = append(qmCmd, "-cdrom", options.LiveISO, "-boot", "once=d")
+	}
+	allDisks := append([]Disk{primaryDisk}, options.AdditionalDisks...)
+	if options.Netboot != nil {
+		allDisks = options.AdditionalDisks
+	}
 
 	var extraFiles []*os.File
 	fdnum := 3 // first additional file starts at position 3
@@ -407,6 +527,40 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 	return qmCmd, extraFiles, nil
 }
 
+func consoleChardev(consolePath, consoleSocket string) string {
+	if consoleSocket == "" {
+		return "file,id=log,path=" + consolePath
+	}
+	return fmt.Sprintf("socket,id=log,path=%s,server=on,wait=off,logfile=%s", consoleSocket, consolePath)
+}
+
+// NewQEMUConsoleSocket returns the path for the socket of the serial
+// console of a QEMU machine, in a new temporary directory since the path of
+// Unix sockets is limited to 108 bytes. RemoveQEMUConsoleSocket removes it.
+func NewQEMUConsoleSocket() (string, error) {
+	dir, err := ioutil.TempDir("", "mantle-console")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "console.sock"), nil
+}
+
+// RemoveQEMUConsoleSocket removes the socket created by QEMU at path and
+// its directory.
+func RemoveQEMUConsoleSocket(path string) error {
+	return os.RemoveAll(filepath.Dir(path))
+}
+
+// ConnectQEMUConsole connects to the serial console of a QEMU machine
+// created with the socket path.
+func ConnectQEMUConsole(path string) (*SerialConsole, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to serial console: %v", err)
+	}
+	return NewSerialConsole(conn), nil
+}
+
 // The virtio device name differs between machine types but otherwise
 // configuration is the same. Use this to help construct device args.
 func Virtio(board, device, args string) string {
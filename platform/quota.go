@@ -0,0 +1,52 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuotaChecker is implemented by flights which can check the service
+// quotas of the cloud account before tests are scheduled.
+type QuotaChecker interface {
+	// CheckQuota fails if the quotas don't leave room for running the
+	// given number of machines at the same time.
+	CheckQuota(machines int) error
+}
+
+// Quota is a limit of a cloud account together with its current usage and
+// the additional usage planned by a run.
+type Quota struct {
+	Name  string
+	Limit float64
+	Usage float64
+	Need  float64
+}
+
+// CheckQuotas fails with a message listing all quotas which are too low
+// for the planned usage.
+func CheckQuotas(quotas []Quota) error {
+	var exceeded []string
+	for _, q := range quotas {
+		if q.Usage+q.Need > q.Limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s: need %g but only %g of %g available", q.Name, q.Need, q.Limit-q.Usage, q.Limit))
+		}
+	}
+	if len(exceeded) > 0 {
+		return fmt.Errorf("quota exceeded, lower --parallel or raise the quota: %s", strings.Join(exceeded, "; "))
+	}
+	return nil
+}
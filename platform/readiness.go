@@ -0,0 +1,128 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultProbeTimeout is how long CheckMachine waits for a readiness
+	// probe without a Timeout.
+	DefaultProbeTimeout = 2 * time.Minute
+
+	probeInterval = 2 * time.Second
+)
+
+// ErrProbeFailed is wrapped by the errors of readiness probes which will
+// not succeed by waiting longer, e.g. because a unit failed.
+var ErrProbeFailed = errors.New("readiness probe failed")
+
+// ReadinessProbe is a condition a machine has to meet before CheckMachine
+// considers it ready, in addition to SSH working and systemd having
+// finished the boot. Tests and platforms use them to wait for services,
+// e.g. a container runtime or an agent, instead of sleeping.
+type ReadinessProbe struct {
+	// Name identifies the probe in errors, e.g. "unit docker.service".
+	Name string
+	// Check returns nil once m is ready. Other errors are retried until
+	// the probe times out, except for those wrapping ErrProbeFailed.
+	Check func(m Machine) error
+	// Timeout defaults to DefaultProbeTimeout.
+	Timeout time.Duration
+}
+
+// Wait runs the probe on m until it succeeds, fails for good or times out.
+func (p ReadinessProbe) Wait(ctx context.Context, m Machine) error {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := p.Check(m)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrProbeFailed) {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s: not ready after %v: %v", p.Name, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// UnitActiveProbe waits for the systemd unit to be active. It fails at once
+// if the unit failed.
+func UnitActiveProbe(unit string) ReadinessProbe {
+	return ReadinessProbe{
+		Name: "unit " + unit,
+		Check: func(m Machine) error {
+			// is-active exits non-zero for any state but active
+			out, _, _ := m.SSH("systemctl is-active " + shellQuote(unit))
+			switch state := string(out); state {
+			case "active":
+				return nil
+			case "failed":
+				return fmt.Errorf("%w: %s is failed", ErrProbeFailed, unit)
+			default:
+				return fmt.Errorf("%s is %q", unit, state)
+			}
+		},
+	}
+}
+
+// HTTPProbe waits for url to answer with a successful status. It is
+// fetched with curl on the machine, so it may be local to the machine,
+// e.g. "http://127.0.0.1:8080/healthz".
+func HTTPProbe(url string) ReadinessProbe {
+	return ReadinessProbe{
+		Name: "URL " + url,
+		Check: func(m Machine) error {
+			if _, stderr, err := m.SSH("curl -sSf -o /dev/null -m 10 " + shellQuote(url)); err != nil {
+				return fmt.Errorf("%v: %s", err, stderr)
+			}
+			return nil
+		},
+	}
+}
+
+// CommandProbe waits for the shell command cmd to succeed on the machine.
+func CommandProbe(cmd string) ReadinessProbe {
+	return ReadinessProbe{
+		Name: "command " + cmd,
+		Check: func(m Machine) error {
+			if out, stderr, err := m.SSH(cmd); err != nil {
+				return fmt.Errorf("%v: %s%s", err, out, stderr)
+			}
+			return nil
+		},
+	}
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
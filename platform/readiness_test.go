@@ -0,0 +1,75 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unitMachine answers systemctl is-active with the given states in turn.
+type unitMachine struct {
+	Machine
+	states []string
+	checks int
+}
+
+func (m *unitMachine) SSH(cmd string) ([]byte, []byte, error) {
+	if cmd != "systemctl is-active 'docker.service'" {
+		return nil, nil, errors.New("unexpected command " + cmd)
+	}
+	state := m.states[len(m.states)-1]
+	if m.checks < len(m.states) {
+		state = m.states[m.checks]
+	}
+	m.checks++
+	if state != "active" {
+		return []byte(state), nil, errors.New("exit status 3")
+	}
+	return []byte(state), nil, nil
+}
+
+func TestUnitActiveProbe(t *testing.T) {
+	ctx := context.Background()
+
+	m := &unitMachine{states: []string{"activating", "active"}}
+	if err := UnitActiveProbe("docker.service").Wait(ctx, m); err != nil {
+		t.Errorf("activating then active: %v", err)
+	}
+
+	m = &unitMachine{states: []string{"failed", "active"}}
+	if err := UnitActiveProbe("docker.service").Wait(ctx, m); !errors.Is(err, ErrProbeFailed) {
+		t.Errorf("failed: got %v", err)
+	} else if m.checks != 1 {
+		t.Errorf("failed: checked %d times", m.checks)
+	}
+
+	m = &unitMachine{states: []string{"inactive"}}
+	probe := UnitActiveProbe("docker.service")
+	probe.Timeout = time.Nanosecond
+	if err := probe.Wait(ctx, m); err == nil || !strings.Contains(err.Error(), `docker.service is "inactive"`) {
+		t.Errorf("inactive: got %v", err)
+	}
+
+	m = &unitMachine{states: []string{"activating"}}
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := UnitActiveProbe("docker.service").Wait(ctx, m); err != context.Canceled {
+		t.Errorf("canceled: got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The SELinux modes machines boot in, see Options.SELinuxMode.
+const (
+	SELinuxEnforcing  = "enforcing"
+	SELinuxPermissive = "permissive"
+)
+
+// SELinuxModes are the valid values of Options.SELinuxMode.
+var SELinuxModes = []string{SELinuxEnforcing, SELinuxPermissive}
+
+// CheckSELinuxMode fails if SELinux on m is not in mode, e.g. because the
+// policy failed to load.
+func CheckSELinuxMode(m Machine, mode string) error {
+	out, stderr, err := m.SSH("getenforce")
+	if err != nil {
+		return fmt.Errorf("getenforce: %s: %s", err, stderr)
+	}
+	if got := strings.ToLower(strings.TrimSpace(string(out))); got != mode {
+		return fmt.Errorf("SELinux is %s, expected %s", got, mode)
+	}
+	return nil
+}
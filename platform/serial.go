@@ -0,0 +1,127 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// SerialConsoleMachine is implemented by machines whose serial console
+// tests can interact with, e.g. with the emergency shell, the GRUB menu or
+// boot prompts.
+type SerialConsoleMachine interface {
+	Machine
+
+	// SerialConsole connects to the serial console of the machine. Its
+	// output is still recorded in ConsoleOutput. The caller must close
+	// the console.
+	SerialConsole() (*SerialConsole, error)
+}
+
+// SerialConsole is an interactive connection to the serial console of a
+// machine. Output is buffered from the time of connecting until it is
+// consumed by Expect.
+type SerialConsole struct {
+	conn io.ReadWriteCloser
+
+	lock    sync.Mutex
+	buf     bytes.Buffer
+	err     error
+	updated chan struct{}
+}
+
+// NewSerialConsole reads the output of the console connection conn until
+// it is closed.
+func NewSerialConsole(conn io.ReadWriteCloser) *SerialConsole {
+	c := &SerialConsole{
+		conn:    conn,
+		updated: make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *SerialConsole) read() {
+	b := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(b)
+		c.lock.Lock()
+		c.buf.Write(b[:n])
+		if err != nil {
+			c.err = err
+		}
+		close(c.updated)
+		c.updated = make(chan struct{})
+		c.lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write writes p to the console as typed input.
+func (c *SerialConsole) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+// Send types s on the console.
+func (c *SerialConsole) Send(s string) error {
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// SendLine types s on the console followed by enter.
+func (c *SerialConsole) SendLine(s string) error {
+	return c.Send(s + "\r")
+}
+
+// Expect waits until the output not consumed yet matches re and returns
+// it up to the end of the match, which is consumed. It fails if there is
+// no match within timeout or the console was closed.
+func (c *SerialConsole) Expect(re *regexp.Regexp, timeout time.Duration) (string, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		c.lock.Lock()
+		if loc := re.FindIndex(c.buf.Bytes()); loc != nil {
+			out := string(c.buf.Next(loc[1]))
+			c.lock.Unlock()
+			return out, nil
+		}
+		if c.err != nil {
+			err := c.err
+			c.lock.Unlock()
+			return "", fmt.Errorf("waiting for %q on console: %v", re, err)
+		}
+		updated := c.updated
+		c.lock.Unlock()
+
+		select {
+		case <-updated:
+		case <-deadline.C:
+			return "", fmt.Errorf("timed out after %v waiting for %q on console", timeout, re)
+		}
+	}
+}
+
+// Close disconnects from the console.
+func (c *SerialConsole) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,71 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSerialConsole(t *testing.T) {
+	guest, host := net.Pipe()
+	c := NewSerialConsole(host)
+	defer c.Close()
+
+	// a shell echoing the typed commands
+	go func() {
+		io.WriteString(guest, "Press Enter for emergency shell\n")
+		r := bufio.NewReader(guest)
+		for {
+			line, err := r.ReadString('\r')
+			if err != nil {
+				return
+			}
+			io.WriteString(guest, line+"\n# ")
+		}
+	}()
+
+	out, err := c.Expect(regexp.MustCompile(`emergency shell`), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Press Enter for emergency shell" {
+		t.Errorf("got %q", out)
+	}
+
+	if err := c.SendLine("systemctl status"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = c.Expect(regexp.MustCompile(`# $`), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "\nsystemctl status\r\n# " {
+		t.Errorf("got %q", out)
+	}
+
+	if _, err := c.Expect(regexp.MustCompile(`never`), 10*time.Millisecond); err == nil {
+		t.Error("expected timeout")
+	}
+
+	guest.Close()
+	if _, err := c.Expect(regexp.MustCompile(`never`), 10*time.Second); err == nil {
+		t.Error("expected error after the console was closed")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpServerCmd runs the SFTP server of the machine as root, so files can
+// be written anywhere. The SFTP subsystem of sshd would run as the SSH
+// user.
+const sftpServerCmd = `for p in /usr/lib64/misc/sftp-server /usr/lib/misc/sftp-server /usr/libexec/sftp-server /usr/libexec/openssh/sftp-server /usr/lib/openssh/sftp-server; do if [ -x "$p" ]; then exec sudo "$p"; fi; done; echo "no sftp-server found" >&2; exit 127`
+
+// TransferProgress is called during a transfer with the number of bytes
+// transferred so far and the total, which is -1 if unknown.
+type TransferProgress func(done, total int64)
+
+// SFTPClient is an SFTP session with root privileges on a machine.
+type SFTPClient struct {
+	*sftp.Client
+	ssh *ssh.Client
+}
+
+// NewSFTPClient opens an SFTP session to m. The caller must close it.
+func NewSFTPClient(m Machine) (*SFTPClient, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.Start(sftpServerCmd); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed starting sftp-server: %v", err)
+	}
+
+	sc, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed starting SFTP session: %v", err)
+	}
+	return &SFTPClient{Client: sc, ssh: client}, nil
+}
+
+// Close ends the SFTP session and closes its SSH connection.
+func (c *SFTPClient) Close() error {
+	err := c.Client.Close()
+	if cerr := c.ssh.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Upload streams the data of r to the file at to on m with the given mode,
+// creating the parent directories. size is the length of the data for the
+// progress reports, -1 if unknown. The SHA-256 checksum of the written file
+// is verified.
+func Upload(m Machine, r io.Reader, size int64, to string, mode os.FileMode, progress TransferProgress) error {
+	c, err := NewSFTPClient(m)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	h, err := c.write(r, size, to, mode, progress)
+	if err != nil {
+		return err
+	}
+	return verifyChecksum(m, to, h)
+}
+
+// write streams the data of r to the file at to, see Upload, and returns
+// the checksum of the data written.
+func (c *SFTPClient) write(r io.Reader, size int64, to string, mode os.FileMode, progress TransferProgress) (hash.Hash, error) {
+	if err := c.MkdirAll(path.Dir(to)); err != nil {
+		return nil, fmt.Errorf("failed creating directory of %s: %v", to, err)
+	}
+	f, err := c.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating %s: %v", to, err)
+	}
+
+	h := sha256.New()
+	pw := &progressWriter{total: size, progress: progress}
+	_, err = f.ReadFromWithConcurrency(io.TeeReader(r, io.MultiWriter(h, pw)), 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed writing %s: %v", to, err)
+	}
+	if err := c.Chmod(to, mode); err != nil {
+		return nil, fmt.Errorf("failed setting mode of %s: %v", to, err)
+	}
+	return h, nil
+}
+
+// UploadFile uploads the local file at from to the file at to on m, keeping
+// its mode. See Upload.
+func UploadFile(m Machine, from, to string, progress TransferProgress) error {
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return Upload(m, f, info.Size(), to, info.Mode().Perm(), progress)
+}
+
+// UploadDir uploads the contents of the local directory from to the
+// directory to on m, keeping the modes of the files. Symbolic links to
+// files are followed. The SHA-256 checksums of the written files are verified.
+func UploadDir(m Machine, from, to string) error {
+	c, err := NewSFTPClient(m)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	sums := make(map[string]hash.Hash)
+	err = filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(to, filepath.ToSlash(rel))
+		if info.IsDir() {
+			if err := c.MkdirAll(target); err != nil {
+				return fmt.Errorf("failed creating directory %s: %v", target, err)
+			}
+			return c.Chmod(target, info.Mode().Perm())
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err = f.Stat()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", p)
+		}
+		h, err := c.write(f, info.Size(), target, info.Mode().Perm(), nil)
+		if err != nil {
+			return err
+		}
+		sums[target] = h
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for target, h := range sums {
+		if err := verifyChecksum(m, target, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download streams the file at from on m to w. The SHA-256 checksum of the
+// received data is verified.
+func Download(m Machine, from string, w io.Writer, progress TransferProgress) error {
+	c, err := NewSFTPClient(m)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	f, err := c.Open(from)
+	if err != nil {
+		return fmt.Errorf("failed opening %s: %v", from, err)
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	h := sha256.New()
+	pw := &progressWriter{total: size, progress: progress}
+	if _, err := f.WriteTo(io.MultiWriter(w, h, pw)); err != nil {
+		return fmt.Errorf("failed reading %s: %v", from, err)
+	}
+
+	return verifyChecksum(m, from, h)
+}
+
+// verifyChecksum compares the SHA-256 checksum of the file at path on m with
+// the one of the data transferred.
+func verifyChecksum(m Machine, path string, h hash.Hash) error {
+	out, stderr, err := m.SSH(fmt.Sprintf("sudo sha256sum %s", path))
+	if err != nil {
+		return fmt.Errorf("failed computing checksum of %s: %s: %v", path, stderr, err)
+	}
+	fields := strings.Fields(string(out))
+	want := hex.EncodeToString(h.Sum(nil))
+	if len(fields) == 0 || fields[0] != want {
+		return fmt.Errorf("checksum mismatch for %s: got %q, transferred %s", path, out, want)
+	}
+	return nil
+}
+
+// progressWriter reports the number of bytes written to it.
+type progressWriter struct {
+	done     int64
+	total    int64
+	progress TransferProgress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if p.progress != nil {
+		p.progress(p.done, p.total)
+	}
+	return len(b), nil
+}
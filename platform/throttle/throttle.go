@@ -0,0 +1,233 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttle limits the rate of the cloud API calls made by mantle
+// and retries the calls rejected by rate limits with exponential backoff
+// and jitter, so large parallel runs don't fail spuriously when they
+// exceed the budget of an account.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/flatcar/mantle/platform/metrics"
+)
+
+const (
+	// MaxRetries is how often a throttled call is retried.
+	MaxRetries = 8
+	// MinDelay and MaxDelay bound the backoff before a retry.
+	MinDelay = 500 * time.Millisecond
+	MaxDelay = 60 * time.Second
+)
+
+// Budget is the rate of calls allowed to a service, shared by all clients
+// of the service in the process.
+type Budget struct {
+	// Rate is the number of calls per second, unlimited if zero.
+	Rate float64
+	// Burst is the number of calls allowed at once, at least 1.
+	Burst int
+}
+
+// DefaultBudgets are well below the documented limits of the services,
+// which are shared with other users of the same account.
+var DefaultBudgets = map[string]Budget{
+	"ec2":          {Rate: 20, Burst: 50},
+	"iam":          {Rate: 5, Burst: 10},
+	"azure":        {Rate: 5, Burst: 50},
+	"gce":          {Rate: 10, Burst: 20},
+	"digitalocean": {Rate: 1, Burst: 20},
+	"equinixmetal": {Rate: 5, Burst: 10},
+	"scaleway":     {Rate: 5, Burst: 10},
+}
+
+var (
+	mu       sync.Mutex
+	budgets  = make(map[string]Budget)
+	limiters = make(map[string]*rate.Limiter)
+)
+
+// SetBudget sets the budget of service, replacing the default one. A zero
+// rate removes the limit.
+func SetBudget(service string, b Budget) {
+	mu.Lock()
+	defer mu.Unlock()
+	budgets[service] = b
+	delete(limiters, service)
+}
+
+// ParseBudget parses a budget given as service=rate[:burst], e.g.
+// "ec2=10:20". The burst defaults to the rate, rounded up.
+func ParseBudget(spec string) (string, Budget, error) {
+	service, value, ok := strings.Cut(spec, "=")
+	if !ok || service == "" {
+		return "", Budget{}, fmt.Errorf("invalid API rate limit %q, expected service=rate[:burst]", spec)
+	}
+	rateStr, burstStr, hasBurst := strings.Cut(value, ":")
+	r, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || r < 0 {
+		return "", Budget{}, fmt.Errorf("invalid rate in API rate limit %q", spec)
+	}
+	b := Budget{Rate: r, Burst: int(r)}
+	if float64(b.Burst) < r {
+		b.Burst++
+	}
+	if hasBurst {
+		b.Burst, err = strconv.Atoi(burstStr)
+		if err != nil || b.Burst < 1 {
+			return "", Budget{}, fmt.Errorf("invalid burst in API rate limit %q", spec)
+		}
+	}
+	return service, b, nil
+}
+
+// limiter returns the limiter of service, nil if it is unlimited.
+func limiter(service string) *rate.Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := limiters[service]; ok {
+		return l
+	}
+	b, ok := budgets[service]
+	if !ok {
+		b = DefaultBudgets[service]
+	}
+	var l *rate.Limiter
+	if b.Rate > 0 {
+		burst := b.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		l = rate.NewLimiter(rate.Limit(b.Rate), burst)
+	}
+	limiters[service] = l
+	return l
+}
+
+// Wait blocks until the budget of service allows another call or ctx is
+// done.
+func Wait(ctx context.Context, service string) error {
+	l := limiter(service)
+	if l == nil {
+		return nil
+	}
+	return l.Wait(ctx)
+}
+
+// Backoff returns the delay before retry number attempt, counted from 0:
+// a random duration between half and all of MinDelay doubled attempt
+// times, capped at MaxDelay. The jitter keeps parallel clients throttled
+// at the same time from retrying in lockstep.
+func Backoff(attempt int) time.Duration {
+	max := MaxDelay
+	if attempt < 16 && MinDelay<<uint(attempt) < MaxDelay {
+		max = MinDelay << uint(attempt)
+	}
+	return max/2 + time.Duration(rand.Int63n(int64(max/2)))
+}
+
+// IsThrottled reports whether an HTTP response rejects a call because of
+// rate limits, which is worth retrying later.
+func IsThrottled(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable)
+}
+
+// retryAfter returns the delay requested by the Retry-After header of
+// resp, in seconds or as a date, or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Do sends req with send within the budget of service and retries it
+// while it is throttled, waiting at least as long as the service asks
+// for. Requests with a body are only retried if it can be read again,
+// see http.Request.GetBody.
+func Do(service string, req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := Wait(ctx, service); err != nil {
+			return nil, err
+		}
+		resp, err := send(req)
+		if err != nil || !IsThrottled(resp) || attempt == MaxRetries {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+
+		delay := Backoff(attempt)
+		if d := retryAfter(resp); d > delay {
+			delay = d
+		}
+		resp.Body.Close()
+		metrics.APIThrottled(service)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
+
+type transport struct {
+	service string
+	rt      http.RoundTripper
+}
+
+// Transport wraps rt to send all requests through Do with the budget of
+// service.
+func Transport(service string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{service: service, rt: rt}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return Do(t.service, req, t.rt.RoundTrip)
+}
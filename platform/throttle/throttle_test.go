@@ -0,0 +1,88 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransportRetriesThrottled(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("call %d: got body %q", calls, body)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	SetBudget("test", Budget{Rate: 1000, Burst: 1})
+	client := &http.Client{Transport: Transport("test", nil)}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("got status %d after %d calls, want 200 after 3", resp.StatusCode, calls)
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	for _, tt := range []struct {
+		spec    string
+		service string
+		budget  Budget
+		err     bool
+	}{
+		{spec: "ec2=10:20", service: "ec2", budget: Budget{Rate: 10, Burst: 20}},
+		{spec: "gce=2.5", service: "gce", budget: Budget{Rate: 2.5, Burst: 3}},
+		{spec: "azure=0", service: "azure", budget: Budget{}},
+		{spec: "ec2", err: true},
+		{spec: "=5", err: true},
+		{spec: "ec2=fast", err: true},
+		{spec: "ec2=5:0", err: true},
+	} {
+		service, budget, err := ParseBudget(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: got error %v", tt.spec, err)
+			continue
+		}
+		if service != tt.service || budget != tt.budget {
+			t.Errorf("%q: got %s %+v, want %s %+v", tt.spec, service, budget, tt.service, tt.budget)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		d := Backoff(attempt)
+		max := MaxDelay
+		if attempt < 7 {
+			max = MinDelay << uint(attempt)
+		}
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: got %v, want between %v and %v", attempt, d, max/2, max)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records OpenTelemetry spans of the phases of a test,
+// like creating machines, rendering Ignition configs and waiting for SSH,
+// and exports them over OTLP so slow provisioning paths can be analyzed.
+//
+// Until Start is called spans are not recorded and cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/flatcar/mantle"
+
+	shutdownTimeout = 30 * time.Second
+)
+
+var (
+	providerLock sync.Mutex
+	provider     *sdktrace.TracerProvider
+)
+
+// Start exports the spans over OTLP/HTTP to endpoint, the host:port of
+// an OpenTelemetry collector. service is reported as the service name.
+func Start(endpoint, service string, insecure bool) error {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if provider != nil {
+		return fmt.Errorf("tracing is already started")
+	}
+
+	opts := []otlphttp.Option{otlphttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlphttp.WithInsecure())
+	}
+	exporter, err := otlp.NewExporter(context.Background(), otlphttp.NewDriver(opts...))
+	if err != nil {
+		return fmt.Errorf("creating OTLP exporter: %v", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Stop flushes the recorded spans and stops exporting them.
+func Stop() error {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if provider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := provider.Shutdown(ctx)
+	provider = nil
+	return err
+}
+
+// StartSpan starts a span named name as a child of the span in ctx, if
+// any. A nil ctx starts a root span.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
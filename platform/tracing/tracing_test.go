@@ -0,0 +1,46 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStartStop(t *testing.T) {
+	if err := Start("127.0.0.1:4318", "kola", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Start("127.0.0.1:4318", "kola", true); err == nil {
+		t.Error("expected error starting tracing twice")
+	}
+
+	ctx, span := StartSpan(nil, "test")
+	if !span.SpanContext().IsValid() {
+		t.Error("expected a recorded span")
+	}
+	_, child := StartSpan(ctx, "test.run")
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Error("expected the child span in the trace of its parent")
+	}
+	End(child, errors.New("failed"))
+	End(span, nil)
+
+	// nothing listens on the endpoint, the export error is not checked
+	Stop()
+	if err := Stop(); err != nil {
+		t.Errorf("stopping twice: %v", err)
+	}
+}
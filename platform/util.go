@@ -20,24 +20,27 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"os"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/flatcar/mantle/platform/metrics"
+	"github.com/flatcar/mantle/platform/tracing"
 )
 
 // Manhole connects os.Stdin, os.Stdout, and os.Stderr to an interactive shell
 // session on the Machine m. Manhole blocks until the shell session has ended.
 // If os.Stdin does not refer to a TTY, Manhole returns immediately with a nil
-// error.
-func Manhole(m Machine) error {
-	fd := int(os.Stdin.Fd())
-	if !terminal.IsTerminal(fd) {
+// error. If forwardAgent is set, the SSH agent of kola, whose key is
+// authorized on all machines of the flight, is forwarded to the session.
+func Manhole(m Machine, forwardAgent bool) error {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
 		return nil
 	}
 
-	tstate, _ := terminal.MakeRaw(fd)
-	defer terminal.Restore(fd, tstate)
-
 	client, err := m.SSHClient()
 	if err != nil {
 		return fmt.Errorf("SSH client failed: %v", err)
@@ -45,6 +48,21 @@ func Manhole(m Machine) error {
 
 	defer client.Close()
 
+	return Shell(client, forwardAgent)
+}
+
+// Shell is like Manhole for an established SSH connection. If forwardAgent
+// is set, the agent the client forwards requests to, see
+// agent.ForwardToAgent, is forwarded to the session.
+func Shell(client *ssh.Client, forwardAgent bool) error {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil
+	}
+
+	tstate, _ := terminal.MakeRaw(fd)
+	defer terminal.Restore(fd, tstate)
+
 	session, err := client.NewSession()
 	if err != nil {
 		return fmt.Errorf("SSH session failed: %v", err)
@@ -52,6 +70,12 @@ func Manhole(m Machine) error {
 
 	defer session.Close()
 
+	if forwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return fmt.Errorf("failed to request agent forwarding: %v", err)
+		}
+	}
+
 	session.Stdin = os.Stdin
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
@@ -61,7 +85,7 @@ func Manhole(m Machine) error {
 		ssh.TTY_OP_OSPEED: 115200,
 	}
 
-	cols, lines, err := terminal.GetSize(int(os.Stdin.Fd()))
+	cols, lines, err := terminal.GetSize(fd)
 	if err != nil {
 		return err
 	}
@@ -87,9 +111,13 @@ func EnableSelinux(m Machine) error {
 	if err != nil {
 		return fmt.Errorf("Unable to enable SELinux: %s: %s", err, stderr)
 	}
+	return enableSelinuxAudit(m)
+}
 
-	// remove audit rules to get SELinux AVCs in the audit logs
-	_, stderr, err = m.SSH("sudo rm -rf /etc/audit/rules.d/{80-selinux.rules,99-default.rules}; sudo systemctl restart audit-rules")
+// enableSelinuxAudit removes the audit rules to get SELinux AVCs in the
+// audit logs.
+func enableSelinuxAudit(m Machine) error {
+	_, stderr, err := m.SSH("sudo rm -rf /etc/audit/rules.d/{80-selinux.rules,99-default.rules}; sudo systemctl restart audit-rules")
 	if err != nil {
 		return fmt.Errorf("unable to enable SELinux audit logs: %s: %s", err, stderr)
 	}
@@ -101,8 +129,8 @@ func EnableSelinux(m Machine) error {
 // Afterwards run CheckMachine to verify the system is back and operational.
 func StartReboot(m Machine) error {
 	// stop sshd so that commonMachineChecks will only work if the machine
-	// actually rebooted
-	out, stderr, err := m.SSH("sudo systemctl stop sshd.socket && sudo reboot")
+	// actually rebooted, Debian and Ubuntu name its units ssh
+	out, stderr, err := m.SSH(`sudo systemctl stop $(systemctl list-unit-files --no-legend sshd.socket ssh.socket ssh.service | cut -d" " -f1) && sudo reboot`)
 	if _, ok := err.(*ssh.ExitMissingError); ok {
 		// A terminated session is perfectly normal during reboot.
 		err = nil
@@ -118,21 +146,57 @@ func RebootMachine(m Machine, j *Journal) error {
 	if err := StartReboot(m); err != nil {
 		return fmt.Errorf("machine %q failed to begin rebooting: %v", m.ID(), err)
 	}
-	return StartMachine(m, j)
+	return startMachine(m, j)
 }
 
 // StartMachine will start a given machine, provided the machine's journal.
+// The boot is recorded in the run metrics and as a span of the cluster.
 func StartMachine(m Machine, j *Journal) error {
+	start := time.Now()
+	_, span := tracing.StartSpan(m.RuntimeConf().TraceContext, "machine.ssh_ready",
+		attribute.String("machine", m.ID()))
+	err := startMachine(m, j)
+	tracing.End(span, err)
+	metrics.MachineStarted(start, err)
+	if err != nil {
+		return &BootError{Machine: m.ID(), Err: err}
+	}
+	return nil
+}
+
+func startMachine(m Machine, j *Journal) error {
 	if err := j.Start(context.TODO(), m); err != nil {
-		return fmt.Errorf("machine %q failed to start: %v", m.ID(), err)
+		return fmt.Errorf("machine %q failed to start: %w", m.ID(), err)
 	}
 	if err := CheckMachine(context.TODO(), m); err != nil {
-		return fmt.Errorf("machine %q failed basic checks: %v", m.ID(), err)
+		return fmt.Errorf("machine %q failed basic checks: %w", m.ID(), err)
 	}
-	if !m.RuntimeConf().NoEnableSelinux {
+	if mode := m.RuntimeConf().CgroupMode; mode != "" {
+		if err := CheckCgroupMode(m, mode); err != nil {
+			return fmt.Errorf("machine %q: %v", m.ID(), err)
+		}
+	}
+	if w := m.RuntimeConf().WireGuard; w != nil {
+		if err := w.join(m); err != nil {
+			return fmt.Errorf("machine %q failed to join the WireGuard overlay: %v", m.ID(), err)
+		}
+	}
+	if m.RuntimeConf().NoEnableSelinux {
+		return nil
+	}
+	mode := m.RuntimeConf().SELinuxMode
+	if mode == "" {
 		if err := EnableSelinux(m); err != nil {
 			return fmt.Errorf("machine %q failed to enable selinux: %v", m.ID(), err)
 		}
+		return nil
+	}
+	// the machine booted in the mode set in its userdata
+	if err := CheckSELinuxMode(m, mode); err != nil {
+		return fmt.Errorf("machine %q: %v", m.ID(), err)
+	}
+	if err := enableSelinuxAudit(m); err != nil {
+		return fmt.Errorf("machine %q: %v", m.ID(), err)
 	}
 	return nil
 }
@@ -0,0 +1,312 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/flatcar/mantle/util"
+)
+
+const (
+	// WireGuardInterface is the name of the overlay interface on the
+	// machines.
+	WireGuardInterface = "kola-wg"
+	// WireGuardPort is the UDP port the machines listen on, it has to
+	// be reachable from the kola host and the other machines.
+	WireGuardPort = 51820
+
+	wireGuardNetDev  = "/etc/systemd/network/50-kola-wg.netdev"
+	wireGuardNetwork = "/etc/systemd/network/50-kola-wg.network"
+)
+
+// wireGuardKeys generates a WireGuard key pair, base64 encoded like wg
+// genkey and wg pubkey.
+func wireGuardKeys() (private, public string, err error) {
+	var key [curve25519.ScalarSize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", "", err
+	}
+	// clamp the key like wg genkey
+	key[0] &= 248
+	key[31] = (key[31] & 127) | 64
+	pub, err := wireGuardPublicKey(key[:])
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key[:]), pub, nil
+}
+
+func wireGuardPublicKey(private []byte) (string, error) {
+	pub, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// wireGuardHost is the WireGuard interface on the kola host, shared by
+// the overlays of all clusters of a flight. It hands out the addresses
+// of the subnet of the overlay, the host has the first one.
+type wireGuardHost struct {
+	ifname    string
+	publicKey string
+	subnet    *net.IPNet
+
+	mu   sync.Mutex
+	next net.IP
+}
+
+// newWireGuardHost creates the WireGuard interface of the kola host with
+// the first address of subnet. It needs the ip and wg tools and the
+// privileges to create network interfaces.
+func newWireGuardHost(subnet string) (*wireGuardHost, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("parsing WireGuard subnet: %v", err)
+	}
+	if ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("WireGuard subnet %s is not an IPv4 subnet", subnet)
+	}
+	h := &wireGuardHost{
+		// interface names are limited to 15 characters
+		ifname: fmt.Sprintf("kola-wg%d", os.Getpid()%100000),
+		subnet: ipnet,
+		next:   ipnet.IP.To4(),
+	}
+	addr, err := h.allocate()
+	if err != nil {
+		return nil, err
+	}
+	private, public, err := wireGuardKeys()
+	if err != nil {
+		return nil, err
+	}
+	h.publicKey = public
+
+	keyFile, err := os.CreateTemp("", "kola-wg-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.WriteString(private)
+	if err2 := keyFile.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runHostCmd("ip", "link", "add", "dev", h.ifname, "type", "wireguard"); err != nil {
+		return nil, err
+	}
+	for _, args := range [][]string{
+		{"wg", "set", h.ifname, "private-key", keyFile.Name()},
+		{"ip", "address", "add", fmt.Sprintf("%s/%d", addr, h.prefixLen()), "dev", h.ifname},
+		{"ip", "link", "set", "up", "dev", h.ifname},
+	} {
+		if err := runHostCmd(args[0], args[1:]...); err != nil {
+			h.Close()
+			return nil, err
+		}
+	}
+	plog.Infof("Created WireGuard interface %s with address %s", h.ifname, addr)
+	return h, nil
+}
+
+func runHostCmd(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (h *wireGuardHost) prefixLen() int {
+	ones, _ := h.subnet.Mask.Size()
+	return ones
+}
+
+// address returns the overlay address of the kola host.
+func (h *wireGuardHost) address() net.IP {
+	return nextIP(h.subnet.IP.To4())
+}
+
+// allocate returns the next free address of the subnet, skipping the
+// network address.
+func (h *wireGuardHost) allocate() (net.IP, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	next := nextIP(h.next)
+	broadcast := make(net.IP, len(next))
+	for i := range next {
+		broadcast[i] = h.subnet.IP.To4()[i] | ^h.subnet.Mask[i]
+	}
+	if !h.subnet.Contains(next) || next.Equal(broadcast) {
+		return nil, fmt.Errorf("no free addresses left in WireGuard subnet %s", h.subnet)
+	}
+	h.next = next
+	return next, nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// addPeer adds a machine to the interface of the host. The host sends
+// keepalives, so machines can reach it even if it is behind NAT.
+func (h *wireGuardHost) addPeer(publicKey, endpoint string, addr net.IP) error {
+	return runHostCmd("wg", "set", h.ifname, "peer", publicKey,
+		"endpoint", endpoint, "allowed-ips", addr.String()+"/32",
+		"persistent-keepalive", "25")
+}
+
+// Close removes the interface of the host.
+func (h *wireGuardHost) Close() error {
+	return runHostCmd("ip", "link", "delete", "dev", h.ifname)
+}
+
+// WireGuardMesh is the WireGuard overlay of a cluster, see
+// Options.WireGuardSubnet. Machines join it when they start and can
+// reach the kola host and each other at their overlay addresses.
+type WireGuardMesh struct {
+	host *wireGuardHost
+
+	mu    sync.Mutex
+	peers []wireGuardPeer
+}
+
+type wireGuardPeer struct {
+	machine   Machine
+	publicKey string
+	addr      net.IP
+}
+
+func newWireGuardMesh(host *wireGuardHost) *WireGuardMesh {
+	return &WireGuardMesh{host: host}
+}
+
+// HostAddress returns the overlay address of the kola host.
+func (w *WireGuardMesh) HostAddress() string {
+	return w.host.address().String()
+}
+
+// Address returns the overlay address of the machine, or an empty
+// string if it didn't join the overlay.
+func (w *WireGuardMesh) Address(m Machine) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range w.peers {
+		if p.machine.ID() == m.ID() {
+			return p.addr.String()
+		}
+	}
+	return ""
+}
+
+func (w *WireGuardMesh) netDevPeer(publicKey, endpoint string, addr net.IP) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n[WireGuardPeer]\nPublicKey=%s\nAllowedIPs=%s/32\n", publicKey, addr)
+	if endpoint != "" {
+		fmt.Fprintf(&b, "Endpoint=%s\n", endpoint)
+	}
+	return b.String()
+}
+
+// join configures the overlay interface on the machine with systemd-networkd,
+// adds it to the kola host and the machines that already joined, and
+// waits until it reaches the host.
+func (w *WireGuardMesh) join(m Machine) error {
+	addr, err := w.host.allocate()
+	if err != nil {
+		return err
+	}
+	private, public, err := wireGuardKeys()
+	if err != nil {
+		return err
+	}
+	endpoint := func(ip string) string {
+		return net.JoinHostPort(ip, fmt.Sprint(WireGuardPort))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	netdev := fmt.Sprintf("[NetDev]\nName=%s\nKind=wireguard\n\n[WireGuard]\nPrivateKey=%s\nListenPort=%d\n",
+		WireGuardInterface, private, WireGuardPort)
+	// the host has no endpoint, it may be behind NAT and connects first
+	netdev += w.netDevPeer(w.host.publicKey, "", w.host.address())
+	for _, p := range w.peers {
+		netdev += w.netDevPeer(p.publicKey, endpoint(p.machine.PrivateIP()), p.addr)
+	}
+	network := fmt.Sprintf("[Match]\nName=%s\n\n[Network]\nAddress=%s/%d\n",
+		WireGuardInterface, addr, w.host.prefixLen())
+	if err := InstallFile(strings.NewReader(netdev), m, wireGuardNetDev); err != nil {
+		return fmt.Errorf("writing WireGuard netdev: %v", err)
+	}
+	if err := InstallFile(strings.NewReader(network), m, wireGuardNetwork); err != nil {
+		return fmt.Errorf("writing WireGuard network: %v", err)
+	}
+	if out, stderr, err := m.SSH(fmt.Sprintf("sudo chmod 0640 %s && sudo chgrp systemd-network %s && sudo networkctl reload", wireGuardNetDev, wireGuardNetDev)); err != nil {
+		return fmt.Errorf("configuring WireGuard interface: %v: %s%s", err, out, stderr)
+	}
+
+	if err := w.host.addPeer(public, endpoint(m.IP()), addr); err != nil {
+		return err
+	}
+
+	// the running machines recreate their interface with the new peer
+	peer := w.netDevPeer(public, endpoint(m.PrivateIP()), addr)
+	for _, p := range w.peers {
+		cmd := fmt.Sprintf("echo '%s' | sudo tee -a %s >/dev/null && sudo ip link delete dev %s && sudo networkctl reload",
+			peer, wireGuardNetDev, WireGuardInterface)
+		if out, stderr, err := p.machine.SSH(cmd); err != nil {
+			return fmt.Errorf("adding WireGuard peer %s to machine %s: %v: %s%s", m.ID(), p.machine.ID(), err, out, stderr)
+		}
+	}
+
+	ping := fmt.Sprintf("ping -c 1 -W 2 %s", w.host.address())
+	if err := util.Retry(15, 2*time.Second, func() error {
+		_, stderr, err := m.SSH(ping)
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, stderr)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("reaching the kola host over WireGuard: %v", err)
+	}
+
+	w.peers = append(w.peers, wireGuardPeer{machine: m, publicKey: public, addr: addr})
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+func TestWireGuardPublicKey(t *testing.T) {
+	// RFC 7748 section 6.1
+	private, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	public, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	got, err := wireGuardPublicKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := base64.StdEncoding.EncodeToString(public); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestWireGuardAllocate(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.254.0.0/30")
+	h := &wireGuardHost{subnet: subnet, next: subnet.IP.To4()}
+	for _, expected := range []string{"10.254.0.1", "10.254.0.2"} {
+		addr, err := h.allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.String() != expected {
+			t.Errorf("got %s, expected %s", addr, expected)
+		}
+	}
+	if h.address().String() != "10.254.0.1" {
+		t.Errorf("host address %s, expected 10.254.0.1", h.address())
+	}
+	// 10.254.0.3 is the broadcast address
+	if addr, err := h.allocate(); err == nil {
+		t.Errorf("allocated %s from a full subnet", addr)
+	}
+}
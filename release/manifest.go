@@ -0,0 +1,222 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package release publishes Flatcar releases, as declared by a Manifest, to
+// the clouds and storage buckets. It is the library behind plume.
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "release")
+
+type StorageSpec struct {
+	BaseURL       string
+	Title         string // Replace the bucket name in index page titles
+	NamedPath     string // Copy to $BaseURL/$Board/$NamedPath
+	VersionPath   bool   // Copy to $BaseURL/$Board/$Version
+	DirectoryHTML bool
+	IndexHTML     bool
+}
+
+type GCESpec struct {
+	Project     string   // GCE project name
+	Family      string   // A group name, also used as name prefix
+	Description string   // Human readable-ish description
+	Licenses    []string // Identifiers for tracking usage
+	Image       string   // File name of image source
+	Publish     string   // Write published image name to given file
+	Limit       int      // Limit on # of old images to keep
+}
+
+type AzureEnvironmentSpec struct {
+	SubscriptionName string // Name of subscription in Azure profile
+}
+
+type AzureSpec struct {
+	Offer          string                 // Azure offer name
+	Image          string                 // File name of image source
+	StorageAccount string                 // Storage account to use for image uploads in each environment
+	ResourceGroup  string                 // Resource Group to use for blobs in each environment
+	Container      string                 // Container to hold the disk image in each environment
+	Environments   []AzureEnvironmentSpec // Azure environments to upload to
+
+	// Fields for azure.OSImage
+	Label             string
+	Description       string // Description of an image in this channel
+	RecommendedVMSize string
+	IconURI           string
+	SmallIconURI      string
+}
+
+type AWSPartitionSpec struct {
+	Name              string   // Printable name for the partition
+	Profile           string   // Authentication profile in ~/.aws
+	Bucket            string   // S3 bucket for uploading image
+	BucketRegion      string   // Region of the bucket
+	LaunchPermissions []string // Other accounts to give launch permission
+	Regions           []string // Regions to create the AMI in
+}
+
+type AWSSpec struct {
+	BaseName        string             // Prefix of image name
+	BaseDescription string             // Prefix of image description
+	Prefix          string             // Prefix for filenames of AMI lists
+	Image           string             // File name of image source
+	Partitions      []AWSPartitionSpec // AWS partitions
+}
+
+// Manifest declares a release: the version of the boards of a channel and
+// where their images are published. A cloud is skipped if its spec is
+// empty. Manifests can be written as JSON, using the field names as keys.
+type Manifest struct {
+	Channel      string
+	Version      string
+	Boards       []string
+	BaseURL      string // Copy from $BaseURL/$Board/$Version
+	Destinations []StorageSpec
+	GCE          GCESpec
+	Azure        AzureSpec
+	AzurePremium AzureSpec
+	AWS          AWSSpec
+}
+
+// LoadManifest reads a JSON manifest from the file path.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %v", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that the manifest names what to release.
+func (m *Manifest) Validate() error {
+	switch {
+	case m.Channel == "":
+		return fmt.Errorf("no channel")
+	case m.Version == "":
+		return fmt.Errorf("no version")
+	case len(m.Boards) == 0:
+		return fmt.Errorf("no boards")
+	case m.BaseURL == "":
+		return fmt.Errorf("no base URL")
+	}
+	if m.AWS.Image != "" {
+		for _, board := range m.Boards {
+			if _, err := amiNameArchTag(board); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dSpec := range m.Destinations {
+		if !dSpec.VersionPath && dSpec.NamedPath == "" {
+			return fmt.Errorf("destination %s has neither a version nor a named path", dSpec.BaseURL)
+		}
+	}
+	return nil
+}
+
+// SourceURL returns where the images of board are fetched from. Buckets
+// on Google Cloud Storage are replaced by their public web server if
+// unauthenticated.
+func (m *Manifest) SourceURL(board string, unauthenticated bool) (string, error) {
+	baseURL := m.BaseURL
+	if unauthenticated {
+		baseURL = strings.Replace(baseURL, "gs://", "https://bucket.release.flatcar-linux.net/", 1)
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// We conditionnally drop the '-usr' of the board based on the
+	// URL scheme of the BaseURL.
+	arch := board
+	if u.Scheme != "gs" {
+		arch = strings.TrimSuffix(board, "-usr")
+	}
+
+	u.Path = path.Join(u.Path, arch, m.Version)
+	return u.String(), nil
+}
+
+// AzureBlobName returns the name of the Azure blob of board.
+func (m *Manifest) AzureBlobName(board string) string {
+	archTag := ""
+	switch board {
+	case "amd64-usr":
+		archTag = "amd64"
+	case "arm64-usr":
+		archTag = "arm64"
+	}
+	return fmt.Sprintf("flatcar-linux-%s-%s-%s.vhd", m.Version, m.Channel, archTag)
+}
+
+func amiNameArchTag(board string) (string, error) {
+	switch board {
+	case "amd64-usr":
+		return "", nil
+	case "arm64-usr":
+		return "-arm64", nil
+	default:
+		return "", fmt.Errorf("no AMI name architecture tag defined for board %q", board)
+	}
+}
+
+func (ss StorageSpec) parentPrefixes(board string) ([]string, error) {
+	u, err := url.Parse(ss.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return []string{u.Path, path.Join(u.Path, board)}, nil
+}
+
+func (ss StorageSpec) finalPrefixes(board, version string) ([]string, error) {
+	u, err := url.Parse(ss.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := []string{}
+	if ss.VersionPath {
+		prefixes = append(prefixes,
+			path.Join(u.Path, board, version))
+	}
+	if ss.NamedPath != "" {
+		prefixes = append(prefixes,
+			path.Join(u.Path, board, ss.NamedPath))
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("invalid destination: %#v", ss)
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,79 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	write := func(data string) string {
+		path := filepath.Join(dir, "manifest.json")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	m, err := LoadManifest(write(`{
+		"channel": "stable",
+		"version": "3510.2.0",
+		"boards": ["amd64-usr", "arm64-usr"],
+		"baseURL": "gs://flatcar-jenkins/stable/boards",
+		"aws": {"image": "flatcar_production_ami_image.bin.bz2", "partitions": [{"name": "AWS", "regions": ["us-east-1"]}]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Channel != "stable" || len(m.Boards) != 2 || len(m.AWS.Partitions) != 1 || m.AWS.Partitions[0].Regions[0] != "us-east-1" {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	for _, bad := range []string{
+		`{"version": "1.0.0", "boards": ["amd64-usr"], "baseURL": "gs://b"}`,
+		`{"channel": "alpha", "boards": ["amd64-usr"], "baseURL": "gs://b"}`,
+		`{"channel": "alpha", "version": "1.0.0", "baseURL": "gs://b"}`,
+		`{"channel": "alpha", "version": "1.0.0", "boards": ["riscv-usr"], "baseURL": "gs://b", "aws": {"image": "ami.bin"}}`,
+		`{"channel": "alpha", "version": "1.0.0", "boards": ["amd64-usr"], "baseURL": "gs://b", "destinations": [{"baseURL": "gs://d"}]}`,
+	} {
+		if _, err := LoadManifest(write(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	for _, tt := range []struct {
+		baseURL         string
+		unauthenticated bool
+		want            string
+	}{
+		{"gs://flatcar-jenkins/stable/boards", false, "gs://flatcar-jenkins/stable/boards/arm64-usr/3510.2.0"},
+		{"gs://flatcar-jenkins/stable/boards", true, "https://bucket.release.flatcar-linux.net/flatcar-jenkins/stable/boards/arm64/3510.2.0"},
+		{"http://bincache.flatcar-linux.net/images", false, "http://bincache.flatcar-linux.net/images/arm64/3510.2.0"},
+	} {
+		m := Manifest{BaseURL: tt.baseURL, Version: "3510.2.0"}
+		got, err := m.SourceURL("arm64-usr", tt.unauthenticated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.baseURL, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,619 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	azurestorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
+	"github.com/Microsoft/azure-vhd-utils/vhdcore/validator"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/lang/maps"
+	"github.com/flatcar/mantle/platform/api/aws"
+	"github.com/flatcar/mantle/platform/api/azure"
+	"github.com/flatcar/mantle/sdk"
+	"github.com/flatcar/mantle/util"
+)
+
+const privateBucketSuffix = "private"
+
+var preReleasePlatforms = map[string]struct {
+	displayName string
+	handler     func(*job, context.Context, *ImageInfo) error
+}{
+	"aws": {
+		displayName: "AWS",
+		handler:     (*job).awsPreRelease,
+	},
+	"azure": {
+		displayName: "Azure",
+		handler:     (*job).azurePreRelease,
+	},
+}
+
+// PreReleasePlatforms returns the clouds supported by PreRelease.
+func PreReleasePlatforms() []string {
+	return maps.SortedKeys(preReleasePlatforms)
+}
+
+type imageMetadataAbstract struct {
+	Env       string
+	Version   string
+	Timestamp string
+	Respin    string
+	ImageType string
+	Arch      string
+}
+
+// ImageInfo describes the images pre-released for a board.
+type ImageInfo struct {
+	AWS   *AMIList        `json:"aws,omitempty"`
+	Azure *AzureImageInfo `json:"azure,omitempty"`
+}
+
+type AzureImageInfo struct {
+	ImageName string `json:"image"`
+}
+
+type AMIListEntry struct {
+	Region string `json:"name"`
+	HvmAmi string `json:"hvm"`
+}
+
+type AMIList struct {
+	Entries []AMIListEntry `json:"amis"`
+}
+
+// PreRelease does as much of the release as possible without making
+// anything public, like uploading the images to the clouds and replicating
+// them across regions. It returns the images created for each board.
+func PreRelease(ctx context.Context, m *Manifest, opts *Options) (map[string]*ImageInfo, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = PreReleasePlatforms()
+	}
+	for _, platformName := range platforms {
+		if _, ok := preReleasePlatforms[platformName]; !ok {
+			return nil, fmt.Errorf("unknown platform %q", platformName)
+		}
+	}
+
+	infos := make(map[string]*ImageInfo)
+	for _, board := range m.Boards {
+		j, err := newJob(ctx, m, opts, board)
+		if err != nil {
+			return nil, err
+		}
+
+		// Sanity check!
+		if !strings.Contains(j.sourceURL, privateBucketSuffix) {
+			if err := j.checkVersion(); err != nil {
+				return nil, err
+			}
+		}
+
+		var imageInfo ImageInfo
+		for _, platformName := range platforms {
+			platform := preReleasePlatforms[platformName]
+			plog.Printf("Running %v pre-release of %v...", platform.displayName, board)
+			if err := platform.handler(j, ctx, &imageInfo); err != nil {
+				return nil, fmt.Errorf("pre-releasing %v on %v: %v", board, platform.displayName, err)
+			}
+		}
+		infos[board] = &imageInfo
+	}
+	return infos, nil
+}
+
+// imageFile downloads a bzipped Flatcar image, verifies its signature,
+// decompresses it, and returns the decompressed path.
+func (j *job) imageFile(fileName string) (string, error) {
+	cacheDir := filepath.Join(sdk.RepoCache(), "images", j.Channel, j.board, j.Version)
+	bzipPath := filepath.Join(cacheDir, fileName)
+	imagePath := strings.TrimSuffix(bzipPath, filepath.Ext(bzipPath))
+
+	if _, err := os.Stat(imagePath); err == nil {
+		if !j.Force {
+			plog.Printf("Reusing existing image %q", imagePath)
+			return imagePath, nil
+		} else {
+			if err := os.Remove(imagePath); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	bzipUri, err := url.Parse(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	bzipUri = j.src.URL().ResolveReference(bzipUri)
+
+	plog.Printf("Downloading image %q to %q", bzipUri, bzipPath)
+
+	if err := sdk.UpdateSignedFile(bzipPath, bzipUri.String(), j.Client, j.VerifyKeyFile); err != nil {
+		return "", err
+	}
+
+	// decompress it
+	plog.Printf("Decompressing %q...", bzipPath)
+	if err := util.Bunzip2File(imagePath, bzipPath); err != nil {
+		return "", err
+	}
+	return imagePath, nil
+}
+
+func (j *job) azureSpec() AzureSpec {
+	if j.AzureCategory == "pro" {
+		return j.AzurePremium
+	}
+	return j.Azure
+}
+
+func (j *job) uploadAzureBlob(api *azure.API, storageKeys azurestorage.AccountListKeysResult, vhdfile, container, blobName string) error {
+	specAzure := j.azureSpec()
+
+	for _, key := range *storageKeys.Keys {
+		blobExists, err := api.BlobExists(specAzure.StorageAccount, *key.Value, container, blobName)
+		if err != nil {
+			return fmt.Errorf("failed to check if file %q in account %q container %q exists: %v", vhdfile, specAzure.StorageAccount, container, err)
+		}
+
+		if blobExists {
+			if !j.Force {
+				return nil
+			} else {
+				if err := api.DeleteBlob(specAzure.StorageAccount, *key.Value, container, blobName); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := api.UploadBlob(specAzure.StorageAccount, *key.Value, vhdfile, container, blobName, false); err != nil {
+			if _, ok := err.(azure.BlobExistsError); !ok {
+				return fmt.Errorf("uploading file %q to account %q container %q failed: %v", vhdfile, specAzure.StorageAccount, container, err)
+			}
+		}
+		break
+	}
+	return nil
+}
+
+// azurePreRelease runs everything necessary to prepare a Flatcar release for Azure.
+//
+// This includes uploading the vhd image to Azure storage, creating an OS image from it,
+// and replicating that OS image.
+func (j *job) azurePreRelease(ctx context.Context, imageInfo *ImageInfo) error {
+	specAzure := j.azureSpec()
+	blobName := j.AzureBlobName(j.board)
+	if j.AzureCategory == "pro" {
+		blobName = fmt.Sprintf("flatcar-linux-pro-%s-%s.vhd", j.Version, j.Channel)
+	}
+
+	if specAzure.StorageAccount == "" {
+		plog.Notice("Azure image creation disabled.")
+		return nil
+	}
+
+	container := specAzure.Container
+	if j.AzureTestContainer != "" {
+		container = j.AzureTestContainer
+	}
+
+	if j.DryRun {
+		for _, environment := range specAzure.Environments {
+			plog.Noticef("Would upload %s as %q to %q in %q on %v", specAzure.Image, blobName,
+				container, specAzure.StorageAccount, environment.SubscriptionName)
+		}
+		return nil
+	}
+
+	// download azure vhd image and unzip it
+	vhdfile, err := j.imageFile(specAzure.Image)
+	if err != nil {
+		return err
+	}
+
+	// sanity check - validate VHD file
+	plog.Printf("Validating VHD file %q", vhdfile)
+	if err := validator.ValidateVhd(vhdfile); err != nil {
+		return err
+	}
+	if err := validator.ValidateVhdSize(vhdfile); err != nil {
+		return err
+	}
+
+	for _, environment := range specAzure.Environments {
+		// construct azure api client
+		api, err := azure.New(&azure.Options{
+			AzureProfile:      j.AzureProfile,
+			AzureAuthLocation: j.AzureAuth,
+			AzureSubscription: environment.SubscriptionName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Azure API: %v", err)
+		}
+		if err := api.SetupClients(); err != nil {
+			return fmt.Errorf("setting up clients: %v", err)
+		}
+
+		plog.Printf("Fetching Azure storage credentials")
+
+		storageKey, err := api.GetStorageServiceKeysARM(specAzure.StorageAccount, specAzure.ResourceGroup)
+		if err != nil {
+			return err
+		}
+		if storageKey.Keys == nil {
+			return fmt.Errorf("no storage service keys found")
+		}
+
+		// upload blob, do not overwrite
+		plog.Printf("Uploading %q to Azure Storage...", vhdfile)
+
+		err = j.uploadAzureBlob(api, storageKey, vhdfile, container, blobName)
+		if err != nil {
+			return err
+		}
+		var sas string
+		for _, key := range *storageKey.Keys {
+			sas, err = api.SignBlob(specAzure.StorageAccount, *key.Value, container, blobName)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("signing failed: %v", err)
+		}
+		url := api.UrlOfBlob(specAzure.StorageAccount, container, blobName).String()
+		plog.Noticef("Generated SAS: %q from %q for %q", sas, url, j.Channel)
+		imageInfo.Azure = &AzureImageInfo{
+			ImageName: sas, // the SAS URL can be used for publishing and for testing with kola via --azure-blob-url
+		}
+	}
+	return nil
+}
+
+func (j *job) awsImageMetadata() (map[string]string, error) {
+	archTag, err := amiNameArchTag(j.board)
+	if err != nil {
+		return nil, err
+	}
+
+	imageFileName := j.AWS.Image
+	imageMetadata := imageMetadataAbstract{
+		Version: j.Version,
+		Arch:    j.board,
+	}
+	t, err := template.New("filename").Parse(imageFileName)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	if err := t.Execute(buffer, imageMetadata); err != nil {
+		return nil, err
+	}
+	imageFileName = buffer.String()
+
+	imageName := fmt.Sprintf("%v-%v-%v%v", j.AWS.BaseName, j.Channel, j.Version, archTag)
+	imageName = regexp.MustCompile(`[^A-Za-z0-9()\\./_-]`).ReplaceAllLiteralString(imageName, "_")
+
+	imageDescription := fmt.Sprintf("%v %v %v%v", j.AWS.BaseDescription, j.Channel, j.Version, strings.ReplaceAll(archTag, "-", " "))
+
+	awsImageMetaData := map[string]string{
+		"imageFileName":    imageFileName,
+		"imageName":        imageName,
+		"imageDescription": imageDescription,
+	}
+
+	return awsImageMetaData, nil
+}
+
+func (j *job) awsUploadToPartition(part *AWSPartitionSpec, imagePath string) (map[string]string, error) {
+	plog.Printf("Connecting to %v...", part.Name)
+	api, err := aws.New(&aws.Options{
+		CredentialsFile: j.AWSCredentialsFile,
+		Profile:         part.Profile,
+		Region:          part.BucketRegion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %v: %v", part.Name, err)
+	}
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open image file %v: %v", imagePath, err)
+	}
+	defer f.Close()
+
+	awsImageMetadata, err := j.awsImageMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("Could not generate the image metadata: %v", err)
+	}
+
+	imageFileName := awsImageMetadata["imageFileName"]
+	imageName := awsImageMetadata["imageName"]
+	imageDescription := awsImageMetadata["imageDescription"]
+
+	s3ObjectPath := fmt.Sprintf("%s/%s/%s", j.board, j.Version, strings.TrimSuffix(imageFileName, filepath.Ext(imageFileName)))
+	s3ObjectURL := fmt.Sprintf("s3://%s/%s", part.Bucket, s3ObjectPath)
+
+	destRegions := make([]string, 0, len(part.Regions))
+	foundBucketRegion := false
+	for _, region := range part.Regions {
+		if region != part.BucketRegion {
+			destRegions = append(destRegions, region)
+		} else {
+			foundBucketRegion = true
+		}
+	}
+	if !foundBucketRegion {
+		// We don't handle this case and shouldn't ever
+		// encounter it
+		return nil, fmt.Errorf("BucketRegion %v is not listed in Regions", part.BucketRegion)
+	}
+
+	if j.Force {
+		s3object := aws.BucketObject{
+			Region: part.BucketRegion,
+			Bucket: part.Bucket,
+			Path:   s3ObjectPath,
+		}
+		err := api.RemoveImage(imageName, imageName, s3object, destRegions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := api.FindSnapshot(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check for snapshot: %v", err)
+	}
+
+	if snapshot == nil {
+		plog.Printf("Creating S3 object %v...", s3ObjectURL)
+		err = api.UploadObject(f, part.Bucket, s3ObjectPath, false)
+		if err != nil {
+			return nil, fmt.Errorf("Error uploading: %v", err)
+		}
+
+		plog.Printf("Creating EBS snapshot...")
+
+		format := aws.EC2ImageFormatRaw
+
+		snapshot, err = api.CreateSnapshot(imageName, s3ObjectURL, format)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create snapshot: %v", err)
+		}
+	}
+
+	// delete unconditionally to avoid leaks after a restart
+	plog.Printf("Deleting S3 object %v...", s3ObjectURL)
+	err = api.DeleteObject(part.Bucket, s3ObjectPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error deleting S3 object: %v", err)
+	}
+
+	plog.Printf("Creating AMIs from %v...", snapshot.SnapshotID)
+
+	amiArch, err := aws.AmiArchForBoard(j.board)
+	if err != nil {
+		return nil, fmt.Errorf("could not get architecture for board: %v", err)
+	}
+
+	hvmImageID, err := api.CreateHVMImage(snapshot.SnapshotID, aws.ContainerLinuxDiskSizeGiB, imageName+"-hvm", imageDescription+" (HVM)", amiArch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create HVM image: %v", err)
+	}
+	resources := []string{snapshot.SnapshotID, hvmImageID}
+
+	err = api.CreateTags(resources, map[string]string{
+		"Channel": j.Channel,
+		"Version": j.Version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't tag images: %v", err)
+	}
+
+	postprocess := func(imageID string) (map[string]string, error) {
+		if len(part.LaunchPermissions) > 0 {
+			if err := api.GrantLaunchPermission(imageID, part.LaunchPermissions); err != nil {
+				return nil, err
+			}
+		}
+
+		amis := map[string]string{}
+		if len(destRegions) > 0 {
+			plog.Printf("Replicating AMI %v to %d regions...", imageID, len(destRegions))
+			amis, err = api.CopyImage(imageID, destRegions)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't copy image: %v", err)
+			}
+		}
+		amis[part.BucketRegion] = imageID
+
+		return amis, nil
+	}
+
+	hvmAmis, err := postprocess(hvmImageID)
+	if err != nil {
+		return nil, fmt.Errorf("processing HVM images: %v", err)
+	}
+
+	return hvmAmis, nil
+}
+
+type amiFile struct {
+	Name    string
+	Content string
+}
+
+func awsCreateAmiLists(amis *AMIList) ([]amiFile, error) {
+	var amiFiles []amiFile
+	// emit keys in stable order
+	sort.Slice(amis.Entries, func(i, j int) bool {
+		return amis.Entries[i].Region < amis.Entries[j].Region
+	})
+
+	// format JSON AMI list
+	var jsonBuf bytes.Buffer
+	encoder := json.NewEncoder(&jsonBuf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(amis); err != nil {
+		return nil, fmt.Errorf("couldn't encode JSON: %v", err)
+	}
+	jsonAll := jsonBuf.String()
+
+	// format text AMI lists for individual regions
+	var hvmRecords []string
+	for _, entry := range amis.Entries {
+		hvmRecords = append(hvmRecords,
+			fmt.Sprintf("%v=%v", entry.Region, entry.HvmAmi))
+
+		content := entry.HvmAmi + "\n"
+		amiFiles = append(amiFiles, amiFile{Name: fmt.Sprintf("hvm_%v.txt", entry.Region), Content: content})
+		amiFiles = append(amiFiles, amiFile{Name: fmt.Sprintf("%v.txt", entry.Region), Content: content})
+	}
+	hvmAll := strings.Join(hvmRecords, "|") + "\n"
+
+	amiFiles = append(amiFiles, amiFile{Name: "all.json", Content: jsonAll})
+	amiFiles = append(amiFiles, amiFile{Name: "hvm.txt", Content: hvmAll})
+	amiFiles = append(amiFiles, amiFile{Name: "all.txt", Content: hvmAll})
+
+	return amiFiles, nil
+}
+
+func (j *job) awsWriteAmiLists(amiFiles []amiFile) error {
+	for _, amiFileEntry := range amiFiles {
+		name := filepath.Join(j.AMIListDir, j.AWS.Prefix+amiFileEntry.Name)
+		if err := os.WriteFile(name, []byte(amiFileEntry.Content), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *job) awsUploadAmiLists(ctx context.Context, amiFiles []amiFile) error {
+	upload := func(name string, data string) error {
+		var contentType string
+		if strings.HasSuffix(name, ".txt") {
+			contentType = "text/plain"
+		} else if strings.HasSuffix(name, ".json") {
+			contentType = "application/json"
+		} else {
+			return fmt.Errorf("unknown file extension in %v", name)
+		}
+
+		obj := gs.Object{
+			Name:        j.src.Prefix() + j.AWS.Prefix + name,
+			ContentType: contentType,
+		}
+		media := bytes.NewReader([]byte(data))
+		if err := j.src.Upload(ctx, &obj, media); err != nil {
+			return fmt.Errorf("couldn't upload %v: %v", name, err)
+		}
+		return nil
+	}
+
+	for _, amiFileEntry := range amiFiles {
+		if err := upload(amiFileEntry.Name, amiFileEntry.Content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// awsPreRelease runs everything necessary to prepare a Flatcar release for AWS.
+//
+// This includes uploading the ami image to an S3 bucket in each EC2
+// partition, creating HVM AMIs, and replicating the AMIs to each
+// region.
+func (j *job) awsPreRelease(ctx context.Context, imageInfo *ImageInfo) error {
+	if j.AWS.Image == "" {
+		plog.Notice("AWS image creation disabled.")
+		return nil
+	}
+
+	awsImageMetadata, err := j.awsImageMetadata()
+	if err != nil {
+		return fmt.Errorf("Could not generate the image filname: %v", err)
+	}
+
+	imageFileName := awsImageMetadata["imageFileName"]
+
+	if j.DryRun {
+		for _, part := range j.AWS.Partitions {
+			plog.Noticef("Would upload %s to %v and create AMI %s-hvm in %s", imageFileName,
+				part.Name, awsImageMetadata["imageName"], strings.Join(part.Regions, ", "))
+		}
+		return nil
+	}
+
+	imagePath, err := j.imageFile(imageFileName)
+	if err != nil {
+		return err
+	}
+
+	var amis AMIList
+	for i := range j.AWS.Partitions {
+		hvmAmis, err := j.awsUploadToPartition(&j.AWS.Partitions[i], imagePath)
+		if err != nil {
+			return err
+		}
+
+		for region := range hvmAmis {
+			amis.Entries = append(amis.Entries, AMIListEntry{
+				Region: region,
+				HvmAmi: hvmAmis[region],
+			})
+		}
+	}
+
+	amiFiles, err := awsCreateAmiLists(&amis)
+	if err != nil {
+		return fmt.Errorf("creating AMI ID list files: %v", err)
+	}
+
+	if j.AMIListDir != "" {
+		if err := j.awsWriteAmiLists(amiFiles); err != nil {
+			return fmt.Errorf("writing AMI ID list files: %v", err)
+		}
+	}
+
+	if !j.Unauthenticated {
+		if err := j.awsUploadAmiLists(ctx, amiFiles); err != nil {
+			return fmt.Errorf("uploading AMI IDs: %v", err)
+		}
+	}
+
+	imageInfo.AWS = &amis
+	return nil
+}
@@ -0,0 +1,614 @@
+// Copyright The Mantle Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/compute/v1"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/lang/worker"
+	"github.com/flatcar/mantle/platform/api/aws"
+	"github.com/flatcar/mantle/platform/api/azure"
+	"github.com/flatcar/mantle/platform/api/gcloud"
+	"github.com/flatcar/mantle/sdk"
+	"github.com/flatcar/mantle/storage"
+	"github.com/flatcar/mantle/storage/index"
+)
+
+// Options are the credentials and settings of a pre-release or release.
+type Options struct {
+	// Client fetches the images from Google Cloud Storage and uploads
+	// the image lists there.
+	Client *http.Client
+	// Unauthenticated is set if Client has no credentials. The images
+	// are then fetched from the web server of the bucket and the image
+	// lists are not uploaded.
+	Unauthenticated bool
+
+	AWSCredentialsFile string
+	// AWSMarketplaceCredentialsFile is used for publishing the AMIs on
+	// the AWS Marketplace.
+	AWSMarketplaceCredentialsFile string
+	// PublishMarketplace publishes the AMIs on the AWS Marketplace.
+	PublishMarketplace bool
+	// AccessRoleARN is the ARN to give marketplace access to the AMI.
+	AccessRoleARN string
+	// ProductIDs are the AWS Marketplace offer IDs.
+	ProductIDs []string
+	// Username is the default user on instances launched by AWS
+	// Marketplace.
+	Username string
+	// AMIListDir is where the AMI lists are written by a pre-release,
+	// nowhere if empty.
+	AMIListDir string
+
+	AzureProfile string
+	AzureAuth    string
+	// AzureTestContainer replaces the container of the manifest.
+	AzureTestContainer string
+	// AzureCategory is "pro" to pre-release the AzurePremium image.
+	AzureCategory string
+
+	// GCEReleaseKey is the key file of the GCE project, GCE is skipped
+	// without it.
+	GCEReleaseKey string
+	// VerifyKeyFile is the PGP public key verifying the downloads, the
+	// embedded one if empty.
+	VerifyKeyFile string
+
+	// Platforms are the clouds to pre-release to, all if empty.
+	Platforms []string
+	// Force replaces existing images.
+	Force bool
+	// DryRun logs what would be done without making changes.
+	DryRun bool
+	// Parallel is the maximum number of concurrent operations in bulk
+	// operations, e.g. publishing in many regions.
+	Parallel int
+}
+
+// job is the pre-release or release of a board.
+type job struct {
+	*Options
+	*Manifest
+	board     string
+	sourceURL string
+	src       *storage.Bucket
+}
+
+func newJob(ctx context.Context, m *Manifest, opts *Options, board string) (*job, error) {
+	sourceURL, err := m.SourceURL(board, opts.Unauthenticated)
+	if err != nil {
+		return nil, err
+	}
+	src, err := storage.NewBucket(opts.Client, sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	src.WriteDryRun(opts.DryRun)
+
+	if err := src.Fetch(ctx); err != nil && !strings.HasPrefix(sourceURL, "http") {
+		return nil, err
+	}
+
+	return &job{
+		Options:   opts,
+		Manifest:  m,
+		board:     board,
+		sourceURL: sourceURL,
+		src:       src,
+	}, nil
+}
+
+// checkVersion is a sanity check of the source of the images.
+func (j *job) checkVersion() error {
+	if vertxt := j.src.Object(j.src.Prefix() + "version.txt"); vertxt == nil {
+		return fmt.Errorf("file not found: %sversion.txt", j.src.URL())
+	}
+	return nil
+}
+
+// Release makes the images of a pre-release public, creates those that
+// could not be pre-released and copies the release artifacts to the
+// destinations of the manifest.
+func Release(ctx context.Context, m *Manifest, opts *Options) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	for _, board := range m.Boards {
+		j, err := newJob(ctx, m, opts, board)
+		if err != nil {
+			return err
+		}
+		if err := j.release(ctx); err != nil {
+			return fmt.Errorf("releasing %s: %v", board, err)
+		}
+	}
+	return nil
+}
+
+func (j *job) release(ctx context.Context) error {
+	if err := j.checkVersion(); err != nil {
+		return err
+	}
+
+	// We do not provide yet ARM64 image for Google.
+	if j.board == "amd64-usr" {
+		// Create a GCS bucket client to temporary upload the GCE image on GCS.
+		gcs, err := storage.NewBucket(j.Client, "gs://flatcar-jenkins")
+		if err != nil {
+			return fmt.Errorf("creating GCE bucket client: %v", err)
+		}
+
+		if err := j.doGCE(ctx, gcs); err != nil {
+			return err
+		}
+	}
+
+	// Make Azure images public.
+	if err := j.doAzure(); err != nil {
+		return err
+	}
+
+	// Make AWS images public.
+	if err := j.doAWS(ctx); err != nil {
+		return err
+	}
+
+	for _, dSpec := range j.Destinations {
+		if err := j.syncDestination(ctx, dSpec); err != nil {
+			return fmt.Errorf("copying to %s: %v", dSpec.BaseURL, err)
+		}
+	}
+	return nil
+}
+
+func (j *job) syncDestination(ctx context.Context, dSpec StorageSpec) error {
+	dst, err := storage.NewBucket(j.Client, dSpec.BaseURL)
+	if err != nil {
+		return err
+	}
+	dst.WriteDryRun(j.DryRun)
+
+	parentPrefixes, err := dSpec.parentPrefixes(j.board)
+	if err != nil {
+		return err
+	}
+	finalPrefixes, err := dSpec.finalPrefixes(j.board, j.Version)
+	if err != nil {
+		return err
+	}
+
+	// Fetch parent directories non-recursively to re-index it later.
+	for _, prefix := range parentPrefixes {
+		if err := dst.FetchPrefix(ctx, prefix, false); err != nil {
+			return err
+		}
+	}
+
+	// Fetch and sync each destination directory.
+	for _, prefix := range finalPrefixes {
+		if err := dst.FetchPrefix(ctx, prefix, true); err != nil {
+			return err
+		}
+
+		sync := index.NewSyncIndexJob(j.src, dst)
+		sync.DestinationPrefix(prefix)
+		sync.DirectoryHTML(dSpec.DirectoryHTML)
+		sync.IndexHTML(dSpec.IndexHTML)
+		sync.Delete(true)
+		if dSpec.Title != "" {
+			sync.Name(dSpec.Title)
+		}
+		if err := sync.Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Now refresh the parent directory indexes.
+	for _, prefix := range parentPrefixes {
+		parent := index.NewIndexJob(dst)
+		parent.Prefix(prefix)
+		parent.DirectoryHTML(dSpec.DirectoryHTML)
+		parent.IndexHTML(dSpec.IndexHTML)
+		parent.Recursive(false)
+		parent.Delete(true)
+		if dSpec.Title != "" {
+			parent.Name(dSpec.Title)
+		}
+		if err := parent.Do(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *job) sanitizeVersion() string {
+	v := strings.Replace(j.Version, ".", "-", -1)
+	return strings.Replace(v, "+", "-", -1)
+}
+
+func gceWaitForImage(pending *gcloud.Pending) error {
+	plog.Infof("Waiting for image creation to finish...")
+	pending.Interval = 3 * time.Second
+	pending.Progress = func(_ string, _ time.Duration, op *compute.Operation) error {
+		status := strings.ToLower(op.Status)
+		if op.Progress != 0 {
+			plog.Infof("Image creation is %s: %s % 2d%%", status, op.StatusMessage, op.Progress)
+		} else {
+			plog.Infof("Image creation is %s. %s", status, op.StatusMessage)
+		}
+		return nil
+	}
+	if err := pending.Wait(); err != nil {
+		return err
+	}
+	plog.Info("Success!")
+	return nil
+}
+
+func (j *job) gceUploadImage(api *gcloud.API, obj *gs.Object, name, desc string) (string, error) {
+	plog.Noticef("Creating GCE image %s", name)
+	// Overwrite is set
+	op, pending, err := api.CreateImage(&gcloud.ImageSpec{
+		SourceImage: obj.MediaLink,
+		Family:      j.GCE.Family,
+		Name:        name,
+		Description: desc,
+		Licenses:    j.GCE.Licenses,
+	}, true)
+	if err != nil {
+		return "", fmt.Errorf("GCE image creation failed: %v", err)
+	}
+
+	if err := gceWaitForImage(pending); err != nil {
+		return "", err
+	}
+
+	return op.TargetLink, nil
+}
+
+func (j *job) doGCE(ctx context.Context, src *storage.Bucket) error {
+	if j.GCE.Project == "" || j.GCE.Image == "" {
+		plog.Notice("GCE image creation disabled.")
+		return nil
+	}
+
+	if j.GCEReleaseKey == "" {
+		plog.Notice("No GCE Release key file defined, skipping.")
+		return nil
+	}
+
+	api, err := gcloud.New(&gcloud.Options{
+		Project:     j.GCE.Project,
+		JSONKeyFile: j.GCEReleaseKey,
+	})
+	if err != nil {
+		return fmt.Errorf("GCE client failed: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s", j.GCE.Family, j.sanitizeVersion())
+
+	// We extend the name with '-arm64' suffix to avoid conflicting image name.
+	if j.board == "arm64-usr" {
+		name = name + "-arm64"
+	}
+
+	date := time.Now().UTC()
+	desc := fmt.Sprintf("%s, %s, %s published on %s", j.GCE.Description,
+		j.Version, j.board, date.Format("2006-01-02"))
+
+	images, err := api.ListImages(ctx, j.GCE.Family+"-")
+	if err != nil {
+		return err
+	}
+
+	var oldImages []*compute.Image
+	created := make(map[*compute.Image]time.Time)
+	for _, image := range images {
+		if !strings.HasPrefix(image.Name, name) {
+			stamp, err := time.Parse(time.RFC3339, image.CreationTimestamp)
+			if err != nil {
+				return fmt.Errorf("couldn't parse timestamp %q: %v", image.CreationTimestamp, err)
+			}
+			oldImages = append(oldImages, image)
+			created[image] = stamp
+		}
+	}
+	sort.Slice(oldImages, func(a, b int) bool {
+		return created[oldImages[a]].After(created[oldImages[b]])
+	})
+
+	// Prepare the URL to temporary store the downloaded GCE image.
+	gsURL, err := url.Parse(src.Prefix())
+	if err != nil {
+		return fmt.Errorf("parsing GCS prefix URL: %v", err)
+	}
+
+	gsURL = gsURL.JoinPath(j.Channel, "boards", j.board, j.Version, j.GCE.Image)
+
+	// Check for any with the same version but possibly different dates.
+	if j.DryRun {
+		plog.Noticef("Would create GCE image %s", name)
+		return nil
+	}
+
+	// Download the image from the webserver, to temporary upload it on GCS.
+	// To create the Image on GCE, it's required to have a GCS URL.
+	imgURL, err := url.Parse(j.sourceURL)
+	if err != nil {
+		return fmt.Errorf("parsing webserver source URL: %v", err)
+	}
+
+	imgURL = imgURL.JoinPath(j.GCE.Image)
+
+	// verify key is set to "" to use the embedded one.
+	if err := sdk.DownloadSignedFile(j.GCE.Image, imgURL.String(), &http.Client{}, ""); err != nil {
+		return fmt.Errorf("downloading GCE image from webserver: %v", err)
+	}
+
+	f, err := os.Open(j.GCE.Image)
+	if err != nil {
+		return fmt.Errorf("opening GCE image: %v", err)
+	}
+
+	defer f.Close()
+
+	o := gs.Object{Name: gsURL.String()}
+
+	// Required to overwrite an existing image.
+	src.WriteAlways(true)
+
+	if err := src.Upload(ctx, &o, f); err != nil {
+		return fmt.Errorf("uploading GCE image to GCS: %v", err)
+	}
+
+	obj := src.Object(gsURL.String())
+	if obj == nil {
+		return fmt.Errorf("GCE image not found %s%s", src.URL(), j.GCE.Image)
+	}
+
+	imageLink, err := j.gceUploadImage(api, obj, name, desc)
+	if err != nil {
+		return err
+	}
+
+	// Released images should be public
+	plog.Noticef("Setting image to have public access: %v", name)
+	err = api.SetImagePublic(name)
+	if err != nil {
+		return fmt.Errorf("marking GCE image with public ACLs failed: %v", err)
+	}
+
+	if j.GCE.Publish != "" {
+		obj := gs.Object{
+			Name:        src.Prefix() + j.GCE.Publish,
+			ContentType: "text/plain",
+		}
+		media := strings.NewReader(
+			fmt.Sprintf("projects/%s/global/images/%s\n",
+				j.GCE.Project, name))
+		if err := src.Upload(ctx, &obj, media); err != nil {
+			return err
+		}
+	} else {
+		plog.Notice("GCE image name publishing disabled.")
+	}
+
+	var pendings []*gcloud.Pending
+	for _, old := range oldImages {
+		if old.Deprecated != nil && old.Deprecated.State != "" {
+			continue
+		}
+		plog.Noticef("Deprecating old image %s", old.Name)
+		pending, err := api.DeprecateImage(old.Name, gcloud.DeprecationStateDeprecated, imageLink)
+		if err != nil {
+			return err
+		}
+		pending.Interval = 1 * time.Second
+		pending.Timeout = 0
+		pendings = append(pendings, pending)
+	}
+
+	if j.GCE.Limit > 0 && len(oldImages) > j.GCE.Limit {
+		plog.Noticef("Pruning %d GCE images.", len(oldImages)-j.GCE.Limit)
+		for _, old := range oldImages[j.GCE.Limit:] {
+			plog.Noticef("Deleting old image %s", old.Name)
+			pending, err := api.DeleteImage(old.Name)
+			if err != nil {
+				return err
+			}
+			pending.Interval = 1 * time.Second
+			pending.Timeout = 0
+			pendings = append(pendings, pending)
+		}
+	}
+
+	plog.Infof("Waiting on %d operations.", len(pendings))
+	for _, pending := range pendings {
+		if err := pending.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *job) doAzure() error {
+	if j.Azure.StorageAccount == "" {
+		plog.Notice("Azure image creation disabled, skipping.")
+		return nil
+	}
+
+	if j.AzureProfile == "" {
+		plog.Notice("No Azure profile defined, skipping.")
+		return nil
+	}
+
+	blobName := j.AzureBlobName(j.board)
+
+	for _, environment := range j.Azure.Environments {
+		api, err := azure.New(&azure.Options{
+			AzureProfile:      j.AzureProfile,
+			AzureAuthLocation: j.AzureAuth,
+			AzureSubscription: environment.SubscriptionName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Azure API: %v", err)
+		}
+		if err := api.SetupClients(); err != nil {
+			return fmt.Errorf("setting up clients: %v", err)
+		}
+
+		plog.Printf("Fetching Azure storage credentials for %q in %q", j.Azure.StorageAccount, j.Azure.ResourceGroup)
+
+		storageKey, err := api.GetStorageServiceKeysARM(j.Azure.StorageAccount, j.Azure.ResourceGroup)
+		if err != nil {
+			return fmt.Errorf("fetching storage key: %v", err)
+		}
+		if storageKey.Keys == nil {
+			return fmt.Errorf("no storage service keys found")
+		}
+
+		container := j.Azure.Container
+		if j.AzureTestContainer != "" {
+			container = j.AzureTestContainer
+		}
+
+		plog.Printf("Signing %q in %q on %v...", blobName, container, environment.SubscriptionName)
+
+		var url string
+		for _, key := range *storageKey.Keys {
+			var blobExists bool
+			blobExists, err = api.BlobExists(j.Azure.StorageAccount, *key.Value, container, blobName)
+			if err != nil {
+				continue
+			}
+			if !blobExists {
+				plog.Notice("Blob does not exist, skipping.")
+				return nil
+			}
+			url, err = api.SignBlob(j.Azure.StorageAccount, *key.Value, container, blobName)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("signing failed: %v", err)
+		}
+		plog.Noticef("Generated SAS: %q for %q", url, j.Channel)
+		plog.Noticef("Please update the SKU manually (or try to automate this step)!")
+	}
+	return nil
+}
+
+func (j *job) doAWS(ctx context.Context) error {
+	if j.AWS.Image == "" || j.AWSCredentialsFile == "" {
+		plog.Notice("AWS image creation disabled.")
+		return nil
+	}
+
+	awsImageMetadata, err := j.awsImageMetadata()
+	if err != nil {
+		return err
+	}
+
+	imageName := awsImageMetadata["imageName"]
+
+	type target struct {
+		part   *AWSPartitionSpec
+		region string
+	}
+	var targets []target
+	for i := range j.AWS.Partitions {
+		for _, region := range j.AWS.Partitions[i].Regions {
+			targets = append(targets, target{&j.AWS.Partitions[i], region})
+		}
+	}
+
+	err = worker.ForEach(ctx, j.Parallel, len(targets), func(ctx context.Context, i int) error {
+		part, region := targets[i].part, targets[i].region
+		if j.DryRun {
+			plog.Printf("Checking for images in %v %v...", part.Name, region)
+		} else {
+			plog.Printf("Publishing images in %v %v...", part.Name, region)
+		}
+
+		api, err := aws.New(&aws.Options{
+			CredentialsFile: j.AWSCredentialsFile,
+			Profile:         part.Profile,
+			Region:          region,
+		})
+		if err != nil {
+			return fmt.Errorf("creating client for %v %v: %v", part.Name, region, err)
+		}
+
+		publish := func(imageName string) error {
+			imageID, err := api.FindImage(imageName)
+			if err != nil {
+				return fmt.Errorf("couldn't find image %q in %v %v: %v", imageName, part.Name, region, err)
+			}
+
+			if !j.DryRun {
+				err := api.PublishImage(imageID)
+				if err != nil {
+					return fmt.Errorf("couldn't publish image in %v %v: %v", part.Name, region, err)
+				}
+			}
+
+			// Publish on AWS Marketplace AMIs in us-east-1.
+			if j.PublishMarketplace && region == "us-east-1" {
+				// Create a new API client to consume the AWS Marketplace credentials.
+				marketplace, err := aws.New(&aws.Options{
+					CredentialsFile: j.AWSMarketplaceCredentialsFile,
+					Profile:         "default",
+					Region:          "us-east-1",
+				})
+				if err != nil {
+					return fmt.Errorf("creating API Marketplace client: %w", err)
+				}
+
+				// Define the launch instance type based on the arch.
+				instanceType := "t3.medium"
+				if j.board == "arm64-usr" {
+					instanceType = "m6g.medium"
+				}
+
+				for _, pid := range j.ProductIDs {
+					if err := marketplace.UpdateProduct(imageID, j.AccessRoleARN, j.Username, j.Version, pid, instanceType, j.DryRun); err != nil {
+						return fmt.Errorf("updating product with ID %s: %w", pid, err)
+					}
+				}
+
+			}
+
+			return nil
+		}
+
+		return publish(imageName + "-hvm")
+	}, worker.LogProgress(plog, "publishing AWS images"))
+	if err != nil {
+		return fmt.Errorf("publishing AWS release: %v", err)
+	}
+	return nil
+}
@@ -48,6 +48,29 @@ func RetryConditional(attempts int, delay time.Duration, shouldRetry func(err er
 	return err
 }
 
+// RetryBackoff is like RetryConditional but doubles the delay after each
+// call of f, up to maxDelay.
+func RetryBackoff(attempts int, delay, maxDelay time.Duration, shouldRetry func(err error) bool, f func() error) error {
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		err = f()
+		if err == nil || !shouldRetry(err) {
+			break
+		}
+
+		if i < attempts-1 {
+			time.Sleep(delay)
+			delay *= 2
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+		}
+	}
+
+	return err
+}
+
 func WaitUntilReady(timeout, delay time.Duration, checkFunction func() (bool, error)) error {
 	after := time.After(timeout)
 	for {